@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"file-counter/pkg/kube"
+	"file-counter/pkg/output"
+	"file-counter/pkg/scanner"
+)
+
+// agentTarget is one volume scanned by runAgent.
+type agentTarget struct {
+	path   string
+	labels map[string]string
+}
+
+// agentConfig is the -config file of the agent, so that a fleet can be
+// deployed with one file per host or environment. Flags given on the
+// command line take precedence; labels from both are merged.
+type agentConfig struct {
+	Push        string            `json:"push"`
+	Hostname    string            `json:"hostname"`
+	Environment string            `json:"environment"`
+	Labels      map[string]string `json:"labels"`
+	Volumes     []string          `json:"volumes"` // [NAME=]PATH, as arguments
+	KubeletDir  string            `json:"kubelet_dir"`
+	Node        string            `json:"node"`
+}
+
+func loadAgentConfig(name string) (*agentConfig, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var cfg agentConfig
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return &cfg, nil
+}
+
+// runAgent scans persistent volumes from inside a Kubernetes Job or
+// DaemonSet and pushes a labelled summary for each to a collector.
+func runAgent(args []string) int {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	push := fs.String("push", "", "POST each volume's JSON summary to this collector `URL`")
+	kubeletDir := fs.String("kubelet-dir", "", "scan every persistent volume mounted on this node, found under the kubelet's pods `dir` (e.g. /var/lib/kubelet/pods)")
+	node := fs.String("node", os.Getenv("NODE_NAME"), "node `name` used to look up pods in -kubelet-dir mode")
+	hostname := fs.String("hostname", "", "report this `name` as the host instead of the machine's hostname")
+	env := fs.String("env", "", "tag every summary with this `environment` (e.g. prod, staging)")
+	configPath := fs.String("config", "", "read settings from this JSON `file`; flags override it")
+	var labelSpecs stringList
+	fs.Var(&labelSpecs, "label", "add `key=value` to every summary; repeatable")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: file-counter agent [-config file] [-push URL] [-env name] [-label k=v] [NAME=]PATH...")
+		fmt.Fprintln(os.Stderr, "       file-counter agent [-config file] [-push URL] -kubelet-dir /var/lib/kubelet/pods")
+		fmt.Fprintln(os.Stderr, "Scans mounted persistent volumes and reports them labelled with host, environment, pod and namespace.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	extra, err := parseLabels(labelSpecs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	volumes := fs.Args()
+	if *configPath != "" {
+		cfg, err := loadAgentConfig(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		set := map[string]bool{}
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		for _, opt := range []struct {
+			flag  string
+			value *string
+			cfg   string
+		}{
+			{"push", push, cfg.Push},
+			{"hostname", hostname, cfg.Hostname},
+			{"env", env, cfg.Environment},
+			{"kubelet-dir", kubeletDir, cfg.KubeletDir},
+			{"node", node, cfg.Node},
+		} {
+			if !set[opt.flag] && opt.cfg != "" {
+				*opt.value = opt.cfg
+			}
+		}
+		for k, v := range cfg.Labels {
+			if _, ok := extra[k]; !ok {
+				extra[k] = v
+			}
+		}
+		if len(volumes) == 0 {
+			volumes = cfg.Volumes
+		}
+	}
+
+	var targets []agentTarget
+	switch {
+	case *kubeletDir != "" && len(volumes) == 0:
+		targets, err = nodeVolumes(*kubeletDir, *node)
+	case *kubeletDir == "" && len(volumes) > 0:
+		targets = podVolumes(volumes)
+	default:
+		fs.Usage()
+		return exitError
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	code := exitOK
+	fmt.Printf("%-20s %-30s %10s %10s\n", "Namespace", "Claim", "Files", "Size")
+	for _, t := range targets {
+		for k, v := range extra {
+			t.labels[k] = v
+		}
+		result := scanner.NewScannerWithOptions(scanner.Options{Quiet: true}).Start(t.path)
+		fmt.Printf("%-20s %-30s %10d %10s\n", t.labels["namespace"], t.labels["pvc"], result.TotalFiles, scanner.FormatBytes(result.TotalBytes))
+		if result.TotalErrors > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %d entries could not be read\n", t.path, result.TotalErrors)
+		}
+		if *push == "" {
+			continue
+		}
+		out, err := output.Open(output.Spec{Format: "push", Target: *push, Host: *hostname, Environment: *env, Labels: t.labels}, t.path)
+		if err == nil {
+			err = closeOutputs([]output.Output{out}, result)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", t.path, err)
+			code = exitError
+		}
+	}
+	return code
+}
+
+// podVolumes labels volumes mounted into the agent's own pod, as in a Job.
+// Pod, namespace and node come from the POD_NAME, POD_NAMESPACE and
+// NODE_NAME variables, which a manifest sets with the Downward API.
+func podVolumes(args []string) []agentTarget {
+	var targets []agentTarget
+	for _, arg := range args {
+		name, path, ok := strings.Cut(arg, "=")
+		if !ok {
+			path, name = arg, filepath.Base(arg)
+		}
+		labels := map[string]string{"pvc": name}
+		for key, env := range map[string]string{"namespace": "POD_NAMESPACE", "pod": "POD_NAME", "node": "NODE_NAME"} {
+			if v := os.Getenv(env); v != "" {
+				labels[key] = v
+			}
+		}
+		targets = append(targets, agentTarget{path: path, labels: labels})
+	}
+	return targets
+}
+
+// nodeVolumes finds every persistent volume the kubelet has mounted on this
+// node, as in a DaemonSet, and labels it with its pod and claim from the
+// API server. Without API access the pod UID and volume name are used.
+func nodeVolumes(kubeletDir, node string) ([]agentTarget, error) {
+	volumes, err := kube.KubeletVolumes(kubeletDir)
+	if err != nil {
+		return nil, err
+	}
+
+	pods := map[string]kube.Pod{}
+	client, err := kube.InCluster()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; volumes are labelled by pod UID only\n", err)
+	} else if node != "" {
+		list, err := client.Pods(node)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: listing pods: %v\n", err)
+		}
+		for _, p := range list {
+			pods[p.UID] = p
+		}
+	}
+
+	var targets []agentTarget
+	for _, v := range volumes {
+		labels := map[string]string{"pod_uid": v.PodUID, "volume": v.Name, "pvc": v.Name}
+		if node != "" {
+			labels["node"] = node
+		}
+		if p, ok := pods[v.PodUID]; ok {
+			labels["pod"], labels["namespace"] = p.Name, p.Namespace
+		}
+		if client != nil {
+			// Persistent volumes are mounted under their PV name; inline
+			// volumes are not PVs and simply aren't found.
+			if claim, err := client.PersistentVolume(v.Name); err == nil {
+				labels["pvc"], labels["namespace"] = claim.Name, claim.Namespace
+				if claim.StorageClass != "" {
+					labels["storage_class"] = claim.StorageClass
+				}
+			}
+		}
+		targets = append(targets, agentTarget{path: v.Path, labels: labels})
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		a, b := targets[i].labels, targets[j].labels
+		if a["namespace"] != b["namespace"] {
+			return a["namespace"] < b["namespace"]
+		}
+		return a["pvc"] < b["pvc"]
+	})
+	return targets, nil
+}
+
+// parseLabels parses key=value flag values.
+func parseLabels(specs []string) (map[string]string, error) {
+	labels := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		k, v, ok := strings.Cut(spec, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", spec)
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
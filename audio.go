@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"file-counter/pkg/media"
+	"file-counter/pkg/scanner"
+)
+
+// audioShown caps how many artists, albums and untagged files the report
+// lists.
+const audioShown = 20
+
+// audioSink tallies audio files by artist and album from their tags, as
+// read by the media probe, and notes the files missing tags.
+type audioSink struct {
+	total    mediaTally
+	formats  map[string]int64
+	artists  map[string]*mediaTally
+	albums   map[string]*mediaTally
+	missing  map[string]int64 // by tag
+	untagged []string
+	count    int64 // files missing any tag
+}
+
+// newAudioSink adds the audio library report to opts; it needs
+// inspectMedia.
+func newAudioSink(opts *scanner.Options) *audioSink {
+	s := &audioSink{
+		formats: map[string]int64{},
+		artists: map[string]*mediaTally{},
+		albums:  map[string]*mediaTally{},
+		missing: map[string]int64{},
+	}
+	opts.Sinks = append(opts.Sinks, s)
+	return s
+}
+
+func (s *audioSink) Write(rec *scanner.FileRecord) error {
+	m, ok := inspection[*media.Info](rec)
+	if !ok || m.Kind != "audio" {
+		return nil
+	}
+	s.total.files++
+	s.total.bytes += rec.Size
+	s.total.duration += m.Duration
+	s.formats[m.Format]++
+
+	var missing []string
+	for _, tag := range []struct{ name, value string }{
+		{"artist", m.Artist},
+		{"album", m.Album},
+		{"title", m.Title},
+	} {
+		if tag.value == "" {
+			missing = append(missing, tag.name)
+			s.missing[tag.name]++
+		}
+	}
+	if len(missing) > 0 {
+		s.count++
+		if len(s.untagged) < audioShown {
+			s.untagged = append(s.untagged, fmt.Sprintf("%s (no %s)", rec.Path, strings.Join(missing, ", ")))
+		}
+	}
+
+	if m.Artist != "" {
+		addTally(s.artists, m.Artist, rec.Size, m)
+	}
+	if m.Album != "" {
+		// Albums are told apart by artist, since many share a title.
+		artist := m.AlbumArtist
+		if artist == "" {
+			artist = m.Artist
+		}
+		addTally(s.albums, artist+" - "+m.Album, rec.Size, m)
+	}
+	return nil
+}
+
+func addTally(tallies map[string]*mediaTally, key string, size int64, m *media.Info) {
+	t := tallies[key]
+	if t == nil {
+		t = &mediaTally{}
+		tallies[key] = t
+	}
+	t.files++
+	t.bytes += size
+	t.duration += m.Duration
+}
+
+// report prints the playing time of the library, the artists and albums
+// with the most tracks, and the files missing tags.
+func (s *audioSink) report() {
+	fmt.Printf("\n=== AUDIO LIBRARY ===\n")
+	fmt.Printf("Tracks: %d (%s), %s\n", s.total.files, scanner.FormatBytes(s.total.bytes), hours(s.total.duration))
+	if s.total.files == 0 {
+		return
+	}
+	fmt.Printf("  Formats: %s\n", countList(s.formats))
+	for _, list := range []struct {
+		name    string
+		tallies map[string]*mediaTally
+	}{
+		{"Artists", s.artists},
+		{"Albums", s.albums},
+	} {
+		fmt.Printf("%s: %d\n", list.name, len(list.tallies))
+		for i, name := range mostFiles(list.tallies) {
+			if i == audioShown {
+				fmt.Printf("  ... and %d more\n", len(list.tallies)-i)
+				break
+			}
+			t := list.tallies[name]
+			fmt.Printf("  %s: %d tracks, %s\n", name, t.files, t.duration.Round(time.Second))
+		}
+	}
+	if s.count == 0 {
+		fmt.Println("Missing Tags: none")
+		return
+	}
+	fmt.Printf("Missing Tags: %d files (no artist %d, no album %d, no title %d)\n",
+		s.count, s.missing["artist"], s.missing["album"], s.missing["title"])
+	for _, f := range s.untagged {
+		fmt.Printf("  %s\n", f)
+	}
+	if s.count > int64(len(s.untagged)) {
+		fmt.Printf("  ... and %d more\n", s.count-int64(len(s.untagged)))
+	}
+}
+
+// mostFiles returns the keys of tallies, those with the most files first.
+func mostFiles(tallies map[string]*mediaTally) []string {
+	keys := make([]string, 0, len(tallies))
+	for k := range tallies {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := tallies[keys[i]], tallies[keys[j]]
+		if a.files != b.files {
+			return a.files > b.files
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
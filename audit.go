@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"file-counter/pkg/output"
+	"file-counter/pkg/scanner"
+)
+
+// auditBatch is how many large files are sent to the webhook per request.
+const auditBatch = 100
+
+var auditClient = &http.Client{Timeout: 30 * time.Second}
+
+// auditEvent is one large file, as logged and sent to the webhook.
+type auditEvent struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	Owner   string    `json:"owner,omitempty"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// auditSink logs every file of at least min bytes, one logfmt line each,
+// and posts them in batches to a webhook. Webhook failures are reported
+// when the scan ends rather than stopping it.
+type auditSink struct {
+	min     int64
+	log     *bufio.Writer
+	closer  io.Closer
+	webhook string
+	host    string
+	root    string
+	pending []auditEvent
+	files   int64
+	bytes   int64
+	err     error
+}
+
+// newAuditSink logs to logPath, or to stderr if it is empty or "-".
+func newAuditSink(min int64, logPath, webhook, root string) (*auditSink, error) {
+	a := &auditSink{min: min, webhook: webhook, root: root}
+	a.host, _ = os.Hostname()
+	var w io.Writer = os.Stderr
+	if logPath != "" && logPath != "-" {
+		f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, err
+		}
+		w, a.closer = f, f
+	}
+	a.log = bufio.NewWriter(w)
+	return a, nil
+}
+
+func (a *auditSink) Write(rec *scanner.FileRecord) error {
+	if rec.IsDir || rec.Size < a.min {
+		return nil
+	}
+	ev := auditEvent{Path: rec.Path, Size: rec.Size, Owner: output.OwnerName(rec), ModTime: rec.ModTime.UTC()}
+	a.files++
+	a.bytes += ev.Size
+	fmt.Fprintf(a.log, "time=%s event=large_file path=%s size=%d owner=%s mtime=%s\n",
+		time.Now().UTC().Format(time.RFC3339), strconv.Quote(ev.Path), ev.Size, strconv.Quote(ev.Owner), ev.ModTime.Format(time.RFC3339))
+	if a.log.Buffered() > 0 && a.closer == nil {
+		a.log.Flush() // interleaved with the report on stderr
+	}
+	if a.webhook != "" {
+		a.pending = append(a.pending, ev)
+		if len(a.pending) >= auditBatch {
+			a.send()
+		}
+	}
+	return nil
+}
+
+// send posts the pending events; the first failure is kept for report.
+func (a *auditSink) send() {
+	if len(a.pending) == 0 {
+		return
+	}
+	body, _ := json.Marshal(map[string]any{
+		"event":     "large_files",
+		"host":      a.host,
+		"root":      a.root,
+		"threshold": a.min,
+		"files":     a.pending,
+	})
+	a.pending = a.pending[:0]
+	resp, err := auditClient.Post(a.webhook, "application/json", bytes.NewReader(body))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("%s", resp.Status)
+		}
+	}
+	if err != nil && a.err == nil {
+		a.err = fmt.Errorf("audit webhook: %w", err)
+	}
+}
+
+func (a *auditSink) Close() error {
+	if a.webhook != "" {
+		a.send()
+	}
+	err := a.log.Flush()
+	if a.closer != nil {
+		if cerr := a.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if a.err != nil {
+		return a.err
+	}
+	return err
+}
+
+// report prints the totals of the audit.
+func (a *auditSink) report() {
+	fmt.Printf("Files Over %s: %d, %s\n", scanner.FormatBytes(a.min), a.files, scanner.FormatBytes(a.bytes))
+}
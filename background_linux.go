@@ -0,0 +1,45 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+	backgroundNice   = 19
+)
+
+// backgroundPriority describes what -background does here.
+const backgroundPriority = "idle I/O class, nice 19"
+
+// enterBackground moves the process to the idle I/O scheduling class and the
+// lowest CPU priority. Both are per-thread attributes on Linux, so they are
+// applied to every thread that exists now; threads the runtime starts later
+// inherit them from the thread that creates them.
+func enterBackground() error {
+	tids, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+
+	prio := uintptr(ioprioClassIdle << ioprioClassShift)
+	for _, entry := range tids {
+		tid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), prio); errno != 0 && errno != syscall.ESRCH {
+			return os.NewSyscallError("ioprio_set", errno)
+		}
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, backgroundNice); err != nil && err != syscall.ESRCH {
+			return os.NewSyscallError("setpriority", err)
+		}
+	}
+	return nil
+}
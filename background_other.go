@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+const backgroundPriority = ""
+
+func enterBackground() error {
+	return errors.New("-background is not supported on this platform")
+}
@@ -0,0 +1,22 @@
+//go:build unix && !linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+const backgroundNice = 19
+
+// backgroundPriority describes what -background does here.
+const backgroundPriority = "nice 19"
+
+// enterBackground lowers the CPU priority. These platforms have no portable
+// I/O priority call, but most schedule I/O for niced processes lower too.
+func enterBackground() error {
+	if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, backgroundNice); err != nil {
+		return os.NewSyscallError("setpriority", err)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"file-counter/pkg/scanner"
+	"file-counter/pkg/snapshot"
+)
+
+// runBaseline records path, size, mtime, mode and hash for every file under a root.
+func runBaseline(args []string) int {
+	fs := flag.NewFlagSet("baseline", flag.ExitOnError)
+	output := fs.String("o", "baseline.json", "file to store the baseline in")
+	hashCache := fs.Bool("hash-cache", false, "reuse the hashes of files unchanged since an earlier -hash-cache run instead of reading them again")
+	saveErrors := fs.String("save-errors", "", "leave out entries that can't be read instead of failing, and save their paths to this JSON `file` for 'file-counter rescan-errors'")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: file-counter baseline [-o baseline.json] [-hash-cache] [-save-errors errors.json] <path>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitError
+	}
+
+	opts := snapshot.Options{Hash: true, Skip: samePath(*output)}
+	if *hashCache {
+		opts.HashCache = openHashCache()
+	}
+	var failures []snapshot.Failure
+	if *saveErrors != "" {
+		skipOutput, skipErrors := opts.Skip, samePath(*saveErrors)
+		opts.Skip = func(path string) bool { return skipOutput(path) || skipErrors(path) }
+		opts.OnError = func(f snapshot.Failure) { failures = append(failures, f) }
+	}
+	snap, err := snapshot.Build(fs.Arg(0), opts)
+	saveHashCache(opts.HashCache)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning %s: %v\n", fs.Arg(0), err)
+		return exitError
+	}
+	if err := snap.Save(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving baseline: %v\n", err)
+		return exitError
+	}
+
+	fmt.Printf("Baseline of %s saved to %s (%d files, %s)\n",
+		snap.Root, *output, snap.TotalFiles, scanner.FormatBytes(snap.TotalBytes))
+	if *saveErrors != "" {
+		abs, _ := filepath.Abs(*output)
+		list := &snapshot.Failures{Version: snapshot.Version, Root: snap.Root, Snapshot: abs, CreatedAt: snap.CreatedAt, Failures: failures}
+		if err := list.Save(*saveErrors); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving error list: %v\n", err)
+			return exitError
+		}
+		if len(failures) > 0 {
+			fmt.Printf("%d entries could not be read; 'file-counter rescan-errors %s' scans them again\n", len(failures), *saveErrors)
+		}
+	}
+	if opts.HashCache != nil {
+		fmt.Printf("Hash cache: %s\n", hashCacheSummary(opts.HashCache))
+	}
+	return exitOK
+}
+
+// runCheck re-scans a baselined tree and reports every file that changed since.
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	baselinePath := fs.String("baseline", "baseline.json", "baseline file created by 'file-counter baseline'")
+	quiet := fs.Bool("q", false, "only print the summary counts")
+	budget := addBudgetFlags(fs)
+	maxGrowth := fs.String("max-growth", "", "compare only the total size with the baseline, and fail when it grew by more than this percentage (e.g. 10%) or `size`")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: file-counter check [-baseline baseline.json] [-max-growth limit] [-q] [path]")
+		fmt.Fprintln(os.Stderr, "       file-counter check [-max-size size] [-max-files n] [-max-dirs n] [-max-dir-entries n] [-quota [dir/]glob=size] [-alert-log file] [-alert-webhook URL] [-exclude pattern] [path]")
+		fmt.Fprintln(os.Stderr, "The first form compares the tree with a baseline, or only its growth with -max-growth; the path defaults to the root recorded in it.")
+		fmt.Fprintln(os.Stderr, "The second checks the tree below path (default .) against size and count budgets, e.g. in CI.")
+		fmt.Fprintln(os.Stderr, "Exit status is 0 when nothing changed or all budgets hold, 1 when changes were found or a budget is exceeded, 2 on error.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return exitError
+	}
+	if budget.set() {
+		root := "."
+		if fs.NArg() == 1 {
+			root = fs.Arg(0)
+		}
+		return budget.check(root, *quiet)
+	}
+	var growth growthLimit
+	if *maxGrowth != "" {
+		var err error
+		if growth, err = parseGrowth(*maxGrowth); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -max-growth: %v\n", err)
+			return exitError
+		}
+	}
+
+	base, err := snapshot.Load(*baselinePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading baseline: %v\n", err)
+		return exitError
+	}
+	root := base.Root
+	if fs.NArg() == 1 {
+		root = fs.Arg(0)
+	}
+
+	// Growth only needs sizes, so skip hashing.
+	current, err := snapshot.Build(root, snapshot.Options{Hash: *maxGrowth == "", Skip: samePath(*baselinePath)})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning %s: %v\n", root, err)
+		return exitError
+	}
+	if *maxGrowth != "" {
+		return checkGrowth(base, current, growth, *budget.top, *quiet)
+	}
+	diff := snapshot.Compare(base, current)
+
+	if !*quiet {
+		for _, c := range diff.Added {
+			fmt.Printf("ADDED     %s\n", c.Path)
+		}
+		for _, c := range diff.Removed {
+			fmt.Printf("REMOVED   %s\n", c.Path)
+		}
+		for _, c := range diff.Modified {
+			fmt.Printf("MODIFIED  %s (%s)\n", c.Path, strings.Join(c.Fields, ", "))
+		}
+	}
+
+	fmt.Printf("\n=== CHECK RESULTS ===\n")
+	fmt.Printf("Baseline: %s (%s)\n", base.Root, base.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("Unchanged: %d\n", diff.Unchanged)
+	fmt.Printf("Added: %d\n", len(diff.Added))
+	fmt.Printf("Removed: %d\n", len(diff.Removed))
+	fmt.Printf("Modified: %d\n", len(diff.Modified))
+
+	if !diff.Empty() {
+		return exitChanged
+	}
+	return exitOK
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"file-counter/pkg/scanner"
+)
+
+// budgetFlags are the limits check enforces in budget mode, for keeping
+// repositories and artifact directories within size budgets in CI.
+type budgetFlags struct {
+	maxSize  *string
+	maxFiles *int64
+	maxDirs  *int64
+	// maxEntries limits each directory rather than the tree.
+	maxEntries *int64
+	// quotas limit the files matching a pattern, as [dir/]glob=size.
+	quotas       stringList
+	top          *int
+	alertLog     *string
+	alertWebhook *string
+	filter       func() *scanner.Filter
+}
+
+func addBudgetFlags(fs *flag.FlagSet) *budgetFlags {
+	b := &budgetFlags{
+		maxSize:      fs.String("max-size", "", "fail when the files below path take up more than this `size` (e.g. 500MB)"),
+		maxFiles:     fs.Int64("max-files", 0, "fail when there are more than `n` files below path"),
+		maxDirs:      fs.Int64("max-dirs", 0, "fail when there are more than `n` directories below path"),
+		maxEntries:   fs.Int64("max-dir-entries", 0, "fail when any directory holds more than `n` files and subdirectories directly"),
+		top:          fs.Int("top", 10, "list the `n` largest files when -max-size is exceeded, and at most n directories over -max-dir-entries"),
+		alertLog:     fs.String("alert-log", "", "append a line for every exceeded budget to this `file` (\"-\" for stderr)"),
+		alertWebhook: fs.String("alert-webhook", "", "POST the exceeded budgets as JSON to this `URL`"),
+		filter:       filterFlags(fs),
+	}
+	fs.Var(&b.quotas, "quota", "fail when the files whose names match glob, below dir if given, take up more than size, as `[dir/]glob=size` (e.g. var/*.log=20G); repeatable")
+	return b
+}
+
+// set reports whether any budget was given.
+func (b *budgetFlags) set() bool {
+	return *b.maxSize != "" || *b.maxFiles > 0 || *b.maxDirs > 0 || *b.maxEntries > 0 || len(b.quotas) > 0
+}
+
+// check scans root and reports each budget, returning exitChanged when
+// one is exceeded.
+func (b *budgetFlags) check(root string, quiet bool) int {
+	var maxSize int64
+	if *b.maxSize != "" {
+		var err error
+		if maxSize, err = scanner.ParseBytes(*b.maxSize); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -max-size: %v\n", err)
+			return exitError
+		}
+		if maxSize <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: -max-size must be larger than 0\n")
+			return exitError
+		}
+	}
+	if _, err := os.Stat(root); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	quotas, err := parseQuotas(b.quotas, root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -quota: %v\n", err)
+		return exitError
+	}
+
+	largest := &largestFiles{n: *b.top}
+	entries := &dirEntries{root: filepath.Clean(root), counts: map[string]int64{}}
+	sinks := []scanner.Sink{largest}
+	if *b.maxEntries > 0 {
+		sinks = append(sinks, entries)
+	}
+	if len(quotas) > 0 {
+		sinks = append(sinks, quotaSink(quotas))
+	}
+	result := scanner.NewScannerWithOptions(scanner.Options{
+		Quiet:          true,
+		DedupHardlinks: true,
+		Filter:         b.filter(),
+		Sinks:          sinks,
+	}).Start(root)
+	if !result.Completed {
+		fmt.Fprintf(os.Stderr, "Error: the scan of %s did not complete\n", root)
+		return exitError
+	}
+
+	fmt.Printf("=== BUDGET CHECK ===\n")
+	fmt.Printf("Path: %s\n", root)
+	var alerts []budgetAlert
+	report := func(name string, used, limit int64, format func(int64) string) bool {
+		if limit <= 0 {
+			return false
+		}
+		over := used > limit
+		status := "ok"
+		if over {
+			status = "EXCEEDED"
+			alerts = append(alerts, budgetAlert{Budget: name, Used: used, Limit: limit})
+		}
+		fmt.Printf("%-6s %s of %s (%.0f%%) %s\n", name+":", format(used), format(limit), 100*float64(used)/float64(limit), status)
+		return over
+	}
+	count := func(n int64) string { return fmt.Sprint(n) }
+	sizeOver := report("Size", result.TotalBytes, maxSize, scanner.FormatBytes)
+	report("Files", result.TotalFiles, *b.maxFiles, count)
+	report("Dirs", result.TotalDirs, *b.maxDirs, count)
+	for _, q := range quotas {
+		report("Quota "+q.name, q.used, q.limit, scanner.FormatBytes)
+	}
+	var crowded []dirCount
+	if *b.maxEntries > 0 {
+		crowded = entries.over(*b.maxEntries)
+		busiest := entries.busiest()
+		status := "ok"
+		if len(crowded) > 0 {
+			status = fmt.Sprintf("EXCEEDED in %d directories", len(crowded))
+			alerts = append(alerts, budgetAlert{Budget: "Entries in " + crowded[0].dir, Used: crowded[0].n, Limit: *b.maxEntries})
+		}
+		fmt.Printf("Most entries in one directory: %d of %d (%s) %s\n", busiest.n, *b.maxEntries, busiest.dir, status)
+	}
+
+	if sizeOver && !quiet && len(largest.files) > 0 {
+		fmt.Printf("\nLargest files:\n")
+		for _, rec := range largest.files {
+			fmt.Printf("  %10s  %s\n", scanner.FormatBytes(rec.Size), rec.Path)
+		}
+	}
+	if len(crowded) > 0 && !quiet {
+		fmt.Printf("\nDirectories over %d entries:\n", *b.maxEntries)
+		for i, d := range crowded {
+			if i == *b.top {
+				fmt.Printf("  ... and %d more\n", len(crowded)-i)
+				break
+			}
+			fmt.Printf("  %10d  %s\n", d.n, d.dir)
+		}
+	}
+	if result.TotalErrors > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d entries could not be read, so the totals may be low\n", result.TotalErrors)
+	}
+	if len(alerts) > 0 {
+		if err := sendAlerts(alerts, root, *b.alertLog, *b.alertWebhook); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		return exitChanged
+	}
+	return exitOK
+}
+
+// quota limits the bytes of the files whose names match glob, below dir
+// or anywhere when dir is empty.
+type quota struct {
+	name  string
+	dir   string
+	glob  string
+	limit int64
+	used  int64
+}
+
+// parseQuotas parses -quota specs. Directories are relative to root, or
+// absolute, and are made to match the paths a scan of root produces.
+func parseQuotas(specs []string, root string) ([]*quota, error) {
+	var quotas []*quota
+	for _, spec := range specs {
+		pattern, size, ok := strings.Cut(spec, "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("%q is not [dir/]glob=size", spec)
+		}
+		limit, err := scanner.ParseBytes(size)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", spec, err)
+		}
+		q := &quota{name: pattern, limit: limit}
+		dir, glob := filepath.Split(filepath.FromSlash(pattern))
+		if _, err := filepath.Match(glob, ""); err != nil || glob == "" {
+			return nil, fmt.Errorf("%s: bad pattern %q", spec, glob)
+		}
+		q.glob = glob
+		if dir != "" {
+			if filepath.IsAbs(dir) {
+				abs, err := filepath.Abs(root)
+				if err != nil {
+					return nil, err
+				}
+				if dir, err = filepath.Rel(abs, dir); err != nil {
+					return nil, err
+				}
+			}
+			q.dir = filepath.Join(root, dir)
+			q.name = fmt.Sprintf("%s under %s", glob, filepath.Clean(filepath.Join(root, dir)))
+		}
+		quotas = append(quotas, q)
+	}
+	return quotas, nil
+}
+
+// quotaSink adds up the files each quota covers.
+type quotaSink []*quota
+
+func (s quotaSink) Write(rec *scanner.FileRecord) error {
+	if rec.IsDir {
+		return nil
+	}
+	dir, name := filepath.Split(rec.Path)
+	for _, q := range s {
+		if q.dir != "" && !within(filepath.Clean(dir), q.dir) {
+			continue
+		}
+		if ok, _ := filepath.Match(q.glob, name); ok {
+			q.used += rec.Size
+		}
+	}
+	return nil
+}
+
+// within reports whether path is dir or below it.
+func within(path, dir string) bool {
+	if dir == "." {
+		return !filepath.IsAbs(path) && path != ".." && !strings.HasPrefix(path, ".."+string(filepath.Separator))
+	}
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// largestFiles keeps the n largest regular files seen, largest first.
+type largestFiles struct {
+	n     int
+	files []*scanner.FileRecord
+}
+
+func (l *largestFiles) Write(rec *scanner.FileRecord) error {
+	if rec.IsDir || !rec.Mode.IsRegular() || l.n <= 0 {
+		return nil
+	}
+	if len(l.files) == l.n && rec.Size <= l.files[l.n-1].Size {
+		return nil
+	}
+	i := sort.Search(len(l.files), func(i int) bool { return l.files[i].Size < rec.Size })
+	if len(l.files) < l.n {
+		l.files = append(l.files, nil)
+	}
+	copy(l.files[i+1:], l.files[i:])
+	l.files[i] = rec
+	return nil
+}
+
+// dirEntries counts the entries directly inside each directory below root.
+type dirEntries struct {
+	root   string
+	counts map[string]int64
+}
+
+type dirCount struct {
+	dir string
+	n   int64
+}
+
+func (d *dirEntries) Write(rec *scanner.FileRecord) error {
+	if rec.Path != d.root {
+		d.counts[filepath.Dir(rec.Path)]++
+	}
+	return nil
+}
+
+// over lists the directories with more than limit entries, fullest first.
+func (d *dirEntries) over(limit int64) []dirCount {
+	var out []dirCount
+	for dir, n := range d.counts {
+		if n > limit {
+			out = append(out, dirCount{dir, n})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].n != out[j].n {
+			return out[i].n > out[j].n
+		}
+		return out[i].dir < out[j].dir
+	})
+	return out
+}
+
+// busiest returns the directory with the most entries.
+func (d *dirEntries) busiest() dirCount {
+	best := dirCount{dir: d.root}
+	for dir, n := range d.counts {
+		if n > best.n || n == best.n && dir < best.dir {
+			best = dirCount{dir, n}
+		}
+	}
+	return best
+}
+
+// budgetAlert is one exceeded budget, as logged and sent to the webhook.
+type budgetAlert struct {
+	Budget string `json:"budget"`
+	Used   int64  `json:"used"`
+	Limit  int64  `json:"limit"`
+}
+
+// sendAlerts appends the exceeded budgets to logPath, in the key=value form
+// of the audit log, and posts them to webhook, where those are given.
+func sendAlerts(alerts []budgetAlert, root, logPath, webhook string) error {
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	if logPath != "" {
+		var w io.Writer = os.Stderr
+		if logPath != "-" {
+			f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		now := time.Now().UTC().Format(time.RFC3339)
+		for _, a := range alerts {
+			if _, err := fmt.Fprintf(w, "time=%s event=budget_exceeded root=%s budget=%s used=%d limit=%d\n",
+				now, strconv.Quote(root), strconv.Quote(a.Budget), a.Used, a.Limit); err != nil {
+				return err
+			}
+		}
+	}
+	if webhook != "" {
+		host, _ := os.Hostname()
+		body, _ := json.Marshal(map[string]any{
+			"event":   "budget_exceeded",
+			"host":    host,
+			"root":    root,
+			"budgets": alerts,
+		})
+		resp, err := auditClient.Post(webhook, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				err = fmt.Errorf("%s", resp.Status)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("alert webhook: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"file-counter/pkg/scanner"
+)
+
+// makeTree creates the files in tree, mapping slash-separated paths to
+// their contents, below a new temporary directory and returns it.
+func makeTree(t *testing.T, tree map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, data := range tree {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// runBudget runs check's budget mode on root with args and returns its
+// exit code and the budgets it reported as exceeded in its alert log.
+func runBudget(t *testing.T, root string, args ...string) (int, []string) {
+	t.Helper()
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	b := addBudgetFlags(fs)
+	log := filepath.Join(t.TempDir(), "alerts.log")
+	if err := fs.Parse(append([]string{"-alert-log", log}, args...)); err != nil {
+		t.Fatal(err)
+	}
+	if !b.set() {
+		t.Fatalf("%q sets no budget", args)
+	}
+	code := b.check(root, true)
+
+	data, err := os.ReadFile(log)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var exceeded []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		_, field, ok := strings.Cut(line, " budget=")
+		if !ok {
+			continue
+		}
+		budget, err := strconv.QuotedPrefix(field)
+		if err != nil {
+			t.Fatalf("Bad alert line %q", line)
+		}
+		budget, _ = strconv.Unquote(budget)
+		exceeded = append(exceeded, budget)
+	}
+	return code, exceeded
+}
+
+// budgetTree holds 6 files of 190 bytes in 2 directories, sub holding
+// the most entries (4).
+var budgetTree = map[string]string{
+	"a":     strings.Repeat("a", 100),
+	"b":     strings.Repeat("b", 50),
+	"sub/c": "0123456789",
+	"sub/d": "0123456789",
+	"sub/e": "0123456789",
+	"sub/f": "0123456789",
+}
+
+func TestBudgetCheck(t *testing.T) {
+	root := makeTree(t, budgetTree)
+
+	tests := []struct {
+		name     string
+		args     []string
+		code     int
+		exceeded []string
+	}{
+		{"size within", []string{"-max-size", "190"}, exitOK, nil},
+		{"size exceeded", []string{"-max-size", "189"}, exitChanged, []string{"Size"}},
+		{"files within", []string{"-max-files", "6"}, exitOK, nil},
+		{"files exceeded", []string{"-max-files", "5"}, exitChanged, []string{"Files"}},
+		{"dirs within", []string{"-max-dirs", "2"}, exitOK, nil},
+		{"dirs exceeded", []string{"-max-dirs", "1"}, exitChanged, []string{"Dirs"}},
+		{"all exceeded", []string{"-max-size", "1", "-max-files", "1", "-max-dirs", "1"}, exitChanged, []string{"Size", "Files", "Dirs"}},
+		{"excluded files don't count", []string{"-max-files", "2", "-exclude", "sub/"}, exitOK, nil},
+		{"zero size", []string{"-max-size", "0"}, exitError, nil},
+		{"bad size", []string{"-max-size", "lots"}, exitError, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, exceeded := runBudget(t, root, test.args...)
+			if code != test.code {
+				t.Errorf("Exit code %d, expected %d", code, test.code)
+			}
+			if !reflect.DeepEqual(exceeded, test.exceeded) {
+				t.Errorf("Exceeded %q, expected %q", exceeded, test.exceeded)
+			}
+		})
+	}
+
+	if code, _ := runBudget(t, filepath.Join(root, "missing"), "-max-files", "1"); code != exitError {
+		t.Errorf("Exit code %d for a missing path, expected %d", code, exitError)
+	}
+}
+
+func TestDirEntriesBudget(t *testing.T) {
+	root := makeTree(t, budgetTree)
+	sub := filepath.Join(root, "sub")
+
+	tests := []struct {
+		name     string
+		args     []string
+		code     int
+		exceeded []string
+	}{
+		{"within", []string{"-max-dir-entries", "4"}, exitOK, nil},
+		// Only the fullest directory is alerted on.
+		{"exceeded", []string{"-max-dir-entries", "2"}, exitChanged, []string{"Entries in " + sub}},
+		{"with other budgets", []string{"-max-dir-entries", "3", "-max-files", "6"}, exitChanged, []string{"Entries in " + sub}},
+		{"excluded entries don't count", []string{"-max-dir-entries", "3", "-exclude", "sub/f"}, exitOK, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, exceeded := runBudget(t, root, test.args...)
+			if code != test.code {
+				t.Errorf("Exit code %d, expected %d", code, test.code)
+			}
+			if !reflect.DeepEqual(exceeded, test.exceeded) {
+				t.Errorf("Exceeded %q, expected %q", exceeded, test.exceeded)
+			}
+		})
+	}
+}
+
+func TestParseQuotas(t *testing.T) {
+	root := filepath.FromSlash("/srv/data")
+	tests := []struct {
+		spec  string
+		name  string
+		dir   string
+		glob  string
+		limit int64
+		err   bool
+	}{
+		{spec: "*.log=1K", name: "*.log", glob: "*.log", limit: 1024},
+		{spec: "var/*.log=20", name: "*.log under " + filepath.Join(root, "var"), dir: filepath.Join(root, "var"), glob: "*.log", limit: 20},
+		{spec: "/srv/data/var/*.log=20", name: "*.log under " + filepath.Join(root, "var"), dir: filepath.Join(root, "var"), glob: "*.log", limit: 20},
+		{spec: "*.log", err: true},
+		{spec: "=1K", err: true},
+		{spec: "var/=1K", err: true},
+		{spec: "[*.log=1K", err: true},
+		{spec: "*.log=lots", err: true},
+	}
+	for _, test := range tests {
+		quotas, err := parseQuotas([]string{test.spec}, root)
+		if (err != nil) != test.err {
+			t.Errorf("parseQuotas(%q) error = %v", test.spec, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		want := quota{name: test.name, dir: test.dir, glob: test.glob, limit: test.limit}
+		if len(quotas) != 1 || *quotas[0] != want {
+			t.Errorf("parseQuotas(%q) = %+v, expected %+v", test.spec, *quotas[0], want)
+		}
+	}
+}
+
+func TestQuotaSink(t *testing.T) {
+	quotas, err := parseQuotas([]string{"*.log=1K", "var/*.log=1K", "var/cache/*=1K"}, "/srv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := quotaSink(quotas)
+	for path, size := range map[string]int64{
+		"/srv/app.log":         1,
+		"/srv/var/a.log":       10,
+		"/srv/var/old/b.log":   100,
+		"/srv/variable/c.log":  1000,
+		"/srv/var/cache/d.bin": 10000,
+		"/srv/var/e.txt":       100000,
+	} {
+		sink.Write(&scanner.FileRecord{Path: filepath.FromSlash(path), Size: size})
+	}
+	// Directories never count, even when their names match.
+	sink.Write(&scanner.FileRecord{Path: filepath.FromSlash("/srv/var/dir.log"), Size: 4096, IsDir: true})
+
+	for i, used := range []int64{1111, 110, 10000} {
+		if quotas[i].used != used {
+			t.Errorf("Quota %s used %d bytes, expected %d", quotas[i].name, quotas[i].used, used)
+		}
+	}
+}
+
+func TestQuotaBudget(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"app.log":     strings.Repeat("x", 100),
+		"var/a.log":   strings.Repeat("x", 30),
+		"var/b.log":   strings.Repeat("x", 20),
+		"var/c.txt":   strings.Repeat("x", 500),
+		"other/d.log": strings.Repeat("x", 5),
+	})
+	varLogs := "Quota *.log under " + filepath.Join(root, "var")
+	abs, err := filepath.Abs(filepath.Join(root, "var"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		code     int
+		exceeded []string
+	}{
+		{"at the limit", []string{"-quota", "*.log=155"}, exitOK, nil},
+		{"over the limit", []string{"-quota", "*.log=154"}, exitChanged, []string{"Quota *.log"}},
+		{"directory within", []string{"-quota", "var/*.log=50"}, exitOK, nil},
+		{"directory over", []string{"-quota", "var/*.log=49"}, exitChanged, []string{varLogs}},
+		{"absolute directory", []string{"-quota", filepath.Join(abs, "*.log") + "=49"}, exitChanged, []string{varLogs}},
+		{"one of several over", []string{"-quota", "*.txt=1K", "-quota", "var/*.log=49"}, exitChanged, []string{varLogs}},
+		{"with other budgets", []string{"-quota", "*.log=1", "-max-files", "1"}, exitChanged, []string{"Files", "Quota *.log"}},
+		{"bad quota", []string{"-quota", "*.log"}, exitError, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, exceeded := runBudget(t, root, test.args...)
+			if code != test.code {
+				t.Errorf("Exit code %d, expected %d", code, test.code)
+			}
+			if !reflect.DeepEqual(exceeded, test.exceeded) {
+				t.Errorf("Exceeded %q, expected %q", exceeded, test.exceeded)
+			}
+		})
+	}
+}
+
+func TestAlertWebhook(t *testing.T) {
+	root := makeTree(t, map[string]string{"app.log": strings.Repeat("x", 100)})
+	var got struct {
+		Event   string        `json:"event"`
+		Root    string        `json:"root"`
+		Budgets []budgetAlert `json:"budgets"`
+	}
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	code, _ := runBudget(t, root, "-quota", "*.log=10", "-alert-webhook", srv.URL)
+	if code != exitChanged {
+		t.Errorf("Exit code %d, expected %d", code, exitChanged)
+	}
+	want := []budgetAlert{{Budget: "Quota *.log", Used: 100, Limit: 10}}
+	if got.Event != "budget_exceeded" || !reflect.DeepEqual(got.Budgets, want) {
+		t.Errorf("Webhook received %+v", got)
+	}
+
+	// A webhook that fails the request makes the check fail as an error.
+	status = http.StatusInternalServerError
+	if code, _ := runBudget(t, root, "-quota", "*.log=10", "-alert-webhook", srv.URL); code != exitError {
+		t.Errorf("Exit code %d with a failing webhook, expected %d", code, exitError)
+	}
+}
+
+func TestLargestFiles(t *testing.T) {
+	file := func(path string, size int64) *scanner.FileRecord {
+		return &scanner.FileRecord{Path: path, Size: size}
+	}
+	tests := []struct {
+		name  string
+		n     int
+		recs  []*scanner.FileRecord
+		paths []string
+	}{
+		{"fewer than n", 3, []*scanner.FileRecord{file("small", 1), file("big", 9)}, []string{"big", "small"}},
+		{"largest kept", 2, []*scanner.FileRecord{file("a", 3), file("b", 7), file("c", 1), file("d", 5)}, []string{"b", "d"}},
+		// Files of equal size keep the order they were seen in, and a
+		// later one doesn't displace an earlier one.
+		{"ties", 3, []*scanner.FileRecord{file("a", 5), file("b", 1), file("c", 5), file("d", 7), file("e", 5)}, []string{"d", "a", "c"}},
+		{"not regular", 3, []*scanner.FileRecord{
+			{Path: "dir", Size: 4096, IsDir: true, Mode: os.ModeDir},
+			{Path: "link", Size: 20, Mode: os.ModeSymlink},
+			file("file", 1),
+		}, []string{"file"}},
+		{"none wanted", 0, []*scanner.FileRecord{file("a", 1)}, nil},
+	}
+	for _, test := range tests {
+		l := &largestFiles{n: test.n}
+		for _, rec := range test.recs {
+			l.Write(rec)
+		}
+		var paths []string
+		for _, rec := range l.files {
+			paths = append(paths, rec.Path)
+		}
+		if !reflect.DeepEqual(paths, test.paths) {
+			t.Errorf("%s: kept %q, expected %q", test.name, paths, test.paths)
+		}
+	}
+}
+
+func TestDirEntries(t *testing.T) {
+	root := filepath.FromSlash("/data")
+	d := &dirEntries{root: root, counts: map[string]int64{}}
+	if got := d.busiest(); got != (dirCount{root, 0}) {
+		t.Errorf("busiest() of an empty tree = %+v", got)
+	}
+
+	for _, path := range []string{"", "x", "y", "z", "a", "a/1", "a/2", "a/3", "b", "b/1", "b/2", "b/3", "x/1"} {
+		d.Write(&scanner.FileRecord{Path: filepath.Join(root, filepath.FromSlash(path))})
+	}
+	a, b, x := filepath.Join(root, "a"), filepath.Join(root, "b"), filepath.Join(root, "x")
+
+	// The root holds x, y, z, a and b; the root itself is no entry.
+	if got := d.busiest(); got != (dirCount{root, 5}) {
+		t.Errorf("busiest() = %+v, expected the root with 5", got)
+	}
+	tests := []struct {
+		limit int64
+		over  []dirCount
+	}{
+		{5, nil},
+		{4, []dirCount{{root, 5}}},
+		// a and b tie, and are listed by name.
+		{2, []dirCount{{root, 5}, {a, 3}, {b, 3}}},
+		{0, []dirCount{{root, 5}, {a, 3}, {b, 3}, {x, 1}}},
+	}
+	for _, test := range tests {
+		if over := d.over(test.limit); !reflect.DeepEqual(over, test.over) {
+			t.Errorf("over(%d) = %+v, expected %+v", test.limit, over, test.over)
+		}
+	}
+
+	// Of directories with equally many entries, the first by name is
+	// the busiest.
+	d = &dirEntries{root: root, counts: map[string]int64{b: 2, a: 2}}
+	if got := d.busiest(); got != (dirCount{a, 2}) {
+		t.Errorf("busiest() = %+v, expected %s", got, a)
+	}
+}
@@ -0,0 +1,121 @@
+//go:build js && wasm
+
+// Command wasm is the scanner built for the browser. The page lists a
+// folder the user picks or drops through the File System Access API (see
+// web/shim.js) and hands the paths and sizes to fileCounter.scan, which
+// counts them with the same engine as the command line. Nothing is read
+// or uploaded: only the listing crosses into Go.
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall/js"
+
+	"file-counter/pkg/listfs"
+	"file-counter/pkg/scanner"
+)
+
+// topExtensions is how many extensions the result breaks the bytes into.
+const topExtensions = 10
+
+// extTotal is the files and bytes with one extension.
+type extTotal struct {
+	Ext   string `json:"ext"`
+	Files int64  `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+type result struct {
+	Files      int64      `json:"files"`
+	Dirs       int64      `json:"dirs"`
+	Bytes      int64      `json:"bytes"`
+	Size       string     `json:"size"`
+	Seconds    float64    `json:"seconds"`
+	Extensions []extTotal `json:"extensions"`
+}
+
+// extensions is a scanner.FileVisitor totalling files by extension.
+type extensions struct {
+	mu    sync.Mutex
+	total map[string]*extTotal
+}
+
+func (e *extensions) VisitFile(p string, info os.FileInfo) {
+	ext := strings.ToLower(path.Ext(p))
+	if ext == "" {
+		ext = "(none)"
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	t := e.total[ext]
+	if t == nil {
+		t = &extTotal{Ext: ext}
+		e.total[ext] = t
+	}
+	t.Files++
+	t.Bytes += info.Size()
+}
+
+func (e *extensions) VisitDir(string, os.FileInfo) {}
+func (e *extensions) HandleError(string, error)    {}
+
+func (e *extensions) top() []extTotal {
+	out := make([]extTotal, 0, len(e.total))
+	for _, t := range e.total {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Bytes > out[j].Bytes })
+	return out[:min(len(out), topExtensions)]
+}
+
+// scan counts a listing given as a JSON array of listfs entries.
+func scan(listing string) (*result, error) {
+	var entries []listfs.Entry
+	if err := json.Unmarshal([]byte(listing), &entries); err != nil {
+		return nil, err
+	}
+	fsys, err := listfs.New(entries)
+	if err != nil {
+		return nil, err
+	}
+	exts := &extensions{total: map[string]*extTotal{}}
+	r := scanner.NewScannerWithOptions(scanner.Options{FS: fsys, Quiet: true, Visitor: exts}).Start(".")
+	return &result{
+		Files:      r.TotalFiles,
+		Dirs:       r.TotalDirs,
+		Bytes:      r.TotalBytes,
+		Size:       scanner.FormatBytes(r.TotalBytes),
+		Seconds:    r.Duration.Seconds(),
+		Extensions: exts.top(),
+	}, nil
+}
+
+func main() {
+	// fileCounter.scan(listingJSON) returns a promise of the result.
+	scanFunc := js.FuncOf(func(this js.Value, args []js.Value) any {
+		listing := ""
+		if len(args) > 0 {
+			listing = args[0].String()
+		}
+		return js.Global().Get("Promise").New(js.FuncOf(func(this js.Value, cb []js.Value) any {
+			resolve, reject := cb[0], cb[1]
+			go func() {
+				res, err := scan(listing)
+				if err != nil {
+					reject.Invoke(js.Global().Get("Error").New(err.Error()))
+					return
+				}
+				data, _ := json.Marshal(res)
+				resolve.Invoke(js.Global().Get("JSON").Call("parse", string(data)))
+			}()
+			return nil
+		}))
+	})
+	js.Global().Set("fileCounter", map[string]any{"scan": scanFunc})
+	select {}
+}
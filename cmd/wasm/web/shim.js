@@ -0,0 +1,109 @@
+// Lists a folder the user picked or dropped, using the File System Access
+// API where the browser has it and the older entries API otherwise, and
+// hands the listing to the Go scanner. Only names, sizes and times are
+// read; file contents never leave the disk.
+
+async function listHandle(dir, prefix, out) {
+  for await (const entry of dir.values()) {
+    const path = prefix + entry.name;
+    if (entry.kind === "directory") {
+      out.push({ path, dir: true });
+      await listHandle(entry, path + "/", out);
+    } else {
+      const file = await entry.getFile();
+      out.push({ path, size: file.size, mtime: new Date(file.lastModified).toISOString() });
+    }
+  }
+}
+
+function readEntries(reader) {
+  return new Promise((resolve, reject) => reader.readEntries(resolve, reject));
+}
+
+async function listEntry(entry, prefix, out) {
+  const path = prefix + entry.name;
+  if (entry.isDirectory) {
+    out.push({ path, dir: true });
+    const reader = entry.createReader();
+    // readEntries returns the children in batches until an empty one.
+    for (let batch = await readEntries(reader); batch.length > 0; batch = await readEntries(reader)) {
+      for (const child of batch) {
+        await listEntry(child, path + "/", out);
+      }
+    }
+  } else {
+    const file = await new Promise((resolve, reject) => entry.file(resolve, reject));
+    out.push({ path, size: file.size, mtime: new Date(file.lastModified).toISOString() });
+  }
+}
+
+async function listDropped(items) {
+  const out = [];
+  for (const item of items) {
+    if (item.kind !== "file") {
+      continue;
+    }
+    if (item.getAsFileSystemHandle) {
+      const handle = await item.getAsFileSystemHandle();
+      if (handle.kind === "directory") {
+        out.push({ path: handle.name, dir: true });
+        await listHandle(handle, handle.name + "/", out);
+      } else {
+        const file = await handle.getFile();
+        out.push({ path: file.name, size: file.size, mtime: new Date(file.lastModified).toISOString() });
+      }
+    } else {
+      await listEntry(item.webkitGetAsEntry(), "", out);
+    }
+  }
+  return out;
+}
+
+async function count(listing) {
+  const status = document.getElementById("status");
+  status.textContent = `Counting ${listing.length} entries...`;
+  try {
+    const r = await fileCounter.scan(JSON.stringify(listing));
+    status.textContent = `${r.files} files in ${r.dirs} directories, ${r.size} (${r.seconds.toFixed(3)}s)`;
+    const rows = document.getElementById("extensions");
+    rows.replaceChildren(...r.extensions.map((e) => {
+      const tr = document.createElement("tr");
+      for (const v of [e.ext, e.files, e.bytes.toLocaleString()]) {
+        const td = document.createElement("td");
+        td.textContent = v;
+        tr.append(td);
+      }
+      return tr;
+    }));
+  } catch (err) {
+    status.textContent = `Error: ${err.message}`;
+  }
+}
+
+async function start() {
+  const go = new Go();
+  const wasm = await WebAssembly.instantiateStreaming(fetch("file-counter.wasm"), go.importObject);
+  go.run(wasm.instance);
+
+  const pick = document.getElementById("pick");
+  if (window.showDirectoryPicker) {
+    pick.addEventListener("click", async () => {
+      const dir = await window.showDirectoryPicker();
+      const out = [];
+      await listHandle(dir, "", out);
+      count(out);
+    });
+  } else {
+    pick.disabled = true;
+  }
+
+  const drop = document.getElementById("drop");
+  drop.addEventListener("dragover", (e) => e.preventDefault());
+  drop.addEventListener("drop", async (e) => {
+    e.preventDefault();
+    count(await listDropped([...e.dataTransfer.items]));
+  });
+  document.getElementById("status").textContent = "Ready.";
+}
+
+start();
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"file-counter/pkg/content"
+	"file-counter/pkg/scanner"
+)
+
+// sniffedFormat is the inspection result of -compressibility: the format
+// of files whose content is already compressed, and whether other files
+// are text or binary.
+type sniffedFormat struct {
+	compressed string
+	binary     bool
+}
+
+// compressibilitySink splits the scanned data into files that are already
+// compressed, going by the formats the scanning workers sniffed, and files
+// that filesystem compression could shrink: text, which compresses well,
+// and other binary data, which may not.
+type compressibilitySink struct {
+	compressed, text, binary sizeTally
+	formats                  map[string]*sizeTally
+}
+
+// newCompressibilitySink hooks format sniffing into opts.
+func newCompressibilitySink(opts *scanner.Options) *compressibilitySink {
+	s := &compressibilitySink{formats: map[string]*sizeTally{}}
+	addInspector(opts, func(ctx context.Context, path string, info os.FileInfo) (any, error) {
+		if info.Size() == 0 {
+			return nil, nil
+		}
+		head, err := content.ReadHead(path, content.TextSample)
+		if err != nil {
+			return nil, err
+		}
+		return sniffedFormat{compressed: content.Compressed(path, head), binary: content.IsBinary(head)}, nil
+	})
+	opts.Sinks = append(opts.Sinks, s)
+	return s
+}
+
+func (s *compressibilitySink) Write(rec *scanner.FileRecord) error {
+	if !rec.Mode.IsRegular() || rec.Size == 0 || rec.CloudOnly {
+		return nil
+	}
+	format, ok := inspection[sniffedFormat](rec)
+	switch {
+	case !ok:
+	case format.compressed != "":
+		s.compressed.add(rec.Size)
+		addSize(s.formats, format.compressed, rec.Size)
+	case format.binary:
+		s.binary.add(rec.Size)
+	default:
+		s.text.add(rec.Size)
+	}
+	return nil
+}
+
+// report prints the split, and the compressed formats taking up the most
+// space.
+func (s *compressibilitySink) report() {
+	fmt.Printf("\n=== COMPRESSIBILITY ===\n")
+	total := s.compressed.bytes + s.text.bytes + s.binary.bytes
+	percent := func(n int64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(n) / float64(total) * 100
+	}
+	fmt.Printf("Already Compressed: %d files, %s (%.1f%% of bytes)\n", s.compressed.files, scanner.FormatBytes(s.compressed.bytes), percent(s.compressed.bytes))
+	fmt.Printf("Compressible Text: %d files, %s (%.1f%% of bytes)\n", s.text.files, scanner.FormatBytes(s.text.bytes), percent(s.text.bytes))
+	fmt.Printf("Other Binary: %d files, %s (%.1f%% of bytes)\n", s.binary.files, scanner.FormatBytes(s.binary.bytes), percent(s.binary.bytes))
+	fmt.Println("Already Compressed Formats:")
+	formats := make([]string, 0, len(s.formats))
+	for f := range s.formats {
+		formats = append(formats, f)
+	}
+	sort.Slice(formats, func(i, j int) bool {
+		a, b := s.formats[formats[i]], s.formats[formats[j]]
+		if a.bytes != b.bytes {
+			return a.bytes > b.bytes
+		}
+		return formats[i] < formats[j]
+	})
+	for _, f := range formats {
+		t := s.formats[f]
+		fmt.Printf("  %s: %d files, %s\n", f, t.files, scanner.FormatBytes(t.bytes))
+	}
+}
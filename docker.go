@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"file-counter/pkg/docker"
+	"file-counter/pkg/scanner"
+)
+
+// dockerTarget is one container or volume counted by runDocker.
+type dockerTarget struct {
+	kind, name string
+	totals     docker.Totals
+	unreadable int64
+	err        error
+}
+
+// runDocker counts the files in running containers or named volumes.
+func runDocker(args []string) int {
+	fs := flag.NewFlagSet("docker", flag.ExitOnError)
+	host := fs.String("host", "", "Docker daemon `address` (default $DOCKER_HOST or "+docker.DefaultHost+")")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: file-counter docker [-host unix:///var/run/docker.sock] container|volume [NAME...]")
+		fmt.Fprintln(os.Stderr, "Counts files in containers' filesystems or in volumes; without names, every running container or every volume.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return exitError
+	}
+	client, err := docker.NewClient(*host)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	var targets []*dockerTarget
+	names := fs.Args()[1:]
+	switch fs.Arg(0) {
+	case "container", "containers":
+		targets, err = dockerContainers(client, names)
+	case "volume", "volumes":
+		targets, err = dockerVolumes(client, names)
+	default:
+		fs.Usage()
+		return exitError
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if len(targets) == 0 {
+		fmt.Println("Nothing to scan.")
+		return exitOK
+	}
+
+	code := exitOK
+	var total docker.Totals
+	fmt.Printf("%-10s %-30s %10s %8s %10s\n", "Type", "Name", "Files", "Dirs", "Size")
+	for _, t := range targets {
+		if t.err != nil {
+			fmt.Printf("%-10s %-30s error: %v\n", t.kind, t.name, t.err)
+			code = exitError
+			continue
+		}
+		fmt.Printf("%-10s %-30s %10d %8d %10s", t.kind, t.name, t.totals.Files, t.totals.Dirs, scanner.FormatBytes(t.totals.Bytes))
+		if t.unreadable > 0 {
+			fmt.Printf("  (%d unreadable)", t.unreadable)
+		}
+		fmt.Println()
+		total.Files += t.totals.Files
+		total.Dirs += t.totals.Dirs
+		total.Bytes += t.totals.Bytes
+	}
+	if len(targets) > 1 {
+		fmt.Printf("%-10s %-30s %10d %8d %10s\n", "", "total", total.Files, total.Dirs, scanner.FormatBytes(total.Bytes))
+	}
+	return code
+}
+
+// dockerContainers counts each container's filesystem from the export
+// endpoint, so nothing needs to be mounted or copied out first.
+func dockerContainers(client *docker.Client, names []string) ([]*dockerTarget, error) {
+	var containers []docker.Container
+	if len(names) == 0 {
+		list, err := client.Containers()
+		if err != nil {
+			return nil, err
+		}
+		containers = list
+	}
+	for _, name := range names {
+		c, err := client.Container(name)
+		if err != nil {
+			return nil, err
+		}
+		containers = append(containers, *c)
+	}
+
+	var targets []*dockerTarget
+	for _, c := range containers {
+		t := &dockerTarget{kind: "container", name: c.Name()}
+		fmt.Fprintf(os.Stderr, "Exporting %s...\n", t.name)
+		body, err := client.Export(c.ID)
+		if err == nil {
+			t.totals, err = docker.CountTar(body)
+			body.Close()
+		}
+		t.err = err
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// dockerVolumes scans each volume's mount point on this host, which
+// usually requires root.
+func dockerVolumes(client *docker.Client, names []string) ([]*dockerTarget, error) {
+	var volumes []docker.Volume
+	if len(names) == 0 {
+		list, err := client.Volumes()
+		if err != nil {
+			return nil, err
+		}
+		volumes = list
+	}
+	for _, name := range names {
+		v, err := client.Volume(name)
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, *v)
+	}
+
+	var targets []*dockerTarget
+	for _, v := range volumes {
+		t := &dockerTarget{kind: "volume", name: v.Name}
+		if _, err := os.Stat(v.Mountpoint); err != nil {
+			t.err = fmt.Errorf("mount point not readable on this host (%v); volumes of a Docker VM or remote daemon can't be scanned", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Scanning %s...\n", t.name)
+			result := scanner.NewScannerWithOptions(scanner.Options{Quiet: true}).Start(v.Mountpoint)
+			t.totals = docker.Totals{Files: result.TotalFiles, Dirs: result.TotalDirs, Bytes: result.TotalBytes}
+			t.unreadable = result.TotalErrors
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"file-counter/pkg/document"
+	"file-counter/pkg/scanner"
+)
+
+// documentsShown caps how many directories and authors the report lists.
+const documentsShown = 20
+
+// docTally counts documents, their pages and their bytes.
+type docTally struct {
+	files int64
+	pages int64
+	bytes int64
+}
+
+func (t *docTally) add(info *document.Info, size int64) {
+	t.files++
+	t.pages += int64(info.Pages)
+	t.bytes += size
+}
+
+// documentSink totals the page counts and authors that the document probe
+// read in the scanning workers, per format, directory and author.
+type documentSink struct {
+	report  string
+	total   docTally
+	formats map[string]*docTally
+	dirs    map[string]*docTally
+	authors map[string]*docTally
+}
+
+// newDocumentSink hooks the document probe into opts. report, if set, is
+// the file the totals of every directory are written to.
+func newDocumentSink(report string, opts *scanner.Options) *documentSink {
+	s := &documentSink{
+		report:  report,
+		formats: map[string]*docTally{},
+		dirs:    map[string]*docTally{},
+		authors: map[string]*docTally{},
+	}
+	addInspector(opts, func(ctx context.Context, path string, info os.FileInfo) (any, error) {
+		d, err := document.Probe(path)
+		if d == nil {
+			return nil, err
+		}
+		return d, err
+	})
+	opts.Sinks = append(opts.Sinks, s)
+	return s
+}
+
+func (s *documentSink) Write(rec *scanner.FileRecord) error {
+	d, ok := inspection[*document.Info](rec)
+	if !ok {
+		return nil
+	}
+	author := d.Author
+	if author == "" {
+		author = "unknown"
+	}
+	s.total.add(d, rec.Size)
+	for _, t := range []struct {
+		m   map[string]*docTally
+		key string
+	}{
+		{s.formats, d.Format},
+		{s.dirs, filepath.Dir(rec.Path)},
+		{s.authors, author},
+	} {
+		tally := t.m[t.key]
+		if tally == nil {
+			tally = &docTally{}
+			t.m[t.key] = tally
+		}
+		tally.add(d, rec.Size)
+	}
+	return nil
+}
+
+// finish prints the totals per format, the directories with the most pages
+// and the most prolific authors, and writes the -documents-report file.
+func (s *documentSink) finish() {
+	fmt.Printf("\n=== DOCUMENTS ===\n")
+	fmt.Printf("Documents: %d (%s), %d pages\n", s.total.files, scanner.FormatBytes(s.total.bytes), s.total.pages)
+	if s.total.files > 0 {
+		for _, f := range sortedTallies(s.formats, false) {
+			t := s.formats[f]
+			fmt.Printf("  %s: %d files, %d pages, %s\n", f, t.files, t.pages, scanner.FormatBytes(t.bytes))
+		}
+		fmt.Println("Directories With the Most Pages:")
+		for i, dir := range sortedTallies(s.dirs, true) {
+			if i == documentsShown {
+				fmt.Printf("  ... and %d more directories\n", len(s.dirs)-i)
+				break
+			}
+			t := s.dirs[dir]
+			fmt.Printf("  %s: %d files, %d pages, %s\n", dir, t.files, t.pages, scanner.FormatBytes(t.bytes))
+		}
+		fmt.Println("Authors:")
+		for i, a := range sortedTallies(s.authors, false) {
+			if i == documentsShown {
+				fmt.Printf("  ... and %d more authors\n", len(s.authors)-i)
+				break
+			}
+			t := s.authors[a]
+			fmt.Printf("  %s: %d files, %d pages\n", a, t.files, t.pages)
+		}
+	}
+	if s.report != "" {
+		if err := s.writeReport(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -documents-report: %v\n", err)
+			return
+		}
+		fmt.Printf("Directory totals written to %s\n", s.report)
+	}
+}
+
+// writeReport writes the totals of every directory holding documents as
+// tab-separated lines, sorted by path.
+func (s *documentSink) writeReport() error {
+	f, err := os.Create(s.report)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "directory\tdocuments\tpages\tbytes\n")
+	dirs := make([]string, 0, len(s.dirs))
+	for dir := range s.dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		t := s.dirs[dir]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", dir, t.files, t.pages, t.bytes)
+	}
+	err = w.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// sortedTallies returns the keys of tallies, those with the most pages or
+// files first.
+func sortedTallies(tallies map[string]*docTally, byPages bool) []string {
+	keys := make([]string, 0, len(tallies))
+	for k := range tallies {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := tallies[keys[i]], tallies[keys[j]]
+		if byPages && a.pages != b.pages {
+			return a.pages > b.pages
+		}
+		if a.files != b.files {
+			return a.files > b.files
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
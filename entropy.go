@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+
+	"file-counter/pkg/content"
+	"file-counter/pkg/scanner"
+)
+
+// entropyShown caps how many findings are printed when there is no
+// -entropy-report file.
+const entropyShown = 50
+
+// entropyFinding is a file whose content looks encrypted: a known
+// encrypted format, or high-entropy data in no known compressed format.
+type entropyFinding struct {
+	Path    string  `json:"path"`
+	Size    int64   `json:"size"`
+	Kind    string  `json:"kind"`
+	Entropy float64 `json:"entropy"` // bits per byte of the start of the file
+}
+
+// entropySink collects the files that the scanning workers found to hold
+// encrypted or random data.
+type entropySink struct {
+	report   string
+	kinds    map[string]*sizeTally
+	findings []entropyFinding
+}
+
+// newEntropySink hooks entropy sampling into opts.
+func newEntropySink(report string, opts *scanner.Options) *entropySink {
+	s := &entropySink{report: report, kinds: map[string]*sizeTally{}}
+	addInspector(opts, func(ctx context.Context, path string, info os.FileInfo) (any, error) {
+		if info.Size() == 0 {
+			return nil, nil
+		}
+		sample, err := content.ReadHead(path, content.EntropySample)
+		if err != nil {
+			return nil, err
+		}
+		kind := content.Encrypted(sample)
+		if kind == "" && content.Compressed(path, sample) == "" && content.HighEntropy(sample) {
+			kind = "unidentified random data"
+		}
+		if kind == "" {
+			return nil, nil
+		}
+		e := math.Round(content.Entropy(sample)*1000) / 1000
+		return &entropyFinding{Path: path, Size: info.Size(), Kind: kind, Entropy: e}, nil
+	})
+	opts.Sinks = append(opts.Sinks, s)
+	return s
+}
+
+func (s *entropySink) Write(rec *scanner.FileRecord) error {
+	if f, ok := inspection[*entropyFinding](rec); ok {
+		addSize(s.kinds, f.Kind, f.Size)
+		s.findings = append(s.findings, *f)
+	}
+	return nil
+}
+
+// finish prints the counts per kind and writes the findings, largest
+// first, to the report file, or prints them when there is none.
+func (s *entropySink) finish() {
+	fmt.Printf("\n=== LIKELY ENCRYPTED FILES ===\n")
+	var bytes int64
+	for _, f := range s.findings {
+		bytes += f.Size
+	}
+	fmt.Printf("%d files, %s\n", len(s.findings), scanner.FormatBytes(bytes))
+	if len(s.findings) == 0 {
+		return
+	}
+	kinds := make([]string, 0, len(s.kinds))
+	for k := range s.kinds {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	for _, k := range kinds {
+		fmt.Printf("  %s: %d files, %s\n", k, s.kinds[k].files, scanner.FormatBytes(s.kinds[k].bytes))
+	}
+	sort.Slice(s.findings, func(i, j int) bool {
+		if s.findings[i].Size != s.findings[j].Size {
+			return s.findings[i].Size > s.findings[j].Size
+		}
+		return s.findings[i].Path < s.findings[j].Path
+	})
+	if s.report != "" {
+		if err := s.writeReport(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -entropy-report: %v\n", err)
+			return
+		}
+		fmt.Printf("Report written to %s\n", s.report)
+		return
+	}
+	for i, f := range s.findings {
+		if i == entropyShown {
+			fmt.Printf("... and %d more; use -entropy-report to list them all\n", len(s.findings)-i)
+			break
+		}
+		fmt.Printf("%s: %s, %s, %.3f bits/byte\n", f.Path, f.Kind, scanner.FormatBytes(f.Size), f.Entropy)
+	}
+}
+
+func (s *entropySink) writeReport() error {
+	f, err := os.Create(s.report)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s.findings); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"file-counter/pkg/executable"
+	"file-counter/pkg/scanner"
+)
+
+// executableSink counts the native binaries that the scanning workers
+// identified, per format, architecture, kind and linkage.
+type executableSink struct {
+	total     sizeTally
+	platforms map[string]*sizeTally
+	kinds     map[string]int64
+	linkage   map[string]int64
+}
+
+// newExecutableSink hooks native binary identification into opts.
+func newExecutableSink(opts *scanner.Options) *executableSink {
+	s := &executableSink{
+		platforms: map[string]*sizeTally{},
+		kinds:     map[string]int64{},
+		linkage:   map[string]int64{},
+	}
+	addInspector(opts, func(ctx context.Context, path string, info os.FileInfo) (any, error) {
+		e, err := executable.Probe(path)
+		if e == nil {
+			return nil, err
+		}
+		return e, err
+	})
+	opts.Sinks = append(opts.Sinks, s)
+	return s
+}
+
+func (s *executableSink) Write(rec *scanner.FileRecord) error {
+	e, ok := inspection[*executable.Info](rec)
+	if !ok {
+		return nil
+	}
+	s.total.add(rec.Size)
+	addSize(s.platforms, e.Format+" "+e.Arch, rec.Size)
+	s.kinds[e.Kind]++
+	if e.Linkage != "" {
+		s.linkage[e.Linkage]++
+	}
+	return nil
+}
+
+func (s *executableSink) report() {
+	fmt.Printf("\n=== NATIVE BINARIES ===\n")
+	fmt.Printf("Binaries: %d files, %s\n", s.total.files, scanner.FormatBytes(s.total.bytes))
+	if s.total.files == 0 {
+		return
+	}
+	fmt.Printf("Kinds: %s\n", countList(s.kinds))
+	if len(s.linkage) > 0 {
+		fmt.Printf("Executables Linked: %s\n", countList(s.linkage))
+	}
+	platforms := make([]string, 0, len(s.platforms))
+	for p := range s.platforms {
+		platforms = append(platforms, p)
+	}
+	sort.Slice(platforms, func(i, j int) bool {
+		a, b := s.platforms[platforms[i]], s.platforms[platforms[j]]
+		if a.files != b.files {
+			return a.files > b.files
+		}
+		return platforms[i] < platforms[j]
+	})
+	fmt.Println("Formats and Architectures:")
+	for _, p := range platforms {
+		t := s.platforms[p]
+		fmt.Printf("  %s: %d files, %s\n", p, t.files, scanner.FormatBytes(t.bytes))
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+
+	"file-counter/pkg/scanner"
+)
+
+// filterFlag is a repeatable flag whose values become filter rules. All
+// rsync-style filter flags add to the same scanner.Filter, so their rules
+// keep the order they were given in, as rsync's do.
+type filterFlag func(value string) error
+
+func (f filterFlag) String() string     { return "" }
+func (f filterFlag) Set(v string) error { return f(v) }
+
+// filterFlags registers -exclude, -include, -exclude-from, -include-from
+// and -filter on fs. The returned function yields the filter, or nil if
+// none of them was used.
+func filterFlags(fs *flag.FlagSet) func() *scanner.Filter {
+	var filter scanner.Filter
+	used := false
+	add := func(build func(string) error) filterFlag {
+		return func(v string) error {
+			used = true
+			return build(v)
+		}
+	}
+	fs.Var(add(func(v string) error { return filter.Add("- " + v) }), "exclude", "skip entries matching the rsync `pattern`; repeatable")
+	fs.Var(add(func(v string) error { return filter.Add("+ " + v) }), "include", "don't skip entries matching the rsync `pattern`, even if a later rule would; repeatable")
+	fs.Var(add(func(v string) error { return filter.AddFile(v, "-") }), "exclude-from", "read exclude patterns from `file`; repeatable")
+	fs.Var(add(func(v string) error { return filter.AddFile(v, "+") }), "include-from", "read include patterns from `file`; repeatable")
+	fs.Var(add(filter.Add), "filter", "add an rsync filter `rule`, e.g. \"- *.o\" or \"merge backup.rules\"; repeatable")
+	return func() *scanner.Filter {
+		if !used {
+			return nil
+		}
+		return &filter
+	}
+}
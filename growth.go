@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"file-counter/pkg/scanner"
+	"file-counter/pkg/snapshot"
+)
+
+// growthLimit is check's -max-growth: either a percentage of the size
+// recorded in the baseline or an absolute size.
+type growthLimit struct {
+	percent float64
+	bytes   int64
+}
+
+func parseGrowth(s string) (growthLimit, error) {
+	if p, ok := strings.CutSuffix(strings.TrimSpace(s), "%"); ok {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || v < 0 {
+			return growthLimit{}, fmt.Errorf("invalid percentage %q", s)
+		}
+		return growthLimit{percent: v}, nil
+	}
+	n, err := scanner.ParseBytes(s)
+	return growthLimit{bytes: n}, err
+}
+
+// allowed is how many bytes a tree of base bytes may grow by.
+func (g growthLimit) allowed(base int64) int64 {
+	if g.bytes > 0 {
+		return g.bytes
+	}
+	return int64(float64(base) * g.percent / 100)
+}
+
+func (g growthLimit) String() string {
+	if g.bytes > 0 {
+		return scanner.FormatBytes(g.bytes)
+	}
+	return strconv.FormatFloat(g.percent, 'f', -1, 64) + "%"
+}
+
+// checkGrowth reports how much current grew since base and returns
+// exitChanged when that is more than limit allows, listing the top files
+// that grew most unless quiet.
+func checkGrowth(base, current *snapshot.Snapshot, limit growthLimit, top int, quiet bool) int {
+	growth := current.TotalBytes - base.TotalBytes
+	over := growth > limit.allowed(base.TotalBytes)
+
+	fmt.Printf("=== GROWTH CHECK ===\n")
+	fmt.Printf("Baseline: %s (%s)\n", base.Root, base.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+	status := "ok"
+	if over {
+		status = "EXCEEDED"
+	}
+	pct := "new"
+	if base.TotalBytes > 0 {
+		pct = fmt.Sprintf("%+.1f%%", 100*float64(growth)/float64(base.TotalBytes))
+	}
+	fmt.Printf("Size:  %s -> %s (%s, %s), %s allowed %s\n", scanner.FormatBytes(base.TotalBytes), scanner.FormatBytes(current.TotalBytes),
+		signedBytes(growth), pct, limit, status)
+	fmt.Printf("Files: %d -> %d (%+d)\n", base.TotalFiles, current.TotalFiles, current.TotalFiles-base.TotalFiles)
+
+	if over && !quiet {
+		type grown struct {
+			path  string
+			delta int64
+			added bool
+		}
+		var files []grown
+		diff := snapshot.Compare(base, current)
+		for _, c := range diff.Added {
+			files = append(files, grown{c.Path, c.New.Size, true})
+		}
+		for _, c := range diff.Modified {
+			if d := c.New.Size - c.Old.Size; d > 0 {
+				files = append(files, grown{c.Path, d, false})
+			}
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].delta > files[j].delta })
+		if len(files) > top {
+			files = files[:top]
+		}
+		if len(files) > 0 {
+			fmt.Printf("\nGrew most:\n")
+		}
+		for _, f := range files {
+			note := ""
+			if f.added {
+				note = " (new)"
+			}
+			fmt.Printf("  %11s  %s%s\n", signedBytes(f.delta), f.path, note)
+		}
+	}
+	if over {
+		return exitChanged
+	}
+	return exitOK
+}
+
+// signedBytes formats a change in size, e.g. "+1.5 MB".
+func signedBytes(n int64) string {
+	if n < 0 {
+		return "-" + scanner.FormatBytes(-n)
+	}
+	return "+" + scanner.FormatBytes(n)
+}
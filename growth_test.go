@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseGrowth(t *testing.T) {
+	tests := []struct {
+		in      string
+		allowed int64 // of a 1000-byte baseline
+		err     bool
+	}{
+		{"10%", 100, false},
+		{" 2.5 % ", 25, false},
+		{"0%", 0, false},
+		{"1K", 1024, false},
+		{"300", 300, false},
+		{"-5%", 0, true},
+		{"ten%", 0, true},
+		{"lots", 0, true},
+	}
+	for _, test := range tests {
+		g, err := parseGrowth(test.in)
+		if (err != nil) != test.err {
+			t.Errorf("parseGrowth(%q) error = %v", test.in, err)
+			continue
+		}
+		if err == nil && g.allowed(1000) != test.allowed {
+			t.Errorf("parseGrowth(%q) allows %d bytes of growth, expected %d", test.in, g.allowed(1000), test.allowed)
+		}
+	}
+}
+
+func TestGrowthCheck(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a":     strings.Repeat("a", 150),
+		"sub/b": strings.Repeat("b", 50),
+	})
+	baseline := filepath.Join(t.TempDir(), "baseline.json")
+	if code := runBaseline([]string{"-o", baseline, root}); code != exitOK {
+		t.Fatalf("baseline exited with %d", code)
+	}
+	// Grow the tree by 20 bytes, 10% of the baseline's 200.
+	if err := os.WriteFile(filepath.Join(root, "sub", "new"), []byte(strings.Repeat("n", 20)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		limit string
+		code  int
+	}{
+		{"11%", exitOK},
+		{"10%", exitOK},
+		{"9.9%", exitChanged},
+		{"0%", exitChanged},
+		{"21", exitOK},
+		{"20", exitOK},
+		{"19", exitChanged},
+	}
+	for _, test := range tests {
+		if code := runCheck([]string{"-baseline", baseline, "-max-growth", test.limit, "-q"}); code != test.code {
+			t.Errorf("-max-growth %s: exit code %d, expected %d", test.limit, code, test.code)
+		}
+	}
+
+	// Shrinking never exceeds the limit.
+	if err := os.Remove(filepath.Join(root, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if code := runCheck([]string{"-baseline", baseline, "-max-growth", "0%", "-q"}); code != exitOK {
+		t.Errorf("Exit code %d after the tree shrank, expected %d", code, exitOK)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	if code := runCheck([]string{"-baseline", missing, "-max-growth", "10%", root}); code != exitError {
+		t.Errorf("Exit code %d without a baseline, expected %d", code, exitError)
+	}
+	if code := runCheck([]string{"-baseline", baseline, "-max-growth", "lots"}); code != exitError {
+		t.Errorf("Exit code %d for a bad limit, expected %d", code, exitError)
+	}
+}
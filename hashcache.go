@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"file-counter/pkg/hashcache"
+)
+
+// openHashCache opens the hash cache under the user cache directory, or
+// returns nil when there is none. An unreadable cache only costs the work
+// it would have saved, so it is reported and started again.
+func openHashCache() *hashcache.Cache {
+	name, err := hashcache.DefaultPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: -hash-cache: %v\n", err)
+		return nil
+	}
+	c, err := hashcache.Open(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: -hash-cache: %v; starting a new one\n", err)
+		c = hashcache.New(name)
+	}
+	return c
+}
+
+// saveHashCache writes c back, if there is one.
+func saveHashCache(c *hashcache.Cache) {
+	if c == nil {
+		return
+	}
+	if err := c.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: saving the hash cache: %v\n", err)
+	}
+}
+
+// hashCacheSummary says how many files the cache saved reading.
+func hashCacheSummary(c *hashcache.Cache) string {
+	hits, misses := c.Stats()
+	return fmt.Sprintf("%d reused, %d hashed", hits, misses)
+}
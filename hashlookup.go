@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+
+	"file-counter/pkg/hashset"
+	"file-counter/pkg/scanner"
+)
+
+// hashLookupSink checks file hashes against a known-good list and a
+// blocklist.
+type hashLookupSink struct {
+	good, bad hashset.Set
+
+	goodFiles, goodBytes int64
+	hits                 []blocklistHit
+}
+
+type blocklistHit struct {
+	path, hash, label string
+}
+
+// newHashLookupSink loads the lists named; either may be empty.
+func newHashLookupSink(goodFile, badFile string) (*hashLookupSink, error) {
+	s := &hashLookupSink{}
+	var err error
+	if goodFile != "" {
+		if s.good, err = hashset.Load(goodFile); err != nil {
+			return nil, err
+		}
+	}
+	if badFile != "" {
+		if s.bad, err = hashset.Load(badFile); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *hashLookupSink) Write(rec *scanner.FileRecord) error {
+	if rec.Hash == "" {
+		return nil
+	}
+	if label, ok := s.bad.Lookup(rec.Hash); ok {
+		s.hits = append(s.hits, blocklistHit{rec.Path, rec.Hash, label})
+	}
+	if _, ok := s.good.Lookup(rec.Hash); ok {
+		s.goodFiles++
+		s.goodBytes += rec.Size
+	}
+	return nil
+}
+
+func (s *hashLookupSink) report() {
+	fmt.Printf("\n=== HASH LOOKUP ===\n")
+	if s.good != nil {
+		fmt.Printf("Known Good: %d files (%s)\n", s.goodFiles, scanner.FormatBytes(s.goodBytes))
+	}
+	if s.bad == nil {
+		return
+	}
+	fmt.Printf("Blocklist Matches: %d\n", len(s.hits))
+	for _, h := range s.hits {
+		if h.label != "" {
+			fmt.Printf("  %s: %s (%s)\n", h.path, h.label, h.hash)
+		} else {
+			fmt.Printf("  %s (%s)\n", h.path, h.hash)
+		}
+	}
+}
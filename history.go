@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"file-counter/pkg/scanner"
+	"file-counter/pkg/snapshot"
+)
+
+// scanHistory is the outcome of the last completed scan of a root, kept so
+// the next scan of the same root can show a progress bar.
+type scanHistory struct {
+	Root       string        `json:"root"`
+	Items      int64         `json:"items"`
+	Bytes      int64         `json:"bytes"`
+	Duration   time.Duration `json:"duration"`
+	FinishedAt time.Time     `json:"finished_at"`
+}
+
+// historyFile returns where the history for root is kept, one small JSON
+// file per root under the user cache directory.
+func historyFile(root string) (string, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(dir, "file-counter", "history", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+func loadHistory(root string) (*scanner.Estimate, bool) {
+	name, err := historyFile(root)
+	if err != nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, false
+	}
+	var h scanHistory
+	if err := json.Unmarshal(data, &h); err != nil || h.Items <= 0 {
+		return nil, false
+	}
+	return &scanner.Estimate{Items: h.Items, Bytes: h.Bytes, Source: "scan of " + h.FinishedAt.Local().Format("2006-01-02 15:04")}, true
+}
+
+// historyEstimate adds up the previous scans of several roots, or returns
+// nil unless every one of them has been scanned before.
+func historyEstimate(roots []string) *scanner.Estimate {
+	total := &scanner.Estimate{Source: "previous scans"}
+	for _, root := range roots {
+		est, ok := loadHistory(root)
+		if !ok {
+			return nil
+		}
+		total.Items += est.Items
+		total.Bytes += est.Bytes
+	}
+	return total
+}
+
+// saveHistory records a completed scan. Failures are ignored: the history
+// only improves the next progress display.
+func saveHistory(root string, result *scanner.ScanResult) {
+	if !result.Completed {
+		return
+	}
+	name, err := historyFile(root)
+	if err != nil {
+		return
+	}
+	abs, _ := filepath.Abs(root)
+	data, err := json.Marshal(scanHistory{
+		Root:       abs,
+		Items:      result.TotalFiles + result.TotalDirs + result.TotalHardlinks,
+		Bytes:      result.TotalBytes,
+		Duration:   result.Duration,
+		FinishedAt: time.Now(),
+	})
+	if err != nil {
+		return
+	}
+	if os.MkdirAll(filepath.Dir(name), 0755) == nil {
+		os.WriteFile(name, data, 0644)
+	}
+}
+
+// estimateFromSnapshot uses a baseline or snapshot file of the same tree as
+// the progress estimate.
+func estimateFromSnapshot(path string) (*scanner.Estimate, error) {
+	snap, err := snapshot.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return &scanner.Estimate{
+		Items:  snap.TotalFiles + snap.TotalDirs,
+		Bytes:  snap.TotalBytes,
+		Source: "snapshot " + filepath.Base(path),
+	}, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"file-counter/pkg/hook"
+	"file-counter/pkg/scanner"
+)
+
+// hookRunner classifies files with -hook or -hook-func and optionally
+// writes every label to -hook-results.
+type hookRunner struct {
+	*hook.Runner
+	results *os.File
+	w       *bufio.Writer
+}
+
+// newHookRunner sets up the classifier: command is split on spaces and
+// run with each file's path appended; funcName names a registered hook.
+func newHookRunner(command, funcName string, match []string, jobs int, timeout time.Duration, results string) (*hookRunner, error) {
+	var fn hook.Func
+	switch {
+	case command != "" && funcName != "":
+		return nil, fmt.Errorf("-hook and -hook-func can't be combined")
+	case command != "":
+		fn = hook.Exec(strings.Fields(command), timeout)
+	default:
+		var ok bool
+		if fn, ok = hook.Lookup(funcName); !ok {
+			return nil, fmt.Errorf("-hook-func: unknown hook %q (available: %s)", funcName, strings.Join(hook.Names(), ", "))
+		}
+	}
+	h := &hookRunner{Runner: hook.NewRunner(context.Background(), fn, jobs)}
+	h.Match = match
+	if results != "" {
+		f, err := os.Create(results)
+		if err != nil {
+			return nil, err
+		}
+		h.results, h.w = f, bufio.NewWriter(f)
+		h.OnResult = func(rec *scanner.FileRecord, label string) {
+			fmt.Fprintf(h.w, "%s\t%s\n", rec.Path, label)
+		}
+	}
+	return h, nil
+}
+
+// report waits for the last calls and prints the files per label.
+func (h *hookRunner) report() {
+	res := h.Wait()
+	if h.results != nil {
+		err := h.w.Flush()
+		if cerr := h.results.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -hook-results: %v\n", err)
+		}
+	}
+	fmt.Printf("\n=== HOOK CLASSIFICATION ===\n")
+	fmt.Printf("Files Classified: %d\n", res.Files)
+	for _, c := range res.Counts {
+		fmt.Printf("  %s: %d files, %s\n", c.Label, c.Files, scanner.FormatBytes(c.Bytes))
+	}
+	if res.Errors > 0 {
+		fmt.Printf("Hook Errors: %d (last: %v)\n", res.Errors, res.LastErr)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"file-counter/pkg/content"
+	"file-counter/pkg/scanner"
+)
+
+// hygieneShown caps how many inconsistent directories the report lists.
+const hygieneShown = 20
+
+// hygieneTally counts the line endings, byte order marks and encodings of
+// text files.
+type hygieneTally struct {
+	files     int64
+	boms      int64
+	utf8BOMs  int64
+	endings   map[string]int64
+	encodings map[string]int64
+}
+
+func newHygieneTally() *hygieneTally {
+	return &hygieneTally{endings: map[string]int64{}, encodings: map[string]int64{}}
+}
+
+func (t *hygieneTally) add(info *content.TextInfo) {
+	t.files++
+	if info.BOM {
+		t.boms++
+		if info.Encoding == "utf-8" {
+			t.utf8BOMs++
+		}
+	}
+	t.endings[info.LineEndings]++
+	t.encodings[info.Encoding]++
+}
+
+// inconsistent reports whether the files counted don't share one set of
+// conventions: they use different line endings, some mix them within the
+// file, only some start with a byte order mark, or they use different
+// encodings. ASCII goes with anything, being valid in all of them but
+// UTF-16 and UTF-32, and files without line breaks go with any ending.
+func (t *hygieneTally) inconsistent() bool {
+	endings := 0
+	for e := range t.endings {
+		if e == "mixed" {
+			return true
+		}
+		if e != "none" {
+			endings++
+		}
+	}
+	encodings := 0
+	for e := range t.encodings {
+		if e != "ascii" {
+			encodings++
+		}
+	}
+	return endings > 1 || encodings > 1 || t.boms > 0 && t.boms < t.files
+}
+
+// hygieneSink totals the line endings, byte order marks and encodings that
+// the scanning workers detected in text files, overall and per directory.
+type hygieneSink struct {
+	report string
+	total  *hygieneTally
+	dirs   map[string]*hygieneTally
+}
+
+// newHygieneSink hooks text hygiene detection into opts. report, if set, is
+// the file the totals of every directory are written to.
+func newHygieneSink(report string, opts *scanner.Options) *hygieneSink {
+	s := &hygieneSink{report: report, total: newHygieneTally(), dirs: map[string]*hygieneTally{}}
+	addInspector(opts, func(ctx context.Context, path string, info os.FileInfo) (any, error) {
+		if info.Size() == 0 {
+			return nil, nil
+		}
+		sample, err := content.ReadHead(path, content.HygieneSample)
+		if err != nil {
+			return nil, err
+		}
+		t := content.Hygiene(sample, info.Size() > int64(len(sample)))
+		if t == nil {
+			return nil, nil
+		}
+		return t, nil
+	})
+	opts.Sinks = append(opts.Sinks, s)
+	return s
+}
+
+func (s *hygieneSink) Write(rec *scanner.FileRecord) error {
+	t, ok := inspection[*content.TextInfo](rec)
+	if !ok {
+		return nil
+	}
+	s.total.add(t)
+	dir := filepath.Dir(rec.Path)
+	tally := s.dirs[dir]
+	if tally == nil {
+		tally = newHygieneTally()
+		s.dirs[dir] = tally
+	}
+	tally.add(t)
+	return nil
+}
+
+// finish prints the overall totals and the directories whose text files
+// don't agree on their conventions, and writes the -text-hygiene-report
+// file.
+func (s *hygieneSink) finish() {
+	fmt.Printf("\n=== TEXT HYGIENE ===\n")
+	fmt.Printf("Text files: %d\n", s.total.files)
+	if s.total.files > 0 {
+		fmt.Printf("Line Endings: %s\n", countList(s.total.endings))
+		fmt.Printf("Byte Order Marks: %d (UTF-8: %d)\n", s.total.boms, s.total.utf8BOMs)
+		fmt.Printf("Encodings: %s\n", countList(s.total.encodings))
+
+		var dirs []string
+		for dir, t := range s.dirs {
+			if t.inconsistent() {
+				dirs = append(dirs, dir)
+			}
+		}
+		sort.Slice(dirs, func(i, j int) bool {
+			a, b := s.dirs[dirs[i]], s.dirs[dirs[j]]
+			if a.files != b.files {
+				return a.files > b.files
+			}
+			return dirs[i] < dirs[j]
+		})
+		fmt.Printf("Inconsistent Directories: %d of %d\n", len(dirs), len(s.dirs))
+		for i, dir := range dirs {
+			if i == hygieneShown {
+				fmt.Printf("  ... and %d more directories\n", len(dirs)-i)
+				break
+			}
+			t := s.dirs[dir]
+			fmt.Printf("  %s: %d files; %s; %s; %d with BOM\n", dir, t.files, countList(t.endings), countList(t.encodings), t.boms)
+		}
+	}
+	if s.report != "" {
+		if err := s.writeReport(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -text-hygiene-report: %v\n", err)
+			return
+		}
+		fmt.Printf("Directory totals written to %s\n", s.report)
+	}
+}
+
+// writeReport writes the totals of every directory holding text files as
+// tab-separated lines, sorted by path.
+func (s *hygieneSink) writeReport() error {
+	f, err := os.Create(s.report)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "directory\tfiles\tlf\tcrlf\tcr\tmixed\tbom\tutf8_bom\tencodings\n")
+	dirs := make([]string, 0, len(s.dirs))
+	for dir := range s.dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		t := s.dirs[dir]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n", dir, t.files,
+			t.endings["lf"], t.endings["crlf"], t.endings["cr"], t.endings["mixed"],
+			t.boms, t.utf8BOMs, countList(t.encodings))
+	}
+	err = w.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
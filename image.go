@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"file-counter/pkg/image"
+	"file-counter/pkg/scanner"
+)
+
+// runImage counts the files in a container image layer by layer.
+func runImage(args []string) int {
+	fs := flag.NewFlagSet("image", flag.ExitOnError)
+	engine := fs.String("engine", "docker", "container engine `command` used to pull and export images (docker or podman)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: file-counter image [-engine docker] <image|archive.tar|oci-layout-dir>")
+		fmt.Fprintln(os.Stderr, "Counts files and sizes per layer and the space taken by files later layers overwrite or delete.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitError
+	}
+
+	img, err := loadImage(fs.Arg(0), *engine)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	name := fs.Arg(0)
+	if len(img.Tags) > 0 {
+		name = strings.Join(img.Tags, ", ")
+	}
+	fmt.Printf("Image: %s (%d layers)\n\n", name, len(img.Layers))
+	fmt.Printf("%-5s %-12s %9s %7s %10s %10s  %s\n", "Layer", "Digest", "Files", "Dirs", "Size", "Wasted", "Created by")
+	for i, l := range img.Layers {
+		digest := strings.TrimPrefix(l.Digest, "sha256:")
+		if len(digest) > 12 {
+			digest = digest[:12]
+		}
+		wasted := "-"
+		if l.ShadowedBytes > 0 {
+			wasted = scanner.FormatBytes(l.ShadowedBytes)
+		}
+		fmt.Printf("%-5d %-12s %9d %7d %10s %10s  %s\n", i+1, digest, l.Files, l.Dirs,
+			scanner.FormatBytes(l.Bytes), wasted, shorten(l.CreatedBy, 60))
+	}
+
+	fmt.Printf("\n=== IMAGE RESULTS ===\n")
+	fmt.Printf("Visible Files: %d\n", img.Files)
+	fmt.Printf("Visible Data Size: %s\n", scanner.FormatBytes(img.Bytes))
+	fmt.Printf("Wasted by Later Layers: %s", scanner.FormatBytes(img.Wasted))
+	if total := img.Bytes + img.Wasted; total > 0 {
+		fmt.Printf(" (%.1f%% of layer contents)", float64(img.Wasted)*100/float64(total))
+	}
+	fmt.Println()
+	return exitOK
+}
+
+// loadImage reads an image archive or OCI layout from disk, or otherwise
+// has the container engine export the named image, pulling it first if it
+// is not available locally.
+func loadImage(ref, engine string) (*image.Image, error) {
+	if info, err := os.Stat(ref); err == nil {
+		if info.IsDir() {
+			return image.ReadDir(ref)
+		}
+		f, err := os.Open(ref)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return image.Read(f)
+	}
+
+	if exec.Command(engine, "image", "inspect", ref).Run() != nil {
+		fmt.Fprintf(os.Stderr, "Pulling %s...\n", ref)
+		pull := exec.Command(engine, "pull", ref)
+		pull.Stdout, pull.Stderr = os.Stderr, os.Stderr
+		if err := pull.Run(); err != nil {
+			return nil, fmt.Errorf("%s pull %s: %w", engine, ref, err)
+		}
+	}
+
+	save := exec.Command(engine, "save", ref)
+	save.Stderr = os.Stderr
+	out, err := save.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := save.Start(); err != nil {
+		return nil, err
+	}
+	img, readErr := image.Read(out)
+	if readErr != nil {
+		// Unblock the engine if the archive was rejected part way.
+		save.Process.Kill()
+	}
+	if err := save.Wait(); err != nil && readErr == nil {
+		return nil, fmt.Errorf("%s save %s: %w", engine, ref, err)
+	}
+	return img, readErr
+}
+
+// shorten trims s to at most n characters for table output.
+func shorten(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
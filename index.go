@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"file-counter/pkg/index"
+	"file-counter/pkg/scanner"
+)
+
+// runIndex builds, updates and lists the stored path indexes.
+func runIndex(args []string) int {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Usage: file-counter index build [-index file] <path>")
+		fmt.Fprintln(os.Stderr, "       file-counter index update [-index file] [path]")
+		fmt.Fprintln(os.Stderr, "       file-counter index list")
+		fmt.Fprintln(os.Stderr, "Stores every path under a root with its size and mtime so search and query can answer without rescanning.")
+	}
+	if len(args) == 0 {
+		usage()
+		return exitError
+	}
+	switch args[0] {
+	case "build", "update":
+	case "list":
+		return listIndexes()
+	default:
+		usage()
+		return exitError
+	}
+
+	fs := flag.NewFlagSet("index "+args[0], flag.ExitOnError)
+	indexPath := fs.String("index", "", "index `file` (default: one per root in the user cache directory)")
+	fs.Usage = func() {
+		usage()
+		fs.PrintDefaults()
+	}
+	fs.Parse(args[1:])
+	if fs.NArg() > 1 || (args[0] == "build" && fs.NArg() != 1) || (fs.NArg() == 0 && *indexPath == "") {
+		fs.Usage()
+		return exitError
+	}
+
+	var root string
+	if fs.NArg() == 1 {
+		root = fs.Arg(0)
+	}
+	if *indexPath == "" {
+		name, err := index.DefaultPath(root)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		*indexPath = name
+	}
+
+	var opts index.Options
+	started := time.Now()
+	var ix *index.Index
+	var changes *index.Changes
+	var err error
+	if args[0] == "update" {
+		old, lerr := index.Load(*indexPath)
+		if lerr != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v (run 'file-counter index build' first)\n", lerr)
+			return exitError
+		}
+		if root != "" {
+			// The journal position says nothing about another tree.
+			if abs, _ := filepath.Abs(root); abs != old.Root {
+				old.Journal = nil
+			}
+			old.Root = root
+		}
+		opts.Skip = scanner.SkipFunc(old.Root)
+		ix, changes, err = index.Update(old, opts)
+	} else {
+		opts.Skip = scanner.SkipFunc(root)
+		ix, err = index.Build(root, opts)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error indexing: %v\n", err)
+		return exitError
+	}
+	if err := ix.Save(*indexPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving index: %v\n", err)
+		return exitError
+	}
+
+	fmt.Printf("Indexed %s in %v: %d files, %d directories, %s\n", ix.Root,
+		time.Since(started).Truncate(time.Millisecond), ix.Files, ix.Dirs, scanner.FormatBytes(ix.Bytes))
+	if changes != nil {
+		how := ""
+		if changes.Source != "" {
+			how = ", from the " + changes.Source
+		}
+		fmt.Printf("Changes: %d added, %d removed, %d modified (%d directories reused, %d re-read%s)\n",
+			changes.Added, changes.Removed, changes.Modified, changes.Reused, changes.Reread, how)
+	}
+	if info, err := os.Stat(*indexPath); err == nil {
+		fmt.Printf("Index: %s (%s)\n", *indexPath, scanner.FormatBytes(info.Size()))
+	}
+	return exitOK
+}
+
+func listIndexes() int {
+	names, err := index.All()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	for _, name := range names {
+		ix, err := index.Load(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			continue
+		}
+		fmt.Printf("%s  %d files, %s, built %s\n", ix.Root, ix.Files, scanner.FormatBytes(ix.Bytes),
+			ix.BuiltAt.Local().Format("2006-01-02 15:04"))
+	}
+	return exitOK
+}
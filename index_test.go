@@ -0,0 +1,38 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"file-counter/pkg/index"
+)
+
+// tmpTree is makeTree below /tmp, which the default skip rules prune
+// from walks that don't start inside it.
+func tmpTree(t *testing.T, tree map[string]string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("The default skip rules are Unix paths")
+	}
+	t.Setenv("TMPDIR", "/tmp")
+	return makeTree(t, tree)
+}
+
+func TestIndexUnderTmp(t *testing.T) {
+	root := tmpTree(t, map[string]string{"a": "1", "sub/b": "22", "sub/deeper/c": "333"})
+	name := filepath.Join(t.TempDir(), "index")
+
+	for _, cmd := range []string{"build", "update"} {
+		if code := runIndex([]string{cmd, "-index", name, root}); code != exitOK {
+			t.Fatalf("index %s exited with %d", cmd, code)
+		}
+		ix, err := index.Load(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ix.Files != 3 || ix.Dirs != 3 || ix.Bytes != 6 {
+			t.Errorf("index %s of %s: %d files, %d dirs, %d bytes, expected 3, 3, 6", cmd, root, ix.Files, ix.Dirs, ix.Bytes)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"file-counter/pkg/churn"
+	"file-counter/pkg/diskimage"
+	"file-counter/pkg/hook"
+	"file-counter/pkg/output"
+	"file-counter/pkg/scanner"
+	"file-counter/pkg/watch"
+)
+
+// version is set at build time with -ldflags "-X main.version=..."; the
+// module version from the build info is used otherwise.
+var version string
+
+// buildInfo is what runInfo reports.
+type buildInfo struct {
+	Version     string            `json:"version"`
+	Commit      string            `json:"commit,omitempty"`
+	CommitTime  string            `json:"commit_time,omitempty"`
+	Modified    bool              `json:"modified,omitempty"`
+	Go          string            `json:"go"`
+	Platform    string            `json:"platform"`
+	CPUs        int               `json:"cpus"`
+	Sources     []string          `json:"sources"`
+	Outputs     []string          `json:"outputs"`
+	Hooks       []string          `json:"hooks"`
+	Features    []scanner.Feature `json:"features"`
+	SkipPaths   []string          `json:"default_skip_paths"`
+	CacheDir    string            `json:"cache_dir,omitempty"`
+	Environment map[string]string `json:"environment,omitempty"`
+}
+
+func collectBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:  version,
+		Go:       runtime.Version(),
+		Platform: runtime.GOOS + "/" + runtime.GOARCH,
+		CPUs:     runtime.NumCPU(),
+		Sources: []string{
+			"local filesystem",
+			"path lists (-files-from)",
+			"disk images (raw, qcow2: " + strings.Join(diskimage.Filesystems, ", ") + ")",
+			"container images",
+			"Docker containers and volumes",
+			"Kubernetes volumes (agent)",
+		},
+		Outputs:   output.Formats(),
+		Hooks:     hook.Names(),
+		Features:  scanner.Features(),
+		SkipPaths: scanner.DefaultSkipPaths(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Commit = s.Value
+			case "vcs.time":
+				info.CommitTime = s.Value
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "(devel)"
+	}
+	background := "low priority scans (-background)"
+	if backgroundPriority != "" {
+		background = "low priority scans (-background: " + backgroundPriority + ")"
+	}
+	live := "live counting (watch -live)"
+	if watch.LiveBackend != "" {
+		live = "live counting (watch -live: " + watch.LiveBackend + ")"
+	}
+	info.Features = append(info.Features,
+		scanner.Feature{Name: background, Available: backgroundPriority != ""},
+		scanner.Feature{Name: live, Available: watch.LiveBackend != ""},
+		scanner.Feature{Name: "process attribution (watch -procs: eBPF)", Available: churn.Supported},
+		scanner.Feature{Name: "Time Machine exclusions (-backup-exclusions)", Available: haveTimeMachine})
+	if dir, err := os.UserCacheDir(); err == nil {
+		info.CacheDir = dir
+	}
+	for _, name := range []string{"GOMAXPROCS", "GOMEMLIMIT", apiTokenEnv} {
+		if v, ok := os.LookupEnv(name); ok {
+			if name == apiTokenEnv {
+				v = "(set)"
+			}
+			if info.Environment == nil {
+				info.Environment = map[string]string{}
+			}
+			info.Environment[name] = v
+		}
+	}
+	return info
+}
+
+// runInfo prints the version, build and platform capabilities, for bug
+// reports.
+func runInfo(args []string) int {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	jsonOut := fs.Bool("json", false, "print JSON instead of text")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: file-counter info [-json]")
+		fmt.Fprintln(os.Stderr, "Prints the version, build details and what this build supports, to include in bug reports.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return exitError
+	}
+
+	info := collectBuildInfo()
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(info)
+		return exitOK
+	}
+	fmt.Printf("file-counter %s\n", info.Version)
+	if info.Commit != "" {
+		commit := info.Commit
+		if info.CommitTime != "" {
+			commit += " (" + info.CommitTime + ")"
+		}
+		if info.Modified {
+			commit += ", modified"
+		}
+		fmt.Printf("Commit:    %s\n", commit)
+	}
+	fmt.Printf("Go:        %s %s, %d CPUs\n", info.Go, info.Platform, info.CPUs)
+	if info.CacheDir != "" {
+		fmt.Printf("Cache:     %s\n", info.CacheDir)
+	}
+	var env []string
+	for name, v := range info.Environment {
+		env = append(env, name+"="+v)
+	}
+	sort.Strings(env)
+	for _, kv := range env {
+		fmt.Printf("Env:       %s\n", kv)
+	}
+	fmt.Printf("Skips:     %s\n", strings.Join(info.SkipPaths, " "))
+	fmt.Printf("Outputs:   %s\n", strings.Join(info.Outputs, ", "))
+	fmt.Printf("Hooks:     %s\n", strings.Join(info.Hooks, ", "))
+	fmt.Println("\nSources:")
+	for _, s := range info.Sources {
+		fmt.Printf("  %s\n", s)
+	}
+	fmt.Println("\nPlatform features:")
+	for _, f := range info.Features {
+		mark := " "
+		if f.Available {
+			mark = "x"
+		}
+		fmt.Printf("  [%s] %s\n", mark, f.Name)
+	}
+	return exitOK
+}
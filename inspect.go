@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"file-counter/pkg/scanner"
+)
+
+// inspections carries the results of several content inspections of one
+// file in FileRecord.Inspection; see addInspector.
+type inspections []any
+
+// addInspector has the scanning workers call fn for every regular file
+// stored locally, after whatever opts.Inspect already does, so that several
+// content passes can run in one scan. fn should return a nil result for
+// files it has nothing to say about. Sinks find their result with
+// inspection.
+func addInspector(opts *scanner.Options, fn func(ctx context.Context, path string, info os.FileInfo) (any, error)) {
+	prev := opts.Inspect
+	if prev == nil {
+		opts.Inspect = fn
+		return
+	}
+	opts.Inspect = func(ctx context.Context, path string, info os.FileInfo) (any, error) {
+		a, aerr := prev(ctx, path, info)
+		b, berr := fn(ctx, path, info)
+		var all inspections
+		for _, v := range []any{a, b} {
+			switch v := v.(type) {
+			case nil:
+			case inspections:
+				all = append(all, v...)
+			default:
+				all = append(all, v)
+			}
+		}
+		var v any
+		switch len(all) {
+		case 0:
+		case 1:
+			v = all[0]
+		default:
+			v = all
+		}
+		return v, errors.Join(aerr, berr)
+	}
+}
+
+// inspection returns the result of type T that an inspector added with
+// addInspector found for rec, if any.
+func inspection[T any](rec *scanner.FileRecord) (T, bool) {
+	switch v := rec.Inspection.(type) {
+	case T:
+		return v, true
+	case inspections:
+		for _, x := range v {
+			if t, ok := x.(T); ok {
+				return t, true
+			}
+		}
+	}
+	var zero T
+	return zero, false
+}
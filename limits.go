@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"file-counter/pkg/scanner"
+)
+
+// parseMountLimits turns repeated -mount-limit values of the form
+// "mountpoint=N" or "fstype=N" into scanner.Options.MountLimits.
+func parseMountLimits(values []string) (map[string]int, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	limits := make(map[string]int, len(values))
+	for _, value := range values {
+		key, n, ok := strings.Cut(value, "=")
+		limit, err := strconv.Atoi(n)
+		if !ok || key == "" || err != nil || limit < 1 {
+			return nil, fmt.Errorf("invalid -mount-limit %q, expected mountpoint=N or fstype=N", value)
+		}
+		limits[key] = limit
+	}
+	return limits, nil
+}
+
+// applyContainerLimits sizes the Go runtime for the cgroup the process runs
+// in: GOMAXPROCS follows the CPU quota, and the garbage collector's soft
+// memory limit is set just below the memory limit so in-memory aggregations
+// are collected before the container is OOM-killed. Explicit GOMAXPROCS or
+// GOMEMLIMIT settings win.
+func applyContainerLimits() scanner.Limits {
+	limits := scanner.ContainerLimits()
+	if limits.CPUs > 0 && os.Getenv("GOMAXPROCS") == "" {
+		if n := int(math.Ceil(limits.CPUs)); n < runtime.GOMAXPROCS(0) {
+			runtime.GOMAXPROCS(n)
+		}
+	}
+	if limits.Memory > 0 && os.Getenv("GOMEMLIMIT") == "" {
+		debug.SetMemoryLimit(limits.Memory / 10 * 9)
+	}
+	return limits
+}
+
+func formatLimits(l scanner.Limits) string {
+	var parts []string
+	if l.CPUs > 0 {
+		parts = append(parts, strconv.FormatFloat(l.CPUs, 'f', -1, 64)+" CPUs")
+	}
+	if l.Memory > 0 {
+		parts = append(parts, scanner.FormatBytes(l.Memory)+" memory")
+	}
+	return strings.Join(parts, ", ")
+}
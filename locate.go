@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"file-counter/pkg/locate"
+	"file-counter/pkg/scanner"
+)
+
+// runLocate counts a tree from the updatedb database instead of walking it.
+func runLocate(args []string) int {
+	fs := flag.NewFlagSet("locate", flag.ExitOnError)
+	db := fs.String("db", "", "locate `database` to read (default: the system plocate or mlocate database)")
+	sizes := fs.Bool("sizes", false, "stat every listed path to add up sizes (slower, but still skips the directory walk)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: file-counter locate [-db file] [-sizes] [path]")
+		fmt.Fprintln(os.Stderr, "Counts the files under path (default /) as of the last updatedb run.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return exitError
+	}
+
+	root := "/"
+	if fs.NArg() == 1 {
+		abs, err := filepath.Abs(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		root = abs
+	}
+	if *db == "" {
+		found, err := locate.Find()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		*db = found
+	}
+
+	if *sizes {
+		return locateSizes(*db, root)
+	}
+
+	started := time.Now()
+	var files, dirs int64
+	info, err := locate.Paths(*db, root, func(path string, dir bool) error {
+		if dir {
+			dirs++
+		} else {
+			files++
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	printLocateHeader(info, root)
+	if info.Typed {
+		fmt.Printf("Files:       %d\n", files)
+		fmt.Printf("Directories: %d\n", dirs)
+	} else {
+		fmt.Printf("Entries:     %d (files and directories; use -sizes to tell them apart)\n", files)
+	}
+	fmt.Printf("Read in %v\n", time.Since(started).Truncate(time.Millisecond))
+	return exitOK
+}
+
+// locateSizes feeds the database entries to the scanner as a path list, so
+// each one is stat'ed but no directory is read.
+func locateSizes(db, root string) int {
+	pr, pw := io.Pipe()
+	infoc := make(chan *locate.Info, 1)
+	go func() {
+		w := bufio.NewWriter(pw)
+		info, err := locate.Paths(db, root, func(path string, dir bool) error {
+			w.WriteString(path)
+			return w.WriteByte(0)
+		})
+		if err == nil {
+			err = w.Flush()
+		}
+		infoc <- info
+		pw.CloseWithError(err)
+	}()
+
+	fileScanner := scanner.NewScannerWithOptions(scanner.Options{})
+	result := fileScanner.StartList(pr, 0)
+	pr.Close()
+	info := <-infoc
+	if err := fileScanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	fmt.Println()
+	printLocateHeader(info, root)
+	fmt.Printf("Files:       %d\n", result.TotalFiles)
+	fmt.Printf("Directories: %d\n", result.TotalDirs)
+	fmt.Printf("Total size:  %s\n", scanner.FormatBytes(result.TotalBytes))
+	if result.TotalErrors > 0 {
+		fmt.Printf("Missing:     %d (deleted since the database was built, or unreadable)\n", result.TotalErrors)
+	}
+	fmt.Printf("Scanned in %v\n", result.Duration.Truncate(time.Millisecond))
+	return exitOK
+}
+
+func printLocateHeader(info *locate.Info, root string) {
+	fmt.Printf("Locate database totals for %s (%s %s, updated %s, %s ago)\n", root, info.Format, info.Path,
+		info.Updated.Format(time.DateTime), time.Since(info.Updated).Truncate(time.Minute))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"file-counter/pkg/logfile"
+	"file-counter/pkg/scanner"
+)
+
+// logFlags are the flags of the long-running commands for writing what
+// they would print to a rotated log file instead.
+type logFlags struct {
+	file    *string
+	maxSize *string
+	every   *time.Duration
+	keep    *int
+	maxAge  *time.Duration
+}
+
+func addLogFlags(fs *flag.FlagSet) *logFlags {
+	return &logFlags{
+		file:    fs.String("log-file", "", "append output and errors to this `file` instead of the terminal"),
+		maxSize: fs.String("log-max-size", "10M", "rotate -log-file once it reaches this `size`; 0 for no limit"),
+		every:   fs.Duration("log-rotate", 24*time.Hour, "rotate -log-file after this `duration`; 0 to rotate by size only"),
+		keep:    fs.Int("log-keep", 7, "keep this many rotated log `files`; 0 keeps them all"),
+		maxAge:  fs.Duration("log-max-age", 0, "remove rotated log files older than this `duration`"),
+	}
+}
+
+// open returns where to write output and errors: stdout and stderr, or
+// with -log-file both to the log file; close closes it.
+func (f *logFlags) open() (out, errs io.Writer, close func() error, err error) {
+	if *f.file == "" {
+		return os.Stdout, os.Stderr, func() error { return nil }, nil
+	}
+	maxSize, err := scanner.ParseBytes(*f.maxSize)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("-log-max-size: %v", err)
+	}
+	l, err := logfile.Open(*f.file, logfile.Options{MaxSize: maxSize, Every: *f.every, Keep: *f.keep, MaxAge: *f.maxAge})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return l, l, l.Close, nil
+}
@@ -1,52 +1,580 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"runtime"
+	"strings"
 	"syscall"
+	"text/template"
+	"time"
 
+	"file-counter/pkg/hashcache"
+	"file-counter/pkg/output"
+	"file-counter/pkg/progress"
+	"file-counter/pkg/query"
 	"file-counter/pkg/scanner"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "manifest":
+			os.Exit(runManifest(os.Args[2:]))
+		case "verify":
+			os.Exit(runVerify(os.Args[2:]))
+		case "baseline":
+			os.Exit(runBaseline(os.Args[2:]))
+		case "check":
+			os.Exit(runCheck(os.Args[2:]))
+		case "estimate":
+			os.Exit(runEstimate(os.Args[2:]))
+		case "image":
+			os.Exit(runImage(os.Args[2:]))
+		case "docker":
+			os.Exit(runDocker(os.Args[2:]))
+		case "agent":
+			os.Exit(runAgent(os.Args[2:]))
+		case "disk":
+			os.Exit(runDisk(os.Args[2:]))
+		case "locate":
+			os.Exit(runLocate(os.Args[2:]))
+		case "index":
+			os.Exit(runIndex(os.Args[2:]))
+		case "query":
+			os.Exit(runQuery(os.Args[2:]))
+		case "search":
+			os.Exit(runSearch(os.Args[2:]))
+		case "serve":
+			os.Exit(runServe(os.Args[2:]))
+		case "watch":
+			os.Exit(runWatch(os.Args[2:]))
+		case "info":
+			os.Exit(runInfo(os.Args[2:]))
+		case "self-update":
+			os.Exit(runSelfUpdate(os.Args[2:]))
+		case "rescan-errors":
+			os.Exit(runRescanErrors(os.Args[2:]))
+		}
+	}
+
+	dedupHardlinks := flag.Bool("dedup-hardlinks", false, "count files with multiple hard links only once")
+	var outputSpecs stringList
+	flag.Var(&outputSpecs, "output", "stream per-file records to `format[://path]` (ndjson, csv, manifest, parquet, arrow, sqlite, postgres, clickhouse, elasticsearch, kafka, nats, mqtt, graphite, statsd, influx, tar, cas); repeatable")
+	hash := flag.Bool("hash", false, "record SHA-256 hashes of regular files in -output records")
+	fieldList := flag.String("fields", "", "limit ndjson and csv -output records to these comma-separated `fields` ("+strings.Join(output.Fields, ",")+"); hash implies -hash")
+	selectCond := flag.String("select", "", "only list entries meeting this `condition` in ndjson and csv -output, -format and -print0, written as in a query's WHERE clause, e.g. \"size > 100MB and ext = 'log'\"")
+	hashCache := flag.Bool("hash-cache", false, "reuse the hashes of files unchanged since an earlier -hash-cache run instead of reading them again")
+	var mountLimitSpecs stringList
+	flag.Var(&mountLimitSpecs, "mount-limit", "cap concurrent operations on a filesystem, as `mountpoint=N` or fstype=N (e.g. nfs=4); repeatable")
+	logInterval := flag.Duration("log-interval", 10*time.Second, "when output is not a terminal, print a progress line every `duration`")
+	timeout := flag.Duration("timeout", 0, "stop the scan after this `duration` (e.g. 30m) and report partial results")
+	precount := flag.Bool("precount", false, "count entries quickly before scanning to show a progress bar with ETA")
+	recordProgress := flag.Bool("record-progress", false, "keep the live counters under the user cache directory, so 'file-counter serve' can show this scan's progress")
+	estimateFrom := flag.String("estimate-from", "", "use this baseline or snapshot `file` of the same tree as the progress bar estimate")
+	background := flag.Bool("background", false, "run with idle I/O priority and the lowest CPU priority, for busy production hosts")
+	push := flag.String("push", "", "POST the JSON scan summary to this collector `URL`, spooling it if the collector is unreachable (signed with $"+output.PushKeyEnv+")")
+	filesFrom := flag.String("files-from", "", "scan the paths listed in `file` (\"-\" for stdin, newline or NUL separated) instead of walking a tree")
+	archiveTo := flag.String("archive-to", "", "copy every scanned file into the tar `archive` (gzip-compressed for .tar.gz/.tgz) while counting")
+	print0 := flag.Bool("print0", false, "write the path of every scanned file to stdout, NUL-terminated, and the report to stderr")
+	format := flag.String("format", "", "write every scanned entry to stdout through this Go `template`, e.g. '{{.Path}}\\t{{.Size}}', and the report to stderr")
+	summaryFormat := flag.String("summary-format", "", "write the totals to stdout through this Go `template`, e.g. '{{.TotalFiles}} {{human .TotalBytes}}', and the report to stderr")
+	backupExclusions := flag.Bool("backup-exclusions", false, "report how much of the scanned data Time Machine backs up and how much it excludes (macOS)")
+	snapshots := flag.String("snapshots", "include", "what to do with ZFS and Btrfs snapshots: `include` them, skip them, or count them separately")
+	reflinks := flag.Bool("reflinks", false, "read file extents to report the physical size of data shared through reflinks or clones (XFS, Btrfs, APFS)")
+	auditSize := flag.String("audit-size", "", "log every file of at least this `size` (e.g. 10G) with its owner and mtime")
+	auditLog := flag.String("audit-log", "", "append -audit-size entries to this `file` instead of stderr")
+	auditWebhook := flag.String("audit-webhook", "", "also POST -audit-size entries as JSON to this `URL`")
+	findSensitive := flag.Bool("sensitive", false, "flag files whose names suggest credentials (keys, keystores, .env, password databases) and report them per directory with who can read them")
+	findSecrets := flag.Bool("secrets", false, "scan the contents of small text files for secrets such as AWS keys and private keys, reported redacted")
+	secretPatterns := flag.String("secret-patterns", "", "read -secrets patterns from this `file` of name: regexp lines instead of the built-in ones")
+	secretsReport := flag.String("secrets-report", "", "write the redacted -secrets matches to this JSON `file` instead of printing them")
+	probeMedia := flag.Bool("media", false, "read image dimensions and video durations and codecs from file headers, and report megapixels and hours of video")
+	exifReport := flag.Bool("exif", false, "read the EXIF date and camera of photos and report their count and size per year and per camera model")
+	audioReport := flag.Bool("audio", false, "read the ID3, FLAC and MP4 tags of audio files and report total playing time, tracks per artist and album, and files missing tags")
+	documents := flag.Bool("documents", false, "read the page count and author of PDF and office documents and report totals per format, directory and author")
+	documentsReport := flag.String("documents-report", "", "write the -documents totals of every directory to this tab-separated `file`")
+	compressibility := flag.Bool("compressibility", false, "sniff every file's format and report how much of the data is already compressed (archives, images, video) and how much filesystem compression could shrink")
+	entropy := flag.Bool("entropy", false, "sample the start of every file and flag likely encrypted data: known encrypted formats, and random-looking data in no known compressed format")
+	entropyReport := flag.String("entropy-report", "", "write the -entropy findings to this JSON `file` instead of printing them")
+	textStats := flag.Bool("text", false, "classify files as text or binary by a NUL byte in their first 8000 bytes, and report the files and bytes of each")
+	textHygiene := flag.Bool("text-hygiene", false, "report the line endings, byte order marks and encodings of text files, overall and for directories that mix them")
+	textHygieneReport := flag.String("text-hygiene-report", "", "write the -text-hygiene totals of every directory to this tab-separated `file`")
+	scriptStats := flag.Bool("scripts", false, "count executable scripts by the interpreter their #! line names, such as bash or python3")
+	executables := flag.Bool("executables", false, "identify ELF, PE and Mach-O executables and shared libraries and report them per format, architecture and linkage")
+	knownGood := flag.String("known-good", "", "count files whose SHA-256 is in this hash list `file` (NSRL-style known-good files); implies -hash")
+	blocklist := flag.String("blocklist", "", "report files whose SHA-256 is in this hash list `file` of known-bad files; implies -hash")
+	hookCommand := flag.String("hook", "", "run this `command` with each matching file's path appended and tally the first line it prints as the file's label")
+	hookFunc := flag.String("hook-func", "", "classify matching files with the built-in hook of this `name` (mime)")
+	var hookMatch stringList
+	flag.Var(&hookMatch, "hook-match", "only pass files whose name matches this `glob` to the hook; repeatable")
+	hookJobs := flag.Int("hook-jobs", runtime.NumCPU(), "run at most `n` hook calls at a time")
+	hookTimeout := flag.Duration("hook-timeout", 30*time.Second, "give up on a -hook command after this `duration`")
+	hookResults := flag.String("hook-results", "", "write each classified file's path and label to this tab-separated `file`")
+	slowestDirs := flag.Int("slowest-dirs", 0, "report the `n` directories that took longest to list, such as network mounts or directories with millions of entries")
+	profile := flag.Bool("perf", false, "time the parts of the scan and print where the time went: listing directories, stat calls, hashing, and workers waiting")
+	saveErrors := flag.String("save-errors", "", "save the paths that could not be read to this JSON `file`, for 'file-counter rescan-errors'")
+	pathQueue := flag.Int("queue", 0, "let the walk find up to `n` paths ahead of the workers (default 1000)")
+	workStealing := flag.Bool("work-stealing", false, "give each worker its own path queue, with idle workers stealing from busy ones")
+	followLinks := flag.Bool("follow-links", false, "descend into symbolic links and junctions to directories, skipping cycles")
+	filter := filterFlags(flag.CommandLine)
+	shardSize := flag.String("shard-size", "", "split each -output into numbered files of this many records (e.g. 5M)")
+	flag.Parse()
+
+	rootPath := "/"
+	if flag.NArg() > 0 {
+		rootPath = flag.Arg(0)
+	}
+	// Several roots are scanned together and reported one by one as well
+	// as in total.
+	var roots []string
+	if flag.NArg() > 1 {
+		roots = flag.Args()
+		// Outputs that store relative paths make them relative to here.
+		rootPath, _ = os.Getwd()
+	}
+	var list *bufio.Reader
+	if *filesFrom != "" {
+		if flag.NArg() > 0 {
+			fmt.Fprintln(os.Stderr, "Error: -files-from cannot be combined with a root path")
+			os.Exit(1)
+		}
+		r, err := openList(*filesFrom)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -files-from: %v\n", err)
+			os.Exit(1)
+		}
+		list = r
+		// Outputs that store relative paths make them relative to here.
+		rootPath, _ = os.Getwd()
+	}
+
+	if *background {
+		if err := enterBackground(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: -background: %v\n", err)
+		}
+	}
+	mountLimits, err := parseMountLimits(mountLimitSpecs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	snapshotMode, ok := map[string]scanner.SnapshotMode{
+		"include":  scanner.SnapshotsInclude,
+		"skip":     scanner.SnapshotsSkip,
+		"separate": scanner.SnapshotsSeparate,
+	}[*snapshots]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: -snapshots must be include, skip or separate, not %q\n", *snapshots)
+		os.Exit(1)
+	}
+	opts := scanner.Options{
+		DedupHardlinks: *dedupHardlinks,
+		Hash:           *hash,
+		MountLimits:    mountLimits,
+		Timeout:        *timeout,
+		Filter:         filter(),
+		FollowLinks:    *followLinks,
+		Snapshots:      snapshotMode,
+		Reflinks:       *reflinks,
+		LogInterval:    *logInterval,
+		PathQueue:      *pathQueue,
+		WorkStealing:   *workStealing,
+		SlowestDirs:    *slowestDirs,
+		Profile:        *profile,
+	}
+	if *push != "" {
+		outputSpecs = append(outputSpecs, "push://"+*push)
+	}
+	if *archiveTo != "" {
+		outputSpecs = append(outputSpecs, "tar://"+*archiveTo)
+	}
+	var shardRecords int64
+	if *shardSize != "" {
+		n, err := output.ParseCount(*shardSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -shard-size: %v\n", err)
+			os.Exit(1)
+		}
+		shardRecords = n
+	}
+	var fields []string
+	if *fieldList != "" {
+		if !listsRecords(outputSpecs) {
+			fmt.Fprintln(os.Stderr, "Error: -fields needs an ndjson or csv -output")
+			os.Exit(1)
+		}
+		if fields, err = output.ParseFields(*fieldList); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -fields: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	var sel *query.Filter
+	if *selectCond != "" {
+		if !listsRecords(outputSpecs) && !*print0 && *format == "" {
+			fmt.Fprintln(os.Stderr, "Error: -select needs an ndjson or csv -output, -format or -print0")
+			os.Exit(1)
+		}
+		if sel, err = query.ParseFilter(*selectCond, query.RecordColumns); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -select: %v\n", err)
+			os.Exit(1)
+		}
+		if sel.Uses("hash") {
+			opts.Hash = true
+		}
+	}
+	outputs, err := openOutputs(outputSpecs, shardRecords, fields, sel, rootPath, &opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *print0 && *format != "" {
+		fmt.Fprintln(os.Stderr, "Error: -print0 and -format both write to stdout; use \\0 in -format instead")
+		os.Exit(1)
+	}
+	var summaryTmpl *template.Template
+	if *summaryFormat != "" {
+		if summaryTmpl, err = parseTemplate("summary-format", *summaryFormat); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -summary-format: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	stdout := os.Stdout
+	if *print0 {
+		// Stdout carries only the path list; everything else printed from
+		// here on, including the scanner's live counters, goes to stderr.
+		sink := newPrint0Sink(os.Stdout)
+		outputs = append(outputs, sink)
+		opts.Sinks = append(opts.Sinks, selected(sink, sel))
+		os.Stdout = os.Stderr
+	}
+	if *format != "" {
+		t, err := parseTemplate("format", *format)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -format: %v\n", err)
+			os.Exit(1)
+		}
+		sink := newTemplateSink(t, os.Stdout)
+		outputs = append(outputs, sink)
+		opts.Sinks = append(opts.Sinks, selected(sink, sel))
+		if strings.Contains(*format, ".Hash") {
+			opts.Hash = true
+		}
+		os.Stdout = os.Stderr
+	}
+	if summaryTmpl != nil {
+		// Likewise, stdout only gets the summary.
+		os.Stdout = os.Stderr
+	}
+	var audit *auditSink
+	if *auditSize == "" && (*auditLog != "" || *auditWebhook != "") {
+		fmt.Fprintln(os.Stderr, "Error: -audit-log and -audit-webhook need -audit-size")
+		os.Exit(1)
+	}
+	if *auditSize != "" {
+		min, err := scanner.ParseBytes(*auditSize)
+		if err == nil {
+			audit, err = newAuditSink(min, *auditLog, *auditWebhook, rootPath)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -audit-size: %v\n", err)
+			os.Exit(1)
+		}
+		outputs = append(outputs, audit)
+		opts.Sinks = append(opts.Sinks, audit)
+	}
+	var sensitiveFiles *sensitiveSink
+	if *findSensitive {
+		sensitiveFiles = &sensitiveSink{}
+		opts.Sinks = append(opts.Sinks, sensitiveFiles)
+	}
+	if !*findSecrets && (*secretPatterns != "" || *secretsReport != "") {
+		fmt.Fprintln(os.Stderr, "Error: -secret-patterns and -secrets-report need -secrets")
+		os.Exit(1)
+	}
+	var secrets *secretsSink
+	if *findSecrets {
+		secrets, err = newSecretsSink(*secretPatterns, *secretsReport, &opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -secret-patterns: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *probeMedia || *exifReport || *audioReport {
+		inspectMedia(&opts)
+	}
+	var mediaFiles *mediaSink
+	if *probeMedia {
+		mediaFiles = newMediaSink(&opts)
+	}
+	var photos *photoSink
+	if *exifReport {
+		photos = newPhotoSink(&opts)
+	}
+	var music *audioSink
+	if *audioReport {
+		music = newAudioSink(&opts)
+	}
+	if !*documents && *documentsReport != "" {
+		fmt.Fprintln(os.Stderr, "Error: -documents-report needs -documents")
+		os.Exit(1)
+	}
+	var docs *documentSink
+	if *documents {
+		docs = newDocumentSink(*documentsReport, &opts)
+	}
+	var textFiles *textSink
+	if *textStats {
+		textFiles = newTextSink(&opts)
+	}
+	if !*textHygiene && *textHygieneReport != "" {
+		fmt.Fprintln(os.Stderr, "Error: -text-hygiene-report needs -text-hygiene")
+		os.Exit(1)
+	}
+	var hygiene *hygieneSink
+	if *textHygiene {
+		hygiene = newHygieneSink(*textHygieneReport, &opts)
+	}
+	var scripts *scriptSink
+	if *scriptStats {
+		scripts = newScriptSink(&opts)
+	}
+	var binaries *executableSink
+	if *executables {
+		binaries = newExecutableSink(&opts)
+	}
+	var compressible *compressibilitySink
+	if *compressibility {
+		compressible = newCompressibilitySink(&opts)
+	}
+	if !*entropy && *entropyReport != "" {
+		fmt.Fprintln(os.Stderr, "Error: -entropy-report needs -entropy")
+		os.Exit(1)
+	}
+	var encrypted *entropySink
+	if *entropy {
+		encrypted = newEntropySink(*entropyReport, &opts)
+	}
+	var lookup *hashLookupSink
+	if *knownGood != "" || *blocklist != "" {
+		lookup, err = newHashLookupSink(*knownGood, *blocklist)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Hash = true
+		opts.Sinks = append(opts.Sinks, lookup)
+	}
+	var hashes *hashcache.Cache
+	if *hashCache {
+		if !opts.Hash {
+			fmt.Fprintln(os.Stderr, "Error: -hash-cache needs -hash, or an -output or -known-good/-blocklist lookup that hashes")
+			os.Exit(1)
+		}
+		if hashes = openHashCache(); hashes != nil {
+			opts.HashCache = hashes
+		}
+	}
+	var classify *hookRunner
+	if *hookCommand != "" || *hookFunc != "" {
+		classify, err = newHookRunner(*hookCommand, *hookFunc, hookMatch, *hookJobs, *hookTimeout, *hookResults)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Sinks = append(opts.Sinks, classify)
+	} else if len(hookMatch) > 0 || *hookResults != "" {
+		fmt.Fprintln(os.Stderr, "Error: -hook-match and -hook-results need -hook or -hook-func")
+		os.Exit(1)
+	}
+	var backup *backupSink
+	if *backupExclusions {
+		exclusions, err := loadBackupExclusions(rootPath)
+		if exclusions == nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: -backup-exclusions: excluded items were not looked up: %v\n", err)
+		}
+		backup = newBackupSink(exclusions)
+		opts.Sinks = append(opts.Sinks, backup)
+	}
+
 	fmt.Println("=== File Counter - Advanced File System Scanner ===")
-	fmt.Println("Scanning entire file system from root /")
-	fmt.Println("Note: This may take a very long time and require elevated permissions")
-	fmt.Println("Use 'sudo' for full system access if needed")
+	if list != nil {
+		fmt.Printf("Scanning paths listed in %s\n", *filesFrom)
+	} else if roots != nil {
+		fmt.Printf("Scanning %d roots: %s\n", len(roots), strings.Join(roots, ", "))
+	} else if rootPath == "/" {
+		fmt.Println("Scanning entire file system from root /")
+		fmt.Println("Note: This may take a very long time and require elevated permissions")
+		fmt.Println("Use 'sudo' for full system access if needed")
+	} else {
+		fmt.Printf("Scanning: %s\n", rootPath)
+	}
 	fmt.Println()
 
-	fileScanner := scanner.NewScanner()
+	switch {
+	case list != nil:
+		// No tree to estimate from.
+	case *estimateFrom != "":
+		est, err := estimateFromSnapshot(*estimateFrom)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -estimate-from: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Estimate = est
+	case *precount && roots != nil:
+		fmt.Println("Pre-counting entries...")
+		opts.Estimate = &scanner.Estimate{Source: "pre-count"}
+		for _, root := range roots {
+			est := scanner.Precount(root)
+			opts.Estimate.Items += est.Items
+			opts.Estimate.Bytes += est.Bytes
+		}
+	case *precount:
+		fmt.Println("Pre-counting entries...")
+		opts.Estimate = scanner.Precount(rootPath)
+	case roots != nil:
+		opts.Estimate = historyEstimate(roots)
+	default:
+		opts.Estimate, _ = loadHistory(rootPath)
+	}
+	if est := opts.Estimate; est != nil {
+		fmt.Printf("Expecting about %d entries (from %s)\n", est.Items, est.Source)
+	}
+
+	if limits := applyContainerLimits(); limits != (scanner.Limits{}) {
+		fmt.Printf("Container limits: %s\n", formatLimits(limits))
+	}
+	// Persist the live counters for 'serve', so a UI that connects mid-scan
+	// sees the progress so far. Like the history, this is best effort.
+	var recorder *progress.Recorder
+	if *recordProgress && list == nil && roots == nil {
+		if rec, err := progress.NewRecorder(rootPath, opts.Estimate); err == nil {
+			recorder = rec
+			report := opts.OnProgress
+			opts.OnProgress = func(stats scanner.Stats) {
+				if report != nil {
+					report(stats)
+				}
+				rec.Update(stats)
+			}
+		}
+	}
+	var failures *errorRecorder
+	if *saveErrors != "" {
+		failures = &errorRecorder{}
+		opts.Visitor = failures
+	}
+	fileScanner := scanner.NewScannerWithOptions(opts)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
 	resultChan := make(chan *scanner.ScanResult, 1)
+	var perRoot map[string]*scanner.ScanResult
 	go func() {
-		result := fileScanner.Start("/")
-		resultChan <- result
+		if roots != nil {
+			var result *scanner.ScanResult
+			result, perRoot = fileScanner.StartRoots(roots)
+			resultChan <- result
+			return
+		}
+		if list != nil {
+			resultChan <- fileScanner.StartList(list, scanner.DetectDelimiter(list))
+			return
+		}
+		resultChan <- fileScanner.Start(rootPath)
 	}()
 
+	// Start always returns once the scan is stopped, with the totals counted
+	// so far. A second interrupt gives up on waiting for it.
 	var result *scanner.ScanResult
 	select {
 	case <-sigChan:
-		fmt.Println("\n\nReceived interrupt signal. Stopping scan...")
+		fmt.Println("\n\nReceived interrupt signal. Stopping scan (press Ctrl+C again to quit immediately)...")
 		fileScanner.Stop()
 		select {
 		case result = <-resultChan:
-		case <-make(chan struct{}):
+		case <-sigChan:
+			fmt.Fprintln(os.Stderr, "Aborted.")
+			os.Exit(130)
 		}
 		fmt.Println("Scan interrupted by user.")
 	case result = <-resultChan:
-		fmt.Println("\n\nScan completed!")
+		if result.Completed {
+			fmt.Println("\n\nScan completed!")
+		} else if *timeout > 0 && fileScanner.Err() == nil {
+			fmt.Printf("\n\nScan stopped after the %v timeout; results are partial.\n", *timeout)
+		}
+	}
+	if result != nil && list == nil && roots == nil {
+		saveHistory(rootPath, result)
+	}
+	for root, r := range perRoot {
+		saveHistory(root, r)
+	}
+	if result != nil && recorder != nil {
+		recorder.Finish(result)
+	}
+	if err := closeOutputs(outputs, result); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+	}
+	saveHashCache(hashes)
+	if failures != nil {
+		root := ""
+		if list == nil && roots == nil {
+			root = rootPath
+		}
+		failures.save(*saveErrors, root)
+	}
+	if summaryTmpl != nil && result != nil {
+		root := rootPath
+		if list != nil {
+			root = *filesFrom
+		} else if roots != nil {
+			root = strings.Join(roots, " ")
+		}
+		if err := summaryTmpl.Execute(stdout, summaryData{result, root}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -summary-format: %v\n", err)
+		} else {
+			fmt.Fprintln(stdout)
+		}
+	}
+	if err := fileScanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Scan aborted: %v\n", err)
 	}
+
 	if result != nil {
-		fmt.Printf("\n=== FINAL RESULTS ===\n")
+		if result.Completed {
+			fmt.Printf("\n=== FINAL RESULTS ===\n")
+		} else {
+			fmt.Printf("\n=== PARTIAL RESULTS ===\n")
+		}
 		fmt.Printf("Total Files Scanned: %d\n", result.TotalFiles)
 		fmt.Printf("Total Directories: %d\n", result.TotalDirs)
 		fmt.Printf("Total Errors: %d\n", result.TotalErrors)
+		if result.TotalReparsePoints > 0 {
+			fmt.Printf("Total Reparse Points: %d\n", result.TotalReparsePoints)
+		}
 		fmt.Printf("Total Skipped: %d\n", result.TotalSkipped)
+		for _, sk := range result.Skipped {
+			fmt.Printf("  %s: %d pruned (~%d entries, ~%s)\n", sk.Rule, sk.Count, sk.Entries, scanner.FormatBytes(sk.Bytes))
+		}
 		fmt.Printf("Total Data Size: %s\n", scanner.FormatBytes(result.TotalBytes))
+		if result.CloudOnlyFiles > 0 {
+			fmt.Printf("  Locally Present: %d files, %s\n", result.TotalFiles-result.CloudOnlyFiles, scanner.FormatBytes(result.TotalBytes-result.CloudOnlyBytes))
+			fmt.Printf("  Cloud-Only: %d files, %s\n", result.CloudOnlyFiles, scanner.FormatBytes(result.CloudOnlyBytes))
+		}
+		if *reflinks {
+			fmt.Printf("  Physically Unique: %s (%s shared through reflinks or clones)\n", scanner.FormatBytes(result.PhysicalBytes), scanner.FormatBytes(result.SharedBytes))
+		}
+		printSnapshots(result.Snapshots, snapshotMode)
 		fmt.Printf("Total Time: %v\n", result.Duration.Truncate(1))
 		fmt.Printf("Average Speed: %.2f files/second\n", result.FilesPerSecond)
 
@@ -60,6 +588,79 @@ func main() {
 			itemsPerSecond := float64(totalItems) / result.Duration.Seconds()
 			fmt.Printf("Items per Second: %.2f\n", itemsPerSecond)
 		}
+		printRoots(roots, perRoot)
+		if backup != nil {
+			backup.report()
+		}
+		if audit != nil {
+			audit.report()
+		}
+		if sensitiveFiles != nil {
+			sensitiveFiles.report()
+		}
+		if secrets != nil {
+			secrets.finish()
+		}
+		if mediaFiles != nil {
+			mediaFiles.report()
+		}
+		if photos != nil {
+			photos.report()
+		}
+		if music != nil {
+			music.report()
+		}
+		if docs != nil {
+			docs.finish()
+		}
+		if textFiles != nil {
+			textFiles.report()
+		}
+		if hygiene != nil {
+			hygiene.finish()
+		}
+		if scripts != nil {
+			scripts.report()
+		}
+		if binaries != nil {
+			binaries.report()
+		}
+		if compressible != nil {
+			compressible.report()
+		}
+		if encrypted != nil {
+			encrypted.finish()
+		}
+		if lookup != nil {
+			lookup.report()
+		}
+		if hashes != nil {
+			fmt.Printf("Hash Cache: %s\n", hashCacheSummary(hashes))
+		}
+		if classify != nil {
+			classify.report()
+		}
+
+		if *dedupHardlinks {
+			fmt.Printf("Duplicate Hard Links: %d\n", result.TotalHardlinks)
+			fmt.Printf("Tracked Inodes: %d (%s in memory)\n", result.VisitedInodes, scanner.FormatBytes(result.VisitedBytes))
+		}
+
+		for _, m := range result.Mounts {
+			mode := "fixed"
+			if m.Adaptive {
+				mode = fmt.Sprintf("adaptive, peak %d", m.PeakWorkers)
+			}
+			name := m.Path
+			if m.FSType != "" {
+				name += " (" + m.FSType + ")"
+			}
+			fmt.Printf("Concurrency %s: %d workers (%s), avg stat %v\n", name, m.Workers, mode, m.AvgLatency)
+		}
+		printSlowestDirs(result.SlowestDirs)
+		if result.Performance != nil {
+			printPerformance(result.Performance, result.Duration)
+		}
 
 		if result.TotalErrors > 0 {
 			fmt.Printf("\nScan completed with %d errors (permission denied, etc.)\n", result.TotalErrors)
@@ -70,3 +671,89 @@ func main() {
 
 	fmt.Println("\nThank you for using File Counter.")
 }
+
+// printSlowestDirs lists the directories that took the walk longest to
+// enumerate, slowest first.
+func printSlowestDirs(dirs []scanner.DirTiming) {
+	if len(dirs) == 0 {
+		return
+	}
+	fmt.Printf("\n=== SLOWEST DIRECTORIES ===\n")
+	fmt.Printf("%12s %10s  %s\n", "Time", "Entries", "Directory")
+	for _, d := range dirs {
+		fmt.Printf("%12v %10d  %s\n", d.Duration.Round(time.Microsecond), d.Entries, d.Path)
+	}
+}
+
+// printPerformance prints where the scan's time went. The walk's times are
+// shares of the scan's duration, the workers' of the time they were busy.
+func printPerformance(p *scanner.Performance, elapsed time.Duration) {
+	share := func(d, of time.Duration) string {
+		if of <= 0 {
+			return fmt.Sprintf("%v", d.Round(time.Millisecond))
+		}
+		return fmt.Sprintf("%v (%.1f%%)", d.Round(time.Millisecond), 100*float64(d)/float64(of))
+	}
+	fmt.Printf("\n=== SCAN PERFORMANCE ===\n")
+	fmt.Println("Walk:")
+	fmt.Printf("  Listing directories: %s\n", share(p.ReadDir, elapsed))
+	fmt.Printf("  Stat calls: %s\n", share(p.WalkStat, elapsed))
+	fmt.Printf("  Waiting for workers: %s\n", share(p.WalkBlocked, elapsed))
+	fmt.Printf("Workers: %d, %.1f%% busy", p.Workers, 100*p.Utilization())
+	if elapsed > 0 {
+		fmt.Printf(", %.1f at a time on average", float64(p.Busy)/float64(elapsed))
+	}
+	fmt.Println()
+	fmt.Printf("  Stat calls: %s\n", share(p.Stat, p.Busy))
+	if p.Hash > 0 {
+		fmt.Printf("  Hashing: %s\n", share(p.Hash, p.Busy))
+	}
+	if p.Inspect > 0 {
+		fmt.Printf("  Reading content: %s\n", share(p.Inspect, p.Busy))
+	}
+	fmt.Printf("  Waiting for output: %s\n", share(p.RecordWait, p.Busy))
+	fmt.Printf("  Waiting for paths: %v\n", p.PathWait.Round(time.Millisecond))
+	fmt.Printf("  Waiting for filesystem limits: %v\n", p.MountWait.Round(time.Millisecond))
+	fmt.Printf("Output and reports: %s\n", share(p.Sinks, elapsed))
+}
+
+// printRoots lists the totals of each root of a multi-root scan, in the
+// order they were given.
+func printRoots(roots []string, perRoot map[string]*scanner.ScanResult) {
+	if len(perRoot) == 0 {
+		return
+	}
+	fmt.Printf("\n=== PER ROOT ===\n")
+	fmt.Printf("%-40s %10s %8s %10s %8s\n", "Root", "Files", "Dirs", "Size", "Errors")
+	for _, root := range roots {
+		r, ok := perRoot[root]
+		if !ok {
+			fmt.Printf("%-40s %10s\n", root, "(counted in an enclosing root)")
+			continue
+		}
+		fmt.Printf("%-40s %10d %8d %10s %8d\n", root, r.TotalFiles, r.TotalDirs, scanner.FormatBytes(r.TotalBytes), r.TotalErrors)
+	}
+}
+
+// printSnapshots lists the filesystem snapshots found during the scan.
+func printSnapshots(snapshots []scanner.SnapshotStats, mode scanner.SnapshotMode) {
+	if len(snapshots) == 0 {
+		return
+	}
+	switch mode {
+	case scanner.SnapshotsInclude:
+		fmt.Printf("Snapshots: %d found and counted in the totals (use -snapshots skip or separate to leave them out)\n", len(snapshots))
+	case scanner.SnapshotsSkip:
+		fmt.Printf("Snapshots: %d skipped\n", len(snapshots))
+	case scanner.SnapshotsSeparate:
+		var files, bytes int64
+		for _, st := range snapshots {
+			files += st.Files
+			bytes += st.Bytes
+		}
+		fmt.Printf("Snapshots: %d, %d files, %s (not in the totals)\n", len(snapshots), files, scanner.FormatBytes(bytes))
+		for _, st := range snapshots {
+			fmt.Printf("  %s (%s): %d files, %s\n", st.Path, st.Kind, st.Files, scanner.FormatBytes(st.Bytes))
+		}
+	}
+}
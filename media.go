@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"file-counter/pkg/media"
+	"file-counter/pkg/scanner"
+)
+
+// megapixelBuckets are the upper bounds of the megapixel ranges images
+// are counted in; the last range is open.
+var megapixelBuckets = []float64{1, 4, 12, 24, 50}
+
+// videoClasses name video resolutions by their shorter side, so that
+// portrait videos are classed like landscape ones.
+var videoClasses = []struct {
+	name string
+	min  int
+}{
+	{"4K", 2160},
+	{"1080p", 1080},
+	{"720p", 720},
+	{"SD", 1},
+}
+
+// mediaTally counts files and the bytes and playing time they add up to.
+type mediaTally struct {
+	files    int64
+	bytes    int64
+	duration time.Duration
+}
+
+// mediaSink collects the dimensions of images and the durations and codecs
+// of videos that the media probe read in the scanning workers.
+type mediaSink struct {
+	images, videos mediaTally
+	formats        map[string]int64
+	megapixels     []int64
+	codecs         map[string]*mediaTally
+	resolutions    map[string]int64
+}
+
+// inspectMedia has the scanning workers probe every file for media
+// metadata, for the -media, -exif and -audio reports.
+func inspectMedia(opts *scanner.Options) {
+	addInspector(opts, func(ctx context.Context, path string, info os.FileInfo) (any, error) {
+		m, err := media.Probe(path)
+		if m == nil {
+			return nil, err
+		}
+		return m, err
+	})
+}
+
+// newMediaSink adds the media report to opts; it needs inspectMedia.
+func newMediaSink(opts *scanner.Options) *mediaSink {
+	s := &mediaSink{
+		formats:     map[string]int64{},
+		megapixels:  make([]int64, len(megapixelBuckets)+1),
+		codecs:      map[string]*mediaTally{},
+		resolutions: map[string]int64{},
+	}
+	opts.Sinks = append(opts.Sinks, s)
+	return s
+}
+
+func (s *mediaSink) Write(rec *scanner.FileRecord) error {
+	m, ok := inspection[*media.Info](rec)
+	if !ok {
+		return nil
+	}
+	switch m.Kind {
+	case "image":
+		s.images.files++
+		s.images.bytes += rec.Size
+		s.formats[m.Format]++
+		i := sort.SearchFloat64s(megapixelBuckets, m.Megapixels())
+		if i < len(megapixelBuckets) && megapixelBuckets[i] == m.Megapixels() {
+			i++
+		}
+		s.megapixels[i]++
+	case "video":
+		s.videos.files++
+		s.videos.bytes += rec.Size
+		s.videos.duration += m.Duration
+		c := s.codecs[m.Codec]
+		if c == nil {
+			c = &mediaTally{}
+			s.codecs[m.Codec] = c
+		}
+		c.files++
+		c.bytes += rec.Size
+		c.duration += m.Duration
+		class := "unknown"
+		for _, vc := range videoClasses {
+			if min(m.Width, m.Height) >= vc.min {
+				class = vc.name
+				break
+			}
+		}
+		s.resolutions[class]++
+	}
+	return nil
+}
+
+// report prints the image formats and megapixel distribution, and the
+// video playing time per codec and resolution.
+func (s *mediaSink) report() {
+	fmt.Printf("\n=== MEDIA ===\n")
+	fmt.Printf("Images: %d (%s)\n", s.images.files, scanner.FormatBytes(s.images.bytes))
+	if s.images.files > 0 {
+		fmt.Printf("  Formats: %s\n", countList(s.formats))
+		lo := 0.0
+		for i, n := range s.megapixels {
+			if i < len(megapixelBuckets) {
+				fmt.Printf("  %g-%g MP: %d\n", lo, megapixelBuckets[i], n)
+				lo = megapixelBuckets[i]
+			} else {
+				fmt.Printf("  %g+ MP: %d\n", lo, n)
+			}
+		}
+	}
+	fmt.Printf("Videos: %d (%s), %s\n", s.videos.files, scanner.FormatBytes(s.videos.bytes), hours(s.videos.duration))
+	if s.videos.files > 0 {
+		codecs := make([]string, 0, len(s.codecs))
+		for c := range s.codecs {
+			codecs = append(codecs, c)
+		}
+		sort.Slice(codecs, func(i, j int) bool {
+			a, b := s.codecs[codecs[i]], s.codecs[codecs[j]]
+			if a.duration != b.duration {
+				return a.duration > b.duration
+			}
+			return codecs[i] < codecs[j]
+		})
+		for _, c := range codecs {
+			t := s.codecs[c]
+			fmt.Printf("  %s: %d files, %s, %s\n", c, t.files, scanner.FormatBytes(t.bytes), hours(t.duration))
+		}
+		fmt.Printf("  Resolutions: %s\n", countList(s.resolutions))
+	}
+}
+
+// countList formats counts by name, largest first.
+func countList(counts map[string]int64) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s %d", name, counts[name])
+	}
+	return strings.Join(parts, ", ")
+}
+
+func hours(d time.Duration) string {
+	return fmt.Sprintf("%.1f hours", d.Hours())
+}
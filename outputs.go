@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"file-counter/pkg/output"
+	"file-counter/pkg/query"
+	"file-counter/pkg/scanner"
+)
+
+// stringList collects the values of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// openOutputs opens every --output spec and registers it as a scanner sink.
+// fields, when set, limits the outputs that support it to those fields, and
+// sel, when set, to the records it matches.
+func openOutputs(specs []string, shardSize int64, fields []string, sel *query.Filter, root string, opts *scanner.Options) ([]output.Output, error) {
+	var outputs []output.Output
+	var progressWriters []output.ProgressWriter
+	for _, value := range specs {
+		spec, err := output.ParseSpec(value)
+		if err != nil {
+			closeOutputs(outputs, nil)
+			return nil, err
+		}
+		spec.ShardSize = shardSize
+		if spec.HasFields() {
+			spec.Fields = fields
+		}
+		out, err := output.Open(spec, root)
+		if err != nil {
+			closeOutputs(outputs, nil)
+			return nil, fmt.Errorf("opening %s output: %w", spec.Format, err)
+		}
+
+		outputs = append(outputs, out)
+		if spec.HasFields() {
+			opts.Sinks = append(opts.Sinks, selected(out, sel))
+		} else {
+			opts.Sinks = append(opts.Sinks, out)
+		}
+		if spec.NeedsHash() {
+			opts.Hash = true
+		}
+		if pw, ok := out.(output.ProgressWriter); ok {
+			progressWriters = append(progressWriters, pw)
+		}
+	}
+	if len(progressWriters) > 0 {
+		// Publish failures are sticky on the connection and surface through
+		// Write or Close, so they can be ignored here.
+		opts.OnProgress = func(stats scanner.Stats) {
+			for _, pw := range progressWriters {
+				pw.WriteProgress(stats)
+			}
+		}
+	}
+	return outputs, nil
+}
+
+// listsRecords reports whether any of the --output specs is a listing that
+// -fields and -select apply to.
+func listsRecords(specs []string) bool {
+	for _, value := range specs {
+		if spec, err := output.ParseSpec(value); err == nil && spec.HasFields() {
+			return true
+		}
+	}
+	return false
+}
+
+// closeOutputs closes every output, first handing the scan totals to those
+// that record them. result is nil when the scan did not produce one.
+func closeOutputs(outputs []output.Output, result *scanner.ScanResult) error {
+	var first error
+	for _, out := range outputs {
+		if sw, ok := out.(output.SummaryWriter); ok && result != nil {
+			if err := sw.WriteSummary(result); err != nil && first == nil {
+				first = err
+			}
+		}
+		if err := out.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// openList opens a -files-from path list; "-" reads standard input. The file
+// is left open for the rest of the run.
+func openList(name string) (*bufio.Reader, error) {
+	if name == "-" {
+		return bufio.NewReader(os.Stdin), nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(f), nil
+}
+
+// selectOutput passes on only the records a -select condition matches.
+type selectOutput struct {
+	output.Output
+	sel *query.Filter
+}
+
+func (o *selectOutput) Write(rec *scanner.FileRecord) error {
+	ok, err := o.sel.Match(query.RecordRow(rec))
+	if err != nil || !ok {
+		return err
+	}
+	return o.Output.Write(rec)
+}
+
+// selected applies sel to out, if it is set.
+func selected(out output.Output, sel *query.Filter) scanner.Sink {
+	if sel == nil {
+		return out
+	}
+	return &selectOutput{Output: out, sel: sel}
+}
+
+// print0Sink writes the path of every non-directory entry to w, each
+// terminated by a NUL byte, for `xargs -0` and similar consumers.
+type print0Sink struct {
+	w *bufio.Writer
+}
+
+func newPrint0Sink(f *os.File) *print0Sink {
+	return &print0Sink{w: bufio.NewWriterSize(f, 64*1024)}
+}
+
+func (p *print0Sink) Write(rec *scanner.FileRecord) error {
+	if rec.IsDir {
+		return nil
+	}
+	p.w.WriteString(rec.Path)
+	return p.w.WriteByte(0)
+}
+
+func (p *print0Sink) Close() error {
+	return p.w.Flush()
+}
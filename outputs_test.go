@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"file-counter/pkg/scanner"
+)
+
+// TestMain lets tests run the whole CLI: started again with
+// FILE_COUNTER_MAIN set, the test binary is file-counter itself.
+func TestMain(m *testing.M) {
+	if os.Getenv("FILE_COUNTER_MAIN") != "" {
+		main()
+		os.Exit(exitOK)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs file-counter with args and returns what it wrote to stdout
+// and stderr. Its state directories are kept below a temporary home.
+func runMain(t *testing.T, args ...string) (stdout, stderr []byte, err error) {
+	t.Helper()
+	home := t.TempDir()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "FILE_COUNTER_MAIN=1", "HOME="+home,
+		"XDG_CACHE_HOME="+filepath.Join(home, "cache"),
+		"XDG_CONFIG_HOME="+filepath.Join(home, "config"),
+		"XDG_STATE_HOME="+filepath.Join(home, "state"))
+	var out, errs bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errs
+	err = cmd.Run()
+	return out.Bytes(), errs.Bytes(), err
+}
+
+func TestPrint0Sink(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sink := newPrint0Sink(f)
+	for _, rec := range []*scanner.FileRecord{
+		{Path: "dir", IsDir: true},
+		{Path: "dir/with space"},
+		{Path: "dir/new\nline"},
+		{Path: "link", Mode: os.ModeSymlink},
+	} {
+		if err := sink.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "dir/with space\x00dir/new\nline\x00link\x00"; string(out) != want {
+		t.Errorf("Printed %q, expected %q", out, want)
+	}
+}
+
+func TestPrint0Stdout(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a.txt":          "a",
+		"sub/b with.txt": "bb",
+		"sub/deeper/c":   "ccc",
+	})
+	stdout, stderr, err := runMain(t, "-print0", root)
+	if err != nil {
+		t.Fatalf("%v: %s", err, stderr)
+	}
+	if len(stdout) == 0 || stdout[len(stdout)-1] != 0 {
+		t.Fatalf("Printed %q, expected NUL-terminated paths", stdout)
+	}
+	// Only the files, each ending in a NUL: no directories, no report.
+	got := strings.Split(string(stdout[:len(stdout)-1]), "\x00")
+	sort.Strings(got)
+	want := []string{
+		filepath.Join(root, "a.txt"),
+		filepath.Join(root, "sub", "b with.txt"),
+		filepath.Join(root, "sub", "deeper", "c"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Printed %q, expected %q", got, want)
+	}
+	if !bytes.Contains(stderr, []byte("Scanning: "+root)) {
+		t.Errorf("Expected the report on stderr, got %q", stderr)
+	}
+}
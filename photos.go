@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"file-counter/pkg/media"
+	"file-counter/pkg/scanner"
+)
+
+// photoCameras caps how many camera models the report lists.
+const photoCameras = 20
+
+// sizeTally counts files and their bytes.
+type sizeTally struct {
+	files int64
+	bytes int64
+}
+
+// photoSink breaks images down by the year and camera in their EXIF data,
+// as read by the media probe.
+type photoSink struct {
+	total   sizeTally
+	years   map[string]*sizeTally
+	cameras map[string]*sizeTally
+}
+
+// newPhotoSink adds the EXIF report to opts; it needs inspectMedia.
+func newPhotoSink(opts *scanner.Options) *photoSink {
+	s := &photoSink{years: map[string]*sizeTally{}, cameras: map[string]*sizeTally{}}
+	opts.Sinks = append(opts.Sinks, s)
+	return s
+}
+
+func (s *photoSink) Write(rec *scanner.FileRecord) error {
+	m, ok := inspection[*media.Info](rec)
+	if !ok || m.Kind != "image" {
+		return nil
+	}
+	year, camera := "no date", m.Camera
+	if !m.Taken.IsZero() {
+		year = strconv.Itoa(m.Taken.Year())
+	}
+	if camera == "" {
+		camera = "unknown camera"
+	}
+	s.total.add(rec.Size)
+	addSize(s.years, year, rec.Size)
+	addSize(s.cameras, camera, rec.Size)
+	return nil
+}
+
+func (t *sizeTally) add(size int64) {
+	t.files++
+	t.bytes += size
+}
+
+func addSize(m map[string]*sizeTally, key string, size int64) {
+	t := m[key]
+	if t == nil {
+		t = &sizeTally{}
+		m[key] = t
+	}
+	t.add(size)
+}
+
+// report lists photos per year, oldest first, and per camera, most used
+// first.
+func (s *photoSink) report() {
+	fmt.Printf("\n=== PHOTOS BY EXIF DATE AND CAMERA ===\n")
+	fmt.Printf("Images: %d (%s)\n", s.total.files, scanner.FormatBytes(s.total.bytes))
+	if s.total.files == 0 {
+		return
+	}
+	years := make([]string, 0, len(s.years))
+	for y := range s.years {
+		years = append(years, y)
+	}
+	// "no date" sorts after the years.
+	sort.Strings(years)
+	fmt.Println("By Year:")
+	for _, y := range years {
+		fmt.Printf("  %s: %d files, %s\n", y, s.years[y].files, scanner.FormatBytes(s.years[y].bytes))
+	}
+
+	cameras := make([]string, 0, len(s.cameras))
+	for c := range s.cameras {
+		cameras = append(cameras, c)
+	}
+	sort.Slice(cameras, func(i, j int) bool {
+		a, b := s.cameras[cameras[i]], s.cameras[cameras[j]]
+		if a.files != b.files {
+			return a.files > b.files
+		}
+		return cameras[i] < cameras[j]
+	})
+	fmt.Println("By Camera:")
+	for i, c := range cameras {
+		if i == photoCameras {
+			fmt.Printf("  ... and %d more cameras\n", len(cameras)-i)
+			break
+		}
+		fmt.Printf("  %s: %d files, %s\n", c, s.cameras[c].files, scanner.FormatBytes(s.cameras[c].bytes))
+	}
+}
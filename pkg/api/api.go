@@ -0,0 +1,384 @@
+// Package api serves stored scan data over HTTP as JSON, so dashboards can
+// browse indexes and baseline snapshots without reading the files
+// themselves.
+//
+//	GET /api/scans                     list the stored scans
+//	GET /api/scans/{id}                totals of one scan
+//	GET /api/scans/{id}/rollup?path=   per-directory totals below path
+//	GET /api/diff?from={id}&to={id}    what changed between two scans
+//	GET /api/progress                  running and recently finished scans
+//	GET /api/progress/{id}             counters and rate history of one
+//	GET /api/progress/{id}/events      the same as server-sent events,
+//	                                   starting with the current state
+//	GET /metrics                       Prometheus gauges, among them the
+//	                                   time of the last successful scan
+//
+// Server.Probes adds the /healthz and /readyz probes.
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"file-counter/pkg/index"
+	"file-counter/pkg/progress"
+	"file-counter/pkg/snapshot"
+)
+
+// DefaultDiffLimit caps each change list of a diff unless ?limit= is given.
+const DefaultDiffLimit = 1000
+
+// Scan describes one stored scan. ID is its file name without the
+// extension.
+type Scan struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"` // "index" or "snapshot"
+	Root      string    `json:"root"`
+	CreatedAt time.Time `json:"created_at"`
+	Files     int64     `json:"files"`
+	Dirs      int64     `json:"dirs"`
+	Bytes     int64     `json:"bytes"`
+}
+
+// Change is one file in a diff.
+type Change struct {
+	Path    string   `json:"path"`
+	OldSize *int64   `json:"old_size,omitempty"`
+	NewSize *int64   `json:"new_size,omitempty"`
+	Fields  []string `json:"fields,omitempty"`
+}
+
+// Diff is the response of /api/diff. The change lists are cut to the
+// limit; the counts are not.
+type Diff struct {
+	From          string   `json:"from"`
+	To            string   `json:"to"`
+	Unchanged     int      `json:"unchanged"`
+	AddedCount    int      `json:"added_count"`
+	RemovedCount  int      `json:"removed_count"`
+	ModifiedCount int      `json:"modified_count"`
+	BytesDelta    int64    `json:"bytes_delta"`
+	Added         []Change `json:"added"`
+	Removed       []Change `json:"removed"`
+	Modified      []Change `json:"modified"`
+	Truncated     bool     `json:"truncated"`
+}
+
+// Server answers the API requests. Scans are loaded on first use and kept
+// until their file changes.
+type Server struct {
+	snapshots []string
+	poll      time.Duration // how often events check for progress
+
+	mu    sync.Mutex
+	cache map[string]*loaded
+}
+
+type loaded struct {
+	modTime time.Time
+	scan    Scan
+	ix      *index.Index
+	snap    *snapshot.Snapshot
+}
+
+// New returns a server for the indexes in index.Dir and the given baseline
+// snapshot files.
+func New(snapshots []string) *Server {
+	return &Server{snapshots: snapshots, poll: time.Second, cache: make(map[string]*loaded)}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("only GET is supported"))
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 2 && parts[0] == "api" && parts[1] == "scans":
+		s.list(w)
+	case len(parts) == 3 && parts[0] == "api" && parts[1] == "scans":
+		s.scan(w, parts[2])
+	case len(parts) == 4 && parts[0] == "api" && parts[1] == "scans" && parts[3] == "rollup":
+		s.rollup(w, parts[2], r.URL.Query().Get("path"))
+	case len(parts) == 2 && parts[0] == "api" && parts[1] == "diff":
+		s.diff(w, r)
+	case len(parts) == 2 && parts[0] == "api" && parts[1] == "progress":
+		s.progressList(w)
+	case len(parts) == 3 && parts[0] == "api" && parts[1] == "progress":
+		s.progress(w, parts[2])
+	case len(parts) == 4 && parts[0] == "api" && parts[1] == "progress" && parts[3] == "events":
+		s.progressEvents(w, r, parts[2])
+	case len(parts) == 1 && parts[0] == "metrics":
+		s.metrics(w)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no such endpoint %s", r.URL.Path))
+	}
+}
+
+func (s *Server) list(w http.ResponseWriter) {
+	files, err := s.files()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	scans := []Scan{}
+	for _, name := range files {
+		l, err := s.load(name)
+		if err != nil {
+			continue // being rewritten, or not ours
+		}
+		scans = append(scans, l.scan)
+	}
+	sort.Slice(scans, func(i, j int) bool { return scans[i].CreatedAt.After(scans[j].CreatedAt) })
+	writeJSON(w, scans)
+}
+
+func (s *Server) scan(w http.ResponseWriter, id string) {
+	l, status, err := s.lookup(id)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	writeJSON(w, l.scan)
+}
+
+func (s *Server) rollup(w http.ResponseWriter, id, dir string) {
+	l, status, err := s.lookup(id)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	if dir == "" {
+		dir = "."
+	}
+	r, err := l.ix.Rollup(dir)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, r)
+}
+
+func (s *Server) diff(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := DefaultDiffLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", v))
+			return
+		}
+		limit = n
+	}
+	if q.Get("from") == "" || q.Get("to") == "" {
+		writeError(w, http.StatusBadRequest, errors.New("from and to are required"))
+		return
+	}
+	from, status, err := s.lookup(q.Get("from"))
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	to, status, err := s.lookup(q.Get("to"))
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+
+	d := snapshot.Compare(from.files(), to.files())
+	out := &Diff{
+		From: from.scan.ID, To: to.scan.ID,
+		Unchanged:  d.Unchanged,
+		AddedCount: len(d.Added), RemovedCount: len(d.Removed), ModifiedCount: len(d.Modified),
+		BytesDelta: to.scan.Bytes - from.scan.Bytes,
+	}
+	out.Added, out.Truncated = changes(d.Added, limit, out.Truncated)
+	out.Removed, out.Truncated = changes(d.Removed, limit, out.Truncated)
+	out.Modified, out.Truncated = changes(d.Modified, limit, out.Truncated)
+	writeJSON(w, out)
+}
+
+func (s *Server) progressList(w http.ResponseWriter) {
+	states, err := progress.All()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, states)
+}
+
+func (s *Server) progress(w http.ResponseWriter, id string) {
+	st, err := progress.Load(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no scan progress %q", id))
+		return
+	}
+	writeJSON(w, st)
+}
+
+// progressEvents streams a scan's progress. The first event carries the
+// whole state with its history, so a client that reconnects can redraw at
+// once; later ones carry only the newest sample. The stream ends after the
+// scan does.
+func (s *Server) progressEvents(w http.ResponseWriter, r *http.Request, id string) {
+	st, err := progress.Load(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no scan progress %q", id))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	ticker := time.NewTicker(s.poll)
+	defer ticker.Stop()
+	last := time.Time{}
+	for {
+		if !st.UpdatedAt.Equal(last) {
+			if !last.IsZero() && len(st.History) > 0 {
+				st.History = st.History[len(st.History)-1:]
+			}
+			data, _ := json.Marshal(st)
+			fmt.Fprintf(w, "event: progress\ndata: %s\n\n", data)
+			flusher.Flush()
+			last = st.UpdatedAt
+		}
+		if st.Status != progress.Running {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+		if next, err := progress.Load(id); err == nil {
+			st = next
+		}
+	}
+}
+
+// changes converts at most limit changes, setting truncated if some were
+// dropped.
+func changes(list []snapshot.Change, limit int, truncated bool) ([]Change, bool) {
+	if len(list) > limit {
+		list, truncated = list[:limit], true
+	}
+	out := []Change{}
+	for _, c := range list {
+		ch := Change{Path: c.Path, Fields: c.Fields}
+		if c.Old != nil {
+			ch.OldSize = &c.Old.Size
+		}
+		if c.New != nil {
+			ch.NewSize = &c.New.Size
+		}
+		out = append(out, ch)
+	}
+	return out, truncated
+}
+
+// files returns the scan as a snapshot for comparing. Snapshots are used
+// as they are, so recorded hashes are compared too.
+func (l *loaded) files() *snapshot.Snapshot {
+	if l.snap != nil {
+		return l.snap
+	}
+	return l.ix.Snapshot()
+}
+
+// files lists every index and snapshot file the server knows.
+func (s *Server) files() ([]string, error) {
+	indexes, err := index.All()
+	if err != nil {
+		return nil, err
+	}
+	return append(indexes, s.snapshots...), nil
+}
+
+// lookup finds the scan with the given id, returning the HTTP status to
+// answer with if it can't.
+func (s *Server) lookup(id string) (*loaded, int, error) {
+	files, err := s.files()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	for _, name := range files {
+		if scanID(name) == id {
+			l, err := s.load(name)
+			if err != nil {
+				return nil, http.StatusInternalServerError, err
+			}
+			return l, http.StatusOK, nil
+		}
+	}
+	return nil, http.StatusNotFound, fmt.Errorf("no scan %q", id)
+}
+
+func scanID(name string) string {
+	base := filepath.Base(name)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// load reads name, or returns the cached copy if the file hasn't changed.
+func (s *Server) load(name string) (*loaded, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	l := s.cache[name]
+	s.mu.Unlock()
+	if l != nil && l.modTime.Equal(info.ModTime()) {
+		return l, nil
+	}
+
+	l = &loaded{modTime: info.ModTime(), scan: Scan{ID: scanID(name)}}
+	if filepath.Ext(name) == ".idx" {
+		l.scan.Kind = "index"
+		l.ix, err = index.Load(name)
+	} else {
+		l.scan.Kind = "snapshot"
+		if l.snap, err = snapshot.Load(name); err == nil {
+			l.ix = index.FromSnapshot(l.snap)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.scan.Root, l.scan.CreatedAt = l.ix.Root, l.ix.BuiltAt
+	l.scan.Files, l.scan.Dirs, l.scan.Bytes = l.ix.Files, l.ix.Dirs, l.ix.Bytes
+	if l.snap != nil {
+		l.scan.Dirs = l.snap.TotalDirs
+	}
+
+	s.mu.Lock()
+	s.cache[name] = l
+	s.mu.Unlock()
+	return l, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
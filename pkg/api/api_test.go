@@ -0,0 +1,248 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"file-counter/pkg/index"
+	"file-counter/pkg/progress"
+	"file-counter/pkg/scanner"
+	"file-counter/pkg/snapshot"
+)
+
+func writeFile(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func get(t *testing.T, h http.Handler, url string, status int, v any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+	if rec.Code != status {
+		t.Fatalf("GET %s: got status %d, expected %d: %s", url, rec.Code, status, rec.Body)
+	}
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "x"), 10)
+	writeFile(t, filepath.Join(root, "b"), 5)
+
+	base, err := snapshot.Build(root, snapshot.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapPath := filepath.Join(t.TempDir(), "before.json")
+	if err := base.Save(snapPath); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, filepath.Join(root, "a", "y"), 100)
+	os.Remove(filepath.Join(root, "b"))
+	ix, err := index.Build(root, index.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ixPath, err := index.DefaultPath(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Save(ixPath); err != nil {
+		t.Fatal(err)
+	}
+	ixID := scanID(ixPath)
+
+	s := New([]string{snapPath})
+	var scans []Scan
+	get(t, s, "/api/scans", http.StatusOK, &scans)
+	if len(scans) != 2 {
+		t.Fatalf("Got %d scans, expected 2", len(scans))
+	}
+
+	var scan Scan
+	get(t, s, "/api/scans/before", http.StatusOK, &scan)
+	if scan.Kind != "snapshot" || scan.Files != 2 || scan.Bytes != 15 {
+		t.Errorf("Got snapshot %+v", scan)
+	}
+	get(t, s, "/api/scans/missing", http.StatusNotFound, nil)
+
+	var r index.Rollup
+	get(t, s, "/api/scans/"+ixID+"/rollup?path=a", http.StatusOK, &r)
+	if r.Files != 2 || r.Bytes != 110 {
+		t.Errorf("Got rollup %+v", r)
+	}
+	get(t, s, "/api/scans/"+ixID+"/rollup?path=nope", http.StatusNotFound, nil)
+
+	var d Diff
+	get(t, s, "/api/diff?from=before&to="+ixID, http.StatusOK, &d)
+	if d.AddedCount != 1 || d.RemovedCount != 1 || d.Unchanged != 1 || d.BytesDelta != 95 {
+		t.Errorf("Got diff %+v", d)
+	}
+	if len(d.Added) != 1 || d.Added[0].Path != "a/y" || *d.Added[0].NewSize != 100 {
+		t.Errorf("Got added %+v", d.Added)
+	}
+	get(t, s, "/api/diff?from=before&to="+ixID+"&limit=0", http.StatusOK, &d)
+	if len(d.Added) != 0 || !d.Truncated {
+		t.Errorf("Got limited diff %+v", d)
+	}
+	get(t, s, "/api/diff?from=before", http.StatusBadRequest, nil)
+}
+
+func TestProgressEvents(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	root := t.TempDir()
+	rec, err := progress.NewRecorder(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 3; i++ {
+		rec.Update(scanner.Stats{Files: i})
+	}
+
+	s := New(nil)
+	s.poll = time.Millisecond
+	var states []*progress.State
+	get(t, s, "/api/progress", http.StatusOK, &states)
+	if len(states) != 1 || states[0].Status != progress.Running {
+		t.Fatalf("Got progress %+v", states)
+	}
+
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/api/progress/" + progress.ID(root) + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	events := bufio.NewScanner(resp.Body)
+	next := func() *progress.State {
+		t.Helper()
+		for events.Scan() {
+			if data, ok := strings.CutPrefix(events.Text(), "data: "); ok {
+				var st progress.State
+				if err := json.Unmarshal([]byte(data), &st); err != nil {
+					t.Fatal(err)
+				}
+				return &st
+			}
+		}
+		t.Fatalf("Stream ended: %v", events.Err())
+		return nil
+	}
+
+	// A client connecting mid-scan gets the history so far.
+	if st := next(); len(st.History) != 3 || st.Files != 3 {
+		t.Errorf("Got first event %+v", st)
+	}
+	rec.Finish(&scanner.ScanResult{TotalFiles: 4, Completed: true})
+	if st := next(); len(st.History) != 1 || st.Files != 4 || st.Status != progress.Completed {
+		t.Errorf("Got final event %+v", st)
+	}
+	for events.Scan() {
+		if events.Text() != "" {
+			t.Errorf("Expected the stream to end, got %q", events.Text())
+		}
+	}
+}
+
+func TestAuth(t *testing.T) {
+	dir := t.TempDir()
+	tokens := filepath.Join(dir, "tokens")
+	users := filepath.Join(dir, "users")
+	os.WriteFile(tokens, []byte("# dashboards\ns3cret\n"), 0600)
+	// sha256("hunter2")
+	os.WriteFile(users, []byte("alice:wonderland\nbob:sha256:f52fbd32b2b3b86ff88ef6c490628285f482af15ddcb29541f94bcf526a3f6c7\n"), 0600)
+	auth, err := LoadAuth(tokens, users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tc := range []struct {
+		name   string
+		set    func(r *http.Request)
+		status int
+	}{
+		{"none", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, http.StatusOK},
+		{"wrong token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cre") }, http.StatusUnauthorized},
+		{"plain password", func(r *http.Request) { r.SetBasicAuth("alice", "wonderland") }, http.StatusOK},
+		{"hashed password", func(r *http.Request) { r.SetBasicAuth("bob", "hunter2") }, http.StatusOK},
+		{"wrong password", func(r *http.Request) { r.SetBasicAuth("bob", "wonderland") }, http.StatusUnauthorized},
+		{"unknown user", func(r *http.Request) { r.SetBasicAuth("carol", "wonderland") }, http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest("GET", "/api/scans", nil)
+		tc.set(r)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != tc.status {
+			t.Errorf("%s: got status %d, expected %d", tc.name, rec.Code, tc.status)
+		}
+	}
+
+	if _, err := LoadAuth("", filepath.Join(dir, "tokens")); err == nil {
+		t.Error("Expected a users file without passwords to be rejected")
+	}
+}
+
+func TestProbes(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a"), 10)
+	snap, err := snapshot.Build(root, snapshot.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapPath := filepath.Join(t.TempDir(), "nightly.json")
+	if err := snap.Save(snapPath); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New([]string{snapPath})
+	auth := &Auth{Tokens: []string{"s3cret"}}
+	h := s.Probes(auth.Wrap(s))
+
+	var health Health
+	get(t, h, "/healthz", http.StatusOK, &health)
+	get(t, h, "/readyz", http.StatusOK, &health)
+	if health.Status != "ready" || health.Scans != 1 || health.LastScan == nil || !health.LastScan.Equal(snap.CreatedAt) {
+		t.Errorf("Got %+v, expected the snapshot's time", health)
+	}
+	get(t, h, "/metrics", http.StatusUnauthorized, nil)
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	want := fmt.Sprintf("file_counter_last_successful_scan_timestamp_seconds %g\n", float64(snap.CreatedAt.UnixNano())/1e9)
+	if body := rec.Body.String(); !strings.Contains(body, "file_counter_ready 1\n") || !strings.Contains(body, want) {
+		t.Errorf("Got metrics:\n%s", body)
+	}
+
+	os.WriteFile(snapPath, []byte("{"), 0644)
+	get(t, h, "/readyz", http.StatusServiceUnavailable, &health)
+	if health.Status != "unavailable" || health.Error == "" {
+		t.Errorf("Got %+v for an unreadable snapshot", health)
+	}
+}
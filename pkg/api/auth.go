@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Auth holds the credentials accepted by the API: bearer tokens, and
+// users for basic auth whose passwords are stored in the clear or as
+// "sha256:" followed by the hex digest.
+type Auth struct {
+	Tokens []string
+	Users  map[string]string
+}
+
+// LoadAuth reads a token file, holding one token per line, and a users
+// file of user:password lines. Either name may be empty; blank lines and
+// lines starting with # are ignored.
+func LoadAuth(tokenFile, usersFile string) (*Auth, error) {
+	a := &Auth{Users: map[string]string{}}
+	if tokenFile != "" {
+		err := readLines(tokenFile, func(line string) error {
+			a.Tokens = append(a.Tokens, line)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if usersFile != "" {
+		err := readLines(usersFile, func(line string) error {
+			user, pass, ok := strings.Cut(line, ":")
+			if !ok || user == "" || pass == "" {
+				return fmt.Errorf("invalid line %q, expected user:password", user)
+			}
+			a.Users[user] = pass
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+func readLines(name string, fn func(string) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return sc.Err()
+}
+
+// Enabled reports whether any credentials are configured.
+func (a *Auth) Enabled() bool {
+	return a != nil && (len(a.Tokens) > 0 || len(a.Users) > 0)
+}
+
+// Wrap returns h behind the credential check. Without credentials every
+// request is let through.
+func (a *Auth) Wrap(h http.Handler) http.Handler {
+	if !a.Enabled() {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.allowed(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="file-counter", Basic realm="file-counter"`)
+			writeError(w, http.StatusUnauthorized, errors.New("authentication required"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (a *Auth) allowed(r *http.Request) bool {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		match := 0
+		for _, t := range a.Tokens {
+			match |= subtle.ConstantTimeCompare([]byte(token), []byte(t))
+		}
+		return match == 1
+	}
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	want, known := a.Users[user]
+	if digest, hashed := strings.CutPrefix(want, "sha256:"); hashed {
+		sum := sha256.Sum256([]byte(pass))
+		pass, want = hex.EncodeToString(sum[:]), strings.ToLower(digest)
+	}
+	return subtle.ConstantTimeCompare([]byte(pass), []byte(want)) == 1 && known
+}
+
+// TLSConfig returns the server TLS settings. With clientCA, clients must
+// present a certificate signed by one of the CAs in that PEM file.
+func TLSConfig(clientCA string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCA != "" {
+		pem, err := os.ReadFile(clientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", clientCA)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
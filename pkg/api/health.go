@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"file-counter/pkg/progress"
+)
+
+// Health is the response of /readyz.
+type Health struct {
+	Status   string     `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	Scans    int        `json:"scans"`
+	LastScan *time.Time `json:"last_scan,omitempty"`
+}
+
+// Probes answers the supervisor probes ahead of next, which usually
+// checks credentials: Kubernetes and load balancers probe without them,
+// and the probes reveal no scan data.
+//
+//	GET /healthz   200 as long as the process answers requests
+//	GET /readyz    200 when the stored scans can be listed and read,
+//	               503 otherwise
+func (s *Server) Probes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimSuffix(r.URL.Path, "/") {
+		case "/healthz":
+			writeJSON(w, Health{Status: "ok"})
+		case "/readyz":
+			h, err := s.health()
+			if err != nil {
+				h.Status, h.Error = "unavailable", err.Error()
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				writeJSON(w, h)
+				return
+			}
+			writeJSON(w, h)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// health loads every stored scan, as the API would to answer for it, and
+// finds when the last successful scan finished: the newest stored scan, or
+// the newest scan progress recorded as completed.
+func (s *Server) health() (Health, error) {
+	h := Health{Status: "ready"}
+	files, err := s.files()
+	if err != nil {
+		return h, err
+	}
+	var last time.Time
+	for _, name := range files {
+		l, err := s.load(name)
+		if err != nil {
+			return h, fmt.Errorf("%s: %w", scanID(name), err)
+		}
+		h.Scans++
+		if l.scan.CreatedAt.After(last) {
+			last = l.scan.CreatedAt
+		}
+	}
+	states, _ := progress.All()
+	for _, st := range states {
+		if st.Status == progress.Completed && st.UpdatedAt.After(last) {
+			last = st.UpdatedAt
+		}
+	}
+	if !last.IsZero() {
+		h.LastScan = &last
+	}
+	return h, nil
+}
+
+// metrics writes the Prometheus text format.
+func (s *Server) metrics(w http.ResponseWriter) {
+	h, err := s.health()
+	ready := 1
+	if err != nil {
+		ready = 0
+	}
+	running := 0
+	states, _ := progress.All()
+	for _, st := range states {
+		if st.Status == progress.Running {
+			running++
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	gauge := func(name, help string, value float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, help, name, name, value)
+	}
+	gauge("file_counter_ready", "Whether every stored scan can be read.", float64(ready))
+	gauge("file_counter_scans", "Stored indexes and snapshots served.", float64(h.Scans))
+	gauge("file_counter_running_scans", "Scans running on this machine.", float64(running))
+	if h.LastScan != nil {
+		gauge("file_counter_last_successful_scan_timestamp_seconds", "Unix time the last completed scan finished.",
+			float64(h.LastScan.UnixNano())/1e9)
+	}
+}
@@ -0,0 +1,165 @@
+package arrow
+
+import "encoding/binary"
+
+// builder is a minimal back-to-front FlatBuffers builder, enough to encode
+// the Arrow IPC Schema, Message and Footer tables. Offsets are measured from
+// the end of the buffer, as in the reference implementation.
+type builder struct {
+	buf       []byte
+	minAlign  int
+	vtable    []int
+	tableSize int
+}
+
+func newBuilder() *builder {
+	return &builder{minAlign: 1}
+}
+
+func (b *builder) offset() int {
+	return len(b.buf)
+}
+
+func (b *builder) prepend(p []byte) {
+	b.buf = append(make([]byte, len(p), len(p)+len(b.buf)), b.buf...)
+	copy(b.buf, p)
+}
+
+// prep pads so that after writing additional bytes the buffer is aligned to size.
+func (b *builder) prep(size, additional int) {
+	if size > b.minAlign {
+		b.minAlign = size
+	}
+	pad := (-(len(b.buf) + additional)) & (size - 1)
+	if pad > 0 {
+		b.prepend(make([]byte, pad))
+	}
+}
+
+func (b *builder) prependUint8(v uint8) {
+	b.prep(1, 0)
+	b.prepend([]byte{v})
+}
+
+func (b *builder) prependUint16(v uint16) {
+	b.prep(2, 0)
+	var tmp [2]byte
+	binary.LittleEndian.PutUint16(tmp[:], v)
+	b.prepend(tmp[:])
+}
+
+func (b *builder) prependUint32(v uint32) {
+	b.prep(4, 0)
+	var tmp [4]byte
+	binary.LittleEndian.PutUint32(tmp[:], v)
+	b.prepend(tmp[:])
+}
+
+func (b *builder) prependUint64(v uint64) {
+	b.prep(8, 0)
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], v)
+	b.prepend(tmp[:])
+}
+
+func (b *builder) prependOffset(off int) {
+	b.prep(4, 0)
+	b.prependUint32(uint32(b.offset() - off + 4))
+}
+
+func (b *builder) createString(s string) int {
+	b.prep(4, len(s)+1)
+	b.prepend(append([]byte(s), 0))
+	b.prependUint32(uint32(len(s)))
+	return b.offset()
+}
+
+func (b *builder) createOffsetVector(offsets []int) int {
+	b.prep(4, 4*len(offsets))
+	for i := len(offsets) - 1; i >= 0; i-- {
+		b.prependOffset(offsets[i])
+	}
+	b.prependUint32(uint32(len(offsets)))
+	return b.offset()
+}
+
+// createStructVector writes a vector of fixed-size structs given as raw
+// little-endian bytes, all of the given size and alignment.
+func (b *builder) createStructVector(elems [][]byte, size, align int) int {
+	b.prep(4, size*len(elems))
+	b.prep(align, size*len(elems))
+	for i := len(elems) - 1; i >= 0; i-- {
+		b.prepend(elems[i])
+	}
+	b.prependUint32(uint32(len(elems)))
+	return b.offset()
+}
+
+func (b *builder) startTable(numFields int) {
+	b.vtable = make([]int, numFields)
+	b.tableSize = b.offset()
+}
+
+func (b *builder) slot(field int) {
+	b.vtable[field] = b.offset()
+}
+
+func (b *builder) addUint8(field int, v uint8) {
+	b.prependUint8(v)
+	b.slot(field)
+}
+
+func (b *builder) addBool(field int, v bool) {
+	var n uint8
+	if v {
+		n = 1
+	}
+	b.addUint8(field, n)
+}
+
+func (b *builder) addInt16(field int, v int16) {
+	b.prependUint16(uint16(v))
+	b.slot(field)
+}
+
+func (b *builder) addInt32(field int, v int32) {
+	b.prependUint32(uint32(v))
+	b.slot(field)
+}
+
+func (b *builder) addInt64(field int, v int64) {
+	b.prependUint64(uint64(v))
+	b.slot(field)
+}
+
+func (b *builder) addOffset(field int, off int) {
+	b.prependOffset(off)
+	b.slot(field)
+}
+
+func (b *builder) endTable() int {
+	b.prependUint32(0) // placeholder for the vtable soffset
+	object := b.offset()
+
+	for i := len(b.vtable) - 1; i >= 0; i-- {
+		var off uint16
+		if b.vtable[i] != 0 {
+			off = uint16(object - b.vtable[i])
+		}
+		b.prependUint16(off)
+	}
+	b.prependUint16(uint16(object - b.tableSize))
+	b.prependUint16(uint16((len(b.vtable) + 2) * 2))
+
+	vt := b.offset()
+	pos := len(b.buf) - object
+	binary.LittleEndian.PutUint32(b.buf[pos:], uint32(int32(vt-object)))
+	b.vtable = nil
+	return object
+}
+
+func (b *builder) finish(root int) []byte {
+	b.prep(b.minAlign, 4)
+	b.prependOffset(root)
+	return b.buf
+}
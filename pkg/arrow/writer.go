@@ -0,0 +1,339 @@
+package arrow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+type ColumnType int
+
+const (
+	String ColumnType = iota
+	Int64
+	Timestamp
+)
+
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Arrow flatbuffer enum values used by the writer.
+const (
+	metadataV5 = 4
+
+	headerSchema      = 1
+	headerRecordBatch = 3
+
+	typeInt       = 2
+	typeUtf8      = 5
+	typeTimestamp = 10
+
+	unitMillisecond = 1
+)
+
+const (
+	fileMagic = "ARROW1"
+	// DefaultBatchSize bounds how many rows are buffered before a record
+	// batch is written out.
+	DefaultBatchSize = 64 * 1024
+)
+
+type block struct {
+	offset     int64
+	metaLength int32
+	bodyLength int64
+}
+
+type column struct {
+	offsets []int32
+	data    bytes.Buffer
+}
+
+// Writer streams rows into an Arrow IPC file (Feather v2). All columns are
+// non-nullable; strings are Utf8 and timestamps are milliseconds in UTC.
+type Writer struct {
+	w         io.Writer
+	columns   []Column
+	buffers   []column
+	rows      int64
+	offset    int64
+	batches   []block
+	BatchSize int64
+	closed    bool
+}
+
+func NewWriter(w io.Writer, columns []Column) (*Writer, error) {
+	if len(columns) == 0 {
+		return nil, errors.New("arrow: no columns")
+	}
+
+	aw := &Writer{w: w, columns: columns, BatchSize: DefaultBatchSize}
+	aw.resetBuffers()
+	if err := aw.write([]byte(fileMagic + "\x00\x00")); err != nil {
+		return nil, err
+	}
+	if _, err := aw.writeMessage(aw.schemaMessage(), nil); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+func (w *Writer) resetBuffers() {
+	w.buffers = make([]column, len(w.columns))
+	for i, col := range w.columns {
+		if col.Type == String {
+			w.buffers[i].offsets = []int32{0}
+		}
+	}
+	w.rows = 0
+}
+
+// WriteRow appends one row. Values must match the column types: string for
+// String, int64 for Int64 and time.Time for Timestamp.
+func (w *Writer) WriteRow(values ...any) error {
+	if len(values) != len(w.columns) {
+		return fmt.Errorf("arrow: got %d values for %d columns", len(values), len(w.columns))
+	}
+	for i, v := range values {
+		var ok bool
+		switch w.columns[i].Type {
+		case String:
+			_, ok = v.(string)
+		case Int64:
+			_, ok = v.(int64)
+		case Timestamp:
+			_, ok = v.(time.Time)
+		}
+		if !ok {
+			return fmt.Errorf("arrow: unexpected %T for column %s", v, w.columns[i].Name)
+		}
+	}
+
+	var tmp [8]byte
+	for i, v := range values {
+		col := &w.buffers[i]
+		switch v := v.(type) {
+		case string:
+			col.data.WriteString(v)
+			col.offsets = append(col.offsets, int32(col.data.Len()))
+		case int64:
+			binary.LittleEndian.PutUint64(tmp[:], uint64(v))
+			col.data.Write(tmp[:])
+		case time.Time:
+			binary.LittleEndian.PutUint64(tmp[:], uint64(v.UnixMilli()))
+			col.data.Write(tmp[:])
+		}
+	}
+
+	w.rows++
+	if w.rows >= w.BatchSize {
+		return w.flushBatch()
+	}
+	return nil
+}
+
+func (w *Writer) flushBatch() error {
+	if w.rows == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	var buffers [][2]int64
+	addBuffer := func(p []byte) {
+		buffers = append(buffers, [2]int64{int64(body.Len()), int64(len(p))})
+		body.Write(p)
+		body.Write(make([]byte, pad8(len(p))))
+	}
+
+	for i, col := range w.columns {
+		buf := &w.buffers[i]
+		addBuffer(nil) // validity bitmap, omitted since nothing is null
+		if col.Type == String {
+			offsets := make([]byte, 4*len(buf.offsets))
+			for j, off := range buf.offsets {
+				binary.LittleEndian.PutUint32(offsets[4*j:], uint32(off))
+			}
+			addBuffer(offsets)
+		}
+		addBuffer(buf.data.Bytes())
+	}
+
+	blk, err := w.writeMessage(w.recordBatchMessage(buffers, int64(body.Len())), body.Bytes())
+	if err != nil {
+		return err
+	}
+	w.batches = append(w.batches, blk)
+	w.resetBuffers()
+	return nil
+}
+
+// Close flushes buffered rows and writes the end-of-stream marker and file
+// footer. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if err := w.flushBatch(); err != nil {
+		return err
+	}
+	if err := w.write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}); err != nil {
+		return err
+	}
+
+	footer := w.footer()
+	var tail [4]byte
+	binary.LittleEndian.PutUint32(tail[:], uint32(len(footer)))
+	if err := w.write(footer); err != nil {
+		return err
+	}
+	if err := w.write(tail[:]); err != nil {
+		return err
+	}
+	return w.write([]byte(fileMagic))
+}
+
+// writeMessage writes an encapsulated IPC message: continuation marker,
+// padded metadata length, flatbuffer metadata and the 8-byte aligned body.
+func (w *Writer) writeMessage(meta, body []byte) (block, error) {
+	padded := len(meta) + pad8(8+len(meta))
+	blk := block{offset: w.offset, metaLength: int32(8 + padded), bodyLength: int64(len(body))}
+
+	var prefix [8]byte
+	binary.LittleEndian.PutUint32(prefix[:4], 0xffffffff)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(padded))
+	for _, p := range [][]byte{prefix[:], meta, make([]byte, padded-len(meta)), body} {
+		if err := w.write(p); err != nil {
+			return blk, err
+		}
+	}
+	return blk, nil
+}
+
+func (w *Writer) write(p []byte) error {
+	n, err := w.w.Write(p)
+	w.offset += int64(n)
+	return err
+}
+
+func pad8(n int) int {
+	return (8 - n%8) % 8
+}
+
+func (w *Writer) buildSchema(b *builder) int {
+	fields := make([]int, len(w.columns))
+	for i, col := range w.columns {
+		name := b.createString(col.Name)
+		children := b.createOffsetVector(nil)
+
+		var typeType uint8
+		var typ int
+		switch col.Type {
+		case String:
+			typeType = typeUtf8
+			b.startTable(0)
+			typ = b.endTable()
+		case Int64:
+			typeType = typeInt
+			b.startTable(2)
+			b.addInt32(0, 64)
+			b.addBool(1, true)
+			typ = b.endTable()
+		case Timestamp:
+			typeType = typeTimestamp
+			tz := b.createString("UTC")
+			b.startTable(2)
+			b.addOffset(1, tz)
+			b.addInt16(0, unitMillisecond)
+			typ = b.endTable()
+		}
+
+		b.startTable(7)
+		b.addOffset(0, name)
+		b.addOffset(3, typ)
+		b.addOffset(5, children)
+		b.addUint8(2, typeType)
+		b.addBool(1, false)
+		fields[i] = b.endTable()
+	}
+	fieldVec := b.createOffsetVector(fields)
+
+	b.startTable(4)
+	b.addOffset(1, fieldVec)
+	return b.endTable()
+}
+
+func (w *Writer) schemaMessage() []byte {
+	b := newBuilder()
+	schema := w.buildSchema(b)
+
+	b.startTable(5)
+	b.addInt64(3, 0)
+	b.addOffset(2, schema)
+	b.addInt16(0, metadataV5)
+	b.addUint8(1, headerSchema)
+	return b.finish(b.endTable())
+}
+
+func (w *Writer) recordBatchMessage(buffers [][2]int64, bodyLength int64) []byte {
+	b := newBuilder()
+
+	nodes := make([][]byte, len(w.columns))
+	for i := range nodes {
+		node := make([]byte, 16)
+		binary.LittleEndian.PutUint64(node, uint64(w.rows))
+		nodes[i] = node
+	}
+	nodeVec := b.createStructVector(nodes, 16, 8)
+
+	bufs := make([][]byte, len(buffers))
+	for i, buf := range buffers {
+		elem := make([]byte, 16)
+		binary.LittleEndian.PutUint64(elem, uint64(buf[0]))
+		binary.LittleEndian.PutUint64(elem[8:], uint64(buf[1]))
+		bufs[i] = elem
+	}
+	bufVec := b.createStructVector(bufs, 16, 8)
+
+	b.startTable(5)
+	b.addInt64(0, w.rows)
+	b.addOffset(1, nodeVec)
+	b.addOffset(2, bufVec)
+	batch := b.endTable()
+
+	b.startTable(5)
+	b.addInt64(3, bodyLength)
+	b.addOffset(2, batch)
+	b.addInt16(0, metadataV5)
+	b.addUint8(1, headerRecordBatch)
+	return b.finish(b.endTable())
+}
+
+func (w *Writer) footer() []byte {
+	b := newBuilder()
+	schema := w.buildSchema(b)
+
+	blocks := make([][]byte, len(w.batches))
+	for i, blk := range w.batches {
+		elem := make([]byte, 24)
+		binary.LittleEndian.PutUint64(elem, uint64(blk.offset))
+		binary.LittleEndian.PutUint32(elem[8:], uint32(blk.metaLength))
+		binary.LittleEndian.PutUint64(elem[16:], uint64(blk.bodyLength))
+		blocks[i] = elem
+	}
+	batchVec := b.createStructVector(blocks, 24, 8)
+	dictVec := b.createStructVector(nil, 24, 8)
+
+	b.startTable(5)
+	b.addOffset(1, schema)
+	b.addOffset(2, dictVec)
+	b.addOffset(3, batchVec)
+	b.addInt16(0, metadataV5)
+	return b.finish(b.endTable())
+}
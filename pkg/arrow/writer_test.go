@@ -0,0 +1,95 @@
+package arrow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// field returns the absolute position of a table field, or 0 when absent.
+func field(buf []byte, table, id int) int {
+	vtable := table - int(int32(binary.LittleEndian.Uint32(buf[table:])))
+	vtSize := int(binary.LittleEndian.Uint16(buf[vtable:]))
+	slot := 4 + 2*id
+	if slot >= vtSize {
+		return 0
+	}
+	off := int(binary.LittleEndian.Uint16(buf[vtable+slot:]))
+	if off == 0 {
+		return 0
+	}
+	return table + off
+}
+
+func deref(buf []byte, pos int) int {
+	return pos + int(binary.LittleEndian.Uint32(buf[pos:]))
+}
+
+func TestBuilderTable(t *testing.T) {
+	b := newBuilder()
+	name := b.createString("hello")
+	b.startTable(3)
+	b.addInt64(2, 42)
+	b.addOffset(0, name)
+	buf := b.finish(b.endTable())
+
+	root := deref(buf, 0)
+	if pos := field(buf, root, 2); pos == 0 || binary.LittleEndian.Uint64(buf[pos:]) != 42 {
+		t.Error("Int64 field not readable")
+	}
+	if field(buf, root, 1) != 0 {
+		t.Error("Unset field should be absent")
+	}
+	str := deref(buf, field(buf, root, 0))
+	n := int(binary.LittleEndian.Uint32(buf[str:]))
+	if got := string(buf[str+4 : str+4+n]); got != "hello" {
+		t.Errorf("String field = %q, expected hello", got)
+	}
+}
+
+func TestWriterFooter(t *testing.T) {
+	var out bytes.Buffer
+	w, err := NewWriter(&out, []Column{
+		{Name: "path", Type: String},
+		{Name: "size", Type: Int64},
+		{Name: "mtime", Type: Timestamp},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.BatchSize = 2
+	for i := 0; i < 5; i++ {
+		if err := w.WriteRow("/a", int64(i), time.Unix(0, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := out.Bytes()
+	if string(data[:6]) != fileMagic || string(data[len(data)-6:]) != fileMagic {
+		t.Fatal("File is missing the ARROW1 magic")
+	}
+	if binary.LittleEndian.Uint32(data[8:]) != 0xffffffff {
+		t.Error("Schema message should start with a continuation marker")
+	}
+
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-10:]))
+	footer := data[len(data)-10-footerLen : len(data)-10]
+	root := deref(footer, 0)
+	batches := field(footer, root, 3)
+	if batches == 0 {
+		t.Fatal("Footer has no record batch vector")
+	}
+	vec := deref(footer, batches)
+	if n := binary.LittleEndian.Uint32(footer[vec:]); n != 3 {
+		t.Errorf("Footer lists %d record batches, expected 3", n)
+	}
+
+	first := int(binary.LittleEndian.Uint64(footer[vec+4:]))
+	if first%8 != 0 || binary.LittleEndian.Uint32(data[first:]) != 0xffffffff {
+		t.Errorf("First record batch block points at invalid offset %d", first)
+	}
+}
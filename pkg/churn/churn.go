@@ -0,0 +1,100 @@
+// Package churn attributes file creation and deletion to the processes
+// doing it, to answer "what keeps creating these millions of files". It is
+// experimental and only works on Linux, where eBPF programs on the syscall
+// tracepoints count the create, mkdir, unlink and rmdir calls of every
+// process on the system, whichever tree they touch.
+package churn
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Proc is what one process created and deleted during an interval.
+// Creating opens count whether or not the file already existed.
+type Proc struct {
+	PID     int    `json:"pid"`
+	Comm    string `json:"comm"`
+	Created int64  `json:"created"`
+	Deleted int64  `json:"deleted"`
+}
+
+// String names the process, e.g. "rsync[1234]".
+func (p Proc) String() string {
+	if p.Comm == "" {
+		return fmt.Sprintf("pid %d", p.PID)
+	}
+	return fmt.Sprintf("%s[%d]", p.Comm, p.PID)
+}
+
+// counts are the kernel's per-process counters, laid out as in the map,
+// with the command name of the process when it was first counted.
+type counts struct {
+	created uint64
+	deleted uint64
+	comm    [16]byte
+}
+
+// counter is the platform's way of counting calls per process.
+type counter interface {
+	// take returns the counts since the last call and starts again.
+	take() (map[uint32]counts, error)
+	close() error
+}
+
+// Monitor counts file creation and deletion per process.
+type Monitor struct {
+	c counter
+}
+
+// Start starts counting. It needs root, or CAP_BPF and CAP_PERFMON, and
+// tracefs mounted.
+func Start() (*Monitor, error) {
+	c, err := newCounter()
+	if err != nil {
+		return nil, err
+	}
+	return &Monitor{c: c}, nil
+}
+
+// Read returns the processes that created or deleted anything since the
+// last Read, busiest first.
+func (m *Monitor) Read() ([]Proc, error) {
+	raw, err := m.c.take()
+	if err != nil {
+		return nil, err
+	}
+	procs := make([]Proc, 0, len(raw))
+	for pid, c := range raw {
+		name := string(bytes.TrimRight(c.comm[:], "\x00"))
+		if name == "" {
+			name = comm(int(pid))
+		}
+		procs = append(procs, Proc{PID: int(pid), Comm: name, Created: int64(c.created), Deleted: int64(c.deleted)})
+	}
+	sort.Slice(procs, func(i, j int) bool {
+		a, b := procs[i].Created+procs[i].Deleted, procs[j].Created+procs[j].Deleted
+		if a != b {
+			return a > b
+		}
+		return procs[i].PID < procs[j].PID
+	})
+	return procs, nil
+}
+
+// Close stops counting.
+func (m *Monitor) Close() error {
+	return m.c.close()
+}
+
+// comm returns the command name of a process, or "" once it has exited.
+func comm(pid int) string {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,420 @@
+//go:build amd64 || arm64
+
+package churn
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// From linux/bpf.h and linux/perf_event.h.
+const (
+	bpfMapCreate  = 0
+	bpfMapLookup  = 1
+	bpfMapDelete  = 3
+	bpfMapNextKey = 4
+	bpfProgLoad   = 5
+
+	bpfMapTypeHash        = 1
+	bpfProgTypeTracepoint = 5
+	bpfNoExist            = 1
+
+	bpfFuncMapLookup   = 1
+	bpfFuncMapUpdate   = 2
+	bpfFuncPidTgid     = 14
+	bpfFuncComm        = 16
+	bpfPseudoMapFD     = 1
+	perfTypeTracepoint = 2
+	perfFlagCloexec    = 8
+	perfIocEnable      = 0x2400
+	perfIocSetBPF      = 0x40042408
+	rlimitMemlock      = 8
+
+	maxProcs = 16384
+)
+
+// Supported reports whether a Monitor can run here at all.
+const Supported = true
+
+// tracepoint is a syscall tracepoint counted as a creation or a deletion.
+// flags names the field holding open flags, for calls that only create
+// with O_CREAT.
+type tracepoint struct {
+	name    string
+	deleted bool
+	flags   string
+}
+
+// The calls that are missing on some architectures, such as unlink on
+// arm64, are skipped where they don't exist.
+var tracepoints = []tracepoint{
+	{name: "sys_enter_creat"},
+	{name: "sys_enter_open", flags: "flags"},
+	{name: "sys_enter_openat", flags: "flags"},
+	{name: "sys_enter_mkdir"},
+	{name: "sys_enter_mkdirat"},
+	{name: "sys_enter_mknod"},
+	{name: "sys_enter_mknodat"},
+	{name: "sys_enter_unlink", deleted: true},
+	{name: "sys_enter_unlinkat", deleted: true},
+	{name: "sys_enter_rmdir", deleted: true},
+}
+
+var tracefsDirs = []string{"/sys/kernel/tracing", "/sys/kernel/debug/tracing"}
+
+type bpfCounter struct {
+	mapFD int
+	fds   []int
+}
+
+func newCounter() (counter, error) {
+	events := ""
+	for _, dir := range tracefsDirs {
+		if _, err := os.Stat(filepath.Join(dir, "events", "syscalls")); err == nil {
+			events = filepath.Join(dir, "events", "syscalls")
+			break
+		}
+	}
+	if events == "" {
+		return nil, errors.New("no syscall tracepoints: mount tracefs on /sys/kernel/tracing, in a kernel built with CONFIG_FTRACE_SYSCALLS")
+	}
+
+	// Kernels before 5.11 charge maps to the locked memory limit.
+	syscall.Setrlimit(rlimitMemlock, &syscall.Rlimit{Cur: ^uint64(0), Max: ^uint64(0)})
+	mapFD, err := bpf(bpfMapCreate, unsafe.Pointer(&mapAttr{
+		mapType: bpfMapTypeHash, keySize: 4, valueSize: uint32(unsafe.Sizeof(counts{})), maxEntries: maxProcs,
+	}), unsafe.Sizeof(mapAttr{}))
+	if err != nil {
+		return nil, fmt.Errorf("creating eBPF map: %w", err)
+	}
+	c := &bpfCounter{mapFD: mapFD}
+
+	progs := map[string]int{}
+	for _, tp := range tracepoints {
+		dir := filepath.Join(events, tp.name)
+		id, err := readInt(filepath.Join(dir, "id"))
+		if err != nil {
+			continue
+		}
+		flagsOff := -1
+		if tp.flags != "" {
+			if flagsOff, err = fieldOffset(filepath.Join(dir, "format"), tp.flags); err != nil {
+				c.close()
+				return nil, err
+			}
+		}
+		key := fmt.Sprint(tp.deleted, flagsOff)
+		prog, ok := progs[key]
+		if !ok {
+			if prog, err = load(program(mapFD, tp.deleted, flagsOff)); err != nil {
+				c.close()
+				return nil, err
+			}
+			progs[key] = prog
+			c.fds = append(c.fds, prog)
+		}
+		ev, err := attach(id, prog)
+		if err != nil {
+			c.close()
+			return nil, fmt.Errorf("attaching to %s: %w", tp.name, err)
+		}
+		c.fds = append(c.fds, ev)
+	}
+	if len(progs) == 0 {
+		c.close()
+		return nil, fmt.Errorf("no create or unlink tracepoints in %s", events)
+	}
+	return c, nil
+}
+
+func (c *bpfCounter) take() (map[uint32]counts, error) {
+	var pids []uint32
+	var key, next uint32
+	cur := unsafe.Pointer(nil)
+	for {
+		attr := elemAttr{mapFD: uint32(c.mapFD), key: cur, value: unsafe.Pointer(&next)}
+		if _, err := bpf(bpfMapNextKey, unsafe.Pointer(&attr), unsafe.Sizeof(attr)); err != nil {
+			if err == syscall.ENOENT {
+				break
+			}
+			return nil, err
+		}
+		pids = append(pids, next)
+		key, cur = next, unsafe.Pointer(&key)
+	}
+
+	// Counts added between the lookup and the delete are lost, which is
+	// fine for finding who is busy.
+	out := make(map[uint32]counts, len(pids))
+	for _, pid := range pids {
+		var v counts
+		attr := elemAttr{mapFD: uint32(c.mapFD), key: unsafe.Pointer(&pid), value: unsafe.Pointer(&v)}
+		if _, err := bpf(bpfMapLookup, unsafe.Pointer(&attr), unsafe.Sizeof(attr)); err != nil {
+			continue
+		}
+		// The kernel wants the fields past the key zeroed.
+		attr.value = nil
+		bpf(bpfMapDelete, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+		out[pid] = v
+	}
+	return out, nil
+}
+
+func (c *bpfCounter) close() error {
+	for _, fd := range c.fds {
+		syscall.Close(fd)
+	}
+	c.fds = nil
+	return syscall.Close(c.mapFD)
+}
+
+// The bpf(2) attributes below hold real pointers, which works as only
+// 64-bit platforms are built, so the collector and stack growth see them.
+type mapAttr struct {
+	mapType    uint32
+	keySize    uint32
+	valueSize  uint32
+	maxEntries uint32
+	mapFlags   uint32
+}
+
+type elemAttr struct {
+	mapFD uint32
+	_     uint32
+	key   unsafe.Pointer
+	value unsafe.Pointer
+	flags uint64
+}
+
+type progAttr struct {
+	progType    uint32
+	insnCnt     uint32
+	insns       unsafe.Pointer
+	license     unsafe.Pointer
+	logLevel    uint32
+	logSize     uint32
+	logBuf      unsafe.Pointer
+	kernVersion uint32
+	progFlags   uint32
+	name        [16]byte
+}
+
+// perfAttr is the first version of struct perf_event_attr.
+type perfAttr struct {
+	typ          uint32
+	size         uint32
+	config       uint64
+	samplePeriod uint64
+	sampleType   uint64
+	readFormat   uint64
+	bits         uint64
+	wakeupEvents uint32
+	bpType       uint32
+	config1      uint64
+}
+
+func bpf(cmd int, attr unsafe.Pointer, size uintptr) (int, error) {
+	fd, _, errno := syscall.Syscall(sysBPF, uintptr(cmd), uintptr(attr), size)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// load loads a tracepoint program, returning the verifier's complaint if
+// it is rejected.
+func load(insns []insn) (int, error) {
+	code := make([]byte, 0, len(insns)*8)
+	for _, in := range insns {
+		code = in.append(code)
+	}
+	license := []byte("Dual MIT/GPL\x00")
+	log := make([]byte, 64<<10)
+	attr := progAttr{
+		progType: bpfProgTypeTracepoint, insnCnt: uint32(len(insns)),
+		insns: unsafe.Pointer(&code[0]), license: unsafe.Pointer(&license[0]),
+		logLevel: 1, logSize: uint32(len(log)), logBuf: unsafe.Pointer(&log[0]),
+	}
+	copy(attr.name[:], "file_counter")
+	fd, err := bpf(bpfProgLoad, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	if err != nil {
+		if msg := strings.TrimSpace(strings.TrimRight(string(log), "\x00")); msg != "" {
+			return -1, fmt.Errorf("loading eBPF program: %w: %s", err, msg)
+		}
+		return -1, fmt.Errorf("loading eBPF program: %w", err)
+	}
+	return fd, nil
+}
+
+// attach runs prog whenever the tracepoint with the given id fires, on any
+// CPU.
+func attach(id int, prog int) (int, error) {
+	attr := perfAttr{typ: perfTypeTracepoint, config: uint64(id), samplePeriod: 1, wakeupEvents: 1}
+	attr.size = uint32(unsafe.Sizeof(attr))
+	pid, cpu, group := -1, 0, -1
+	fd, _, errno := syscall.Syscall6(syscall.SYS_PERF_EVENT_OPEN, uintptr(unsafe.Pointer(&attr)),
+		uintptr(pid), uintptr(cpu), uintptr(group), perfFlagCloexec, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	for _, req := range []uintptr{perfIocSetBPF, perfIocEnable} {
+		arg := uintptr(0)
+		if req == perfIocSetBPF {
+			arg = uintptr(prog)
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg); errno != 0 {
+			syscall.Close(int(fd))
+			return -1, errno
+		}
+	}
+	return int(fd), nil
+}
+
+func readInt(name string) (int, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// fieldOffset finds where a field is in a tracepoint's record, from lines
+// such as "field:int flags;	offset:32;	size:8;	signed:0;".
+func fieldOffset(format, field string) (int, error) {
+	f, err := os.Open(format)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		parts := strings.Split(strings.TrimSpace(sc.Text()), ";")
+		if len(parts) < 3 || !strings.HasPrefix(parts[0], "field:") {
+			continue
+		}
+		decl := strings.Fields(parts[0])
+		if decl[len(decl)-1] != field {
+			continue
+		}
+		off, ok := strings.CutPrefix(strings.TrimSpace(parts[1]), "offset:")
+		if !ok {
+			break
+		}
+		return strconv.Atoi(off)
+	}
+	return 0, fmt.Errorf("%s: no %s field", format, field)
+}
+
+// insn is one eBPF instruction.
+type insn struct {
+	op       uint8
+	dst, src uint8
+	off      int16
+	imm      int32
+}
+
+func (in insn) append(b []byte) []byte {
+	b = append(b, in.op, in.dst|in.src<<4)
+	b = binary.LittleEndian.AppendUint16(b, uint16(in.off))
+	return binary.LittleEndian.AppendUint32(b, uint32(in.imm))
+}
+
+// Registers and opcodes used by program.
+const (
+	r0, r1, r2, r3, r4, r10 = 0, 1, 2, 3, 4, 10
+
+	opLoadDW    = 0x79 // dst = *(u64 *)(src + off)
+	opStoreW    = 0x63 // *(u32 *)(dst + off) = src
+	opStoreImm  = 0x7a // *(u64 *)(dst + off) = imm
+	opAtomicAdd = 0xdb // lock *(u64 *)(dst + off) += src
+	opMovReg    = 0xbf
+	opMovImm    = 0xb7
+	opAddImm    = 0x07
+	opAndImm    = 0x57
+	opRshImm    = 0x77
+	opJeqImm    = 0x15
+	opJump      = 0x05
+	opCall      = 0x85
+	opExit      = 0x95
+	opLoadImm64 = 0x18
+)
+
+// program counts one call for the current process in the map, in the
+// created or the deleted counter. With flagsOff set, only calls whose open
+// flags there include O_CREAT are counted.
+//
+// The stack holds the key, the process ID, at -4 and a new value below
+// it, to add when the process has no counters yet. The command
+// name is kept then, while the process is sure to be alive.
+func program(mapFD int, deleted bool, flagsOff int) []insn {
+	valueSize := int16(unsafe.Sizeof(counts{}))
+	value := -8 - valueSize
+	slot := int16(unsafe.Offsetof(counts{}.created))
+	if deleted {
+		slot = int16(unsafe.Offsetof(counts{}.deleted))
+	}
+	comm := int16(unsafe.Offsetof(counts{}.comm))
+	loadMap := []insn{
+		{op: opLoadImm64, dst: r1, src: bpfPseudoMapFD, imm: int32(mapFD)},
+		{},
+	}
+	key := []insn{{op: opMovReg, dst: r2, src: r10}, {op: opAddImm, dst: r2, imm: -4}}
+
+	// No counters for the process yet: add them, starting at one.
+	insert := []insn{
+		{op: opStoreImm, dst: r10, off: value},
+		{op: opStoreImm, dst: r10, off: value + 8},
+		{op: opStoreImm, dst: r10, off: value + slot, imm: 1},
+		{op: opMovReg, dst: r1, src: r10},
+		{op: opAddImm, dst: r1, imm: int32(value + comm)},
+		{op: opMovImm, dst: r2, imm: int32(valueSize - comm)},
+		{op: opCall, imm: bpfFuncComm},
+	}
+	insert = append(insert, loadMap...)
+	insert = append(insert, key...)
+	insert = append(insert,
+		insn{op: opMovReg, dst: r3, src: r10},
+		insn{op: opAddImm, dst: r3, imm: int32(value)},
+		insn{op: opMovImm, dst: r4, imm: bpfNoExist},
+		insn{op: opCall, imm: bpfFuncMapUpdate},
+	)
+	increment := []insn{
+		{op: opMovImm, dst: r1, imm: 1},
+		{op: opAtomicAdd, dst: r0, src: r1, off: slot},
+		{op: opJump, off: int16(len(insert))},
+	}
+
+	// The key is the process ID, the upper half of pid_tgid.
+	lookup := []insn{
+		{op: opCall, imm: bpfFuncPidTgid},
+		{op: opRshImm, dst: r0, imm: 32},
+		{op: opStoreW, dst: r10, src: r0, off: -4},
+	}
+	lookup = append(lookup, loadMap...)
+	lookup = append(lookup, key...)
+	lookup = append(lookup,
+		insn{op: opCall, imm: bpfFuncMapLookup},
+		insn{op: opJeqImm, dst: r0, off: int16(len(increment))},
+	)
+
+	var prog []insn
+	if flagsOff >= 0 {
+		prog = append(prog,
+			insn{op: opLoadDW, dst: r2, src: r1, off: int16(flagsOff)},
+			insn{op: opAndImm, dst: r2, imm: syscall.O_CREAT},
+			insn{op: opJeqImm, dst: r2, off: int16(len(lookup) + len(increment) + len(insert))},
+		)
+	}
+	prog = append(prog, lookup...)
+	prog = append(prog, increment...)
+	prog = append(prog, insert...)
+	return append(prog, insn{op: opMovImm, dst: r0}, insn{op: opExit})
+}
@@ -0,0 +1,11 @@
+//go:build !linux || !(amd64 || arm64)
+
+package churn
+
+import "errors"
+
+const Supported = false
+
+func newCounter() (counter, error) {
+	return nil, errors.New("attributing file churn to processes needs eBPF on Linux (amd64 or arm64)")
+}
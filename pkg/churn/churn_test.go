@@ -0,0 +1,73 @@
+package churn
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProcString(t *testing.T) {
+	if got := (Proc{PID: 12, Comm: "rsync"}).String(); got != "rsync[12]" {
+		t.Errorf("Got %q", got)
+	}
+	if got := (Proc{PID: 12}).String(); got != "pid 12" {
+		t.Errorf("Got %q for an exited process", got)
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	m, err := Start()
+	if err != nil {
+		// Without the privileges or tracefs there is nothing to test, but
+		// the verifier rejecting a program is a bug.
+		if strings.Contains(err.Error(), "loading eBPF program") {
+			t.Fatal(err)
+		}
+		t.Skip(err)
+	}
+	defer m.Close()
+	m.Read()
+
+	dir := t.TempDir()
+	for i := 0; i < 50; i++ {
+		name := filepath.Join(dir, fmt.Sprint(i))
+		if err := os.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 0 {
+			os.Remove(name)
+		}
+	}
+	// Opening without O_CREAT is not a creation.
+	for i := 0; i < 50; i++ {
+		os.ReadFile(filepath.Join(dir, "1"))
+	}
+
+	procs, err := m.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := find(procs, os.Getpid()); p == nil {
+		t.Fatalf("Expected pid %d among %v", os.Getpid(), procs)
+	} else if p.Created < 50 || p.Created > 60 || p.Deleted < 25 || p.Deleted > 35 || p.Comm == "" {
+		// Other tests and the runtime may create files too, but not many.
+		t.Errorf("Got %+v", *p)
+	}
+
+	// Reading starts counting again.
+	procs, _ = m.Read()
+	if p := find(procs, os.Getpid()); p != nil && p.Created >= 50 {
+		t.Errorf("Got %+v again", *p)
+	}
+}
+
+func find(procs []Proc, pid int) *Proc {
+	for i := range procs {
+		if procs[i].PID == pid {
+			return &procs[i]
+		}
+	}
+	return nil
+}
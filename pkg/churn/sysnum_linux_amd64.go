@@ -0,0 +1,4 @@
+package churn
+
+// The syscall package predates bpf(2) on amd64.
+const sysBPF = 321
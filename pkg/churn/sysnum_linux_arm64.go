@@ -0,0 +1,5 @@
+package churn
+
+import "syscall"
+
+const sysBPF = syscall.SYS_BPF
@@ -0,0 +1,118 @@
+// Package content classifies files by what their first bytes hold: data
+// that is already compressed, and so gains nothing from filesystem
+// compression, or that is encrypted, and the like.
+package content
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadHead returns up to the first n bytes of the file at path.
+func ReadHead(path string, n int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b := make([]byte, n)
+	m, err := io.ReadFull(f, b)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return b[:m], err
+}
+
+// magic is a signature at a fixed offset that identifies a format.
+type magic struct {
+	format string
+	offset int
+	sig    string
+}
+
+func (m magic) match(head []byte) bool {
+	return len(head) >= m.offset+len(m.sig) && string(head[m.offset:m.offset+len(m.sig)]) == m.sig
+}
+
+// compressedMagic identifies formats whose content is compressed: archives
+// and compressed streams, and media and document formats that compress
+// their data.
+var compressedMagic = []magic{
+	{"zip", 0, "PK\x03\x04"},
+	{"zip", 0, "PK\x05\x06"},
+	{"gzip", 0, "\x1f\x8b"},
+	{"bzip2", 0, "BZh"},
+	{"xz", 0, "\xfd7zXZ\x00"},
+	{"zstd", 0, "\x28\xb5\x2f\xfd"},
+	{"lz4", 0, "\x04\x22\x4d\x18"},
+	{"lzip", 0, "LZIP"},
+	{"zlib", 0, "\x78\x01"},
+	{"zlib", 0, "\x78\x5e"},
+	{"zlib", 0, "\x78\x9c"},
+	{"zlib", 0, "\x78\xda"},
+	{"git pack", 0, "PACK"},
+	{"compress", 0, "\x1f\x9d"},
+	{"7z", 0, "7z\xbc\xaf\x27\x1c"},
+	{"rar", 0, "Rar!\x1a\x07"},
+	{"cab", 0, "MSCF"},
+	{"rpm", 0, "\xed\xab\xee\xdb"},
+	{"deb", 0, "!<arch>\ndebian"},
+	{"squashfs", 0, "hsqs"},
+	{"jpeg", 0, "\xff\xd8\xff"},
+	{"png", 0, "\x89PNG\r\n\x1a\n"},
+	{"gif", 0, "GIF8"},
+	{"webp", 8, "WEBP"},
+	{"jpeg xl", 0, "\xff\x0a"},
+	{"jpeg xl", 4, "JXL "},
+	{"mp4", 4, "ftyp"}, // also QuickTime, HEIC and AVIF
+	{"matroska", 0, "\x1a\x45\xdf\xa3"},
+	{"mp3", 0, "ID3"},
+	{"flac", 0, "fLaC"},
+	{"ogg", 0, "OggS"},
+	{"woff", 0, "wOFF"},
+	{"woff2", 0, "wOF2"},
+}
+
+// compressedExts are compressed formats that have no signature to go by,
+// or none distinctive enough, and so are told by extension.
+var compressedExts = map[string]string{
+	".br":   "brotli",
+	".mp3":  "mp3",
+	".aac":  "aac",
+	".sz":   "snappy",
+	".lzma": "lzma",
+	".dmg":  "dmg",
+}
+
+// Compressed returns the name of the compressed format the file at path
+// is in, going by its first bytes in head, which should hold at least 16
+// if the file is that long, or failing that by its extension. It returns
+// "" for other files.
+func Compressed(path string, head []byte) string {
+	for _, m := range compressedMagic {
+		if m.match(head) {
+			return m.format
+		}
+	}
+	return compressedExts[strings.ToLower(filepath.Ext(path))]
+}
+
+// TextSample is how much of the start of a file IsBinary should be given,
+// as much as git looks at to tell binary files apart.
+const TextSample = 8000
+
+// IsBinary reports whether sample, the start of a file, is binary rather
+// than text: whether it holds a NUL byte, which text in 8-bit encodings and
+// UTF-8 never does. Text in UTF-16 or UTF-32 does; it is recognized by its
+// byte order mark.
+func IsBinary(sample []byte) bool {
+	for _, bom := range []string{"\xff\xfe", "\xfe\xff", "\x00\x00\xfe\xff"} {
+		if strings.HasPrefix(string(sample), bom) {
+			return false
+		}
+	}
+	return bytes.IndexByte(sample, 0) >= 0
+}
@@ -0,0 +1,151 @@
+package content
+
+import (
+	"bytes"
+	"compress/zlib"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressed(t *testing.T) {
+	for _, tc := range []struct {
+		path, head, want string
+	}{
+		{"a.tar.gz", "\x1f\x8b\x08\x00", "gzip"},
+		{"a.bin", "\x28\xb5\x2f\xfd\x00", "zstd"},
+		{"report.docx", "PK\x03\x04\x14\x00", "zip"},
+		{"IMG_0001", "\xff\xd8\xff\xe0\x00\x10JFIF", "jpeg"},
+		{"clip.mov", "\x00\x00\x00\x14ftypqt  ", "mp4"},
+		{"a.webp", "RIFF\x00\x00\x00\x00WEBPVP8 ", "webp"},
+		{"bundle.js.br", "\x1b\x0b\x00\x00", "brotli"},
+		{"SONG.MP3", "\xff\xfb\x90\x00", "mp3"},
+		{"notes.txt", "hello, world", ""},
+		{"a.wav", "RIFF\x00\x00\x00\x00WAVEfmt ", ""},
+		{"empty.gz", "", ""},
+	} {
+		if got := Compressed(tc.path, []byte(tc.head)); got != tc.want {
+			t.Errorf("Compressed(%q, %q) = %q, expected %q", tc.path, tc.head, got, tc.want)
+		}
+	}
+}
+
+func TestReadHead(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "a")
+	os.WriteFile(name, []byte("abc"), 0644)
+	for n, want := range map[int]string{2: "ab", 3: "abc", 10: "abc"} {
+		b, err := ReadHead(name, n)
+		if err != nil || string(b) != want {
+			t.Errorf("ReadHead(%d) = %q, %v; expected %q", n, b, err, want)
+		}
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	random := make([]byte, EntropySample)
+	rand.New(rand.NewSource(1)).Read(random)
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 2000)
+
+	if e := Entropy(bytes.Repeat([]byte{'a'}, 100)); e != 0 {
+		t.Errorf("Entropy of one byte value = %v", e)
+	}
+	if e := Entropy([]byte{0, 1, 2, 3}); e != 2 {
+		t.Errorf("Entropy of four byte values = %v", e)
+	}
+	for _, n := range []int{MinEntropySample, 16 << 10, EntropySample} {
+		if !HighEntropy(random[:n]) {
+			t.Errorf("%d random bytes: entropy %v not high", n, Entropy(random[:n]))
+		}
+	}
+	if HighEntropy(text) {
+		t.Errorf("text: entropy %v high", Entropy(text))
+	}
+	if HighEntropy(random[:MinEntropySample-1]) {
+		t.Error("sample below the minimum judged")
+	}
+	// Compressed data is dense too, so known formats go by signature.
+	var deflated bytes.Buffer
+	zw := zlib.NewWriter(&deflated)
+	zw.Write(text)
+	zw.Close()
+	if Compressed("a", deflated.Bytes()) != "zlib" {
+		t.Error("zlib stream not recognized")
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	for head, want := range map[string]string{
+		"Salted__\x01\x02":                     "openssl enc",
+		"age-encryption.org/v1\n-> X25519":     "age",
+		"\xeb\x58\x90-FVE-FS-":                 "bitlocker volume",
+		"PK\x03\x04\x14\x00\x01\x00\x08\x00":   "encrypted zip",
+		"PK\x03\x04\x14\x00\x00\x00\x08\x00":   "",
+		"-----BEGIN PGP PUBLIC KEY BLOCK-----": "",
+	} {
+		if got := Encrypted([]byte(head)); got != want {
+			t.Errorf("Encrypted(%q) = %q, expected %q", head, got, want)
+		}
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	for sample, want := range map[string]bool{
+		"package main\n":          false,
+		"na\xc3\xafve UTF-8\n":    false,
+		"\x7fELF\x02\x01\x01\x00": true,
+		"\xff\xfeh\x00i\x00":      false, // UTF-16LE with a BOM
+		"h\x00i\x00":              true,
+		"":                        false,
+	} {
+		if got := IsBinary([]byte(sample)); got != want {
+			t.Errorf("IsBinary(%q) = %v", sample, got)
+		}
+	}
+}
+
+func TestHygiene(t *testing.T) {
+	for _, tc := range []struct {
+		sample    string
+		truncated bool
+		want      *TextInfo
+	}{
+		{"a\nb\n", false, &TextInfo{"ascii", false, "lf"}},
+		{"a\r\nb\r\n", false, &TextInfo{"ascii", false, "crlf"}},
+		{"a\r\nb\n", false, &TextInfo{"ascii", false, "mixed"}},
+		{"a\rb\r", false, &TextInfo{"ascii", false, "cr"}},
+		{"one line", false, &TextInfo{"ascii", false, "none"}},
+		{"\xef\xbb\xbfcaf\xc3\xa9\r\n", false, &TextInfo{"utf-8", true, "crlf"}},
+		{"caf\xc3", true, &TextInfo{"utf-8", false, "none"}},
+		{"caf\xc3", false, &TextInfo{"8-bit", false, "none"}},
+		{"caf\xe9\n", false, &TextInfo{"8-bit", false, "lf"}},
+		{"\xff\xfea\x00\r\x00\n\x00", false, &TextInfo{"utf-16le", true, "crlf"}},
+		{"\xfe\xff\x00a\x00\n", false, &TextInfo{"utf-16be", true, "lf"}},
+		{"\x7fELF\x02\x01\x01\x00", false, nil},
+	} {
+		got := Hygiene([]byte(tc.sample), tc.truncated)
+		if (got == nil) != (tc.want == nil) || got != nil && *got != *tc.want {
+			t.Errorf("Hygiene(%q) = %+v, expected %+v", tc.sample, got, tc.want)
+		}
+	}
+}
+
+func TestShebang(t *testing.T) {
+	for _, tc := range []struct {
+		head string
+		want *Interpreter
+	}{
+		{"#!/bin/bash\necho hi\n", &Interpreter{"bash", "/bin/bash"}},
+		{"#! /bin/sh -e\r\n", &Interpreter{"sh", "/bin/sh"}},
+		{"#!/usr/bin/env python3\n", &Interpreter{"python3", "/usr/bin/env python3"}},
+		{"#!/usr/bin/env -S LANG=C perl -w\n", &Interpreter{"perl", "/usr/bin/env perl"}},
+		{"#!/usr/bin/env\n", &Interpreter{"env", "/usr/bin/env"}},
+		{"#!\n", nil},
+		{"echo hi\n", nil},
+	} {
+		got := Shebang([]byte(tc.head))
+		if (got == nil) != (tc.want == nil) || got != nil && *got != *tc.want {
+			t.Errorf("Shebang(%q) = %+v, expected %+v", tc.head, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package content
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// EntropySample is how much of the start of a file is enough to judge its
+// entropy by. Ransomware encrypts at least the start of what it touches.
+const EntropySample = 64 << 10
+
+// MinEntropySample is the smallest sample HighEntropy judges: the entropy
+// of fewer bytes says too little about whether they are random.
+const MinEntropySample = 4 << 10
+
+// Entropy returns the Shannon entropy of b in bits per byte, from 0 for a
+// single repeated byte to 8 for uniformly random data.
+func Entropy(b []byte) float64 {
+	if len(b) == 0 {
+		return 0
+	}
+	var counts [256]int
+	for _, c := range b {
+		counts[c]++
+	}
+	var h float64
+	n := float64(len(b))
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / n
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+// HighEntropy reports whether sample, of at least MinEntropySample bytes,
+// looks like random data: encrypted, or compressed by something that left
+// no signature. Even random samples fall short of 8 bits per byte by about
+// 255/(2n ln 2) for n bytes; the threshold allows twice that.
+func HighEntropy(sample []byte) bool {
+	if len(sample) < MinEntropySample {
+		return false
+	}
+	return Entropy(sample) >= 8-255/(float64(len(sample))*math.Ln2)
+}
+
+// encryptedMagic identifies encrypted containers and files.
+var encryptedMagic = []magic{
+	{"openssl enc", 0, "Salted__"},
+	{"age", 0, "age-encryption.org/v1\n"},
+	{"pgp message", 0, "-----BEGIN PGP MESSAGE-----"},
+	{"luks volume", 0, "LUKS\xba\xbe"},
+	{"bitlocker volume", 3, "-FVE-FS-"},
+	{"ansible vault", 0, "$ANSIBLE_VAULT;"},
+	{"keepass database", 0, "\x03\xd9\xa2\x9a"},
+}
+
+// Encrypted returns the name of the encrypted format the file whose first
+// bytes are head is in, if it is one with a signature, such as a LUKS
+// volume or a zip archive with encrypted entries, or "".
+func Encrypted(head []byte) string {
+	for _, m := range encryptedMagic {
+		if m.match(head) {
+			return m.format
+		}
+	}
+	// Bit 0 of a zip entry's flags is set if it is encrypted.
+	if len(head) >= 8 && string(head[:4]) == "PK\x03\x04" && binary.LittleEndian.Uint16(head[6:])&1 != 0 {
+		return "encrypted zip"
+	}
+	return ""
+}
@@ -0,0 +1,143 @@
+package content
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// HygieneSample is how much of the start of a text file Hygiene looks at.
+const HygieneSample = 1 << 20
+
+// TextInfo describes the conventions a text file follows.
+type TextInfo struct {
+	// Encoding is "ascii", "utf-8", "utf-16le", "utf-16be", "utf-32le",
+	// "utf-32be", or "8-bit" for text in a legacy single-byte encoding
+	// such as Latin-1 or Windows-1252, which can't be told apart.
+	Encoding string
+	// BOM is whether the text starts with a byte order mark.
+	BOM bool
+	// LineEndings is "lf", "crlf", "cr", "mixed" for more than one kind,
+	// or "none" for text without line breaks.
+	LineEndings string
+}
+
+// boms are the byte order marks and the encodings they stand for, longest
+// first since the UTF-32LE mark starts like the UTF-16LE one.
+var boms = []struct {
+	mark, encoding string
+}{
+	{"\xff\xfe\x00\x00", "utf-32le"},
+	{"\x00\x00\xfe\xff", "utf-32be"},
+	{"\xef\xbb\xbf", "utf-8"},
+	{"\xff\xfe", "utf-16le"},
+	{"\xfe\xff", "utf-16be"},
+}
+
+// Hygiene returns the encoding and line endings of sample, the start of a
+// file, or nil if it is binary. truncated says whether sample is only part
+// of the file, in which case it may end in the middle of a character.
+func Hygiene(sample []byte, truncated bool) *TextInfo {
+	info := &TextInfo{}
+	for _, b := range boms {
+		if bytes.HasPrefix(sample, []byte(b.mark)) {
+			info.Encoding, info.BOM = b.encoding, true
+			sample = sample[len(b.mark):]
+			break
+		}
+	}
+	switch info.Encoding {
+	case "utf-16le", "utf-16be":
+		var order binary.ByteOrder = binary.LittleEndian
+		if info.Encoding == "utf-16be" {
+			order = binary.BigEndian
+		}
+		units := make([]uint16, len(sample)/2)
+		for i := range units {
+			units[i] = order.Uint16(sample[i*2:])
+		}
+		sample = []byte(string(utf16.Decode(units)))
+	case "utf-32le", "utf-32be":
+		var order binary.ByteOrder = binary.LittleEndian
+		if info.Encoding == "utf-32be" {
+			order = binary.BigEndian
+		}
+		var buf []byte
+		for i := 0; i+4 <= len(sample); i += 4 {
+			buf = utf8.AppendRune(buf, rune(order.Uint32(sample[i:])))
+		}
+		sample = buf
+	case "":
+		if IsBinary(sample) {
+			return nil
+		}
+		info.Encoding = encoding(sample, truncated)
+	}
+	info.LineEndings = lineEndings(sample)
+	return info
+}
+
+// encoding tells ASCII, UTF-8 and other 8-bit text apart.
+func encoding(sample []byte, truncated bool) string {
+	ascii := true
+	for _, c := range sample {
+		if c >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return "ascii"
+	}
+	if truncated {
+		// Drop a character cut off at the end of the sample.
+		for i := 1; i <= utf8.UTFMax && i <= len(sample); i++ {
+			if utf8.RuneStart(sample[len(sample)-i]) {
+				if !utf8.FullRune(sample[len(sample)-i:]) {
+					sample = sample[:len(sample)-i]
+				}
+				break
+			}
+		}
+	}
+	if utf8.Valid(sample) {
+		return "utf-8"
+	}
+	return "8-bit"
+}
+
+// lineEndings classifies the line breaks in text.
+func lineEndings(text []byte) string {
+	var lf, crlf, cr int
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\n':
+			lf++
+		case '\r':
+			if i+1 < len(text) && text[i+1] == '\n' {
+				crlf++
+				i++
+			} else if i+1 < len(text) {
+				cr++
+			}
+			// A CR at the very end of a sample may be the first half of a
+			// CRLF; it is not counted either way.
+		}
+	}
+	kinds := 0
+	kind := "none"
+	for _, k := range []struct {
+		name string
+		n    int
+	}{{"lf", lf}, {"crlf", crlf}, {"cr", cr}} {
+		if k.n > 0 {
+			kinds++
+			kind = k.name
+		}
+	}
+	if kinds > 1 {
+		return "mixed"
+	}
+	return kind
+}
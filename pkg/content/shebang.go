@@ -0,0 +1,50 @@
+package content
+
+import (
+	"bytes"
+	"path"
+	"strings"
+)
+
+// ShebangSample is how much of a file Shebang needs: the longest #! line
+// Linux reads.
+const ShebangSample = 256
+
+// Interpreter is the program a script's #! line runs it with.
+type Interpreter struct {
+	// Name is the interpreter's file name, such as "bash" or "python3".
+	Name string
+	// Path is the interpreter as the #! line names it, such as "/bin/bash"
+	// or "/usr/bin/env python3".
+	Path string
+}
+
+// Shebang returns the interpreter named by the #! line at the start of head,
+// or nil if there is none. Scripts run through env are attributed to the
+// program env runs, skipping its options and variable assignments.
+func Shebang(head []byte) *Interpreter {
+	line, ok := bytes.CutPrefix(head, []byte("#!"))
+	if !ok {
+		return nil
+	}
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return nil
+	}
+	interp := &Interpreter{Name: path.Base(fields[0]), Path: fields[0]}
+	if interp.Name != "env" {
+		return interp
+	}
+	for _, arg := range fields[1:] {
+		if strings.HasPrefix(arg, "-") || strings.Contains(arg, "=") {
+			continue
+		}
+		interp.Name = path.Base(arg)
+		interp.Path += " " + arg
+		break
+	}
+	return interp
+}
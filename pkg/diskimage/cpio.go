@@ -0,0 +1,219 @@
+package diskimage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+)
+
+// compressors maps the magic numbers of compressed initramfs segments to
+// the command used to decompress them when the standard library can't.
+var compressors = []struct {
+	magic   []byte
+	name    string
+	command []string
+}{
+	{[]byte{0x1f, 0x8b}, "gzip", nil},
+	{[]byte("BZh"), "bzip2", nil},
+	{[]byte{0xfd, '7', 'z', 'X', 'Z', 0}, "xz", []string{"xz", "-dc"}},
+	{[]byte{0x28, 0xb5, 0x2f, 0xfd}, "zstd", []string{"zstd", "-dc"}},
+	{[]byte{0x02, 0x21, 0x4c, 0x18}, "lz4", []string{"lz4", "-dc"}},
+	{[]byte{0x5d, 0, 0}, "lzma", []string{"xz", "--format=lzma", "-dc"}},
+}
+
+// isCPIO reports whether head starts a new ASCII ("070701", "070702") or
+// portable ("070707") cpio archive, possibly compressed.
+func isCPIO(head []byte) bool {
+	if len(head) >= 6 && (bytes.Equal(head[:6], []byte("070701")) || bytes.Equal(head[:6], []byte("070702")) || bytes.Equal(head[:6], []byte("070707"))) {
+		return true
+	}
+	if len(head) >= 2 && head[0] == 0x1f && head[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(head))
+		if err != nil {
+			return false
+		}
+		inner := make([]byte, 6)
+		n, _ := io.ReadFull(zr, inner)
+		return n == 6 && isCPIO(inner)
+	}
+	return false
+}
+
+// countCPIO counts the entries of a cpio archive. Like the Linux kernel,
+// it accepts several archives back to back, separated by zero padding and
+// each optionally compressed, as in initramfs images that carry an
+// uncompressed microcode archive in front of the compressed root.
+func countCPIO(r io.Reader) (Totals, error) {
+	t := Totals{Dirs: 1}
+	br := bufio.NewReaderSize(r, 64*1024)
+	for {
+		// Skip the padding between archives.
+		for {
+			b, err := br.ReadByte()
+			if err == io.EOF {
+				return t, nil
+			}
+			if err != nil {
+				return t, err
+			}
+			if b != 0 {
+				br.UnreadByte()
+				break
+			}
+		}
+
+		head, _ := br.Peek(6)
+		if bytes.HasPrefix(head, []byte("0707")) {
+			if err := readCPIO(br, &t); err != nil {
+				return t, err
+			}
+			continue
+		}
+		if err := countCompressed(br, head, &t); err != nil {
+			return t, err
+		}
+	}
+}
+
+// countCompressed decompresses one segment from br and counts the archives
+// in it. gzip and bzip2 segments are decompressed in-process; the others
+// need the matching command-line tool and consume the rest of the input.
+func countCompressed(br *bufio.Reader, head []byte, t *Totals) error {
+	for _, c := range compressors {
+		if !bytes.HasPrefix(head, c.magic) {
+			continue
+		}
+		var inner io.Reader
+		switch c.name {
+		case "gzip":
+			zr, err := gzip.NewReader(br)
+			if err != nil {
+				return err
+			}
+			// Stop at the end of this member; what follows may not be gzip.
+			zr.Multistream(false)
+			inner = zr
+		case "bzip2":
+			inner = bzip2.NewReader(br)
+		default:
+			if _, err := exec.LookPath(c.command[0]); err != nil {
+				return fmt.Errorf("%s-compressed archive needs the %s command", c.name, c.command[0])
+			}
+			cmd := exec.Command(c.command[0], c.command[1:]...)
+			cmd.Stdin = br
+			out, err := cmd.StdoutPipe()
+			if err != nil {
+				return err
+			}
+			if err := cmd.Start(); err != nil {
+				return err
+			}
+			sub, err := countCPIO(out)
+			io.Copy(io.Discard, out)
+			if werr := cmd.Wait(); err == nil && werr != nil {
+				err = fmt.Errorf("%s: %w", c.command[0], werr)
+			}
+			t.add(sub)
+			return err
+		}
+		sub, err := countCPIO(inner)
+		t.add(sub)
+		return err
+	}
+	return fmt.Errorf("unrecognised data in archive (% x)", head)
+}
+
+func (t *Totals) add(sub Totals) {
+	t.Files += sub.Files
+	t.Dirs += sub.Dirs - 1 // each archive counted its own root
+	t.Bytes += sub.Bytes
+}
+
+// readCPIO reads one archive up to its TRAILER!!! entry.
+func readCPIO(br *bufio.Reader, t *Totals) error {
+	for {
+		magic := make([]byte, 6)
+		if _, err := io.ReadFull(br, magic); err != nil {
+			return fmt.Errorf("reading cpio header: %w", err)
+		}
+
+		var mode, size, nameSize int64
+		var hdrLen int64
+		var err error
+		switch string(magic) {
+		case "070701", "070702":
+			hdr := make([]byte, 104)
+			if _, err = io.ReadFull(br, hdr); err != nil {
+				return fmt.Errorf("reading cpio header: %w", err)
+			}
+			field := func(i int) int64 {
+				v, perr := strconv.ParseInt(string(hdr[8*i:8*i+8]), 16, 64)
+				if perr != nil && err == nil {
+					err = errors.New("corrupt cpio header")
+				}
+				return v
+			}
+			mode, size, nameSize = field(1), field(6), field(11)
+			hdrLen = 110
+		case "070707":
+			hdr := make([]byte, 70)
+			if _, err = io.ReadFull(br, hdr); err != nil {
+				return fmt.Errorf("reading cpio header: %w", err)
+			}
+			field := func(off, n int) int64 {
+				v, perr := strconv.ParseInt(string(hdr[off:off+n]), 8, 64)
+				if perr != nil && err == nil {
+					err = errors.New("corrupt cpio header")
+				}
+				return v
+			}
+			mode, nameSize, size = field(12, 6), field(53, 6), field(59, 11)
+		default:
+			return fmt.Errorf("unsupported cpio format %q", magic)
+		}
+		if err != nil {
+			return err
+		}
+		if nameSize <= 0 || nameSize > 1<<16 || size < 0 {
+			return errors.New("corrupt cpio header")
+		}
+
+		name := make([]byte, nameSize)
+		if _, err := io.ReadFull(br, name); err != nil {
+			return fmt.Errorf("reading cpio name: %w", err)
+		}
+		name = bytes.TrimRight(name, "\x00")
+		dataPad, namePad := int64(0), int64(0)
+		if hdrLen > 0 {
+			// newc pads the name and the data to four bytes.
+			namePad = (4 - (hdrLen+nameSize)%4) % 4
+			dataPad = (4 - size%4) % 4
+		}
+		if _, err := br.Discard(int(namePad)); err != nil {
+			return err
+		}
+		if string(name) == "TRAILER!!!" {
+			return nil
+		}
+		if _, err := io.CopyN(io.Discard, br, size+dataPad); err != nil {
+			return fmt.Errorf("reading %s: %w", name, err)
+		}
+
+		switch {
+		case string(name) == "." || string(name) == "./":
+		case mode&0o170000 == 0o040000:
+			t.Dirs++
+		case mode&0o170000 == 0o100000:
+			t.Files++
+			t.Bytes += size
+		default:
+			t.Files++
+		}
+	}
+}
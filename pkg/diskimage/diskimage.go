@@ -0,0 +1,242 @@
+// Package diskimage counts the files in disk images without mounting them.
+// Raw and qcow2 images are read through their MBR or GPT partition table;
+// ISO9660, FAT, ext2/3/4 and squashfs filesystems are understood, as are
+// cpio archives such as initramfs images.
+package diskimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Totals are the counts of one filesystem.
+type Totals struct {
+	Files int64
+	Dirs  int64
+	Bytes int64
+}
+
+// Partition is one filesystem found in an image. Offset and Size are in
+// bytes from the start of the virtual disk. Err is set when the
+// filesystem is unsupported or could not be read.
+type Partition struct {
+	Index  int
+	Offset int64
+	Size   int64
+	FSType string
+	Totals
+	Err error
+}
+
+// Result describes a scanned image. Format is "raw" or "qcow2" and Size the
+// virtual disk size.
+type Result struct {
+	Format     string
+	Size       int64
+	Partitions []Partition
+}
+
+// Scan opens the image at path read-only and counts every filesystem in it.
+func Scan(path string) (*Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return ScanReader(f, info.Size())
+}
+
+// ScanReader is Scan for an image already open as r, size bytes long.
+func ScanReader(r io.ReaderAt, size int64) (*Result, error) {
+	res := &Result{Format: "raw", Size: size}
+	var magic [4]byte
+	if _, err := r.ReadAt(magic[:], 0); err == nil && bytes.Equal(magic[:], qcow2Magic) {
+		q, err := openQcow2(r)
+		if err != nil {
+			return nil, err
+		}
+		res.Format, res.Size, r = "qcow2", q.size, q
+	}
+
+	// A filesystem that starts at sector 0 has no partition table, although
+	// FAT boot sectors carry the same 0x55AA signature as an MBR.
+	if fs := detect(r, 0, res.Size); fs != "" {
+		res.Partitions = []Partition{count(r, Partition{Index: 0, Size: res.Size, FSType: fs})}
+		return res, nil
+	}
+	parts, err := partitions(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range parts {
+		p.FSType = detect(r, p.Offset, p.Size)
+		res.Partitions = append(res.Partitions, count(r, p))
+	}
+	return res, nil
+}
+
+// Filesystems lists the filesystems whose files can be counted.
+var Filesystems = []string{"ext2", "ext3", "ext4", "fat12", "fat16", "fat32", "iso9660", "squashfs", "cpio"}
+
+// count fills in the totals of p.
+func count(r io.ReaderAt, p Partition) Partition {
+	sr := io.NewSectionReader(r, p.Offset, p.Size)
+	switch p.FSType {
+	case "iso9660":
+		p.Totals, p.Err = countISO9660(sr)
+	case "fat12", "fat16", "fat32":
+		p.Totals, p.Err = countFAT(sr)
+	case "ext2", "ext3", "ext4":
+		p.Totals, p.Err = countExt(sr)
+	case "squashfs":
+		p.Totals, p.Err = countSquashfs(sr)
+	case "cpio":
+		p.Totals, p.Err = countCPIO(sr)
+	case "":
+		p.Err = errors.New("unrecognised filesystem")
+	default:
+		p.Err = fmt.Errorf("%s is not supported", p.FSType)
+	}
+	return p
+}
+
+// detect names the filesystem at off, or returns "" if it isn't known.
+func detect(r io.ReaderAt, off, size int64) string {
+	buf := make([]byte, 4096)
+	n, _ := r.ReadAt(buf, off)
+	buf = buf[:n]
+	switch {
+	case bytes.HasPrefix(buf, squashfsMagic):
+		return "squashfs"
+	case isCPIO(buf):
+		return "cpio"
+	}
+	if len(buf) < 1536 {
+		return ""
+	}
+	if binary.LittleEndian.Uint16(buf[1024+56:]) == extMagic {
+		return extVersion(buf[1024:])
+	}
+	switch {
+	case bytes.Equal(buf[3:11], []byte("NTFS    ")):
+		return "ntfs"
+	case bytes.Equal(buf[0:4], []byte("XFSB")):
+		return "xfs"
+	case bytes.Equal(buf[3:8], []byte("EXFAT")):
+		return "exfat"
+	}
+	if fat := fatType(buf); fat != "" {
+		return fat
+	}
+
+	var pvd [6]byte
+	if size > 16*isoSector+6 {
+		if _, err := r.ReadAt(pvd[:], off+16*isoSector); err == nil && bytes.Equal(pvd[1:6], []byte("CD001")) {
+			return "iso9660"
+		}
+	}
+	var btrfs [8]byte
+	if _, err := r.ReadAt(btrfs[:], off+0x10040); err == nil && bytes.Equal(btrfs[:], []byte("_BHRfS_M")) {
+		return "btrfs"
+	}
+	return ""
+}
+
+// partitions reads a GPT, or else an MBR with its logical partitions.
+func partitions(r io.ReaderAt) ([]Partition, error) {
+	for _, sector := range []int64{512, 4096} {
+		if parts, ok, err := readGPT(r, sector); ok || err != nil {
+			return parts, err
+		}
+	}
+
+	mbr := make([]byte, 512)
+	if _, err := r.ReadAt(mbr, 0); err != nil {
+		return nil, fmt.Errorf("reading partition table: %w", err)
+	}
+	if mbr[510] != 0x55 || mbr[511] != 0xaa {
+		return nil, errors.New("no partition table or known filesystem found")
+	}
+	var parts []Partition
+	for i := 0; i < 4; i++ {
+		e := mbr[446+16*i:]
+		kind := e[4]
+		start := int64(binary.LittleEndian.Uint32(e[8:])) * 512
+		length := int64(binary.LittleEndian.Uint32(e[12:])) * 512
+		switch {
+		case kind == 0 || length == 0:
+		case kind == 0x05 || kind == 0x0f || kind == 0x85:
+			logical, err := readEBR(r, start)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, logical...)
+		default:
+			parts = append(parts, Partition{Index: i + 1, Offset: start, Size: length})
+		}
+	}
+	return parts, nil
+}
+
+// readEBR follows the chain of extended boot records starting at base.
+// Logical partitions are numbered from 5, as Linux does.
+func readEBR(r io.ReaderAt, base int64) ([]Partition, error) {
+	var parts []Partition
+	ebr := make([]byte, 512)
+	for next, index := base, 5; ; index++ {
+		if _, err := r.ReadAt(ebr, next); err != nil {
+			return nil, fmt.Errorf("reading extended partition: %w", err)
+		}
+		if ebr[510] != 0x55 || ebr[511] != 0xaa || index > 5+128 {
+			return parts, nil
+		}
+		start := int64(binary.LittleEndian.Uint32(ebr[446+8:])) * 512
+		length := int64(binary.LittleEndian.Uint32(ebr[446+12:])) * 512
+		if length > 0 {
+			parts = append(parts, Partition{Index: index, Offset: next + start, Size: length})
+		}
+		link := int64(binary.LittleEndian.Uint32(ebr[462+8:])) * 512
+		if link == 0 {
+			return parts, nil
+		}
+		next = base + link
+	}
+}
+
+// readGPT reads a GUID partition table whose header is at LBA 1 for the
+// given sector size. ok is false when there is none.
+func readGPT(r io.ReaderAt, sector int64) (parts []Partition, ok bool, err error) {
+	hdr := make([]byte, 92)
+	if _, err := r.ReadAt(hdr, sector); err != nil || !bytes.Equal(hdr[:8], []byte("EFI PART")) {
+		return nil, false, nil
+	}
+	entriesLBA := int64(binary.LittleEndian.Uint64(hdr[72:]))
+	count := int(binary.LittleEndian.Uint32(hdr[80:]))
+	entrySize := int(binary.LittleEndian.Uint32(hdr[84:]))
+	if entrySize < 128 || count > 1024 {
+		return nil, true, errors.New("invalid GPT header")
+	}
+
+	table := make([]byte, count*entrySize)
+	if _, err := r.ReadAt(table, entriesLBA*sector); err != nil {
+		return nil, true, fmt.Errorf("reading GPT entries: %w", err)
+	}
+	for i := 0; i < count; i++ {
+		e := table[i*entrySize:]
+		if bytes.Equal(e[:16], make([]byte, 16)) {
+			continue
+		}
+		first := int64(binary.LittleEndian.Uint64(e[32:]))
+		last := int64(binary.LittleEndian.Uint64(e[40:]))
+		parts = append(parts, Partition{Index: i + 1, Offset: first * sector, Size: (last - first + 1) * sector})
+	}
+	return parts, true, nil
+}
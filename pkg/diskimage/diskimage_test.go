@@ -0,0 +1,322 @@
+package diskimage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// floppy returns a 1.44 MB FAT12 image holding README.TXT (10 bytes) and
+// DOCS/NOTES.TXT (700 bytes, two clusters), plus a deleted entry and a
+// long-name entry that must be ignored.
+func floppy() []byte {
+	img := make([]byte, 2880*512)
+	le := binary.LittleEndian
+	copy(img[3:], "MSDOS5.0")
+	le.PutUint16(img[11:], 512)
+	img[13] = 1
+	le.PutUint16(img[14:], 1)
+	img[16] = 2
+	le.PutUint16(img[17:], 224)
+	le.PutUint16(img[19:], 2880)
+	le.PutUint16(img[22:], 9)
+	img[510], img[511] = 0x55, 0xaa
+
+	// Chains: 2 (README), 3 (DOCS), 4 -> 5 (NOTES).
+	fat := make([]uint16, 8)
+	fat[0], fat[1], fat[2], fat[3], fat[4], fat[5] = 0xff0, 0xfff, 0xfff, 0xfff, 5, 0xfff
+	for copyIdx := 0; copyIdx < 2; copyIdx++ {
+		base := 512 + copyIdx*9*512
+		for c := 0; c < len(fat); c += 2 {
+			off := base + c*3/2
+			img[off] = byte(fat[c])
+			img[off+1] = byte(fat[c]>>8&0x0f) | byte(fat[c+1]<<4)
+			img[off+2] = byte(fat[c+1] >> 4)
+		}
+	}
+
+	entry := func(at int, name string, attr byte, cluster uint16, size uint32) {
+		copy(img[at:at+11], name)
+		img[at+11] = attr
+		le.PutUint16(img[at+26:], cluster)
+		le.PutUint32(img[at+28:], size)
+	}
+	root := 19 * 512
+	entry(root, "FLOPPY     ", 0x08, 0, 0)
+	entry(root+32, "README  TXT", 0x20, 2, 10)
+	entry(root+64, "\xe5OLD    TXT", 0x20, 0, 99)
+	entry(root+96, "A          ", 0x0f, 0, 0)
+	entry(root+128, "DOCS       ", 0x10, 3, 0)
+	docs := 33*512 + 512
+	entry(docs, ".          ", 0x10, 3, 0)
+	entry(docs+32, "..         ", 0x10, 0, 0)
+	entry(docs+64, "NOTES   TXT", 0x20, 4, 700)
+	return img
+}
+
+// iso returns an ISO9660 image with /A.TXT (5 bytes), /SUB/B.TXT (3000
+// bytes) and /SUB/C.BIN recorded in two extents of 2048 and 100 bytes.
+func iso() []byte {
+	img := make([]byte, 24*isoSector)
+	le := binary.LittleEndian
+	record := func(name string, lba, size uint32, flags byte) []byte {
+		r := make([]byte, 33+len(name)+(1-len(name)%2))
+		r[0] = byte(len(r))
+		le.PutUint32(r[2:], lba)
+		le.PutUint32(r[10:], size)
+		r[25] = flags
+		r[32] = byte(len(name))
+		copy(r[33:], name)
+		return r
+	}
+	dir := func(sector int, records ...[]byte) {
+		pos := sector * isoSector
+		for _, r := range records {
+			pos += copy(img[pos:], r)
+		}
+	}
+
+	pvd := img[16*isoSector:]
+	pvd[0] = 1
+	copy(pvd[1:], "CD001")
+	copy(pvd[156:], record("\x00", 18, isoSector, 2))
+	img[17*isoSector] = 255
+	copy(img[17*isoSector+1:], "CD001")
+
+	dir(18, record("\x00", 18, isoSector, 2), record("\x01", 18, isoSector, 2),
+		record("A.TXT;1", 20, 5, 0), record("SUB", 19, isoSector, 2))
+	dir(19, record("\x00", 19, isoSector, 2), record("\x01", 18, isoSector, 2),
+		record("B.TXT;1", 21, 3000, 0), record("C.BIN;1", 22, 2048, 0x80), record("C.BIN;1", 23, 100, 0))
+	return img
+}
+
+// qcow2Image wraps raw in a qcow2 v2 container with 4 KB clusters,
+// allocating only the clusters that aren't all zeros.
+func qcow2Image(raw []byte) []byte {
+	const clusterBits, cluster = 12, 4096
+	perL2 := cluster / 8
+	clusters := (len(raw) + cluster - 1) / cluster
+	l2Tables := (clusters + perL2 - 1) / perL2
+
+	be := binary.BigEndian
+	img := make([]byte, (2+l2Tables)*cluster)
+	copy(img, qcow2Magic)
+	be.PutUint32(img[4:], 2)
+	be.PutUint32(img[20:], clusterBits)
+	be.PutUint64(img[24:], uint64(len(raw)))
+	be.PutUint32(img[36:], uint32(l2Tables))
+	be.PutUint64(img[40:], cluster)
+	for t := 0; t < l2Tables; t++ {
+		be.PutUint64(img[cluster+8*t:], uint64((2+t)*cluster))
+	}
+	for c := 0; c < clusters; c++ {
+		data := raw[c*cluster : min((c+1)*cluster, len(raw))]
+		if bytes.Count(data, []byte{0}) == len(data) {
+			continue
+		}
+		be.PutUint64(img[(2+c/perL2)*cluster+8*(c%perL2):], uint64(len(img)))
+		padded := make([]byte, cluster)
+		copy(padded, data)
+		img = append(img, padded...)
+	}
+	return img
+}
+
+// withMBR puts fs in the first MBR partition, 1 MB into the disk.
+func withMBR(fs []byte) []byte {
+	img := make([]byte, 1<<20+len(fs))
+	copy(img[1<<20:], fs)
+	e := img[446:]
+	e[4] = 0x0c
+	binary.LittleEndian.PutUint32(e[8:], 2048)
+	binary.LittleEndian.PutUint32(e[12:], uint32(len(fs)/512))
+	img[510], img[511] = 0x55, 0xaa
+	return img
+}
+
+// squashfsImage returns a squashfs image with /a (5 bytes), /link and
+// /sub/b (70000 bytes, in an extended inode). The inode table is stored
+// uncompressed and the directory table zlib-compressed.
+func squashfsImage() []byte {
+	le := binary.LittleEndian
+	inodes := make([]byte, 152+32)
+	inode := func(at int, kind uint16) []byte {
+		le.PutUint16(inodes[at:], kind)
+		return inodes[at:]
+	}
+	le.PutUint32(inode(32, 2)[28:], 5)
+	le.PutUint64(inode(96, 9)[24:], 70000)
+	inode(152, 3)
+
+	var dirs []byte
+	listing := func(entries ...any) (offset, size int) {
+		offset = len(dirs)
+		dirs = le.AppendUint32(dirs, uint32(len(entries)/3-1))
+		dirs = le.AppendUint32(dirs, 0)
+		dirs = le.AppendUint32(dirs, 1)
+		for i := 0; i < len(entries); i += 3 {
+			name := entries[i].(string)
+			dirs = le.AppendUint16(dirs, uint16(entries[i+1].(int)))
+			dirs = le.AppendUint16(dirs, 0)
+			dirs = le.AppendUint16(dirs, uint16(entries[i+2].(int)))
+			dirs = le.AppendUint16(dirs, uint16(len(name)-1))
+			dirs = append(dirs, name...)
+		}
+		return offset, len(dirs) - offset + 3
+	}
+	rootOff, rootSize := listing("a", 32, 2, "link", 152, 3, "sub", 64, 1)
+	subOff, subSize := listing("b", 96, 2)
+	root, sub := inode(0, 1), inode(64, 1)
+	le.PutUint16(root[24:], uint16(rootSize))
+	le.PutUint16(root[26:], uint16(rootOff))
+	le.PutUint16(sub[24:], uint16(subSize))
+	le.PutUint16(sub[26:], uint16(subOff))
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(dirs)
+	zw.Close()
+
+	img := make([]byte, 96)
+	copy(img, squashfsMagic)
+	le.PutUint16(img[20:], 1)
+	le.PutUint16(img[28:], 4)
+	le.PutUint64(img[64:], 96)
+	img = le.AppendUint16(img, uint16(len(inodes))|0x8000)
+	img = append(img, inodes...)
+	le.PutUint64(img[72:], uint64(len(img)))
+	img = le.AppendUint16(img, uint16(compressed.Len()))
+	img = append(img, compressed.Bytes()...)
+	return append(img, make([]byte, 4096)...)
+}
+
+// cpioArchive returns a newc archive holding the given entries, each a
+// name and mode, with file contents of size bytes.
+func cpioArchive(size int, entries ...any) []byte {
+	var buf bytes.Buffer
+	pad := func() {
+		for buf.Len()%4 != 0 {
+			buf.WriteByte(0)
+		}
+	}
+	add := func(name string, mode, size int) {
+		fmt.Fprintf(&buf, "070701%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+			0, mode, 0, 0, 1, 0, size, 0, 0, 0, 0, len(name)+1, 0)
+		buf.WriteString(name + "\x00")
+		pad()
+		buf.Write(make([]byte, size))
+		pad()
+	}
+	for i := 0; i < len(entries); i += 2 {
+		mode := entries[i+1].(int)
+		n := 0
+		if mode&0o170000 == 0o100000 {
+			n = size
+		}
+		add(entries[i].(string), mode, n)
+	}
+	add("TRAILER!!!", 0, 0)
+	return buf.Bytes()
+}
+
+func scanBytes(t *testing.T, img []byte) *Result {
+	t.Helper()
+	res, err := ScanReader(bytes.NewReader(img), int64(len(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func checkPartition(t *testing.T, res *Result, fstype string, want Totals) {
+	t.Helper()
+	if len(res.Partitions) != 1 {
+		t.Fatalf("Expected one partition, got %+v", res.Partitions)
+	}
+	p := res.Partitions[0]
+	if p.Err != nil {
+		t.Fatalf("%s: %v", p.FSType, p.Err)
+	}
+	if p.FSType != fstype || p.Totals != want {
+		t.Errorf("Got %s %+v, expected %s %+v", p.FSType, p.Totals, fstype, want)
+	}
+}
+
+func TestFAT(t *testing.T) {
+	want := Totals{Files: 2, Dirs: 2, Bytes: 710}
+	checkPartition(t, scanBytes(t, floppy()), "fat12", want)
+
+	res := scanBytes(t, withMBR(floppy()))
+	checkPartition(t, res, "fat12", want)
+	if p := res.Partitions[0]; p.Index != 1 || p.Offset != 1<<20 {
+		t.Errorf("Unexpected partition placement %+v", p)
+	}
+}
+
+func TestISO9660(t *testing.T) {
+	checkPartition(t, scanBytes(t, iso()), "iso9660", Totals{Files: 3, Dirs: 2, Bytes: 5153})
+}
+
+func TestQcow2(t *testing.T) {
+	res := scanBytes(t, qcow2Image(withMBR(floppy())))
+	if res.Format != "qcow2" || res.Size != 1<<20+2880*512 {
+		t.Errorf("Got %s image of %d bytes", res.Format, res.Size)
+	}
+	checkPartition(t, res, "fat12", Totals{Files: 2, Dirs: 2, Bytes: 710})
+}
+
+func TestExt(t *testing.T) {
+	if _, err := exec.LookPath("mke2fs"); err != nil {
+		t.Skip("mke2fs not installed")
+	}
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "a", "b"), 0755)
+	os.WriteFile(filepath.Join(src, "a", "one"), []byte("12345"), 0644)
+	os.WriteFile(filepath.Join(src, "a", "b", "two"), make([]byte, 70000), 0644)
+	os.Symlink("one", filepath.Join(src, "a", "link"))
+
+	for _, fstype := range []string{"ext2", "ext4"} {
+		img := filepath.Join(t.TempDir(), fstype+".img")
+		if out, err := exec.Command("mke2fs", "-q", "-F", "-t", fstype, "-b", "1024", "-d", src, img, "4M").CombinedOutput(); err != nil {
+			t.Skipf("mke2fs failed: %v: %s", err, out)
+		}
+		res, err := Scan(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// lost+found is a real directory on the image.
+		checkPartition(t, res, fstype, Totals{Files: 3, Dirs: 4, Bytes: 70005})
+	}
+}
+
+func TestSquashfs(t *testing.T) {
+	checkPartition(t, scanBytes(t, squashfsImage()), "squashfs", Totals{Files: 3, Dirs: 2, Bytes: 70005})
+}
+
+func TestCPIO(t *testing.T) {
+	microcode := cpioArchive(10, "kernel", 0o40755, "kernel/x86", 0o40755, "kernel/x86/microcode.bin", 0o100644)
+	root := cpioArchive(3, ".", 0o40755, "init", 0o100755, "bin", 0o40755, "bin/sh", 0o120777)
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(root)
+	zw.Close()
+
+	checkPartition(t, scanBytes(t, root), "cpio", Totals{Files: 2, Dirs: 2, Bytes: 3})
+	checkPartition(t, scanBytes(t, compressed.Bytes()), "cpio", Totals{Files: 2, Dirs: 2, Bytes: 3})
+
+	// An early microcode archive, padding, then the compressed root.
+	initramfs := append(append(microcode, make([]byte, 512)...), compressed.Bytes()...)
+	checkPartition(t, scanBytes(t, initramfs), "cpio", Totals{Files: 3, Dirs: 4, Bytes: 13})
+}
+
+func TestUnknownImage(t *testing.T) {
+	if _, err := ScanReader(bytes.NewReader(make([]byte, 8192)), 8192); err == nil {
+		t.Error("Expected an error for an image with no partition table or filesystem")
+	}
+}
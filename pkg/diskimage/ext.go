@@ -0,0 +1,302 @@
+package diskimage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	extMagic = 0xef53
+
+	extRootInode = 2
+
+	extFeatureJournal    = 0x4   // compat
+	extFeatureExtents    = 0x40  // incompat
+	extFeature64Bit      = 0x80  // incompat
+	extFeatureFlexBG     = 0x200 // incompat
+	extFeatureHugeFile   = 0x8   // ro_compat
+	extInodeExtents      = 0x80000
+	extInodeInlineData   = 0x10000000
+	extExtentHeaderMagic = 0xf30a
+)
+
+// extVersion tells ext2, ext3 and ext4 apart by their feature flags.
+func extVersion(sb []byte) string {
+	le := binary.LittleEndian
+	incompat := le.Uint32(sb[96:])
+	switch {
+	case incompat&(extFeatureExtents|extFeature64Bit|extFeatureFlexBG) != 0 || le.Uint32(sb[100:])&extFeatureHugeFile != 0:
+		return "ext4"
+	case le.Uint32(sb[92:])&extFeatureJournal != 0:
+		return "ext3"
+	}
+	return "ext2"
+}
+
+type extFS struct {
+	r              io.ReaderAt
+	blockSize      int64
+	inodeSize      int64
+	inodesPerGroup uint32
+	inodeCount     uint32
+	descSize       int64
+	gdtOffset      int64
+	tables         map[uint32]int64 // group -> inode table offset
+}
+
+// countExt walks an ext2/3/4 filesystem from its root directory, reading
+// inodes for the sizes. Hard-linked files count once per link, as in a
+// scan without -dedup-hardlinks.
+func countExt(r io.ReaderAt) (Totals, error) {
+	t := Totals{Dirs: 1}
+	sb := make([]byte, 1024)
+	if _, err := r.ReadAt(sb, 1024); err != nil {
+		return t, fmt.Errorf("reading superblock: %w", err)
+	}
+	le := binary.LittleEndian
+	fs := &extFS{
+		r:              r,
+		blockSize:      1024 << le.Uint32(sb[24:]),
+		inodeCount:     le.Uint32(sb[0:]),
+		inodesPerGroup: le.Uint32(sb[40:]),
+		inodeSize:      128,
+		descSize:       32,
+		tables:         make(map[uint32]int64),
+	}
+	if le.Uint32(sb[76:]) >= 1 {
+		fs.inodeSize = int64(le.Uint16(sb[88:]))
+	}
+	if le.Uint32(sb[96:])&extFeature64Bit != 0 {
+		fs.descSize = int64(le.Uint16(sb[254:]))
+	}
+	if fs.blockSize > 65536 || fs.inodesPerGroup == 0 || fs.inodeSize < 128 || fs.descSize < 32 {
+		return t, errors.New("invalid ext superblock")
+	}
+	// The group descriptors follow the block holding the superblock.
+	fs.gdtOffset = (1024/fs.blockSize + 1) * fs.blockSize
+
+	stack := []uint32{extRootInode}
+	seen := map[uint32]bool{extRootInode: true}
+	for len(stack) > 0 {
+		ino := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		inode, err := fs.inode(ino)
+		if err != nil {
+			return t, err
+		}
+		data, err := fs.contents(inode)
+		if err != nil {
+			return t, fmt.Errorf("reading directory inode %d: %w", ino, err)
+		}
+
+		for pos := 0; pos+8 <= len(data); {
+			child := le.Uint32(data[pos:])
+			recLen := int(le.Uint16(data[pos+4:]))
+			nameLen := int(data[pos+6])
+			if recLen < 8 || pos+recLen > len(data) {
+				break
+			}
+			name := data[pos+8 : min(pos+8+nameLen, len(data))]
+			pos += recLen
+			if child == 0 || string(name) == "." || string(name) == ".." {
+				continue
+			}
+
+			ci, err := fs.inode(child)
+			if err != nil {
+				return t, err
+			}
+			switch le.Uint16(ci[0:]) & 0xf000 {
+			case 0x4000:
+				t.Dirs++
+				if !seen[child] {
+					seen[child] = true
+					stack = append(stack, child)
+				}
+			case 0x8000:
+				t.Files++
+				t.Bytes += extSize(ci)
+			default:
+				t.Files++
+			}
+		}
+	}
+	return t, nil
+}
+
+func extSize(inode []byte) int64 {
+	le := binary.LittleEndian
+	return int64(le.Uint32(inode[108:]))<<32 | int64(le.Uint32(inode[4:]))
+}
+
+// inode reads inode number ino.
+func (fs *extFS) inode(ino uint32) ([]byte, error) {
+	if ino == 0 || ino > fs.inodeCount {
+		return nil, fmt.Errorf("invalid inode number %d", ino)
+	}
+	group := (ino - 1) / fs.inodesPerGroup
+	table, ok := fs.tables[group]
+	if !ok {
+		desc := make([]byte, fs.descSize)
+		if _, err := fs.r.ReadAt(desc, fs.gdtOffset+int64(group)*fs.descSize); err != nil {
+			return nil, fmt.Errorf("reading group descriptor %d: %w", group, err)
+		}
+		block := int64(binary.LittleEndian.Uint32(desc[8:]))
+		if fs.descSize >= 64 {
+			block |= int64(binary.LittleEndian.Uint32(desc[0x28:])) << 32
+		}
+		table = block * fs.blockSize
+		fs.tables[group] = table
+	}
+
+	buf := make([]byte, fs.inodeSize)
+	off := table + int64((ino-1)%fs.inodesPerGroup)*fs.inodeSize
+	if _, err := fs.r.ReadAt(buf, off); err != nil {
+		return nil, fmt.Errorf("reading inode %d: %w", ino, err)
+	}
+	return buf, nil
+}
+
+// contents reads the data of a (directory) inode.
+func (fs *extFS) contents(inode []byte) ([]byte, error) {
+	size := extSize(inode)
+	flags := binary.LittleEndian.Uint32(inode[32:])
+	iblock := inode[40:100]
+	if flags&extInodeInlineData != 0 {
+		// Entries follow the parent's inode number; any that spill into the
+		// extended attribute area are not read.
+		return iblock[4:], nil
+	}
+	if size > 1<<30 {
+		return nil, errors.New("directory too large")
+	}
+
+	n := (size + fs.blockSize - 1) / fs.blockSize
+	var blocks []int64
+	var err error
+	if flags&extInodeExtents != 0 {
+		blocks, err = fs.extentBlocks(iblock, 0)
+	} else {
+		blocks, err = fs.mappedBlocks(iblock, n)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, n*fs.blockSize)
+	for i := int64(0); i < n && i < int64(len(blocks)); i++ {
+		if blocks[i] == 0 {
+			continue // hole
+		}
+		if _, err := fs.r.ReadAt(data[i*fs.blockSize:(i+1)*fs.blockSize], blocks[i]*fs.blockSize); err != nil {
+			return nil, err
+		}
+	}
+	return data[:size], nil
+}
+
+// extentBlocks maps logical to physical blocks through an extent tree.
+func (fs *extFS) extentBlocks(node []byte, depth int) ([]int64, error) {
+	le := binary.LittleEndian
+	if le.Uint16(node) != extExtentHeaderMagic || depth > 5 {
+		return nil, errors.New("corrupt extent tree")
+	}
+	entries := int(le.Uint16(node[2:]))
+	leaf := le.Uint16(node[6:]) == 0
+	var blocks []int64
+	for i := 0; i < entries && 12+12*(i+1) <= len(node); i++ {
+		e := node[12+12*i:]
+		if !leaf {
+			child := int64(le.Uint16(e[8:]))<<32 | int64(le.Uint32(e[4:]))
+			buf := make([]byte, fs.blockSize)
+			if _, err := fs.r.ReadAt(buf, child*fs.blockSize); err != nil {
+				return nil, err
+			}
+			sub, err := fs.extentBlocks(buf, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			blocks = mergeBlocks(blocks, sub)
+			continue
+		}
+		logical := int64(le.Uint32(e[0:]))
+		length := int64(le.Uint16(e[4:]))
+		uninit := length > 32768
+		if uninit {
+			length -= 32768
+		}
+		start := int64(le.Uint16(e[6:]))<<32 | int64(le.Uint32(e[8:]))
+		for len(blocks) < int(logical+length) {
+			blocks = append(blocks, 0)
+		}
+		for j := int64(0); j < length; j++ {
+			if !uninit {
+				blocks[logical+j] = start + j
+			}
+		}
+	}
+	return blocks, nil
+}
+
+// mergeBlocks overlays the non-zero entries of b onto a.
+func mergeBlocks(a, b []int64) []int64 {
+	for len(a) < len(b) {
+		a = append(a, 0)
+	}
+	for i, v := range b {
+		if v != 0 {
+			a[i] = v
+		}
+	}
+	return a
+}
+
+// mappedBlocks maps the first n logical blocks to physical ones through
+// the direct and indirect block pointers of ext2/3.
+func (fs *extFS) mappedBlocks(iblock []byte, n int64) ([]int64, error) {
+	var blocks []int64
+	for i := 0; i < 12; i++ {
+		blocks = append(blocks, int64(binary.LittleEndian.Uint32(iblock[4*i:])))
+	}
+	for level := 1; level <= 3 && int64(len(blocks)) < n; level++ {
+		var err error
+		ptr := int64(binary.LittleEndian.Uint32(iblock[4*(11+level):]))
+		if blocks, err = fs.indirect(blocks, ptr, level, n); err != nil {
+			return nil, err
+		}
+	}
+	return blocks, nil
+}
+
+// indirect appends the blocks an indirect block of the given level maps,
+// stopping once blocks holds n entries. A zero pointer is a hole.
+func (fs *extFS) indirect(blocks []int64, ptr int64, level int, n int64) ([]int64, error) {
+	if ptr == 0 {
+		span := int64(1)
+		for i := 0; i < level; i++ {
+			span *= fs.blockSize / 4
+		}
+		for j := int64(0); j < span && int64(len(blocks)) < n; j++ {
+			blocks = append(blocks, 0)
+		}
+		return blocks, nil
+	}
+	buf := make([]byte, fs.blockSize)
+	if _, err := fs.r.ReadAt(buf, ptr*fs.blockSize); err != nil {
+		return nil, err
+	}
+	for i := int64(0); i < fs.blockSize/4 && int64(len(blocks)) < n; i++ {
+		child := int64(binary.LittleEndian.Uint32(buf[4*i:]))
+		if level == 1 {
+			blocks = append(blocks, child)
+			continue
+		}
+		var err error
+		if blocks, err = fs.indirect(blocks, child, level-1, n); err != nil {
+			return nil, err
+		}
+	}
+	return blocks, nil
+}
@@ -0,0 +1,202 @@
+package diskimage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// fatType recognises a FAT boot sector by its BIOS parameter block and
+// returns "fat12", "fat16" or "fat32".
+func fatType(boot []byte) string {
+	if boot[510] != 0x55 || boot[511] != 0xaa {
+		return ""
+	}
+	b, err := parseBPB(boot)
+	if err != nil {
+		return ""
+	}
+	return b.kind
+}
+
+type bpb struct {
+	kind              string
+	bytesPerSector    int64
+	sectorsPerCluster int64
+	fatOffset         int64
+	rootOffset        int64 // fixed root directory (FAT12/16)
+	rootEntries       int64
+	dataOffset        int64
+	rootCluster       uint32 // FAT32
+	clusters          uint32
+}
+
+func parseBPB(boot []byte) (*bpb, error) {
+	le := binary.LittleEndian
+	b := &bpb{
+		bytesPerSector:    int64(le.Uint16(boot[11:])),
+		sectorsPerCluster: int64(boot[13]),
+		rootEntries:       int64(le.Uint16(boot[17:])),
+	}
+	switch b.bytesPerSector {
+	case 512, 1024, 2048, 4096:
+	default:
+		return nil, errors.New("invalid sector size")
+	}
+	if b.sectorsPerCluster == 0 || b.sectorsPerCluster&(b.sectorsPerCluster-1) != 0 {
+		return nil, errors.New("invalid cluster size")
+	}
+	reserved := int64(le.Uint16(boot[14:]))
+	fats := int64(boot[16])
+	total := int64(le.Uint16(boot[19:]))
+	if total == 0 {
+		total = int64(le.Uint32(boot[32:]))
+	}
+	fatSize := int64(le.Uint16(boot[22:]))
+	if fatSize == 0 {
+		fatSize = int64(le.Uint32(boot[36:]))
+		b.rootCluster = le.Uint32(boot[44:])
+	}
+	if reserved == 0 || fats == 0 || fatSize == 0 || total == 0 {
+		return nil, errors.New("invalid BIOS parameter block")
+	}
+
+	rootSectors := (b.rootEntries*32 + b.bytesPerSector - 1) / b.bytesPerSector
+	b.fatOffset = reserved * b.bytesPerSector
+	b.rootOffset = (reserved + fats*fatSize) * b.bytesPerSector
+	b.dataOffset = b.rootOffset + rootSectors*b.bytesPerSector
+	dataSectors := total - reserved - fats*fatSize - rootSectors
+	if dataSectors <= 0 {
+		return nil, errors.New("invalid BIOS parameter block")
+	}
+	b.clusters = uint32(dataSectors / b.sectorsPerCluster)
+	switch {
+	case b.clusters < 4085:
+		b.kind = "fat12"
+	case b.clusters < 65525:
+		b.kind = "fat16"
+	default:
+		b.kind = "fat32"
+	}
+	if (b.kind == "fat32") != (b.rootEntries == 0) {
+		return nil, errors.New("inconsistent BIOS parameter block")
+	}
+	return b, nil
+}
+
+// countFAT walks a FAT12, FAT16 or FAT32 filesystem, including its root.
+func countFAT(r io.ReaderAt) (Totals, error) {
+	t := Totals{Dirs: 1}
+	boot := make([]byte, 512)
+	if _, err := r.ReadAt(boot, 0); err != nil {
+		return t, err
+	}
+	b, err := parseBPB(boot)
+	if err != nil {
+		return t, err
+	}
+	fs := &fatFS{r: r, bpb: b}
+
+	var root []byte
+	if b.kind == "fat32" {
+		root, err = fs.readChain(b.rootCluster)
+	} else {
+		root = make([]byte, b.rootEntries*32)
+		_, err = r.ReadAt(root, b.rootOffset)
+	}
+	if err != nil {
+		return t, fmt.Errorf("reading root directory: %w", err)
+	}
+
+	stack := [][]byte{root}
+	seen := map[uint32]bool{}
+	for len(stack) > 0 {
+		dir := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for pos := 0; pos+32 <= len(dir); pos += 32 {
+			e := dir[pos : pos+32]
+			if e[0] == 0 {
+				break
+			}
+			attr := e[11]
+			if e[0] == 0xe5 || attr&0x0f == 0x0f || attr&0x08 != 0 || e[0] == '.' {
+				continue // deleted, long name part, volume label, "." or ".."
+			}
+			first := uint32(binary.LittleEndian.Uint16(e[20:]))<<16 | uint32(binary.LittleEndian.Uint16(e[26:]))
+			if attr&0x10 == 0 {
+				t.Files++
+				t.Bytes += int64(binary.LittleEndian.Uint32(e[28:]))
+				continue
+			}
+			t.Dirs++
+			if first < 2 || seen[first] {
+				continue
+			}
+			seen[first] = true
+			sub, err := fs.readChain(first)
+			if err != nil {
+				return t, err
+			}
+			stack = append(stack, sub)
+		}
+	}
+	return t, nil
+}
+
+type fatFS struct {
+	r   io.ReaderAt
+	bpb *bpb
+}
+
+// next returns the cluster following c in its chain.
+func (fs *fatFS) next(c uint32) (uint32, error) {
+	b := fs.bpb
+	var off int64
+	switch b.kind {
+	case "fat12":
+		off = int64(c) + int64(c)/2
+	case "fat16":
+		off = int64(c) * 2
+	default:
+		off = int64(c) * 4
+	}
+	var buf [4]byte
+	if _, err := fs.r.ReadAt(buf[:], b.fatOffset+off); err != nil {
+		return 0, err
+	}
+	switch b.kind {
+	case "fat12":
+		v := uint32(binary.LittleEndian.Uint16(buf[:]))
+		if c&1 == 1 {
+			v >>= 4
+		}
+		return v & 0xfff, nil
+	case "fat16":
+		return uint32(binary.LittleEndian.Uint16(buf[:])), nil
+	}
+	return binary.LittleEndian.Uint32(buf[:]) & 0x0fffffff, nil
+}
+
+// readChain reads a directory's clusters.
+func (fs *fatFS) readChain(c uint32) ([]byte, error) {
+	b := fs.bpb
+	size := b.sectorsPerCluster * b.bytesPerSector
+	var data []byte
+	for steps := uint32(0); c >= 2 && c < b.clusters+2; steps++ {
+		if steps > b.clusters {
+			return nil, errors.New("cluster chain loops")
+		}
+		buf := make([]byte, size)
+		if _, err := fs.r.ReadAt(buf, b.dataOffset+int64(c-2)*size); err != nil {
+			return nil, err
+		}
+		data = append(data, buf...)
+		next, err := fs.next(c)
+		if err != nil {
+			return nil, err
+		}
+		c = next
+	}
+	return data, nil
+}
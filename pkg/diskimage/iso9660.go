@@ -0,0 +1,73 @@
+package diskimage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const isoSector = 2048
+
+// countISO9660 walks the primary volume descriptor's directory tree. Files
+// split into several extents are counted once. Like a scan, the totals
+// include the root directory.
+func countISO9660(r io.ReaderAt) (Totals, error) {
+	t := Totals{Dirs: 1}
+	pvd := make([]byte, isoSector)
+	if _, err := r.ReadAt(pvd, 16*isoSector); err != nil {
+		return t, fmt.Errorf("reading volume descriptor: %w", err)
+	}
+	if pvd[0] != 1 {
+		return t, errors.New("no primary volume descriptor")
+	}
+	root := pvd[156 : 156+34]
+
+	type extent struct{ lba, length uint32 }
+	stack := []extent{{binary.LittleEndian.Uint32(root[2:]), binary.LittleEndian.Uint32(root[10:])}}
+	seen := map[uint32]bool{}
+	for len(stack) > 0 {
+		dir := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[dir.lba] {
+			continue
+		}
+		seen[dir.lba] = true
+
+		data := make([]byte, dir.length)
+		if _, err := r.ReadAt(data, int64(dir.lba)*isoSector); err != nil {
+			return t, fmt.Errorf("reading directory at sector %d: %w", dir.lba, err)
+		}
+		for pos := 0; pos < len(data); {
+			length := int(data[pos])
+			if length == 0 {
+				// Records never span sectors; the rest of this one is padding.
+				pos = (pos/isoSector + 1) * isoSector
+				continue
+			}
+			if length < 34 || pos+length > len(data) {
+				return t, fmt.Errorf("corrupt directory record at sector %d", dir.lba)
+			}
+			rec := data[pos : pos+length]
+			pos += length
+
+			nameLen := int(rec[32])
+			if nameLen == 1 && (rec[33] == 0 || rec[33] == 1) {
+				continue // "." and ".."
+			}
+			flags := rec[25]
+			lba, size := binary.LittleEndian.Uint32(rec[2:]), binary.LittleEndian.Uint32(rec[10:])
+			switch {
+			case flags&0x02 != 0:
+				t.Dirs++
+				stack = append(stack, extent{lba, size})
+			default:
+				t.Bytes += int64(size)
+				if flags&0x80 == 0 {
+					t.Files++
+				}
+			}
+		}
+	}
+	return t, nil
+}
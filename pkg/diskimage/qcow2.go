@@ -0,0 +1,139 @@
+package diskimage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var qcow2Magic = []byte{'Q', 'F', 'I', 0xfb}
+
+const (
+	qcow2OffsetMask = 0x00fffffffffffe00
+	qcow2Compressed = 1 << 62
+	qcow2ZeroFlag   = 1
+
+	// qcow2CachedTables bounds the L2 tables kept in memory; each maps
+	// 512 MB of disk with the default 64 KB clusters.
+	qcow2CachedTables = 64
+)
+
+// qcow2 presents the virtual disk of a qcow2 image as an io.ReaderAt.
+// Unallocated clusters read as zeros. Compressed clusters, encryption and
+// backing files are not supported.
+type qcow2 struct {
+	r           io.ReaderAt
+	size        int64
+	clusterBits uint
+	l1          []uint64
+
+	mu sync.Mutex
+	l2 map[uint64][]uint64
+}
+
+func openQcow2(r io.ReaderAt) (*qcow2, error) {
+	hdr := make([]byte, 72)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return nil, fmt.Errorf("reading qcow2 header: %w", err)
+	}
+	be := binary.BigEndian
+	if v := be.Uint32(hdr[4:]); v != 2 && v != 3 {
+		return nil, fmt.Errorf("unsupported qcow2 version %d", v)
+	}
+	if be.Uint64(hdr[8:]) != 0 {
+		return nil, errors.New("qcow2 images with a backing file are not supported")
+	}
+	if be.Uint32(hdr[32:]) != 0 {
+		return nil, errors.New("encrypted qcow2 images are not supported")
+	}
+	q := &qcow2{
+		r:           r,
+		clusterBits: uint(be.Uint32(hdr[20:])),
+		size:        int64(be.Uint64(hdr[24:])),
+		l2:          make(map[uint64][]uint64),
+	}
+	if q.clusterBits < 9 || q.clusterBits > 21 {
+		return nil, fmt.Errorf("invalid qcow2 cluster size 2^%d", q.clusterBits)
+	}
+
+	l1 := make([]byte, 8*int(be.Uint32(hdr[36:])))
+	if _, err := r.ReadAt(l1, int64(be.Uint64(hdr[40:]))); err != nil {
+		return nil, fmt.Errorf("reading qcow2 L1 table: %w", err)
+	}
+	q.l1 = make([]uint64, len(l1)/8)
+	for i := range q.l1 {
+		q.l1[i] = be.Uint64(l1[8*i:])
+	}
+	return q, nil
+}
+
+func (q *qcow2) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		if off >= q.size {
+			return n, io.EOF
+		}
+		clusterSize := int64(1) << q.clusterBits
+		within := off & (clusterSize - 1)
+		chunk := min(int64(len(p)-n), clusterSize-within, q.size-off)
+
+		host, err := q.lookup(uint64(off) >> q.clusterBits)
+		if err != nil {
+			return n, err
+		}
+		dst := p[n : n+int(chunk)]
+		if host == 0 {
+			clear(dst)
+		} else if _, err := q.r.ReadAt(dst, int64(host)+within); err != nil {
+			return n, err
+		}
+		n += int(chunk)
+		off += chunk
+	}
+	return n, nil
+}
+
+// lookup returns the host offset of a guest cluster, 0 if it reads as zeros.
+func (q *qcow2) lookup(cluster uint64) (uint64, error) {
+	perL2 := uint64(1) << (q.clusterBits - 3)
+	l1Index := cluster / perL2
+	if l1Index >= uint64(len(q.l1)) {
+		return 0, nil
+	}
+	l2Offset := q.l1[l1Index] & qcow2OffsetMask
+	if l2Offset == 0 {
+		return 0, nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	table, ok := q.l2[l2Offset]
+	if !ok {
+		raw := make([]byte, 8*perL2)
+		if _, err := q.r.ReadAt(raw, int64(l2Offset)); err != nil {
+			return 0, fmt.Errorf("reading qcow2 L2 table: %w", err)
+		}
+		table = make([]uint64, perL2)
+		for i := range table {
+			table[i] = binary.BigEndian.Uint64(raw[8*i:])
+		}
+		if len(q.l2) >= qcow2CachedTables {
+			for k := range q.l2 {
+				delete(q.l2, k)
+				break
+			}
+		}
+		q.l2[l2Offset] = table
+	}
+
+	entry := table[cluster%perL2]
+	if entry&qcow2Compressed != 0 {
+		return 0, errors.New("compressed qcow2 clusters are not supported")
+	}
+	if entry&qcow2ZeroFlag != 0 {
+		return 0, nil
+	}
+	return entry & qcow2OffsetMask, nil
+}
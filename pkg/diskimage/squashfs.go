@@ -0,0 +1,178 @@
+package diskimage
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var squashfsMagic = []byte("hsqs")
+
+// squashfsCompressors names the compression ids of the superblock. Only
+// gzip (zlib) is built in.
+var squashfsCompressors = map[uint16]string{1: "gzip", 2: "lzma", 3: "lzo", 4: "xz", 5: "lz4", 6: "zstd"}
+
+const squashfsMetadataSize = 8192
+
+type squashfs struct {
+	r          io.ReaderAt
+	inodeTable int64
+	dirTable   int64
+	cache      map[int64]squashfsBlock
+}
+
+type squashfsBlock struct {
+	data []byte
+	next int64 // offset of the following metadata block
+}
+
+// countSquashfs walks a squashfs 4.0 image from its root directory. File
+// data is never read, only the inode and directory tables.
+func countSquashfs(r io.ReaderAt) (Totals, error) {
+	t := Totals{Dirs: 1}
+	sb := make([]byte, 96)
+	if _, err := r.ReadAt(sb, 0); err != nil {
+		return t, fmt.Errorf("reading superblock: %w", err)
+	}
+	le := binary.LittleEndian
+	if major := le.Uint16(sb[28:]); major != 4 {
+		return t, fmt.Errorf("squashfs version %d is not supported", major)
+	}
+	if c := le.Uint16(sb[20:]); c != 1 {
+		return t, fmt.Errorf("%s-compressed squashfs is not supported", squashfsCompressors[c])
+	}
+	fs := &squashfs{
+		r:          r,
+		inodeTable: int64(le.Uint64(sb[64:])),
+		dirTable:   int64(le.Uint64(sb[72:])),
+		cache:      make(map[int64]squashfsBlock),
+	}
+
+	stack := []uint64{le.Uint64(sb[32:])}
+	seen := map[uint64]bool{}
+	for len(stack) > 0 {
+		ref := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+
+		inode, err := fs.meta(fs.inodeTable, ref, 56)
+		if err != nil {
+			return t, err
+		}
+		var start, offset, size uint32
+		switch le.Uint16(inode) {
+		case 1:
+			start, size, offset = le.Uint32(inode[16:]), uint32(le.Uint16(inode[24:])), uint32(le.Uint16(inode[26:]))
+		case 8:
+			size, start, offset = le.Uint32(inode[20:]), le.Uint32(inode[24:]), uint32(le.Uint16(inode[34:]))
+		default:
+			return t, fmt.Errorf("inode %x is not a directory", ref)
+		}
+		if size <= 3 {
+			continue // empty; the size counts "." and ".."
+		}
+		listing, err := fs.meta(fs.dirTable, uint64(start)<<16|uint64(offset), int(size-3))
+		if err != nil {
+			return t, err
+		}
+
+		for pos := 0; pos+12 <= len(listing); {
+			count := int(le.Uint32(listing[pos:])) + 1
+			block := uint64(le.Uint32(listing[pos+4:]))
+			pos += 12
+			for i := 0; i < count && pos+8 <= len(listing); i++ {
+				child := block<<16 | uint64(le.Uint16(listing[pos:]))
+				kind := le.Uint16(listing[pos+4:])
+				pos += 8 + int(le.Uint16(listing[pos+6:])) + 1
+				switch kind {
+				case 1:
+					t.Dirs++
+					stack = append(stack, child)
+				case 2:
+					t.Files++
+					file, err := fs.meta(fs.inodeTable, child, 56)
+					if err != nil {
+						return t, err
+					}
+					switch le.Uint16(file) {
+					case 2:
+						t.Bytes += int64(le.Uint32(file[28:]))
+					case 9:
+						t.Bytes += int64(le.Uint64(file[24:]))
+					}
+				default:
+					t.Files++
+				}
+			}
+		}
+	}
+	return t, nil
+}
+
+// meta reads n bytes of a metadata table starting at ref, whose upper bits
+// are the offset of a metadata block from the table start and whose low 16
+// bits are an offset into the block's uncompressed data. Reads past the
+// end of the table are padded with zeros, since inodes are read with the
+// size of the largest kind.
+func (fs *squashfs) meta(table int64, ref uint64, n int) ([]byte, error) {
+	pos := table + int64(ref>>16)
+	skip := int(ref & 0xffff)
+	var out []byte
+	for len(out) < n {
+		b, err := fs.block(pos)
+		if err != nil {
+			if len(out) > 0 {
+				return append(out, make([]byte, n-len(out))...), nil
+			}
+			return nil, err
+		}
+		if skip < len(b.data) {
+			out = append(out, b.data[skip:]...)
+		}
+		skip = max(0, skip-len(b.data))
+		pos = b.next
+	}
+	return out[:n], nil
+}
+
+func (fs *squashfs) block(pos int64) (squashfsBlock, error) {
+	if b, ok := fs.cache[pos]; ok {
+		return b, nil
+	}
+	var hdr [2]byte
+	if _, err := fs.r.ReadAt(hdr[:], pos); err != nil {
+		return squashfsBlock{}, fmt.Errorf("reading metadata block at %d: %w", pos, err)
+	}
+	h := binary.LittleEndian.Uint16(hdr[:])
+	size := int(h & 0x7fff)
+	raw := make([]byte, size)
+	if _, err := fs.r.ReadAt(raw, pos+2); err != nil {
+		return squashfsBlock{}, fmt.Errorf("reading metadata block at %d: %w", pos, err)
+	}
+	data := raw
+	if h&0x8000 == 0 {
+		zr, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return squashfsBlock{}, err
+		}
+		data, err = io.ReadAll(io.LimitReader(zr, squashfsMetadataSize+1))
+		if err != nil {
+			return squashfsBlock{}, err
+		}
+		if len(data) > squashfsMetadataSize {
+			return squashfsBlock{}, errors.New("oversized metadata block")
+		}
+	}
+	b := squashfsBlock{data: data, next: pos + 2 + int64(size)}
+	if len(fs.cache) > 1024 {
+		clear(fs.cache)
+	}
+	fs.cache[pos] = b
+	return b, nil
+}
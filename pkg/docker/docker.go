@@ -0,0 +1,179 @@
+// Package docker is a minimal client for the parts of the Docker Engine API
+// needed to scan containers and volumes: listing them and exporting a
+// container's filesystem.
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// DefaultHost is used when DOCKER_HOST is not set.
+const DefaultHost = "unix:///var/run/docker.sock"
+
+type Client struct {
+	http *http.Client
+	base string
+}
+
+// NewClient connects to host, a unix:// socket or tcp:// address; an empty
+// host means $DOCKER_HOST or DefaultHost. TLS is not supported.
+func NewClient(host string) (*Client, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = DefaultHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("docker host %q: %w", host, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &Client{http: &http.Client{Transport: transport}, base: "http://docker"}, nil
+	case "tcp", "http":
+		return &Client{http: &http.Client{}, base: "http://" + u.Host}, nil
+	}
+	return nil, fmt.Errorf("docker host %q: unsupported scheme %q", host, u.Scheme)
+}
+
+type Container struct {
+	ID    string
+	Names []string
+	Image string
+	State string
+}
+
+// Name returns the container's primary name without the leading slash.
+func (c Container) Name() string {
+	if len(c.Names) == 0 {
+		return c.ID[:min(12, len(c.ID))]
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+type Volume struct {
+	Name       string
+	Driver     string
+	Mountpoint string
+}
+
+// Containers lists running containers.
+func (c *Client) Containers() ([]Container, error) {
+	var list []Container
+	return list, c.getJSON("/containers/json", &list)
+}
+
+// Container looks up a container by name or ID.
+func (c *Client) Container(name string) (*Container, error) {
+	var info struct {
+		ID     string `json:"Id"`
+		Name   string
+		Config struct{ Image string }
+		State  struct{ Status string }
+	}
+	if err := c.getJSON("/containers/"+url.PathEscape(name)+"/json", &info); err != nil {
+		return nil, err
+	}
+	return &Container{ID: info.ID, Names: []string{info.Name}, Image: info.Config.Image, State: info.State.Status}, nil
+}
+
+// Volumes lists all volumes.
+func (c *Client) Volumes() ([]Volume, error) {
+	var list struct{ Volumes []Volume }
+	return list.Volumes, c.getJSON("/volumes", &list)
+}
+
+// Volume looks up a volume by name.
+func (c *Client) Volume(name string) (*Volume, error) {
+	var v Volume
+	if err := c.getJSON("/volumes/"+url.PathEscape(name), &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// Export streams the container's filesystem as a tar archive. Volumes and
+// bind mounts are not included.
+func (c *Client) Export(id string) (io.ReadCloser, error) {
+	resp, err := c.get("/containers/" + url.PathEscape(id) + "/export")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (c *Client) get(path string) (*http.Response, error) {
+	resp, err := c.http.Get(c.base + path)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var msg struct{ Message string }
+		json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&msg)
+		if msg.Message == "" {
+			msg.Message = resp.Status
+		}
+		return nil, fmt.Errorf("docker: %s", msg.Message)
+	}
+	return resp, nil
+}
+
+func (c *Client) getJSON(path string, v any) error {
+	resp, err := c.get(path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Totals are the counts of a filesystem read from a tar stream.
+type Totals struct {
+	Files int64
+	Dirs  int64
+	Bytes int64
+}
+
+// CountTar counts the entries of a tar archive. Hard links are counted as
+// files without adding to Bytes.
+func CountTar(r io.Reader) (Totals, error) {
+	var t Totals
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return t, nil
+		}
+		if err != nil {
+			return t, err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			t.Dirs++
+		case tar.TypeReg:
+			t.Files++
+			t.Bytes += hdr.Size
+		default:
+			t.Files++
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package docker
+
+import (
+	"archive/tar"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"Id":"0123456789abcdef","Names":["/web"],"Image":"nginx","State":"running"}]`))
+	})
+	mux.HandleFunc("/containers/0123456789abcdef/export", func(w http.ResponseWriter, r *http.Request) {
+		tw := tar.NewWriter(w)
+		tw.WriteHeader(&tar.Header{Name: "etc/", Typeflag: tar.TypeDir})
+		tw.WriteHeader(&tar.Header{Name: "etc/hosts", Typeflag: tar.TypeReg, Size: 5})
+		tw.Write([]byte("hosts"))
+		tw.WriteHeader(&tar.Header{Name: "bin/sh", Typeflag: tar.TypeSymlink, Linkname: "busybox"})
+		tw.Close()
+	})
+	mux.HandleFunc("/volumes/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"get missing: no such volume"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c, err := NewClient("tcp://" + strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers, err := c.Containers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 || containers[0].Name() != "web" {
+		t.Fatalf("Unexpected containers %+v", containers)
+	}
+
+	body, err := c.Export(containers[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	totals, err := CountTar(body)
+	body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totals != (Totals{Files: 2, Dirs: 1, Bytes: 5}) {
+		t.Errorf("Totals = %+v", totals)
+	}
+
+	if _, err := c.Volume("missing"); err == nil || !strings.Contains(err.Error(), "no such volume") {
+		t.Errorf("Expected the daemon's error message, got %v", err)
+	}
+	if _, err := NewClient("ssh://host"); err == nil {
+		t.Error("Expected an error for an unsupported scheme")
+	}
+}
@@ -0,0 +1,118 @@
+// Package document reads the page count and author of PDF files and of
+// office documents: Office Open XML (docx, xlsx, pptx), OpenDocument (odt,
+// ods, odp) and the legacy binary Office formats (doc, xls, ppt). Only the
+// metadata is read; documents are never rendered or fully parsed.
+package document
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Info is what Probe found out about a document. Pages counts slides for
+// presentations and is zero when the document does not record it, as
+// spreadsheets do not. Author is empty when not recorded.
+type Info struct {
+	Format string // e.g. "pdf", "docx", "odt", "doc"
+	Pages  int
+	Author string
+}
+
+// errMalformed is returned by the parsers for structures that do not make
+// sense; Read reports such files as not documents.
+var errMalformed = errors.New("malformed document")
+
+// Probe reads the metadata of the file at path. It returns nil and no
+// error for files that are not a document in a format it knows, and for
+// damaged ones.
+func Probe(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Read(f, st.Size())
+}
+
+// Read is Probe for the size bytes of r.
+func Read(r io.ReaderAt, size int64) (*Info, error) {
+	head, err := readAtMost(r, 0, 1024)
+	if err != nil {
+		return nil, err
+	}
+	var info *Info
+	switch {
+	case bytes.Contains(head, []byte("%PDF-")):
+		info, err = readPDF(r, size)
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		info, err = readZip(r, size)
+	case bytes.HasPrefix(head, []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")):
+		info, err = readOLE(r, size)
+	}
+	if err != nil {
+		if errors.Is(err, errMalformed) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return info, nil
+}
+
+// readAt reads exactly n bytes at off.
+func readAt(r io.ReaderAt, off int64, n int) ([]byte, error) {
+	b := make([]byte, n)
+	m, err := r.ReadAt(b, off)
+	if m == n {
+		return b, nil
+	}
+	if err == io.EOF || err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return nil, err
+}
+
+// readAtMost reads up to n bytes at off, fewer at the end of r.
+func readAtMost(r io.ReaderAt, off int64, n int) ([]byte, error) {
+	b := make([]byte, n)
+	m, err := r.ReadAt(b, off)
+	if m == n || err == io.EOF {
+		return b[:m], nil
+	}
+	return nil, err
+}
+
+// text decodes metadata strings stored in an 8-bit encoding: UTF-8 when
+// valid, Latin-1 otherwise.
+func text(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	if utf8.Valid(b) {
+		return strings.TrimSpace(string(b))
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return strings.TrimSpace(string(runes))
+}
+
+// utf16Text decodes UTF-16 code units, up to the first NUL.
+func utf16Text(units []uint16) string {
+	for i, u := range units {
+		if u == 0 {
+			units = units[:i]
+			break
+		}
+	}
+	return strings.TrimSpace(string(utf16.Decode(units)))
+}
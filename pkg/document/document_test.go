@@ -0,0 +1,217 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func probe(t *testing.T, data []byte) *Info {
+	t.Helper()
+	info, err := Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func TestPDF(t *testing.T) {
+	// Stream data is skipped, here running past the first block read.
+	content := "<< /Type /Pages /Count 99 >>" + strings.Repeat("\x00", pdfBlock)
+	plain := fmt.Sprintf(`%%PDF-1.4
+1 0 obj << /Type /Catalog /Pages 2 0 R /Outlines 5 0 R >> endobj
+2 0 obj << /Type /Pages /Kids [3 0 R 4 0 R 6 0 R] /Count 3 >> endobj
+3 0 obj << /Type /Page /Parent 2 0 R /Contents 7 0 R >> endobj
+5 0 obj << /Type /Outlines /Count 12 >> endobj
+7 0 obj << /Length %d >>
+stream
+%s
+endstream endobj
+8 0 obj << /Title (Report) /Author (Jane \(J.\) D\351) >> endobj
+trailer << /Root 1 0 R /Info 8 0 R >>
+%%%%EOF
+`, len(content), content)
+	info := probe(t, []byte(plain))
+	if want := (Info{Format: "pdf", Pages: 3, Author: "Jane (J.) Dé"}); info == nil || *info != want {
+		t.Errorf("plain: got %+v", info)
+	}
+
+	// PDF 1.5 writers pack the page tree and info dictionary into
+	// compressed object streams.
+	var objs bytes.Buffer
+	zw := zlib.NewWriter(&objs)
+	zw.Write([]byte("2 0 4 60 << /Kids [3 0 R] /Type/Pages /Count 42 >> << /Author <FEFF004A0061006E0065> >>"))
+	zw.Close()
+	packed := fmt.Sprintf("%%PDF-1.7\n9 0 obj\n<</Type/ObjStm/N 2/First 8/Filter/FlateDecode/Length %d>>stream\n%s\nendstream\nendobj\n", objs.Len(), objs.Bytes())
+	info = probe(t, []byte(packed))
+	if want := (Info{Format: "pdf", Pages: 42, Author: "Jane"}); info == nil || *info != want {
+		t.Errorf("object streams: got %+v", info)
+	}
+
+	linearized := "%PDF-1.6\n1 0 obj <</Linearized 1/L 1000/H [ 500 100 ]/O 4/E 300/N 7/T 900>> endobj\n" +
+		"<x:xmpmeta><dc:creator><rdf:Seq><rdf:li>Ann</rdf:li></rdf:Seq></dc:creator></x:xmpmeta>\n" +
+		"trailer << /Encrypt 5 0 R >>\n4 0 obj << /Author (\x8a\x13) >> endobj\n"
+	info = probe(t, []byte(linearized))
+	if want := (Info{Format: "pdf", Pages: 7, Author: "Ann"}); info == nil || *info != want {
+		t.Errorf("linearized: got %+v", info)
+	}
+}
+
+func zipFile(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestZip(t *testing.T) {
+	core := `<?xml version="1.0"?><cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:creator>Jane Doe</dc:creator></cp:coreProperties>`
+	for _, tc := range []struct {
+		name  string
+		parts map[string]string
+		want  *Info
+	}{
+		{"docx", map[string]string{
+			"word/document.xml": "<w:document/>",
+			"docProps/app.xml":  `<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/extended-properties"><Pages>12</Pages><Words>3000</Words></Properties>`,
+			"docProps/core.xml": core,
+		}, &Info{Format: "docx", Pages: 12, Author: "Jane Doe"}},
+		{"pptx", map[string]string{
+			"ppt/presentation.xml": "<p:presentation/>",
+			"docProps/app.xml":     `<Properties><Slides>30</Slides></Properties>`,
+		}, &Info{Format: "pptx", Pages: 30}},
+		{"xlsx", map[string]string{
+			"xl/workbook.xml":   "<workbook/>",
+			"docProps/core.xml": core,
+		}, &Info{Format: "xlsx", Author: "Jane Doe"}},
+		{"odt", map[string]string{
+			"mimetype": "application/vnd.oasis.opendocument.text",
+			"meta.xml": `<office:document-meta xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:meta="urn:oasis:names:tc:opendocument:xmlns:meta:1.0" xmlns:dc="http://purl.org/dc/elements/1.1/"><office:meta><meta:initial-creator>Ann</meta:initial-creator><dc:creator>Bob</dc:creator><meta:document-statistic meta:page-count="5" meta:word-count="900"/></office:meta></office:document-meta>`,
+		}, &Info{Format: "odt", Pages: 5, Author: "Ann"}},
+		{"odp", map[string]string{
+			"mimetype":    "application/vnd.oasis.opendocument.presentation",
+			"content.xml": `<office:document-content><office:body><office:presentation><draw:page draw:name="1"/><draw:page draw:name="2"><draw:frame/></draw:page></office:presentation></office:body></office:document-content>`,
+		}, &Info{Format: "odp", Pages: 2}},
+		{"zip", map[string]string{"a.txt": "hello"}, nil},
+	} {
+		info := probe(t, zipFile(t, tc.parts))
+		if (info == nil) != (tc.want == nil) || info != nil && *info != *tc.want {
+			t.Errorf("%s: got %+v, expected %+v", tc.name, info, tc.want)
+		}
+	}
+}
+
+// compoundFile builds a version 3 compound file with a Word document stream
+// and a SummaryInformation stream large enough to sit in regular sectors.
+func compoundFile(author string, pages int) []byte {
+	le := binary.LittleEndian
+	u32 := func(v uint32) []byte { return le.AppendUint32(nil, v) }
+
+	str := append([]byte(author), 0)
+	for len(str)%4 != 0 {
+		str = append(str, 0)
+	}
+	props := bytes.Join([][]byte{u32(0x1e), u32(uint32(len(author) + 1)), str, u32(0x03), u32(uint32(pages))}, nil)
+	section := bytes.Join([][]byte{u32(uint32(24 + len(props))), u32(2), u32(4), u32(24), u32(14), u32(uint32(24 + 8 + len(str))), props}, nil)
+	summary := bytes.Join([][]byte{{0xfe, 0xff, 0, 0}, make([]byte, 20), u32(1), make([]byte, 16), u32(48), section}, nil)
+	summary = append(summary, make([]byte, 4096-len(summary))...)
+
+	header := make([]byte, 512)
+	copy(header, "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")
+	le.PutUint16(header[0x1a:], 3)
+	le.PutUint16(header[0x1c:], 0xfffe)
+	le.PutUint16(header[0x1e:], 9)
+	le.PutUint16(header[0x20:], 6)
+	le.PutUint32(header[0x2c:], 1)
+	le.PutUint32(header[0x30:], 1)
+	le.PutUint32(header[0x38:], 4096)
+	le.PutUint32(header[0x3c:], endOfChain)
+	le.PutUint32(header[0x44:], endOfChain)
+	for i := 0; i < 109; i++ {
+		le.PutUint32(header[0x4c+i*4:], 0xffffffff)
+	}
+	le.PutUint32(header[0x4c:], 0)
+
+	fat := make([]byte, 512)
+	for i := 0; i < 128; i++ {
+		next := uint32(0xffffffff)
+		switch {
+		case i == 0:
+			next = 0xfffffffd
+		case i == 1 || i == 9:
+			next = endOfChain
+		case i < 9:
+			next = uint32(i + 1)
+		}
+		le.PutUint32(fat[i*4:], next)
+	}
+
+	entry := func(name string, typ byte, start uint32, size uint64) []byte {
+		e := make([]byte, 128)
+		units := utf16.Encode([]rune(name))
+		for i, u := range units {
+			le.PutUint16(e[i*2:], u)
+		}
+		le.PutUint16(e[64:], uint16(len(units)*2+2))
+		e[66] = typ
+		le.PutUint32(e[116:], start)
+		le.PutUint64(e[120:], size)
+		return e
+	}
+	dir := bytes.Join([][]byte{
+		entry("Root Entry", 5, endOfChain, 0),
+		entry("WordDocument", 2, endOfChain, 0),
+		entry("\x05SummaryInformation", 2, 2, 4096),
+		make([]byte, 128),
+	}, nil)
+	return bytes.Join([][]byte{header, fat, dir, summary}, nil)
+}
+
+func TestOLE(t *testing.T) {
+	info := probe(t, compoundFile("Jane Doe", 17))
+	if want := (Info{Format: "doc", Pages: 17, Author: "Jane Doe"}); info == nil || *info != want {
+		t.Errorf("got %+v", info)
+	}
+}
+
+func TestNotDocuments(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"text":  []byte("hello, world\n"),
+		"empty": nil,
+		"ole":   []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1 truncated"),
+		"zip":   []byte("PK\x03\x04 truncated"),
+	} {
+		if info := probe(t, data); info != nil {
+			t.Errorf("%s: got %+v", name, info)
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "a.doc")
+	os.WriteFile(name, compoundFile("Ann", 2), 0644)
+	info, err := Probe(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info == nil || info.Pages != 2 {
+		t.Errorf("got %+v", info)
+	}
+}
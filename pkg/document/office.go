@@ -0,0 +1,147 @@
+package document
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// maxPart is the most read of any one part of a zipped document; metadata
+// parts are a few kilobytes.
+const maxPart = 1 << 20
+
+// odfFormats maps OpenDocument media types to formats.
+var odfFormats = map[string]string{
+	"application/vnd.oasis.opendocument.text":         "odt",
+	"application/vnd.oasis.opendocument.spreadsheet":  "ods",
+	"application/vnd.oasis.opendocument.presentation": "odp",
+}
+
+// readZip reads an Office Open XML or OpenDocument file. Other zip files
+// are not documents.
+func readZip(r io.ReaderAt, size int64) (*Info, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		if errors.Is(err, zip.ErrFormat) || errors.Is(err, zip.ErrAlgorithm) {
+			return nil, errMalformed
+		}
+		return nil, err
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	switch {
+	case files["word/document.xml"] != nil:
+		return readOOXML(files, "docx")
+	case files["xl/workbook.xml"] != nil:
+		return readOOXML(files, "xlsx")
+	case files["ppt/presentation.xml"] != nil:
+		return readOOXML(files, "pptx")
+	case files["mimetype"] != nil:
+		b, err := readPart(files["mimetype"])
+		if err != nil {
+			return nil, err
+		}
+		if format, ok := odfFormats[strings.TrimSpace(string(b))]; ok {
+			return readODF(files, format)
+		}
+	}
+	return nil, nil
+}
+
+// readPart reads a part of a zipped document.
+func readPart(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, errMalformed
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(io.LimitReader(rc, maxPart))
+	if err != nil {
+		return nil, errMalformed
+	}
+	return b, nil
+}
+
+// decodePart decodes the XML part name into v. Missing and broken parts
+// leave v as it is.
+func decodePart(files map[string]*zip.File, name string, v any) error {
+	f := files[name]
+	if f == nil {
+		return nil
+	}
+	b, err := readPart(f)
+	if err != nil {
+		return err
+	}
+	xml.Unmarshal(b, v)
+	return nil
+}
+
+// readOOXML reads the page or slide count that Office saves in the
+// extended properties, and the author from the core properties.
+func readOOXML(files map[string]*zip.File, format string) (*Info, error) {
+	var app struct {
+		Pages  int `xml:"Pages"`
+		Slides int `xml:"Slides"`
+	}
+	var core struct {
+		Creator string `xml:"creator"`
+	}
+	if err := decodePart(files, "docProps/app.xml", &app); err != nil {
+		return nil, err
+	}
+	if err := decodePart(files, "docProps/core.xml", &core); err != nil {
+		return nil, err
+	}
+	info := &Info{Format: format, Author: strings.TrimSpace(core.Creator), Pages: app.Pages}
+	if format == "pptx" {
+		info.Pages = app.Slides
+	}
+	return info, nil
+}
+
+// readODF reads the page count and author from an OpenDocument file's
+// metadata. Presentations record no page count there, so their slides are
+// counted in the content.
+func readODF(files map[string]*zip.File, format string) (*Info, error) {
+	var meta struct {
+		InitialCreator string `xml:"meta>initial-creator"`
+		Creator        string `xml:"meta>creator"`
+		Statistic      struct {
+			Pages int `xml:"page-count,attr"`
+		} `xml:"meta>document-statistic"`
+	}
+	if err := decodePart(files, "meta.xml", &meta); err != nil {
+		return nil, err
+	}
+	info := &Info{Format: format, Author: strings.TrimSpace(meta.InitialCreator), Pages: meta.Statistic.Pages}
+	if info.Author == "" {
+		info.Author = strings.TrimSpace(meta.Creator)
+	}
+	if format == "odp" {
+		if f := files["content.xml"]; f != nil {
+			rc, err := f.Open()
+			if err != nil {
+				return info, nil
+			}
+			defer rc.Close()
+			// Counted as the content streams by, since presentations with
+			// embedded media can make it large.
+			d := xml.NewDecoder(rc)
+			for {
+				tok, err := d.RawToken()
+				if err != nil {
+					break
+				}
+				if el, ok := tok.(xml.StartElement); ok && el.Name.Space == "draw" && el.Name.Local == "page" {
+					info.Pages++
+				}
+			}
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,276 @@
+package document
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// Special sector numbers of compound files.
+const (
+	endOfChain = 0xfffffffe
+	maxSector  = 0xfffffffa
+)
+
+// oleFile reads the streams of a compound file, the container of the
+// legacy Office formats.
+type oleFile struct {
+	r          io.ReaderAt
+	size       int64
+	sectorSize int64
+	miniSize   int64
+	cutoff     int64
+	fat        []uint32
+	miniFAT    []uint32
+	ministream []byte
+}
+
+// oleEntry is a directory entry.
+type oleEntry struct {
+	name  string
+	start uint32
+	size  int64
+}
+
+// readOLE reads a Word, Excel or PowerPoint file's page or slide count and
+// author from its summary information property sets. Other compound files,
+// such as Outlook messages and installer packages, are not documents.
+func readOLE(r io.ReaderAt, size int64) (*Info, error) {
+	f, entries, err := openOLE(r, size)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{}
+	for _, e := range entries {
+		switch e.name {
+		case "WordDocument":
+			info.Format = "doc"
+		case "Workbook", "Book":
+			info.Format = "xls"
+		case "PowerPoint Document":
+			info.Format = "ppt"
+		}
+	}
+	if info.Format == "" {
+		return nil, nil
+	}
+	for _, e := range entries {
+		switch e.name {
+		case "\x05SummaryInformation":
+			props, err := f.properties(e)
+			if err != nil {
+				continue
+			}
+			info.Author = props.str[4] // PIDSI_AUTHOR
+			if info.Format == "doc" {
+				info.Pages = int(props.num[14]) // PIDSI_PAGECOUNT
+			}
+		case "\x05DocumentSummaryInformation":
+			if info.Format != "ppt" {
+				continue
+			}
+			if props, err := f.properties(e); err == nil {
+				info.Pages = int(props.num[7]) // PIDDSI_SLIDECOUNT
+			}
+		}
+	}
+	return info, nil
+}
+
+// openOLE reads the header, allocation table and directory of a compound
+// file.
+func openOLE(r io.ReaderAt, size int64) (*oleFile, []oleEntry, error) {
+	h, err := readAt(r, 0, 512)
+	if err != nil {
+		return nil, nil, err
+	}
+	le := binary.LittleEndian
+	shift, miniShift := le.Uint16(h[0x1e:]), le.Uint16(h[0x20:])
+	if shift != 9 && shift != 12 || miniShift != 6 {
+		return nil, nil, errMalformed
+	}
+	f := &oleFile{r: r, size: size, sectorSize: 1 << shift, miniSize: 1 << miniShift, cutoff: int64(le.Uint32(h[0x38:]))}
+
+	// The sectors of the allocation table are listed in the header and
+	// then in a chain of further sectors.
+	fatSectors := int(le.Uint32(h[0x2c:]))
+	if int64(fatSectors)*f.sectorSize > size {
+		return nil, nil, errMalformed
+	}
+	var difat []uint32
+	for i := 0; i < 109; i++ {
+		difat = append(difat, le.Uint32(h[0x4c+i*4:]))
+	}
+	per := int(f.sectorSize/4) - 1
+	for next, n := le.Uint32(h[0x44:]), 0; next <= maxSector && len(difat) < fatSectors; n++ {
+		if n > fatSectors {
+			return nil, nil, errMalformed
+		}
+		b, err := f.sector(next)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := 0; i < per; i++ {
+			difat = append(difat, le.Uint32(b[i*4:]))
+		}
+		next = le.Uint32(b[per*4:])
+	}
+	if len(difat) > fatSectors {
+		difat = difat[:fatSectors]
+	}
+	for _, s := range difat {
+		b, err := f.sector(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := 0; i < len(b); i += 4 {
+			f.fat = append(f.fat, le.Uint32(b[i:]))
+		}
+	}
+
+	dir, err := f.chain(le.Uint32(h[0x30:]), -1)
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries []oleEntry
+	for i := 0; i+128 <= len(dir); i += 128 {
+		e := dir[i : i+128]
+		n := int(le.Uint16(e[64:]))
+		if n < 2 || n > 64 || e[66] != 2 && e[66] != 5 { // streams and the root
+			continue
+		}
+		units := make([]uint16, n/2-1)
+		for j := range units {
+			units[j] = le.Uint16(e[j*2:])
+		}
+		size := int64(le.Uint64(e[120:]))
+		if shift == 9 {
+			size &= 0xffffffff // the high half is not reliable in version 3
+		}
+		entry := oleEntry{name: string(utf16.Decode(units)), start: le.Uint32(e[116:]), size: size}
+		if e[66] == 5 {
+			// The root holds the mini stream, where small streams live.
+			if f.ministream, err = f.chain(entry.start, entry.size); err != nil {
+				return nil, nil, err
+			}
+			mf, err := f.chain(le.Uint32(h[0x3c:]), -1)
+			if err != nil {
+				return nil, nil, err
+			}
+			for j := 0; j+4 <= len(mf); j += 4 {
+				f.miniFAT = append(f.miniFAT, le.Uint32(mf[j:]))
+			}
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return f, entries, nil
+}
+
+func (f *oleFile) sector(n uint32) ([]byte, error) {
+	if n > maxSector {
+		return nil, errMalformed
+	}
+	return readAt(f.r, (int64(n)+1)*f.sectorSize, int(f.sectorSize))
+}
+
+// chain reads the sectors chained from start, up to size bytes if size is
+// not negative.
+func (f *oleFile) chain(start uint32, size int64) ([]byte, error) {
+	var out []byte
+	for s := start; s != endOfChain && (size < 0 || int64(len(out)) < size); s = f.fat[s] {
+		if int(s) >= len(f.fat) || int64(len(out)) > f.size {
+			return nil, errMalformed
+		}
+		b, err := f.sector(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b...)
+	}
+	if size >= 0 && int64(len(out)) > size {
+		out = out[:size]
+	}
+	return out, nil
+}
+
+// stream reads the content of a stream, from the mini stream if it is
+// small.
+func (f *oleFile) stream(e oleEntry) ([]byte, error) {
+	if e.size >= f.cutoff {
+		return f.chain(e.start, e.size)
+	}
+	var out []byte
+	for s := e.start; s != endOfChain && int64(len(out)) < e.size; s = f.miniFAT[s] {
+		off := int64(s) * f.miniSize
+		if int(s) >= len(f.miniFAT) || off+f.miniSize > int64(len(f.ministream)) {
+			return nil, errMalformed
+		}
+		out = append(out, f.ministream[off:off+f.miniSize]...)
+	}
+	if int64(len(out)) < e.size {
+		return nil, errMalformed
+	}
+	return out[:e.size], nil
+}
+
+// oleProperties are the string and integer properties of the first
+// section of a property set stream, by property ID.
+type oleProperties struct {
+	str map[uint32]string
+	num map[uint32]int64
+}
+
+// properties reads a property set stream such as SummaryInformation.
+func (f *oleFile) properties(e oleEntry) (oleProperties, error) {
+	p := oleProperties{str: map[uint32]string{}, num: map[uint32]int64{}}
+	if e.size > 1<<20 {
+		return p, errMalformed
+	}
+	b, err := f.stream(e)
+	if err != nil {
+		return p, err
+	}
+	le := binary.LittleEndian
+	if len(b) < 48 || le.Uint16(b) != 0xfffe || le.Uint32(b[24:]) == 0 {
+		return p, errMalformed
+	}
+	sec := int(le.Uint32(b[44:]))
+	if sec < 0 || sec+8 > len(b) {
+		return p, errMalformed
+	}
+	s := b[sec:]
+	count := int(le.Uint32(s[4:]))
+	if count > (len(s)-8)/8 {
+		return p, errMalformed
+	}
+	for i := 0; i < count; i++ {
+		id, off := le.Uint32(s[8+i*8:]), int(le.Uint32(s[12+i*8:]))
+		if off < 0 || off+8 > len(s) {
+			continue
+		}
+		v := s[off:]
+		switch le.Uint32(v) {
+		case 0x02: // VT_I2
+			p.num[id] = int64(int16(le.Uint16(v[4:])))
+		case 0x03: // VT_I4
+			p.num[id] = int64(int32(le.Uint32(v[4:])))
+		case 0x1e: // VT_LPSTR, in the set's code page
+			n := int(le.Uint32(v[4:]))
+			if n >= 0 && 8+n <= len(v) {
+				p.str[id] = text(v[8 : 8+n])
+			}
+		case 0x1f: // VT_LPWSTR
+			n := int(le.Uint32(v[4:]))
+			if n >= 0 && 8+2*n <= len(v) {
+				units := make([]uint16, n)
+				for j := range units {
+					units[j] = le.Uint16(v[8+2*j:])
+				}
+				p.str[id] = strings.TrimSpace(utf16Text(units))
+			}
+		}
+	}
+	return p, nil
+}
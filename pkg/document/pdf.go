@@ -0,0 +1,280 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// PDF files are read in blocks, each overlapping the next so that the
+// dictionaries looked for are seen whole in at least one of them.
+const (
+	pdfBlock   = 1 << 20
+	pdfOverlap = 4 << 10
+	// maxObjStm caps how much of an object stream is inflated.
+	maxObjStm = 16 << 20
+)
+
+var (
+	pdfPages      = regexp.MustCompile(`/Type\s*/Pages\b`)
+	pdfCount      = regexp.MustCompile(`/Count\s+(\d+)`)
+	pdfLinearized = regexp.MustCompile(`/Linearized\b[^>]*?/N\s+(\d+)`)
+	pdfObjStm     = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+	pdfFlate      = regexp.MustCompile(`/Filter\s*\[?\s*/FlateDecode\s*\]?`)
+	pdfLength     = regexp.MustCompile(`/Length\s+(\d+)(\s+\d+\s+R)?`)
+	pdfAuthor     = regexp.MustCompile(`/Author\s*([(<])`)
+	pdfEncrypt    = regexp.MustCompile(`/Encrypt\s+\d+\s+\d+\s+R`)
+	xmpCreator    = regexp.MustCompile(`(?s)<dc:creator>.*?<rdf:li[^>]*>([^<]*)</rdf:li>`)
+	pdfStream     = regexp.MustCompile(`>>\s*stream\r?\n`)
+)
+
+// pdfScan collects what the dictionaries of a PDF file say.
+type pdfScan struct {
+	pages     int
+	author    string
+	xmpAuthor string
+	encrypted bool
+}
+
+// readPDF finds the page count in the page tree root, whose /Count is the
+// largest of all /Pages dictionaries, or in the linearization dictionary at
+// the start of files optimized for the web, and the author in the document
+// information dictionary or XMP metadata. Rather than follow the cross
+// reference table, which is often damaged, the file is scanned, inflating
+// the object streams that modern writers pack dictionaries into and jumping
+// over other streams, such as page contents and images, where their length
+// is given.
+func readPDF(r io.ReaderAt, size int64) (*Info, error) {
+	var s pdfScan
+	for pos := int64(0); pos < size; {
+		block, err := readAtMost(r, pos, pdfBlock)
+		if err != nil {
+			return nil, err
+		}
+		if pos == 0 {
+			if m := pdfLinearized.FindSubmatch(block); m != nil {
+				s.pages, _ = strconv.Atoi(string(m[1]))
+			}
+		}
+		next := pos + int64(len(block))
+		if len(block) == pdfBlock {
+			next -= pdfOverlap
+		}
+		// Search what lies between streams, skipping stream data.
+		at := 0
+		for _, m := range pdfStream.FindAllIndex(block, -1) {
+			if m[0] < at {
+				continue
+			}
+			s.search(block[at:m[1]])
+			at = m[1]
+			dict := dictBefore(block, m[0]+2)
+			data := pos + int64(m[1])
+			if pdfObjStm.Match(dict) && pdfFlate.Match(dict) {
+				s.objStm(r, data, size)
+			}
+			if l := pdfLength.FindSubmatch(dict); l != nil && l[2] == nil {
+				n, _ := strconv.ParseInt(string(l[1]), 10, 64)
+				if end := data + n; end-pos < int64(len(block)) {
+					at = int(end - pos)
+				} else {
+					next, at = max(next, end), len(block)
+					break
+				}
+			} else if e := bytes.Index(block[at:], []byte("endstream")); e >= 0 {
+				at += e
+			} else {
+				at = len(block)
+				break
+			}
+		}
+		s.search(block[at:])
+		pos = next
+	}
+	if s.encrypted {
+		// Strings in encrypted files can't be read without decrypting.
+		s.author = ""
+	}
+	info := &Info{Format: "pdf", Pages: s.pages, Author: s.author}
+	if info.Author == "" {
+		info.Author = s.xmpAuthor
+	}
+	return info, nil
+}
+
+// search looks for page tree nodes, the author and the encryption
+// dictionary in b.
+func (s *pdfScan) search(b []byte) {
+	for _, m := range pdfPages.FindAllIndex(b, -1) {
+		dict := dictAround(b, m[0])
+		if c := pdfCount.FindSubmatch(dict); c != nil {
+			if n, err := strconv.Atoi(string(c[1])); err == nil && n > s.pages {
+				s.pages = n
+			}
+		}
+	}
+	if s.author == "" {
+		if m := pdfAuthor.FindSubmatchIndex(b); m != nil {
+			s.author = pdfString(b[m[2]:])
+		}
+	}
+	if s.xmpAuthor == "" {
+		if m := xmpCreator.FindSubmatch(b); m != nil {
+			s.xmpAuthor = text(bytes.TrimSpace(m[1]))
+		}
+	}
+	if !s.encrypted && pdfEncrypt.Match(b) {
+		s.encrypted = true
+	}
+}
+
+// objStm inflates the object stream whose data starts at off and searches
+// the objects in it.
+func (s *pdfScan) objStm(r io.ReaderAt, off, size int64) {
+	zr, err := zlib.NewReader(io.NewSectionReader(r, off, size-off))
+	if err != nil {
+		return
+	}
+	defer zr.Close()
+	b, _ := io.ReadAll(io.LimitReader(zr, maxObjStm))
+	s.search(b)
+}
+
+// dictBefore returns the dictionary ending just before end, which is the
+// index after its closing ">>".
+func dictBefore(b []byte, end int) []byte {
+	depth := 0
+	for i := end - 1; i > 0; i-- {
+		switch {
+		case b[i] == '>' && b[i-1] == '>':
+			depth++
+			i--
+		case b[i] == '<' && b[i-1] == '<':
+			depth--
+			i--
+			if depth == 0 {
+				return b[i:end]
+			}
+		}
+	}
+	return nil
+}
+
+// dictAround returns the innermost dictionary around position at in b.
+func dictAround(b []byte, at int) []byte {
+	start, depth := -1, 0
+	for i := at - 1; i > 0; i-- {
+		if b[i] == '>' && b[i-1] == '>' {
+			depth++
+			i--
+		} else if b[i] == '<' && b[i-1] == '<' {
+			i--
+			if depth == 0 {
+				start = i
+				break
+			}
+			depth--
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+	depth = 0
+	for i := start; i+1 < len(b); i++ {
+		if b[i] == '<' && b[i+1] == '<' {
+			depth++
+			i++
+		} else if b[i] == '>' && b[i+1] == '>' {
+			depth--
+			i++
+			if depth == 0 {
+				return b[start : i+1]
+			}
+		}
+	}
+	return nil
+}
+
+// pdfString decodes the literal "(...)" or hex "<...>" string at the start
+// of b. Strings starting with a byte order mark are UTF-16; others are
+// taken as Latin-1, close enough to PDFDocEncoding for names.
+func pdfString(b []byte) string {
+	var raw []byte
+	if b[0] == '<' {
+		end := bytes.IndexByte(b, '>')
+		if end < 0 {
+			return ""
+		}
+		digits := bytes.Map(func(r rune) rune {
+			if r == ' ' || r == '\n' || r == '\r' || r == '\t' {
+				return -1
+			}
+			return r
+		}, b[1:end])
+		if len(digits)%2 == 1 {
+			digits = append(digits, '0')
+		}
+		raw = make([]byte, len(digits)/2)
+		if _, err := hex.Decode(raw, digits); err != nil {
+			return ""
+		}
+	} else {
+		depth := 0
+	loop:
+		for i := 0; i < len(b); i++ {
+			c := b[i]
+			switch c {
+			case '(':
+				depth++
+				if depth == 1 {
+					continue
+				}
+			case ')':
+				depth--
+				if depth == 0 {
+					break loop
+				}
+			case '\\':
+				i++
+				if i == len(b) {
+					break loop
+				}
+				switch c = b[i]; c {
+				case 'n':
+					c = '\n'
+				case 'r':
+					c = '\r'
+				case 't':
+					c = '\t'
+				case 'b':
+					c = '\b'
+				case 'f':
+					c = '\f'
+				case '\r', '\n':
+					continue // line continuation
+				default:
+					if c >= '0' && c <= '7' {
+						v := int(c - '0')
+						for j := 0; j < 2 && i+1 < len(b) && b[i+1] >= '0' && b[i+1] <= '7'; j++ {
+							i++
+							v = v*8 + int(b[i]-'0')
+						}
+						c = byte(v)
+					}
+				}
+			}
+			raw = append(raw, c)
+		}
+	}
+	if len(raw) >= 2 && raw[0] == 0xfe && raw[1] == 0xff {
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return utf16Text(units)
+	}
+	return text(raw)
+}
@@ -0,0 +1,176 @@
+// Package estimate extrapolates the size of a directory tree from a sample
+// of random root-to-leaf probes instead of walking all of it.
+//
+// Each probe descends from the root, picking one subdirectory uniformly at
+// random at every level. Weighting what it sees in a directory by the product
+// of the branching factors above it gives an unbiased estimate of the tree
+// total (Knuth, "Estimating the efficiency of backtrack programs", 1975).
+// Averaging many probes narrows the estimate, and their spread gives the
+// confidence interval.
+package estimate
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Options bound the sampling. The estimate stops after Samples probes or
+// when Duration has elapsed, whichever comes first (defaults 100000 and 10s).
+type Options struct {
+	Samples  int
+	Duration time.Duration
+	// Skip prunes directories from the probes, like the scanner's skip rules.
+	Skip func(path string) bool
+	Rand *rand.Rand
+}
+
+// Value is an estimate with a 95% confidence interval.
+type Value struct {
+	Estimate float64
+	Low      float64
+	High     float64
+}
+
+type Result struct {
+	Files Value
+	Dirs  Value
+	Bytes Value
+	// Samples is the number of probes taken and DirsRead the number of
+	// distinct directories they listed.
+	Samples  int
+	DirsRead int
+	Elapsed  time.Duration
+}
+
+// dirInfo is what a probe needs from one directory, cached because the
+// upper levels are visited by almost every probe.
+type dirInfo struct {
+	files   float64
+	bytes   float64
+	subdirs []string
+}
+
+type sampler struct {
+	skip  func(string) bool
+	cache map[string]*dirInfo
+}
+
+func Run(root string, opts Options) (*Result, error) {
+	if opts.Samples <= 0 {
+		opts.Samples = 100000
+	}
+	if opts.Duration <= 0 {
+		opts.Duration = 10 * time.Second
+	}
+	rng := opts.Rand
+	if rng == nil {
+		rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	s := &sampler{skip: opts.Skip, cache: make(map[string]*dirInfo)}
+	if _, err := s.read(root); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	var files, dirs, bytes stats
+	n := 0
+	for n < opts.Samples && (n < 2 || time.Since(start) < opts.Duration) {
+		f, d, b := s.probe(root, rng)
+		files.add(f)
+		dirs.add(d)
+		bytes.add(b)
+		n++
+	}
+
+	return &Result{
+		Files:    files.value(),
+		Dirs:     dirs.value(),
+		Bytes:    bytes.value(),
+		Samples:  n,
+		DirsRead: len(s.cache),
+		Elapsed:  time.Since(start),
+	}, nil
+}
+
+// probe walks one random path from root and returns its estimates of the
+// number of files, directories and bytes in the tree.
+func (s *sampler) probe(root string, rng *rand.Rand) (files, dirs, bytes float64) {
+	weight := 1.0
+	dir := root
+	for {
+		info, err := s.read(dir)
+		if err != nil {
+			// An unreadable directory still counts as one directory.
+			return files, dirs + weight, bytes
+		}
+		files += weight * info.files
+		bytes += weight * info.bytes
+		dirs += weight
+		if len(info.subdirs) == 0 {
+			return files, dirs, bytes
+		}
+		weight *= float64(len(info.subdirs))
+		dir = info.subdirs[rng.Intn(len(info.subdirs))]
+	}
+}
+
+func (s *sampler) read(dir string) (*dirInfo, error) {
+	if info, ok := s.cache[dir]; ok {
+		return info, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &dirInfo{}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if e.IsDir() {
+			if s.skip == nil || !s.skip(path) {
+				info.subdirs = append(info.subdirs, path)
+			}
+			continue
+		}
+		info.files++
+		if e.Type().IsRegular() {
+			if fi, err := e.Info(); err == nil {
+				info.bytes += float64(fi.Size())
+			}
+		}
+	}
+	s.cache[dir] = info
+	return info, nil
+}
+
+// stats accumulates a running mean and variance (Welford's method).
+type stats struct {
+	n    float64
+	mean float64
+	m2   float64
+}
+
+func (s *stats) add(x float64) {
+	s.n++
+	delta := x - s.mean
+	s.mean += delta / s.n
+	s.m2 += delta * (x - s.mean)
+}
+
+// value returns the mean with a normal-approximation 95% interval, clamped
+// at zero since totals cannot be negative.
+func (s *stats) value() Value {
+	if s.n < 2 {
+		return Value{Estimate: s.mean, Low: s.mean, High: s.mean}
+	}
+	stderr := math.Sqrt(s.m2/(s.n-1)) / math.Sqrt(s.n)
+	return Value{
+		Estimate: s.mean,
+		Low:      math.Max(0, s.mean-1.96*stderr),
+		High:     s.mean + 1.96*stderr,
+	}
+}
@@ -0,0 +1,84 @@
+package estimate
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBalancedTreeIsExact(t *testing.T) {
+	// Every probe of a balanced tree sees the same thing, so the estimate
+	// is exact and the interval has no width.
+	root := t.TempDir()
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 2; j++ {
+			writeFile(t, filepath.Join(root, fmt.Sprint("d", i), fmt.Sprint("f", j)), 10)
+		}
+	}
+	writeFile(t, filepath.Join(root, "top"), 5)
+
+	res, err := Run(root, Options{Samples: 20, Rand: rand.New(rand.NewSource(1))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Files.Estimate != 7 || res.Dirs.Estimate != 4 || res.Bytes.Estimate != 65 {
+		t.Errorf("Unexpected estimate %+v", res)
+	}
+	if res.Files.Low != res.Files.High {
+		t.Errorf("Expected an exact interval, got %+v", res.Files)
+	}
+}
+
+func TestUnbalancedTreeBounds(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 40; i++ {
+		writeFile(t, filepath.Join(root, "big", fmt.Sprint("f", i)), 1)
+	}
+	writeFile(t, filepath.Join(root, "small", "f"), 1)
+	writeFile(t, filepath.Join(root, "skipped", "f"), 1)
+
+	skip := func(path string) bool { return filepath.Base(path) == "skipped" }
+	res, err := Run(root, Options{Samples: 2000, Skip: skip, Rand: rand.New(rand.NewSource(1))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 41 files in truth; each probe says 2 or 80.
+	if res.Files.Low > 41 || res.Files.High < 41 {
+		t.Errorf("True file count 41 outside the interval %+v", res.Files)
+	}
+	if res.DirsRead != 3 {
+		t.Errorf("Expected 3 directories read, got %d", res.DirsRead)
+	}
+}
+
+func TestMissingRoot(t *testing.T) {
+	if _, err := Run(filepath.Join(t.TempDir(), "missing"), Options{}); err == nil {
+		t.Error("Expected an error for a missing root")
+	}
+}
+
+func TestParseSpotlight(t *testing.T) {
+	out := "/Users/me/a.txt   kMDItemFSSize = 120\n" +
+		"/Users/me/dir with spaces/b.bin   kMDItemFSSize = 4096\n" +
+		"/Users/me/c   kMDItemFSSize = (null)\n"
+	files, bytes, err := parseSpotlight(strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files != 3 || bytes != 4216 {
+		t.Errorf("Got %v files, %v bytes, expected 3 files, 4216 bytes", files, bytes)
+	}
+}
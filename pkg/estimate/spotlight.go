@@ -0,0 +1,88 @@
+package estimate
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	spotlightFiles = "kMDItemFSName == '*' && kMDItemContentType != 'public.folder'"
+	spotlightDirs  = "kMDItemContentType == 'public.folder'"
+	spotlightSize  = "kMDItemFSSize = "
+)
+
+// Spotlight answers from the macOS Spotlight index instead of the disk: it
+// is near-instant, but only as complete and current as the index. Folders
+// excluded from Spotlight, unindexed volumes and files created since the
+// last index update are missed. The values have no interval; Low and High
+// equal the estimate.
+func Spotlight(root string) (*Result, error) {
+	if _, err := exec.LookPath("mdfind"); err != nil {
+		return nil, errors.New("the Spotlight index is only available on macOS")
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+
+	out, err := exec.Command("mdfind", "-count", "-onlyin", abs, spotlightDirs).Output()
+	if err != nil {
+		return nil, fmt.Errorf("mdfind: %w", err)
+	}
+	dirs, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return nil, fmt.Errorf("mdfind: unexpected count %q", out)
+	}
+
+	cmd := exec.Command("mdfind", "-onlyin", abs, "-attr", "kMDItemFSSize", spotlightFiles)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("mdfind: %w", err)
+	}
+	files, bytes, err := parseSpotlight(stdout)
+	if werr := cmd.Wait(); err == nil && werr != nil {
+		err = fmt.Errorf("mdfind: %w", werr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	exact := func(v float64) Value { return Value{Estimate: v, Low: v, High: v} }
+	return &Result{
+		Files:   exact(files),
+		Dirs:    exact(dirs),
+		Bytes:   exact(bytes),
+		Elapsed: time.Since(start),
+	}, nil
+}
+
+// parseSpotlight totals the output of mdfind -attr kMDItemFSSize, one
+// "<path>   kMDItemFSSize = <n>" line per file. Sizes the index doesn't
+// know are printed as "(null)" and count as zero.
+func parseSpotlight(r io.Reader) (files, bytes float64, err error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		i := strings.LastIndex(line, spotlightSize)
+		if i < 0 {
+			continue
+		}
+		files++
+		if n, err := strconv.ParseFloat(strings.TrimSpace(line[i+len(spotlightSize):]), 64); err == nil {
+			bytes += n
+		}
+	}
+	return files, bytes, sc.Err()
+}
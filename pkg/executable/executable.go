@@ -0,0 +1,266 @@
+// Package executable identifies native executables and shared libraries in
+// the ELF, PE and Mach-O formats by their magic bytes, and reads what they
+// were built for and whether they load shared libraries.
+package executable
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Info is what Probe found out about a native binary.
+type Info struct {
+	Format string // "ELF", "PE", "Mach-O" or "Mach-O universal"
+	// Kind is "executable", "shared library", "object", "bundle" (a
+	// Mach-O plugin) or "core dump".
+	Kind string
+	// Arch is the architecture the code is for, named as Go's GOARCH
+	// names it, e.g. "amd64" or "arm64". Universal binaries list theirs
+	// joined with "+".
+	Arch string
+	// Linkage is "dynamic" for executables that load shared libraries and
+	// "static" for those that don't; it is empty for other kinds.
+	Linkage string
+}
+
+// Probe identifies the file at path. It returns nil and no error for files
+// that are not a native binary in a format it knows, and for damaged or
+// truncated ones.
+func Probe(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Read is Probe for the contents of r.
+func Read(r io.ReaderAt) (*Info, error) {
+	head := make([]byte, 8)
+	n, err := r.ReadAt(head, 0)
+	if n < len(head) {
+		if err == io.EOF {
+			err = nil
+		}
+		return nil, err
+	}
+	var info *Info
+	switch {
+	case bytes.HasPrefix(head, []byte(elf.ELFMAG)):
+		info, err = readELF(r)
+	case bytes.HasPrefix(head, []byte("MZ")):
+		info, err = readPE(r)
+	case bytes.HasPrefix(head, []byte("\xfe\xed\xfa\xce")), bytes.HasPrefix(head, []byte("\xce\xfa\xed\xfe")),
+		bytes.HasPrefix(head, []byte("\xfe\xed\xfa\xcf")), bytes.HasPrefix(head, []byte("\xcf\xfa\xed\xfe")):
+		info, err = readMachO(r)
+	case bytes.HasPrefix(head, []byte("\xca\xfe\xba\xbe")):
+		// Java class files start the same; where a universal binary
+		// counts its architectures they have their version, which is
+		// well above any real count.
+		if binary.BigEndian.Uint32(head[4:]) <= 20 {
+			info, err = readFat(r)
+		}
+	}
+	if err != nil {
+		// The debug packages report malformed headers and short reads
+		// alike; either way the file is not a usable binary.
+		return nil, nil
+	}
+	return info, nil
+}
+
+func readELF(r io.ReaderAt) (*Info, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{Format: "ELF", Arch: elfArch(f)}
+	interp := false
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_INTERP {
+			interp = true
+		}
+	}
+	switch f.Type {
+	case elf.ET_EXEC:
+		info.Kind = "executable"
+	case elf.ET_DYN:
+		// Position-independent executables are shared objects too; they
+		// name a dynamic loader or, when static, carry the PIE flag.
+		info.Kind = "shared library"
+		if flags, _ := f.DynValue(elf.DT_FLAGS_1); interp || len(flags) > 0 && flags[0]&uint64(elf.DF_1_PIE) != 0 {
+			info.Kind = "executable"
+		}
+	case elf.ET_REL:
+		info.Kind = "object"
+	case elf.ET_CORE:
+		info.Kind = "core dump"
+	default:
+		return nil, nil
+	}
+	if info.Kind == "executable" {
+		libs, _ := f.ImportedLibraries()
+		info.Linkage = linkage(interp || len(libs) > 0)
+	}
+	return info, nil
+}
+
+func elfArch(f *elf.File) string {
+	switch f.Machine {
+	case elf.EM_X86_64:
+		return "amd64"
+	case elf.EM_386:
+		return "386"
+	case elf.EM_AARCH64:
+		return "arm64"
+	case elf.EM_ARM:
+		return "arm"
+	case elf.EM_RISCV:
+		if f.Class == elf.ELFCLASS32 {
+			return "riscv"
+		}
+		return "riscv64"
+	case elf.EM_PPC64:
+		if f.Data == elf.ELFDATA2LSB {
+			return "ppc64le"
+		}
+		return "ppc64"
+	case elf.EM_PPC:
+		return "ppc"
+	case elf.EM_S390:
+		return "s390x"
+	case elf.EM_MIPS:
+		arch := "mips"
+		if f.Class == elf.ELFCLASS64 {
+			arch = "mips64"
+		}
+		if f.Data == elf.ELFDATA2LSB {
+			arch += "le"
+		}
+		return arch
+	case elf.EM_LOONGARCH:
+		return "loong64"
+	case elf.EM_SPARCV9:
+		return "sparc64"
+	}
+	return strings.ToLower(strings.TrimPrefix(f.Machine.String(), "EM_"))
+}
+
+func readPE(r io.ReaderAt) (*Info, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{Format: "PE", Kind: "executable", Arch: peArch(f.Machine)}
+	if f.Characteristics&pe.IMAGE_FILE_DLL != 0 {
+		info.Kind = "shared library"
+	} else {
+		info.Linkage = linkage(peImports(f))
+	}
+	return info, nil
+}
+
+// peImports reports whether f has an import table, naming the DLLs it
+// loads. pe.File.ImportedLibraries is not implemented.
+func peImports(f *pe.File) bool {
+	var dirs []pe.DataDirectory
+	switch h := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		dirs = h.DataDirectory[:min(h.NumberOfRvaAndSizes, 16)]
+	case *pe.OptionalHeader64:
+		dirs = h.DataDirectory[:min(h.NumberOfRvaAndSizes, 16)]
+	}
+	return len(dirs) > pe.IMAGE_DIRECTORY_ENTRY_IMPORT && dirs[pe.IMAGE_DIRECTORY_ENTRY_IMPORT].Size > 0
+}
+
+func peArch(machine uint16) string {
+	switch machine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return "amd64"
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return "386"
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		return "arm64"
+	case pe.IMAGE_FILE_MACHINE_ARMNT, pe.IMAGE_FILE_MACHINE_ARM, pe.IMAGE_FILE_MACHINE_THUMB:
+		return "arm"
+	case pe.IMAGE_FILE_MACHINE_IA64:
+		return "ia64"
+	case pe.IMAGE_FILE_MACHINE_RISCV64:
+		return "riscv64"
+	case pe.IMAGE_FILE_MACHINE_LOONGARCH64:
+		return "loong64"
+	}
+	return fmt.Sprintf("0x%04x", machine)
+}
+
+func readMachO(r io.ReaderAt) (*Info, error) {
+	f, err := macho.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	return machOInfo(f, "Mach-O", machOArch(f.Cpu))
+}
+
+func readFat(r io.ReaderAt) (*Info, error) {
+	f, err := macho.NewFatFile(r)
+	if err != nil {
+		return nil, err
+	}
+	archs := make([]string, len(f.Arches))
+	for i, a := range f.Arches {
+		archs[i] = machOArch(a.Cpu)
+	}
+	return machOInfo(f.Arches[0].File, "Mach-O universal", strings.Join(archs, "+"))
+}
+
+func machOInfo(f *macho.File, format, arch string) (*Info, error) {
+	info := &Info{Format: format, Arch: arch}
+	switch f.Type {
+	case macho.TypeExec:
+		info.Kind = "executable"
+		libs, _ := f.ImportedLibraries()
+		info.Linkage = linkage(len(libs) > 0)
+	case macho.TypeDylib:
+		info.Kind = "shared library"
+	case macho.TypeBundle:
+		info.Kind = "bundle"
+	case macho.TypeObj:
+		info.Kind = "object"
+	default:
+		return nil, nil
+	}
+	return info, nil
+}
+
+func machOArch(cpu macho.Cpu) string {
+	switch cpu {
+	case macho.CpuAmd64:
+		return "amd64"
+	case macho.Cpu386:
+		return "386"
+	case macho.CpuArm64:
+		return "arm64"
+	case macho.CpuArm:
+		return "arm"
+	case macho.CpuPpc64:
+		return "ppc64"
+	case macho.CpuPpc:
+		return "ppc"
+	}
+	return strings.ToLower(strings.TrimPrefix(cpu.String(), "Cpu"))
+}
+
+func linkage(dynamic bool) string {
+	if dynamic {
+		return "dynamic"
+	}
+	return "static"
+}
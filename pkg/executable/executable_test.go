@@ -0,0 +1,148 @@
+package executable
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"testing"
+)
+
+func probe(t *testing.T, data []byte) *Info {
+	t.Helper()
+	info, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+// elfFile returns a 64-bit ELF header of type typ for machine, followed by
+// a PT_INTERP program header if interp is set.
+func elfFile(typ elf.Type, machine elf.Machine, interp bool) []byte {
+	h := elf.Header64{
+		Type:      uint16(typ),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Ehsize:    64,
+		Phentsize: 56,
+	}
+	copy(h.Ident[:], elf.ELFMAG)
+	h.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	h.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	h.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	var progs []elf.Prog64
+	if interp {
+		h.Phoff, h.Phnum = 64, 1
+		progs = append(progs, elf.Prog64{Type: uint32(elf.PT_INTERP)})
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, h)
+	binary.Write(&buf, binary.LittleEndian, progs)
+	return buf.Bytes()
+}
+
+func TestELF(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want Info
+	}{
+		{"static", elfFile(elf.ET_EXEC, elf.EM_X86_64, false), Info{"ELF", "executable", "amd64", "static"}},
+		{"dynamic", elfFile(elf.ET_EXEC, elf.EM_AARCH64, true), Info{"ELF", "executable", "arm64", "dynamic"}},
+		{"pie", elfFile(elf.ET_DYN, elf.EM_X86_64, true), Info{"ELF", "executable", "amd64", "dynamic"}},
+		{"library", elfFile(elf.ET_DYN, elf.EM_RISCV, false), Info{"ELF", "shared library", "riscv64", ""}},
+		{"object", elfFile(elf.ET_REL, elf.EM_386, false), Info{"ELF", "object", "386", ""}},
+	} {
+		if info := probe(t, tc.data); info == nil || *info != tc.want {
+			t.Errorf("%s: got %+v, expected %+v", tc.name, info, tc.want)
+		}
+	}
+}
+
+// peFile returns a PE image for machine with the characteristics flags,
+// and an import table if imports is set.
+func peFile(machine, characteristics uint16, imports bool) []byte {
+	var buf bytes.Buffer
+	dos := make([]byte, 64)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], 64)
+	buf.Write(dos)
+	buf.WriteString("PE\x00\x00")
+	opt := pe.OptionalHeader64{Magic: 0x20b, NumberOfRvaAndSizes: 16}
+	if imports {
+		opt.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_IMPORT] = pe.DataDirectory{VirtualAddress: 0x2000, Size: 40}
+	}
+	binary.Write(&buf, binary.LittleEndian, pe.FileHeader{
+		Machine:              machine,
+		SizeOfOptionalHeader: uint16(binary.Size(opt)),
+		Characteristics:      characteristics | pe.IMAGE_FILE_EXECUTABLE_IMAGE,
+	})
+	binary.Write(&buf, binary.LittleEndian, opt)
+	return buf.Bytes()
+}
+
+func TestPE(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want Info
+	}{
+		{"dynamic", peFile(pe.IMAGE_FILE_MACHINE_AMD64, 0, true), Info{"PE", "executable", "amd64", "dynamic"}},
+		{"static", peFile(pe.IMAGE_FILE_MACHINE_ARM64, 0, false), Info{"PE", "executable", "arm64", "static"}},
+		{"dll", peFile(pe.IMAGE_FILE_MACHINE_I386, pe.IMAGE_FILE_DLL, true), Info{"PE", "shared library", "386", ""}},
+	} {
+		if info := probe(t, tc.data); info == nil || *info != tc.want {
+			t.Errorf("%s: got %+v, expected %+v", tc.name, info, tc.want)
+		}
+	}
+	// A DOS program, or any file starting with "MZ", is not a PE image.
+	if info := probe(t, []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00")); info != nil {
+		t.Errorf("DOS program: got %+v", info)
+	}
+}
+
+// machOFile returns a 64-bit Mach-O header without load commands.
+func machOFile(typ macho.Type, cpu macho.Cpu) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, macho.FileHeader{Magic: macho.Magic64, Cpu: cpu, Type: typ})
+	buf.Write(make([]byte, 4)) // reserved
+	return buf.Bytes()
+}
+
+func TestMachO(t *testing.T) {
+	if info := probe(t, machOFile(macho.TypeExec, macho.CpuArm64)); info == nil || *info != (Info{"Mach-O", "executable", "arm64", "static"}) {
+		t.Errorf("executable: got %+v", info)
+	}
+	if info := probe(t, machOFile(macho.TypeDylib, macho.CpuAmd64)); info == nil || *info != (Info{"Mach-O", "shared library", "amd64", ""}) {
+		t.Errorf("dylib: got %+v", info)
+	}
+
+	arm, amd := machOFile(macho.TypeExec, macho.CpuArm64), machOFile(macho.TypeExec, macho.CpuAmd64)
+	var fat bytes.Buffer
+	binary.Write(&fat, binary.BigEndian, []uint32{macho.MagicFat, 2,
+		uint32(macho.CpuArm64), 0, 0x1000, uint32(len(arm)), 12,
+		uint32(macho.CpuAmd64), 0, 0x2000, uint32(len(amd)), 12,
+	})
+	fat.Write(make([]byte, 0x1000-fat.Len()))
+	fat.Write(arm)
+	fat.Write(make([]byte, 0x2000-fat.Len()))
+	fat.Write(amd)
+	if info := probe(t, fat.Bytes()); info == nil || *info != (Info{"Mach-O universal", "executable", "arm64+amd64", "static"}) {
+		t.Errorf("universal: got %+v", info)
+	}
+
+	// Java class files share the universal binary magic.
+	if info := probe(t, []byte("\xca\xfe\xba\xbe\x00\x00\x00\x34\x00\x10")); info != nil {
+		t.Errorf("class file: got %+v", info)
+	}
+}
+
+func TestNotExecutable(t *testing.T) {
+	for _, data := range []string{"", "\x7fEL", "hello, world\n", "\x7fELF\x02\x01\x01\x00garbage"} {
+		if info := probe(t, []byte(data)); info != nil {
+			t.Errorf("%q: got %+v", data, info)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// Package hashcache remembers the SHA-256 of files between runs, so that
+// hashing a mostly unchanged tree again only reads the files that changed.
+// A hash is reused while the file's size, mtime, device and inode are what
+// they were when it was hashed.
+package hashcache
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const magic = "FCHC1\n"
+
+// MaxAge is how long an entry is kept without being used. Entries of
+// deleted files and of trees no longer hashed are dropped on Save once
+// they are older.
+const MaxAge = 30 * 24 * time.Hour
+
+// settle is how recently a file may have been modified for its hash to be
+// remembered. A file still being written could change again within the
+// same mtime tick, and the cache would then hold a hash of old content.
+const settle = 2 * time.Second
+
+type entry struct {
+	size  int64
+	mtime int64
+	dev   uint64
+	ino   uint64
+	used  int64 // Unix seconds
+	sum   [32]byte
+}
+
+// Cache maps absolute paths to the hashes of their content. Its methods are
+// safe for concurrent use.
+type Cache struct {
+	name string
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	dirty   bool
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// DefaultPath is where the cache is kept by default, under the user cache
+// directory.
+func DefaultPath() (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cache, "file-counter", "hashes"), nil
+}
+
+// New returns an empty cache that Save writes to name.
+func New(name string) *Cache {
+	return &Cache{name: name, entries: map[string]*entry{}}
+}
+
+// Open reads the cache in name. A missing file is an empty cache.
+func Open(name string) (*Cache, error) {
+	c := New(name)
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := c.read(f); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return c, nil
+}
+
+func (c *Cache) read(r io.Reader) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(zr)
+	head := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, head); err != nil || string(head) != magic {
+		return errors.New("not a hash cache")
+	}
+	var prev []byte
+	for {
+		shared, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return unexpected(err)
+		}
+		if shared > uint64(len(prev)) || n > 1<<16 {
+			return errors.New("corrupt entry")
+		}
+		path := append(prev[:shared:shared], make([]byte, n)...)
+		if _, err := io.ReadFull(br, path[shared:]); err != nil {
+			return unexpected(err)
+		}
+		e := &entry{}
+		for _, v := range []*int64{&e.size, &e.mtime, &e.used} {
+			if *v, err = binary.ReadVarint(br); err != nil {
+				return unexpected(err)
+			}
+		}
+		for _, v := range []*uint64{&e.dev, &e.ino} {
+			if *v, err = binary.ReadUvarint(br); err != nil {
+				return unexpected(err)
+			}
+		}
+		if _, err := io.ReadFull(br, e.sum[:]); err != nil {
+			return unexpected(err)
+		}
+		c.entries[string(path)] = e
+		prev = path
+	}
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Lookup returns the hash remembered for path, if the file described by
+// info is still the one that was hashed.
+func (c *Cache) Lookup(path string, info os.FileInfo) (string, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	dev, ino := fileID(info)
+	c.mu.Lock()
+	e := c.entries[abs]
+	ok := e != nil && e.size == info.Size() && e.mtime == info.ModTime().UnixNano() && e.dev == dev && e.ino == ino
+	if ok {
+		// Only rewrite the cache for a day's change in use, or every
+		// run would save it.
+		if now := time.Now().Unix(); now-e.used > 24*60*60 {
+			e.used, c.dirty = now, true
+		}
+	}
+	c.mu.Unlock()
+	if !ok {
+		c.misses.Add(1)
+		return "", false
+	}
+	c.hits.Add(1)
+	return hex.EncodeToString(e.sum[:]), true
+}
+
+// Store remembers the hex SHA-256 hash of the file at path described by
+// info. Files modified in the last two seconds are not remembered.
+func (c *Cache) Store(path string, info os.FileInfo, hash string) {
+	if time.Since(info.ModTime()) < settle {
+		return
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	e := &entry{size: info.Size(), mtime: info.ModTime().UnixNano(), used: time.Now().Unix()}
+	if n, err := hex.Decode(e.sum[:], []byte(hash)); err != nil || n != len(e.sum) {
+		return
+	}
+	e.dev, e.ino = fileID(info)
+	c.mu.Lock()
+	c.entries[abs] = e
+	c.dirty = true
+	c.mu.Unlock()
+}
+
+// Stats returns how many lookups found a hash and how many did not.
+func (c *Cache) Stats() (hits, misses int64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+// Len returns the number of remembered hashes.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Save writes the cache back, replacing the file atomically, unless
+// nothing changed since it was opened.
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cutoff := time.Now().Add(-MaxAge).Unix()
+	for path, e := range c.entries {
+		if e.used < cutoff {
+			delete(c.entries, path)
+			c.dirty = true
+		}
+	}
+	if !c.dirty {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(c.name), 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(c.name), filepath.Base(c.name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	err = c.write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+func (c *Cache) write(w io.Writer) error {
+	paths := make([]string, 0, len(c.entries))
+	for path := range c.entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+	bw.WriteString(magic)
+	var buf []byte
+	prev := ""
+	for _, path := range paths {
+		e := c.entries[path]
+		shared := 0
+		for shared < len(prev) && shared < len(path) && prev[shared] == path[shared] {
+			shared++
+		}
+		buf = binary.AppendUvarint(buf[:0], uint64(shared))
+		buf = binary.AppendUvarint(buf, uint64(len(path)-shared))
+		buf = append(buf, path[shared:]...)
+		buf = binary.AppendVarint(buf, e.size)
+		buf = binary.AppendVarint(buf, e.mtime)
+		buf = binary.AppendVarint(buf, e.used)
+		buf = binary.AppendUvarint(buf, e.dev)
+		buf = binary.AppendUvarint(buf, e.ino)
+		buf = append(buf, e.sum[:]...)
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+		prev = path
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
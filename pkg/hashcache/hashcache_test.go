@@ -0,0 +1,107 @@
+package hashcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const abcSHA256 = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+
+// writeOld writes a file with an mtime an hour ago, so that it has settled.
+func writeOld(t *testing.T, path, content string) os.FileInfo {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	info := writeOld(t, file, "abc")
+
+	name := filepath.Join(dir, "cache", "hashes")
+	c, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Lookup(file, info); ok {
+		t.Fatal("Empty cache had a hash")
+	}
+	c.Store(file, info, abcSHA256)
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 1 {
+		t.Fatalf("Expected 1 entry after reopening, got %d", c.Len())
+	}
+	if hash, ok := c.Lookup(file, info); !ok || hash != abcSHA256 {
+		t.Errorf("Lookup = %q, %v; want the stored hash", hash, ok)
+	}
+
+	// Same size, new mtime.
+	info = writeOld(t, file, "xyz")
+	later := info.ModTime().Add(time.Minute)
+	os.Chtimes(file, later, later)
+	info, _ = os.Lstat(file)
+	if _, ok := c.Lookup(file, info); ok {
+		t.Error("Lookup returned the hash of a modified file")
+	}
+	if hits, misses := c.Stats(); hits != 1 || misses != 1 {
+		t.Errorf("Stats = %d hits, %d misses; want 1, 1", hits, misses)
+	}
+
+	// A file written just now may still change within its mtime tick.
+	fresh := filepath.Join(dir, "fresh.txt")
+	if err := os.WriteFile(fresh, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	freshInfo, _ := os.Lstat(fresh)
+	c.Store(fresh, freshInfo, abcSHA256)
+	if _, ok := c.Lookup(fresh, freshInfo); ok {
+		t.Error("A file modified just now was remembered")
+	}
+}
+
+func TestCacheExpires(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	info := writeOld(t, file, "abc")
+
+	c := New(filepath.Join(dir, "hashes"))
+	c.Store(file, info, abcSHA256)
+	abs, _ := filepath.Abs(file)
+	c.entries[abs].used = time.Now().Add(-MaxAge - time.Hour).Unix()
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 0 {
+		t.Errorf("Expected the unused entry to be dropped, %d left", c.Len())
+	}
+}
+
+func TestOpenCorrupt(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "hashes")
+	if err := os.WriteFile(name, []byte("not gzip"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(name); err == nil {
+		t.Error("Expected an error opening a corrupt cache")
+	}
+}
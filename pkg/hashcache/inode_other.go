@@ -0,0 +1,11 @@
+//go:build !unix
+
+package hashcache
+
+import "os"
+
+// fileID is not available on this platform, so only size and mtime are
+// compared.
+func fileID(info os.FileInfo) (dev, ino uint64) {
+	return 0, 0
+}
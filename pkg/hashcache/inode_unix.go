@@ -0,0 +1,18 @@
+//go:build unix
+
+package hashcache
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID returns the device and inode of info, so that a file replaced by
+// another of the same size and mtime is hashed again.
+func fileID(info os.FileInfo) (dev, ino uint64) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return uint64(st.Dev), uint64(st.Ino)
+}
@@ -0,0 +1,66 @@
+// Package hashset loads sets of known file hashes, such as an NSRL-style
+// list of known-good operating system files or a blocklist of known-bad
+// ones, to check scanned files against.
+package hashset
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Set maps lowercase hex SHA-256 hashes to a label, such as the file name
+// or threat name given in the list; the label may be empty.
+type Set map[string]string
+
+// Load reads a hash list. Each line starts with a SHA-256 hash, optionally
+// quoted, followed by whitespace or a comma and an optional label, so
+// sha256sum output and CSV exports with the hash in the first column both
+// work. Lines whose first field isn't a SHA-256 hash, such as CSV headers
+// and # comments, are skipped.
+func Load(name string) (Set, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := Set{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		i := strings.IndexAny(line, " \t,")
+		if i < 0 {
+			i = len(line)
+		}
+		hash := strings.ToLower(strings.Trim(line[:i], `"`))
+		if !valid(hash) {
+			continue
+		}
+		label := strings.TrimLeft(line[i:], " \t,")
+		label = strings.TrimPrefix(label, "*") // sha256sum binary mode
+		s[hash] = strings.Trim(label, `"`)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(s) == 0 {
+		return nil, fmt.Errorf("%s: no SHA-256 hashes found", name)
+	}
+	return s, nil
+}
+
+func valid(hash string) bool {
+	if len(hash) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// Lookup reports whether hash is in the set, and its label.
+func (s Set) Lookup(hash string) (label string, ok bool) {
+	label, ok = s[strings.ToLower(hash)]
+	return label, ok
+}
@@ -0,0 +1,40 @@
+package hashset
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	empty = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	hello = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+)
+
+func TestLoad(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "list")
+	os.WriteFile(name, []byte(`"SHA-256","FileName"
+"`+empty+`","empty.txt"
+`+hello+` *hello
+# not a hash
+abc123 short
+`), 0644)
+	s, err := Load(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s) != 2 {
+		t.Errorf("Got %d hashes, expected 2", len(s))
+	}
+	if label, ok := s.Lookup(empty); !ok || label != "empty.txt" {
+		t.Errorf("Got %q, %v for the CSV line", label, ok)
+	}
+	if label, ok := s.Lookup("2CF24DBA5FB0A30E26E83B2AC5B9E29E1B161E5C1FA7425E73043362938B9824"); !ok || label != "hello" {
+		t.Errorf("Got %q, %v for the sha256sum line", label, ok)
+	}
+
+	os.WriteFile(name, []byte("nothing here\n"), 0644)
+	if _, err := Load(name); err == nil {
+		t.Error("Expected a list without hashes to be rejected")
+	}
+}
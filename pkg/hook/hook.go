@@ -0,0 +1,203 @@
+// Package hook lets users classify scanned files without forking the
+// scanner: an external command or a registered Go function is called for
+// every file matching a set of globs, a bounded number at a time, and the
+// labels it returns are tallied.
+package hook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"file-counter/pkg/scanner"
+)
+
+// Func classifies one file, returning a label such as "invoice" or
+// "image/png"; an empty label leaves the file unclassified. It is called
+// from several goroutines at once.
+type Func func(ctx context.Context, rec *scanner.FileRecord) (string, error)
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]Func{}
+)
+
+// Register makes fn available under name, typically from an init
+// function. It panics if name is already registered.
+func Register(name string, fn Func) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := registry[name]; dup {
+		panic("hook: Register called twice for " + name)
+	}
+	registry[name] = fn
+}
+
+// Lookup returns the function registered under name.
+func Lookup(name string) (Func, bool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	fn, ok := registry[name]
+	return fn, ok
+}
+
+// Names returns the registered names, sorted.
+func Names() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Exec returns a Func that runs argv with the file's path appended and
+// uses the first line of its output as the label. A command that exits
+// non-zero or runs longer than timeout fails for that file.
+func Exec(argv []string, timeout time.Duration) Func {
+	return func(ctx context.Context, rec *scanner.FileRecord) (string, error) {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		cmd := exec.CommandContext(ctx, argv[0], append(argv[1:], rec.Path)...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return "", fmt.Errorf("%v: %s", err, msg)
+			}
+			return "", err
+		}
+		label, _, _ := strings.Cut(string(out), "\n")
+		return strings.TrimSpace(label), nil
+	}
+}
+
+// Count is the files given one label.
+type Count struct {
+	Label string
+	Files int64
+	Bytes int64
+}
+
+// Runner is a scanner.Sink that calls Func for matching regular files.
+// Write returns as soon as a call has started, blocking only while Jobs
+// calls are already running, which slows the scan down to the pace of the
+// hook rather than queueing without bound.
+type Runner struct {
+	Func Func
+	// Match holds globs for the base name of files to classify; with none,
+	// every regular file is.
+	Match []string
+	// OnResult, if set, is called with every label, one call at a time.
+	OnResult func(rec *scanner.FileRecord, label string)
+
+	ctx  context.Context
+	sem  chan struct{}
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	seen int64
+
+	counts  map[string]*Count
+	errors  int64
+	lastErr error
+}
+
+// NewRunner returns a Runner calling fn for up to jobs files at a time.
+// Calls still running when ctx is cancelled see it cancelled.
+func NewRunner(ctx context.Context, fn Func, jobs int) *Runner {
+	return &Runner{Func: fn, ctx: ctx, sem: make(chan struct{}, max(1, jobs)), counts: map[string]*Count{}}
+}
+
+func (r *Runner) matches(rec *scanner.FileRecord) bool {
+	if rec.IsDir || !rec.Mode.IsRegular() || rec.CloudOnly {
+		return false
+	}
+	if len(r.Match) == 0 {
+		return true
+	}
+	name := filepath.Base(rec.Path)
+	for _, pat := range r.Match {
+		if ok, _ := filepath.Match(pat, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Runner) Write(rec *scanner.FileRecord) error {
+	if !r.matches(rec) {
+		return nil
+	}
+	select {
+	case r.sem <- struct{}{}:
+	case <-r.ctx.Done():
+		return nil
+	}
+	r.wg.Add(1)
+	go func() {
+		defer func() { <-r.sem; r.wg.Done() }()
+		label, err := r.Func(r.ctx, rec)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.seen++
+		if err != nil {
+			r.errors++
+			r.lastErr = fmt.Errorf("%s: %w", rec.Path, err)
+			return
+		}
+		if label == "" {
+			return
+		}
+		c := r.counts[label]
+		if c == nil {
+			c = &Count{Label: label}
+			r.counts[label] = c
+		}
+		c.Files++
+		c.Bytes += rec.Size
+		if r.OnResult != nil {
+			r.OnResult(rec, label)
+		}
+	}()
+	return nil
+}
+
+// Result is the outcome of a run.
+type Result struct {
+	Files   int64 // files the hook was called for
+	Counts  []Count
+	Errors  int64
+	LastErr error
+}
+
+// Wait waits for the running calls and returns the labels given, the
+// most common first.
+func (r *Runner) Wait() Result {
+	r.wg.Wait()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := Result{Files: r.seen, Errors: r.errors, LastErr: r.lastErr}
+	for _, c := range r.counts {
+		res.Counts = append(res.Counts, *c)
+	}
+	sort.Slice(res.Counts, func(i, j int) bool {
+		a, b := res.Counts[i], res.Counts[j]
+		if a.Files != b.Files {
+			return a.Files > b.Files
+		}
+		return a.Label < b.Label
+	})
+	return res
+}
@@ -0,0 +1,79 @@
+package hook
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"file-counter/pkg/scanner"
+)
+
+func records(t *testing.T, files map[string]string) []*scanner.FileRecord {
+	t.Helper()
+	dir := t.TempDir()
+	var recs []*scanner.FileRecord
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, &scanner.FileRecord{Path: path, Size: int64(len(data)), Mode: 0644})
+	}
+	return recs
+}
+
+func TestRunner(t *testing.T) {
+	recs := records(t, map[string]string{"a.txt": "hello", "b.txt": "world", "c.png": "\x89PNG\r\n\x1a\n", "d.log": "x"})
+	var running, peak int32
+	fn := func(ctx context.Context, rec *scanner.FileRecord) (string, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for p := atomic.LoadInt32(&peak); n > p && !atomic.CompareAndSwapInt32(&peak, p, n); p = atomic.LoadInt32(&peak) {
+		}
+		time.Sleep(10 * time.Millisecond)
+		return sniffType(ctx, rec)
+	}
+	r := NewRunner(context.Background(), fn, 2)
+	r.Match = []string{"*.txt", "*.png"}
+	for _, rec := range recs {
+		r.Write(rec)
+	}
+	res := r.Wait()
+	if res.Files != 3 || res.Errors != 0 {
+		t.Fatalf("Got %+v", res)
+	}
+	want := []Count{{"text/plain", 2, 10}, {"image/png", 1, 8}}
+	if len(res.Counts) != 2 || res.Counts[0] != want[0] || res.Counts[1] != want[1] {
+		t.Errorf("Got counts %+v, expected %+v", res.Counts, want)
+	}
+	if peak > 2 {
+		t.Errorf("Got %d concurrent calls, expected at most 2", peak)
+	}
+	if _, ok := Lookup("mime"); !ok {
+		t.Error("Expected mime to be registered")
+	}
+}
+
+func TestExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	recs := records(t, map[string]string{"small": "x", "large": "xxxxxxxxxx"})
+	fn := Exec([]string{"sh", "-c", `if [ $(wc -c < "$1") -gt 5 ]; then echo large; else echo small; fi`, "sh"}, time.Minute)
+	for _, rec := range recs {
+		label, err := fn(context.Background(), rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if label != filepath.Base(rec.Path) {
+			t.Errorf("Got %q for %s", label, rec.Path)
+		}
+	}
+	if _, err := Exec([]string{"sh", "-c", "echo oops >&2; exit 3", "sh"}, time.Minute)(context.Background(), recs[0]); err == nil {
+		t.Error("Expected a failing command to fail")
+	}
+}
@@ -0,0 +1,35 @@
+package hook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"file-counter/pkg/scanner"
+)
+
+func init() {
+	Register("mime", sniffType)
+}
+
+// sniffType labels files with their media type, detected from the first
+// 512 bytes the way browsers do.
+func sniffType(ctx context.Context, rec *scanner.FileRecord) (string, error) {
+	f, err := os.Open(rec.Path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if n == 0 {
+		return "", nil
+	}
+	typ, _, _ := strings.Cut(http.DetectContentType(buf[:n]), ";")
+	return typ, nil
+}
@@ -0,0 +1,353 @@
+// Package image counts the files in container images and how much of each
+// layer is wasted on files that later layers overwrite or delete.
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Layer describes what one image layer adds. Shadowed counts its files
+// that later layers replace or delete: they still take up space in the
+// image but are not visible in the final filesystem.
+type Layer struct {
+	Digest    string
+	CreatedBy string
+	Files     int64
+	Dirs      int64
+	Bytes     int64
+	Whiteouts int64
+
+	ShadowedFiles int64
+	ShadowedBytes int64
+}
+
+// Image summarises a container image. Files and Bytes count what is
+// visible in the final filesystem; Wasted is the sum of the layers'
+// ShadowedBytes.
+type Image struct {
+	Tags   []string
+	Layers []Layer
+	Files  int64
+	Bytes  int64
+	Wasted int64
+}
+
+// maxJSONBlob bounds the size of configs and manifests kept in memory.
+const maxJSONBlob = 4 << 20
+
+// archive holds the parts of an image needed to assemble it, keyed by
+// their path in the archive or layout ("blobs/sha256/<hex>").
+type archive struct {
+	json   map[string][]byte
+	layers map[string]*layerContents
+	// links are symlinked blobs; old `docker save` archives store a layer
+	// shared by several images once and link to it.
+	links map[string]string
+}
+
+func newArchive() *archive {
+	return &archive{
+		json:   make(map[string][]byte),
+		layers: make(map[string]*layerContents),
+		links:  make(map[string]string),
+	}
+}
+
+// Read summarises an image archive as written by `docker save` or
+// `podman save`, in either the Docker or the OCI layout. The archive is
+// read in a single pass, so it can come straight from a pipe.
+func Read(r io.Reader) (*Image, error) {
+	a := newArchive()
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeSymlink {
+			a.links[cleanPath(hdr.Name)] = cleanPath(path.Join(path.Dir(hdr.Name), hdr.Linkname))
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := a.add(cleanPath(hdr.Name), hdr.Size, tr); err != nil {
+			return nil, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+	}
+	return a.image()
+}
+
+// ReadDir summarises an image stored as an OCI image layout directory, as
+// written by `skopeo copy ... oci:dir` or `docker buildx --output type=oci`.
+func ReadDir(dir string) (*Image, error) {
+	a := newArchive()
+	for _, name := range []string{"index.json", "manifest.json"} {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err == nil {
+			a.json[name] = data
+		}
+	}
+	blobs, err := filepath.Glob(filepath.Join(dir, "blobs", "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, blob := range blobs {
+		f, err := os.Open(blob)
+		if err != nil {
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err == nil {
+			rel, _ := filepath.Rel(dir, blob)
+			err = a.add(filepath.ToSlash(rel), info.Size(), f)
+		}
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", blob, err)
+		}
+	}
+	return a.image()
+}
+
+// add keeps small JSON documents and summarises anything that is a layer.
+func (a *archive) add(name string, size int64, r io.Reader) error {
+	br := bufio.NewReader(r)
+	first, _ := br.Peek(1)
+	if len(first) == 1 && (first[0] == '{' || first[0] == '[') {
+		if size <= maxJSONBlob {
+			data, err := io.ReadAll(br)
+			if err != nil {
+				return err
+			}
+			a.json[name] = data
+		}
+		return nil
+	}
+	lc, err := readLayer(br)
+	if errors.Is(err, errNotTar) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	a.layers[name] = lc
+	return nil
+}
+
+type dockerManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations"`
+	Platform    *struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+	} `json:"platform"`
+}
+
+type ociIndex struct {
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+	Config ociDescriptor   `json:"config"`
+	Layers []ociDescriptor `json:"layers"`
+}
+
+type imageConfig struct {
+	History []struct {
+		CreatedBy  string `json:"created_by"`
+		EmptyLayer bool   `json:"empty_layer"`
+	} `json:"history"`
+}
+
+// image resolves the layer order from the Docker manifest.json, falling
+// back to the OCI index.json, and stacks the layers.
+func (a *archive) image() (*Image, error) {
+	var tags []string
+	var config string
+	var layers []string
+
+	if data, ok := a.json["manifest.json"]; ok {
+		var manifests []dockerManifest
+		if err := json.Unmarshal(data, &manifests); err != nil {
+			return nil, fmt.Errorf("manifest.json: %w", err)
+		}
+		if len(manifests) == 0 {
+			return nil, errors.New("manifest.json lists no images")
+		}
+		m := manifests[0]
+		tags, config, layers = m.RepoTags, cleanPath(m.Config), m.Layers
+	} else if data, ok := a.json["index.json"]; ok {
+		m, ref, err := a.resolveIndex(data, 0)
+		if err != nil {
+			return nil, err
+		}
+		if ref != "" {
+			tags = []string{ref}
+		}
+		config = blobPath(m.Config.Digest)
+		for _, l := range m.Layers {
+			layers = append(layers, blobPath(l.Digest))
+		}
+	} else {
+		return nil, errors.New("not an image archive: no manifest.json or index.json")
+	}
+
+	var history []string
+	if data, ok := a.json[config]; ok {
+		var cfg imageConfig
+		if json.Unmarshal(data, &cfg) == nil {
+			for _, h := range cfg.History {
+				if !h.EmptyLayer {
+					history = append(history, h.CreatedBy)
+				}
+			}
+		}
+	}
+
+	contents := make([]*layerContents, len(layers))
+	img := &Image{Tags: tags, Layers: make([]Layer, len(layers))}
+	for i, name := range layers {
+		name = cleanPath(name)
+		lc, ok := a.layers[name]
+		if target, link := a.links[name]; !ok && link {
+			lc, ok = a.layers[target]
+		}
+		if !ok {
+			return nil, fmt.Errorf("layer %s is missing from the archive", name)
+		}
+		contents[i] = lc
+		img.Layers[i].Digest = layerDigest(name)
+		if len(history) == len(layers) {
+			img.Layers[i].CreatedBy = history[i]
+		}
+	}
+	img.stack(contents)
+	return img, nil
+}
+
+// resolveIndex picks the image manifest for this platform (or the first
+// one) from an OCI index, following nested indexes. ref is the image name
+// the top-level index records, if any.
+func (a *archive) resolveIndex(data []byte, depth int) (m *ociManifest, ref string, err error) {
+	var idx ociIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, "", fmt.Errorf("index.json: %w", err)
+	}
+	if len(idx.Manifests) == 0 || depth > 2 {
+		return nil, "", errors.New("index.json lists no images")
+	}
+	desc := idx.Manifests[0]
+	for _, d := range idx.Manifests {
+		if d.Platform != nil && d.Platform.OS == runtime.GOOS && d.Platform.Architecture == runtime.GOARCH {
+			desc = d
+			break
+		}
+	}
+	ref = desc.Annotations["org.opencontainers.image.ref.name"]
+	blob, ok := a.json[blobPath(desc.Digest)]
+	if !ok {
+		return nil, "", fmt.Errorf("manifest %s is missing from the archive", desc.Digest)
+	}
+	if strings.Contains(desc.MediaType, "index") || strings.Contains(desc.MediaType, "manifest.list") {
+		m, nested, err := a.resolveIndex(blob, depth+1)
+		if ref == "" {
+			ref = nested
+		}
+		return m, ref, err
+	}
+	m = new(ociManifest)
+	if err := json.Unmarshal(blob, m); err != nil {
+		return nil, "", fmt.Errorf("manifest %s: %w", desc.Digest, err)
+	}
+	return m, ref, nil
+}
+
+// blobPath maps a digest such as "sha256:abc" to its path in a layout.
+func blobPath(digest string) string {
+	algo, hex, _ := strings.Cut(digest, ":")
+	return path.Join("blobs", algo, hex)
+}
+
+// layerDigest recovers a digest from a layer's path: blobs/sha256/<hex> in
+// the OCI layout, <hex>/layer.tar in the old Docker one.
+func layerDigest(name string) string {
+	if dir, file := path.Split(name); file == "layer.tar" {
+		return "sha256:" + strings.TrimSuffix(dir, "/")
+	}
+	parts := strings.Split(name, "/")
+	if len(parts) == 3 && parts[0] == "blobs" {
+		return parts[1] + ":" + parts[2]
+	}
+	return name
+}
+
+// stack applies the layers in order. A file is charged as shadowed to the
+// layer that added it when a later layer overwrites it or deletes it with a
+// whiteout.
+func (img *Image) stack(contents []*layerContents) {
+	type owner struct {
+		layer int
+		size  int64
+	}
+	visible := make(map[string]owner)
+	shadow := func(p string) {
+		if o, ok := visible[p]; ok {
+			img.Layers[o.layer].ShadowedFiles++
+			img.Layers[o.layer].ShadowedBytes += o.size
+			delete(visible, p)
+		}
+	}
+	removeTree := func(dir string) {
+		for p := range visible {
+			if dir == "" || p == dir || strings.HasPrefix(p, dir+"/") {
+				shadow(p)
+			}
+		}
+	}
+
+	for i, lc := range contents {
+		l := &img.Layers[i]
+		l.Dirs = lc.dirs
+		l.Whiteouts = int64(len(lc.whiteouts) + len(lc.opaque))
+		for _, dir := range lc.opaque {
+			removeTree(dir)
+		}
+		for _, p := range lc.whiteouts {
+			removeTree(p)
+		}
+		for p, size := range lc.files {
+			l.Files++
+			l.Bytes += size
+			shadow(p)
+			visible[p] = owner{i, size}
+		}
+	}
+
+	for _, o := range visible {
+		img.Files++
+		img.Bytes += o.size
+	}
+	for _, l := range img.Layers {
+		img.Wasted += l.ShadowedBytes
+	}
+}
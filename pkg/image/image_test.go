@@ -0,0 +1,142 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type entry struct {
+	name string
+	size int
+	dir  bool
+}
+
+func layerTar(t *testing.T, gz bool, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var zw *gzip.Writer
+	if gz {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(e.size), Typeflag: tar.TypeReg}
+		if e.dir {
+			hdr.Typeflag, hdr.Size = tar.TypeDir, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(make([]byte, e.size))
+	}
+	tw.Close()
+	if zw != nil {
+		zw.Close()
+	}
+	return buf.Bytes()
+}
+
+// testLayers adds a, b and dir/c, then replaces a and deletes b, then
+// makes dir opaque and adds dir/d: every file of the first layer ends up
+// shadowed.
+func testLayers(t *testing.T) [][]byte {
+	return [][]byte{
+		layerTar(t, false, entry{name: "dir/", dir: true}, entry{name: "a", size: 100}, entry{name: "b", size: 50}, entry{name: "dir/c", size: 10}),
+		layerTar(t, true, entry{name: "./a", size: 120}, entry{name: ".wh.b"}),
+		layerTar(t, false, entry{name: "dir/.wh..wh..opq"}, entry{name: "dir/d", size: 5}),
+	}
+}
+
+func checkImage(t *testing.T, img *Image) {
+	t.Helper()
+	if len(img.Layers) != 3 {
+		t.Fatalf("Expected 3 layers, got %d", len(img.Layers))
+	}
+	if img.Files != 2 || img.Bytes != 125 || img.Wasted != 160 {
+		t.Errorf("Image totals = %d files, %d bytes, %d wasted; expected 2, 125, 160", img.Files, img.Bytes, img.Wasted)
+	}
+	first := img.Layers[0]
+	if first.Files != 3 || first.Dirs != 1 || first.Bytes != 160 || first.ShadowedFiles != 3 || first.ShadowedBytes != 160 {
+		t.Errorf("Unexpected first layer %+v", first)
+	}
+	if img.Layers[1].Whiteouts != 1 || img.Layers[2].Whiteouts != 1 || img.Layers[2].ShadowedBytes != 0 {
+		t.Errorf("Unexpected upper layers %+v", img.Layers[1:])
+	}
+}
+
+func TestReadDockerArchive(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	add := func(name string, data []byte) {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		tw.Write(data)
+	}
+
+	var layers []string
+	for i, data := range testLayers(t) {
+		name := filepath.ToSlash(filepath.Join(string(rune('a'+i))+"0", "layer.tar"))
+		add(name, data)
+		layers = append(layers, name)
+	}
+	config, _ := json.Marshal(map[string]any{"history": []map[string]any{
+		{"created_by": "ADD rootfs /"},
+		{"created_by": "ENV X=1", "empty_layer": true},
+		{"created_by": "RUN update"},
+		{"created_by": "RUN cleanup"},
+	}})
+	add("config.json", config)
+	manifest, _ := json.Marshal([]map[string]any{{"Config": "config.json", "RepoTags": []string{"app:latest"}, "Layers": layers}})
+	add("manifest.json", manifest)
+	tw.Close()
+
+	img, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImage(t, img)
+	if len(img.Tags) != 1 || img.Tags[0] != "app:latest" {
+		t.Errorf("Tags = %v", img.Tags)
+	}
+	if img.Layers[0].Digest != "sha256:a0" || img.Layers[2].CreatedBy != "RUN cleanup" {
+		t.Errorf("Unexpected layer metadata %+v", img.Layers[2])
+	}
+}
+
+func TestReadOCILayout(t *testing.T) {
+	dir := t.TempDir()
+	blobs := filepath.Join(dir, "blobs", "sha256")
+	os.MkdirAll(blobs, 0755)
+	write := func(hex string, data []byte) string {
+		os.WriteFile(filepath.Join(blobs, hex), data, 0644)
+		return "sha256:" + hex
+	}
+
+	var layers []map[string]string
+	for i, data := range testLayers(t) {
+		layers = append(layers, map[string]string{"digest": write(string(rune('a'+i))+"1", data)})
+	}
+	manifest, _ := json.Marshal(map[string]any{"config": map[string]string{"digest": write("c0", []byte("{}"))}, "layers": layers})
+	index, _ := json.Marshal(map[string]any{"manifests": []map[string]any{{
+		"mediaType":   "application/vnd.oci.image.manifest.v1+json",
+		"digest":      write("m0", manifest),
+		"annotations": map[string]string{"org.opencontainers.image.ref.name": "latest"},
+	}}})
+	os.WriteFile(filepath.Join(dir, "index.json"), index, 0644)
+
+	img, err := ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImage(t, img)
+	if img.Layers[1].Digest != "sha256:b1" || len(img.Tags) != 1 || img.Tags[0] != "latest" {
+		t.Errorf("Unexpected metadata: tags %v, layer %+v", img.Tags, img.Layers[1])
+	}
+}
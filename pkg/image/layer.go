@@ -0,0 +1,83 @@
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+// errNotTar is returned by readLayer for blobs that are not (gzipped) tar
+// archives, such as configs and manifests.
+var errNotTar = errors.New("not a tar archive")
+
+// layerContents is what one layer adds and deletes.
+type layerContents struct {
+	files map[string]int64 // non-directory entries and their sizes
+	dirs  int64
+	// whiteouts are paths the layer deletes; opaque directories have all
+	// of their lower-layer contents hidden.
+	whiteouts []string
+	opaque    []string
+}
+
+// readLayer summarises a layer blob, gunzipping it if needed.
+func readLayer(r io.Reader) (*layerContents, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	head, _ := br.Peek(512)
+	var src io.Reader = br
+	if len(head) >= 2 && head[0] == 0x1f && head[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		src = gz
+	} else if len(head) < 512 || !bytes.Equal(head[257:262], []byte("ustar")) {
+		if bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}) {
+			return nil, errors.New("zstd-compressed layers are not supported")
+		}
+		return nil, errNotTar
+	}
+
+	lc := &layerContents{files: make(map[string]int64)}
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return lc, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := cleanPath(hdr.Name)
+		if name == "" {
+			continue
+		}
+		dir, base := path.Split(name)
+		switch {
+		case base == ".wh..wh..opq":
+			lc.opaque = append(lc.opaque, strings.TrimSuffix(dir, "/"))
+		case strings.HasPrefix(base, ".wh."):
+			lc.whiteouts = append(lc.whiteouts, dir+strings.TrimPrefix(base, ".wh."))
+		case hdr.Typeflag == tar.TypeDir:
+			lc.dirs++
+		default:
+			size := int64(0)
+			if hdr.Typeflag == tar.TypeReg {
+				size = hdr.Size
+			}
+			lc.files[name] = size
+		}
+	}
+}
+
+// cleanPath turns a tar member name into a slash-separated path relative to
+// the image root, "" for the root itself.
+func cleanPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
@@ -0,0 +1,62 @@
+package index
+
+import "path"
+
+// A ChangeSource tells Update which directories of a tree may have changed
+// since the old index was built, so that only those are listed and stat'ed
+// again: a change journal such as the NTFS USN journal, events from
+// inotify or FSEvents collected while watching, or, when none can tell,
+// the directories' mtimes.
+type ChangeSource interface {
+	// Name names the source in reports.
+	Name() string
+	// Changes returns the directories under abs that may have changed
+	// since old was built, and the source's position now, which is kept
+	// with the new index for the next update. When it can't tell, such
+	// as before it had a position or after losing track, ok is false and
+	// Update compares mtimes instead.
+	Changes(abs string, old *Index) (dirs Dirs, pos *Journal, ok bool)
+}
+
+// Dirs is a set of directories, slash-separated and relative to the root,
+// whose entries may have changed. A directory marked true stands for all
+// the directories below it too.
+type Dirs map[string]bool
+
+// Has reports whether the directory rel may have changed.
+func (d Dirs) Has(rel string) bool {
+	if _, ok := d[rel]; ok {
+		return true
+	}
+	for rel != "." {
+		rel = path.Dir(rel)
+		if d[rel] {
+			return true
+		}
+	}
+	return false
+}
+
+// MTimes is the fallback change source, which can never tell. Update then
+// lists the directories whose mtime changed again, and stats everything.
+var MTimes ChangeSource = mtimes{}
+
+type mtimes struct{}
+
+func (mtimes) Name() string { return "mtimes" }
+
+func (mtimes) Changes(abs string, old *Index) (Dirs, *Journal, bool) { return nil, nil, false }
+
+// USNJournal reads the NTFS USN journal of the volume a tree is on, on
+// Windows when run as administrator. Anywhere else it falls back to
+// mtimes.
+var USNJournal ChangeSource = usnJournal{}
+
+type usnJournal struct{}
+
+func (usnJournal) Name() string { return "USN journal" }
+
+func (usnJournal) Changes(abs string, old *Index) (Dirs, *Journal, bool) {
+	pos, dirs := readJournal(abs, old.Journal)
+	return dirs, pos, dirs != nil
+}
@@ -0,0 +1,449 @@
+// Package index keeps the full path list of a tree, with sizes, mtimes and
+// modes, in a compact file so later commands can answer questions about
+// the tree without walking it again.
+//
+// The file is a gzip stream holding a magic line, a JSON header and the
+// entries sorted by path. Paths are front-coded: each one stores only the
+// length of the prefix it shares with the previous path and the rest, so
+// an index is typically a few bytes per entry.
+package index
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Version is bumped whenever the file layout changes incompatibly.
+const Version = 1
+
+const magic = "file-counter index\n"
+
+// Entry is one file or directory. Path is slash-separated and relative to
+// the index root; the root itself is ".".
+type Entry struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Mode    os.FileMode
+}
+
+// IsDir reports whether e is a directory.
+func (e *Entry) IsDir() bool { return e.Mode.IsDir() }
+
+// Index is the stored state of a tree. Journal is where its change source
+// was when it was built, if it keeps a position.
+type Index struct {
+	Root    string
+	BuiltAt time.Time
+	Files   int64
+	Dirs    int64
+	Bytes   int64
+	Journal *Journal
+	Entries []Entry
+}
+
+// Journal is a position in a change source, such as the NTFS USN journal.
+// Next is only meaningful in the journal with that ID.
+type Journal struct {
+	ID   uint64 `json:"id"`
+	Next int64  `json:"next"`
+}
+
+type header struct {
+	Version int       `json:"version"`
+	Root    string    `json:"root"`
+	BuiltAt time.Time `json:"built_at"`
+	Files   int64     `json:"files"`
+	Dirs    int64     `json:"dirs"`
+	Bytes   int64     `json:"bytes"`
+	Entries int       `json:"entries"`
+	Journal *Journal  `json:"journal,omitempty"`
+}
+
+// Dir is where indexes are kept by default: one file per root under the
+// user cache directory.
+func Dir() (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cache, "file-counter", "index"), nil
+}
+
+// DefaultPath returns the default index file for root.
+func DefaultPath(root string) (string, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".idx"), nil
+}
+
+// All returns the paths of the indexes in Dir.
+func All() ([]string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	return filepath.Glob(filepath.Join(dir, "*.idx"))
+}
+
+// Save writes the index to name, replacing it atomically.
+func (ix *Index) Save(name string) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	err = ix.write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func (ix *Index) write(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+	hdr, err := json.Marshal(header{
+		Version: Version, Root: ix.Root, BuiltAt: ix.BuiltAt,
+		Files: ix.Files, Dirs: ix.Dirs, Bytes: ix.Bytes, Entries: len(ix.Entries), Journal: ix.Journal,
+	})
+	if err != nil {
+		return err
+	}
+	bw.WriteString(magic)
+	bw.Write(append(hdr, '\n'))
+
+	var buf []byte
+	prev := ""
+	for i := range ix.Entries {
+		e := &ix.Entries[i]
+		shared := 0
+		for shared < len(prev) && shared < len(e.Path) && prev[shared] == e.Path[shared] {
+			shared++
+		}
+		buf = binary.AppendUvarint(buf[:0], uint64(shared))
+		buf = binary.AppendUvarint(buf, uint64(len(e.Path)-shared))
+		buf = append(buf, e.Path[shared:]...)
+		buf = binary.AppendUvarint(buf, uint64(e.Mode))
+		buf = binary.AppendVarint(buf, e.Size)
+		buf = binary.AppendVarint(buf, e.ModTime.UnixNano())
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+		prev = e.Path
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Load reads an index written by Save.
+func Load(name string) (*Index, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ix, err := read(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading index %s: %w", name, err)
+	}
+	return ix, nil
+}
+
+func read(r io.Reader) (*Index, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.New("not an index file")
+	}
+	br := bufio.NewReader(zr)
+	if line, err := br.ReadString('\n'); err != nil || line != magic {
+		return nil, errors.New("not an index file")
+	}
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	var hdr header
+	if err := json.Unmarshal(line, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.Version != Version {
+		return nil, fmt.Errorf("unsupported version %d", hdr.Version)
+	}
+
+	ix := &Index{Root: hdr.Root, BuiltAt: hdr.BuiltAt, Files: hdr.Files, Dirs: hdr.Dirs, Bytes: hdr.Bytes, Journal: hdr.Journal}
+	ix.Entries = make([]Entry, hdr.Entries)
+	prev := ""
+	for i := range ix.Entries {
+		shared, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, truncated(err)
+		}
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, truncated(err)
+		}
+		if shared > uint64(len(prev)) || n > 1<<16 {
+			return nil, errors.New("corrupt entry")
+		}
+		suffix := make([]byte, n)
+		if _, err := io.ReadFull(br, suffix); err != nil {
+			return nil, truncated(err)
+		}
+		mode, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, truncated(err)
+		}
+		size, err := binary.ReadVarint(br)
+		if err != nil {
+			return nil, truncated(err)
+		}
+		mtime, err := binary.ReadVarint(br)
+		if err != nil {
+			return nil, truncated(err)
+		}
+		e := &ix.Entries[i]
+		e.Path = prev[:shared] + string(suffix)
+		e.Mode, e.Size, e.ModTime = os.FileMode(mode), size, time.Unix(0, mtime).UTC()
+		prev = e.Path
+	}
+	return ix, nil
+}
+
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Options control a build. Skip prunes paths (absolute, OS-separated) from
+// the index, like the scanner's skip rules. Changes says which directories
+// an update lists again; it is USNJournal when nil.
+type Options struct {
+	Skip    func(path string) bool
+	Changes ChangeSource
+}
+
+// Changes summarises an update. Reused counts the directories whose
+// listing was taken from the old index because their mtime was unchanged,
+// or the change source said they were, Reread those that were listed
+// again. Source names the change source, unless mtimes were compared.
+type Changes struct {
+	Added    int64
+	Removed  int64
+	Modified int64
+	Reused   int64
+	Reread   int64
+	Source   string
+}
+
+// Build indexes the tree at root.
+func Build(root string, opts Options) (*Index, error) {
+	ix, _, err := Update(&Index{Root: root}, opts)
+	return ix, err
+}
+
+// Update re-indexes old.Root. When the change source can tell which
+// directories changed since old was built, only those are listed and
+// stat'ed again, and the entries of all others are taken as they were.
+// Otherwise, like updatedb, it only lists directories again when their
+// mtime changed, taking the names in the others from the old index; every
+// entry is still stat'ed, so size and mtime changes of existing files are
+// picked up.
+func Update(old *Index, opts Options) (*Index, *Changes, error) {
+	abs, err := filepath.Abs(old.Root)
+	if err != nil {
+		return nil, nil, err
+	}
+	src := opts.Changes
+	if src == nil {
+		src = USNJournal
+	}
+	// The position is taken before walking, so that changes made during
+	// the walk are found again next time.
+	changed, pos, ok := src.Changes(abs, old)
+	if !ok {
+		changed = nil
+	}
+	ix, changes, err := update(old, abs, opts, pos, changed)
+	if err == nil && ok {
+		changes.Source = src.Name()
+	}
+	return ix, changes, err
+}
+
+// update re-indexes old at abs. With changed set, only the directories in
+// it are listed again.
+func update(old *Index, abs string, opts Options, pos *Journal, changed Dirs) (*Index, *Changes, error) {
+	b := &builder{
+		abs:      abs,
+		skip:     opts.Skip,
+		old:      make(map[string]*Entry, len(old.Entries)),
+		children: make(map[string][]string),
+		changed:  changed,
+		changes:  &Changes{},
+	}
+	for i := range old.Entries {
+		e := &old.Entries[i]
+		b.old[e.Path] = e
+		if e.Path != "." {
+			parent := path.Dir(e.Path)
+			b.children[parent] = append(b.children[parent], path.Base(e.Path))
+		}
+	}
+
+	info, err := os.Lstat(abs)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.IsDir() {
+		return nil, nil, fmt.Errorf("%s is not a directory", abs)
+	}
+	b.ix = &Index{Root: abs, BuiltAt: time.Now().UTC(), Journal: pos}
+	b.add(".", info)
+	b.walk(".", info)
+
+	sortEntries(b.ix.Entries)
+	b.changes.Removed = int64(len(b.old)) - b.seen
+	return b.ix, b.changes, nil
+}
+
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+}
+
+type builder struct {
+	abs      string
+	skip     func(string) bool
+	old      map[string]*Entry
+	children map[string][]string
+	changed  Dirs
+	ix       *Index
+	changes  *Changes
+	seen     int64
+}
+
+func (b *builder) add(rel string, info os.FileInfo) {
+	b.addEntry(Entry{Path: rel, Size: info.Size(), ModTime: info.ModTime().UTC(), Mode: info.Mode()})
+}
+
+func (b *builder) addEntry(e Entry) {
+	rel := e.Path
+	if e.IsDir() {
+		e.Size = 0
+		b.ix.Dirs++
+	} else {
+		b.ix.Files++
+		b.ix.Bytes += e.Size
+	}
+	if prev, ok := b.old[rel]; !ok {
+		b.changes.Added++
+	} else {
+		b.seen++
+		if prev.Size != e.Size || !prev.ModTime.Equal(e.ModTime) || prev.Mode != e.Mode {
+			b.changes.Modified++
+		}
+	}
+	b.ix.Entries = append(b.ix.Entries, e)
+}
+
+// walk adds the entries below the directory rel. Unreadable entries are
+// left out rather than failing the whole index.
+func (b *builder) walk(rel string, info os.FileInfo) {
+	prev, ok := b.old[rel]
+	if ok && prev.IsDir() && b.changed != nil && !b.changed.Has(rel) {
+		b.reuse(rel)
+		return
+	}
+	dir := filepath.Join(b.abs, filepath.FromSlash(rel))
+	var names []string
+	if ok && prev.IsDir() && b.changed == nil && prev.ModTime.Equal(info.ModTime().UTC()) {
+		names = b.children[rel]
+		b.changes.Reused++
+	} else {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		b.changes.Reread++
+	}
+
+	for _, name := range names {
+		full := filepath.Join(dir, name)
+		if b.skip != nil && b.skip(full) {
+			continue
+		}
+		child, err := os.Lstat(full)
+		if err != nil {
+			continue
+		}
+		childRel := path.Join(rel, name)
+		b.add(childRel, child)
+		if child.IsDir() {
+			b.walk(childRel, child)
+		}
+	}
+}
+
+// reuse adds the entries below the directory rel from the old index
+// without looking at them, as the change source says it did not change.
+// Directories below it that did are walked.
+func (b *builder) reuse(rel string) {
+	b.changes.Reused++
+	dir := filepath.Join(b.abs, filepath.FromSlash(rel))
+	for _, name := range b.children[rel] {
+		full := filepath.Join(dir, name)
+		if b.skip != nil && b.skip(full) {
+			continue
+		}
+		childRel := path.Join(rel, name)
+		e := b.old[childRel]
+		if !e.IsDir() || !b.changed.Has(childRel) {
+			b.addEntry(*e)
+			if e.IsDir() {
+				b.reuse(childRel)
+			}
+			continue
+		}
+		child, err := os.Lstat(full)
+		if err != nil {
+			continue
+		}
+		b.add(childRel, child)
+		if child.IsDir() {
+			b.walk(childRel, child)
+		}
+	}
+}
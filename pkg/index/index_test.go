@@ -0,0 +1,266 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path string, size int) {
+	t.Helper()
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a.txt"), 10)
+	writeFile(t, filepath.Join(root, "src", "main.go"), 200)
+	writeFile(t, filepath.Join(root, "src", "main_test.go"), 300)
+
+	ix, err := Build(root, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ix.Files != 3 || ix.Dirs != 2 || ix.Bytes != 510 {
+		t.Errorf("Got %d files, %d dirs, %d bytes", ix.Files, ix.Dirs, ix.Bytes)
+	}
+
+	name := filepath.Join(t.TempDir(), "tree.idx")
+	if err := ix.Save(name); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, ix) {
+		t.Errorf("Loaded index differs:\n%+v\n%+v", loaded, ix)
+	}
+	var paths []string
+	for _, e := range loaded.Entries {
+		paths = append(paths, e.Path)
+	}
+	want := []string{".", "a.txt", "src", "src/main.go", "src/main_test.go"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("Got paths %q, expected %q", paths, want)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "keep", "same.txt"), 1)
+	writeFile(t, filepath.Join(root, "keep", "grows.txt"), 1)
+	writeFile(t, filepath.Join(root, "gone.txt"), 1)
+	ix, err := Build(root, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep the directory's mtime so its listing is reused, and push the
+	// file's mtime forward so the change is visible on coarse clocks.
+	keep := filepath.Join(root, "keep")
+	info, _ := os.Stat(keep)
+	writeFile(t, filepath.Join(keep, "grows.txt"), 5000)
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(keep, "grows.txt"), later, later)
+	os.Chtimes(keep, info.ModTime(), info.ModTime())
+	os.Remove(filepath.Join(root, "gone.txt"))
+	writeFile(t, filepath.Join(root, "new", "file.txt"), 7)
+
+	updated, changes, err := Update(ix, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Files != 3 || updated.Bytes != 5008 {
+		t.Errorf("Got %d files, %d bytes", updated.Files, updated.Bytes)
+	}
+	// The root changed (gone.txt, new/), keep/ did not.
+	want := Changes{Added: 2, Removed: 1, Modified: 2, Reused: 1, Reread: 2}
+	if *changes != want {
+		t.Errorf("Got changes %+v, expected %+v", *changes, want)
+	}
+}
+
+func TestUpdateFromJournal(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "quiet", "a.txt"), 1)
+	writeFile(t, filepath.Join(root, "quiet", "busy", "b.txt"), 1)
+	writeFile(t, filepath.Join(root, "c.txt"), 1)
+	ix, err := Build(root, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only busy/ is in the journal, so the change in quiet/ goes unseen.
+	writeFile(t, filepath.Join(root, "quiet", "a.txt"), 100)
+	writeFile(t, filepath.Join(root, "quiet", "busy", "b.txt"), 10)
+	writeFile(t, filepath.Join(root, "quiet", "busy", "new.txt"), 5)
+	journal := &Journal{ID: 1, Next: 42}
+	updated, changes, err := update(ix, ix.Root, Options{}, journal, Dirs{"quiet/busy": false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Files != 4 || updated.Bytes != 17 || updated.Journal != journal {
+		t.Errorf("Got %d files, %d bytes, journal %v", updated.Files, updated.Bytes, updated.Journal)
+	}
+	want := Changes{Added: 1, Modified: 2, Reused: 2, Reread: 1}
+	if *changes != want {
+		t.Errorf("Got changes %+v, expected %+v", *changes, want)
+	}
+
+	// The position is kept with the index.
+	name := filepath.Join(t.TempDir(), "journal.idx")
+	if err := updated.Save(name); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := Load(name); err != nil || loaded.Journal == nil || *loaded.Journal != *journal {
+		t.Errorf("Got journal %v after loading (%v)", loaded.Journal, err)
+	}
+}
+
+// source always says the same directories changed.
+type source Dirs
+
+func (source) Name() string { return "test" }
+
+func (s source) Changes(abs string, old *Index) (Dirs, *Journal, bool) {
+	return Dirs(s), nil, s != nil
+}
+
+func TestChangeSource(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "deep", "er", "f.txt"), 1)
+	writeFile(t, filepath.Join(root, "b", "g.txt"), 1)
+	ix, err := Build(root, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, "a", "deep", "er", "f.txt"), 10)
+	writeFile(t, filepath.Join(root, "b", "g.txt"), 10)
+
+	// "a" stands for everything below it.
+	updated, changes, err := Update(ix, Options{Changes: source{"a": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Bytes != 11 || changes.Source != "test" || changes.Reread != 3 {
+		t.Errorf("Got %d bytes, changes %+v", updated.Bytes, *changes)
+	}
+	// A source that can't tell falls back to mtimes.
+	updated, changes, err = Update(ix, Options{Changes: source(nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Bytes != 20 || changes.Source != "" {
+		t.Errorf("Got %d bytes, changes %+v", updated.Bytes, *changes)
+	}
+}
+
+func TestSkip(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a"), 1)
+	writeFile(t, filepath.Join(root, "cache", "b"), 1)
+	skip := filepath.Join(root, "cache")
+	ix, err := Build(root, Options{Skip: func(p string) bool { return p == skip }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ix.Files != 1 || ix.Dirs != 1 {
+		t.Errorf("Expected cache/ to be skipped, got %d files, %d dirs", ix.Files, ix.Dirs)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ix := &Index{Root: "/srv", Entries: []Entry{
+		{Path: "."}, {Path: "Docs"}, {Path: "Docs/report.PDF"}, {Path: "docs.txt"}, {Path: "src/main.go"},
+	}}
+	tests := []struct {
+		pattern, kind string
+		fold          bool
+		want          []string
+	}{
+		{"docs", MatchSubstring, false, []string{"/srv/docs.txt"}},
+		{"docs", MatchSubstring, true, []string{"/srv/Docs", "/srv/Docs/report.PDF", "/srv/docs.txt"}},
+		{"*.pdf", MatchGlob, true, []string{"/srv/Docs/report.PDF"}},
+		{"/srv/*/*.go", MatchGlob, false, []string{"/srv/src/main.go"}},
+		{`\.(txt|go)$`, MatchRegexp, false, []string{"/srv/docs.txt", "/srv/src/main.go"}},
+	}
+	for _, tt := range tests {
+		match, err := Matcher(tt.pattern, tt.kind, tt.fold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		ix.Search(match, func(p string, e *Entry) bool {
+			got = append(got, p)
+			return true
+		})
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %q: got %q, expected %q", tt.kind, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestRollup(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "top.txt"), 1)
+	writeFile(t, filepath.Join(root, "a", "x"), 10)
+	writeFile(t, filepath.Join(root, "a", "deep", "y"), 20)
+	writeFile(t, filepath.Join(root, "a-b", "z"), 100)
+	os.MkdirAll(filepath.Join(root, "empty"), 0755)
+	ix, err := Build(root, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := ix.Rollup(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Totals != (Totals{Files: 4, Dirs: 4, Bytes: 131}) {
+		t.Errorf("Got root totals %+v", r.Totals)
+	}
+	want := []DirTotals{
+		{"a-b", Totals{Files: 1, Bytes: 100}},
+		{"a", Totals{Files: 2, Dirs: 1, Bytes: 30}},
+		{"empty", Totals{}},
+	}
+	if !reflect.DeepEqual(r.Children, want) {
+		t.Errorf("Got children %+v, expected %+v", r.Children, want)
+	}
+
+	r, err = ix.Rollup("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Totals != (Totals{Files: 2, Dirs: 1, Bytes: 30}) || len(r.Children) != 1 || r.Children[0].Bytes != 20 {
+		t.Errorf("Got rollup of a %+v", r)
+	}
+	if _, err := ix.Rollup("a/x"); err == nil {
+		t.Error("Expected an error for a file")
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "b", "c.txt"), 3)
+	ix, err := Build(root, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	back := FromSnapshot(ix.Snapshot())
+	back.Dirs, back.BuiltAt = ix.Dirs, ix.BuiltAt
+	for i := range ix.Entries {
+		if e := &ix.Entries[i]; e.IsDir() {
+			e.ModTime, e.Mode = time.Time{}, os.ModeDir|0o755
+		}
+	}
+	if !reflect.DeepEqual(back, ix) {
+		t.Errorf("Got %+v, expected %+v", back, ix)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package index
+
+// readJournal finds directories to list again from a change journal, which
+// only Windows has. Elsewhere, Update compares directory mtimes.
+func readJournal(abs string, since *Journal) (*Journal, Dirs) {
+	return nil, nil
+}
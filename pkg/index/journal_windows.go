@@ -0,0 +1,171 @@
+package index
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	fsctlQueryUSNJournal = 0x000900f4
+	fsctlReadUSNJournal  = 0x000900bb
+
+	fileShareAll            = syscall.FILE_SHARE_READ | syscall.FILE_SHARE_WRITE | syscall.FILE_SHARE_DELETE
+	fileReadAttributes      = 0x80
+	fileFlagBackupSemantics = 0x02000000
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	openFileByID     = kernel32.NewProc("OpenFileById")
+	getFinalPathName = kernel32.NewProc("GetFinalPathNameByHandleW")
+)
+
+// usnJournalData is USN_JOURNAL_DATA_V0.
+type usnJournalData struct {
+	ID              uint64
+	FirstUSN        int64
+	NextUSN         int64
+	LowestValidUSN  int64
+	MaxUSN          int64
+	MaximumSize     uint64
+	AllocationDelta uint64
+}
+
+// readUSNJournalData is READ_USN_JOURNAL_DATA_V0, which reads version 2
+// records.
+type readUSNJournalData struct {
+	StartUSN          int64
+	ReasonMask        uint32
+	ReturnOnlyOnClose uint32
+	Timeout           uint64
+	BytesToWaitFor    uint64
+	JournalID         uint64
+}
+
+// fileIDDescriptor is FILE_ID_DESCRIPTOR for a 64-bit file ID.
+type fileIDDescriptor struct {
+	Size uint32
+	Type uint32
+	ID   uint64
+	_    uint64
+}
+
+// readJournal returns the current position of the NTFS USN journal of the
+// volume abs is on and, if since is still in the journal, the directories
+// under abs that have had entries created, deleted, renamed or modified
+// since, slash-separated and relative to it. Opening the volume needs
+// administrator rights; without them, or on volumes without a journal,
+// both are nil.
+func readJournal(abs string, since *Journal) (*Journal, Dirs) {
+	vol := filepath.VolumeName(abs)
+	if len(vol) != 2 || vol[1] != ':' {
+		return nil, nil
+	}
+	h, err := syscall.CreateFile(syscall.StringToUTF16Ptr(`\\.\`+vol), syscall.GENERIC_READ, fileShareAll, nil, syscall.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return nil, nil
+	}
+	defer syscall.CloseHandle(h)
+	var jd usnJournalData
+	var n uint32
+	if err := syscall.DeviceIoControl(h, fsctlQueryUSNJournal, nil, 0, (*byte)(unsafe.Pointer(&jd)), uint32(unsafe.Sizeof(jd)), &n, nil); err != nil {
+		return nil, nil
+	}
+	cur := &Journal{ID: jd.ID, Next: jd.NextUSN}
+	// A journal that was recreated, or has wrapped past since, has lost
+	// records.
+	if since == nil || since.ID != jd.ID || since.Next < jd.FirstUSN {
+		return cur, nil
+	}
+	root, ok := pathOf(abs)
+	if !ok {
+		return cur, nil
+	}
+
+	parents := map[uint64]bool{}
+	buf := make([]byte, 64<<10)
+	in := readUSNJournalData{StartUSN: since.Next, ReasonMask: 0xffffffff, JournalID: jd.ID}
+	for in.StartUSN < jd.NextUSN {
+		if err := syscall.DeviceIoControl(h, fsctlReadUSNJournal, (*byte)(unsafe.Pointer(&in)), uint32(unsafe.Sizeof(in)), &buf[0], uint32(len(buf)), &n, nil); err != nil {
+			return cur, nil
+		}
+		if n <= 8 {
+			break
+		}
+		in.StartUSN = int64(binary.LittleEndian.Uint64(buf))
+		// USN_RECORD_V2: the parent's file reference number is at 16.
+		for rec := buf[8:n]; len(rec) >= 24; {
+			size := binary.LittleEndian.Uint32(rec)
+			if size < 24 || int(size) > len(rec) {
+				break
+			}
+			if binary.LittleEndian.Uint16(rec[4:]) == 2 {
+				parents[binary.LittleEndian.Uint64(rec[16:])] = true
+			}
+			rec = rec[size:]
+		}
+	}
+
+	// Directories that are gone can't be opened, but their own deletion
+	// is recorded in their parent.
+	// Each record only says which directory an entry is in.
+	changed := Dirs{}
+	for id := range parents {
+		p, ok := pathByID(h, id)
+		if !ok {
+			continue
+		}
+		if strings.EqualFold(p, root) {
+			changed["."] = false
+		} else if len(p) > len(root) && strings.EqualFold(p[:len(root)+1], root+`\`) {
+			changed[filepath.ToSlash(p[len(root)+1:])] = false
+		}
+	}
+	return cur, changed
+}
+
+// finalPath returns the path of the file open as h, with links and drive
+// mappings resolved and without the \\?\ prefix.
+func finalPath(h syscall.Handle) (string, bool) {
+	buf := make([]uint16, syscall.MAX_PATH)
+	for {
+		n, _, _ := getFinalPathName.Call(uintptr(h), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), 0)
+		if n == 0 {
+			return "", false
+		}
+		if int(n) < len(buf) {
+			p := syscall.UTF16ToString(buf[:n])
+			if rest, ok := strings.CutPrefix(p, `\\?\UNC\`); ok {
+				return `\\` + rest, true
+			}
+			return strings.TrimPrefix(p, `\\?\`), true
+		}
+		buf = make([]uint16, n)
+	}
+}
+
+// pathOf returns the final path of name.
+func pathOf(name string) (string, bool) {
+	h, err := syscall.CreateFile(syscall.StringToUTF16Ptr(name), fileReadAttributes, fileShareAll, nil, syscall.OPEN_EXISTING, fileFlagBackupSemantics, 0)
+	if err != nil {
+		return "", false
+	}
+	defer syscall.CloseHandle(h)
+	return finalPath(h)
+}
+
+// pathByID returns the final path of the file or directory with the given
+// file reference number on the volume open as vol.
+func pathByID(vol syscall.Handle, id uint64) (string, bool) {
+	desc := fileIDDescriptor{Size: uint32(unsafe.Sizeof(fileIDDescriptor{})), ID: id}
+	r, _, _ := openFileByID.Call(uintptr(vol), uintptr(unsafe.Pointer(&desc)), fileReadAttributes, fileShareAll, 0, fileFlagBackupSemantics)
+	h := syscall.Handle(r)
+	if h == syscall.InvalidHandle {
+		return "", false
+	}
+	defer syscall.CloseHandle(h)
+	return finalPath(h)
+}
@@ -0,0 +1,97 @@
+package index
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Totals count the entries below a directory, not including itself.
+type Totals struct {
+	Files int64 `json:"files"`
+	Dirs  int64 `json:"dirs"`
+	Bytes int64 `json:"bytes"`
+}
+
+// DirTotals is a subdirectory in a Rollup.
+type DirTotals struct {
+	Name string `json:"name"`
+	Totals
+}
+
+// Rollup is what a directory holds in total and in each subdirectory,
+// largest first. Files directly inside it are counted in Totals only.
+type Rollup struct {
+	Path string `json:"path"`
+	Totals
+	Children []DirTotals `json:"children"`
+}
+
+// Rollup totals the directory dir, given as an absolute path or relative to
+// the index root.
+func (ix *Index) Rollup(dir string) (*Rollup, error) {
+	rel := dir
+	if path.IsAbs(filepath.ToSlash(dir)) {
+		var err error
+		if rel, err = filepath.Rel(ix.Root, dir); err != nil || strings.HasPrefix(rel, "..") {
+			return nil, fmt.Errorf("%s is not inside %s", dir, ix.Root)
+		}
+	}
+	rel = path.Clean(filepath.ToSlash(rel))
+
+	at := sort.Search(len(ix.Entries), func(i int) bool { return ix.Entries[i].Path >= rel })
+	if at == len(ix.Entries) || ix.Entries[at].Path != rel || !ix.Entries[at].IsDir() {
+		return nil, fmt.Errorf("%s is not an indexed directory", dir)
+	}
+
+	r := &Rollup{Path: path.Join(ix.Root, rel)}
+	children := make(map[string]*DirTotals)
+	prefix := rel + "/"
+	if rel == "." {
+		prefix = ""
+	}
+	// Entries are sorted, so the paths starting with prefix are one
+	// contiguous run.
+	start := sort.Search(len(ix.Entries), func(i int) bool { return ix.Entries[i].Path >= prefix })
+	for i := start; i < len(ix.Entries); i++ {
+		e := &ix.Entries[i]
+		if !strings.HasPrefix(e.Path, prefix) {
+			break
+		}
+		if e.Path == "." {
+			continue
+		}
+		name, _, nested := strings.Cut(e.Path[len(prefix):], "/")
+		add := func(t *Totals) {
+			if e.IsDir() {
+				t.Dirs++
+			} else {
+				t.Files++
+				t.Bytes += e.Size
+			}
+		}
+		add(&r.Totals)
+		if !nested {
+			if e.IsDir() {
+				children[name] = &DirTotals{Name: name}
+			}
+			continue
+		}
+		if c := children[name]; c != nil {
+			add(&c.Totals)
+		}
+	}
+
+	for _, c := range children {
+		r.Children = append(r.Children, *c)
+	}
+	sort.Slice(r.Children, func(i, j int) bool {
+		if r.Children[i].Bytes != r.Children[j].Bytes {
+			return r.Children[i].Bytes > r.Children[j].Bytes
+		}
+		return r.Children[i].Name < r.Children[j].Name
+	})
+	return r, nil
+}
@@ -0,0 +1,70 @@
+package index
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Match kinds for Matcher.
+const (
+	MatchSubstring = "substring"
+	MatchGlob      = "glob"
+	MatchRegexp    = "regex"
+)
+
+// Matcher returns a test for absolute slash-separated paths. A substring
+// matches anywhere in the path; a glob matches the base name, or the whole
+// path if it contains a "/"; a regular expression matches anywhere unless
+// anchored. fold makes the match case-insensitive.
+func Matcher(pattern, kind string, fold bool) (func(string) bool, error) {
+	switch kind {
+	case MatchSubstring:
+		if fold {
+			pattern = strings.ToLower(pattern)
+			return func(p string) bool { return strings.Contains(strings.ToLower(p), pattern) }, nil
+		}
+		return func(p string) bool { return strings.Contains(p, pattern) }, nil
+	case MatchGlob:
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q", pattern)
+		}
+		if fold {
+			pattern = strings.ToLower(pattern)
+		}
+		whole := strings.Contains(pattern, "/")
+		return func(p string) bool {
+			if !whole {
+				p = path.Base(p)
+			}
+			if fold {
+				p = strings.ToLower(p)
+			}
+			ok, _ := path.Match(pattern, p)
+			return ok
+		}, nil
+	case MatchRegexp:
+		if fold {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+	return nil, fmt.Errorf("unknown match kind %q", kind)
+}
+
+// Search calls fn with the absolute path of every entry that match
+// accepts, in path order, until fn returns false.
+func (ix *Index) Search(match func(string) bool, fn func(p string, e *Entry) bool) {
+	for i := range ix.Entries {
+		e := &ix.Entries[i]
+		p := path.Join(ix.Root, e.Path)
+		if match(p) && !fn(p, e) {
+			return
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package index
+
+import (
+	"os"
+	"path"
+
+	"file-counter/pkg/snapshot"
+)
+
+// FromSnapshot turns a baseline snapshot into an index. Snapshots only
+// record files, so the directories holding them are added without sizes or
+// mtimes; empty directories are not known.
+func FromSnapshot(s *snapshot.Snapshot) *Index {
+	ix := &Index{Root: s.Root, BuiltAt: s.CreatedAt, Files: s.TotalFiles, Bytes: s.TotalBytes}
+	dirs := map[string]bool{".": true}
+	ix.Entries = append(ix.Entries, Entry{Path: ".", Mode: os.ModeDir | 0o755})
+	for _, f := range s.Files {
+		for dir := path.Dir(f.Path); !dirs[dir]; dir = path.Dir(dir) {
+			dirs[dir] = true
+			ix.Entries = append(ix.Entries, Entry{Path: dir, Mode: os.ModeDir | 0o755})
+		}
+		ix.Entries = append(ix.Entries, Entry{Path: f.Path, Size: f.Size, ModTime: f.ModTime, Mode: os.FileMode(f.Mode)})
+	}
+	ix.Dirs = int64(len(dirs))
+	sortEntries(ix.Entries)
+	return ix
+}
+
+// Snapshot returns the files of the index as a snapshot, so two indexes
+// can be compared with snapshot.Compare.
+func (ix *Index) Snapshot() *snapshot.Snapshot {
+	s := &snapshot.Snapshot{
+		Version: snapshot.Version, Root: ix.Root, CreatedAt: ix.BuiltAt,
+		TotalFiles: ix.Files, TotalDirs: ix.Dirs, TotalBytes: ix.Bytes,
+	}
+	for i := range ix.Entries {
+		e := &ix.Entries[i]
+		if !e.IsDir() {
+			s.Files = append(s.Files, snapshot.File{Path: e.Path, Size: e.Size, ModTime: e.ModTime, Mode: uint32(e.Mode)})
+		}
+	}
+	return s
+}
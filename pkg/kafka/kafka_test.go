@@ -0,0 +1,201 @@
+package kafka
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMurmur2(t *testing.T) {
+	// Test vectors from the Java client's UtilsTest.
+	tests := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+	for input, expected := range tests {
+		if got := murmur2([]byte(input)); got != expected {
+			t.Errorf("murmur2(%q) = %d, expected %d", input, got, expected)
+		}
+	}
+}
+
+func TestEncodeRecordBatch(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	batch := encodeRecordBatch([]Message{
+		{Key: []byte("k"), Value: []byte("first"), Time: now},
+		{Value: []byte("second"), Time: now.Add(time.Second)},
+	})
+
+	d := &decoder{buf: batch}
+	if base := d.int64(); base != 0 {
+		t.Errorf("Base offset = %d", base)
+	}
+	if length := d.int32(); int(length) != len(batch)-12 {
+		t.Errorf("Batch length = %d, expected %d", length, len(batch)-12)
+	}
+	d.int32()
+	if magic := d.int8(); magic != 2 {
+		t.Errorf("Magic = %d, expected 2", magic)
+	}
+	crc := uint32(d.int32())
+	if got := crc32.Checksum(batch[21:], castagnoli); got != crc {
+		t.Errorf("CRC = %08x, expected %08x", crc, got)
+	}
+	d.int16()
+	if last := d.int32(); last != 1 {
+		t.Errorf("Last offset delta = %d, expected 1", last)
+	}
+	if first, max := d.int64(), d.int64(); first != now.UnixMilli() || max != now.UnixMilli()+1000 {
+		t.Errorf("Timestamps = %d..%d", first, max)
+	}
+}
+
+// fakeBroker answers Metadata with three partitions led by itself and counts
+// the records in Produce requests. With dropProduce it hangs up on every
+// Produce request instead, like a broker going away mid-scan.
+func fakeBroker(t *testing.T, dropProduce bool) (addr string, records chan int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	records = make(chan int, 100)
+	port := l.Addr().(*net.TCPAddr).Port
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for {
+					var size [4]byte
+					if _, err := io.ReadFull(r, size[:]); err != nil {
+						return
+					}
+					req := make([]byte, binary.BigEndian.Uint32(size[:]))
+					if _, err := io.ReadFull(r, req); err != nil {
+						return
+					}
+					d := &decoder{buf: req}
+					api, _, corr := d.int16(), d.int16(), d.int32()
+					d.string()
+
+					var resp encoder
+					resp.int32(corr)
+					switch api {
+					case apiMetadata:
+						d.int32()
+						topic := d.string()
+						resp.int32(0)
+						resp.int32(1)
+						resp.int32(7)
+						resp.string("127.0.0.1")
+						resp.int32(int32(port))
+						resp.nullString()
+						resp.nullString()
+						resp.int32(7)
+						resp.int32(1)
+						resp.int16(0)
+						resp.string(topic)
+						resp.int8(0)
+						resp.int32(3)
+						for i := int32(0); i < 3; i++ {
+							resp.int16(0)
+							resp.int32(i)
+							resp.int32(7)
+							resp.int32(0)
+							resp.int32(0)
+						}
+					case apiProduce:
+						if dropProduce {
+							return
+						}
+						d.string()
+						d.int16()
+						d.int32()
+						d.int32()
+						topic := d.string()
+						d.int32()
+						partition := d.int32()
+						batch := d.take(int(d.int32()))
+						records <- int(binary.BigEndian.Uint32(batch[57:]))
+
+						resp.int32(1)
+						resp.string(topic)
+						resp.int32(1)
+						resp.int32(partition)
+						resp.int16(0)
+						resp.int64(0)
+						resp.int64(-1)
+						resp.int32(0)
+					}
+					frame := binary.BigEndian.AppendUint32(nil, uint32(len(resp.buf)))
+					c.Write(append(frame, resp.buf...))
+				}
+			}(c)
+		}
+	}()
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), records
+}
+
+func TestProducer(t *testing.T) {
+	addr, records := fakeBroker(t, false)
+
+	p, err := NewProducer(Config{Brokers: []string{addr}, Acks: -1, BatchSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := p.Publish("files", Message{Value: []byte("v")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	close(records)
+	total := 0
+	for n := range records {
+		total += n
+	}
+	if total != 10 {
+		t.Errorf("Broker received %d records, expected 10", total)
+	}
+}
+
+func TestProducerBrokerFailure(t *testing.T) {
+	addr, _ := fakeBroker(t, true)
+
+	p, err := NewProducer(Config{Brokers: []string{addr}, Acks: -1, BatchSize: 2, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keyed messages all land on one partition, so the second fills the
+	// batch and sends it; the third is left pending on another partition.
+	for i, key := range []string{"a", "a", "b"} {
+		err := p.Publish("files", Message{Key: []byte(key), Value: []byte("v")})
+		if i == 1 && err == nil {
+			t.Fatal("Publish succeeded although the broker dropped the connection")
+		}
+	}
+	if err := p.Flush(); err == nil {
+		t.Error("Flush succeeded although the broker dropped the connection")
+	}
+	if err := p.Close(); err == nil {
+		t.Error("Close succeeded although the broker dropped the connection")
+	}
+}
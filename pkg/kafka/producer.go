@@ -0,0 +1,354 @@
+package kafka
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Config describes how to reach the cluster. Only plaintext and TLS
+// listeners are supported; SASL is not.
+type Config struct {
+	Brokers  []string
+	ClientID string
+	// Acks is 1 (leader only), -1 (all in-sync replicas) or 0 (no reply).
+	Acks    int16
+	TLS     *tls.Config
+	Timeout time.Duration
+	// BatchSize is the number of messages buffered per partition before
+	// they are sent.
+	BatchSize int
+}
+
+type conn struct {
+	c    net.Conn
+	r    *bufio.Reader
+	corr int32
+}
+
+type partitionInfo struct {
+	leaders []int32
+}
+
+// Producer publishes messages to one or more topics. It is safe for
+// concurrent use, but sends are synchronous: Publish blocks while a full
+// batch is delivered, which gives the scanner natural backpressure.
+type Producer struct {
+	cfg     Config
+	mu      sync.Mutex
+	brokers map[int32]string
+	conns   map[int32]*conn
+	topics  map[string]*partitionInfo
+	pending map[string]map[int32][]Message
+	counts  map[string]int
+	next    map[string]int
+}
+
+func NewProducer(cfg Config) (*Producer, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, fmt.Errorf("kafka: no brokers configured")
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "file-counter"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
+
+	return &Producer{
+		cfg:     cfg,
+		brokers: make(map[int32]string),
+		conns:   make(map[int32]*conn),
+		topics:  make(map[string]*partitionInfo),
+		pending: make(map[string]map[int32][]Message),
+		counts:  make(map[string]int),
+		next:    make(map[string]int),
+	}, nil
+}
+
+// Publish queues msg for topic, sending the partition's batch once it is full.
+func (p *Producer) Publish(topic string, msg Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := p.topic(topic)
+	if err != nil {
+		return err
+	}
+
+	var partition int32
+	if msg.Key != nil {
+		partition = (murmur2(msg.Key) & 0x7fffffff) % int32(len(info.leaders))
+	} else {
+		partition = int32(p.next[topic] % len(info.leaders))
+		p.next[topic]++
+	}
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+
+	if p.pending[topic] == nil {
+		p.pending[topic] = make(map[int32][]Message)
+	}
+	batch := append(p.pending[topic][partition], msg)
+	p.pending[topic][partition] = batch
+	if len(batch) >= p.cfg.BatchSize {
+		return p.send(topic, partition)
+	}
+	return nil
+}
+
+// Flush sends every buffered message.
+func (p *Producer) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for topic, partitions := range p.pending {
+		for partition, batch := range partitions {
+			if len(batch) == 0 {
+				continue
+			}
+			if err := p.send(topic, partition); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close flushes buffered messages and closes broker connections.
+func (p *Producer) Close() error {
+	err := p.Flush()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, c := range p.conns {
+		c.c.Close()
+		delete(p.conns, id)
+	}
+	return err
+}
+
+func (p *Producer) send(topic string, partition int32) error {
+	batch := p.pending[topic][partition]
+	// A failed send drops the topic's metadata, so look the leaders up
+	// again rather than trusting the cache to still hold them.
+	info, err := p.topic(topic)
+	if err != nil {
+		return err
+	}
+	if int(partition) >= len(info.leaders) {
+		return fmt.Errorf("kafka: partition %s/%d no longer exists", topic, partition)
+	}
+	leader := info.leaders[partition]
+
+	var body encoder
+	body.nullString()
+	body.int16(p.cfg.Acks)
+	body.int32(int32(p.cfg.Timeout / time.Millisecond))
+	body.int32(1)
+	body.string(topic)
+	body.int32(1)
+	body.int32(partition)
+	body.bytes(encodeRecordBatch(batch))
+
+	resp, err := p.roundTrip(leader, apiProduce, produceVersion, body.buf, p.cfg.Acks != 0)
+	if err != nil {
+		// Drop cached metadata so the next publish rediscovers leaders.
+		delete(p.topics, topic)
+		return err
+	}
+	p.pending[topic][partition] = batch[:0]
+	if resp == nil {
+		return nil
+	}
+
+	d := &decoder{buf: resp}
+	for t := d.int32(); t > 0 && d.err == nil; t-- {
+		d.string()
+		for n := d.int32(); n > 0 && d.err == nil; n-- {
+			d.int32()
+			if code := d.int16(); code != 0 {
+				delete(p.topics, topic)
+				return fmt.Errorf("kafka: produce to %s/%d failed with error code %d", topic, partition, code)
+			}
+			d.int64()
+			d.int64()
+		}
+	}
+	return d.err
+}
+
+// topic returns cached partition leaders, fetching metadata on first use.
+func (p *Producer) topic(name string) (*partitionInfo, error) {
+	if info, ok := p.topics[name]; ok {
+		return info, nil
+	}
+
+	var body encoder
+	body.int32(1)
+	body.string(name)
+	body.int8(1) // allow_auto_topic_creation
+
+	var lastErr error
+	for _, addr := range p.cfg.Brokers {
+		resp, err := p.roundTripAddr(addr, apiMetadata, metadataVersion, body.buf)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		info, err := p.parseMetadata(name, resp)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		p.topics[name] = info
+		return info, nil
+	}
+	return nil, lastErr
+}
+
+func (p *Producer) parseMetadata(name string, resp []byte) (*partitionInfo, error) {
+	d := &decoder{buf: resp}
+	d.int32() // throttle_time_ms
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		p.brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.string() // cluster_id
+	d.int32()  // controller_id
+
+	var info *partitionInfo
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		code := d.int16()
+		topic := d.string()
+		d.int8() // is_internal
+
+		var leaders []int32
+		for parts := d.int32(); parts > 0 && d.err == nil; parts-- {
+			d.int16()
+			index := d.int32()
+			leader := d.int32()
+			d.int32Array()
+			d.int32Array()
+			for int(index) >= len(leaders) {
+				leaders = append(leaders, -1)
+			}
+			leaders[index] = leader
+		}
+		if topic != name {
+			continue
+		}
+		if code != 0 {
+			return nil, fmt.Errorf("kafka: metadata for %s failed with error code %d", name, code)
+		}
+		info = &partitionInfo{leaders: leaders}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if info == nil || len(info.leaders) == 0 {
+		return nil, fmt.Errorf("kafka: topic %s has no partitions yet", name)
+	}
+	for i, leader := range info.leaders {
+		if leader < 0 {
+			return nil, fmt.Errorf("kafka: partition %s/%d has no leader", name, i)
+		}
+	}
+	return info, nil
+}
+
+func (p *Producer) roundTrip(node int32, api, version int16, body []byte, wantResponse bool) ([]byte, error) {
+	c, ok := p.conns[node]
+	if !ok {
+		addr, known := p.brokers[node]
+		if !known {
+			return nil, fmt.Errorf("kafka: unknown broker %d", node)
+		}
+		var err error
+		if c, err = p.dial(addr); err != nil {
+			return nil, err
+		}
+		p.conns[node] = c
+	}
+
+	resp, err := p.exchange(c, api, version, body, wantResponse)
+	if err != nil {
+		c.c.Close()
+		delete(p.conns, node)
+	}
+	return resp, err
+}
+
+func (p *Producer) roundTripAddr(addr string, api, version int16, body []byte) ([]byte, error) {
+	c, err := p.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer c.c.Close()
+	return p.exchange(c, api, version, body, true)
+}
+
+func (p *Producer) dial(addr string) (*conn, error) {
+	dialer := &net.Dialer{Timeout: p.cfg.Timeout}
+	var c net.Conn
+	var err error
+	if p.cfg.TLS != nil {
+		c, err = tls.DialWithDialer(dialer, "tcp", addr, p.cfg.TLS)
+	} else {
+		c, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("kafka: %w", err)
+	}
+	return &conn{c: c, r: bufio.NewReader(c)}, nil
+}
+
+func (p *Producer) exchange(c *conn, api, version int16, body []byte, wantResponse bool) ([]byte, error) {
+	c.corr++
+	var req encoder
+	req.int32(0) // size, filled in below
+	req.int16(api)
+	req.int16(version)
+	req.int32(c.corr)
+	req.string(p.cfg.ClientID)
+	req.buf = append(req.buf, body...)
+	binary.BigEndian.PutUint32(req.buf, uint32(len(req.buf)-4))
+
+	c.c.SetDeadline(time.Now().Add(p.cfg.Timeout))
+	if _, err := c.c.Write(req.buf); err != nil {
+		return nil, fmt.Errorf("kafka: %w", err)
+	}
+	if !wantResponse {
+		return nil, nil
+	}
+
+	var header [8]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return nil, fmt.Errorf("kafka: %w", err)
+	}
+	size := int32(binary.BigEndian.Uint32(header[:4]))
+	if corr := int32(binary.BigEndian.Uint32(header[4:])); corr != c.corr {
+		return nil, fmt.Errorf("kafka: correlation id mismatch (%d != %d)", corr, c.corr)
+	}
+	if size < 4 {
+		return nil, errShort
+	}
+	resp := make([]byte, size-4)
+	if _, err := io.ReadFull(c.r, resp); err != nil {
+		return nil, fmt.Errorf("kafka: %w", err)
+	}
+	return resp, nil
+}
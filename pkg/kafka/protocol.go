@@ -0,0 +1,203 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"time"
+)
+
+// API keys and versions. Produce v3 is the first version using the v2
+// record batch format and Metadata v4 is still supported by Kafka 4.x.
+const (
+	apiProduce      = 0
+	apiMetadata     = 3
+	produceVersion  = 3
+	metadataVersion = 4
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) int8(v int8)   { e.buf = append(e.buf, byte(v)) }
+func (e *encoder) int16(v int16) { e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(v)) }
+func (e *encoder) int32(v int32) { e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v)) }
+func (e *encoder) int64(v int64) { e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v)) }
+func (e *encoder) varint(v int64) {
+	e.buf = binary.AppendVarint(e.buf, v)
+}
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) nullString() {
+	e.int16(-1)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+type decoder struct {
+	buf []byte
+	err error
+}
+
+var errShort = errors.New("kafka: short response")
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil || n < 0 || len(d.buf) < n {
+		d.err = errShort
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) int8() int8 {
+	if b := d.take(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *decoder) int16() int16 {
+	if b := d.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	if b := d.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if b := d.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+func (d *decoder) int32Array() {
+	n := d.int32()
+	for i := int32(0); i < n && d.err == nil; i++ {
+		d.int32()
+	}
+}
+
+// Message is one record to publish. A nil Key lets the producer spread
+// messages round-robin over partitions.
+type Message struct {
+	Key   []byte
+	Value []byte
+	Time  time.Time
+}
+
+// encodeRecordBatch builds a magic v2 record batch with no compression.
+func encodeRecordBatch(msgs []Message) []byte {
+	first := msgs[0].Time.UnixMilli()
+	max := first
+	var records encoder
+	for i, m := range msgs {
+		ts := m.Time.UnixMilli()
+		if ts > max {
+			max = ts
+		}
+
+		var rec encoder
+		rec.int8(0)
+		rec.varint(ts - first)
+		rec.varint(int64(i))
+		if m.Key == nil {
+			rec.varint(-1)
+		} else {
+			rec.varint(int64(len(m.Key)))
+			rec.buf = append(rec.buf, m.Key...)
+		}
+		rec.varint(int64(len(m.Value)))
+		rec.buf = append(rec.buf, m.Value...)
+		rec.varint(0) // headers
+
+		records.varint(int64(len(rec.buf)))
+		records.buf = append(records.buf, rec.buf...)
+	}
+
+	// The CRC covers everything from the attributes to the end of the batch.
+	var tail encoder
+	tail.int16(0)
+	tail.int32(int32(len(msgs) - 1))
+	tail.int64(first)
+	tail.int64(max)
+	tail.int64(-1)
+	tail.int16(-1)
+	tail.int32(-1)
+	tail.int32(int32(len(msgs)))
+	tail.buf = append(tail.buf, records.buf...)
+
+	var batch encoder
+	batch.int64(0)
+	batch.int32(int32(4 + 1 + 4 + len(tail.buf)))
+	batch.int32(-1)
+	batch.int8(2)
+	batch.buf = binary.BigEndian.AppendUint32(batch.buf, crc32.Checksum(tail.buf, castagnoli))
+	batch.buf = append(batch.buf, tail.buf...)
+	return batch.buf
+}
+
+// murmur2 matches the Java client's default partitioner, so keyed messages
+// land on the same partitions as those from other producers.
+func murmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+	length := len(data)
+	h := seed ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	rest := data[length&^3:]
+	switch len(rest) {
+	case 3:
+		h ^= uint32(rest[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(rest[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(rest[0])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
@@ -0,0 +1,197 @@
+// Package kube finds the persistent volumes mounted on a Kubernetes node
+// and looks up which pod, namespace and claim they belong to.
+package kube
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ServiceAccountDir holds the in-cluster credentials of a pod.
+const ServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Client talks to the Kubernetes API server.
+type Client struct {
+	http  *http.Client
+	base  string
+	token string
+}
+
+// NewClient returns a client for the API server at base, authenticating
+// with a bearer token.
+func NewClient(base, token string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{http: httpClient, base: strings.TrimSuffix(base, "/"), token: token}
+}
+
+// InCluster returns a client using the pod's service account, or an error
+// when not running inside a cluster.
+func InCluster() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster")
+	}
+	token, err := os.ReadFile(filepath.Join(ServiceAccountDir, "token"))
+	if err != nil {
+		return nil, err
+	}
+	ca, err := os.ReadFile(filepath.Join(ServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificates in service account ca.crt")
+	}
+	httpClient := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+	base := "https://" + net.JoinHostPort(host, port)
+	return NewClient(base, strings.TrimSpace(string(token)), httpClient), nil
+}
+
+// Pod identifies a pod.
+type Pod struct {
+	UID       string
+	Name      string
+	Namespace string
+}
+
+// Claim is what a persistent volume is bound to.
+type Claim struct {
+	Namespace    string
+	Name         string
+	StorageClass string
+}
+
+// Pods lists the pods scheduled on node.
+func (c *Client) Pods(node string) ([]Pod, error) {
+	var list struct {
+		Items []struct {
+			Metadata struct {
+				UID       string `json:"uid"`
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+		} `json:"items"`
+	}
+	query := url.Values{"fieldSelector": {"spec.nodeName=" + node}}
+	if err := c.get("/api/v1/pods?"+query.Encode(), &list); err != nil {
+		return nil, err
+	}
+
+	pods := make([]Pod, 0, len(list.Items))
+	for _, item := range list.Items {
+		pods = append(pods, Pod{UID: item.Metadata.UID, Name: item.Metadata.Name, Namespace: item.Metadata.Namespace})
+	}
+	return pods, nil
+}
+
+// PersistentVolume returns the claim a persistent volume is bound to.
+func (c *Client) PersistentVolume(name string) (*Claim, error) {
+	var pv struct {
+		Spec struct {
+			StorageClassName string `json:"storageClassName"`
+			ClaimRef         *struct {
+				Namespace string `json:"namespace"`
+				Name      string `json:"name"`
+			} `json:"claimRef"`
+		} `json:"spec"`
+	}
+	if err := c.get("/api/v1/persistentvolumes/"+url.PathEscape(name), &pv); err != nil {
+		return nil, err
+	}
+	claim := &Claim{StorageClass: pv.Spec.StorageClassName}
+	if ref := pv.Spec.ClaimRef; ref != nil {
+		claim.Namespace, claim.Name = ref.Namespace, ref.Name
+	}
+	return claim, nil
+}
+
+func (c *Client) get(path string, v any) error {
+	req, err := http.NewRequest("GET", c.base+path, nil)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var status struct{ Message string }
+		json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&status)
+		if status.Message == "" {
+			status.Message = resp.Status
+		}
+		return fmt.Errorf("kubernetes: %s", status.Message)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Volume is a volume directory of a pod on this node.
+type Volume struct {
+	PodUID string
+	// Plugin is the volume plugin, e.g. "kubernetes.io~csi".
+	Plugin string
+	// Name is the persistent volume name for persistent volumes, or the
+	// pod's volume name for inline ones.
+	Name string
+	Path string
+}
+
+// ephemeralPlugins hold pod configuration or scratch space rather than
+// persistent data.
+var ephemeralPlugins = map[string]bool{
+	"kubernetes.io~configmap":    true,
+	"kubernetes.io~secret":       true,
+	"kubernetes.io~projected":    true,
+	"kubernetes.io~downward-api": true,
+	"kubernetes.io~empty-dir":    true,
+}
+
+// KubeletVolumes lists the data volumes under the kubelet's pods directory
+// (usually /var/lib/kubelet/pods), laid out as
+// <pod-uid>/volumes/<plugin>/<name>. CSI volumes are mounted on a "mount"
+// subdirectory.
+func KubeletVolumes(podsDir string) ([]Volume, error) {
+	dirs, err := filepath.Glob(filepath.Join(podsDir, "*", "volumes", "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+	var volumes []Volume
+	for _, dir := range dirs {
+		rel, _ := filepath.Rel(podsDir, dir)
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		v := Volume{PodUID: parts[0], Plugin: parts[2], Name: parts[3], Path: dir}
+		if ephemeralPlugins[v.Plugin] {
+			continue
+		}
+		if v.Plugin == "kubernetes.io~csi" {
+			v.Path = filepath.Join(dir, "mount")
+		}
+		if info, err := os.Stat(v.Path); err != nil || !info.IsDir() {
+			continue
+		}
+		volumes = append(volumes, v)
+	}
+	return volumes, nil
+}
@@ -0,0 +1,82 @@
+package kube
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKubeletVolumes(t *testing.T) {
+	dir := t.TempDir()
+	for _, p := range []string{
+		"uid-1/volumes/kubernetes.io~csi/pvc-123/mount",
+		"uid-1/volumes/kubernetes.io~secret/token",
+		"uid-2/volumes/kubernetes.io~nfs/pv-nfs",
+		"uid-2/volumes/kubernetes.io~empty-dir/scratch",
+	} {
+		os.MkdirAll(filepath.Join(dir, p), 0755)
+	}
+	// A CSI volume that is not mounted yet has no mount directory.
+	os.MkdirAll(filepath.Join(dir, "uid-3/volumes/kubernetes.io~csi/pvc-456"), 0755)
+
+	volumes, err := KubeletVolumes(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumes) != 2 {
+		t.Fatalf("Expected 2 volumes, got %+v", volumes)
+	}
+	if v := volumes[0]; v.PodUID != "uid-1" || v.Name != "pvc-123" || v.Path != filepath.Join(dir, "uid-1/volumes/kubernetes.io~csi/pvc-123/mount") {
+		t.Errorf("Unexpected CSI volume %+v", v)
+	}
+	if v := volumes[1]; v.Plugin != "kubernetes.io~nfs" || v.Name != "pv-nfs" {
+		t.Errorf("Unexpected NFS volume %+v", v)
+	}
+}
+
+func TestClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"Unauthorized"}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v1/pods":
+			if r.URL.Query().Get("fieldSelector") != "spec.nodeName=node-1" {
+				t.Errorf("Unexpected field selector %q", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"items":[{"metadata":{"uid":"uid-1","name":"db-0","namespace":"shop"}}]}`))
+		case "/api/v1/persistentvolumes/pvc-123":
+			w.Write([]byte(`{"spec":{"storageClassName":"fast","claimRef":{"namespace":"shop","name":"data-db-0"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"not found"}`))
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, "secret", nil)
+	pods, err := c.Pods("node-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods) != 1 || pods[0] != (Pod{UID: "uid-1", Name: "db-0", Namespace: "shop"}) {
+		t.Errorf("Unexpected pods %+v", pods)
+	}
+	claim, err := c.PersistentVolume("pvc-123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *claim != (Claim{Namespace: "shop", Name: "data-db-0", StorageClass: "fast"}) {
+		t.Errorf("Unexpected claim %+v", claim)
+	}
+	if _, err := c.PersistentVolume("scratch"); err == nil {
+		t.Error("Expected an error for an unknown volume")
+	}
+	if _, err := NewClient(srv.URL, "wrong", nil).Pods("node-1"); err == nil || err.Error() != "kubernetes: Unauthorized" {
+		t.Errorf("Expected the API error message, got %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+// Package listfs is an fs.FS built from a list of paths with their sizes
+// and times, for scanning trees whose contents aren't at hand: a folder
+// listed by the browser's File System Access API, or the table of
+// contents of an archive or image.
+package listfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry is one listed file or directory. Directories implied by the paths
+// of other entries need not be listed.
+type Entry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	IsDir   bool      `json:"dir,omitempty"`
+}
+
+// ErrNoContents is returned when reading a listed file, as only its
+// metadata is known.
+var ErrNoContents = errors.New("listfs: file contents are not available")
+
+// FS is a read-only tree of listed entries. Files can be stat'ed and
+// directories read, but reading a file fails with ErrNoContents.
+type FS struct {
+	nodes map[string]*node
+}
+
+type node struct {
+	name     string
+	entry    Entry
+	children []*node
+}
+
+// New builds the tree. Paths are slash-separated, relative to the root;
+// leading slashes and "./" are dropped, and a later entry for the same
+// path replaces an earlier one.
+func New(entries []Entry) (*FS, error) {
+	f := &FS{nodes: map[string]*node{".": {name: ".", entry: Entry{Path: ".", IsDir: true}}}}
+	for _, e := range entries {
+		p := path.Clean(strings.TrimLeft(e.Path, "/"))
+		if !fs.ValidPath(p) {
+			return nil, &fs.PathError{Op: "add", Path: e.Path, Err: fs.ErrInvalid}
+		}
+		e.Path = p
+		if err := f.add(e); err != nil {
+			return nil, err
+		}
+	}
+	for _, n := range f.nodes {
+		sort.Slice(n.children, func(i, j int) bool { return n.children[i].name < n.children[j].name })
+	}
+	return f, nil
+}
+
+func (f *FS) add(e Entry) error {
+	if n := f.nodes[e.Path]; n != nil {
+		if n.entry.IsDir != e.IsDir {
+			return &fs.PathError{Op: "add", Path: e.Path, Err: errors.New("listed both as a file and a directory")}
+		}
+		n.entry = e
+		return nil
+	}
+	parent := f.nodes[path.Dir(e.Path)]
+	if parent == nil {
+		if err := f.add(Entry{Path: path.Dir(e.Path), IsDir: true, ModTime: e.ModTime}); err != nil {
+			return err
+		}
+		parent = f.nodes[path.Dir(e.Path)]
+	}
+	if !parent.entry.IsDir {
+		return &fs.PathError{Op: "add", Path: e.Path, Err: errors.New("parent is a file")}
+	}
+	n := &node{name: path.Base(e.Path), entry: e}
+	f.nodes[e.Path] = n
+	parent.children = append(parent.children, n)
+	return nil
+}
+
+func (f *FS) lookup(op, name string) (*node, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	n := f.nodes[name]
+	if n == nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return n, nil
+}
+
+// Open implements fs.FS.
+func (f *FS) Open(name string) (fs.File, error) {
+	n, err := f.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &file{node: n}, nil
+}
+
+// Stat implements fs.StatFS.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	n, err := f.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return info{n}, nil
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	n, err := f.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !n.entry.IsDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	out := make([]fs.DirEntry, len(n.children))
+	for i, c := range n.children {
+		out[i] = fs.FileInfoToDirEntry(info{c})
+	}
+	return out, nil
+}
+
+// info describes a node.
+type info struct{ n *node }
+
+func (i info) Name() string       { return i.n.name }
+func (i info) Size() int64        { return i.n.entry.Size }
+func (i info) ModTime() time.Time { return i.n.entry.ModTime }
+func (i info) IsDir() bool        { return i.n.entry.IsDir }
+func (i info) Sys() any           { return nil }
+func (i info) Mode() fs.FileMode {
+	if i.n.entry.IsDir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// file is an open node.
+type file struct {
+	*node
+	read int
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return info{f.node}, nil }
+func (f *file) Close() error               { return nil }
+
+func (f *file) Read([]byte) (int, error) {
+	if f.entry.IsDir {
+		return 0, &fs.PathError{Op: "read", Path: f.entry.Path, Err: errors.New("is a directory")}
+	}
+	if f.entry.Size == 0 {
+		return 0, io.EOF
+	}
+	return 0, &fs.PathError{Op: "read", Path: f.entry.Path, Err: ErrNoContents}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (f *file) ReadDir(count int) ([]fs.DirEntry, error) {
+	if !f.entry.IsDir {
+		return nil, &fs.PathError{Op: "readdir", Path: f.entry.Path, Err: errors.New("not a directory")}
+	}
+	rest := f.children[f.read:]
+	if count > 0 && len(rest) > count {
+		rest = rest[:count]
+	}
+	if count > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	f.read += len(rest)
+	out := make([]fs.DirEntry, len(rest))
+	for i, c := range rest {
+		out[i] = fs.FileInfoToDirEntry(info{c})
+	}
+	return out, nil
+}
@@ -0,0 +1,50 @@
+package listfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"reflect"
+	"testing"
+	"time"
+
+	"file-counter/pkg/scanner"
+)
+
+func TestFS(t *testing.T) {
+	now := time.Now()
+	f, err := New([]Entry{
+		{Path: "/photos/2024/a.jpg", Size: 3000, ModTime: now},
+		{Path: "photos/2024/b.jpg", Size: 2000},
+		{Path: "notes.txt", Size: 0},
+		{Path: "empty", IsDir: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	fs.WalkDir(f, ".", func(p string, d fs.DirEntry, err error) error {
+		paths = append(paths, p)
+		return err
+	})
+	want := []string{".", "empty", "notes.txt", "photos", "photos/2024", "photos/2024/a.jpg", "photos/2024/b.jpg"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("Walked %v, expected %v", paths, want)
+	}
+
+	result := scanner.NewScannerWithOptions(scanner.Options{FS: f, Quiet: true}).Start(".")
+	if result.TotalFiles != 3 || result.TotalDirs != 4 || result.TotalBytes != 5000 {
+		t.Errorf("Got %d files, %d dirs, %d bytes", result.TotalFiles, result.TotalDirs, result.TotalBytes)
+	}
+
+	file, _ := f.Open("photos/2024/a.jpg")
+	if _, err := io.ReadAll(file); !errors.Is(err, ErrNoContents) {
+		t.Errorf("Got %v reading a listed file", err)
+	}
+	if _, err := f.Stat("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Got %v for a missing file", err)
+	}
+	if _, err := New([]Entry{{Path: "a"}, {Path: "a/b"}}); err == nil {
+		t.Error("Expected a file below a file to be rejected")
+	}
+}
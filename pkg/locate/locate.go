@@ -0,0 +1,194 @@
+// Package locate reads the file name databases built by updatedb, so a
+// tree can be counted from the last index run instead of the disk.
+//
+// mlocate databases are parsed directly and record which entries are
+// directories. plocate databases are compressed with zstd and are read
+// through the plocate command, which does not say what is a directory.
+package locate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultDatabases are tried in order when no database is given.
+var DefaultDatabases = []string{
+	"/var/lib/plocate/plocate.db",
+	"/var/lib/mlocate/mlocate.db",
+}
+
+var (
+	mlocateMagic = []byte("\x00mlocate")
+	plocateMagic = []byte("\x00plocate")
+)
+
+// Info describes a database. Typed is false when the database does not
+// record which entries are directories; every entry is then reported as a
+// non-directory.
+type Info struct {
+	Path    string
+	Format  string
+	Updated time.Time
+	Typed   bool
+}
+
+// Find returns the first of DefaultDatabases that exists.
+func Find() (string, error) {
+	for _, db := range DefaultDatabases {
+		if _, err := os.Stat(db); err == nil {
+			return db, nil
+		}
+	}
+	return "", errors.New("no locate database found; run updatedb or pass one explicitly")
+}
+
+// Paths calls fn for every entry of the database db at or below root, in
+// database order. Returning an error from fn stops the read.
+func Paths(db, root string, fn func(path string, dir bool) error) (*Info, error) {
+	f, err := os.Open(db)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{Path: db, Updated: st.ModTime()}
+
+	br := bufio.NewReaderSize(f, 256*1024)
+	magic, _ := br.Peek(8)
+	switch {
+	case bytes.Equal(magic, mlocateMagic):
+		info.Format, info.Typed = "mlocate", true
+		return info, readMlocate(br, root, fn)
+	case bytes.Equal(magic, plocateMagic):
+		info.Format = "plocate"
+		return info, readPlocate(db, root, fn)
+	}
+	return nil, fmt.Errorf("%s: not an mlocate or plocate database", db)
+}
+
+// under reports whether path is root or inside it.
+func under(path, root string) bool {
+	return root == "/" || path == root || strings.HasPrefix(path, root+"/")
+}
+
+// readMlocate parses the mlocate format: a header with the root and the
+// updatedb configuration, then one block per directory holding its path
+// and its entries, each tagged as a file, a subdirectory or the end of the
+// block. Subdirectories are reported through their own blocks, so pruned
+// ones are not counted.
+func readMlocate(br *bufio.Reader, root string, fn func(string, bool) error) error {
+	var hdr [16]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+	if hdr[12] != 0 {
+		return fmt.Errorf("unsupported mlocate version %d", hdr[12])
+	}
+	confSize := int64(binary.BigEndian.Uint32(hdr[8:]))
+	if _, err := br.ReadString(0); err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+	if _, err := br.Discard(int(confSize)); err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+
+	var dirHdr [16]byte
+	for {
+		if _, err := io.ReadFull(br, dirHdr[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading directory: %w", err)
+		}
+		dir, err := readString(br)
+		if err != nil {
+			return err
+		}
+		inside := under(dir, root)
+		if inside {
+			if err := fn(dir, true); err != nil {
+				return err
+			}
+		}
+		for {
+			kind, err := br.ReadByte()
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", dir, err)
+			}
+			if kind == 2 {
+				break
+			}
+			name, err := readString(br)
+			if err != nil {
+				return err
+			}
+			if kind == 0 && inside {
+				path := dir + "/" + name
+				if dir == "/" {
+					path = "/" + name
+				}
+				if err := fn(path, false); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func readString(br *bufio.Reader) (string, error) {
+	s, err := br.ReadString(0)
+	if err != nil {
+		return "", fmt.Errorf("reading entry: %w", err)
+	}
+	return s[:len(s)-1], nil
+}
+
+// readPlocate lists the entries under root with the plocate command.
+func readPlocate(db, root string, fn func(string, bool) error) error {
+	if _, err := exec.LookPath("plocate"); err != nil {
+		return errors.New("reading a plocate database needs the plocate command")
+	}
+	pattern := "^" + regexp.QuoteMeta(strings.TrimSuffix(root, "/")) + "(/|$)"
+	cmd := exec.Command("plocate", "-d", db, "-0", "--regex", pattern)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	br := bufio.NewReader(out)
+	for {
+		path, rerr := br.ReadString(0)
+		if rerr != nil {
+			break
+		}
+		if err = fn(path[:len(path)-1], false); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	// plocate exits with 1 when nothing matched.
+	if werr := cmd.Wait(); werr != nil {
+		var exit *exec.ExitError
+		if !errors.As(werr, &exit) || exit.ExitCode() != 1 {
+			return fmt.Errorf("plocate: %w", werr)
+		}
+	}
+	return nil
+}
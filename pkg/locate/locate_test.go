@@ -0,0 +1,90 @@
+package locate
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// mlocateDB builds an mlocate database. Each directory is given as its path
+// followed by its entries, with a trailing "/" marking subdirectories.
+func mlocateDB(t *testing.T, dirs map[string][]string, order []string) string {
+	t.Helper()
+	db := append([]byte{}, mlocateMagic...)
+	conf := []byte("prune_bind_mounts\x001\x00\x00")
+	db = binary.BigEndian.AppendUint32(db, uint32(len(conf)))
+	db = append(db, 0, 0, 0, 0)
+	db = append(db, "/\x00"...)
+	db = append(db, conf...)
+	for _, dir := range order {
+		db = append(db, make([]byte, 16)...)
+		db = append(db, dir+"\x00"...)
+		for _, name := range dirs[dir] {
+			if n := len(name); name[n-1] == '/' {
+				db = append(db, 1)
+				db = append(db, name[:n-1]+"\x00"...)
+			} else {
+				db = append(db, 0)
+				db = append(db, name+"\x00"...)
+			}
+		}
+		db = append(db, 2)
+	}
+	path := filepath.Join(t.TempDir(), "mlocate.db")
+	if err := os.WriteFile(path, db, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMlocate(t *testing.T) {
+	db := mlocateDB(t, map[string][]string{
+		"/":             {"etc/", "srv/", "vmlinuz"},
+		"/etc":          {"hosts"},
+		"/srv":          {"data/", "readme"},
+		"/srv/data":     {"a.csv", "b.csv"},
+		"/srv/database": {"x"},
+	}, []string{"/", "/etc", "/srv", "/srv/data", "/srv/database"})
+
+	var got []string
+	info, err := Paths(db, "/srv/data", func(path string, dir bool) error {
+		if dir {
+			path += "/"
+		}
+		got = append(got, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Format != "mlocate" || !info.Typed {
+		t.Errorf("Unexpected database info %+v", info)
+	}
+	want := []string{"/srv/data/", "/srv/data/a.csv", "/srv/data/b.csv"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %q, expected %q", got, want)
+	}
+
+	var files, dirs int
+	Paths(db, "/", func(path string, dir bool) error {
+		if dir {
+			dirs++
+		} else {
+			files++
+		}
+		return nil
+	})
+	if files != 6 || dirs != 5 {
+		t.Errorf("Got %d files and %d dirs under /, expected 6 and 5", files, dirs)
+	}
+}
+
+func TestNotADatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "junk")
+	os.WriteFile(path, []byte("not a database"), 0644)
+	if _, err := Paths(path, "/", func(string, bool) error { return nil }); err == nil {
+		t.Error("Expected an error for a file that is not a locate database")
+	}
+}
@@ -0,0 +1,169 @@
+// Package logfile writes the log of a long-running command to a file that
+// is rotated by size and age, keeping a bounded number of old files, so a
+// daemon cannot fill the disks it is there to watch.
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stamp is appended to the name of a rotated file.
+const stamp = "20060102-150405.000"
+
+// Options says when a log file is rotated and how many old ones are kept.
+// The zero Options never rotates.
+type Options struct {
+	// MaxSize rotates the file before a write would take it past this many
+	// bytes.
+	MaxSize int64
+	// Every rotates the file once it has been written to for this long.
+	Every time.Duration
+	// Keep is how many rotated files are kept, newest first; 0 keeps them
+	// all.
+	Keep int
+	// MaxAge removes rotated files older than this.
+	MaxAge time.Duration
+}
+
+// File is a log file opened for appending. It is safe for concurrent use.
+type File struct {
+	name string
+	opts Options
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+	now    func() time.Time
+}
+
+// Open opens the log file name for appending, creating it if needed, and
+// removes rotated files that are past the retention limits.
+func Open(name string, opts Options) (*File, error) {
+	l := &File{name: name, opts: opts, now: time.Now}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	l.prune()
+	return l, nil
+}
+
+func (l *File) open() error {
+	f, err := os.OpenFile(l.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f, l.size, l.opened = f, info.Size(), l.now()
+	return nil
+}
+
+// Write appends p to the file, rotating it first if it is due. A single
+// write is never split across files, so a line larger than MaxSize still
+// goes out whole.
+func (l *File) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return 0, os.ErrClosed
+	}
+	if l.due(int64(len(p))) {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+func (l *File) due(n int64) bool {
+	if l.size == 0 {
+		return false
+	}
+	if l.opts.MaxSize > 0 && l.size+n > l.opts.MaxSize {
+		return true
+	}
+	return l.opts.Every > 0 && l.now().Sub(l.opened) >= l.opts.Every
+}
+
+// Rotate moves the current file aside, whatever its size and age, and
+// starts a new one.
+func (l *File) Rotate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return os.ErrClosed
+	}
+	return l.rotate()
+}
+
+func (l *File) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	l.f = nil
+	if err := os.Rename(l.name, l.name+"."+l.now().Format(stamp)); err != nil {
+		return err
+	}
+	if err := l.open(); err != nil {
+		return err
+	}
+	l.prune()
+	return nil
+}
+
+// Close closes the file.
+func (l *File) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// Rotated lists the rotated files of the log file name, oldest first.
+func Rotated(name string) ([]string, error) {
+	matches, err := filepath.Glob(name + ".*")
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, m := range matches {
+		if _, err := time.ParseInLocation(stamp, strings.TrimPrefix(m, name+"."), time.Local); err == nil {
+			out = append(out, m)
+		}
+	}
+	// The stamps sort in time order.
+	sort.Strings(out)
+	return out, nil
+}
+
+// prune removes the rotated files beyond Keep or older than MaxAge. A
+// file that can't be removed is tried again at the next rotation; the log
+// itself carries on regardless.
+func (l *File) prune() {
+	if l.opts.Keep <= 0 && l.opts.MaxAge <= 0 {
+		return
+	}
+	old, _ := Rotated(l.name)
+	for i, name := range old {
+		at, _ := time.ParseInLocation(stamp, strings.TrimPrefix(name, l.name+"."), time.Local)
+		expired := l.opts.MaxAge > 0 && l.now().Sub(at) > l.opts.MaxAge
+		if l.opts.Keep > 0 && i < len(old)-l.opts.Keep || expired {
+			os.Remove(name)
+		}
+	}
+}
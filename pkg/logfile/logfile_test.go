@@ -0,0 +1,89 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotation(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "watch.log")
+	clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	l, err := Open(name, Options{MaxSize: 10, Every: time.Hour, Keep: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.now = func() time.Time { return clock }
+
+	write := func(s string) {
+		t.Helper()
+		if _, err := l.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+		clock = clock.Add(time.Second)
+	}
+	write("12345\n")
+	write("6789\n") // 11 bytes would be past MaxSize
+	write("abc\n")
+	old, _ := Rotated(name)
+	if len(old) != 1 {
+		t.Fatalf("got %d rotated files, want 1", len(old))
+	}
+	if data, _ := os.ReadFile(old[0]); string(data) != "12345\n" {
+		t.Errorf("rotated file holds %q", data)
+	}
+	if data, _ := os.ReadFile(name); string(data) != "6789\nabc\n" {
+		t.Errorf("current file holds %q", data)
+	}
+
+	// A write larger than MaxSize is not split.
+	write(strings.Repeat("x", 20) + "\n")
+	if data, _ := os.ReadFile(name); len(data) != 21 {
+		t.Errorf("current file holds %q", data)
+	}
+
+	// Rotation by age, and only the newest Keep files stay.
+	clock = clock.Add(time.Hour)
+	write("late\n")
+	write("lt\n")
+	l.Rotate()
+	old, _ = Rotated(name)
+	if len(old) != 2 {
+		t.Fatalf("got %v, want the 2 newest rotated files", old)
+	}
+	if data, _ := os.ReadFile(old[1]); string(data) != "late\nlt\n" {
+		t.Errorf("newest rotated file holds %q", data)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Write([]byte("x")); err == nil {
+		t.Error("write after Close succeeded")
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "serve.log")
+	now := time.Now()
+	for _, age := range []time.Duration{48 * time.Hour, time.Hour} {
+		if err := os.WriteFile(name+"."+now.Add(-age).Format(stamp), []byte("old\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(name+".bak", nil, 0644)
+
+	l, err := Open(name, Options{MaxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	old, _ := Rotated(name)
+	if len(old) != 1 || !strings.HasSuffix(old[0], now.Add(-time.Hour).Format(stamp)) {
+		t.Errorf("got %v, want only the file from an hour ago", old)
+	}
+	if _, err := os.Stat(name + ".bak"); err != nil {
+		t.Errorf("unrelated file removed: %v", err)
+	}
+}
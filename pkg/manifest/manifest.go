@@ -0,0 +1,238 @@
+package manifest
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Entry is one line of a manifest. The on-disk format is the one produced by
+// sha256sum ("<hex>  <path>"), so manifests can also be checked with
+// `sha256sum -c` from the scan root.
+type Entry struct {
+	Path string
+	Hash string
+	// Err is set instead of Hash for a file or directory that could not
+	// be read. Such entries are not written to the manifest.
+	Err string
+}
+type Report struct {
+	Matched    int
+	Missing    []string
+	Added      []string
+	Mismatched []string
+	// Unreadable are the files and directories that could not be read,
+	// so the entries at or below them could not be checked.
+	Unreadable []Entry
+}
+
+func (r *Report) Clean() bool {
+	return len(r.Missing) == 0 && len(r.Added) == 0 && len(r.Mismatched) == 0 && len(r.Unreadable) == 0
+}
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+func Build(root string, skip func(path string) bool) ([]Entry, error) {
+	var entries []Entry
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d == nil && path == root {
+				return err
+			}
+			// Record what can't be read and carry on with the rest, like
+			// the scanner's error count does.
+			entries = append(entries, errorEntry(root, path, err))
+			return nil
+		}
+		if skip != nil && skip(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		hash, err := HashFile(path)
+		if err != nil {
+			entries = append(entries, errorEntry(root, path, err))
+			return nil
+		}
+		entries = append(entries, Entry{Path: filepath.ToSlash(rel), Hash: hash})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+func errorEntry(root, path string, err error) Entry {
+	rel, relErr := filepath.Rel(root, path)
+	if relErr != nil {
+		rel = path
+	}
+	return Entry{Path: filepath.ToSlash(rel), Err: err.Error()}
+}
+
+// pathEscaper escapes a path the way sha256sum does for a line that starts
+// with a backslash.
+var pathEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// unescapePath reverses pathEscaper.
+func unescapePath(s string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i++; i == len(s) {
+			return "", false
+		}
+		switch s[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'n':
+			b.WriteByte('\n')
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+func Write(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range entries {
+		if e.Err != "" {
+			continue
+		}
+		// Like sha256sum, mark a line whose path has a newline or a
+		// backslash with a leading backslash and escape them.
+		prefix, p := "", e.Path
+		if strings.ContainsAny(p, "\\\n") {
+			prefix, p = `\`, pathEscaper.Replace(p)
+		}
+		if _, err := fmt.Fprintf(bw, "%s%s  %s\n", prefix, e.Hash, p); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+func Read(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := sc.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		// A leading backslash means the path is escaped.
+		escaped := strings.HasPrefix(text, `\`)
+		if escaped {
+			text = text[1:]
+		}
+		// sha256sum uses "  " for text mode and " *" for binary mode.
+		if len(text) < 67 || text[64] != ' ' || (text[65] != ' ' && text[65] != '*') {
+			return nil, fmt.Errorf("line %d: malformed manifest entry", line)
+		}
+		hash := strings.ToLower(text[:64])
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("line %d: invalid hash: %v", line, err)
+		}
+		p := text[66:]
+		if escaped {
+			var ok bool
+			if p, ok = unescapePath(p); !ok {
+				return nil, fmt.Errorf("line %d: malformed escape in path", line)
+			}
+		}
+		entries = append(entries, Entry{Path: p, Hash: hash})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+func Verify(root string, entries []Entry, skip func(path string) bool) (*Report, error) {
+	current, err := Build(root, skip)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+	seen := make(map[string]string, len(current))
+	for _, e := range current {
+		if e.Err != "" {
+			report.Unreadable = append(report.Unreadable, e)
+			continue
+		}
+		seen[e.Path] = e.Hash
+	}
+	unreadableDirs := make(map[string]bool, len(report.Unreadable))
+	for _, u := range report.Unreadable {
+		unreadableDirs[u.Path] = true
+	}
+	// unreadable reports whether p is at or below an unreadable path.
+	unreadable := func(p string) bool {
+		for {
+			if unreadableDirs[p] {
+				return true
+			}
+			if p == "." || p == "/" {
+				return false
+			}
+			p = path.Dir(p)
+		}
+	}
+
+	expected := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		expected[e.Path] = true
+		hash, ok := seen[e.Path]
+		switch {
+		case !ok && unreadable(e.Path):
+			// Reported as unreadable rather than missing.
+		case !ok:
+			report.Missing = append(report.Missing, e.Path)
+		case hash != e.Hash:
+			report.Mismatched = append(report.Mismatched, e.Path)
+		default:
+			report.Matched++
+		}
+	}
+	for _, e := range current {
+		if e.Err == "" && !expected[e.Path] {
+			report.Added = append(report.Added, e.Path)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,205 @@
+package manifest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		full := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWriteReadRoundTrip(t *testing.T) {
+	entries := []Entry{
+		{Path: "a.txt", Hash: strings.Repeat("ab", 32)},
+		{Path: "dir/with space.txt", Hash: strings.Repeat("01", 32)},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(entries) {
+		t.Fatalf("Expected %d entries, got %d", len(entries), len(got))
+	}
+	for i := range entries {
+		if got[i] != entries[i] {
+			t.Errorf("Entry %d = %+v, expected %+v", i, got[i], entries[i])
+		}
+	}
+}
+
+func TestEscapedPaths(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	entries := []Entry{
+		{Path: `back\slash.txt`, Hash: hash},
+		{Path: "new\nline.txt", Hash: hash},
+		{Path: "plain.txt", Hash: hash},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+	// The lines sha256sum writes for the same names.
+	want := `\` + hash + `  back\\slash.txt` + "\n" +
+		`\` + hash + `  new\nline.txt` + "\n" +
+		hash + "  plain.txt\n"
+	if buf.String() != want {
+		t.Errorf("Wrote %q, expected %q", buf.String(), want)
+	}
+
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(entries) {
+		t.Fatalf("Expected %d entries, got %d", len(entries), len(got))
+	}
+	for i := range entries {
+		if got[i] != entries[i] {
+			t.Errorf("Entry %d = %+v, expected %+v", i, got[i], entries[i])
+		}
+	}
+}
+
+func TestReadRejectsMalformed(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	for _, text := range []string{
+		"not a manifest line\n",
+		`\` + hash + `  bad\tescape.txt` + "\n",
+		`\` + hash + `  trailing\` + "\n",
+	} {
+		if _, err := Read(strings.NewReader(text)); err == nil {
+			t.Errorf("Expected an error for %q", text)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"keep.txt":       "unchanged",
+		"change.txt":     "before",
+		"sub/remove.txt": "gone soon",
+	})
+
+	entries, err := Build(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+
+	writeTree(t, root, map[string]string{
+		"change.txt": "after",
+		"added.txt":  "new",
+	})
+	if err := os.Remove(filepath.Join(root, "sub", "remove.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Verify(root, entries, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Clean() {
+		t.Fatal("Expected differences to be reported")
+	}
+	if report.Matched != 1 {
+		t.Errorf("Expected 1 match, got %d", report.Matched)
+	}
+	if len(report.Missing) != 1 || report.Missing[0] != "sub/remove.txt" {
+		t.Errorf("Unexpected missing list: %v", report.Missing)
+	}
+	if len(report.Added) != 1 || report.Added[0] != "added.txt" {
+		t.Errorf("Unexpected added list: %v", report.Added)
+	}
+	if len(report.Mismatched) != 1 || report.Mismatched[0] != "change.txt" {
+		t.Errorf("Unexpected mismatch list: %v", report.Mismatched)
+	}
+}
+
+func TestUnreadable(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"keep.txt":         "readable",
+		"secret.txt":       "hidden",
+		"locked/inner.txt": "hidden too",
+	})
+	entries, err := Build(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, locked := filepath.Join(root, "secret.txt"), filepath.Join(root, "locked")
+	if err := os.Chmod(secret, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(locked, 0755) })
+	if f, err := os.Open(secret); err == nil {
+		f.Close()
+		t.Skip("File permissions are not enforced for this user")
+	}
+
+	current, err := Build(root, nil)
+	if err != nil {
+		t.Fatalf("Build gave up on an unreadable entry: %v", err)
+	}
+	var paths []string
+	for _, e := range current {
+		if e.Err == "" {
+			continue
+		}
+		if e.Hash != "" {
+			t.Errorf("Error entry %s has a hash", e.Path)
+		}
+		paths = append(paths, e.Path)
+	}
+	if strings.Join(paths, " ") != "locked secret.txt" {
+		t.Errorf("Expected locked and secret.txt to be unreadable, got %q", paths)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, current); err != nil {
+		t.Fatal(err)
+	}
+	if written, _ := Read(&buf); len(written) != 1 || written[0].Path != "keep.txt" {
+		t.Errorf("Expected only keep.txt in the manifest, got %+v", written)
+	}
+
+	report, err := Verify(root, entries, nil)
+	if err != nil {
+		t.Fatalf("Verify gave up on an unreadable entry: %v", err)
+	}
+	if report.Clean() {
+		t.Error("Expected unreadable entries to make the report unclean")
+	}
+	if report.Matched != 1 || len(report.Missing) != 0 || len(report.Added) != 0 || len(report.Mismatched) != 0 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if len(report.Unreadable) != 2 {
+		t.Errorf("Expected 2 unreadable entries, got %+v", report.Unreadable)
+	}
+}
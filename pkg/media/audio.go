@@ -0,0 +1,468 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// tags are the textual tags of a track, in whichever format it has them.
+type tags struct {
+	artist, albumArtist, album, title string
+}
+
+// set fills info's tag fields that are still empty from t.
+func (t tags) set(info *Info) {
+	fill(&info.Artist, t.artist)
+	fill(&info.AlbumArtist, t.albumArtist)
+	fill(&info.Album, t.album)
+	fill(&info.Title, t.title)
+}
+
+func fill(dst *string, v string) {
+	if *dst == "" {
+		*dst = strings.TrimSpace(v)
+	}
+}
+
+// readUdta reads the iTunes-style tags in an MP4 user data box, kept as
+// udta/meta/ilst with a box per tag holding a data box.
+func readUdta(r io.ReaderAt, off, end int64, info *Info) error {
+	var t tags
+	err := boxes(r, off, end, func(typ string, off, end int64) error {
+		if typ != "meta" {
+			return nil
+		}
+		// meta is a full box in MP4 files but not in QuickTime ones,
+		// where its first child comes straight away.
+		b, err := readAt(r, off, 8)
+		if err != nil {
+			return err
+		}
+		if string(b[4:8]) != "hdlr" {
+			off += 4
+		}
+		return boxes(r, off, end, func(typ string, off, end int64) error {
+			if typ != "ilst" {
+				return nil
+			}
+			return boxes(r, off, end, func(typ string, off, end int64) error {
+				var dst *string
+				switch typ {
+				case "\xa9ART":
+					dst = &t.artist
+				case "aART":
+					dst = &t.albumArtist
+				case "\xa9alb":
+					dst = &t.album
+				case "\xa9nam":
+					dst = &t.title
+				default:
+					return nil
+				}
+				return boxes(r, off, end, func(typ string, off, end int64) error {
+					// Data type 1 is UTF-8 text, after the type and
+					// locale.
+					if typ != "data" || end-off < 8 || end-off > 8+1024 {
+						return nil
+					}
+					b, err := readAt(r, off, int(end-off))
+					if err != nil {
+						return err
+					}
+					if binary.BigEndian.Uint32(b) == 1 {
+						*dst = string(b[8:])
+					}
+					return nil
+				})
+			})
+		})
+	})
+	t.set(info)
+	return err
+}
+
+// readID3File reads a file starting with an ID3v2 tag: an MP3 file, or
+// rarely a FLAC file someone tagged the MP3 way.
+func readID3File(r io.ReaderAt, size int64) (*Info, error) {
+	t, start, err := readID3v2(r)
+	if err != nil {
+		return nil, err
+	}
+	if b, err := readAtMost(r, start, 4); err == nil && string(b) == "fLaC" {
+		info, err := readFLAC(r, start)
+		if info != nil {
+			t.set(info)
+		}
+		return info, err
+	}
+	info, err := readMP3(r, size, start, true)
+	if info != nil {
+		t.set(info)
+	}
+	return info, err
+}
+
+// readID3v2 reads the text frames of interest in the ID3v2 tag at the
+// start of r, and returns where the audio after the tag starts.
+func readID3v2(r io.ReaderAt) (tags, int64, error) {
+	var t tags
+	h, err := readAt(r, 0, 10)
+	if err != nil {
+		return t, 0, err
+	}
+	major, flags := h[3], h[5]
+	end := 10 + syncsafe(h[6:10])
+	if flags&0x10 != 0 { // footer
+		end += 10
+	}
+	pos := int64(10)
+	if flags&0x40 != 0 && major >= 3 { // extended header
+		b, err := readAt(r, pos, 4)
+		if err != nil {
+			return t, 0, err
+		}
+		if major == 4 {
+			pos += syncsafe(b)
+		} else {
+			pos += 4 + int64(binary.BigEndian.Uint32(b))
+		}
+	}
+	idLen, hdrLen := 4, 10
+	if major == 2 {
+		idLen, hdrLen = 3, 6
+	}
+	for pos+int64(hdrLen) <= end {
+		fh, err := readAt(r, pos, hdrLen)
+		if err != nil {
+			break
+		}
+		if fh[0] == 0 { // padding
+			break
+		}
+		id := string(fh[:idLen])
+		var n int64
+		switch major {
+		case 2:
+			n = int64(fh[3])<<16 | int64(fh[4])<<8 | int64(fh[5])
+		case 3:
+			n = int64(binary.BigEndian.Uint32(fh[4:]))
+		default:
+			n = syncsafe(fh[4:8])
+		}
+		data := pos + int64(hdrLen)
+		pos = data + n
+		// Skip compressed and encrypted frames.
+		if major >= 3 && fh[9]&0x0c != 0 {
+			continue
+		}
+		var dst *string
+		switch id {
+		case "TPE1", "TP1":
+			dst = &t.artist
+		case "TPE2", "TP2":
+			dst = &t.albumArtist
+		case "TALB", "TAL":
+			dst = &t.album
+		case "TIT2", "TT2":
+			dst = &t.title
+		default:
+			continue
+		}
+		if n < 1 || n > 4096 || pos > end {
+			continue
+		}
+		b, err := readAt(r, data, int(n))
+		if err != nil {
+			return t, 0, err
+		}
+		*dst = id3Text(b)
+	}
+	return t, end, nil
+}
+
+// syncsafe decodes the 28-bit integers of ID3v2 headers, with the top bit
+// of each byte unused.
+func syncsafe(b []byte) int64 {
+	return int64(b[0]&0x7f)<<21 | int64(b[1]&0x7f)<<14 | int64(b[2]&0x7f)<<7 | int64(b[3]&0x7f)
+}
+
+// id3Text decodes a text frame: an encoding byte, then the text. Of
+// several values, only the first is kept.
+func id3Text(b []byte) string {
+	enc, b := b[0], b[1:]
+	switch enc {
+	case 0: // ISO-8859-1
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		return latin1(b)
+	case 1, 2: // UTF-16 with a BOM, or big-endian without
+		var order binary.ByteOrder = binary.BigEndian
+		if len(b) >= 2 && b[0] == 0xff && b[1] == 0xfe {
+			order, b = binary.LittleEndian, b[2:]
+		} else if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+			b = b[2:]
+		}
+		units := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			u := order.Uint16(b[i:])
+			if u == 0 {
+				break
+			}
+			units = append(units, u)
+		}
+		return string(utf16.Decode(units))
+	default: // UTF-8
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		return string(b)
+	}
+}
+
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// readID3v1 reads the fixed-size ID3v1 tag at the end of r, if there is
+// one.
+func readID3v1(r io.ReaderAt, size int64) (tags, bool) {
+	if size < 128 {
+		return tags{}, false
+	}
+	b, err := readAt(r, size-128, 128)
+	if err != nil || string(b[:3]) != "TAG" {
+		return tags{}, false
+	}
+	field := func(b []byte) string {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		return strings.TrimSpace(latin1(b))
+	}
+	return tags{title: field(b[3:33]), artist: field(b[33:63]), album: field(b[63:93])}, true
+}
+
+// MPEG audio layer III bitrates in kbit/s and sample rates in Hz, by
+// header index, for MPEG-1 and for MPEG-2 and 2.5.
+var (
+	mp3Bitrates = [2][16]int{
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	}
+	mp3Rates = [4][3]int{
+		{11025, 12000, 8000},  // MPEG 2.5
+		{},                    // reserved
+		{22050, 24000, 16000}, // MPEG 2
+		{44100, 48000, 32000}, // MPEG 1
+	}
+)
+
+// mp3Frame is a decoded MPEG audio frame header.
+type mp3Frame struct {
+	mpeg1   bool
+	mono    bool
+	bitrate int // kbit/s
+	rate    int // Hz
+	length  int // bytes, header included
+}
+
+// samples returns the number of samples per channel in a frame.
+func (f mp3Frame) samples() int {
+	if f.mpeg1 {
+		return 1152
+	}
+	return 576
+}
+
+// parseMP3Frame decodes a layer III frame header.
+func parseMP3Frame(b []byte) (mp3Frame, bool) {
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return mp3Frame{}, false
+	}
+	version, layer := b[1]>>3&3, b[1]>>1&3
+	bi, ri := b[2]>>4, b[2]>>2&3
+	if version == 1 || layer != 1 || bi == 0 || bi == 15 || ri == 3 {
+		return mp3Frame{}, false
+	}
+	f := mp3Frame{mpeg1: version == 3, mono: b[3]>>6 == 3, rate: mp3Rates[version][ri]}
+	if f.mpeg1 {
+		f.bitrate = mp3Bitrates[0][bi]
+	} else {
+		f.bitrate = mp3Bitrates[1][bi]
+	}
+	f.length = f.samples()/8*f.bitrate*1000/f.rate + int(b[2]>>1&1)
+	return f, true
+}
+
+// readMP3 finds the first audio frame from start and works out the
+// playing time from the Xing or VBRI header of variable bitrate files, or
+// from the bitrate otherwise. Files without an ID3v2 tag have nothing but
+// the frame sync to go by, so the first frame must be at the start and be
+// followed by another.
+func readMP3(r io.ReaderAt, size, start int64, tagged bool) (*Info, error) {
+	window := 1
+	if tagged {
+		window = 64 * 1024 // encoders leave junk or padding after tags
+	}
+	b, err := readAtMost(r, start, window+3)
+	if err != nil {
+		return nil, err
+	}
+	var f mp3Frame
+	pos := -1
+	for i := 0; i+4 <= len(b) && i < window; i++ {
+		if b[i] != 0xff {
+			continue
+		}
+		var ok bool
+		if f, ok = parseMP3Frame(b[i:]); ok {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 {
+		return nil, errMalformed
+	}
+	first := start + int64(pos)
+	if !tagged {
+		next, err := readAt(r, first+int64(f.length), 4)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := parseMP3Frame(next); !ok {
+			return nil, errMalformed
+		}
+	}
+
+	info := &Info{Kind: "audio", Format: "mp3", Codec: "mp3"}
+	audioEnd := size
+	if t, ok := readID3v1(r, size); ok {
+		t.set(info)
+		audioEnd -= 128
+	}
+	// The side information before a Xing header depends on the version
+	// and channels.
+	side := 32
+	switch {
+	case f.mpeg1 && f.mono, !f.mpeg1 && !f.mono:
+		side = 17
+	case !f.mpeg1 && f.mono:
+		side = 9
+	}
+	frames := int64(-1)
+	if h, err := readAtMost(r, first+4+int64(side), 12); err == nil && len(h) == 12 &&
+		(string(h[:4]) == "Xing" || string(h[:4]) == "Info") && binary.BigEndian.Uint32(h[4:])&1 != 0 {
+		frames = int64(binary.BigEndian.Uint32(h[8:]))
+	} else if h, err := readAtMost(r, first+36, 18); err == nil && len(h) == 18 && string(h[:4]) == "VBRI" {
+		frames = int64(binary.BigEndian.Uint32(h[14:]))
+	}
+	if frames >= 0 {
+		info.Duration = seconds(float64(frames)*float64(f.samples()), float64(f.rate))
+	} else if audioEnd > first {
+		info.Duration = seconds(float64(audioEnd-first)*8, float64(f.bitrate)*1000)
+	}
+	return info, nil
+}
+
+// readFLAC reads the stream info and Vorbis comment blocks of the FLAC
+// stream at start.
+func readFLAC(r io.ReaderAt, start int64) (*Info, error) {
+	info := &Info{Kind: "audio", Format: "flac", Codec: "flac"}
+	var t tags
+	var streamInfo bool
+	pos := start + 4
+	for {
+		h, err := readAt(r, pos, 4)
+		if err != nil {
+			return nil, err
+		}
+		last, typ := h[0]&0x80 != 0, h[0]&0x7f
+		n := int64(h[1])<<16 | int64(h[2])<<8 | int64(h[3])
+		switch typ {
+		case 0: // STREAMINFO
+			b, err := readAt(r, pos+4, 18)
+			if err != nil {
+				return nil, err
+			}
+			rate := int64(b[10])<<12 | int64(b[11])<<4 | int64(b[12])>>4
+			samples := int64(b[13]&0x0f)<<32 | int64(binary.BigEndian.Uint32(b[14:]))
+			info.Duration = seconds(float64(samples), float64(rate))
+			streamInfo = true
+		case 4: // VORBIS_COMMENT
+			if n <= 1<<20 {
+				b, err := readAt(r, pos+4, int(n))
+				if err != nil {
+					return nil, err
+				}
+				t = vorbisComments(b)
+			}
+		}
+		pos += 4 + n
+		if last || typ == 0x7f {
+			break
+		}
+	}
+	if !streamInfo {
+		return nil, errMalformed
+	}
+	t.set(info)
+	return info, nil
+}
+
+// vorbisComments reads the tags of interest from a Vorbis comment block:
+// little-endian length-prefixed vendor string and KEY=value comments.
+func vorbisComments(b []byte) tags {
+	var t tags
+	next := func() ([]byte, bool) {
+		if len(b) < 4 {
+			return nil, false
+		}
+		n := binary.LittleEndian.Uint32(b)
+		if uint64(n) > uint64(len(b)-4) {
+			return nil, false
+		}
+		s := b[4 : 4+n]
+		b = b[4+n:]
+		return s, true
+	}
+	if _, ok := next(); !ok { // vendor
+		return t
+	}
+	if len(b) < 4 {
+		return t
+	}
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+	for i := uint32(0); i < count; i++ {
+		c, ok := next()
+		if !ok {
+			break
+		}
+		key, value, _ := strings.Cut(string(c), "=")
+		var dst *string
+		switch strings.ToUpper(key) {
+		case "ARTIST":
+			dst = &t.artist
+		case "ALBUMARTIST", "ALBUM ARTIST":
+			dst = &t.albumArtist
+		case "ALBUM":
+			dst = &t.album
+		case "TITLE":
+			dst = &t.title
+		default:
+			continue
+		}
+		if *dst == "" {
+			*dst = value
+		}
+	}
+	return t
+}
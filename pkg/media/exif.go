@@ -0,0 +1,191 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+)
+
+// EXIF tags used here.
+const (
+	tagMake             = 271
+	tagModel            = 272
+	tagExifIFD          = 34665
+	tagDateTimeOriginal = 36867
+)
+
+// exifTime is the layout of EXIF dates. They carry no time zone: they are
+// the camera's clock, which is usually local time.
+const exifTime = "2006:01:02 15:04:05"
+
+// readExif sets info's Taken and Camera from the EXIF data in the TIFF
+// structure t, whose first IFD is at first. Missing or damaged EXIF data
+// leaves them unset.
+func readExif(t *tiffReader, first uint32, info *Info) {
+	ifd0, _, err := t.ifd(first)
+	if err != nil {
+		return
+	}
+	maker, model := t.ascii(ifd0[tagMake]), t.ascii(ifd0[tagModel])
+	// Most models already start with the make, as in "Canon EOS R5".
+	if maker != "" && !strings.HasPrefix(strings.ToLower(model), strings.ToLower(strings.Fields(maker)[0])) {
+		model = strings.TrimSpace(maker + " " + model)
+	}
+	info.Camera = model
+	if off, ok := t.uint(ifd0[tagExifIFD]); ok {
+		if exif, _, err := t.ifd(off); err == nil {
+			if taken, err := time.Parse(exifTime, t.ascii(exif[tagDateTimeOriginal])); err == nil {
+				info.Taken = taken
+			}
+		}
+	}
+}
+
+// readExifSegment reads the EXIF data in the payload of a JPEG APP1
+// segment, if it holds any.
+func readExifSegment(seg []byte, info *Info) {
+	tiff, ok := bytes.CutPrefix(seg, []byte("Exif\x00\x00"))
+	if !ok {
+		return
+	}
+	if t, first, err := newTIFF(bytes.NewReader(tiff), 0); err == nil {
+		readExif(t, first, info)
+	}
+}
+
+// ascii returns the value of an ASCII field, without the trailing NULs and
+// padding some cameras add.
+func (t *tiffReader) ascii(e tiffEntry) string {
+	if e.typ != tiffASCII {
+		return ""
+	}
+	b, err := t.data(e)
+	if err != nil {
+		return ""
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// heifItems is what readHEIF collects about the items of a HEIF file to
+// find the one holding EXIF data.
+type heifItems struct {
+	exifID  uint32
+	hasExif bool
+	offsets map[uint32]int64 // item ID to file offset, for items stored in the file
+}
+
+// readInfe reads an item info entry, noting the ID of the EXIF item.
+func (h *heifItems) readInfe(r io.ReaderAt, off, end int64) error {
+	b, err := readAtMost(r, off, int(min(end-off, 12)))
+	if err != nil {
+		return err
+	}
+	c := cursor{b: b}
+	version := c.uint(4) >> 24
+	var id uint64
+	switch version {
+	case 2:
+		id = c.uint(2)
+	case 3:
+		id = c.uint(4)
+	default:
+		return nil
+	}
+	c.uint(2) // protection index
+	if typ := c.uint(4); !c.short && typ == 'E'<<24|'x'<<16|'i'<<8|'f' {
+		h.exifID, h.hasExif = uint32(id), true
+	}
+	return nil
+}
+
+// readIloc reads the item location box for where items start in the file.
+func (h *heifItems) readIloc(r io.ReaderAt, off, end int64) error {
+	if end-off > 1<<20 {
+		return nil
+	}
+	b, err := readAt(r, off, int(end-off))
+	if err != nil {
+		return err
+	}
+	c := cursor{b: b}
+	version := c.uint(4) >> 24
+	if version > 2 {
+		return nil
+	}
+	sizes := c.uint(2)
+	offsetSize, lengthSize := int(sizes>>12), int(sizes>>8&0xf)
+	baseSize, indexSize := int(sizes>>4&0xf), int(sizes&0xf)
+	if version == 0 {
+		indexSize = 0
+	}
+	idSize := 2
+	if version == 2 {
+		idSize = 4
+	}
+	count := c.uint(idSize)
+	h.offsets = map[uint32]int64{}
+	for i := uint64(0); i < count && !c.short; i++ {
+		id := uint32(c.uint(idSize))
+		method := uint64(0)
+		if version > 0 {
+			method = c.uint(2) & 0xf
+		}
+		c.uint(2) // data reference index
+		base := c.uint(baseSize)
+		extents := c.uint(2)
+		for j := uint64(0); j < extents && !c.short; j++ {
+			c.uint(indexSize)
+			extent := c.uint(offsetSize)
+			c.uint(lengthSize)
+			if j == 0 && method == 0 {
+				h.offsets[id] = int64(base + extent)
+			}
+		}
+	}
+	if c.short {
+		h.offsets = nil
+	}
+	return nil
+}
+
+// readExif reads the EXIF item, whose payload starts with the offset of
+// the TIFF header in the rest of it.
+func (h *heifItems) readExif(r io.ReaderAt, info *Info) {
+	off, ok := h.offsets[h.exifID]
+	if !h.hasExif || !ok {
+		return
+	}
+	b, err := readAt(r, off, 4)
+	if err != nil {
+		return
+	}
+	if t, first, err := newTIFF(r, off+4+int64(binary.BigEndian.Uint32(b))); err == nil {
+		readExif(t, first, info)
+	}
+}
+
+// cursor reads big-endian integers of any size up to 8 bytes in turn from
+// b. Reading past its end sets short and yields zeros.
+type cursor struct {
+	b     []byte
+	short bool
+}
+
+func (c *cursor) uint(n int) uint64 {
+	if n > 8 || n > len(c.b) {
+		c.short = true
+		c.b = nil
+		return 0
+	}
+	var v uint64
+	for _, x := range c.b[:n] {
+		v = v<<8 | uint64(x)
+	}
+	c.b = c.b[n:]
+	return v
+}
@@ -0,0 +1,308 @@
+package media
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+func readPNG(head []byte) (*Info, error) {
+	if len(head) < 24 || string(head[12:16]) != "IHDR" {
+		return nil, errMalformed
+	}
+	return &Info{
+		Kind:   "image",
+		Format: "png",
+		Width:  int(binary.BigEndian.Uint32(head[16:])),
+		Height: int(binary.BigEndian.Uint32(head[20:])),
+	}, nil
+}
+
+func readGIF(head []byte) (*Info, error) {
+	if len(head) < 10 {
+		return nil, errMalformed
+	}
+	return &Info{
+		Kind:   "image",
+		Format: "gif",
+		Width:  int(binary.LittleEndian.Uint16(head[6:])),
+		Height: int(binary.LittleEndian.Uint16(head[8:])),
+	}, nil
+}
+
+func readBMP(head []byte) (*Info, error) {
+	if len(head) < 26 {
+		return nil, errMalformed
+	}
+	info := &Info{Kind: "image", Format: "bmp"}
+	switch hdr := binary.LittleEndian.Uint32(head[14:]); {
+	case hdr == 12: // OS/2 BITMAPCOREHEADER
+		info.Width = int(binary.LittleEndian.Uint16(head[18:]))
+		info.Height = int(binary.LittleEndian.Uint16(head[20:]))
+	case hdr >= 40:
+		info.Width = int(int32(binary.LittleEndian.Uint32(head[18:])))
+		// Negative heights are top-down bitmaps.
+		info.Height = int(int32(binary.LittleEndian.Uint32(head[22:])))
+		if info.Height < 0 {
+			info.Height = -info.Height
+		}
+	default:
+		return nil, errMalformed
+	}
+	if info.Width <= 0 {
+		return nil, errMalformed
+	}
+	return info, nil
+}
+
+func readWebP(head []byte) (*Info, error) {
+	if len(head) < 30 {
+		return nil, errMalformed
+	}
+	info := &Info{Kind: "image", Format: "webp"}
+	switch string(head[12:16]) {
+	case "VP8 ": // lossy
+		if string(head[23:26]) != "\x9d\x01\x2a" {
+			return nil, errMalformed
+		}
+		info.Width = int(binary.LittleEndian.Uint16(head[26:]) & 0x3fff)
+		info.Height = int(binary.LittleEndian.Uint16(head[28:]) & 0x3fff)
+	case "VP8L": // lossless
+		if head[20] != 0x2f {
+			return nil, errMalformed
+		}
+		bits := binary.LittleEndian.Uint32(head[21:])
+		info.Width = int(bits&0x3fff) + 1
+		info.Height = int(bits>>14&0x3fff) + 1
+	case "VP8X": // extended
+		info.Width = int(uint32(head[24])|uint32(head[25])<<8|uint32(head[26])<<16) + 1
+		info.Height = int(uint32(head[27])|uint32(head[28])<<8|uint32(head[29])<<16) + 1
+	default:
+		return nil, errMalformed
+	}
+	return info, nil
+}
+
+// readJPEG walks the marker segments up to the frame header, which holds
+// the dimensions, reading the EXIF data on the way.
+func readJPEG(r io.ReaderAt, size int64) (*Info, error) {
+	info := &Info{Kind: "image", Format: "jpeg"}
+	br := bufio.NewReader(io.NewSectionReader(r, 2, size-2))
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if c != 0xff {
+			return nil, errMalformed
+		}
+		// Markers may be preceded by any number of 0xff fill bytes.
+		for c == 0xff {
+			if c, err = br.ReadByte(); err != nil {
+				return nil, err
+			}
+		}
+		switch {
+		case c == 0x01 || c >= 0xd0 && c <= 0xd8:
+			continue // no length or payload
+		case c == 0xd9 || c == 0xda:
+			return nil, errMalformed // image data before any frame header
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(br, length[:]); err != nil {
+			return nil, err
+		}
+		n := int(binary.BigEndian.Uint16(length[:])) - 2
+		if n < 0 {
+			return nil, errMalformed
+		}
+		// SOF0 to SOF15, except DHT, JPG and DAC which share the range.
+		if c >= 0xc0 && c <= 0xcf && c != 0xc4 && c != 0xc8 && c != 0xcc {
+			if n < 5 {
+				return nil, errMalformed
+			}
+			seg := make([]byte, 5)
+			if _, err := io.ReadFull(br, seg); err != nil {
+				return nil, err
+			}
+			info.Height = int(binary.BigEndian.Uint16(seg[1:]))
+			info.Width = int(binary.BigEndian.Uint16(seg[3:]))
+			return info, nil
+		}
+		if c == 0xe1 && info.Taken.IsZero() && info.Camera == "" { // APP1, where EXIF is kept
+			seg := make([]byte, n)
+			if _, err := io.ReadFull(br, seg); err != nil {
+				return nil, err
+			}
+			readExifSegment(seg, info)
+			continue
+		}
+		if _, err := br.Discard(n); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// TIFF tags used here.
+const (
+	tagSubfileType = 254
+	tagImageWidth  = 256
+	tagImageHeight = 257
+	tagSubIFDs     = 330
+)
+
+// readTIFF reads the dimensions of the first full-resolution image. Raw
+// camera formats built on TIFF, such as DNG, often start with a thumbnail
+// and keep the full image in a sub-IFD.
+func readTIFF(r io.ReaderAt) (*Info, error) {
+	t, first, err := newTIFF(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	ifd, _, err := t.ifd(first)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{Kind: "image", Format: "tiff"}
+	t.dimensions(ifd, info)
+	readExif(t, first, info)
+	if sub, ok := t.uint(ifd[tagSubfileType]); ok && sub&1 != 0 {
+		offsets, _ := t.uints(ifd[tagSubIFDs])
+		for _, off := range offsets {
+			if sub, _, err := t.ifd(off); err == nil {
+				t.dimensions(sub, info)
+			}
+		}
+	}
+	if info.Width == 0 {
+		return nil, errMalformed
+	}
+	return info, nil
+}
+
+// dimensions sets info's dimensions to those in ifd if they are larger.
+func (t *tiffReader) dimensions(ifd map[uint16]tiffEntry, info *Info) {
+	w, wok := t.uint(ifd[tagImageWidth])
+	h, hok := t.uint(ifd[tagImageHeight])
+	if wok && hok && uint64(w)*uint64(h) > uint64(info.Width)*uint64(info.Height) {
+		info.Width, info.Height = int(w), int(h)
+	}
+}
+
+// tiffReader reads the IFDs of a TIFF structure starting at base, which is
+// where offsets count from.
+type tiffReader struct {
+	r     io.ReaderAt
+	base  int64
+	order binary.ByteOrder
+}
+
+// tiffEntry is one IFD field. value holds the value itself if it fits in
+// four bytes, and its offset otherwise.
+type tiffEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// TIFF field types used here, and their sizes.
+const (
+	tiffByte  = 1
+	tiffASCII = 2
+	tiffShort = 3
+	tiffLong  = 4
+)
+
+var tiffSizes = map[uint16]uint32{tiffByte: 1, tiffASCII: 1, tiffShort: 2, tiffLong: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+// newTIFF reads the TIFF header at base and returns the offset of the
+// first IFD.
+func newTIFF(r io.ReaderAt, base int64) (*tiffReader, uint32, error) {
+	head, err := readAt(r, base, 8)
+	if err != nil {
+		return nil, 0, err
+	}
+	t := &tiffReader{r: r, base: base}
+	switch string(head[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, 0, errMalformed
+	}
+	if t.order.Uint16(head[2:]) != 42 {
+		return nil, 0, errMalformed
+	}
+	return t, t.order.Uint32(head[4:]), nil
+}
+
+// ifd reads the IFD at off and returns its fields by tag, and the offset
+// of the next IFD.
+func (t *tiffReader) ifd(off uint32) (map[uint16]tiffEntry, uint32, error) {
+	head, err := readAt(t.r, t.base+int64(off), 2)
+	if err != nil {
+		return nil, 0, err
+	}
+	n := int(t.order.Uint16(head))
+	if n == 0 || n > 1000 {
+		return nil, 0, errMalformed
+	}
+	b, err := readAt(t.r, t.base+int64(off)+2, n*12+4)
+	if err != nil {
+		return nil, 0, err
+	}
+	fields := make(map[uint16]tiffEntry, n)
+	for i := 0; i < n; i++ {
+		e := b[i*12:]
+		fields[t.order.Uint16(e)] = tiffEntry{typ: t.order.Uint16(e[2:]), count: t.order.Uint32(e[4:]), value: e[8:12]}
+	}
+	return fields, t.order.Uint32(b[n*12:]), nil
+}
+
+// data returns the bytes of e's value, reading them from where its offset
+// points if they do not fit in the entry.
+func (t *tiffReader) data(e tiffEntry) ([]byte, error) {
+	size, ok := tiffSizes[e.typ]
+	if !ok || e.count == 0 || e.count > 1<<16 {
+		return nil, errMalformed
+	}
+	n := size * e.count
+	if n <= 4 {
+		return e.value[:n], nil
+	}
+	return readAt(t.r, t.base+int64(t.order.Uint32(e.value)), int(n))
+}
+
+// uint returns the first value of a SHORT or LONG field.
+func (t *tiffReader) uint(e tiffEntry) (uint32, bool) {
+	switch {
+	case e.count == 0:
+		return 0, false
+	case e.typ == tiffShort:
+		return uint32(t.order.Uint16(e.value)), true
+	case e.typ == tiffLong:
+		return t.order.Uint32(e.value), true
+	}
+	return 0, false
+}
+
+// uints returns all the values of a SHORT or LONG field.
+func (t *tiffReader) uints(e tiffEntry) ([]uint32, error) {
+	if e.typ != tiffShort && e.typ != tiffLong {
+		return nil, errMalformed
+	}
+	b, err := t.data(e)
+	if err != nil {
+		return nil, err
+	}
+	vals := make([]uint32, e.count)
+	for i := range vals {
+		if e.typ == tiffShort {
+			vals[i] = uint32(t.order.Uint16(b[i*2:]))
+		} else {
+			vals[i] = t.order.Uint32(b[i*4:])
+		}
+	}
+	return vals, nil
+}
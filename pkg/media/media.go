@@ -0,0 +1,158 @@
+// Package media reads the dimensions of images, the duration and codec of
+// videos and audio files, when and with what camera photos were taken and
+// the tags of music, from their headers and without decoding them. Only the few blocks
+// of a file that hold this metadata are read, so probing a large video is
+// about as cheap as probing a photo.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Info is what Probe found out about a media file. Width and Height are
+// zero when the headers did not say, as is Duration.
+type Info struct {
+	Kind     string // "image", "video" or "audio"
+	Format   string // e.g. "jpeg", "png", "mp4", "mkv", "mp3"
+	Width    int
+	Height   int
+	Duration time.Duration // videos and audio
+	Codec    string        // videos and audio, e.g. "h264", "aac"
+
+	// Taken is the EXIF DateTimeOriginal of photos that have one, as set
+	// on the camera's clock; the location is always UTC.
+	Taken time.Time
+	// Camera is the EXIF make and model of the camera, e.g. "Canon EOS R5".
+	Camera string
+
+	// The tags of audio files, from ID3, Vorbis comments in FLAC files or
+	// iTunes-style MP4 metadata.
+	Artist      string
+	AlbumArtist string
+	Album       string
+	Title       string
+}
+
+// Megapixels returns the image area in millions of pixels.
+func (i *Info) Megapixels() float64 {
+	return float64(i.Width) * float64(i.Height) / 1e6
+}
+
+// errMalformed is returned by the parsers for headers that do not make
+// sense; Read reports such files as not media.
+var errMalformed = errors.New("malformed media header")
+
+// Probe reads the headers of the file at path. It returns nil and no error
+// for files that are not an image, video or audio file in a format it
+// knows, and for damaged or truncated ones.
+func Probe(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Read(f, st.Size())
+}
+
+// Read is Probe for the size bytes of r.
+func Read(r io.ReaderAt, size int64) (*Info, error) {
+	head, err := readAtMost(r, 0, 64)
+	if err != nil {
+		return nil, err
+	}
+	var info *Info
+	switch {
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		info, err = readPNG(head)
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		info, err = readGIF(head)
+	case bytes.HasPrefix(head, []byte("BM")):
+		info, err = readBMP(head)
+	case bytes.HasPrefix(head, []byte("\xff\xd8\xff")):
+		info, err = readJPEG(r, size)
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		info, err = readTIFF(r)
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		info, err = readWebP(head)
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "AVI ":
+		info, err = readAVI(r, size)
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		info, err = readBMFF(r, size, head)
+	case bytes.HasPrefix(head, []byte("\x1a\x45\xdf\xa3")):
+		info, err = readMatroska(r, size)
+	case bytes.HasPrefix(head, []byte("ID3")):
+		info, err = readID3File(r, size)
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		info, err = readFLAC(r, 0)
+	case len(head) >= 2 && head[0] == 0xff && head[1]&0xe0 == 0xe0:
+		info, err = readMP3(r, size, 0, false)
+	}
+	if err != nil {
+		if errors.Is(err, errMalformed) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return info, nil
+}
+
+// readAt reads exactly n bytes at off.
+func readAt(r io.ReaderAt, off int64, n int) ([]byte, error) {
+	b := make([]byte, n)
+	m, err := r.ReadAt(b, off)
+	if m == n {
+		return b, nil
+	}
+	if err == io.EOF || err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return nil, err
+}
+
+// readAtMost reads up to n bytes at off, fewer at the end of r.
+func readAtMost(r io.ReaderAt, off int64, n int) ([]byte, error) {
+	b := make([]byte, n)
+	m, err := r.ReadAt(b, off)
+	if m == n || err == io.EOF {
+		return b[:m], nil
+	}
+	return nil, err
+}
+
+// codecNames maps the codec identifiers of the containers to common names.
+var codecNames = map[string]string{
+	// ISO BMFF sample entries
+	"avc1": "h264", "avc3": "h264", "hvc1": "hevc", "hev1": "hevc",
+	"av01": "av1", "vp08": "vp8", "vp09": "vp9", "mp4v": "mpeg4",
+	"apch": "prores", "apcn": "prores", "apcs": "prores", "apco": "prores", "ap4h": "prores", "ap4x": "prores",
+	"jpeg": "mjpeg", "mjpa": "mjpeg", "s263": "h263", "h263": "h263", "dvh1": "hevc", "dvhe": "hevc",
+	// AVI handlers, lower-cased
+	"h264": "h264", "x264": "h264", "hevc": "hevc", "h265": "hevc", "x265": "hevc",
+	"xvid": "mpeg4", "divx": "mpeg4", "dx50": "mpeg4", "fmp4": "mpeg4", "mjpg": "mjpeg",
+	"mpg2": "mpeg2", "wmv3": "wmv", "wvc1": "vc1",
+	// ISO BMFF audio sample entries
+	"mp4a": "aac", "alac": "alac", "ac-3": "ac3", "ec-3": "eac3", "opus": "opus", "flac": "flac",
+	// Matroska codec IDs
+	"v_mpeg4/iso/avc": "h264", "v_mpegh/iso/hevc": "hevc", "v_av1": "av1",
+	"v_vp8": "vp8", "v_vp9": "vp9", "v_mpeg2": "mpeg2", "v_mpeg4/iso/asp": "mpeg4",
+	"v_mpeg4/iso/sp": "mpeg4", "v_mjpeg": "mjpeg", "v_theora": "theora", "v_prores": "prores",
+}
+
+// codecName returns the common name of a container's codec identifier, or
+// the identifier itself when it is not a well-known one.
+func codecName(id string) string {
+	id = strings.TrimRight(id, " \x00")
+	if name, ok := codecNames[strings.ToLower(id)]; ok {
+		return name
+	}
+	return id
+}
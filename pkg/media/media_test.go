@@ -0,0 +1,324 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func probe(t *testing.T, data []byte) *Info {
+	t.Helper()
+	info, err := Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func be16(v int) []byte { return binary.BigEndian.AppendUint16(nil, uint16(v)) }
+func be32(v int) []byte { return binary.BigEndian.AppendUint32(nil, uint32(v)) }
+func le16(v int) []byte { return binary.LittleEndian.AppendUint16(nil, uint16(v)) }
+func le32(v int) []byte { return binary.LittleEndian.AppendUint32(nil, uint32(v)) }
+
+func cat(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+func TestImages(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	var pngData, gifData, jpegData bytes.Buffer
+	png.Encode(&pngData, img)
+	gif.Encode(&gifData, img, nil)
+	jpeg.Encode(&jpegData, img, nil)
+
+	bmp := cat([]byte("BM"), make([]byte, 12), le32(40), le32(40), le32(-30), make([]byte, 40))
+	webp := cat([]byte("RIFF"), le32(100), []byte("WEBPVP8L"), le32(10), []byte{0x2f}, le32(39|29<<14), make([]byte, 40))
+	tiff := cat([]byte("II*\x00"), le32(8), le16(2),
+		le16(tagImageWidth), le16(tiffShort), le32(1), le32(40),
+		le16(tagImageHeight), le16(tiffLong), le32(1), le32(30),
+		le32(0))
+
+	for name, data := range map[string][]byte{
+		"png":  pngData.Bytes(),
+		"gif":  gifData.Bytes(),
+		"jpeg": jpegData.Bytes(),
+		"bmp":  bmp,
+		"webp": webp,
+		"tiff": tiff,
+	} {
+		info := probe(t, data)
+		if info == nil || info.Kind != "image" || info.Format != name || info.Width != 40 || info.Height != 30 {
+			t.Errorf("%s: got %+v", name, info)
+		}
+	}
+}
+
+func box(typ string, payload ...[]byte) []byte {
+	data := cat(payload...)
+	return cat(be32(8+len(data)), []byte(typ), data)
+}
+
+func TestBMFF(t *testing.T) {
+	track := func(handler, codec string) []byte {
+		entry := cat(make([]byte, 8), make([]byte, 16), be16(1920), be16(1080), make([]byte, 50))
+		return box("trak",
+			box("tkhd", make([]byte, 84)),
+			box("mdia",
+				box("hdlr", make([]byte, 8), []byte(handler), make([]byte, 13)),
+				box("minf", box("stbl", box("stsd", make([]byte, 4), be32(1), box(codec, entry))))))
+	}
+	// mvhd version 0: timescale 1000, duration 90.5s.
+	mvhd := box("mvhd", make([]byte, 12), be32(1000), be32(90500), make([]byte, 80))
+	mdat := box("mdat", make([]byte, 1000))
+
+	mov := cat(box("ftyp", []byte("qt  "), be32(0)), mdat,
+		box("moov", mvhd, track("soun", "mp4a"), track("vide", "avc1")))
+	info := probe(t, mov)
+	want := Info{Kind: "video", Format: "mov", Width: 1920, Height: 1080, Duration: 90500 * time.Millisecond, Codec: "h264"}
+	if info == nil || *info != want {
+		t.Errorf("mov: got %+v", info)
+	}
+
+	// mvhd version 1, and a 64-bit box size.
+	mvhd1 := box("mvhd", []byte{1, 0, 0, 0}, make([]byte, 16), be32(600), binary.BigEndian.AppendUint64(nil, 600*3600), make([]byte, 80))
+	moov := box("moov", mvhd1, track("vide", "hvc1"))
+	large := cat(be32(1), []byte("moov"), binary.BigEndian.AppendUint64(nil, uint64(len(moov)+8)), moov[8:])
+	info = probe(t, cat(box("ftyp", []byte("isom"), be32(0)), large))
+	if info == nil || info.Format != "mp4" || info.Codec != "hevc" || info.Duration != time.Hour {
+		t.Errorf("mp4: got %+v", info)
+	}
+
+	tag := func(typ, value string) []byte { return box(typ, box("data", be32(1), be32(0), []byte(value))) }
+	m4a := cat(box("ftyp", []byte("M4A "), be32(0)), box("moov", mvhd, track("soun", "mp4a"),
+		box("udta", box("meta", make([]byte, 4), box("hdlr", make([]byte, 25)),
+			box("ilst", tag("\xa9nam", "Title"), tag("\xa9ART", "Artist"), tag("\xa9alb", "Album"), box("covr", make([]byte, 10)))))))
+	info = probe(t, m4a)
+	want = Info{Kind: "audio", Format: "m4a", Duration: 90500 * time.Millisecond, Codec: "aac", Artist: "Artist", Album: "Album", Title: "Title"}
+	if info == nil || *info != want {
+		t.Errorf("m4a: got %+v", info)
+	}
+
+	ispe := func(w, h int) []byte { return box("ispe", make([]byte, 4), be32(w), be32(h)) }
+	heic := cat(box("ftyp", []byte("mif1"), be32(0), []byte("mif1heic")),
+		box("meta", make([]byte, 4), box("hdlr", make([]byte, 24)),
+			box("iprp", box("ipco", ispe(320, 240), ispe(4032, 3024), box("colr", make([]byte, 4))))))
+	info = probe(t, heic)
+	if info == nil || info.Format != "heic" || info.Width != 4032 || info.Height != 3024 {
+		t.Errorf("heic: got %+v", info)
+	}
+}
+
+// element encodes an EBML element with a one-byte size, or an unknown size
+// if size is negative.
+func element(id int, size int, data ...[]byte) []byte {
+	var idBytes []byte
+	for v := id; v > 0; v >>= 8 {
+		idBytes = append([]byte{byte(v)}, idBytes...)
+	}
+	body := cat(data...)
+	if size < 0 {
+		return cat(idBytes, []byte{0xff}, body)
+	}
+	return cat(idBytes, []byte{0x80 | byte(len(body))}, body)
+}
+
+func TestMatroska(t *testing.T) {
+	duration := binary.BigEndian.AppendUint64(nil, math.Float64bits(12500))
+	mkv := cat(
+		element(ebmlHeader, 0, element(ebmlDocType, 0, []byte("webm"))),
+		element(mkvSegment, -1,
+			element(mkvInfo, 0, element(mkvTimescale, 0, []byte{0x0f, 0x42, 0x40}), element(mkvDuration, 0, duration)),
+			element(mkvTracks, 0,
+				element(mkvTrackEntry, 0, element(mkvTrackType, 0, []byte{2}), element(mkvCodecID, 0, []byte("A_OPUS"))),
+				element(mkvTrackEntry, 0, element(mkvTrackType, 0, []byte{1}), element(mkvCodecID, 0, []byte("V_VP9")),
+					element(mkvVideo, 0, element(mkvWidth, 0, be16(1280)), element(mkvHeight, 0, be16(720))))),
+			element(mkvCluster, -1, make([]byte, 100))))
+	info := probe(t, mkv)
+	want := Info{Kind: "video", Format: "webm", Width: 1280, Height: 720, Duration: 12500 * time.Millisecond, Codec: "vp9"}
+	if info == nil || *info != want {
+		t.Errorf("got %+v", info)
+	}
+}
+
+func chunk(id string, data ...[]byte) []byte {
+	body := cat(data...)
+	if len(body)%2 == 1 {
+		return cat([]byte(id), le32(len(body)), body, []byte{0})
+	}
+	return cat([]byte(id), le32(len(body)), body)
+}
+
+func TestAVI(t *testing.T) {
+	avih := cat(le32(40000), make([]byte, 12), le32(250), make([]byte, 12), le32(640), le32(480), make([]byte, 16))
+	avi := cat([]byte("RIFF"), le32(0), []byte("AVI "),
+		chunk("LIST", []byte("hdrl"), chunk("avih", avih),
+			chunk("LIST", []byte("strl"), chunk("strh", []byte("vidsXVID"), make([]byte, 48)), chunk("strn", []byte("odd")))),
+		chunk("LIST", []byte("movi"), make([]byte, 100)))
+	info := probe(t, avi)
+	want := Info{Kind: "video", Format: "avi", Width: 640, Height: 480, Duration: 10 * time.Second, Codec: "mpeg4"}
+	if info == nil || *info != want {
+		t.Errorf("got %+v", info)
+	}
+}
+
+func TestNotMedia(t *testing.T) {
+	var pngData bytes.Buffer
+	png.Encode(&pngData, image.NewGray(image.Rect(0, 0, 4, 4)))
+	for name, data := range map[string][]byte{
+		"text":      []byte("hello, world\n"),
+		"empty":     nil,
+		"truncated": pngData.Bytes()[:20],
+		"jpeg":      []byte("\xff\xd8\xff\xe0\x00\x10JFIF"),
+	} {
+		if info := probe(t, data); info != nil {
+			t.Errorf("%s: got %+v", name, info)
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "a.png")
+	var data bytes.Buffer
+	png.Encode(&data, image.NewGray(image.Rect(0, 0, 3000, 2000)))
+	os.WriteFile(name, data.Bytes(), 0644)
+	info, err := Probe(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info == nil || info.Megapixels() != 6 {
+		t.Errorf("got %+v", info)
+	}
+	if _, err := Probe(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+// exifTIFF returns a little-endian TIFF structure of a 60x40 image with the
+// given EXIF make, model and date.
+func exifTIFF(maker, model, date string) []byte {
+	ascii := func(s string) []byte { return append([]byte(s), 0) }
+	mk, md, dt := ascii(maker), ascii(model), ascii(date)
+	ifd0 := 8
+	strs := ifd0 + 2 + 5*12 + 4
+	exif := strs + len(mk) + len(md)
+	dateOff := exif + 2 + 12 + 4
+	return cat([]byte("II*\x00"), le32(ifd0),
+		le16(5),
+		le16(tagImageWidth), le16(tiffShort), le32(1), le32(60),
+		le16(tagImageHeight), le16(tiffShort), le32(1), le32(40),
+		le16(tagMake), le16(tiffASCII), le32(len(mk)), le32(strs),
+		le16(tagModel), le16(tiffASCII), le32(len(md)), le32(strs+len(mk)),
+		le16(tagExifIFD), le16(tiffLong), le32(1), le32(exif),
+		le32(0),
+		mk, md,
+		le16(1), le16(tagDateTimeOriginal), le16(tiffASCII), le32(len(dt)), le32(dateOff), le32(0),
+		dt)
+}
+
+func TestExif(t *testing.T) {
+	taken := time.Date(2019, 7, 14, 18, 30, 5, 0, time.UTC)
+	tiff := exifTIFF("Canon", "Canon EOS R5", "2019:07:14 18:30:05")
+
+	var jpegData bytes.Buffer
+	jpeg.Encode(&jpegData, image.NewGray(image.Rect(0, 0, 8, 8)), nil)
+	app1 := cat([]byte("Exif\x00\x00"), exifTIFF("NIKON CORPORATION", "D850", "2019:07:14 18:30:05"))
+	jpg := cat(jpegData.Bytes()[:2], []byte{0xff, 0xe1}, be16(len(app1)+2), app1, jpegData.Bytes()[2:])
+	info := probe(t, jpg)
+	if info == nil || info.Width != 8 || !info.Taken.Equal(taken) || info.Camera != "NIKON CORPORATION D850" {
+		t.Errorf("jpeg: got %+v", info)
+	}
+
+	info = probe(t, tiff)
+	if info == nil || info.Width != 60 || !info.Taken.Equal(taken) || info.Camera != "Canon EOS R5" {
+		t.Errorf("tiff: got %+v", info)
+	}
+
+	exifItem := cat(be32(6), []byte("Exif\x00\x00"), tiff)
+	infe := func(id int, typ string) []byte {
+		return box("infe", []byte{2, 0, 0, 0}, be16(id), be16(0), []byte(typ), []byte{0})
+	}
+	ispe := box("ispe", make([]byte, 4), be32(4032), be32(3024))
+	build := func(exifOff int) []byte {
+		return cat(box("ftyp", []byte("heic"), be32(0)),
+			box("meta", make([]byte, 4),
+				box("iinf", make([]byte, 4), be16(2), infe(1, "hvc1"), infe(2, "Exif")),
+				// Version 0, 4-byte offsets and lengths, no base offset.
+				box("iloc", make([]byte, 4), []byte{0x44, 0x00}, be16(1), be16(2), be16(0), be16(1), be32(exifOff), be32(len(exifItem))),
+				box("iprp", box("ipco", ispe))))
+	}
+	head := build(0)
+	heic := cat(build(len(head)), exifItem)
+	info = probe(t, heic)
+	if info == nil || info.Width != 4032 || !info.Taken.Equal(taken) || info.Camera != "Canon EOS R5" {
+		t.Errorf("heic: got %+v", info)
+	}
+}
+
+// mp3Frames returns n MPEG-1 layer III frames at 128 kbit/s and 44.1 kHz,
+// the first carrying xing in its payload.
+func mp3Frames(n int, xing []byte) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	var out []byte
+	for i := 0; i < n; i++ {
+		f := append([]byte(nil), frame...)
+		if i == 0 && xing != nil {
+			copy(f[4+32:], xing)
+		}
+		out = append(out, f...)
+	}
+	return out
+}
+
+// id3Frame encodes an ID3v2.3 frame.
+func id3Frame(id string, data []byte) []byte {
+	return cat([]byte(id), be32(len(data)), []byte{0, 0}, data)
+}
+
+func TestAudio(t *testing.T) {
+	// 100 frames of 1152 samples at 44.1 kHz is 2.612s; the Xing header
+	// says so for variable bitrate files.
+	xing := cat([]byte("Xing"), be32(1), be32(1000))
+	frames := cat(
+		id3Frame("TIT2", []byte("\x00Title")),
+		id3Frame("TPE1", cat([]byte{1, 0xff, 0xfe}, []byte("A\x00r\x00t\x00i\x00s\x00t\x00\xe9\x00"))),
+		id3Frame("APIC", make([]byte, 100)),
+		make([]byte, 20)) // padding
+	size := len(frames)
+	id3 := cat([]byte("ID3\x03\x00\x00"), []byte{byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}, frames)
+	v1 := cat([]byte("TAG"), make([]byte, 30), make([]byte, 30), []byte("Old Album"), make([]byte, 21+30+4+1))
+	info := probe(t, cat(id3, mp3Frames(3, xing), v1))
+	want := Info{Kind: "audio", Format: "mp3", Codec: "mp3", Duration: seconds(1000*1152, 44100), Artist: "Artisté", Album: "Old Album", Title: "Title"}
+	if info == nil || *info != want {
+		t.Errorf("vbr: got %+v", info)
+	}
+
+	// Without a Xing header the duration follows from the bitrate.
+	info = probe(t, mp3Frames(100, nil))
+	if info == nil || info.Duration != seconds(41700*8, 128000) || info.Artist != "" {
+		t.Errorf("cbr: got %+v", info)
+	}
+
+	comments := cat(le32(6), []byte("vendor"), le32(3),
+		le32(11), []byte("ARTIST=Band"), le32(10), []byte("album=Live"), le32(10), []byte("TITLE=Song"))
+	// 20 bits of 44100 Hz, channels and bits per sample, then 36 bits of
+	// 441000 samples: ten seconds.
+	streamInfo := cat(make([]byte, 10), []byte{0x0a, 0xc4, 0x42, 0xf0}, be32(441000))
+	flac := cat([]byte("fLaC"), []byte{0, 0, 0, 18}, streamInfo, []byte{0x84, 0, 0, byte(len(comments))}, comments, make([]byte, 100))
+	info = probe(t, flac)
+	want = Info{Kind: "audio", Format: "flac", Codec: "flac", Duration: 10 * time.Second, Artist: "Band", Album: "Live", Title: "Song"}
+	if info == nil || *info != want {
+		t.Errorf("flac: got %+v", info)
+	}
+
+	// A stray frame sync at the start of a file is not enough.
+	if info := probe(t, cat([]byte{0xff, 0xfb, 0x90, 0x00}, make([]byte, 1000))); info != nil {
+		t.Errorf("sync only: got %+v", info)
+	}
+}
@@ -0,0 +1,562 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"strings"
+	"time"
+)
+
+// errDone stops a walk over boxes, elements or chunks early.
+var errDone = errors.New("done")
+
+// seconds converts a duration in units of 1/scale seconds.
+func seconds(d, scale float64) time.Duration {
+	if scale <= 0 || d <= 0 || math.IsInf(d, 0) || math.IsNaN(d) {
+		return 0
+	}
+	return time.Duration(d / scale * float64(time.Second))
+}
+
+// boxes calls fn with the type and payload range of each ISO BMFF box in
+// [off, end). A box running past end, as the last one of a truncated file
+// does, is cut off there.
+func boxes(r io.ReaderAt, off, end int64, fn func(typ string, off, end int64) error) error {
+	for off+8 <= end {
+		h, err := readAt(r, off, 8)
+		if err != nil {
+			return err
+		}
+		size, hdr := int64(binary.BigEndian.Uint32(h)), int64(8)
+		switch size {
+		case 0: // to the end of the file
+			size = end - off
+		case 1: // 64-bit size follows
+			b, err := readAt(r, off+8, 8)
+			if err != nil {
+				return err
+			}
+			size, hdr = int64(binary.BigEndian.Uint64(b)), 16
+		}
+		if size < hdr {
+			return errMalformed
+		}
+		if size > end-off {
+			size = end - off
+		}
+		if err := fn(string(h[4:8]), off+hdr, off+size); err != nil {
+			return err
+		}
+		off += size
+	}
+	return nil
+}
+
+// readBMFF reads an ISO base media file: an MP4 or QuickTime video, M4A
+// audio, or a HEIF or AVIF image.
+func readBMFF(r io.ReaderAt, size int64, head []byte) (*Info, error) {
+	brand := string(head[8:12])
+	switch brand {
+	case "heic", "heix", "heim", "heis", "hevc", "hevx":
+		return readHEIF(r, size, "heic")
+	case "avif", "avis":
+		return readHEIF(r, size, "avif")
+	case "mif1", "msf1":
+		// Generic HEIF: tell AVIF apart by its compatible brands.
+		ftyp := int(binary.BigEndian.Uint32(head))
+		for i := 16; i+4 <= ftyp && i+4 <= len(head); i += 4 {
+			if b := string(head[i : i+4]); b == "avif" || b == "avis" {
+				return readHEIF(r, size, "avif")
+			}
+		}
+		return readHEIF(r, size, "heic")
+	}
+
+	info := &Info{Kind: "video", Format: "mp4"}
+	switch {
+	case brand == "qt  ":
+		info.Format = "mov"
+	case strings.HasPrefix(brand, "3g"):
+		info.Format = "3gp"
+	case brand == "M4V " || brand == "M4VH" || brand == "M4VP":
+		info.Format = "m4v"
+	case brand == "M4A " || brand == "M4B ":
+		info.Format = "m4a"
+	}
+	// The moov box holding the metadata is at the start of files made for
+	// streaming and at the end of others; the media data in between is
+	// skipped over, not read.
+	var audio string
+	err := boxes(r, 0, size, func(typ string, off, end int64) error {
+		if typ != "moov" {
+			return nil
+		}
+		if err := readMoov(r, off, end, info, &audio); err != nil {
+			return err
+		}
+		return errDone
+	})
+	if err != nil && err != errDone {
+		return nil, err
+	}
+	if info.Codec == "" {
+		if audio == "" {
+			return nil, nil
+		}
+		info.Kind, info.Codec = "audio", audio
+	}
+	return info, nil
+}
+
+// readMoov reads the movie duration, the codec and dimensions of the first
+// video track, the codec of the first audio track into audio, and the
+// iTunes-style tags.
+func readMoov(r io.ReaderAt, off, end int64, info *Info, audio *string) error {
+	return boxes(r, off, end, func(typ string, off, end int64) error {
+		switch typ {
+		case "mvhd":
+			b, err := readAtMost(r, off, 32)
+			if err != nil {
+				return err
+			}
+			switch {
+			case len(b) >= 20 && b[0] == 0:
+				if d := binary.BigEndian.Uint32(b[16:]); d != math.MaxUint32 {
+					info.Duration = seconds(float64(d), float64(binary.BigEndian.Uint32(b[12:])))
+				}
+			case len(b) >= 32 && b[0] == 1:
+				if d := binary.BigEndian.Uint64(b[24:]); d != math.MaxUint64 {
+					info.Duration = seconds(float64(d), float64(binary.BigEndian.Uint32(b[20:])))
+				}
+			}
+		case "trak":
+			t, err := readTrak(r, off, end)
+			if err != nil {
+				return err
+			}
+			switch {
+			case t.handler == "vide" && t.codec != "" && info.Codec == "":
+				info.Codec = codecName(t.codec)
+				info.Width, info.Height = t.width, t.height
+			case t.handler == "soun" && t.codec != "" && *audio == "":
+				*audio = codecName(t.codec)
+			}
+		case "udta":
+			return readUdta(r, off, end, info)
+		}
+		return nil
+	})
+}
+
+// track is what readTrak found out about a track.
+type track struct {
+	handler string // "vide", "soun" and so on
+	codec   string // the sample entry format
+	width   int
+	height  int
+}
+
+// readTrak reads a track's media type, and its codec and dimensions.
+func readTrak(r io.ReaderAt, off, end int64) (track, error) {
+	var t track
+	var walk func(typ string, off, end int64) error
+	walk = func(typ string, off, end int64) error {
+		switch typ {
+		case "mdia", "minf", "stbl":
+			return boxes(r, off, end, walk)
+		case "hdlr":
+			b, err := readAt(r, off, 12)
+			if err != nil {
+				return err
+			}
+			t.handler = string(b[8:12])
+		case "stsd":
+			// Version and flags, entry count, then the first sample
+			// entry: its size and format, and for video, the width and
+			// height 24 bytes into its payload.
+			b, err := readAtMost(r, off, 44)
+			if err != nil {
+				return err
+			}
+			if len(b) >= 16 {
+				t.codec = string(b[12:16])
+			}
+			if len(b) >= 44 {
+				t.width = int(binary.BigEndian.Uint16(b[40:]))
+				t.height = int(binary.BigEndian.Uint16(b[42:]))
+			}
+		}
+		return nil
+	}
+	err := boxes(r, off, end, func(typ string, off, end int64) error {
+		if typ == "mdia" {
+			return walk(typ, off, end)
+		}
+		return nil
+	})
+	return t, err
+}
+
+// readHEIF reads the dimensions of a HEIF image from the image spatial
+// extent properties. Thumbnails and grid tiles have their own; the largest
+// is the full image. EXIF data is kept in an item of its own, found through
+// the item info and location boxes.
+func readHEIF(r io.ReaderAt, size int64, format string) (*Info, error) {
+	info := &Info{Kind: "image", Format: format}
+	var items heifItems
+	var walk func(typ string, off, end int64) error
+	walk = func(typ string, off, end int64) error {
+		switch typ {
+		case "meta":
+			// A full box: version and flags come before the children.
+			return boxes(r, off+4, end, walk)
+		case "iprp", "ipco":
+			return boxes(r, off, end, walk)
+		case "iinf":
+			// A full box with an entry count, 16 bits in version 0.
+			b, err := readAt(r, off, 1)
+			if err != nil {
+				return err
+			}
+			skip := int64(6)
+			if b[0] > 0 {
+				skip = 8
+			}
+			return boxes(r, off+skip, end, walk)
+		case "infe":
+			return items.readInfe(r, off, end)
+		case "iloc":
+			return items.readIloc(r, off, end)
+		case "ispe":
+			b, err := readAt(r, off, 12)
+			if err != nil {
+				return err
+			}
+			w, h := binary.BigEndian.Uint32(b[4:]), binary.BigEndian.Uint32(b[8:])
+			if uint64(w)*uint64(h) > uint64(info.Width)*uint64(info.Height) {
+				info.Width, info.Height = int(w), int(h)
+			}
+		}
+		return nil
+	}
+	err := boxes(r, 0, size, func(typ string, off, end int64) error {
+		if typ != "meta" {
+			return nil
+		}
+		if err := walk(typ, off, end); err != nil {
+			return err
+		}
+		return errDone
+	})
+	if err != nil && err != errDone {
+		return nil, err
+	}
+	if info.Width == 0 {
+		return nil, errMalformed
+	}
+	items.readExif(r, info)
+	return info, nil
+}
+
+// Matroska element IDs used here.
+const (
+	ebmlHeader    = 0x1a45dfa3
+	ebmlDocType   = 0x4282
+	mkvSegment    = 0x18538067
+	mkvInfo       = 0x1549a966
+	mkvTimescale  = 0x2ad7b1
+	mkvDuration   = 0x4489
+	mkvTracks     = 0x1654ae6b
+	mkvTrackEntry = 0xae
+	mkvTrackType  = 0x83
+	mkvCodecID    = 0x86
+	mkvVideo      = 0xe0
+	mkvWidth      = 0xb0
+	mkvHeight     = 0xba
+	mkvCluster    = 0x1f43b675
+)
+
+// elements calls fn with the ID and data range of each EBML element in
+// [off, end). An element of unknown size runs to end and is the last one
+// walked, since where the next one starts is not known without parsing it.
+func elements(r io.ReaderAt, off, end int64, fn func(id uint32, off, end int64) error) error {
+	for off < end {
+		b, err := readAtMost(r, off, 12)
+		if err != nil {
+			return err
+		}
+		if len(b) == 0 || b[0] == 0 {
+			return errMalformed
+		}
+		n := bits.LeadingZeros8(b[0]) + 1
+		if n > 4 || len(b) < n+1 || b[n] == 0 {
+			return errMalformed
+		}
+		var id uint32
+		for _, c := range b[:n] {
+			id = id<<8 | uint32(c)
+		}
+		m := bits.LeadingZeros8(b[n]) + 1
+		if len(b) < n+m {
+			return io.ErrUnexpectedEOF
+		}
+		size := uint64(b[n] & (0xff >> m))
+		unknown := size == 0xff>>m
+		for _, c := range b[n+1 : n+m] {
+			size = size<<8 | uint64(c)
+			unknown = unknown && c == 0xff
+		}
+		data := off + int64(n+m)
+		next := end
+		if !unknown && size <= uint64(end-data) {
+			next = data + int64(size)
+		}
+		if err := fn(id, data, next); err != nil {
+			return err
+		}
+		if unknown {
+			return nil
+		}
+		off = next
+	}
+	return nil
+}
+
+// ebmlUint reads an unsigned integer element's value.
+func ebmlUint(r io.ReaderAt, off, end int64) (uint64, error) {
+	if end-off > 8 {
+		return 0, errMalformed
+	}
+	b, err := readAt(r, off, int(end-off))
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// ebmlString reads a string element's value.
+func ebmlString(r io.ReaderAt, off, end int64) (string, error) {
+	if end-off > 256 {
+		return "", errMalformed
+	}
+	b, err := readAt(r, off, int(end-off))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\x00"), nil
+}
+
+// readMatroska reads a Matroska or WebM video's duration from the segment
+// information and the codec and dimensions of its first video track. The
+// clusters of media data are skipped, and the walk stops once both have
+// been read.
+func readMatroska(r io.ReaderAt, size int64) (*Info, error) {
+	info := &Info{Kind: "video", Format: "mkv"}
+	var segment bool
+	scale, duration := 1000000.0, 0.0
+	var haveInfo, haveTracks bool
+	err := elements(r, 0, size, func(id uint32, off, end int64) error {
+		switch id {
+		case ebmlHeader:
+			return elements(r, off, end, func(id uint32, off, end int64) error {
+				if id == ebmlDocType {
+					if doc, err := ebmlString(r, off, end); err == nil && doc == "webm" {
+						info.Format = "webm"
+					}
+				}
+				return nil
+			})
+		case mkvSegment:
+			segment = true
+		default:
+			return nil
+		}
+		return elements(r, off, end, func(id uint32, off, end int64) error {
+			switch id {
+			case mkvInfo:
+				haveInfo = true
+				if err := elements(r, off, end, func(id uint32, off, end int64) error {
+					switch id {
+					case mkvTimescale:
+						v, err := ebmlUint(r, off, end)
+						if err != nil {
+							return err
+						}
+						scale = float64(v)
+					case mkvDuration:
+						b, err := readAt(r, off, int(min(end-off, 8)))
+						if err != nil {
+							return err
+						}
+						switch len(b) {
+						case 4:
+							duration = float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+						case 8:
+							duration = math.Float64frombits(binary.BigEndian.Uint64(b))
+						}
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+			case mkvTracks:
+				haveTracks = true
+				if err := elements(r, off, end, func(id uint32, off, end int64) error {
+					if id != mkvTrackEntry || info.Codec != "" {
+						return nil
+					}
+					return readMatroskaTrack(r, off, end, info)
+				}); err != nil {
+					return err
+				}
+			case mkvCluster:
+				if haveTracks {
+					return errDone
+				}
+			}
+			if haveInfo && haveTracks {
+				return errDone
+			}
+			return nil
+		})
+	})
+	if err != nil && err != errDone {
+		return nil, err
+	}
+	if !segment || info.Codec == "" {
+		return nil, nil
+	}
+	info.Duration = seconds(duration*scale, float64(time.Second))
+	return info, nil
+}
+
+// readMatroskaTrack sets info's codec and dimensions if the track entry is
+// a video track.
+func readMatroskaTrack(r io.ReaderAt, off, end int64, info *Info) error {
+	var video bool
+	var codec string
+	var width, height uint64
+	err := elements(r, off, end, func(id uint32, off, end int64) error {
+		var err error
+		switch id {
+		case mkvTrackType:
+			var t uint64
+			t, err = ebmlUint(r, off, end)
+			video = t == 1
+		case mkvCodecID:
+			codec, err = ebmlString(r, off, end)
+		case mkvVideo:
+			err = elements(r, off, end, func(id uint32, off, end int64) error {
+				var err error
+				switch id {
+				case mkvWidth:
+					width, err = ebmlUint(r, off, end)
+				case mkvHeight:
+					height, err = ebmlUint(r, off, end)
+				}
+				return err
+			})
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if video && codec != "" {
+		info.Codec = codecName(codec)
+		info.Width, info.Height = int(width), int(height)
+	}
+	return nil
+}
+
+// chunks calls fn with the ID and data range of each RIFF chunk in
+// [off, end). For LIST chunks, the ID passed is the list type, such as
+// "hdrl", and the data range is that of the chunks in the list.
+func chunks(r io.ReaderAt, off, end int64, fn func(id string, off, end int64) error) error {
+	for off+8 <= end {
+		h, err := readAt(r, off, 12)
+		if err != nil {
+			h, err = readAt(r, off, 8)
+			if err != nil {
+				return err
+			}
+		}
+		id, data := string(h[:4]), off+8
+		next := data + int64(binary.LittleEndian.Uint32(h[4:]))
+		if next > end {
+			next = end
+		}
+		if id == "LIST" && len(h) == 12 {
+			id, data = string(h[8:12]), data+4
+		}
+		if data > next {
+			return errMalformed
+		}
+		if err := fn(id, data, next); err != nil {
+			return err
+		}
+		off = next + (next-off)&1 // chunks are padded to even sizes
+	}
+	return nil
+}
+
+// readAVI reads an AVI video's frame count and rate from the main header
+// and the codec of its first video stream.
+func readAVI(r io.ReaderAt, size int64) (*Info, error) {
+	info := &Info{Kind: "video", Format: "avi"}
+	var usPerFrame, frames uint32
+	var header bool
+	var walk func(id string, off, end int64) error
+	walk = func(id string, off, end int64) error {
+		switch id {
+		case "hdrl", "strl", "odml":
+			return chunks(r, off, end, walk)
+		case "avih":
+			b, err := readAt(r, off, 40)
+			if err != nil {
+				return err
+			}
+			header = true
+			usPerFrame = binary.LittleEndian.Uint32(b)
+			if frames == 0 {
+				frames = binary.LittleEndian.Uint32(b[16:])
+			}
+			info.Width = int(binary.LittleEndian.Uint32(b[32:]))
+			info.Height = int(binary.LittleEndian.Uint32(b[36:]))
+		case "strh":
+			b, err := readAt(r, off, 8)
+			if err != nil {
+				return err
+			}
+			if string(b[:4]) == "vids" && info.Codec == "" {
+				info.Codec = codecName(string(b[4:8]))
+			}
+		case "dmlh":
+			// OpenDML files over 1 GB count all frames here; the main
+			// header only counts those in the first RIFF chunk.
+			b, err := readAt(r, off, 4)
+			if err != nil {
+				return err
+			}
+			frames = binary.LittleEndian.Uint32(b)
+		case "movi":
+			return errDone
+		}
+		return nil
+	}
+	if err := chunks(r, 12, size, walk); err != nil && err != errDone {
+		return nil, err
+	}
+	if !header || info.Codec == "" {
+		return nil, errMalformed
+	}
+	info.Duration = time.Duration(frames) * time.Duration(usPerFrame) * time.Microsecond
+	return info, nil
+}
@@ -0,0 +1,259 @@
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types.
+const (
+	packetConnect    = 1
+	packetConnAck    = 2
+	packetPublish    = 3
+	packetPubAck     = 4
+	packetPingReq    = 12
+	packetDisconnect = 14
+)
+
+// Options configure a connection.
+type Options struct {
+	ClientID string
+	User     string
+	Password string
+	TLS      *tls.Config
+	Timeout  time.Duration
+	// Will, when set, is published by the broker if the connection drops
+	// without a clean disconnect.
+	Will *Message
+}
+
+type Message struct {
+	Topic   string
+	Payload []byte
+	QoS     byte
+	Retain  bool
+}
+
+// Client is a minimal publish-only MQTT 3.1.1 client. QoS 1 publishes block
+// until the broker acknowledges them.
+type Client struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+	mu      sync.Mutex
+	nextID  uint16
+}
+
+var connAckErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+func Connect(addr string, opts Options) (*Client, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	var conn net.Conn
+	var err error
+	if opts.TLS != nil {
+		cfg := opts.TLS
+		if cfg.ServerName == "" {
+			host, _, _ := net.SplitHostPort(addr)
+			cfg = cfg.Clone()
+			cfg.ServerName = host
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, cfg)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mqtt: %w", err)
+	}
+
+	c := &Client{conn: conn, r: bufio.NewReader(conn), timeout: opts.Timeout}
+	if err := c.handshake(opts); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) handshake(opts Options) error {
+	flags := byte(0x02) // clean session
+	var payload []byte
+	payload = appendString(payload, opts.ClientID)
+	if w := opts.Will; w != nil {
+		flags |= 0x04 | w.QoS<<3
+		if w.Retain {
+			flags |= 0x20
+		}
+		payload = appendString(payload, w.Topic)
+		payload = appendBytes(payload, w.Payload)
+	}
+	if opts.User != "" {
+		flags |= 0x80
+		payload = appendString(payload, opts.User)
+		if opts.Password != "" {
+			flags |= 0x40
+			payload = appendString(payload, opts.Password)
+		}
+	}
+
+	var body []byte
+	body = appendString(body, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, 60) // keep alive, seconds
+	body = append(body, payload...)
+
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	defer c.conn.SetDeadline(time.Time{})
+	if err := c.writePacket(packetConnect<<4, body); err != nil {
+		return err
+	}
+	kind, resp, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if kind>>4 != packetConnAck || len(resp) != 2 {
+		return fmt.Errorf("mqtt: unexpected packet %d in reply to CONNECT", kind>>4)
+	}
+	if resp[1] != 0 {
+		reason := connAckErrors[resp[1]]
+		if reason == "" {
+			reason = fmt.Sprintf("return code %d", resp[1])
+		}
+		return fmt.Errorf("mqtt: connection refused: %s", reason)
+	}
+	return nil
+}
+
+// Publish sends msg, waiting for PUBACK when msg.QoS is 1. QoS 2 is not
+// supported.
+func (c *Client) Publish(msg Message) error {
+	if msg.QoS > 1 {
+		return errors.New("mqtt: QoS 2 is not supported")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header := byte(packetPublish<<4) | msg.QoS<<1
+	if msg.Retain {
+		header |= 0x01
+	}
+	body := appendString(nil, msg.Topic)
+	var id uint16
+	if msg.QoS == 1 {
+		c.nextID++
+		if c.nextID == 0 {
+			c.nextID = 1
+		}
+		id = c.nextID
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	body = append(body, msg.Payload...)
+
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	defer c.conn.SetDeadline(time.Time{})
+	if err := c.writePacket(header, body); err != nil {
+		return err
+	}
+	if msg.QoS == 0 {
+		return nil
+	}
+	for {
+		kind, resp, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+		if kind>>4 == packetPubAck && len(resp) == 2 && binary.BigEndian.Uint16(resp) == id {
+			return nil
+		}
+	}
+}
+
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	err := c.writePacket(packetDisconnect<<4, nil)
+	if cerr := c.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (c *Client) writePacket(header byte, body []byte) error {
+	packet := append([]byte{header}, encodeLength(len(body))...)
+	if _, err := c.conn.Write(append(packet, body...)); err != nil {
+		return fmt.Errorf("mqtt: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) readPacket() (byte, []byte, error) {
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, fmt.Errorf("mqtt: %w", err)
+	}
+	length, err := decodeLength(c.r)
+	if err != nil {
+		return 0, nil, fmt.Errorf("mqtt: %w", err)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, fmt.Errorf("mqtt: %w", err)
+	}
+	return header, body, nil
+}
+
+// encodeLength encodes the variable-length "remaining length" field.
+func encodeLength(n int) []byte {
+	var out []byte
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			return out
+		}
+	}
+}
+
+func decodeLength(r io.ByteReader) (int, error) {
+	n, shift := 0, 0
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return n, nil
+		}
+		shift += 7
+	}
+	return 0, errors.New("malformed remaining length")
+}
+
+func appendString(b []byte, s string) []byte {
+	return appendBytes(b, []byte(s))
+}
+
+func appendBytes(b, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
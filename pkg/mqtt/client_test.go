@@ -0,0 +1,125 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRemainingLength(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 16383, 16384, 2097151, 268435455} {
+		got, err := decodeLength(bytes.NewReader(encodeLength(n)))
+		if err != nil || got != n {
+			t.Errorf("Round trip of %d gave %d, %v", n, got, err)
+		}
+	}
+	if len(encodeLength(321)) != 2 {
+		t.Errorf("Expected 321 to encode in two bytes")
+	}
+}
+
+// fakeBroker accepts one connection, answers CONNECT with returnCode and
+// acknowledges QoS 1 publishes, recording their topics.
+type fakeBroker struct {
+	addr   string
+	mu     sync.Mutex
+	topics []string
+	will   string
+}
+
+func newFakeBroker(t *testing.T, returnCode byte) *fakeBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	b := &fakeBroker{addr: l.Addr().String()}
+
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+		for {
+			header, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			length, _ := decodeLength(r)
+			body := make([]byte, length)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return
+			}
+
+			switch header >> 4 {
+			case packetConnect:
+				// Skip protocol name, level, flags and keep alive to reach
+				// the client id, then the will topic if present.
+				flags := body[7]
+				rest := body[10:]
+				rest = rest[2+binary.BigEndian.Uint16(rest):]
+				if flags&0x04 != 0 {
+					b.mu.Lock()
+					b.will = string(rest[2 : 2+binary.BigEndian.Uint16(rest)])
+					b.mu.Unlock()
+				}
+				c.Write([]byte{packetConnAck << 4, 2, 0, returnCode})
+			case packetPublish:
+				n := binary.BigEndian.Uint16(body)
+				b.mu.Lock()
+				b.topics = append(b.topics, string(body[2:2+n]))
+				b.mu.Unlock()
+				if header&0x06 == 0x02 {
+					id := body[2+n : 4+n]
+					c.Write([]byte{packetPubAck << 4, 2, id[0], id[1]})
+				}
+			case packetDisconnect:
+				return
+			}
+		}
+	}()
+	return b
+}
+
+func TestPublish(t *testing.T) {
+	b := newFakeBroker(t, 0)
+	c, err := Connect(b.addr, Options{
+		ClientID: "test",
+		User:     "user",
+		Password: "secret",
+		Will:     &Message{Topic: "fc/status", Payload: []byte("offline"), Retain: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Publish(Message{Topic: "fc/state", Payload: []byte("{}"), QoS: 1, Retain: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.topics) != 1 || b.topics[0] != "fc/state" {
+		t.Errorf("Broker received %v", b.topics)
+	}
+	if b.will != "fc/status" {
+		t.Errorf("Will topic = %q, expected fc/status", b.will)
+	}
+}
+
+func TestConnectRefused(t *testing.T) {
+	b := newFakeBroker(t, 4)
+	_, err := Connect(b.addr, Options{ClientID: "test"})
+	if err == nil || !strings.Contains(err.Error(), "bad user name or password") {
+		t.Errorf("Expected authentication error, got %v", err)
+	}
+}
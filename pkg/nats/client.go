@@ -0,0 +1,291 @@
+package nats
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options configure a connection. User/Password and Token map to the
+// corresponding CONNECT fields.
+type Options struct {
+	User     string
+	Password string
+	Token    string
+	TLS      *tls.Config
+	Timeout  time.Duration
+	// JetStream makes every publish request a stream acknowledgement, and
+	// Flush waits until all of them have arrived.
+	JetStream bool
+}
+
+// Conn is a minimal publish-only NATS client speaking the text protocol.
+type Conn struct {
+	opts    Options
+	conn    net.Conn
+	w       *bufio.Writer
+	mu      sync.Mutex
+	inbox   string
+	pending int
+	cond    *sync.Cond
+	pongs   []chan struct{}
+	err     error
+	closed  bool
+}
+
+type serverInfo struct {
+	TLSRequired bool `json:"tls_required"`
+	MaxPayload  int  `json:"max_payload"`
+}
+
+func Connect(addr string, opts Options) (*Conn, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	raw, err := net.DialTimeout("tcp", addr, opts.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("nats: %w", err)
+	}
+	raw.SetDeadline(time.Now().Add(opts.Timeout))
+	r := bufio.NewReader(raw)
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		raw.Close()
+		return nil, fmt.Errorf("nats: reading INFO: %w", err)
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		raw.Close()
+		return nil, fmt.Errorf("nats: unexpected greeting %q", strings.TrimSpace(line))
+	}
+	var info serverInfo
+	if err := json.Unmarshal([]byte(strings.TrimSpace(line[5:])), &info); err != nil {
+		raw.Close()
+		return nil, fmt.Errorf("nats: invalid INFO: %w", err)
+	}
+
+	conn := raw
+	if opts.TLS != nil || info.TLSRequired {
+		cfg := opts.TLS
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		if cfg.ServerName == "" {
+			host, _, _ := net.SplitHostPort(addr)
+			cfg = cfg.Clone()
+			cfg.ServerName = host
+		}
+		tc := tls.Client(raw, cfg)
+		if err := tc.Handshake(); err != nil {
+			raw.Close()
+			return nil, fmt.Errorf("nats: %w", err)
+		}
+		conn = tc
+		r = bufio.NewReader(tc)
+	}
+
+	connect, _ := json.Marshal(map[string]any{
+		"verbose":    false,
+		"pedantic":   false,
+		"name":       "file-counter",
+		"lang":       "go",
+		"version":    "1",
+		"protocol":   1,
+		"user":       opts.User,
+		"pass":       opts.Password,
+		"auth_token": opts.Token,
+	})
+
+	c := &Conn{opts: opts, conn: conn, w: bufio.NewWriter(conn)}
+	c.cond = sync.NewCond(&c.mu)
+	fmt.Fprintf(c.w, "CONNECT %s\r\nPING\r\n", connect)
+	if err := c.w.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("nats: %w", err)
+	}
+
+	// The server answers PING with PONG, or with -ERR if CONNECT was rejected.
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("nats: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "PONG" {
+			break
+		}
+		if strings.HasPrefix(line, "-ERR") {
+			conn.Close()
+			return nil, fmt.Errorf("nats: %s", line)
+		}
+	}
+	conn.SetDeadline(time.Time{})
+
+	if opts.JetStream {
+		id := make([]byte, 8)
+		rand.Read(id)
+		c.inbox = "_INBOX." + hex.EncodeToString(id)
+		fmt.Fprintf(c.w, "SUB %s.* 1\r\n", c.inbox)
+	}
+	go c.readLoop(r)
+	return c, nil
+}
+
+// Publish queues data on subject. Writes are buffered; call Flush to make
+// sure they reached the server.
+func (c *Conn) Publish(subject string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+
+	if c.opts.JetStream {
+		c.pending++
+		fmt.Fprintf(c.w, "PUB %s %s.%d %d\r\n", subject, c.inbox, c.pending, len(data))
+	} else {
+		fmt.Fprintf(c.w, "PUB %s %d\r\n", subject, len(data))
+	}
+	c.w.Write(data)
+	if _, err := c.w.WriteString("\r\n"); err != nil {
+		c.err = fmt.Errorf("nats: %w", err)
+	}
+	return c.err
+}
+
+// Flush sends buffered messages and waits for the server to confirm them,
+// including every outstanding JetStream acknowledgement.
+func (c *Conn) Flush() error {
+	pong := make(chan struct{})
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.pongs = append(c.pongs, pong)
+	c.w.WriteString("PING\r\n")
+	if err := c.w.Flush(); err != nil {
+		c.err = fmt.Errorf("nats: %w", err)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-pong:
+	case <-time.After(c.opts.Timeout):
+		return errors.New("nats: flush timed out")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	deadline := time.AfterFunc(c.opts.Timeout, func() {
+		c.mu.Lock()
+		if c.err == nil && c.pending > 0 {
+			c.err = fmt.Errorf("nats: %d JetStream acknowledgements not received", c.pending)
+		}
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	})
+	defer deadline.Stop()
+	for c.pending > 0 && c.err == nil {
+		c.cond.Wait()
+	}
+	return c.err
+}
+
+func (c *Conn) Close() error {
+	err := c.Flush()
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.conn.Close()
+	return err
+}
+
+func (c *Conn) readLoop(r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "PING":
+			c.mu.Lock()
+			c.w.WriteString("PONG\r\n")
+			c.w.Flush()
+			c.mu.Unlock()
+		case line == "PONG":
+			c.mu.Lock()
+			if len(c.pongs) > 0 {
+				close(c.pongs[0])
+				c.pongs = c.pongs[1:]
+			}
+			c.mu.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			c.fail(errors.New(line))
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply] <#bytes>
+			fields := strings.Fields(line)
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				c.fail(fmt.Errorf("invalid MSG line %q", line))
+				return
+			}
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				c.fail(err)
+				return
+			}
+			c.ack(payload[:size])
+		}
+	}
+}
+
+// ack records one JetStream publish acknowledgement.
+func (c *Conn) ack(payload []byte) {
+	var resp struct {
+		Error *struct {
+			Description string `json:"description"`
+		} `json:"error"`
+	}
+	json.Unmarshal(payload, &resp)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending--
+	if resp.Error != nil && c.err == nil {
+		c.err = fmt.Errorf("nats: jetstream: %s", resp.Error.Description)
+	}
+	c.cond.Broadcast()
+}
+
+func (c *Conn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	if c.err == nil {
+		c.err = fmt.Errorf("nats: %w", err)
+	}
+	for _, pong := range c.pongs {
+		close(pong)
+	}
+	c.pongs = nil
+	c.cond.Broadcast()
+}
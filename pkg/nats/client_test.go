@@ -0,0 +1,130 @@
+package nats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeServer records published messages and, for publishes with a reply
+// subject, answers with a JetStream ack (or ackErr when set).
+type fakeServer struct {
+	addr   string
+	ackErr string
+	mu     sync.Mutex
+	msgs   map[string][]string
+}
+
+func newFakeServer(t *testing.T, ackErr string) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	srv := &fakeServer{addr: l.Addr().String(), ackErr: ackErr, msgs: map[string][]string{}}
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(c)
+		}
+	}()
+	return srv
+}
+
+func (srv *fakeServer) serve(c net.Conn) {
+	defer c.Close()
+	fmt.Fprintf(c, "INFO {\"server_id\":\"test\",\"max_payload\":1048576}\r\n")
+	r := bufio.NewReader(c)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "PING":
+			fmt.Fprintf(c, "PONG\r\n")
+		case "PUB":
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			srv.mu.Lock()
+			srv.msgs[fields[1]] = append(srv.msgs[fields[1]], string(payload[:size]))
+			srv.mu.Unlock()
+
+			if len(fields) == 4 {
+				ack := `{"stream":"FILES","seq":1}`
+				if srv.ackErr != "" {
+					ack = `{"error":{"code":503,"description":"` + srv.ackErr + `"}}`
+				}
+				fmt.Fprintf(c, "MSG %s 1 %d\r\n%s\r\n", fields[2], len(ack), ack)
+			}
+		}
+	}
+}
+
+func (srv *fakeServer) count(subject string) int {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return len(srv.msgs[subject])
+}
+
+func TestPublish(t *testing.T) {
+	srv := newFakeServer(t, "")
+	c, err := Connect(srv.addr, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := c.Publish("scan.files", []byte("payload")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.count("scan.files"); n != 5 {
+		t.Errorf("Server received %d messages, expected 5", n)
+	}
+}
+
+func TestJetStreamAcks(t *testing.T) {
+	srv := newFakeServer(t, "")
+	c, err := Connect(srv.addr, Options{JetStream: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		c.Publish("scan.files", []byte("payload"))
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.count("scan.files"); n != 3 {
+		t.Errorf("Server received %d messages, expected 3", n)
+	}
+
+	srv = newFakeServer(t, "no responders available for request")
+	c, err = Connect(srv.addr, Options{JetStream: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Publish("scan.files", []byte("payload"))
+	if err := c.Close(); err == nil || !strings.Contains(err.Error(), "no responders") {
+		t.Errorf("Expected JetStream ack error, got %v", err)
+	}
+}
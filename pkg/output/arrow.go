@@ -0,0 +1,40 @@
+package output
+
+import (
+	"file-counter/pkg/arrow"
+	"file-counter/pkg/scanner"
+)
+
+var arrowColumns = []arrow.Column{
+	{Name: "path", Type: arrow.String},
+	{Name: "size", Type: arrow.Int64},
+	{Name: "mtime", Type: arrow.Timestamp},
+	{Name: "type", Type: arrow.String},
+	{Name: "owner", Type: arrow.String},
+	{Name: "hash", Type: arrow.String},
+}
+
+type arrowOutput struct {
+	w  *fileWriter
+	aw *arrow.Writer
+}
+
+func newArrow(w *fileWriter) (*arrowOutput, error) {
+	aw, err := arrow.NewWriter(w, arrowColumns)
+	if err != nil {
+		return nil, err
+	}
+	return &arrowOutput{w: w, aw: aw}, nil
+}
+
+func (o *arrowOutput) Write(rec *scanner.FileRecord) error {
+	return o.aw.WriteRow(rec.Path, rec.Size, rec.ModTime, FileType(rec), OwnerName(rec), rec.Hash)
+}
+
+func (o *arrowOutput) Close() error {
+	if err := o.aw.Close(); err != nil {
+		o.w.Close()
+		return err
+	}
+	return o.w.Close()
+}
@@ -0,0 +1,149 @@
+package output
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"file-counter/pkg/scanner"
+)
+
+// casOutput stores every distinct regular file once in a content-addressed
+// directory, as objects/<first two hex digits>/<rest of the SHA-256>, and
+// writes a manifest per scan, in sha256sum format, to manifests/<scan ID>.txt.
+// Objects already in the store from earlier scans are not stored again, so
+// repeated exports of the same tree only add what changed. Files that can
+// no longer be read are left out and reported by Close.
+type casOutput struct {
+	dir      string
+	link     bool
+	manifest *fileWriter
+	root     string
+	seen     map[string]bool
+
+	unreadable int64
+	firstErr   error
+}
+
+// newCAS opens the store in dir, creating it if needed. "?link=true" hard
+// links files into the store instead of copying them, where they are on
+// the same filesystem; edits to the originals then change the objects too.
+func newCAS(target, root string) (*casOutput, error) {
+	dir, rawQuery, _ := strings.Cut(target, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "objects"), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "manifests"), 0755); err != nil {
+		return nil, err
+	}
+	id, err := newScanID()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "manifests", id+".txt"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &casOutput{
+		dir:      dir,
+		link:     query.Get("link") == "true",
+		manifest: &fileWriter{file: f, Writer: bufio.NewWriterSize(f, 256*1024)},
+		root:     root,
+		seen:     map[string]bool{},
+	}, nil
+}
+
+func (o *casOutput) Write(rec *scanner.FileRecord) error {
+	if !rec.Mode.IsRegular() || rec.Hash == "" {
+		return nil
+	}
+	hash := rec.Hash
+	if !o.seen[hash] {
+		if _, err := os.Stat(o.object(hash)); err != nil {
+			stored, err := o.store(rec.Path, hash)
+			if err != nil {
+				o.skip(rec.Path, err)
+				return nil
+			}
+			hash = stored
+		}
+		o.seen[hash] = true
+	}
+	_, err := fmt.Fprintf(o.manifest, "%s  %s\n", hash, relName(o.root, rec.Path))
+	return err
+}
+
+func (o *casOutput) object(hash string) string {
+	return filepath.Join(o.dir, "objects", hash[:2], hash[2:])
+}
+
+// store adds the file at path to the store and returns its hash. Copies are
+// hashed again as they are written, so a file that changed since the scan
+// hashed it is stored under the hash of what was copied.
+func (o *casOutput) store(path, hash string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(o.object(hash)), 0755); err != nil {
+		return "", err
+	}
+	if o.link {
+		err := os.Link(path, o.object(hash))
+		if err == nil || errors.Is(err, os.ErrExist) {
+			return hash, nil
+		}
+		// Most likely another filesystem: copy instead.
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	tmp, err := os.CreateTemp(filepath.Join(o.dir, "objects"), ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), src)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0444)
+	}
+	if err == nil {
+		hash = hex.EncodeToString(h.Sum(nil))
+		if err = os.MkdirAll(filepath.Dir(o.object(hash)), 0755); err == nil {
+			err = os.Rename(tmp.Name(), o.object(hash))
+		}
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return hash, nil
+}
+
+func (o *casOutput) skip(path string, err error) {
+	o.unreadable++
+	if o.firstErr == nil {
+		o.firstErr = fmt.Errorf("%s: %w", path, err)
+	}
+}
+
+func (o *casOutput) Close() error {
+	err := o.manifest.Close()
+	if err == nil && o.unreadable > 0 {
+		err = fmt.Errorf("%d files could not be stored and are missing from the manifest (first: %v)", o.unreadable, o.firstErr)
+	}
+	return err
+}
@@ -0,0 +1,220 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"file-counter/pkg/scanner"
+)
+
+const clickhouseBatch = 50000
+
+const clickhouseFilesTable = `CREATE TABLE IF NOT EXISTS %s (
+	scan_id String,
+	host LowCardinality(String),
+	path String,
+	type LowCardinality(String),
+	size UInt64,
+	mtime DateTime64(3, 'UTC'),
+	mode UInt32,
+	owner LowCardinality(String),
+	hash String
+) ENGINE = MergeTree ORDER BY (scan_id, path)`
+
+const clickhouseScansTable = `CREATE TABLE IF NOT EXISTS %s_scans (
+	scan_id String,
+	host LowCardinality(String),
+	root String,
+	started_at DateTime64(3, 'UTC'),
+	finished_at DateTime64(3, 'UTC'),
+	total_files UInt64,
+	total_dirs UInt64,
+	total_bytes UInt64,
+	total_errors UInt64,
+	total_skipped UInt64,
+	duration_seconds Float64
+) ENGINE = MergeTree ORDER BY (host, started_at)`
+
+type clickhouseRow struct {
+	ScanID string `json:"scan_id"`
+	Host   string `json:"host"`
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+	Size   int64  `json:"size"`
+	MTime  string `json:"mtime"`
+	Mode   uint32 `json:"mode"`
+	Owner  string `json:"owner"`
+	Hash   string `json:"hash"`
+}
+
+// clickhouseOutput inserts records in JSONEachRow batches over ClickHouse's
+// HTTP interface.
+type clickhouseOutput struct {
+	endpoint string
+	user     string
+	password string
+	table    string
+	scanID   string
+	host     string
+	root     string
+	started  time.Time
+	batch    bytes.Buffer
+	enc      *json.Encoder
+	rows     int
+}
+
+// newClickHouse parses targets of the form
+// [user[:password]@]host[:port]/database[?table=files&secure=true].
+func newClickHouse(target, root, host string) (*clickhouseOutput, error) {
+	remote, err := parseRemote(target, "8123")
+	if err != nil {
+		return nil, err
+	}
+	database := remote.path
+	if database == "" {
+		database = "default"
+	}
+	table := remote.query.Get("table")
+	if table == "" {
+		table = "files"
+	}
+	// The name goes into the SQL as it is, with _scans appended for the
+	// summary table, so only plain identifiers are accepted.
+	if !clickhouseIdent(table) {
+		return nil, fmt.Errorf("clickhouse: invalid table name %q (use letters, digits and underscores)", table)
+	}
+
+	id, err := newScanID()
+	if err != nil {
+		return nil, err
+	}
+
+	o := &clickhouseOutput{
+		endpoint: remote.baseURL + "/?database=" + url.QueryEscape(database),
+		user:     remote.user,
+		password: remote.password,
+		table:    table,
+		scanID:   id,
+		host:     host,
+		root:     root,
+		started:  time.Now(),
+	}
+	o.enc = json.NewEncoder(&o.batch)
+	o.enc.SetEscapeHTML(false)
+
+	for _, ddl := range []string{clickhouseFilesTable, clickhouseScansTable} {
+		if err := o.exec(fmt.Sprintf(ddl, table), nil); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+func (o *clickhouseOutput) Write(rec *scanner.FileRecord) error {
+	if err := o.enc.Encode(clickhouseRow{
+		ScanID: o.scanID,
+		Host:   o.host,
+		Path:   rec.Path,
+		Type:   FileType(rec),
+		Size:   rec.Size,
+		MTime:  clickhouseTime(rec.ModTime),
+		Mode:   uint32(rec.Mode.Perm()),
+		Owner:  OwnerName(rec),
+		Hash:   rec.Hash,
+	}); err != nil {
+		return err
+	}
+
+	o.rows++
+	if o.rows >= clickhouseBatch {
+		return o.flush()
+	}
+	return nil
+}
+
+func (o *clickhouseOutput) flush() error {
+	if o.rows == 0 {
+		return nil
+	}
+	query := fmt.Sprintf("INSERT INTO %s (scan_id, host, path, type, size, mtime, mode, owner, hash) "+
+		"FORMAT JSONEachRow", o.table)
+	if err := o.exec(query, o.batch.Bytes()); err != nil {
+		return err
+	}
+	o.batch.Reset()
+	o.rows = 0
+	return nil
+}
+
+func (o *clickhouseOutput) WriteSummary(result *scanner.ScanResult) error {
+	if err := o.flush(); err != nil {
+		return err
+	}
+
+	row, err := json.Marshal(map[string]any{
+		"scan_id":          o.scanID,
+		"host":             o.host,
+		"root":             o.root,
+		"started_at":       clickhouseTime(o.started),
+		"finished_at":      clickhouseTime(time.Now()),
+		"total_files":      result.TotalFiles,
+		"total_dirs":       result.TotalDirs,
+		"total_bytes":      result.TotalBytes,
+		"total_errors":     result.TotalErrors,
+		"total_skipped":    result.TotalSkipped,
+		"duration_seconds": result.Duration.Seconds(),
+	})
+	if err != nil {
+		return err
+	}
+	return o.exec(fmt.Sprintf("INSERT INTO %s_scans FORMAT JSONEachRow", o.table), row)
+}
+
+func (o *clickhouseOutput) Close() error {
+	return o.flush()
+}
+
+// clickhouseIdent reports whether s is an identifier ClickHouse accepts
+// without quoting.
+func clickhouseIdent(s string) bool {
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		return false
+	}
+	for _, c := range s {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func clickhouseTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05.000")
+}
+
+// exec runs query, sending data (if any) as the INSERT payload.
+func (o *clickhouseOutput) exec(query string, data []byte) error {
+	endpoint := o.endpoint + "&query=" + url.QueryEscape(query)
+	var body io.Reader = strings.NewReader("")
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, body)
+	if err != nil {
+		return err
+	}
+	if o.user != "" {
+		req.Header.Set("X-ClickHouse-User", o.user)
+		req.Header.Set("X-ClickHouse-Key", o.password)
+	}
+
+	_, err = doRequest("clickhouse", req)
+	return err
+}
@@ -0,0 +1,43 @@
+package output
+
+import (
+	"encoding/csv"
+
+	"file-counter/pkg/scanner"
+)
+
+// csvOutput writes one row per record under a header naming its columns,
+// which are Spec.Fields or, by default, all of Fields.
+type csvOutput struct {
+	w      *fileWriter
+	cw     *csv.Writer
+	fields []string
+	row    []string
+}
+
+func newCSV(w *fileWriter, fields []string) (*csvOutput, error) {
+	if fields == nil {
+		fields = Fields
+	}
+	o := &csvOutput{w: w, cw: csv.NewWriter(w), fields: fields, row: make([]string, len(fields))}
+	if err := o.cw.Write(fields); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *csvOutput) Write(rec *scanner.FileRecord) error {
+	for i, f := range o.fields {
+		o.row[i] = fieldString(rec, f)
+	}
+	return o.cw.Write(o.row)
+}
+
+func (o *csvOutput) Close() error {
+	o.cw.Flush()
+	if err := o.cw.Error(); err != nil {
+		o.w.Close()
+		return err
+	}
+	return o.w.Close()
+}
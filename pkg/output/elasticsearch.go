@@ -0,0 +1,248 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"file-counter/pkg/scanner"
+)
+
+const elasticBatch = 5000
+
+// elasticMapping indexes paths both as exact keywords and through a
+// path_hierarchy tokenizer, so "/var/log" matches every file below it.
+const elasticMapping = `{
+  "settings": {
+    "analysis": {
+      "analyzer": {
+        "path_tree": {"tokenizer": "path_tree"},
+        "path_words": {"tokenizer": "path_words", "filter": ["lowercase"]}
+      },
+      "tokenizer": {
+        "path_tree": {"type": "path_hierarchy", "delimiter": "/"},
+        "path_words": {"type": "char_group", "tokenize_on_chars": ["/", ".", "-", "_", "whitespace"]}
+      }
+    }
+  },
+  "mappings": {
+    "properties": {
+      "scan_id": {"type": "keyword"},
+      "host": {"type": "keyword"},
+      "path": {
+        "type": "keyword",
+        "fields": {
+          "tree": {"type": "text", "analyzer": "path_tree", "search_analyzer": "keyword"},
+          "words": {"type": "text", "analyzer": "path_words"}
+        }
+      },
+      "dir": {"type": "keyword"},
+      "name": {"type": "keyword"},
+      "ext": {"type": "keyword"},
+      "type": {"type": "keyword"},
+      "size": {"type": "long"},
+      "mtime": {"type": "date", "format": "epoch_millis"},
+      "mode": {"type": "integer"},
+      "owner": {"type": "keyword"},
+      "hash": {"type": "keyword"},
+      "scanned_at": {"type": "date", "format": "epoch_millis"}
+    }
+  }
+}`
+
+type elasticDoc struct {
+	ScanID    string `json:"scan_id"`
+	Host      string `json:"host"`
+	Path      string `json:"path"`
+	Dir       string `json:"dir"`
+	Name      string `json:"name"`
+	Ext       string `json:"ext,omitempty"`
+	Type      string `json:"type"`
+	Size      int64  `json:"size"`
+	MTime     int64  `json:"mtime"`
+	Mode      uint32 `json:"mode"`
+	Owner     string `json:"owner,omitempty"`
+	Hash      string `json:"hash,omitempty"`
+	ScannedAt int64  `json:"scanned_at"`
+}
+
+// elasticOutput bulk-indexes records into Elasticsearch or OpenSearch.
+type elasticOutput struct {
+	remote  *remoteTarget
+	index   string
+	scanID  string
+	host    string
+	root    string
+	started time.Time
+	batch   bytes.Buffer
+	enc     *json.Encoder
+	docs    int
+}
+
+// newElastic parses targets of the form
+// [user[:password]@]host[:port]/index[?secure=true].
+func newElastic(target, root, host string) (*elasticOutput, error) {
+	remote, err := parseRemote(target, "9200")
+	if err != nil {
+		return nil, err
+	}
+	index := remote.path
+	if index == "" {
+		index = "file-counter"
+	}
+
+	id, err := newScanID()
+	if err != nil {
+		return nil, err
+	}
+
+	o := &elasticOutput{
+		remote:  remote,
+		index:   index,
+		scanID:  id,
+		host:    host,
+		root:    root,
+		started: time.Now(),
+	}
+	o.enc = json.NewEncoder(&o.batch)
+	o.enc.SetEscapeHTML(false)
+
+	if err := o.ensureIndex(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *elasticOutput) ensureIndex() error {
+	body, err := o.request(http.MethodPut, "/"+o.index, "application/json", []byte(elasticMapping))
+	if err != nil && !bytes.Contains(body, []byte("resource_already_exists_exception")) {
+		return err
+	}
+	return nil
+}
+
+func (o *elasticOutput) Write(rec *scanner.FileRecord) error {
+	p := filepath.ToSlash(rec.Path)
+	dir, name := path.Split(p)
+
+	o.batch.WriteString(`{"index":{}}` + "\n")
+	if err := o.enc.Encode(elasticDoc{
+		ScanID:    o.scanID,
+		Host:      o.host,
+		Path:      p,
+		Dir:       strings.TrimSuffix(dir, "/"),
+		Name:      name,
+		Ext:       extension(name),
+		Type:      FileType(rec),
+		Size:      rec.Size,
+		MTime:     rec.ModTime.UnixMilli(),
+		Mode:      uint32(rec.Mode.Perm()),
+		Owner:     OwnerName(rec),
+		Hash:      rec.Hash,
+		ScannedAt: o.started.UnixMilli(),
+	}); err != nil {
+		return err
+	}
+
+	o.docs++
+	if o.docs >= elasticBatch {
+		return o.flush()
+	}
+	return nil
+}
+
+func (o *elasticOutput) flush() error {
+	if o.docs == 0 {
+		return nil
+	}
+
+	body, err := o.request(http.MethodPost, "/"+o.index+"/_bulk", "application/x-ndjson", o.batch.Bytes())
+	if err != nil {
+		return err
+	}
+	if err := bulkError(body); err != nil {
+		return err
+	}
+
+	o.batch.Reset()
+	o.docs = 0
+	return nil
+}
+
+// bulkError returns the first item failure of a _bulk response, which is
+// reported with a 200 status and "errors": true.
+func bulkError(body []byte) error {
+	var resp struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("elasticsearch: invalid bulk response: %w", err)
+	}
+	if !resp.Errors {
+		return nil
+	}
+
+	failed := 0
+	var first string
+	for _, item := range resp.Items {
+		for _, result := range item {
+			if result.Error != nil {
+				failed++
+				if first == "" {
+					first = string(result.Error)
+				}
+			}
+		}
+	}
+	return fmt.Errorf("elasticsearch: %d documents rejected, first error: %s", failed, first)
+}
+
+func (o *elasticOutput) WriteSummary(result *scanner.ScanResult) error {
+	if err := o.flush(); err != nil {
+		return err
+	}
+
+	doc, err := json.Marshal(map[string]any{
+		"scan_id":          o.scanID,
+		"host":             o.host,
+		"root":             o.root,
+		"started_at":       o.started.UnixMilli(),
+		"finished_at":      time.Now().UnixMilli(),
+		"total_files":      result.TotalFiles,
+		"total_dirs":       result.TotalDirs,
+		"total_bytes":      result.TotalBytes,
+		"total_errors":     result.TotalErrors,
+		"total_skipped":    result.TotalSkipped,
+		"duration_seconds": result.Duration.Seconds(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = o.request(http.MethodPut, "/"+o.index+"-scans/_doc/"+o.scanID, "application/json", doc)
+	return err
+}
+
+func (o *elasticOutput) Close() error {
+	return o.flush()
+}
+
+func (o *elasticOutput) request(method, path, contentType string, data []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, o.remote.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if o.remote.user != "" {
+		req.SetBasicAuth(o.remote.user, o.remote.password)
+	}
+	return doRequest("elasticsearch", req)
+}
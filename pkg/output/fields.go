@@ -0,0 +1,72 @@
+package output
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"file-counter/pkg/scanner"
+)
+
+// Fields are the file attributes the ndjson and csv outputs can be limited
+// to with Spec.Fields, in their default order.
+var Fields = []string{"path", "type", "size", "mode", "mtime", "owner", "hash"}
+
+// ParseFields splits a comma-separated field list such as "path,size" and
+// checks every name is one of Fields.
+func ParseFields(list string) ([]string, error) {
+	var fields []string
+	seen := map[string]bool{}
+	for _, f := range strings.Split(list, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "" || seen[f] {
+			continue
+		}
+		known := false
+		for _, name := range Fields {
+			known = known || name == f
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown field %q (choose from %s)", f, strings.Join(Fields, ", "))
+		}
+		seen[f] = true
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields in %q", list)
+	}
+	return fields, nil
+}
+
+// fieldValue returns one field of rec, as a string or an int64.
+func fieldValue(rec *scanner.FileRecord, field string) any {
+	switch field {
+	case "path":
+		return rec.Path
+	case "type":
+		return FileType(rec)
+	case "size":
+		return rec.Size
+	case "mode":
+		return rec.Mode.Perm().String()
+	case "mtime":
+		return rec.ModTime.UTC().Format(time.RFC3339)
+	case "owner":
+		return OwnerName(rec)
+	case "hash":
+		return rec.Hash
+	}
+	return ""
+}
+
+// fieldString formats fieldValue for text outputs.
+func fieldString(rec *scanner.FileRecord, field string) string {
+	switch v := fieldValue(rec, field).(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case string:
+		return v
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"file-counter/pkg/scanner"
+)
+
+// graphiteOutput sends the scan totals to Carbon using the plaintext
+// protocol ("<path> <value> <timestamp>\n") once the scan finishes.
+type graphiteOutput struct {
+	addr   string
+	prefix string
+}
+
+func newGraphite(target, host string) (*graphiteOutput, error) {
+	addr, prefix, err := metricTarget(target, "2003", host)
+	if err != nil {
+		return nil, err
+	}
+	return &graphiteOutput{addr: addr, prefix: prefix}, nil
+}
+
+func (o *graphiteOutput) Write(rec *scanner.FileRecord) error {
+	return nil
+}
+
+func (o *graphiteOutput) WriteSummary(result *scanner.ScanResult) error {
+	conn, err := net.DialTimeout("tcp", o.addr, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("graphite: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	w := bufio.NewWriter(conn)
+	now := time.Now().Unix()
+	for _, m := range scanMetrics(result) {
+		fmt.Fprintf(w, "%s.%s %s %d\n", o.prefix, m.Name, strconv.FormatFloat(m.Value, 'f', -1, 64), now)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("graphite: %w", err)
+	}
+	return nil
+}
+
+func (o *graphiteOutput) Close() error {
+	return nil
+}
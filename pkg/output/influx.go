@@ -0,0 +1,163 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"file-counter/pkg/scanner"
+)
+
+// defaultInfluxDepth bounds the number of directory series a scan creates.
+const defaultInfluxDepth = 2
+
+type dirTotal struct {
+	files int64
+	bytes int64
+}
+
+// influxOutput aggregates recursive file counts and sizes for directories
+// up to depth levels below the root and, once the scan finishes, writes
+// them with the scan totals as InfluxDB line protocol, either to a file or
+// to an HTTP write endpoint.
+type influxOutput struct {
+	target  string
+	root    string
+	absRoot string
+	host    string
+	depth   int
+	dirs    map[string]*dirTotal
+	lines   bytes.Buffer
+}
+
+// newInflux accepts a file path or an http(s) write URL. "?depth=N" on either
+// sets how many directory levels get their own series.
+func newInflux(target, root string) (*influxOutput, error) {
+	var query url.Values
+	if isHTTP(target) {
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, err
+		}
+		query = u.Query()
+		rest := u.Query()
+		rest.Del("depth")
+		u.RawQuery = rest.Encode()
+		target = u.String()
+	} else {
+		base, rawQuery, _ := strings.Cut(target, "?")
+		q, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return nil, err
+		}
+		query, target = q, base
+	}
+	depth := defaultInfluxDepth
+	if d := query.Get("depth"); d != "" {
+		n, err := strconv.Atoi(d)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid influx depth %q", d)
+		}
+		depth = n
+	}
+
+	host, _ := os.Hostname()
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	return &influxOutput{
+		target:  target,
+		root:    filepath.Clean(root),
+		absRoot: absRoot,
+		host:    host,
+		depth:   depth,
+		dirs:    make(map[string]*dirTotal),
+	}, nil
+}
+
+func isHTTP(target string) bool {
+	return strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+}
+
+func (o *influxOutput) Write(rec *scanner.FileRecord) error {
+	if rec.IsDir {
+		return nil
+	}
+	rel, err := filepath.Rel(o.root, filepath.Dir(rec.Path))
+	if err != nil {
+		return err
+	}
+
+	parts := []string{}
+	if rel != "." {
+		parts = strings.Split(filepath.ToSlash(rel), "/")
+	}
+	for level := 0; level <= o.depth && level <= len(parts); level++ {
+		dir := strings.Join(parts[:level], "/")
+		total := o.dirs[dir]
+		if total == nil {
+			total = &dirTotal{}
+			o.dirs[dir] = total
+		}
+		total.files++
+		total.bytes += rec.Size
+	}
+	return nil
+}
+
+func (o *influxOutput) WriteSummary(result *scanner.ScanResult) error {
+	fmt.Fprintf(&o.lines, "file_counter_scan,host=%s,root=%s files=%di,dirs=%di,bytes=%di,errors=%di,skipped=%di,duration_seconds=%s %d\n",
+		influxTag(o.host), influxTag(o.absRoot),
+		result.TotalFiles, result.TotalDirs, result.TotalBytes, result.TotalErrors, result.TotalSkipped,
+		strconv.FormatFloat(result.Duration.Seconds(), 'f', -1, 64), time.Now().UnixNano())
+	return nil
+}
+
+func (o *influxOutput) Close() error {
+	now := time.Now().UnixNano()
+	dirs := make([]string, 0, len(o.dirs))
+	for dir := range o.dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		total := o.dirs[dir]
+		depth := 0
+		if dir != "" {
+			depth = strings.Count(dir, "/") + 1
+		}
+		fmt.Fprintf(&o.lines, "file_counter_dir,host=%s,root=%s,path=%s,depth=%d files=%di,bytes=%di %d\n",
+			influxTag(o.host), influxTag(o.absRoot), influxTag(filepath.Join(o.absRoot, dir)),
+			depth, total.files, total.bytes, now)
+	}
+
+	if !isHTTP(o.target) {
+		return os.WriteFile(o.target, o.lines.Bytes(), 0644)
+	}
+	req, err := http.NewRequest(http.MethodPost, o.target, &o.lines)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if token := os.Getenv("INFLUX_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+	if req.URL.User != nil {
+		pass, _ := req.URL.User.Password()
+		req.SetBasicAuth(req.URL.User.Username(), pass)
+		req.URL.User = nil
+	}
+	_, err = doRequest("influxdb", req)
+	return err
+}
+
+// influxTag escapes a tag value for line protocol.
+var influxTag = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`).Replace
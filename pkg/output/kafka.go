@@ -0,0 +1,179 @@
+package output
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"file-counter/pkg/kafka"
+	"file-counter/pkg/scanner"
+)
+
+type eventRecord struct {
+	ScanID  string `json:"scan_id"`
+	Host    string `json:"host"`
+	Path    string `json:"path"`
+	Type    string `json:"type"`
+	Size    int64  `json:"size"`
+	Mode    string `json:"mode"`
+	ModTime string `json:"mtime"`
+	Owner   string `json:"owner,omitempty"`
+	Hash    string `json:"hash,omitempty"`
+}
+
+type scanSummary struct {
+	ScanID          string  `json:"scan_id"`
+	Host            string  `json:"host"`
+	Root            string  `json:"root"`
+	StartedAt       string  `json:"started_at"`
+	FinishedAt      string  `json:"finished_at"`
+	TotalFiles      int64   `json:"total_files"`
+	TotalDirs       int64   `json:"total_dirs"`
+	TotalBytes      int64   `json:"total_bytes"`
+	TotalErrors     int64   `json:"total_errors"`
+	TotalSkipped    int64   `json:"total_skipped"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Completed       bool    `json:"completed"`
+
+	CloudOnlyFiles int64 `json:"cloud_only_files,omitempty"`
+	CloudOnlyBytes int64 `json:"cloud_only_bytes,omitempty"`
+
+	// Snapshot totals are only counted when snapshots are scanned
+	// separately from the tree.
+	Snapshots     int   `json:"snapshots,omitempty"`
+	SnapshotFiles int64 `json:"snapshot_files,omitempty"`
+	SnapshotBytes int64 `json:"snapshot_bytes,omitempty"`
+
+	PhysicalBytes int64 `json:"physical_bytes,omitempty"`
+	SharedBytes   int64 `json:"shared_bytes,omitempty"`
+
+	Environment string            `json:"environment,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+func newEventRecord(rec *scanner.FileRecord, scanID, host string) eventRecord {
+	return eventRecord{
+		ScanID:  scanID,
+		Host:    host,
+		Path:    rec.Path,
+		Type:    FileType(rec),
+		Size:    rec.Size,
+		Mode:    rec.Mode.Perm().String(),
+		ModTime: rec.ModTime.UTC().Format(time.RFC3339),
+		Owner:   OwnerName(rec),
+		Hash:    rec.Hash,
+	}
+}
+
+func newScanSummary(result *scanner.ScanResult, scanID, host, root string, started time.Time) scanSummary {
+	sum := scanSummary{
+		ScanID:          scanID,
+		Host:            host,
+		Root:            root,
+		StartedAt:       started.UTC().Format(time.RFC3339),
+		FinishedAt:      time.Now().UTC().Format(time.RFC3339),
+		TotalFiles:      result.TotalFiles,
+		TotalDirs:       result.TotalDirs,
+		TotalBytes:      result.TotalBytes,
+		TotalErrors:     result.TotalErrors,
+		TotalSkipped:    result.TotalSkipped,
+		DurationSeconds: result.Duration.Seconds(),
+		Completed:       result.Completed,
+		CloudOnlyFiles:  result.CloudOnlyFiles,
+		CloudOnlyBytes:  result.CloudOnlyBytes,
+		Snapshots:       len(result.Snapshots),
+		PhysicalBytes:   result.PhysicalBytes,
+		SharedBytes:     result.SharedBytes,
+	}
+	for _, st := range result.Snapshots {
+		sum.SnapshotFiles += st.Files
+		sum.SnapshotBytes += st.Bytes
+	}
+	return sum
+}
+
+// kafkaOutput publishes one JSON message per record, keyed by path, and a
+// final summary message keyed by scan id.
+type kafkaOutput struct {
+	producer     *kafka.Producer
+	topic        string
+	summaryTopic string
+	scanID       string
+	host         string
+	root         string
+	started      time.Time
+}
+
+// newKafka parses targets of the form
+// broker1:9092[,broker2:9092]/topic[?summary_topic=t&acks=all&tls=true].
+func newKafka(target, root, host string) (*kafkaOutput, error) {
+	brokers, rest, _ := strings.Cut(target, "/")
+	topic, rawQuery, _ := strings.Cut(rest, "?")
+	if brokers == "" || topic == "" {
+		return nil, fmt.Errorf("kafka target must look like host:9092/topic, got %q", target)
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := kafka.Config{Brokers: strings.Split(brokers, ","), Acks: 1}
+	switch query.Get("acks") {
+	case "", "1":
+	case "all", "-1":
+		cfg.Acks = -1
+	case "0":
+		cfg.Acks = 0
+	default:
+		return nil, fmt.Errorf("invalid kafka acks %q", query.Get("acks"))
+	}
+	if q := query.Get("tls"); q == "true" || q == "1" {
+		cfg.TLS = &tls.Config{}
+	}
+
+	producer, err := kafka.NewProducer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	id, err := newScanID()
+	if err != nil {
+		return nil, err
+	}
+
+	summaryTopic := query.Get("summary_topic")
+	if summaryTopic == "" {
+		summaryTopic = topic + "-scans"
+	}
+	return &kafkaOutput{
+		producer:     producer,
+		topic:        topic,
+		summaryTopic: summaryTopic,
+		scanID:       id,
+		host:         host,
+		root:         root,
+		started:      time.Now(),
+	}, nil
+}
+
+func (o *kafkaOutput) Write(rec *scanner.FileRecord) error {
+	value, err := json.Marshal(newEventRecord(rec, o.scanID, o.host))
+	if err != nil {
+		return err
+	}
+	return o.producer.Publish(o.topic, kafka.Message{Key: []byte(rec.Path), Value: value})
+}
+
+func (o *kafkaOutput) WriteSummary(result *scanner.ScanResult) error {
+	value, err := json.Marshal(newScanSummary(result, o.scanID, o.host, o.root, o.started))
+	if err != nil {
+		return err
+	}
+	return o.producer.Publish(o.summaryTopic, kafka.Message{Key: []byte(o.scanID), Value: value})
+}
+
+func (o *kafkaOutput) Close() error {
+	return o.producer.Close()
+}
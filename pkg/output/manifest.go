@@ -0,0 +1,36 @@
+package output
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"file-counter/pkg/scanner"
+)
+
+// manifestOutput streams sha256sum-style lines as files are hashed. Unlike
+// 'file-counter manifest' the lines are in scan order rather than sorted.
+type manifestOutput struct {
+	w    *fileWriter
+	root string
+}
+
+func newManifest(w *fileWriter, root string) *manifestOutput {
+	return &manifestOutput{w: w, root: root}
+}
+
+func (o *manifestOutput) Write(rec *scanner.FileRecord) error {
+	if !rec.Mode.IsRegular() || rec.Hash == "" {
+		return nil
+	}
+
+	rel, err := filepath.Rel(o.root, rec.Path)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(o.w, "%s  %s\n", rec.Hash, filepath.ToSlash(rel))
+	return err
+}
+
+func (o *manifestOutput) Close() error {
+	return o.w.Close()
+}
@@ -0,0 +1,57 @@
+package output
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"file-counter/pkg/scanner"
+)
+
+type metric struct {
+	Name  string
+	Value float64
+}
+
+// scanMetrics flattens the scan totals into the metric names used by the
+// Graphite and statsd outputs.
+func scanMetrics(result *scanner.ScanResult) []metric {
+	return []metric{
+		{"files", float64(result.TotalFiles)},
+		{"dirs", float64(result.TotalDirs)},
+		{"bytes", float64(result.TotalBytes)},
+		{"errors", float64(result.TotalErrors)},
+		{"skipped", float64(result.TotalSkipped)},
+		{"duration_seconds", result.Duration.Seconds()},
+		{"files_per_second", result.FilesPerSecond},
+	}
+}
+
+// metricTarget parses host[:port][/prefix] targets shared by the metric
+// outputs. The prefix defaults to file_counter.<host>.
+func metricTarget(target, defaultPort, host string) (addr, prefix string, err error) {
+	u, err := url.Parse("metrics://" + target)
+	if err != nil {
+		return "", "", err
+	}
+	addr = u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+	prefix = strings.ReplaceAll(strings.Trim(u.Path, "/"), "/", ".")
+	if prefix == "" {
+		prefix = "file_counter." + metricName(host)
+	}
+	return addr, prefix, nil
+}
+
+// metricName makes s safe to use as one dot-separated metric path component.
+func metricName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
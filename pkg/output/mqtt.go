@@ -0,0 +1,210 @@
+package output
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"file-counter/pkg/mqtt"
+	"file-counter/pkg/scanner"
+)
+
+// mqttStatus is the retained JSON document published on <topic>/state.
+type mqttStatus struct {
+	State          string  `json:"state"`
+	Root           string  `json:"root"`
+	Files          int64   `json:"files"`
+	Dirs           int64   `json:"dirs"`
+	Bytes          int64   `json:"bytes"`
+	Errors         int64   `json:"errors"`
+	Skipped        int64   `json:"skipped"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	UpdatedAt      string  `json:"updated_at"`
+}
+
+// mqttOutput publishes scan status rather than per-file records: running
+// totals at most once per interval, then the final totals, all retained so
+// dashboards show the latest numbers as soon as they subscribe.
+type mqttOutput struct {
+	client   *mqtt.Client
+	topic    string
+	qos      byte
+	root     string
+	interval time.Duration
+
+	mu       sync.Mutex
+	lastSent time.Time
+}
+
+// newMQTT parses targets of the form
+// [user:password@]host[:1883]/topic[?qos=1&interval=10s&tls=true&discovery=homeassistant].
+func newMQTT(target, root, host string) (*mqttOutput, error) {
+	u, err := url.Parse("mqtt://" + target)
+	if err != nil {
+		return nil, err
+	}
+	topic := strings.Trim(u.Path, "/")
+	if topic == "" {
+		topic = "filecounter/" + host
+	}
+	if strings.ContainsAny(topic, "+#") {
+		return nil, fmt.Errorf("mqtt topic %q must not contain wildcards", topic)
+	}
+
+	query := u.Query()
+	out := &mqttOutput{topic: topic, root: root, interval: 10 * time.Second}
+	switch q := query.Get("qos"); q {
+	case "", "0":
+	case "1":
+		out.qos = 1
+	default:
+		return nil, fmt.Errorf("invalid mqtt qos %q", q)
+	}
+	if q := query.Get("interval"); q != "" {
+		if out.interval, err = time.ParseDuration(q); err != nil {
+			return nil, fmt.Errorf("invalid mqtt interval: %w", err)
+		}
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		port := "1883"
+		if isTrue(query.Get("tls")) {
+			port = "8883"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	opts := mqtt.Options{
+		ClientID: "file-counter-" + host + "-" + strconv.Itoa(int(time.Now().Unix())),
+		Will:     &mqtt.Message{Topic: topic + "/status", Payload: []byte("offline"), QoS: out.qos, Retain: true},
+	}
+	if isTrue(query.Get("tls")) {
+		opts.TLS = &tls.Config{}
+	}
+	if u.User != nil {
+		opts.User = u.User.Username()
+		opts.Password, _ = u.User.Password()
+	}
+
+	if out.client, err = mqtt.Connect(addr, opts); err != nil {
+		return nil, err
+	}
+	if prefix := query.Get("discovery"); prefix != "" {
+		if err := out.announce(prefix, host); err != nil {
+			out.client.Close()
+			return nil, err
+		}
+	}
+	if err := out.publish("status", []byte("online")); err != nil {
+		out.client.Close()
+		return nil, err
+	}
+	return out, nil
+}
+
+// announce publishes Home Assistant MQTT discovery configs so the totals
+// appear as sensors without any manual configuration.
+func (o *mqttOutput) announce(prefix, host string) error {
+	sensors := []struct {
+		key, name, unit, class string
+	}{
+		{"files", "Files", "", ""},
+		{"dirs", "Directories", "", ""},
+		{"bytes", "Size", "B", "data_size"},
+		{"errors", "Errors", "", ""},
+	}
+	node := strings.NewReplacer(".", "_", "-", "_", "/", "_").Replace(host + "_" + o.root)
+	for _, s := range sensors {
+		config := map[string]any{
+			"name":                  s.name,
+			"unique_id":             "file_counter_" + node + "_" + s.key,
+			"state_topic":           o.topic + "/state",
+			"value_template":        "{{ value_json." + s.key + " }}",
+			"availability_topic":    o.topic + "/status",
+			"state_class":           "measurement",
+			"json_attributes_topic": o.topic + "/state",
+			"device": map[string]any{
+				"identifiers": []string{"file_counter_" + node},
+				"name":        "File Counter " + host + " " + o.root,
+			},
+		}
+		if s.unit != "" {
+			config["unit_of_measurement"] = s.unit
+			config["device_class"] = s.class
+		}
+		payload, err := json.Marshal(config)
+		if err != nil {
+			return err
+		}
+		topic := prefix + "/sensor/file_counter_" + node + "/" + s.key + "/config"
+		if err := o.client.Publish(mqtt.Message{Topic: topic, Payload: payload, QoS: o.qos, Retain: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *mqttOutput) publish(suffix string, payload []byte) error {
+	return o.client.Publish(mqtt.Message{Topic: o.topic + "/" + suffix, Payload: payload, QoS: o.qos, Retain: true})
+}
+
+func (o *mqttOutput) publishStatus(status mqttStatus) error {
+	status.Root = o.root
+	status.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	payload, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return o.publish("state", payload)
+}
+
+// Write ignores per-file records; only totals are published.
+func (o *mqttOutput) Write(rec *scanner.FileRecord) error {
+	return nil
+}
+
+func (o *mqttOutput) WriteProgress(stats scanner.Stats) error {
+	o.mu.Lock()
+	if time.Since(o.lastSent) < o.interval {
+		o.mu.Unlock()
+		return nil
+	}
+	o.lastSent = time.Now()
+	o.mu.Unlock()
+
+	return o.publishStatus(mqttStatus{
+		State:          "scanning",
+		Files:          stats.Files,
+		Dirs:           stats.Dirs,
+		Bytes:          stats.Bytes,
+		Errors:         stats.Errors,
+		Skipped:        stats.Skipped,
+		ElapsedSeconds: stats.Elapsed.Seconds(),
+	})
+}
+
+func (o *mqttOutput) WriteSummary(result *scanner.ScanResult) error {
+	return o.publishStatus(mqttStatus{
+		State:          "finished",
+		Files:          result.TotalFiles,
+		Dirs:           result.TotalDirs,
+		Bytes:          result.TotalBytes,
+		Errors:         result.TotalErrors,
+		Skipped:        result.TotalSkipped,
+		ElapsedSeconds: result.Duration.Seconds(),
+	})
+}
+
+func (o *mqttOutput) Close() error {
+	err := o.publish("status", []byte("offline"))
+	if cerr := o.client.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,128 @@
+package output
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"file-counter/pkg/nats"
+	"file-counter/pkg/scanner"
+)
+
+type progressEvent struct {
+	ScanID         string  `json:"scan_id"`
+	Host           string  `json:"host"`
+	Root           string  `json:"root"`
+	Files          int64   `json:"files"`
+	Dirs           int64   `json:"dirs"`
+	Errors         int64   `json:"errors"`
+	Skipped        int64   `json:"skipped"`
+	Bytes          int64   `json:"bytes"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	CurrentPath    string  `json:"current_path,omitempty"`
+}
+
+// natsOutput publishes per-file events on <prefix>.files, running totals on
+// <prefix>.progress and the final totals on <prefix>.summary.
+type natsOutput struct {
+	conn    *nats.Conn
+	prefix  string
+	scanID  string
+	host    string
+	root    string
+	started time.Time
+}
+
+// newNATS parses targets of the form
+// [user:password@|token@]host[:4222]/subject.prefix[?jetstream=true&tls=true].
+func newNATS(target, root, host string) (*natsOutput, error) {
+	u, err := url.Parse("nats://" + target)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.Trim(u.Path, "/")
+	if prefix == "" {
+		prefix = "filecounter"
+	}
+	if strings.ContainsAny(prefix, " \t*>/") {
+		return nil, fmt.Errorf("invalid nats subject %q", prefix)
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	query := u.Query()
+	opts := nats.Options{JetStream: isTrue(query.Get("jetstream"))}
+	if isTrue(query.Get("tls")) {
+		opts.TLS = &tls.Config{}
+	}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			opts.User, opts.Password = u.User.Username(), pass
+		} else {
+			opts.Token = u.User.Username()
+		}
+	}
+
+	conn, err := nats.Connect(addr, opts)
+	if err != nil {
+		return nil, err
+	}
+	id, err := newScanID()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &natsOutput{
+		conn:    conn,
+		prefix:  prefix,
+		scanID:  id,
+		host:    host,
+		root:    root,
+		started: time.Now(),
+	}, nil
+}
+
+func isTrue(value string) bool {
+	return value == "true" || value == "1"
+}
+
+func (o *natsOutput) publish(suffix string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return o.conn.Publish(o.prefix+"."+suffix, data)
+}
+
+func (o *natsOutput) Write(rec *scanner.FileRecord) error {
+	return o.publish("files", newEventRecord(rec, o.scanID, o.host))
+}
+
+func (o *natsOutput) WriteProgress(stats scanner.Stats) error {
+	return o.publish("progress", progressEvent{
+		ScanID:         o.scanID,
+		Host:           o.host,
+		Root:           o.root,
+		Files:          stats.Files,
+		Dirs:           stats.Dirs,
+		Errors:         stats.Errors,
+		Skipped:        stats.Skipped,
+		Bytes:          stats.Bytes,
+		ElapsedSeconds: stats.Elapsed.Seconds(),
+		CurrentPath:    stats.CurrentPath,
+	})
+}
+
+func (o *natsOutput) WriteSummary(result *scanner.ScanResult) error {
+	return o.publish("summary", newScanSummary(result, o.scanID, o.host, o.root, o.started))
+}
+
+func (o *natsOutput) Close() error {
+	return o.conn.Close()
+}
@@ -0,0 +1,93 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"file-counter/pkg/scanner"
+)
+
+type ndjsonRecord struct {
+	Path    string `json:"path"`
+	Type    string `json:"type"`
+	Size    int64  `json:"size"`
+	Mode    string `json:"mode"`
+	ModTime string `json:"mtime"`
+	Hash    string `json:"hash,omitempty"`
+	// CloudOnly marks placeholders whose data is not stored locally.
+	CloudOnly bool `json:"cloud_only,omitempty"`
+}
+
+// ndjsonOutput writes an ndjsonRecord per line or, when fields are given,
+// an object with only those fields, in that order.
+type ndjsonOutput struct {
+	w      *fileWriter
+	enc    *json.Encoder
+	fields []string
+	buf    bytes.Buffer
+}
+
+func newNDJSON(w *fileWriter, fields []string) *ndjsonOutput {
+	o := &ndjsonOutput{w: w, fields: fields}
+	// With fields, values are encoded one at a time into buf.
+	var dst io.Writer = w
+	if fields != nil {
+		dst = &o.buf
+	}
+	o.enc = json.NewEncoder(dst)
+	o.enc.SetEscapeHTML(false)
+	return o
+}
+
+func (o *ndjsonOutput) Write(rec *scanner.FileRecord) error {
+	if o.fields != nil {
+		return o.writeFields(rec)
+	}
+	return o.enc.Encode(ndjsonRecord{
+		Path:      rec.Path,
+		Type:      FileType(rec),
+		Size:      rec.Size,
+		Mode:      rec.Mode.Perm().String(),
+		ModTime:   rec.ModTime.UTC().Format(time.RFC3339),
+		Hash:      rec.Hash,
+		CloudOnly: rec.CloudOnly,
+	})
+}
+
+func (o *ndjsonOutput) writeFields(rec *scanner.FileRecord) error {
+	o.w.WriteByte('{')
+	for i, f := range o.fields {
+		if i > 0 {
+			o.w.WriteByte(',')
+		}
+		o.buf.Reset()
+		if err := o.enc.Encode(fieldValue(rec, f)); err != nil {
+			return err
+		}
+		o.w.WriteString(`"` + f + `":`)
+		o.w.Write(bytes.TrimSuffix(o.buf.Bytes(), []byte("\n")))
+	}
+	_, err := o.w.WriteString("}\n")
+	return err
+}
+
+func (o *ndjsonOutput) Close() error {
+	return o.w.Close()
+}
+
+// FileType names the kind of entry rec is: "dir", "file", "symlink" or
+// "other".
+func FileType(rec *scanner.FileRecord) string {
+	switch {
+	case rec.IsDir:
+		return "dir"
+	case rec.Mode.IsRegular():
+		return "file"
+	case rec.Mode&os.ModeSymlink != 0:
+		return "symlink"
+	}
+	return "other"
+}
@@ -0,0 +1,254 @@
+package output
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"file-counter/pkg/scanner"
+)
+
+// Output is a scanner.Sink backed by a file that must be closed (and thereby
+// flushed) once the scan has returned.
+type Output interface {
+	scanner.Sink
+	Close() error
+}
+
+// SummaryWriter is implemented by outputs that also record the scan totals.
+// It is called once, after the scan returns and before Close.
+type SummaryWriter interface {
+	WriteSummary(result *scanner.ScanResult) error
+}
+
+// ProgressWriter is implemented by outputs that publish running totals
+// while the scan is in progress. It may be called concurrently with Write.
+type ProgressWriter interface {
+	WriteProgress(stats scanner.Stats) error
+}
+
+// Spec is a parsed --output value of the form "format" or "format://target".
+// A positive ShardSize splits the output into numbered files of that many
+// records each. Fields, when set, limits the ndjson and csv outputs to those
+// of Fields. Host replaces the machine's hostname in what remote outputs
+// send. Environment and Labels are attached to pushed summaries.
+type Spec struct {
+	Format      string
+	Target      string
+	ShardSize   int64
+	Fields      []string
+	Host        string
+	Environment string
+	Labels      map[string]string
+}
+
+var defaultTargets = map[string]string{
+	"ndjson":        "inventory.ndjson",
+	"csv":           "inventory.csv",
+	"manifest":      "manifest.txt",
+	"parquet":       "inventory.parquet",
+	"arrow":         "inventory.arrow",
+	"feather":       "inventory.feather",
+	"sqlite":        "inventory.db",
+	"postgres":      "",
+	"clickhouse":    "",
+	"elasticsearch": "",
+	"kafka":         "",
+	"nats":          "",
+	"mqtt":          "",
+	"graphite":      "localhost:2003",
+	"statsd":        "localhost:8125",
+	"influx":        "metrics.lp",
+	"tar":           "archive.tar",
+	"cas":           "cas",
+	"push":          "",
+}
+
+// Formats lists the output formats ParseSpec accepts, sorted.
+func Formats() []string {
+	var out []string
+	for f := range defaultTargets {
+		out = append(out, f)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func ParseSpec(value string) (Spec, error) {
+	format, target, _ := strings.Cut(value, "://")
+	format = strings.ToLower(format)
+	switch format {
+	case "postgresql":
+		format = "postgres"
+	case "opensearch":
+		format = "elasticsearch"
+	case "influxdb":
+		format = "influx"
+	}
+
+	def, ok := defaultTargets[format]
+	if !ok {
+		return Spec{}, fmt.Errorf("unknown output format %q", format)
+	}
+	if target == "" {
+		target = def
+	}
+	if target == "" {
+		return Spec{}, fmt.Errorf("%s output needs a target, e.g. %s://user@host/db", format, format)
+	}
+	return Spec{Format: format, Target: target}, nil
+}
+
+// remoteFormats write to a service rather than a local file, so targets are
+// URLs and sharding does not apply.
+var remoteFormats = map[string]bool{
+	"postgres":      true,
+	"clickhouse":    true,
+	"elasticsearch": true,
+	"kafka":         true,
+	"nats":          true,
+	"mqtt":          true,
+	"graphite":      true,
+	"statsd":        true,
+	"push":          true,
+}
+
+func (s Spec) IsRemote() bool {
+	return remoteFormats[s.Format]
+}
+
+// NeedsHash reports whether the format records file content hashes.
+func (s Spec) NeedsHash() bool {
+	if s.HasFields() {
+		for _, f := range s.Fields {
+			if f == "hash" {
+				return true
+			}
+		}
+	}
+	return s.Format == "manifest" || s.Format == "cas"
+}
+
+// HasFields reports whether the format can be limited to Spec.Fields.
+func (s Spec) HasFields() bool {
+	return s.Format == "ndjson" || s.Format == "csv"
+}
+
+// Open creates the output described by spec. root is the scan root, used by
+// formats that store relative paths.
+func Open(spec Spec, root string) (Output, error) {
+	if spec.Format == "influx" {
+		// A handful of summary lines, written to a file or an HTTP endpoint.
+		return newInflux(spec.Target, root)
+	}
+	if spec.Format == "tar" {
+		// A single archive; splitting it into shards would not help.
+		return newTar(spec.Target, root)
+	}
+	if spec.Format == "cas" {
+		// A store shared by every scan, with a manifest for each.
+		return newCAS(spec.Target, root)
+	}
+	if spec.ShardSize > 0 && !spec.IsRemote() {
+		return newSharded(spec, root)
+	}
+	if spec.IsRemote() {
+		host := spec.Host
+		if host == "" {
+			host, _ = os.Hostname()
+		}
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+		switch spec.Format {
+		case "postgres":
+			return newPostgres("postgresql://"+spec.Target, root, host)
+		case "clickhouse":
+			return newClickHouse(spec.Target, root, host)
+		case "elasticsearch":
+			return newElastic(spec.Target, root, host)
+		case "kafka":
+			return newKafka(spec.Target, root, host)
+		case "nats":
+			return newNATS(spec.Target, root, host)
+		case "mqtt":
+			return newMQTT(spec.Target, root, host)
+		case "graphite":
+			return newGraphite(spec.Target, host)
+		case "statsd":
+			return newStatsd(spec.Target, host)
+		case "push":
+			return newPush(spec.Target, root, host, spec.Environment, spec.Labels)
+		}
+	}
+	if spec.Format == "sqlite" {
+		return newSQLite(spec.Target)
+	}
+
+	f, err := os.Create(spec.Target)
+	if err != nil {
+		return nil, err
+	}
+	w := &fileWriter{file: f, Writer: bufio.NewWriterSize(f, 256*1024)}
+
+	switch spec.Format {
+	case "ndjson":
+		return newNDJSON(w, spec.Fields), nil
+	case "csv":
+		out, err := newCSV(w, spec.Fields)
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+		return out, nil
+	case "manifest":
+		return newManifest(w, root), nil
+	case "parquet":
+		out, err := newParquet(w)
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+		return out, nil
+	case "arrow", "feather":
+		// Feather v2 is the Arrow IPC file format under another name.
+		out, err := newArrow(w)
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+		return out, nil
+	}
+
+	f.Close()
+	return nil, fmt.Errorf("unknown output format %q", spec.Format)
+}
+
+type fileWriter struct {
+	*bufio.Writer
+	file *os.File
+}
+
+// newScanID returns a sortable, unique identifier for rows written to
+// shared databases.
+func newScanID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(id), nil
+}
+
+func (w *fileWriter) Close() error {
+	if err := w.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
@@ -0,0 +1,737 @@
+package output
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"file-counter/pkg/scanner"
+)
+
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		input  string
+		format string
+		target string
+		ok     bool
+	}{
+		{"ndjson", "ndjson", "inventory.ndjson", true},
+		{"NDJSON://out.json", "ndjson", "out.json", true},
+		{"manifest://m.txt", "manifest", "m.txt", true},
+		{"xml://out.xml", "", "", false},
+	}
+
+	for _, test := range tests {
+		spec, err := ParseSpec(test.input)
+		if (err == nil) != test.ok {
+			t.Errorf("ParseSpec(%q) error = %v, expected ok=%v", test.input, err, test.ok)
+			continue
+		}
+		if test.ok && (spec.Format != test.format || spec.Target != test.target) {
+			t.Errorf("ParseSpec(%q) = %+v", test.input, spec)
+		}
+	}
+}
+
+func TestNDJSONOutput(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "inv.ndjson")
+	out, err := Open(Spec{Format: "ndjson", Target: target}, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []*scanner.FileRecord{
+		{Path: "/data", IsDir: true, Mode: os.ModeDir | 0755, ModTime: time.Unix(0, 0)},
+		{Path: "/data/a.txt", Size: 12, Mode: 0644, ModTime: time.Unix(0, 0), Hash: "abc"},
+	}
+	for _, rec := range records {
+		if err := out.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var lines []ndjsonRecord
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec ndjsonRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", sc.Text(), err)
+		}
+		lines = append(lines, rec)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+	if lines[0].Type != "dir" || lines[1].Type != "file" {
+		t.Errorf("Unexpected types: %q, %q", lines[0].Type, lines[1].Type)
+	}
+	if lines[1].Size != 12 || lines[1].Hash != "abc" {
+		t.Errorf("Unexpected file record: %+v", lines[1])
+	}
+}
+
+func TestFields(t *testing.T) {
+	if _, err := ParseFields("path,inode"); err == nil {
+		t.Error("Expected an error for an unknown field")
+	}
+	fields, err := ParseFields(" Size, path,size ")
+	if err != nil || strings.Join(fields, ",") != "size,path" {
+		t.Fatalf("ParseFields = %v, %v", fields, err)
+	}
+	if !(Spec{Format: "csv", Fields: []string{"path", "hash"}}).NeedsHash() {
+		t.Error("A hash field should need hashing")
+	}
+
+	rec := &scanner.FileRecord{Path: "/data/a \"b\".txt", Size: 12, Mode: 0644, ModTime: time.Unix(0, 0), Hash: "abc"}
+	dir := t.TempDir()
+	for format, want := range map[string]string{
+		"ndjson": `{"size":12,"path":"/data/a \"b\".txt"}` + "\n",
+		"csv":    "size,path\n12,\"/data/a \"\"b\"\".txt\"\n",
+	} {
+		target := filepath.Join(dir, "out."+format)
+		out, err := Open(Spec{Format: format, Target: target, Fields: fields}, "/data")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := out.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+		if err := out.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := os.ReadFile(target)
+		if string(data) != want {
+			t.Errorf("%s output = %q, expected %q", format, data, want)
+		}
+	}
+}
+
+func TestShardedOutput(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "inv.ndjson")
+	out, err := Open(Spec{Format: "ndjson", Target: target, ShardSize: 2}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := out.Write(&scanner.FileRecord{Path: "f", Mode: 0644}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []int{2, 2, 1} {
+		data, err := os.ReadFile(ShardName(target, i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(strings.Split(strings.TrimSpace(string(data)), "\n")); got != want {
+			t.Errorf("Shard %d has %d records, expected %d", i+1, got, want)
+		}
+	}
+	if _, err := os.Stat(ShardName(target, 4)); !os.IsNotExist(err) {
+		t.Error("Unexpected extra shard")
+	}
+}
+
+func TestParseCount(t *testing.T) {
+	tests := map[string]int64{"100": 100, "5k": 5_000, "2M": 2_000_000, "1B": 1_000_000_000}
+	for input, expected := range tests {
+		got, err := ParseCount(input)
+		if err != nil || got != expected {
+			t.Errorf("ParseCount(%q) = %d, %v; expected %d", input, got, err, expected)
+		}
+	}
+	if _, err := ParseCount("lots"); err == nil {
+		t.Error("Expected an error for a non-numeric count")
+	}
+}
+
+func TestExtension(t *testing.T) {
+	tests := map[string]string{
+		"photo.JPG":      "jpg",
+		"archive.tar.gz": "gz",
+		".bashrc":        "",
+		"Makefile":       "",
+		"trailing.":      "",
+	}
+	for name, expected := range tests {
+		if got := extension(name); got != expected {
+			t.Errorf("extension(%q) = %q, expected %q", name, got, expected)
+		}
+	}
+}
+
+func TestSQLiteOutput(t *testing.T) {
+	if _, err := exec.LookPath(SQLiteCommand); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+
+	target := filepath.Join(t.TempDir(), "inv.db")
+	out, err := Open(Spec{Format: "sqlite", Target: target}, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []*scanner.FileRecord{
+		{Path: "/data", IsDir: true, Mode: os.ModeDir | 0755},
+		{Path: "/data/it's.log", Size: 10, Mode: 0644},
+		{Path: "/data/b.log", Size: 5, Mode: 0644},
+	}
+	for _, rec := range records {
+		if err := out.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := exec.Command(SQLiteCommand, target,
+		"SELECT ext, count(*), sum(size) FROM files GROUP BY ext; SELECT count(*) FROM directories;").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "log|2|15\n1\n"; string(got) != expected {
+		t.Errorf("Query returned %q, expected %q", got, expected)
+	}
+}
+
+func TestPostgresOutputScript(t *testing.T) {
+	dir := t.TempDir()
+	captured := filepath.Join(dir, "script.sql")
+	fake := filepath.Join(dir, "psql")
+	if err := os.WriteFile(fake, []byte("#!/bin/sh\ncat > "+captured+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(old string) { PSQLCommand = old }(PSQLCommand)
+	PSQLCommand = fake
+
+	spec, err := ParseSpec("postgresql://user@db/inventory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Open(spec, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Write(&scanner.FileRecord{Path: "/data/tab\there", Size: 3, Mode: 0644}); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.(SummaryWriter).WriteSummary(&scanner.ScanResult{TotalFiles: 1, TotalBytes: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(captured)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := string(data)
+	for _, want := range []string{
+		"COPY files (scan_id, path, type, size, mtime, mode, owner, hash) FROM STDIN;\n",
+		"\t/data/tab\\there\tfile\t3\t",
+		"\t\\N\n\\.\n",
+		"UPDATE scans SET",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Script is missing %q:\n%s", want, script)
+		}
+	}
+}
+
+func TestClickHouseOutput(t *testing.T) {
+	var queries []string
+	var inserted int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("query")
+		queries = append(queries, query)
+		if r.Header.Get("X-ClickHouse-User") != "fc" {
+			http.Error(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+		if strings.HasPrefix(query, "INSERT INTO inv ") {
+			sc := bufio.NewScanner(r.Body)
+			for sc.Scan() {
+				var row clickhouseRow
+				if err := json.Unmarshal(sc.Bytes(), &row); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				inserted++
+			}
+		}
+	}))
+	defer server.Close()
+
+	spec, err := ParseSpec("clickhouse://fc:secret@" + strings.TrimPrefix(server.URL, "http://") + "/storage?table=inv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Open(spec, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := out.Write(&scanner.FileRecord{Path: "/data/f", Size: 1, Mode: 0644}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := out.(SummaryWriter).WriteSummary(&scanner.ScanResult{TotalFiles: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if inserted != 3 {
+		t.Errorf("Expected 3 inserted rows, got %d", inserted)
+	}
+	if len(queries) != 4 || !strings.HasPrefix(queries[3], "INSERT INTO inv_scans") {
+		t.Errorf("Unexpected query sequence: %q", queries)
+	}
+}
+
+func TestClickHouseTableName(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("query"))
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	for table, ok := range map[string]bool{
+		"inv":                   true,
+		"_files_2024":           true,
+		"Files":                 true,
+		"2024":                  false,
+		"inv; DROP TABLE users": false,
+		"inv`":                  false,
+		"db.inv":                false,
+		"inv (x String) --":     false,
+		"inventaire_année":      false,
+	} {
+		queries = nil
+		spec, err := ParseSpec("clickhouse://" + host + "/storage?table=" + url.QueryEscape(table))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := Open(spec, "/data")
+		if err == nil {
+			out.Close()
+		}
+		if ok && err != nil {
+			t.Errorf("table=%q: %v", table, err)
+		}
+		if !ok && (err == nil || len(queries) > 0) {
+			t.Errorf("table=%q was accepted, sending %q", table, queries)
+		}
+	}
+}
+
+func TestElasticOutput(t *testing.T) {
+	var requests []string
+	var indexed int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/inv":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"type":"resource_already_exists_exception"}}`))
+		case r.URL.Path == "/inv/_bulk":
+			sc := bufio.NewScanner(r.Body)
+			for sc.Scan() {
+				indexed++
+			}
+			w.Write([]byte(`{"errors":false,"items":[]}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	spec, err := ParseSpec("opensearch://" + strings.TrimPrefix(server.URL, "http://") + "/inv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Open(spec, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Write(&scanner.FileRecord{Path: "/data/a.log", Size: 1, Mode: 0644}); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.(SummaryWriter).WriteSummary(&scanner.ScanResult{TotalFiles: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if indexed != 2 {
+		t.Errorf("Expected an action and a document line, got %d lines", indexed)
+	}
+	if len(requests) != 3 || !strings.HasPrefix(requests[2], "PUT /inv-scans/_doc/") {
+		t.Errorf("Unexpected requests: %q", requests)
+	}
+}
+
+func TestBulkError(t *testing.T) {
+	if err := bulkError([]byte(`{"errors":false}`)); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	body := `{"errors":true,"items":[{"index":{"status":201}},{"index":{"status":400,"error":{"type":"mapper_parsing_exception"}}}]}`
+	err := bulkError([]byte(body))
+	if err == nil || !strings.Contains(err.Error(), "1 documents rejected") {
+		t.Errorf("Expected a rejection error, got %v", err)
+	}
+}
+
+func TestMetricOutputs(t *testing.T) {
+	result := &scanner.ScanResult{TotalFiles: 42, TotalBytes: 1024, Duration: 1500 * time.Millisecond}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	received := make(chan string, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		data, _ := io.ReadAll(c)
+		c.Close()
+		received <- string(data)
+	}()
+
+	spec, _ := ParseSpec("graphite://" + l.Addr().String() + "/storage/nas1")
+	out, err := Open(spec, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := out.(SummaryWriter).WriteSummary(result); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	graphite := <-received
+	if !strings.Contains(graphite, "storage.nas1.files 42 ") || !strings.Contains(graphite, "storage.nas1.duration_seconds 1.5 ") {
+		t.Errorf("Unexpected Graphite lines:\n%s", graphite)
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	spec, _ = ParseSpec("statsd://" + pc.LocalAddr().String() + "/fc")
+	out, err = Open(spec, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := out.(SummaryWriter).WriteSummary(result); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	buf := make([]byte, 2048)
+	pc.SetDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statsd := string(buf[:n])
+	if !strings.Contains(statsd, "fc.bytes:1024|g\n") || !strings.Contains(statsd, "fc.duration:1500|ms") {
+		t.Errorf("Unexpected statsd packet:\n%s", statsd)
+	}
+}
+
+func TestInfluxOutput(t *testing.T) {
+	write := func(out Output) {
+		for _, rec := range []*scanner.FileRecord{
+			{Path: "/data/a", IsDir: true},
+			{Path: "/data/a/x", Size: 10},
+			{Path: "/data/a/b/y", Size: 5},
+			{Path: "/data/a/b/c/z", Size: 1},
+			{Path: "/data/top", Size: 100},
+		} {
+			if err := out.Write(rec); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := out.(SummaryWriter).WriteSummary(&scanner.ScanResult{TotalFiles: 4, TotalBytes: 116}); err != nil {
+			t.Fatal(err)
+		}
+		if err := out.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "scan.lp")
+	spec, _ := ParseSpec("influxdb://" + path + "?depth=2")
+	out, err := Open(spec, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(out)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := string(data)
+	for _, want := range []string{
+		"files=4i,dirs=0i,bytes=116i",
+		",path=/data,depth=0 files=4i,bytes=116i ",
+		",path=/data/a,depth=1 files=3i,bytes=16i ",
+		",path=/data/a/b,depth=2 files=2i,bytes=6i ",
+	} {
+		if !strings.Contains(lines, want) {
+			t.Errorf("Missing %q in:\n%s", want, lines)
+		}
+	}
+	if strings.Contains(lines, "/data/a/b/c,") {
+		t.Errorf("Directory below depth 2 was written:\n%s", lines)
+	}
+
+	var body, query, auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body, query, auth = string(data), r.URL.RawQuery, r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	t.Setenv("INFLUX_TOKEN", "secret")
+
+	spec, _ = ParseSpec("influx://" + server.URL + "/api/v2/write?bucket=fc&org=home&depth=0")
+	out, err = Open(spec, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(out)
+	if query != "bucket=fc&org=home" || auth != "Token secret" {
+		t.Errorf("Unexpected request: query %q, authorization %q", query, auth)
+	}
+	if strings.Count(body, "file_counter_dir,") != 1 {
+		t.Errorf("Expected only the root directory at depth 0:\n%s", body)
+	}
+}
+
+func TestPushOutput(t *testing.T) {
+	defer func(d time.Duration) { pushBackoff = d }(pushBackoff)
+	pushBackoff = time.Millisecond
+	t.Setenv(PushKeyEnv, "key")
+	t.Setenv(PushTokenEnv, "token")
+
+	available := false
+	var received []scanSummary
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "no token", http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("key"))
+		mac.Write(body)
+		if r.Header.Get("X-File-Counter-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		var summary scanSummary
+		json.Unmarshal(body, &summary)
+		received = append(received, summary)
+	}))
+	defer server.Close()
+
+	spool := t.TempDir()
+	push := func(files int64) error {
+		spec, _ := ParseSpec("push://" + server.URL)
+		spec.Host, spec.Environment, spec.Labels = "web-1", "prod", map[string]string{"team": "storage"}
+		out, err := Open(spec, "/data")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.(*pushOutput).spoolDir = spool
+		defer out.Close()
+		return out.(SummaryWriter).WriteSummary(&scanner.ScanResult{TotalFiles: files})
+	}
+
+	if err := push(1); err == nil || !strings.Contains(err.Error(), "spooled") {
+		t.Fatalf("Expected the summary to be spooled, got %v", err)
+	}
+	if names, _ := filepath.Glob(filepath.Join(spool, "*.json")); len(names) != 1 {
+		t.Fatalf("Expected one spooled summary, got %v", names)
+	}
+
+	available = true
+	if err := push(2); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 2 || received[0].TotalFiles != 1 || received[1].TotalFiles != 2 {
+		t.Errorf("Expected spooled then current summary, got %+v", received)
+	}
+	for _, s := range received {
+		if s.Host != "web-1" || s.Environment != "prod" || s.Labels["team"] != "storage" {
+			t.Errorf("Expected host metadata in %+v", s)
+		}
+	}
+	if names, _ := filepath.Glob(filepath.Join(spool, "*")); len(names) != 0 {
+		t.Errorf("Spool not emptied: %v", names)
+	}
+}
+
+func TestTarOutput(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "a.txt"), []byte("hello"), 0644)
+	os.Mkdir(filepath.Join(root, "sub"), 0755)
+	os.WriteFile(filepath.Join(root, "sub", "b.txt"), []byte("world!"), 0600)
+	os.Symlink("a.txt", filepath.Join(root, "link"))
+
+	target := filepath.Join(t.TempDir(), "out.tar.gz")
+	out, err := Open(Spec{Format: "tar", Target: target}, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := scanner.NewScannerWithOptions(scanner.Options{Sinks: []scanner.Sink{out}})
+	s.Start(root)
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeSymlink {
+			got[hdr.Name] = "-> " + hdr.Linkname
+			continue
+		}
+		data, _ := io.ReadAll(tr)
+		got[hdr.Name] = string(data)
+	}
+	want := map[string]string{"a.txt": "hello", "sub/b.txt": "world!", "link": "-> a.txt"}
+	if len(got) != len(want) {
+		t.Fatalf("Archive members = %v, expected %v", got, want)
+	}
+	for name, content := range want {
+		if got[name] != content {
+			t.Errorf("%s = %q, expected %q", name, got[name], content)
+		}
+	}
+}
+
+func TestCASOutput(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "a.txt"), []byte("hello"), 0644)
+	os.Mkdir(filepath.Join(root, "sub"), 0755)
+	os.WriteFile(filepath.Join(root, "sub", "copy.txt"), []byte("hello"), 0644)
+	os.WriteFile(filepath.Join(root, "sub", "b.txt"), []byte("world!"), 0600)
+
+	store := t.TempDir()
+	export := func() []string {
+		out, err := Open(Spec{Format: "cas", Target: store}, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := scanner.NewScannerWithOptions(scanner.Options{Sinks: []scanner.Sink{out}, Hash: true, Quiet: true})
+		s.Start(root)
+		if err := out.Close(); err != nil {
+			t.Fatal(err)
+		}
+		manifests, _ := filepath.Glob(filepath.Join(store, "manifests", "*.txt"))
+		if len(manifests) == 0 {
+			t.Fatal("No manifest written")
+		}
+		data, err := os.ReadFile(manifests[len(manifests)-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+
+	lines := export()
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 manifest lines, got %q", lines)
+	}
+	hashes := map[string]string{}
+	for _, line := range lines {
+		hash, path, _ := strings.Cut(line, "  ")
+		hashes[path] = hash
+	}
+	if hashes["a.txt"] != hashes["sub/copy.txt"] {
+		t.Errorf("Identical files have different hashes: %v", hashes)
+	}
+	for path, content := range map[string]string{"a.txt": "hello", "sub/b.txt": "world!"} {
+		h := hashes[path]
+		data, err := os.ReadFile(filepath.Join(store, "objects", h[:2], h[2:]))
+		if err != nil || string(data) != content {
+			t.Errorf("Object of %s = %q, %v; expected %q", path, data, err, content)
+		}
+	}
+	objects := func() int {
+		n := 0
+		filepath.WalkDir(filepath.Join(store, "objects"), func(path string, d os.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				n++
+			}
+			return nil
+		})
+		return n
+	}
+	if n := objects(); n != 2 {
+		t.Errorf("Expected 2 distinct objects, got %d", n)
+	}
+
+	// A second export into the same store adds nothing but its manifest.
+	if lines := export(); len(lines) != 3 {
+		t.Errorf("Expected 3 lines in the second manifest, got %q", lines)
+	}
+	if n := objects(); n != 2 {
+		t.Errorf("Expected still 2 objects after the second export, got %d", n)
+	}
+}
@@ -0,0 +1,37 @@
+package output
+
+import (
+	"os/user"
+	"strconv"
+	"sync"
+
+	"file-counter/pkg/scanner"
+)
+
+var (
+	ownerMu    sync.Mutex
+	ownerNames = map[uint32]string{}
+)
+
+// OwnerName resolves the record's UID to a user name, falling back to the
+// numeric id. Lookups are cached since inventories repeat a handful of owners
+// millions of times.
+func OwnerName(rec *scanner.FileRecord) string {
+	if !rec.HasOwner {
+		return ""
+	}
+
+	ownerMu.Lock()
+	defer ownerMu.Unlock()
+	if name, ok := ownerNames[rec.UID]; ok {
+		return name
+	}
+
+	id := strconv.FormatUint(uint64(rec.UID), 10)
+	name := id
+	if u, err := user.LookupId(id); err == nil {
+		name = u.Username
+	}
+	ownerNames[rec.UID] = name
+	return name
+}
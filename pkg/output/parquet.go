@@ -0,0 +1,40 @@
+package output
+
+import (
+	"file-counter/pkg/parquet"
+	"file-counter/pkg/scanner"
+)
+
+var parquetColumns = []parquet.Column{
+	{Name: "path", Type: parquet.String},
+	{Name: "size", Type: parquet.Int64},
+	{Name: "mtime", Type: parquet.Timestamp},
+	{Name: "type", Type: parquet.String},
+	{Name: "owner", Type: parquet.String},
+	{Name: "hash", Type: parquet.String},
+}
+
+type parquetOutput struct {
+	w  *fileWriter
+	pw *parquet.Writer
+}
+
+func newParquet(w *fileWriter) (*parquetOutput, error) {
+	pw, err := parquet.NewWriter(w, parquetColumns)
+	if err != nil {
+		return nil, err
+	}
+	return &parquetOutput{w: w, pw: pw}, nil
+}
+
+func (o *parquetOutput) Write(rec *scanner.FileRecord) error {
+	return o.pw.WriteRow(rec.Path, rec.Size, rec.ModTime, FileType(rec), OwnerName(rec), rec.Hash)
+}
+
+func (o *parquetOutput) Close() error {
+	if err := o.pw.Close(); err != nil {
+		o.w.Close()
+		return err
+	}
+	return o.w.Close()
+}
@@ -0,0 +1,148 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"file-counter/pkg/scanner"
+)
+
+// PSQLCommand is the PostgreSQL client used to load inventories. Rows are
+// sent with COPY ... FROM STDIN, the bulk-load path of the wire protocol.
+var PSQLCommand = "psql"
+
+const postgresSchema = `CREATE TABLE IF NOT EXISTS scans (
+	id              TEXT PRIMARY KEY,
+	root            TEXT NOT NULL,
+	host            TEXT NOT NULL,
+	started_at      TIMESTAMPTZ NOT NULL,
+	finished_at     TIMESTAMPTZ,
+	total_files     BIGINT,
+	total_dirs      BIGINT,
+	total_bytes     BIGINT,
+	total_errors    BIGINT,
+	total_skipped   BIGINT,
+	duration_seconds DOUBLE PRECISION
+);
+CREATE TABLE IF NOT EXISTS files (
+	scan_id TEXT NOT NULL REFERENCES scans(id) ON DELETE CASCADE,
+	path    TEXT NOT NULL,
+	type    TEXT NOT NULL,
+	size    BIGINT NOT NULL,
+	mtime   TIMESTAMPTZ NOT NULL,
+	mode    INTEGER NOT NULL,
+	owner   TEXT NOT NULL,
+	hash    TEXT
+);
+CREATE INDEX IF NOT EXISTS files_scan_path ON files(scan_id, path);
+`
+
+type postgresOutput struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	w      *bufio.Writer
+	stderr bytes.Buffer
+	scanID string
+	copy   bool
+}
+
+func newPostgres(url, root, host string) (*postgresOutput, error) {
+	if _, err := exec.LookPath(PSQLCommand); err != nil {
+		return nil, fmt.Errorf("postgres output needs the %s command: %w", PSQLCommand, err)
+	}
+
+	id, err := newScanID()
+	if err != nil {
+		return nil, err
+	}
+
+	o := &postgresOutput{
+		cmd:    exec.Command(PSQLCommand, "-X", "-q", "-v", "ON_ERROR_STOP=1", url),
+		scanID: id,
+	}
+	o.cmd.Stderr = &o.stderr
+	stdin, err := o.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := o.cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	o.stdin = stdin
+	o.w = bufio.NewWriterSize(stdin, 256*1024)
+	o.w.WriteString(postgresSchema)
+	fmt.Fprintf(o.w, "INSERT INTO scans (id, root, host, started_at) VALUES (%s, %s, %s, %s);\n",
+		sqlQuote(o.scanID), sqlQuote(root), sqlQuote(host), sqlQuote(time.Now().UTC().Format(time.RFC3339Nano)))
+	o.w.WriteString("COPY files (scan_id, path, type, size, mtime, mode, owner, hash) FROM STDIN;\n")
+	o.copy = true
+	return o, nil
+}
+
+func (o *postgresOutput) Write(rec *scanner.FileRecord) error {
+	hash := `\N`
+	if rec.Hash != "" {
+		hash = copyEscape(rec.Hash)
+	}
+	fmt.Fprintf(o.w, "%s\t%s\t%s\t%d\t%s\t%d\t%s\t%s\n",
+		o.scanID, copyEscape(rec.Path), FileType(rec), rec.Size,
+		rec.ModTime.UTC().Format(time.RFC3339Nano), uint32(rec.Mode.Perm()), copyEscape(OwnerName(rec)), hash)
+
+	if _, err := o.w.Write(nil); err != nil {
+		return o.fail(err)
+	}
+	return nil
+}
+
+func (o *postgresOutput) endCopy() {
+	if o.copy {
+		o.w.WriteString("\\.\n")
+		o.copy = false
+	}
+}
+
+func (o *postgresOutput) WriteSummary(result *scanner.ScanResult) error {
+	o.endCopy()
+	fmt.Fprintf(o.w, "UPDATE scans SET finished_at = %s, total_files = %d, total_dirs = %d, total_bytes = %d, "+
+		"total_errors = %d, total_skipped = %d, duration_seconds = %f WHERE id = %s;\n",
+		sqlQuote(time.Now().UTC().Format(time.RFC3339Nano)), result.TotalFiles, result.TotalDirs, result.TotalBytes,
+		result.TotalErrors, result.TotalSkipped, result.Duration.Seconds(), sqlQuote(o.scanID))
+
+	if _, err := o.w.Write(nil); err != nil {
+		return o.fail(err)
+	}
+	return nil
+}
+
+func (o *postgresOutput) Close() error {
+	o.endCopy()
+	flushErr := o.w.Flush()
+	o.stdin.Close()
+
+	if err := o.cmd.Wait(); err != nil {
+		return o.fail(err)
+	}
+	if flushErr != nil {
+		return o.fail(flushErr)
+	}
+	return nil
+}
+
+func (o *postgresOutput) fail(err error) error {
+	if msg := strings.TrimSpace(o.stderr.String()); msg != "" {
+		return fmt.Errorf("psql: %s", msg)
+	}
+	return fmt.Errorf("psql: %w", err)
+}
+
+var copyReplacer = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// copyEscape escapes a value for COPY's text format.
+func copyEscape(s string) string {
+	return copyReplacer.Replace(s)
+}
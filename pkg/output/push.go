@@ -0,0 +1,239 @@
+package output
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"file-counter/pkg/scanner"
+)
+
+// PushKeyEnv names the environment variable holding the HMAC key used to
+// sign pushed summaries.
+const PushKeyEnv = "FILE_COUNTER_PUSH_KEY"
+
+// Collectors that require authentication are given the bearer token in
+// PushTokenEnv, or user and password in the push URL for basic auth. For
+// mutual TLS, PushCertEnv and PushKeyFileEnv name the client certificate
+// and key files and PushCAEnv the CAs trusted for the collector.
+const (
+	PushTokenEnv   = "FILE_COUNTER_PUSH_TOKEN"
+	PushCertEnv    = "FILE_COUNTER_PUSH_CERT"
+	PushKeyFileEnv = "FILE_COUNTER_PUSH_CERT_KEY"
+	PushCAEnv      = "FILE_COUNTER_PUSH_CA"
+)
+
+// pushAttempts and pushBackoff control retries before a summary is spooled.
+var (
+	pushAttempts = 4
+	pushBackoff  = time.Second
+)
+
+// errRejected marks responses that will not succeed on retry.
+var errRejected = errors.New("rejected by collector")
+
+// pushOutput POSTs the scan summary to a collector. Summaries that cannot be
+// delivered are spooled to disk and sent, oldest first, before the next one.
+type pushOutput struct {
+	url      string
+	key      []byte
+	token    string
+	client   *http.Client
+	spoolDir string
+	scanID   string
+	host     string
+	env      string
+	root     string
+	labels   map[string]string
+	started  time.Time
+}
+
+func newPush(target, root, host, env string, labels map[string]string) (*pushOutput, error) {
+	if !isHTTP(target) {
+		return nil, fmt.Errorf("push target must be an http(s) URL, got %q", target)
+	}
+	spoolDir, err := defaultSpoolDir()
+	if err != nil {
+		return nil, err
+	}
+	id, err := newScanID()
+	if err != nil {
+		return nil, err
+	}
+	client, err := pushClient()
+	if err != nil {
+		return nil, err
+	}
+	return &pushOutput{
+		url:      target,
+		key:      []byte(os.Getenv(PushKeyEnv)),
+		token:    os.Getenv(PushTokenEnv),
+		client:   client,
+		spoolDir: spoolDir,
+		scanID:   id,
+		host:     host,
+		env:      env,
+		root:     root,
+		labels:   labels,
+		started:  time.Now(),
+	}, nil
+}
+
+// pushClient returns the HTTP client for the collector, presenting a
+// client certificate if one is configured.
+func pushClient() (*http.Client, error) {
+	cert, key, ca := os.Getenv(PushCertEnv), os.Getenv(PushKeyFileEnv), os.Getenv(PushCAEnv)
+	if cert == "" && ca == "" {
+		return remoteClient, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cert != "" {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("push client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+	if ca != "" {
+		pem, err := os.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", ca)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	return &http.Client{Timeout: remoteClient.Timeout, Transport: transport}, nil
+}
+
+func defaultSpoolDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "file-counter", "spool"), nil
+}
+
+func (o *pushOutput) Write(rec *scanner.FileRecord) error {
+	return nil
+}
+
+func (o *pushOutput) WriteSummary(result *scanner.ScanResult) error {
+	summary := newScanSummary(result, o.scanID, o.host, o.root, o.started)
+	summary.Environment, summary.Labels = o.env, o.labels
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+
+	if err := o.flushSpool(); err != nil {
+		return o.spool(body, err)
+	}
+	if err := o.send(body); err != nil {
+		if errors.Is(err, errRejected) {
+			return err
+		}
+		return o.spool(body, err)
+	}
+	return nil
+}
+
+// flushSpool delivers previously spooled summaries in the order they were
+// written, stopping at the first one that fails.
+func (o *pushOutput) flushSpool() error {
+	names, err := filepath.Glob(filepath.Join(o.spoolDir, "*.json"))
+	if err != nil || len(names) == 0 {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		body, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		err = o.send(body)
+		if errors.Is(err, errRejected) {
+			// Keep the file for inspection but stop resending it.
+			os.Rename(name, name+".rejected")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *pushOutput) spool(body []byte, cause error) error {
+	if err := os.MkdirAll(o.spoolDir, 0700); err != nil {
+		return fmt.Errorf("push failed (%v) and spooling failed: %w", cause, err)
+	}
+	name := filepath.Join(o.spoolDir, o.scanID+".json")
+	if err := os.WriteFile(name, body, 0600); err != nil {
+		return fmt.Errorf("push failed (%v) and spooling failed: %w", cause, err)
+	}
+	return fmt.Errorf("push failed, summary spooled to %s for the next run: %w", name, cause)
+}
+
+// send POSTs body, retrying network errors and 5xx responses with
+// exponential backoff.
+func (o *pushOutput) send(body []byte) error {
+	var err error
+	delay := pushBackoff
+	for attempt := 0; attempt < pushAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		var req *http.Request
+		req, err = http.NewRequest(http.MethodPost, o.url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if o.token != "" {
+			req.Header.Set("Authorization", "Bearer "+o.token)
+		}
+		if len(o.key) > 0 {
+			mac := hmac.New(sha256.New, o.key)
+			mac.Write(body)
+			req.Header.Set("X-File-Counter-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		}
+
+		var resp *http.Response
+		resp, err = o.client.Do(req)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode < 300:
+			return nil
+		case resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+			return fmt.Errorf("push: %s: %w", resp.Status, errRejected)
+		}
+		err = fmt.Errorf("push: %s", resp.Status)
+	}
+	return err
+}
+
+func (o *pushOutput) Close() error {
+	return nil
+}
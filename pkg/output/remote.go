@@ -0,0 +1,75 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// remoteTarget is a parsed [user[:password]@]host[:port]/path[?query] target
+// for HTTP-based outputs.
+type remoteTarget struct {
+	baseURL  string
+	path     string
+	query    url.Values
+	user     string
+	password string
+}
+
+func parseRemote(target, defaultPort string) (*remoteTarget, error) {
+	u, err := url.Parse("remote://" + target)
+	if err != nil {
+		return nil, err
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("missing host in %q", target)
+	}
+
+	scheme := "http"
+	if q := u.Query().Get("secure"); q == "true" || q == "1" {
+		scheme = "https"
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr += ":" + defaultPort
+	}
+
+	r := &remoteTarget{
+		baseURL: scheme + "://" + addr,
+		path:    strings.Trim(u.Path, "/"),
+		query:   u.Query(),
+	}
+	if u.User != nil {
+		r.user = u.User.Username()
+		r.password, _ = u.User.Password()
+	}
+	return r, nil
+}
+
+var remoteClient = &http.Client{Timeout: 5 * time.Minute}
+
+// doRequest sends req and returns the response body, treating any non-2xx
+// status as an error that includes the server's message.
+func doRequest(name string, req *http.Request) ([]byte, error) {
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg := strings.TrimSpace(string(body))
+		if len(msg) > 4096 {
+			msg = msg[:4096]
+		}
+		return body, fmt.Errorf("%s: %s: %s", name, resp.Status, msg)
+	}
+	return body, nil
+}
@@ -0,0 +1,94 @@
+package output
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"file-counter/pkg/scanner"
+)
+
+// shardedOutput splits a stream of records over numbered files, closing each
+// one after size records so it is complete and readable on its own.
+type shardedOutput struct {
+	spec    Spec
+	root    string
+	size    int64
+	index   int
+	written int64
+	current Output
+}
+
+func newSharded(spec Spec, root string) (*shardedOutput, error) {
+	o := &shardedOutput{spec: spec, root: root, size: spec.ShardSize}
+	if err := o.rotate(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *shardedOutput) Write(rec *scanner.FileRecord) error {
+	if o.written >= o.size {
+		if err := o.rotate(); err != nil {
+			return err
+		}
+	}
+	o.written++
+	return o.current.Write(rec)
+}
+
+func (o *shardedOutput) Close() error {
+	return o.current.Close()
+}
+
+func (o *shardedOutput) rotate() error {
+	if o.current != nil {
+		if err := o.current.Close(); err != nil {
+			return err
+		}
+	}
+
+	o.index++
+	spec := o.spec
+	spec.Target = ShardName(o.spec.Target, o.index)
+	spec.ShardSize = 0
+
+	next, err := Open(spec, o.root)
+	if err != nil {
+		return err
+	}
+	o.current = next
+	o.written = 0
+	return nil
+}
+
+// ShardName inserts a zero-padded shard number before the extension, so
+// "inventory.ndjson" becomes "inventory-00001.ndjson".
+func ShardName(target string, index int) string {
+	ext := filepath.Ext(target)
+	return fmt.Sprintf("%s-%05d%s", strings.TrimSuffix(target, ext), index, ext)
+}
+
+// ParseCount parses a record count with an optional K, M or B suffix.
+func ParseCount(value string) (int64, error) {
+	value = strings.TrimSpace(strings.ToUpper(value))
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(value, "K"):
+		mult = 1_000
+	case strings.HasSuffix(value, "M"):
+		mult = 1_000_000
+	case strings.HasSuffix(value, "B"):
+		mult = 1_000_000_000
+	}
+	if mult > 1 {
+		value = value[:len(value)-1]
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid count %q", value)
+	}
+	return n * mult, nil
+}
@@ -0,0 +1,157 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"file-counter/pkg/scanner"
+)
+
+// SQLiteCommand is the sqlite3 shell used to build databases. The inventory
+// is streamed to it as SQL, which keeps the module free of cgo and drivers.
+var SQLiteCommand = "sqlite3"
+
+const sqliteBatch = 10000
+
+const sqliteSchema = `PRAGMA journal_mode = OFF;
+PRAGMA synchronous = OFF;
+CREATE TABLE files (
+	path  TEXT NOT NULL,
+	dir   TEXT NOT NULL,
+	name  TEXT NOT NULL,
+	ext   TEXT NOT NULL,
+	type  TEXT NOT NULL,
+	size  INTEGER NOT NULL,
+	mtime INTEGER NOT NULL,
+	mode  INTEGER NOT NULL,
+	owner TEXT NOT NULL,
+	hash  TEXT
+);
+CREATE TABLE directories (
+	path   TEXT NOT NULL,
+	parent TEXT NOT NULL,
+	name   TEXT NOT NULL,
+	mtime  INTEGER NOT NULL,
+	mode   INTEGER NOT NULL,
+	owner  TEXT NOT NULL
+);
+BEGIN;
+`
+
+// Indexes are created after loading, which is much faster than maintaining
+// them row by row.
+const sqliteIndexes = `COMMIT;
+CREATE UNIQUE INDEX files_path ON files(path);
+CREATE INDEX files_dir ON files(dir);
+CREATE INDEX files_ext ON files(ext);
+CREATE INDEX files_size ON files(size);
+CREATE UNIQUE INDEX directories_path ON directories(path);
+CREATE INDEX directories_parent ON directories(parent);
+`
+
+type sqliteOutput struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	w      *bufio.Writer
+	stderr bytes.Buffer
+	rows   int
+}
+
+func newSQLite(target string) (*sqliteOutput, error) {
+	if _, err := exec.LookPath(SQLiteCommand); err != nil {
+		return nil, fmt.Errorf("sqlite output needs the %s command: %w", SQLiteCommand, err)
+	}
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	o := &sqliteOutput{cmd: exec.Command(SQLiteCommand, "-bail", target)}
+	o.cmd.Stderr = &o.stderr
+	stdin, err := o.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := o.cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	o.stdin = stdin
+	o.w = bufio.NewWriterSize(stdin, 256*1024)
+	o.w.WriteString(sqliteSchema)
+	return o, nil
+}
+
+func (o *sqliteOutput) Write(rec *scanner.FileRecord) error {
+	p := filepath.ToSlash(rec.Path)
+	dir, name := path.Split(p)
+	if dir != "/" {
+		dir = strings.TrimSuffix(dir, "/")
+	}
+
+	if rec.IsDir {
+		fmt.Fprintf(o.w, "INSERT INTO directories VALUES(%s,%s,%s,%d,%d,%s);\n",
+			sqlQuote(p), sqlQuote(dir), sqlQuote(name), rec.ModTime.Unix(), uint32(rec.Mode), sqlQuote(OwnerName(rec)))
+	} else {
+		hash := "NULL"
+		if rec.Hash != "" {
+			hash = sqlQuote(rec.Hash)
+		}
+		fmt.Fprintf(o.w, "INSERT INTO files VALUES(%s,%s,%s,%s,%s,%d,%d,%d,%s,%s);\n",
+			sqlQuote(p), sqlQuote(dir), sqlQuote(name), sqlQuote(extension(name)), sqlQuote(FileType(rec)),
+			rec.Size, rec.ModTime.Unix(), uint32(rec.Mode), sqlQuote(OwnerName(rec)), hash)
+	}
+
+	o.rows++
+	if o.rows%sqliteBatch == 0 {
+		o.w.WriteString("COMMIT;\nBEGIN;\n")
+	}
+
+	// bufio keeps the first write error; surface it so the scan stops when
+	// sqlite3 has exited.
+	if _, err := o.w.Write(nil); err != nil {
+		return o.fail(err)
+	}
+	return nil
+}
+
+func (o *sqliteOutput) Close() error {
+	o.w.WriteString(sqliteIndexes)
+	flushErr := o.w.Flush()
+	o.stdin.Close()
+
+	if err := o.cmd.Wait(); err != nil {
+		return o.fail(err)
+	}
+	if flushErr != nil {
+		return o.fail(flushErr)
+	}
+	return nil
+}
+
+func (o *sqliteOutput) fail(err error) error {
+	if msg := strings.TrimSpace(o.stderr.String()); msg != "" {
+		return fmt.Errorf("sqlite3: %s", msg)
+	}
+	return fmt.Errorf("sqlite3: %w", err)
+}
+
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// extension returns the lower-cased extension without the dot, or "" for
+// names without one (including dotfiles like ".bashrc").
+func extension(name string) string {
+	i := strings.LastIndexByte(name, '.')
+	if i <= 0 || i == len(name)-1 {
+		return ""
+	}
+	return strings.ToLower(name[i+1:])
+}
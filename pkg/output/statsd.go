@@ -0,0 +1,74 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+
+	"file-counter/pkg/scanner"
+)
+
+// statsdPacketSize keeps datagrams below the common 1500 byte MTU.
+const statsdPacketSize = 1400
+
+// statsdOutput sends the scan totals as statsd gauges, and the scan
+// duration as a timer, once the scan finishes.
+type statsdOutput struct {
+	conn   net.Conn
+	prefix string
+}
+
+func newStatsd(target, host string) (*statsdOutput, error) {
+	addr, prefix, err := metricTarget(target, "8125", host)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd: %w", err)
+	}
+	return &statsdOutput{conn: conn, prefix: prefix}, nil
+}
+
+func (o *statsdOutput) Write(rec *scanner.FileRecord) error {
+	return nil
+}
+
+func (o *statsdOutput) WriteSummary(result *scanner.ScanResult) error {
+	lines := make([]string, 0, 8)
+	for _, m := range scanMetrics(result) {
+		if m.Name == "duration_seconds" {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s.%s:%s|g", o.prefix, m.Name, strconv.FormatFloat(m.Value, 'f', -1, 64)))
+	}
+	lines = append(lines, fmt.Sprintf("%s.duration:%d|ms", o.prefix, result.Duration.Milliseconds()))
+
+	// Several metrics per datagram, newline separated, as long as they fit.
+	var packet bytes.Buffer
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdPacketSize {
+			if err := o.send(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	return o.send(packet.Bytes())
+}
+
+func (o *statsdOutput) send(packet []byte) error {
+	if _, err := o.conn.Write(packet); err != nil {
+		return fmt.Errorf("statsd: %w", err)
+	}
+	return nil
+}
+
+func (o *statsdOutput) Close() error {
+	return o.conn.Close()
+}
@@ -0,0 +1,152 @@
+package output
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"file-counter/pkg/scanner"
+)
+
+// tarOutput copies every regular file and symlink the scan visits into a
+// tar archive, gzip-compressed when the target ends in .gz or .tgz. Names
+// are relative to the scan root. Files that can no longer be opened are
+// left out rather than stopping the scan, and reported by Close.
+type tarOutput struct {
+	w          *fileWriter
+	gz         *gzip.Writer
+	tw         *tar.Writer
+	root       string
+	unreadable int64
+	firstErr   error
+}
+
+func newTar(target, root string) (*tarOutput, error) {
+	f, err := os.Create(target)
+	if err != nil {
+		return nil, err
+	}
+	o := &tarOutput{w: &fileWriter{file: f, Writer: bufio.NewWriterSize(f, 256*1024)}, root: root}
+	var w io.Writer = o.w
+	if strings.HasSuffix(target, ".gz") || strings.HasSuffix(target, ".tgz") {
+		o.gz = gzip.NewWriter(o.w)
+		w = o.gz
+	}
+	o.tw = tar.NewWriter(w)
+	return o, nil
+}
+
+// relName maps path to a relative, slash-separated name below root. Paths
+// outside the root (possible with -files-from) keep their full path minus
+// the leading slash, as tar itself does.
+func relName(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = strings.TrimLeft(filepath.Clean(path), `/\`)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (o *tarOutput) Write(rec *scanner.FileRecord) error {
+	hdr := &tar.Header{
+		Name:    relName(o.root, rec.Path),
+		Mode:    tarMode(rec.Mode),
+		ModTime: rec.ModTime,
+		Format:  tar.FormatPAX,
+	}
+	if rec.HasOwner {
+		hdr.Uid, hdr.Gid = int(rec.UID), int(rec.GID)
+	}
+
+	switch {
+	case rec.Mode&os.ModeSymlink != 0:
+		target, err := os.Readlink(rec.Path)
+		if err != nil {
+			o.skip(rec.Path, err)
+			return nil
+		}
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = target
+		return o.tw.WriteHeader(hdr)
+	case rec.Mode.IsRegular():
+		f, err := os.Open(rec.Path)
+		if err != nil {
+			o.skip(rec.Path, err)
+			return nil
+		}
+		defer f.Close()
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = rec.Size
+		if err := o.tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		// The header already promised rec.Size bytes: extra bytes from a
+		// file that grew are dropped and one that shrank is padded with
+		// zeros, like GNU tar does.
+		n, err := io.Copy(o.tw, io.LimitReader(f, rec.Size))
+		if err != nil && !errors.Is(err, io.EOF) {
+			if _, werr := io.CopyN(o.tw, zeros{}, rec.Size-n); werr != nil {
+				return werr
+			}
+			o.skip(rec.Path, err)
+			return nil
+		}
+		if n < rec.Size {
+			_, err = io.CopyN(o.tw, zeros{}, rec.Size-n)
+			return err
+		}
+		return nil
+	}
+	return nil
+}
+
+func (o *tarOutput) skip(path string, err error) {
+	o.unreadable++
+	if o.firstErr == nil {
+		o.firstErr = fmt.Errorf("%s: %w", path, err)
+	}
+}
+
+func (o *tarOutput) Close() error {
+	err := o.tw.Close()
+	if o.gz != nil {
+		if gerr := o.gz.Close(); err == nil {
+			err = gerr
+		}
+	}
+	if cerr := o.w.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && o.unreadable > 0 {
+		err = fmt.Errorf("%d files could not be read and are missing from the archive (first: %v)", o.unreadable, o.firstErr)
+	}
+	return err
+}
+
+// tarMode converts mode to the permission and special bits of a tar header.
+func tarMode(mode os.FileMode) int64 {
+	m := int64(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= 01000
+	}
+	return m
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
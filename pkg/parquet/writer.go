@@ -0,0 +1,296 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+type ColumnType int
+
+const (
+	String ColumnType = iota
+	Int64
+	Timestamp
+)
+
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Parquet enum values used by the writer.
+const (
+	typeInt64     = 2
+	typeByteArray = 6
+
+	repetitionRequired = 0
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	codecGzip = 2
+
+	pageData = 0
+)
+
+const (
+	magic = "PAR1"
+	// DefaultRowGroupSize bounds how many rows are buffered in memory before
+	// a row group is written out.
+	DefaultRowGroupSize = 128 * 1024
+)
+
+// Writer streams rows into a Parquet file with all columns required,
+// PLAIN-encoded and GZIP-compressed, one data page per column per row group.
+type Writer struct {
+	w            io.Writer
+	columns      []Column
+	buffers      []bytes.Buffer
+	rows         int64
+	totalRows    int64
+	offset       int64
+	rowGroups    []rowGroup
+	RowGroupSize int64
+	closed       bool
+}
+
+type columnChunk struct {
+	offset           int64
+	numValues        int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+type rowGroup struct {
+	columns   []columnChunk
+	numRows   int64
+	totalSize int64
+}
+
+func NewWriter(w io.Writer, columns []Column) (*Writer, error) {
+	if len(columns) == 0 {
+		return nil, errors.New("parquet: no columns")
+	}
+	if _, err := io.WriteString(w, magic); err != nil {
+		return nil, err
+	}
+	return &Writer{
+		w:            w,
+		columns:      columns,
+		buffers:      make([]bytes.Buffer, len(columns)),
+		offset:       int64(len(magic)),
+		RowGroupSize: DefaultRowGroupSize,
+	}, nil
+}
+
+// WriteRow appends one row. Values must match the column types: string for
+// String, int64 for Int64 and time.Time for Timestamp.
+func (w *Writer) WriteRow(values ...any) error {
+	if len(values) != len(w.columns) {
+		return fmt.Errorf("parquet: got %d values for %d columns", len(values), len(w.columns))
+	}
+
+	// Check every value before buffering any, so a bad row can't leave the
+	// column buffers with different lengths.
+	for i, v := range values {
+		var ok bool
+		switch w.columns[i].Type {
+		case String:
+			_, ok = v.(string)
+		case Int64:
+			_, ok = v.(int64)
+		case Timestamp:
+			_, ok = v.(time.Time)
+		}
+		if !ok {
+			return fmt.Errorf("parquet: unexpected %T for column %s", v, w.columns[i].Name)
+		}
+	}
+
+	var tmp [8]byte
+	for i, v := range values {
+		buf := &w.buffers[i]
+		switch v := v.(type) {
+		case string:
+			binary.LittleEndian.PutUint32(tmp[:4], uint32(len(v)))
+			buf.Write(tmp[:4])
+			buf.WriteString(v)
+		case int64:
+			binary.LittleEndian.PutUint64(tmp[:], uint64(v))
+			buf.Write(tmp[:])
+		case time.Time:
+			binary.LittleEndian.PutUint64(tmp[:], uint64(v.UnixMilli()))
+			buf.Write(tmp[:])
+		}
+	}
+
+	w.rows++
+	if w.rows >= w.RowGroupSize {
+		return w.flushRowGroup()
+	}
+	return nil
+}
+
+func (w *Writer) flushRowGroup() error {
+	if w.rows == 0 {
+		return nil
+	}
+
+	group := rowGroup{numRows: w.rows}
+	for i := range w.columns {
+		raw := w.buffers[i].Bytes()
+
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		if _, err := zw.Write(raw); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+
+		header := pageHeader(len(raw), compressed.Len(), w.rows)
+		chunk := columnChunk{
+			offset:           w.offset,
+			numValues:        w.rows,
+			uncompressedSize: int64(len(header) + len(raw)),
+			compressedSize:   int64(len(header) + compressed.Len()),
+		}
+		if err := w.write(header); err != nil {
+			return err
+		}
+		if err := w.write(compressed.Bytes()); err != nil {
+			return err
+		}
+
+		group.columns = append(group.columns, chunk)
+		group.totalSize += chunk.uncompressedSize
+		w.buffers[i].Reset()
+	}
+
+	w.rowGroups = append(w.rowGroups, group)
+	w.totalRows += w.rows
+	w.rows = 0
+	return nil
+}
+
+// Close flushes buffered rows and writes the footer. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if err := w.flushRowGroup(); err != nil {
+		return err
+	}
+
+	footer := w.fileMetaData()
+	var tail [4]byte
+	binary.LittleEndian.PutUint32(tail[:], uint32(len(footer)))
+	if err := w.write(footer); err != nil {
+		return err
+	}
+	if err := w.write(tail[:]); err != nil {
+		return err
+	}
+	return w.write([]byte(magic))
+}
+
+func (w *Writer) write(p []byte) error {
+	n, err := w.w.Write(p)
+	w.offset += int64(n)
+	return err
+}
+
+func pageHeader(uncompressed, compressed int, numValues int64) []byte {
+	var c compactWriter
+	c.beginStruct(0)
+	c.i32(1, pageData)
+	c.i32(2, int32(uncompressed))
+	c.i32(3, int32(compressed))
+	c.beginStruct(5)
+	c.i32(1, int32(numValues))
+	c.i32(2, encodingPlain)
+	c.i32(3, encodingRLE)
+	c.i32(4, encodingRLE)
+	c.endStruct()
+	c.endStruct()
+	return c.buf.Bytes()
+}
+
+func (w *Writer) fileMetaData() []byte {
+	var c compactWriter
+	c.beginStruct(0)
+	c.i32(1, 1)
+
+	c.listHeader(2, tStruct, len(w.columns)+1)
+	c.beginStruct(0)
+	c.str(4, "schema")
+	c.i32(5, int32(len(w.columns)))
+	c.endStruct()
+	for _, col := range w.columns {
+		c.beginStruct(0)
+		switch col.Type {
+		case String:
+			c.i32(1, typeByteArray)
+			c.i32(3, repetitionRequired)
+			c.str(4, col.Name)
+			c.i32(6, convertedUTF8)
+		case Int64:
+			c.i32(1, typeInt64)
+			c.i32(3, repetitionRequired)
+			c.str(4, col.Name)
+		case Timestamp:
+			c.i32(1, typeInt64)
+			c.i32(3, repetitionRequired)
+			c.str(4, col.Name)
+			c.i32(6, convertedTimestampMillis)
+		}
+		c.endStruct()
+	}
+
+	c.i64(3, w.totalRows)
+
+	c.listHeader(4, tStruct, len(w.rowGroups))
+	for _, group := range w.rowGroups {
+		c.beginStruct(0)
+		c.listHeader(1, tStruct, len(group.columns))
+		for i, chunk := range group.columns {
+			col := w.columns[i]
+			c.beginStruct(0)
+			c.i64(2, chunk.offset)
+			c.beginStruct(3)
+			if col.Type == String {
+				c.i32(1, typeByteArray)
+			} else {
+				c.i32(1, typeInt64)
+			}
+			c.i32List(2, []int32{encodingPlain, encodingRLE})
+			c.strList(3, []string{col.Name})
+			c.i32(4, codecGzip)
+			c.i64(5, chunk.numValues)
+			c.i64(6, chunk.uncompressedSize)
+			c.i64(7, chunk.compressedSize)
+			c.i64(9, chunk.offset)
+			c.endStruct()
+			c.endStruct()
+		}
+		c.i64(2, group.totalSize)
+		c.i64(3, group.numRows)
+		c.endStruct()
+	}
+
+	c.str(6, "file-counter")
+	c.endStruct()
+	return c.buf.Bytes()
+}
@@ -0,0 +1,67 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestCompactWriter(t *testing.T) {
+	var c compactWriter
+	c.beginStruct(0)
+	c.i32(1, 1)
+	c.i64(20, -1)
+	c.str(21, "ab")
+	c.endStruct()
+
+	expected := []byte{
+		0x15, 0x02, // field 1, i32, zigzag(1)
+		0x06, 0x28, 0x01, // field 20 (long form), i64, zigzag(-1)
+		0x18, 0x02, 'a', 'b', // field 21, binary
+		0x00, // stop
+	}
+	if !bytes.Equal(c.buf.Bytes(), expected) {
+		t.Errorf("Encoded % x, expected % x", c.buf.Bytes(), expected)
+	}
+}
+
+func TestWriterLayout(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, []Column{
+		{Name: "path", Type: String},
+		{Name: "size", Type: Int64},
+		{Name: "mtime", Type: Timestamp},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.RowGroupSize = 2
+
+	for i := 0; i < 5; i++ {
+		if err := w.WriteRow("/a", int64(i), time.Unix(0, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.WriteRow("/b", "not a size", time.Unix(0, 0)); err == nil {
+		t.Error("Expected a type error for a non-int64 size")
+	}
+	if got := w.buffers[0].Len(); got != 4+len("/a") {
+		t.Errorf("A rejected row left partial column data behind (%d bytes buffered)", got)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	if string(data[:4]) != magic || string(data[len(data)-4:]) != magic {
+		t.Fatal("File is missing the PAR1 magic")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if footerLen <= 0 || footerLen > len(data)-12 {
+		t.Fatalf("Invalid footer length %d", footerLen)
+	}
+	if len(w.rowGroups) != 3 || w.totalRows != 5 {
+		t.Errorf("Expected 3 row groups and 5 rows, got %d and %d", len(w.rowGroups), w.totalRows)
+	}
+}
@@ -0,0 +1,244 @@
+// Package progress persists the live counters of running scans, with a
+// rolling history of recent samples, so a UI that connects or reconnects
+// in the middle of a scan can show where it stands and how fast it has
+// been going straight away.
+//
+// Each scan writes one small JSON file under the user cache directory,
+// replaced atomically on every progress tick.
+package progress
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"file-counter/pkg/scanner"
+)
+
+// HistorySize is how many samples a state keeps; at the default progress
+// interval of one second, the last five minutes.
+const HistorySize = 300
+
+// Keep is how long the state of a finished scan stays around.
+const Keep = time.Hour
+
+// staleAfter is how long a running scan may go without an update before
+// it is reported as abandoned: its process was killed or the machine went
+// down.
+const staleAfter = 30 * time.Second
+
+// Scan statuses.
+const (
+	Running   = "running"
+	Completed = "completed"
+	Stopped   = "stopped"   // interrupted or timed out, with partial totals
+	Abandoned = "abandoned" // stopped updating without finishing
+)
+
+// Sample is the running totals at one moment.
+type Sample struct {
+	At    time.Time `json:"at"`
+	Files int64     `json:"files"`
+	Dirs  int64     `json:"dirs"`
+	Bytes int64     `json:"bytes"`
+}
+
+// State is the progress of one scan. EstimatedItems is the expected number
+// of files and directories, when known.
+type State struct {
+	ID             string    `json:"id"`
+	Root           string    `json:"root"`
+	PID            int       `json:"pid"`
+	Status         string    `json:"status"`
+	StartedAt      time.Time `json:"started_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Files          int64     `json:"files"`
+	Dirs           int64     `json:"dirs"`
+	Errors         int64     `json:"errors"`
+	Skipped        int64     `json:"skipped"`
+	Bytes          int64     `json:"bytes"`
+	CurrentPath    string    `json:"current_path,omitempty"`
+	EstimatedItems int64     `json:"estimated_items,omitempty"`
+	// FilesPerSecond is the rate over the last minute of samples.
+	FilesPerSecond float64  `json:"files_per_second"`
+	History        []Sample `json:"history"`
+}
+
+// Dir is where progress states are kept.
+func Dir() (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cache, "file-counter", "progress"), nil
+}
+
+// ID names the state of scans of root; a new scan of the same root
+// replaces the previous state.
+func ID(root string) string {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		abs = root
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Recorder keeps the state of one scan up to date. Its methods may be
+// called from the scanner's progress goroutine.
+type Recorder struct {
+	name string
+
+	mu    sync.Mutex
+	state State
+}
+
+// NewRecorder starts recording a scan of root. est may be nil.
+func NewRecorder(root string, est *scanner.Estimate) (*Recorder, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	abs, _ := filepath.Abs(root)
+	now := time.Now()
+	r := &Recorder{
+		name: filepath.Join(dir, ID(root)+".json"),
+		state: State{
+			ID: ID(root), Root: abs, PID: os.Getpid(), Status: Running,
+			StartedAt: now, UpdatedAt: now, History: []Sample{},
+		},
+	}
+	if est != nil {
+		r.state.EstimatedItems = est.Items
+	}
+	return r, r.save()
+}
+
+// Update records the running totals; it fits scanner.Options.OnProgress.
+func (r *Recorder) Update(st scanner.Stats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record(st.Files, st.Dirs, st.Errors, st.Skipped, st.Bytes)
+	r.state.CurrentPath = st.CurrentPath
+	r.save()
+}
+
+// Finish records the final totals of the scan.
+func (r *Recorder) Finish(result *scanner.ScanResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record(result.TotalFiles, result.TotalDirs, result.TotalErrors, result.TotalSkipped, result.TotalBytes)
+	r.state.Status, r.state.CurrentPath = Stopped, ""
+	if result.Completed {
+		r.state.Status = Completed
+	}
+	r.save()
+}
+
+func (r *Recorder) record(files, dirs, errs, skipped, bytes int64) {
+	s := &r.state
+	s.UpdatedAt = time.Now()
+	s.Files, s.Dirs, s.Errors, s.Skipped, s.Bytes = files, dirs, errs, skipped, bytes
+	s.History = append(s.History, Sample{At: s.UpdatedAt, Files: files, Dirs: dirs, Bytes: bytes})
+	if len(s.History) > HistorySize {
+		s.History = append(s.History[:0], s.History[len(s.History)-HistorySize:]...)
+	}
+	s.FilesPerSecond = rate(s.History, time.Minute)
+}
+
+// rate is the files per second over the samples of the last window.
+func rate(history []Sample, window time.Duration) float64 {
+	if len(history) < 2 {
+		return 0
+	}
+	last := history[len(history)-1]
+	first := history[0]
+	for _, h := range history {
+		if last.At.Sub(h.At) <= window {
+			first = h
+			break
+		}
+	}
+	secs := last.At.Sub(first.At).Seconds()
+	if secs <= 0 {
+		return 0
+	}
+	return float64(last.Files-first.Files) / secs
+}
+
+// save writes the state; failures are ignored, as the next tick retries.
+func (r *Recorder) save() error {
+	data, err := json.Marshal(&r.state)
+	if err != nil {
+		return err
+	}
+	tmp := r.name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.name)
+}
+
+// Load reads the state with the given id.
+func Load(id string) (*State, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return nil, errors.New("invalid progress id")
+	}
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	return load(filepath.Join(dir, id+".json"))
+}
+
+func load(name string) (*State, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if s.Status == Running && time.Since(s.UpdatedAt) > staleAfter {
+		s.Status = Abandoned
+	}
+	return &s, nil
+}
+
+// All returns the states of running scans and of scans that finished in
+// the last Keep, newest first. Older states are removed.
+func All() ([]*State, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	states := []*State{}
+	for _, name := range names {
+		s, err := load(name)
+		if err != nil {
+			continue
+		}
+		if s.Status != Running && time.Since(s.UpdatedAt) > Keep {
+			os.Remove(name)
+			continue
+		}
+		states = append(states, s)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].StartedAt.After(states[j].StartedAt) })
+	return states, nil
+}
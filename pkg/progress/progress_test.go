@@ -0,0 +1,64 @@
+package progress
+
+import (
+	"testing"
+	"time"
+
+	"file-counter/pkg/scanner"
+)
+
+func TestRecorder(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	root := t.TempDir()
+
+	r, err := NewRecorder(root, &scanner.Estimate{Items: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= HistorySize+10; i++ {
+		r.Update(scanner.Stats{Files: i * 10, Dirs: i, Bytes: i * 100, CurrentPath: "/x"})
+	}
+
+	st, err := Load(ID(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Status != Running || st.Files != (HistorySize+10)*10 || st.EstimatedItems != 500 || st.CurrentPath != "/x" {
+		t.Errorf("Got state %+v", st)
+	}
+	if len(st.History) != HistorySize || st.History[0].Files != 110 {
+		t.Errorf("Expected the last %d samples, got %d starting at %+v", HistorySize, len(st.History), st.History[0])
+	}
+
+	r.Finish(&scanner.ScanResult{TotalFiles: 5000, Completed: true})
+	states, err := All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || states[0].Status != Completed || states[0].Files != 5000 || states[0].CurrentPath != "" {
+		t.Errorf("Got states %+v", states)
+	}
+
+	if _, err := Load("../etc"); err == nil {
+		t.Error("Expected an invalid id to be rejected")
+	}
+}
+
+func TestRate(t *testing.T) {
+	start := time.Now()
+	var history []Sample
+	for i := 0; i <= 120; i++ {
+		files := int64(i * 10)
+		if i > 60 {
+			files = 600 + int64(i-60)*100
+		}
+		history = append(history, Sample{At: start.Add(time.Duration(i) * time.Second), Files: files})
+	}
+	if got := rate(history, time.Minute); got != 100 {
+		t.Errorf("Got a rate of %v over the last minute, expected 100", got)
+	}
+	if got := rate(history[:1], time.Minute); got != 0 {
+		t.Errorf("Got a rate of %v from one sample", got)
+	}
+}
@@ -0,0 +1,27 @@
+package query
+
+import (
+	"os"
+	"strings"
+)
+
+// extension and fileType match the sqlite output's columns.
+func extension(name string) string {
+	i := strings.LastIndexByte(name, '.')
+	if i <= 0 || i == len(name)-1 {
+		return ""
+	}
+	return strings.ToLower(name[i+1:])
+}
+
+func fileType(mode os.FileMode) string {
+	switch {
+	case mode.IsDir():
+		return "dir"
+	case mode.IsRegular():
+		return "file"
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	}
+	return "other"
+}
@@ -0,0 +1,89 @@
+package query
+
+import (
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"file-counter/pkg/scanner"
+)
+
+// RecordColumns are the columns of RecordRow: those of the files table,
+// plus the owner's numeric ids and the content hash.
+var RecordColumns = append(FileColumns[:len(FileColumns):len(FileColumns)], "uid", "gid", "hash")
+
+// RecordRow returns an entry found by a scan as a row of RecordColumns.
+// Directories are included, with type 'dir'; uid and gid are NULL where the
+// platform has no numeric owners, and hash is NULL unless it was computed.
+func RecordRow(rec *scanner.FileRecord) []any {
+	name := filepath.Base(rec.Path)
+	var uid, gid, hash any
+	if rec.HasOwner {
+		uid, gid = int64(rec.UID), int64(rec.GID)
+	}
+	if rec.Hash != "" {
+		hash = rec.Hash
+	}
+	return []any{rec.Path, filepath.Dir(rec.Path), name, extension(name), fileType(rec.Mode), rec.Size,
+		rec.ModTime.Unix(), int64(uint32(rec.Mode)), uid, gid, hash}
+}
+
+// Filter is a WHERE condition on its own, for picking rows as they stream
+// past rather than out of a table. It is not safe for concurrent use.
+type Filter struct {
+	r *runner
+}
+
+// ParseFilter parses cond, the condition of a WHERE clause, over rows with
+// the given columns. Size literals are expanded as in Run; aggregates are
+// not allowed.
+func ParseFilter(cond string, columns []string) (*Filter, error) {
+	toks, err := lex(ExpandUnits(cond))
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks, stmt: &statement{limit: -1}}
+	where, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("unexpected input")
+	}
+	p.stmt.where = where
+	r := &runner{stmt: p.stmt, table: &Table{Columns: columns}, likes: map[string]*regexp.Regexp{}, now: time.Now().Unix()}
+	if err := r.bind(); err != nil {
+		return nil, err
+	}
+	return &Filter{r: r}, nil
+}
+
+// Match reports whether row, in the order of the filter's columns, meets
+// the condition. As in SQL, a condition that comes out NULL does not.
+func (f *Filter) Match(row []any) (bool, error) {
+	return f.r.match(row)
+}
+
+// Uses reports whether the condition refers to the named column, so that
+// callers can skip computing columns it doesn't need.
+func (f *Filter) Uses(name string) bool {
+	var uses func(e expr) bool
+	uses = func(e expr) bool {
+		switch e := e.(type) {
+		case *column:
+			return e.name == name
+		case *unary:
+			return uses(e.e)
+		case *binary:
+			return uses(e.l) || uses(e.r)
+		case *call:
+			for _, a := range e.args {
+				if uses(a) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return uses(f.r.stmt.where)
+}
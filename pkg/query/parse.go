@@ -0,0 +1,608 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// lex splits a statement into tokens. Keywords are returned as identifiers
+// and matched case-insensitively by the parser.
+func lex(sql string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(sql); j++ {
+				if sql[j] == '\'' {
+					if j+1 < len(sql) && sql[j+1] == '\'' {
+						sb.WriteByte('\'')
+						j++
+						continue
+					}
+					break
+				}
+				sb.WriteByte(sql[j])
+			}
+			if j >= len(sql) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			toks = append(toks, token{tokString, sb.String()})
+			i = j + 1
+		case c == '"':
+			j := strings.IndexByte(sql[i+1:], '"')
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated identifier at offset %d", i)
+			}
+			toks = append(toks, token{tokIdent, sql[i+1 : i+1+j]})
+			i += j + 2
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(sql) && sql[i+1] >= '0' && sql[i+1] <= '9':
+			j := i
+			for j < len(sql) && (sql[j] >= '0' && sql[j] <= '9' || sql[j] == '.') {
+				j++
+			}
+			toks = append(toks, token{tokNumber, sql[i:j]})
+			i = j
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(sql) && (sql[j] == '_' || sql[j] >= '0' && sql[j] <= '9' || unicode.IsLetter(rune(sql[j]))) {
+				j++
+			}
+			toks = append(toks, token{tokIdent, sql[i:j]})
+			i = j
+		default:
+			op := string(c)
+			if i+1 < len(sql) {
+				switch two := sql[i : i+2]; two {
+				case "<=", ">=", "<>", "!=", "==", "||":
+					op = two
+				}
+			}
+			if !strings.Contains("=<>!+-*/%(),;|", op[:1]) {
+				return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+			}
+			toks = append(toks, token{tokOp, op})
+			i += len(op)
+		}
+	}
+	return append(toks, token{kind: tokEOF}), nil
+}
+
+// unitPattern matches size literals such as 100MB or 1.5G.
+var unitPattern = regexp.MustCompile(`(?i)\b(\d+(?:\.\d+)?)\s*(k|m|g|t)(i?b)?\b`)
+
+var unitShift = map[byte]uint{'k': 10, 'm': 20, 'g': 30, 't': 40}
+
+// ExpandUnits rewrites size literals such as 100MB, 4k or 1.5GiB outside
+// quotes into byte counts (powers of 1024, like the scan report), so the
+// same statement works here and in sqlite3.
+func ExpandUnits(sql string) string {
+	var out strings.Builder
+	for len(sql) > 0 {
+		q := strings.IndexAny(sql, `'"`)
+		if q < 0 {
+			q = len(sql)
+		}
+		out.WriteString(unitPattern.ReplaceAllStringFunc(sql[:q], func(m string) string {
+			sub := unitPattern.FindStringSubmatch(m)
+			n, _ := strconv.ParseFloat(sub[1], 64)
+			return strconv.FormatInt(int64(n*float64(int64(1)<<unitShift[strings.ToLower(sub[2])[0]])), 10)
+		}))
+		sql = sql[q:]
+		if len(sql) == 0 {
+			break
+		}
+		end := strings.IndexByte(sql[1:], sql[0])
+		if end < 0 {
+			out.WriteString(sql)
+			break
+		}
+		out.WriteString(sql[:end+2])
+		sql = sql[end+2:]
+	}
+	return out.String()
+}
+
+type expr interface{}
+
+type literal struct{ v any }
+
+// column is a table column, or with alias set, a reference to an output
+// column by its AS name.
+type column struct {
+	name  string
+	idx   int
+	alias expr
+}
+
+type unary struct {
+	op string
+	e  expr
+}
+
+type binary struct {
+	op   string
+	l, r expr
+}
+
+// call is a function call. Aggregates get a slot in the group state.
+type call struct {
+	name string
+	args []expr
+	star bool
+	agg  bool
+	slot int
+}
+
+type selectItem struct {
+	e     expr
+	label string
+	star  bool
+}
+
+type orderItem struct {
+	e    expr
+	desc bool
+}
+
+type statement struct {
+	items   []selectItem
+	from    string
+	where   expr
+	groupBy []expr
+	having  expr
+	orderBy []orderItem
+	limit   int
+	aggs    []*call
+}
+
+var aggregates = map[string]bool{"count": true, "sum": true, "avg": true, "min": true, "max": true, "total": true}
+
+type parser struct {
+	toks []token
+	pos  int
+	stmt *statement
+	// inAgg is set while parsing aggregate arguments, which may not nest.
+	inAgg     bool
+	allowAggs bool
+}
+
+// parse reads a single SELECT statement.
+func parse(sql string) (*statement, error) {
+	toks, err := lex(sql)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks, stmt: &statement{limit: -1}}
+	if err := p.statement(); err != nil {
+		return nil, err
+	}
+	return p.stmt, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// keyword consumes the given keywords if they come next.
+func (p *parser) keyword(words ...string) bool {
+	for i, w := range words {
+		t := p.toks[min(p.pos+i, len(p.toks)-1)]
+		if t.kind != tokIdent || !strings.EqualFold(t.text, w) {
+			return false
+		}
+	}
+	p.pos += len(words)
+	return true
+}
+
+func (p *parser) op(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp {
+		return "", false
+	}
+	for _, o := range ops {
+		if t.text == o {
+			p.pos++
+			return o, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(op string) error {
+	if _, ok := p.op(op); !ok {
+		return p.errorf("expected %q", op)
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	near := p.peek().text
+	if p.peek().kind == tokEOF {
+		near = "end of query"
+	}
+	return fmt.Errorf("%s near %q", fmt.Sprintf(format, args...), near)
+}
+
+func (p *parser) statement() error {
+	s := p.stmt
+	if !p.keyword("select") {
+		return p.errorf("expected SELECT")
+	}
+	p.allowAggs = true
+	for {
+		if _, ok := p.op("*"); ok {
+			s.items = append(s.items, selectItem{star: true, label: "*"})
+		} else {
+			start := p.pos
+			e, err := p.expr()
+			if err != nil {
+				return err
+			}
+			item := selectItem{e: e, label: p.text(start, p.pos)}
+			if p.keyword("as") {
+				t := p.next()
+				if t.kind != tokIdent && t.kind != tokString {
+					return p.errorf("expected a column alias")
+				}
+				item.label = t.text
+			}
+			s.items = append(s.items, item)
+		}
+		if _, ok := p.op(","); !ok {
+			break
+		}
+	}
+
+	if !p.keyword("from") {
+		return p.errorf("expected FROM")
+	}
+	t := p.next()
+	if t.kind != tokIdent {
+		return p.errorf("expected a table name")
+	}
+	s.from = strings.ToLower(t.text)
+
+	var err error
+	if p.keyword("where") {
+		p.allowAggs = false
+		if s.where, err = p.expr(); err != nil {
+			return err
+		}
+	}
+	if p.keyword("group", "by") {
+		p.allowAggs = false
+		for {
+			e, err := p.expr()
+			if err != nil {
+				return err
+			}
+			s.groupBy = append(s.groupBy, e)
+			if _, ok := p.op(","); !ok {
+				break
+			}
+		}
+	}
+	p.allowAggs = true
+	if p.keyword("having") {
+		if s.having, err = p.expr(); err != nil {
+			return err
+		}
+	}
+	if p.keyword("order", "by") {
+		for {
+			e, err := p.expr()
+			if err != nil {
+				return err
+			}
+			item := orderItem{e: e}
+			if p.keyword("desc") {
+				item.desc = true
+			} else {
+				p.keyword("asc")
+			}
+			s.orderBy = append(s.orderBy, item)
+			if _, ok := p.op(","); !ok {
+				break
+			}
+		}
+	}
+	if p.keyword("limit") {
+		t := p.next()
+		n, err := strconv.Atoi(t.text)
+		if t.kind != tokNumber || err != nil {
+			return p.errorf("expected a row count")
+		}
+		s.limit = n
+	}
+	p.op(";")
+	if p.peek().kind != tokEOF {
+		return p.errorf("unexpected input")
+	}
+	return nil
+}
+
+// text reconstructs the source of tokens [from, to) for column labels.
+func (p *parser) text(from, to int) string {
+	var sb strings.Builder
+	for i := from; i < to; i++ {
+		t := p.toks[i]
+		if i > from && t.kind != tokOp && p.toks[i-1].kind != tokOp {
+			sb.WriteByte(' ')
+		}
+		if t.kind == tokString {
+			sb.WriteString("'" + strings.ReplaceAll(t.text, "'", "''") + "'")
+		} else {
+			sb.WriteString(t.text)
+		}
+	}
+	return sb.String()
+}
+
+// Precedence, loosest first: OR, AND, NOT, comparison, ||, + -, * / %.
+func (p *parser) expr() (expr, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l = &binary{"or", l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) and() (expr, error) {
+	l, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		r, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l = &binary{"and", l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) not() (expr, error) {
+	if p.keyword("not") {
+		e, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{"not", e}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (expr, error) {
+	l, err := p.concat()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if op, ok := p.op("=", "==", "!=", "<>", "<", "<=", ">", ">="); ok {
+			r, err := p.concat()
+			if err != nil {
+				return nil, err
+			}
+			l = &binary{op, l, r}
+			continue
+		}
+		negate := p.keyword("not")
+		var op string
+		switch {
+		case p.keyword("like"):
+			op = "like"
+		case p.keyword("glob"):
+			op = "glob"
+		case p.keyword("is", "not", "null"):
+			return &unary{"notnull", l}, nil
+		case p.keyword("is", "null"):
+			return &unary{"isnull", l}, nil
+		case negate:
+			return nil, p.errorf("expected LIKE or GLOB after NOT")
+		default:
+			return l, nil
+		}
+		r, err := p.concat()
+		if err != nil {
+			return nil, err
+		}
+		l = &binary{op, l, r}
+		if negate {
+			l = &unary{"not", l}
+		}
+	}
+}
+
+func (p *parser) concat() (expr, error) {
+	l, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.op("||"); !ok {
+			return l, nil
+		}
+		r, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		l = &binary{"||", l, r}
+	}
+}
+
+func (p *parser) additive() (expr, error) {
+	l, err := p.multiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.op("+", "-")
+		if !ok {
+			return l, nil
+		}
+		r, err := p.multiplicative()
+		if err != nil {
+			return nil, err
+		}
+		l = &binary{op, l, r}
+	}
+}
+
+func (p *parser) multiplicative() (expr, error) {
+	l, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.op("*", "/", "%")
+		if !ok {
+			return l, nil
+		}
+		r, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		l = &binary{op, l, r}
+	}
+}
+
+func (p *parser) primary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		if n, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return &literal{n}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t.text)
+		}
+		return &literal{f}, nil
+	case tokString:
+		return &literal{t.text}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expect(")")
+		case "-":
+			e, err := p.primary()
+			if err != nil {
+				return nil, err
+			}
+			return &unary{"-", e}, nil
+		}
+	case tokIdent:
+		if strings.EqualFold(t.text, "null") {
+			return &literal{nil}, nil
+		}
+		if _, ok := p.op("("); !ok {
+			return &column{name: strings.ToLower(t.text), idx: -1}, nil
+		}
+		return p.call(strings.ToLower(t.text))
+	}
+	p.pos--
+	return nil, p.errorf("expected an expression")
+}
+
+func (p *parser) call(name string) (expr, error) {
+	c := &call{name: name, agg: aggregates[name]}
+	if c.agg {
+		if !p.allowAggs || p.inAgg {
+			return nil, fmt.Errorf("aggregate %s() is not allowed here", name)
+		}
+		p.inAgg = true
+		defer func() { p.inAgg = false }()
+	}
+	if _, ok := p.op(")"); ok {
+		return c, c.checkArgs()
+	}
+	if _, ok := p.op("*"); ok {
+		if name != "count" {
+			return nil, fmt.Errorf("%s(*) is not supported", name)
+		}
+		c.star = true
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		c.slot = len(p.stmt.aggs)
+		p.stmt.aggs = append(p.stmt.aggs, c)
+		return c, nil
+	}
+	for {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, e)
+		if _, ok := p.op(","); !ok {
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if c.agg {
+		c.slot = len(p.stmt.aggs)
+		p.stmt.aggs = append(p.stmt.aggs, c)
+	}
+	return c, c.checkArgs()
+}
+
+// scalars maps the supported scalar functions to their argument count.
+var scalars = map[string]int{"lower": 1, "upper": 1, "length": 1, "abs": 1, "human": 1, "now": 0}
+
+func (c *call) checkArgs() error {
+	want, ok := scalars[c.name]
+	if c.agg {
+		want, ok = 1, true
+	}
+	if !ok {
+		return fmt.Errorf("unknown function %s()", c.name)
+	}
+	if !c.star && len(c.args) != want {
+		return fmt.Errorf("%s() takes %d argument(s)", c.name, want)
+	}
+	return nil
+}
@@ -0,0 +1,791 @@
+// Package query runs a small subset of SQL SELECT over stored scan data,
+// so ad-hoc questions can be answered without loading it into a database:
+//
+//	SELECT ext, count(*), sum(size) FROM files WHERE size > 100MB
+//	GROUP BY ext ORDER BY 3 DESC LIMIT 10
+//
+// WHERE, GROUP BY, HAVING, ORDER BY (by expression, alias or position) and
+// LIMIT are supported, with the count, sum, total, avg, min and max
+// aggregates, the scalar functions lower, upper, length, abs, now and
+// human (a byte count as "1.5 GB"), LIKE, GLOB and IS [NOT] NULL. Size
+// literals such as 100MB are expanded with ExpandUnits.
+package query
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"file-counter/pkg/index"
+	"file-counter/pkg/scanner"
+)
+
+// Table is a source of rows. Scan calls fn for every row, in column order;
+// fn may keep the slice.
+type Table struct {
+	Columns []string
+	Scan    func(fn func(row []any) error) error
+}
+
+// Result holds the output of a query.
+type Result struct {
+	Columns []string
+	Rows    [][]any
+}
+
+// FileColumns and DirColumns mirror the files and directories tables of
+// the sqlite output.
+var (
+	FileColumns = []string{"path", "dir", "name", "ext", "type", "size", "mtime", "mode"}
+	DirColumns  = []string{"path", "parent", "name", "mtime", "mode"}
+)
+
+// IndexTables exposes an index as the files and directories tables, with
+// absolute paths.
+func IndexTables(ix *index.Index) map[string]*Table {
+	full := func(e *index.Entry) (p, dir, name string) {
+		p = path.Join(ix.Root, e.Path)
+		dir, name = path.Split(p)
+		if dir != "/" {
+			dir = strings.TrimSuffix(dir, "/")
+		}
+		return p, dir, name
+	}
+	return map[string]*Table{
+		"files": {Columns: FileColumns, Scan: func(fn func([]any) error) error {
+			for i := range ix.Entries {
+				e := &ix.Entries[i]
+				if e.IsDir() {
+					continue
+				}
+				p, dir, name := full(e)
+				row := []any{p, dir, name, extension(name), fileType(e.Mode), e.Size, e.ModTime.Unix(), int64(uint32(e.Mode))}
+				if err := fn(row); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		"directories": {Columns: DirColumns, Scan: func(fn func([]any) error) error {
+			for i := range ix.Entries {
+				e := &ix.Entries[i]
+				if !e.IsDir() {
+					continue
+				}
+				p, dir, name := full(e)
+				if err := fn([]any{p, dir, name, e.ModTime.Unix(), int64(uint32(e.Mode))}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+	}
+}
+
+// Run parses and executes sql against tables.
+func Run(sql string, tables map[string]*Table) (*Result, error) {
+	stmt, err := parse(ExpandUnits(sql))
+	if err != nil {
+		return nil, err
+	}
+	t, ok := tables[stmt.from]
+	if !ok {
+		return nil, fmt.Errorf("no such table: %s", stmt.from)
+	}
+	r := &runner{stmt: stmt, table: t, likes: make(map[string]*regexp.Regexp), now: time.Now().Unix()}
+	if err := r.bind(); err != nil {
+		return nil, err
+	}
+	if len(stmt.aggs) > 0 || len(stmt.groupBy) > 0 {
+		err = r.grouped()
+	} else {
+		err = r.plain()
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.sort()
+	if stmt.limit >= 0 && len(r.out) > stmt.limit {
+		r.out = r.out[:stmt.limit]
+	}
+
+	res := &Result{Rows: make([][]any, len(r.out))}
+	for _, item := range r.items {
+		res.Columns = append(res.Columns, item.label)
+	}
+	for i, o := range r.out {
+		res.Rows[i] = o.values
+	}
+	return res, nil
+}
+
+type outRow struct {
+	values []any
+	keys   []any
+}
+
+type runner struct {
+	stmt  *statement
+	table *Table
+	items []selectItem
+	likes map[string]*regexp.Regexp
+	now   int64
+	out   []outRow
+	// order holds, per ORDER BY term, the output column it refers to or -1
+	// to evaluate the expression.
+	order []int
+}
+
+// bind resolves column names, expands * and matches ORDER BY terms to
+// output columns by alias or position.
+func (r *runner) bind() error {
+	for _, item := range r.stmt.items {
+		if !item.star {
+			r.items = append(r.items, item)
+			continue
+		}
+		for i, name := range r.table.Columns {
+			r.items = append(r.items, selectItem{e: &column{name: name, idx: i}, label: name})
+		}
+	}
+	for _, o := range r.stmt.orderBy {
+		ref := -1
+		if l, ok := o.e.(*literal); ok {
+			if n, ok := l.v.(int64); ok && n >= 1 && int(n) <= len(r.items) {
+				ref = int(n) - 1
+			}
+		}
+		if c, ok := o.e.(*column); ok && r.columnIndex(c.name) < 0 {
+			for i, item := range r.items {
+				if strings.EqualFold(item.label, c.name) {
+					ref = i
+				}
+			}
+		}
+		r.order = append(r.order, ref)
+	}
+
+	// Aliases may be used outside the select list, but only HAVING and
+	// ORDER BY may refer to an aggregate through one.
+	var err error
+	aliases, aggAliases := false, false
+	var resolve func(e expr)
+	resolve = func(e expr) {
+		switch e := e.(type) {
+		case *column:
+			if e.idx = r.columnIndex(e.name); e.idx >= 0 {
+				return
+			}
+			for _, item := range r.items {
+				if _, self := item.e.(*column); aliases && !self && strings.EqualFold(item.label, e.name) && (aggAliases || !hasAggregate(item.e)) {
+					e.alias = item.e
+					return
+				}
+			}
+			if err == nil {
+				err = fmt.Errorf("no such column: %s", e.name)
+			}
+		case *unary:
+			resolve(e.e)
+		case *binary:
+			resolve(e.l)
+			resolve(e.r)
+		case *call:
+			for _, a := range e.args {
+				resolve(a)
+			}
+		}
+	}
+	for _, item := range r.items {
+		resolve(item.e)
+	}
+	aliases = true
+	resolve(r.stmt.where)
+	for _, g := range r.stmt.groupBy {
+		resolve(g)
+	}
+	aggAliases = true
+	resolve(r.stmt.having)
+	for i, o := range r.stmt.orderBy {
+		if r.order[i] < 0 {
+			resolve(o.e)
+		}
+	}
+	return err
+}
+
+func hasAggregate(e expr) bool {
+	switch e := e.(type) {
+	case *call:
+		if e.agg {
+			return true
+		}
+		for _, a := range e.args {
+			if hasAggregate(a) {
+				return true
+			}
+		}
+	case *unary:
+		return hasAggregate(e.e)
+	case *binary:
+		return hasAggregate(e.l) || hasAggregate(e.r)
+	}
+	return false
+}
+
+func (r *runner) columnIndex(name string) int {
+	for i, c := range r.table.Columns {
+		if c == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *runner) match(row []any) (bool, error) {
+	if r.stmt.where == nil {
+		return true, nil
+	}
+	v, err := r.eval(r.stmt.where, row, nil)
+	return truthy(v), err
+}
+
+// emit evaluates the select list and sort keys for one output row.
+func (r *runner) emit(row []any, accs []accumulator) error {
+	o := outRow{values: make([]any, len(r.items)), keys: make([]any, len(r.order))}
+	for i, item := range r.items {
+		v, err := r.eval(item.e, row, accs)
+		if err != nil {
+			return err
+		}
+		o.values[i] = v
+	}
+	for i, ref := range r.order {
+		if ref >= 0 {
+			o.keys[i] = o.values[ref]
+			continue
+		}
+		v, err := r.eval(r.stmt.orderBy[i].e, row, accs)
+		if err != nil {
+			return err
+		}
+		o.keys[i] = v
+	}
+	r.out = append(r.out, o)
+	return nil
+}
+
+func (r *runner) plain() error {
+	return r.table.Scan(func(row []any) error {
+		ok, err := r.match(row)
+		if err != nil || !ok {
+			return err
+		}
+		return r.emit(row, nil)
+	})
+}
+
+type group struct {
+	first []any
+	accs  []accumulator
+}
+
+// grouped aggregates the matching rows per GROUP BY key. Bare columns take
+// their value from the first row of the group, as in SQLite.
+func (r *runner) grouped() error {
+	groups := make(map[string]*group)
+	var order []string
+	err := r.table.Scan(func(row []any) error {
+		ok, err := r.match(row)
+		if err != nil || !ok {
+			return err
+		}
+		var key strings.Builder
+		for _, g := range r.stmt.groupBy {
+			v, err := r.eval(g, row, nil)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&key, "%T:%v\x00", v, v)
+		}
+		g, ok := groups[key.String()]
+		if !ok {
+			g = &group{first: row, accs: make([]accumulator, len(r.stmt.aggs))}
+			for i, c := range r.stmt.aggs {
+				g.accs[i] = accumulator{fn: c.name}
+			}
+			groups[key.String()] = g
+			order = append(order, key.String())
+		}
+		for i, c := range r.stmt.aggs {
+			var v any = int64(1)
+			if !c.star {
+				if v, err = r.eval(c.args[0], row, nil); err != nil {
+					return err
+				}
+			}
+			g.accs[i].add(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// An aggregate over no rows still produces one row.
+	if len(groups) == 0 && len(r.stmt.groupBy) == 0 {
+		g := &group{first: make([]any, len(r.table.Columns)), accs: make([]accumulator, len(r.stmt.aggs))}
+		for i, c := range r.stmt.aggs {
+			g.accs[i] = accumulator{fn: c.name}
+		}
+		groups[""] = g
+		order = append(order, "")
+	}
+	for _, key := range order {
+		g := groups[key]
+		if r.stmt.having != nil {
+			v, err := r.eval(r.stmt.having, g.first, g.accs)
+			if err != nil {
+				return err
+			}
+			if !truthy(v) {
+				continue
+			}
+		}
+		if err := r.emit(g.first, g.accs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *runner) sort() {
+	if len(r.order) == 0 {
+		return
+	}
+	sort.SliceStable(r.out, func(i, j int) bool {
+		for k, o := range r.stmt.orderBy {
+			c := compare(r.out[i].keys[k], r.out[j].keys[k])
+			if c == 0 {
+				continue
+			}
+			if o.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+func (r *runner) eval(e expr, row []any, accs []accumulator) (any, error) {
+	switch e := e.(type) {
+	case *literal:
+		return e.v, nil
+	case *column:
+		if e.alias != nil {
+			return r.eval(e.alias, row, accs)
+		}
+		return row[e.idx], nil
+	case *call:
+		if e.agg {
+			return accs[e.slot].result(), nil
+		}
+		var arg any
+		if len(e.args) > 0 {
+			var err error
+			if arg, err = r.eval(e.args[0], row, accs); err != nil {
+				return nil, err
+			}
+		}
+		return r.scalar(e.name, arg), nil
+	case *unary:
+		v, err := r.eval(e.e, row, accs)
+		if err != nil {
+			return nil, err
+		}
+		switch e.op {
+		case "not":
+			if v == nil {
+				return nil, nil
+			}
+			return boolean(!truthy(v)), nil
+		case "isnull":
+			return boolean(v == nil), nil
+		case "notnull":
+			return boolean(v != nil), nil
+		case "-":
+			return arith("-", int64(0), v), nil
+		}
+	case *binary:
+		l, err := r.eval(e.l, row, accs)
+		if err != nil {
+			return nil, err
+		}
+		// AND and OR short-circuit.
+		if e.op == "and" && l != nil && !truthy(l) {
+			return int64(0), nil
+		}
+		if e.op == "or" && truthy(l) {
+			return int64(1), nil
+		}
+		rv, err := r.eval(e.r, row, accs)
+		if err != nil {
+			return nil, err
+		}
+		return r.binary(e.op, l, rv)
+	}
+	return nil, fmt.Errorf("cannot evaluate %T", e)
+}
+
+func (r *runner) binary(op string, l, rv any) (any, error) {
+	switch op {
+	case "and":
+		if l == nil || rv == nil {
+			if rv != nil && !truthy(rv) {
+				return int64(0), nil
+			}
+			return nil, nil
+		}
+		return boolean(truthy(rv)), nil
+	case "or":
+		if truthy(rv) {
+			return int64(1), nil
+		}
+		if l == nil || rv == nil {
+			return nil, nil
+		}
+		return int64(0), nil
+	case "||":
+		if l == nil || rv == nil {
+			return nil, nil
+		}
+		return text(l) + text(rv), nil
+	case "like", "glob":
+		if l == nil || rv == nil {
+			return nil, nil
+		}
+		re, err := r.pattern(op, text(rv))
+		if err != nil {
+			return nil, err
+		}
+		return boolean(re.MatchString(text(l))), nil
+	case "+", "-", "*", "/", "%":
+		return arith(op, l, rv), nil
+	}
+	if l == nil || rv == nil {
+		return nil, nil
+	}
+	c := compare(l, rv)
+	switch op {
+	case "=", "==":
+		return boolean(c == 0), nil
+	case "!=", "<>":
+		return boolean(c != 0), nil
+	case "<":
+		return boolean(c < 0), nil
+	case "<=":
+		return boolean(c <= 0), nil
+	case ">":
+		return boolean(c > 0), nil
+	case ">=":
+		return boolean(c >= 0), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", op)
+}
+
+// pattern compiles a LIKE pattern (% and _, ASCII case-insensitive) or a
+// GLOB pattern (*, ? and [...], case-sensitive), caching the result.
+func (r *runner) pattern(op, p string) (*regexp.Regexp, error) {
+	key := op + "\x00" + p
+	if re, ok := r.likes[key]; ok {
+		return re, nil
+	}
+	var sb strings.Builder
+	if op == "like" {
+		sb.WriteString("(?is)^")
+	} else {
+		sb.WriteString("(?s)^")
+	}
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case op == "like" && c == '%', op == "glob" && c == '*':
+			sb.WriteString(".*")
+		case op == "like" && c == '_', op == "glob" && c == '?':
+			sb.WriteString(".")
+		case op == "glob" && c == '[':
+			end := strings.IndexByte(p[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := p[i+1 : i+1+end]
+			if strings.HasPrefix(class, "^") {
+				class = "^" + regexp.QuoteMeta(class[1:])
+			} else {
+				class = regexp.QuoteMeta(class)
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\-`, "-") + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s pattern %q", strings.ToUpper(op), p)
+	}
+	r.likes[key] = re
+	return re, nil
+}
+
+func (r *runner) scalar(name string, v any) any {
+	if name == "now" {
+		return r.now
+	}
+	if v == nil {
+		return nil
+	}
+	switch name {
+	case "lower":
+		return strings.ToLower(text(v))
+	case "upper":
+		return strings.ToUpper(text(v))
+	case "length":
+		return int64(len([]rune(text(v))))
+	case "abs":
+		if n, ok := v.(int64); ok && n < 0 {
+			return -n
+		}
+		if f, ok := number(v).(float64); ok {
+			return math.Abs(f)
+		}
+		return number(v)
+	case "human":
+		n, _ := toFloat(v)
+		return scanner.FormatBytes(int64(n))
+	}
+	return nil
+}
+
+// accumulator folds the values of one aggregate over a group. NULLs are
+// ignored, as in SQL.
+type accumulator struct {
+	fn    string
+	n     int64
+	isum  int64
+	fsum  float64
+	float bool
+	best  any
+}
+
+func (a *accumulator) add(v any) {
+	if v == nil {
+		return
+	}
+	a.n++
+	switch a.fn {
+	case "sum", "avg", "total":
+		switch x := number(v).(type) {
+		case int64:
+			a.isum += x
+		case float64:
+			a.fsum += x
+			a.float = true
+		}
+	case "min":
+		if a.best == nil || compare(v, a.best) < 0 {
+			a.best = v
+		}
+	case "max":
+		if a.best == nil || compare(v, a.best) > 0 {
+			a.best = v
+		}
+	}
+}
+
+func (a *accumulator) result() any {
+	switch a.fn {
+	case "count":
+		return a.n
+	case "sum":
+		if a.n == 0 {
+			return nil
+		}
+		if a.float {
+			return float64(a.isum) + a.fsum
+		}
+		return a.isum
+	case "total":
+		return float64(a.isum) + a.fsum
+	case "avg":
+		if a.n == 0 {
+			return nil
+		}
+		return (float64(a.isum) + a.fsum) / float64(a.n)
+	}
+	return a.best
+}
+
+func boolean(b bool) any {
+	if b {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+func truthy(v any) bool {
+	f, ok := toFloat(v)
+	return ok && f != 0
+}
+
+// number converts strings that look numeric, like SQLite's affinity does
+// for arithmetic; anything else becomes 0.
+func number(v any) any {
+	switch x := v.(type) {
+	case int64, float64:
+		return x
+	case string:
+		if n, err := strconv.ParseInt(strings.TrimSpace(x), 10, 64); err == nil {
+			return n
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(x), 64); err == nil {
+			return f
+		}
+	}
+	return int64(0)
+}
+
+func toFloat(v any) (float64, bool) {
+	switch x := number(v).(type) {
+	case int64:
+		return float64(x), v != nil
+	case float64:
+		return x, true
+	}
+	return 0, false
+}
+
+func arith(op string, l, r any) any {
+	if l == nil || r == nil {
+		return nil
+	}
+	a, b := number(l), number(r)
+	ai, aInt := a.(int64)
+	bi, bInt := b.(int64)
+	if aInt && bInt {
+		switch op {
+		case "+":
+			return ai + bi
+		case "-":
+			return ai - bi
+		case "*":
+			return ai * bi
+		case "/":
+			if bi == 0 {
+				return nil
+			}
+			return ai / bi
+		case "%":
+			if bi == 0 {
+				return nil
+			}
+			return ai % bi
+		}
+	}
+	af, _ := toFloat(a)
+	bf, _ := toFloat(b)
+	switch op {
+	case "+":
+		return af + bf
+	case "-":
+		return af - bf
+	case "*":
+		return af * bf
+	case "/":
+		if bf == 0 {
+			return nil
+		}
+		return af / bf
+	case "%":
+		if bf == 0 {
+			return nil
+		}
+		return math.Mod(af, bf)
+	}
+	return nil
+}
+
+// compare orders values as SQLite does: NULL first, then numbers, then
+// text.
+func compare(a, b any) int {
+	rank := func(v any) int {
+		switch v.(type) {
+		case nil:
+			return 0
+		case int64, float64:
+			return 1
+		}
+		return 2
+	}
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return ra - rb
+	}
+	switch x := a.(type) {
+	case nil:
+		return 0
+	case string:
+		return strings.Compare(x, b.(string))
+	}
+	if ai, ok := a.(int64); ok {
+		if bi, ok := b.(int64); ok {
+			switch {
+			case ai < bi:
+				return -1
+			case ai > bi:
+				return 1
+			}
+			return 0
+		}
+	}
+	af, _ := toFloat(a)
+	bf, _ := toFloat(b)
+	switch {
+	case af < bf:
+		return -1
+	case af > bf:
+		return 1
+	}
+	return 0
+}
+
+func text(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	}
+	return Format(v)
+}
+
+// Format renders a value for display.
+func Format(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case string:
+		return x
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,145 @@
+package query
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"file-counter/pkg/scanner"
+)
+
+func testTables() map[string]*Table {
+	rows := [][]any{
+		{"/srv/a.log", "/srv", "a.log", "log", "file", int64(300 << 20), int64(100), int64(0o644)},
+		{"/srv/b.log", "/srv", "b.log", "log", "file", int64(200 << 20), int64(200), int64(0o644)},
+		{"/srv/c.iso", "/srv", "c.iso", "iso", "file", int64(4 << 30), int64(300), int64(0o644)},
+		{"/srv/notes.txt", "/srv", "notes.txt", "txt", "file", int64(10), int64(400), int64(0o600)},
+		{"/srv/README", "/srv", "README", "", "file", int64(5), int64(500), int64(0o644)},
+	}
+	return map[string]*Table{"files": {Columns: FileColumns, Scan: func(fn func([]any) error) error {
+		for _, row := range rows {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}}}
+}
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		sql     string
+		columns []string
+		rows    [][]any
+	}{
+		{
+			"SELECT ext, sum(size) FROM files WHERE size > 100MB GROUP BY ext ORDER BY ext",
+			[]string{"ext", "sum(size)"},
+			[][]any{{"iso", int64(4 << 30)}, {"log", int64(500 << 20)}},
+		},
+		{
+			"select count(*) as n, max(size) from files where name like '%.LOG' or ext = ''",
+			[]string{"n", "max(size)"},
+			[][]any{{int64(3), int64(300 << 20)}},
+		},
+		{
+			"SELECT name FROM files WHERE NOT name GLOB '*.log' ORDER BY mtime DESC LIMIT 2",
+			[]string{"name"},
+			[][]any{{"README"}, {"notes.txt"}},
+		},
+		{
+			"SELECT ext, count(*) c FROM files GROUP BY ext HAVING count(*) > 1",
+			nil, nil,
+		},
+		{
+			"SELECT ext, count(*) AS c FROM files GROUP BY ext HAVING c > 1 ORDER BY 2 DESC",
+			[]string{"ext", "c"},
+			[][]any{{"log", int64(2)}},
+		},
+		{
+			"SELECT human(sum(size)), avg(mtime) FROM files WHERE size < 1KB",
+			[]string{"human(sum(size))", "avg(mtime)"},
+			[][]any{{"15 B", 450.0}},
+		},
+		{
+			"SELECT sum(size) FROM files WHERE ext = 'none'",
+			[]string{"sum(size)"},
+			[][]any{{nil}},
+		},
+	}
+	for _, tt := range tests {
+		res, err := Run(tt.sql, testTables())
+		if tt.columns == nil {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.sql)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.sql, err)
+			continue
+		}
+		if !reflect.DeepEqual(res.Columns, tt.columns) || !reflect.DeepEqual(res.Rows, tt.rows) {
+			t.Errorf("%s:\ngot  %v %v\nwant %v %v", tt.sql, res.Columns, res.Rows, tt.columns, tt.rows)
+		}
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	for _, sql := range []string{
+		"SELECT nope FROM files",
+		"SELECT * FROM nowhere",
+		"SELECT path FROM files WHERE sum(size) > 1",
+		"SELECT path FROM files WHERE name = 'unterminated",
+		"DELETE FROM files",
+		"SELECT size + 1 AS size2, count(*) AS c FROM files WHERE c > 1",
+	} {
+		if _, err := Run(sql, testTables()); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+}
+
+func TestExpandUnits(t *testing.T) {
+	got := ExpandUnits("size > 100MB AND size < 1.5g AND name = '2MB.txt'")
+	want := "size > 104857600 AND size < 1610612736 AND name = '2MB.txt'"
+	if got != want {
+		t.Errorf("Got %q, expected %q", got, want)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	rec := &scanner.FileRecord{Path: filepath.Join("srv", "logs", "app.LOG"), Size: 300 << 20, Mode: 0o644, ModTime: time.Unix(100, 0)}
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{"size > 100MB and ext = 'log'", true},
+		{"name glob '*.txt' or size < 1k", false},
+		{"type = 'file' and not (mtime > 200)", true},
+		{"hash is null and uid is null", true},
+		{"lower(name) like 'app%'", true},
+	}
+	for _, test := range tests {
+		f, err := ParseFilter(test.cond, RecordColumns)
+		if err != nil {
+			t.Errorf("ParseFilter(%q): %v", test.cond, err)
+			continue
+		}
+		got, err := f.Match(RecordRow(rec))
+		if err != nil || got != test.want {
+			t.Errorf("%q matched = %v, %v; expected %v", test.cond, got, err, test.want)
+		}
+	}
+
+	for _, cond := range []string{"count(*) > 1", "size >", "owner = 'root'", "size > 1 limit 2"} {
+		if _, err := ParseFilter(cond, RecordColumns); err == nil {
+			t.Errorf("ParseFilter(%q) succeeded", cond)
+		}
+	}
+	f, _ := ParseFilter("size > 1 and hash = 'abc'", RecordColumns)
+	if !f.Uses("hash") || f.Uses("uid") {
+		t.Error("Uses should report hash but not uid")
+	}
+}
@@ -0,0 +1,291 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxAdaptiveWorkers caps how far the tuner may raise a filesystem's
+	// concurrency.
+	maxAdaptiveWorkers = 64
+	tuneInterval       = 500 * time.Millisecond
+)
+
+type mount struct {
+	Path   string
+	FSType string
+}
+
+// MountStats reports the concurrency used for one filesystem during a scan.
+type MountStats struct {
+	Path   string
+	FSType string
+	// Workers is the concurrency limit at the end of the scan and
+	// PeakWorkers the highest limit the tuner tried.
+	Workers     int
+	PeakWorkers int
+	Adaptive    bool
+	Operations  int64
+	AvgLatency  time.Duration
+}
+
+// limiter bounds the number of concurrent operations on one filesystem.
+// When adaptive, tune moves the limit towards the highest throughput by
+// hill climbing: keep stepping in the same direction while the rate of
+// completed operations improves, turn around when it drops.
+type limiter struct {
+	mount    mount
+	adaptive bool
+	max      int
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    int
+	peak     int
+	inflight int
+
+	// Counters for the current tuning window, and for the whole scan.
+	waits, ops   int64
+	latency      time.Duration
+	totalOps     int64
+	totalLatency time.Duration
+	lastRate     float64
+	direction    int
+}
+
+func newLimiter(m mount, limit, max int, adaptive bool) *limiter {
+	l := &limiter{mount: m, adaptive: adaptive, max: max, limit: limit, peak: limit, direction: 1}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *limiter) acquire() {
+	l.mu.Lock()
+	if l.inflight >= l.limit {
+		l.waits++
+	}
+	for l.inflight >= l.limit {
+		l.cond.Wait()
+	}
+	l.inflight++
+	l.mu.Unlock()
+}
+
+func (l *limiter) release(d time.Duration) {
+	l.mu.Lock()
+	l.inflight--
+	l.ops++
+	l.latency += d
+	l.cond.Signal()
+	l.mu.Unlock()
+}
+
+func (l *limiter) tune(window time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ops, waits := l.ops, l.waits
+	l.totalOps += ops
+	l.totalLatency += l.latency
+	l.ops, l.waits, l.latency = 0, 0, 0
+
+	// Without queued work the limit isn't what bounds throughput, so the
+	// measurement says nothing about it.
+	if !l.adaptive || waits == 0 || ops == 0 {
+		return
+	}
+
+	rate := float64(ops) / window.Seconds()
+	switch {
+	case l.lastRate == 0:
+	case rate < l.lastRate*0.95:
+		l.direction = -l.direction
+	case rate < l.lastRate*1.05:
+		// No clear gain: prefer fewer workers.
+		l.direction = -1
+	}
+	l.lastRate = rate
+
+	next := l.limit
+	if l.direction > 0 {
+		next += l.limit/4 + 1
+	} else {
+		next -= l.limit/5 + 1
+	}
+	if next < 1 {
+		next = 1
+	}
+	if next > l.max {
+		next = l.max
+	}
+	if next > l.limit {
+		l.cond.Broadcast()
+	}
+	l.limit = next
+	if next > l.peak {
+		l.peak = next
+	}
+}
+
+func (l *limiter) stats() MountStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ops := l.totalOps + l.ops
+	st := MountStats{
+		Path:        l.mount.Path,
+		FSType:      l.mount.FSType,
+		Workers:     l.limit,
+		PeakWorkers: l.peak,
+		Adaptive:    l.adaptive,
+		Operations:  ops,
+	}
+	if ops > 0 {
+		st.AvgLatency = (l.totalLatency + l.latency) / time.Duration(ops)
+	}
+	return st
+}
+
+// mountPool maps paths to the limiter of the filesystem they live on.
+type mountPool struct {
+	cwd      string
+	limiters []*limiter // longest mount path first
+	fallback *limiter
+}
+
+// newMountPool creates a limiter for the filesystem holding root and for
+// every filesystem mounted below it. A fixed workers count disables tuning;
+// caps bound individual filesystems (see Options.MountLimits).
+func newMountPool(root string, workers int, caps map[string]int) *mountPool {
+	adaptive := workers <= 0
+	initial, max := workers, workers
+	if adaptive {
+		initial, max = cpuCount()*2, maxAdaptiveWorkers
+		if initial > max {
+			initial = max
+		}
+	}
+
+	cwd, _ := os.Getwd()
+	absRoot := root
+	if !filepath.IsAbs(root) {
+		absRoot = filepath.Join(cwd, root)
+	}
+
+	mounts, _ := listMounts()
+	sort.Slice(mounts, func(i, j int) bool { return len(mounts[i].Path) > len(mounts[j].Path) })
+
+	p := &mountPool{cwd: cwd}
+	add := func(m mount) *limiter {
+		limit, max := initial, max
+		if c, ok := mountCap(m, caps); ok {
+			limit, max = min(limit, c), min(max, c)
+		}
+		l := newLimiter(m, limit, max, adaptive)
+		p.limiters = append(p.limiters, l)
+		return l
+	}
+	seen := make(map[string]bool)
+	for _, m := range mounts {
+		// Later entries for the same path are hidden by earlier ones.
+		if seen[m.Path] {
+			continue
+		}
+		switch {
+		case within(m.Path, absRoot):
+			seen[m.Path] = true
+			add(m)
+		case p.fallback == nil && within(absRoot, m.Path):
+			seen[m.Path] = true
+			p.fallback = add(m)
+		}
+	}
+	if p.fallback == nil {
+		p.fallback = add(mount{Path: absRoot})
+	}
+	return p
+}
+
+// mountCap looks up the cap for m by mount path, then by filesystem type.
+// A type without a version matches all versions, so "nfs" covers "nfs4".
+func mountCap(m mount, caps map[string]int) (int, bool) {
+	if c, ok := caps[m.Path]; ok && c > 0 {
+		return c, true
+	}
+	if m.FSType == "" {
+		return 0, false
+	}
+	if c, ok := caps[m.FSType]; ok && c > 0 {
+		return c, true
+	}
+	c, ok := caps[strings.TrimRight(m.FSType, "0123456789")]
+	return c, ok && c > 0
+}
+
+// within reports whether path is dir or below it. Walking "." yields
+// paths like "a/b", which are below it too.
+func within(path, dir string) bool {
+	if dir == "." {
+		return !filepath.IsAbs(path) && path != ".." && !strings.HasPrefix(path, "../")
+	}
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+}
+
+func (p *mountPool) forPath(path string) *limiter {
+	if len(p.limiters) == 1 {
+		return p.fallback
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(p.cwd, path)
+	}
+	for _, l := range p.limiters {
+		if within(path, l.mount.Path) {
+			return l
+		}
+	}
+	return p.fallback
+}
+
+// maxWorkers is the number of worker goroutines needed to saturate every
+// limiter at once.
+func (p *mountPool) maxWorkers() int {
+	n := 0
+	for _, l := range p.limiters {
+		n += l.max
+	}
+	if n > maxAdaptiveWorkers*4 {
+		n = maxAdaptiveWorkers * 4
+	}
+	return n
+}
+
+func (p *mountPool) tuneLoop(done <-chan struct{}) {
+	ticker := time.NewTicker(tuneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, l := range p.limiters {
+				l.tune(tuneInterval)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// stats lists the filesystems that saw any work, in path order.
+func (p *mountPool) stats() []MountStats {
+	var out []MountStats
+	for _, l := range p.limiters {
+		if st := l.stats(); st.Operations > 0 {
+			out = append(out, st)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
@@ -0,0 +1,54 @@
+package scanner
+
+import (
+	"math"
+	"runtime"
+	"sync"
+)
+
+// Limits describes the resources available to the process. Zero fields
+// mean no limit was found.
+type Limits struct {
+	CPUs   float64
+	Memory int64
+}
+
+var (
+	limitsOnce sync.Once
+	limits     Limits
+)
+
+// ContainerLimits returns the CPU and memory limits of the cgroup the
+// process runs in, read once and cached. Outside Linux it reports no limits.
+func ContainerLimits() Limits {
+	limitsOnce.Do(func() {
+		limits = readContainerLimits()
+	})
+	return limits
+}
+
+// cpuCount is GOMAXPROCS, further bounded by a cgroup CPU quota, so worker
+// pools are sized for the CPUs the container may actually use.
+func cpuCount() int {
+	n := runtime.GOMAXPROCS(0)
+	if cpus := ContainerLimits().CPUs; cpus > 0 {
+		if quota := int(math.Ceil(cpus)); quota < n {
+			n = quota
+		}
+	}
+	return n
+}
+
+// defaultQueueSize shrinks the record queue when memory is tight.
+func defaultQueueSize() int {
+	mem := ContainerLimits().Memory
+	switch {
+	case mem == 0:
+		return defaultRecordQueue
+	case mem < 128<<20:
+		return defaultRecordQueue / 16
+	case mem < 512<<20:
+		return defaultRecordQueue / 4
+	}
+	return defaultRecordQueue
+}
@@ -0,0 +1,130 @@
+//go:build linux
+
+package scanner
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const haveCgroups = true
+
+func readContainerLimits() Limits {
+	return cgroupLimits("/proc/self/cgroup", "/sys/fs/cgroup")
+}
+
+// cgroupLimits reads the limits of the cgroup listed in procFile under the
+// cgroup filesystem mounted at root, for both cgroup v2 (unified) and v1
+// hierarchies. Limits set on parent groups also apply, so the tightest one
+// on the way up wins.
+func cgroupLimits(procFile, root string) Limits {
+	f, err := os.Open(procFile)
+	if err != nil {
+		return Limits{}
+	}
+	defer f.Close()
+
+	var l Limits
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(sc.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		controllers, path := parts[1], parts[2]
+		if controllers == "" {
+			unified := root
+			if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err != nil {
+				// Hybrid hierarchy: v2 is mounted next to the v1 controllers.
+				unified = filepath.Join(root, "unified")
+			}
+			for _, dir := range cgroupDirs(unified, path) {
+				l.tighten(cpuMaxV2(dir), readLimit(filepath.Join(dir, "memory.max")))
+			}
+			continue
+		}
+		for _, c := range strings.Split(controllers, ",") {
+			switch c {
+			case "cpu":
+				for _, dir := range cgroupDirs(filepath.Join(root, controllers), path) {
+					l.tighten(cpuQuotaV1(dir), 0)
+				}
+			case "memory":
+				for _, dir := range cgroupDirs(filepath.Join(root, controllers), path) {
+					l.tighten(0, readLimit(filepath.Join(dir, "memory.limit_in_bytes")))
+				}
+			}
+		}
+	}
+	return l
+}
+
+// cgroupDirs lists the directories for path and its parents below mount.
+// Inside a container the cgroup namespace usually hides the parents, so
+// path may not exist at all and only mount itself is left.
+func cgroupDirs(mount, path string) []string {
+	var dirs []string
+	for p := filepath.Clean("/" + path); ; p = filepath.Dir(p) {
+		dir := filepath.Join(mount, p)
+		if _, err := os.Stat(dir); err == nil {
+			dirs = append(dirs, dir)
+		}
+		if p == "/" {
+			return dirs
+		}
+	}
+}
+
+func (l *Limits) tighten(cpus float64, memory int64) {
+	if cpus > 0 && (l.CPUs == 0 || cpus < l.CPUs) {
+		l.CPUs = cpus
+	}
+	if memory > 0 && (l.Memory == 0 || memory < l.Memory) {
+		l.Memory = memory
+	}
+}
+
+// cpuMaxV2 parses cpu.max ("$MAX $PERIOD", MAX may be "max").
+func cpuMaxV2(dir string) float64 {
+	data, err := os.ReadFile(filepath.Join(dir, "cpu.max"))
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return 0
+	}
+	quota, err1 := strconv.ParseFloat(fields[0], 64)
+	period, err2 := strconv.ParseFloat(fields[1], 64)
+	if err1 != nil || err2 != nil || quota <= 0 || period <= 0 {
+		return 0
+	}
+	return quota / period
+}
+
+func cpuQuotaV1(dir string) float64 {
+	quota := readLimit(filepath.Join(dir, "cpu.cfs_quota_us"))
+	period := readLimit(filepath.Join(dir, "cpu.cfs_period_us"))
+	if quota <= 0 || period <= 0 {
+		return 0
+	}
+	return float64(quota) / float64(period)
+}
+
+// readLimit reads a single integer, treating "max", -1 and the huge values
+// v1 uses for "unlimited" as no limit.
+func readLimit(name string) int64 {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return 0
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || n <= 0 || n >= 1<<62 {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,39 @@
+//go:build linux
+
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCgroupLimits(t *testing.T) {
+	write := func(name, data string) {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	v2 := t.TempDir()
+	write(filepath.Join(v2, "cgroup.controllers"), "cpu memory")
+	write(filepath.Join(v2, "cpu.max"), "max 100000\n")
+	write(filepath.Join(v2, "app", "cpu.max"), "150000 100000\n")
+	write(filepath.Join(v2, "app", "memory.max"), "536870912\n")
+	write(filepath.Join(v2, "proc"), "0::/app\n")
+	if got := cgroupLimits(filepath.Join(v2, "proc"), v2); got != (Limits{CPUs: 1.5, Memory: 512 << 20}) {
+		t.Errorf("cgroup v2 limits = %+v", got)
+	}
+
+	v1 := t.TempDir()
+	write(filepath.Join(v1, "cpu,cpuacct", "cpu.cfs_quota_us"), "200000\n")
+	write(filepath.Join(v1, "cpu,cpuacct", "cpu.cfs_period_us"), "100000\n")
+	write(filepath.Join(v1, "memory", "memory.limit_in_bytes"), "9223372036854771712\n")
+	write(filepath.Join(v1, "proc"), "4:memory:/docker/abc\n3:cpu,cpuacct:/docker/abc\n0::/\n")
+	if got := cgroupLimits(filepath.Join(v1, "proc"), v1); got != (Limits{CPUs: 2}) {
+		t.Errorf("cgroup v1 limits = %+v", got)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package scanner
+
+const haveCgroups = false
+
+func readContainerLimits() Limits {
+	return Limits{}
+}
@@ -0,0 +1,20 @@
+//go:build darwin
+
+package scanner
+
+import (
+	"os"
+	"syscall"
+)
+
+const haveCloudPlaceholders = true
+
+// sfDataless is set on files whose contents have been evicted to iCloud
+// Drive or a File Provider (Dropbox, OneDrive) and are fetched on access.
+const sfDataless = 0x40000000
+
+// isCloudOnly reports whether info is a dataless file.
+func isCloudOnly(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && st.Flags&sfDataless != 0
+}
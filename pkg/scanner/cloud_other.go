@@ -0,0 +1,13 @@
+//go:build !windows && !darwin
+
+package scanner
+
+import "os"
+
+const haveCloudPlaceholders = false
+
+// isCloudOnly always reports false: this platform has no standard marker
+// for placeholder files.
+func isCloudOnly(info os.FileInfo) bool {
+	return false
+}
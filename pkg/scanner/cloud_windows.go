@@ -0,0 +1,26 @@
+//go:build windows
+
+package scanner
+
+import (
+	"os"
+	"syscall"
+)
+
+const haveCloudPlaceholders = true
+
+const (
+	fileAttributeOffline            = 0x1000
+	fileAttributeRecallOnOpen       = 0x40000
+	fileAttributeRecallOnDataAccess = 0x400000
+)
+
+// isCloudOnly reports whether info is a cloud files placeholder (OneDrive,
+// Dropbox, iCloud for Windows) whose data is not stored locally.
+func isCloudOnly(info os.FileInfo) bool {
+	d, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return false
+	}
+	return d.FileAttributes&(fileAttributeOffline|fileAttributeRecallOnOpen|fileAttributeRecallOnDataAccess) != 0
+}
@@ -0,0 +1,62 @@
+package scanner
+
+import (
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// plainWidth is how much of a line the plain progress display uses. Old
+// Windows consoles wrap at 80 columns, and once a line has wrapped a
+// carriage return only goes back to the start of its last row.
+const plainWidth = 79
+
+// defaultLogInterval is Options.LogInterval's default.
+const defaultLogInterval = 10 * time.Second
+
+// isTerminal reports whether f is a terminal or console, rather than a
+// pipe or file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ansiConsole reports whether standard output understands the ANSI escape
+// codes the progress display uses to clear lines and move the cursor up.
+// On Windows it turns on virtual terminal processing when the console
+// supports it, which is everywhere since Windows 10.
+func ansiConsole() bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return enableANSI()
+}
+
+// plainLine fits the status, followed by as much of the end of the
+// current path as there is room for, into plainWidth columns, and pads
+// it to cover a line of prev columns drawn before it. It returns the line
+// and its width.
+func plainLine(status, current string, prev int) (string, int) {
+	line := truncateRunes(status, plainWidth)
+	if n := utf8.RuneCountInString(line); current != "" && n+len(" | ...")+8 <= plainWidth {
+		room := plainWidth - n - len(" | ")
+		if utf8.RuneCountInString(current) > room {
+			r := []rune(current)
+			current = "..." + string(r[len(r)-room+3:])
+		}
+		line += " | " + current
+	}
+	width := utf8.RuneCountInString(line)
+	if width < prev {
+		line += strings.Repeat(" ", prev-width)
+	}
+	return line, width
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package scanner
+
+// enableANSI has nothing to switch on outside Windows, where terminals
+// interpret escape codes.
+func enableANSI() bool {
+	return true
+}
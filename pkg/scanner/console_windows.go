@@ -0,0 +1,29 @@
+//go:build windows
+
+package scanner
+
+import "syscall"
+
+const enableVirtualTerminalProcessing = 0x4
+
+var setConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+
+// enableANSI switches the console on standard output to virtual terminal
+// processing. cmd.exe and PowerShell before Windows 10 cannot do that and
+// print escape codes as text. Output that is not a console, such as the
+// pipes of mintty and other terminal emulators, is left to interpret them.
+func enableANSI() bool {
+	h, err := syscall.GetStdHandle(syscall.STD_OUTPUT_HANDLE)
+	if err != nil {
+		return true
+	}
+	var mode uint32
+	if syscall.GetConsoleMode(h, &mode) != nil {
+		return true
+	}
+	if mode&enableVirtualTerminalProcessing != 0 {
+		return true
+	}
+	ok, _, _ := setConsoleMode.Call(uintptr(h), uintptr(mode|enableVirtualTerminalProcessing))
+	return ok != 0
+}
@@ -0,0 +1,70 @@
+package scanner
+
+// DirSummary is the totals of one directory's subtree, the directory
+// itself included in Dirs. They count what the walk found, before hard
+// link deduplication and without entries that could not be read.
+type DirSummary struct {
+	Path  string
+	Files int64
+	Dirs  int64
+	Bytes int64
+}
+
+// DirSummaries returns a channel that receives a DirSummary as soon as the
+// walk has finished each directory's subtree, children before their
+// parents and the root last, so consumers can draw the tree while the scan
+// is still running. It must be called before Start, at most once per
+// scan, and the channel must be drained: the walk waits for a full
+// channel. It is closed when the walk ends.
+func (s *Scanner) DirSummaries(buffer int) <-chan DirSummary {
+	s.dirs = make(chan DirSummary, buffer)
+	return s.dirs
+}
+
+// dirFrame is a directory whose subtree is being walked.
+type dirFrame struct {
+	DirSummary
+}
+
+// trackDir accounts for an entry the walk is about to hand to the workers,
+// first finishing the directories the walk has left. Only the walking
+// goroutine calls it.
+func (s *Scanner) trackDir(path string, isDir bool, size int64) {
+	if s.dirs == nil {
+		return
+	}
+	for len(s.dirStack) > 0 && !within(path, s.dirStack[len(s.dirStack)-1].Path) {
+		s.popDir()
+	}
+	if isDir {
+		s.dirStack = append(s.dirStack, &dirFrame{DirSummary{Path: path, Dirs: 1}})
+		return
+	}
+	if n := len(s.dirStack); n > 0 {
+		s.dirStack[n-1].Files++
+		s.dirStack[n-1].Bytes += size
+	}
+}
+
+// finishDirs finishes every directory still open, at the end of a walk.
+func (s *Scanner) finishDirs() {
+	for len(s.dirStack) > 0 {
+		s.popDir()
+	}
+}
+
+func (s *Scanner) popDir() {
+	n := len(s.dirStack)
+	top := s.dirStack[n-1]
+	s.dirStack = s.dirStack[:n-1]
+	if n > 1 {
+		parent := s.dirStack[n-2]
+		parent.Files += top.Files
+		parent.Dirs += top.Dirs
+		parent.Bytes += top.Bytes
+	}
+	select {
+	case s.dirs <- top.DirSummary:
+	case <-s.ctx.Done():
+	}
+}
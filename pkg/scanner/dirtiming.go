@@ -0,0 +1,63 @@
+package scanner
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DirTiming is how long the walk took to enumerate one directory: to list
+// it and Lstat its entries, not counting its subdirectories or the time it
+// waited for the workers to catch up.
+type DirTiming struct {
+	Path     string
+	Entries  int
+	Duration time.Duration
+}
+
+// slowDirs keeps the n slowest directories to enumerate, in a min-heap so
+// that the fastest of them is the one replaced. The walk adds to it while
+// a stopped scan may already be collecting its result.
+type slowDirs struct {
+	mu   sync.Mutex
+	n    int
+	dirs dirTimings
+}
+
+func newSlowDirs(n int) *slowDirs {
+	return &slowDirs{n: n}
+}
+
+func (d *slowDirs) add(t DirTiming) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.dirs) < d.n {
+		heap.Push(&d.dirs, t)
+	} else if t.Duration > d.dirs[0].Duration {
+		d.dirs[0] = t
+		heap.Fix(&d.dirs, 0)
+	}
+}
+
+// sorted returns the directories kept, slowest first.
+func (d *slowDirs) sorted() []DirTiming {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dirs := append([]DirTiming(nil), d.dirs...)
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].Duration > dirs[j].Duration })
+	return dirs
+}
+
+type dirTimings []DirTiming
+
+func (h dirTimings) Len() int           { return len(h) }
+func (h dirTimings) Less(i, j int) bool { return h[i].Duration < h[j].Duration }
+func (h dirTimings) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *dirTimings) Push(x any)        { *h = append(*h, x.(DirTiming)) }
+func (h *dirTimings) Pop() any {
+	old := *h
+	t := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return t
+}
@@ -0,0 +1,30 @@
+package scanner
+
+// Feature is a platform-specific capability of the scanner and whether
+// this build has it.
+type Feature struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+}
+
+// Features lists the capabilities that depend on the platform the scanner
+// was built for, so bug reports can say which ones were in play.
+func Features() []Feature {
+	return []Feature{
+		{"hard link deduplication (inode numbers)", haveInodes},
+		{"file owners", haveOwners},
+		{"per-filesystem concurrency (mount table)", haveMounts},
+		{"container CPU and memory limits (cgroups)", haveCgroups},
+		{"skipped filesystem size estimates (statfs)", haveFSUsage},
+		{"Btrfs snapshot detection", haveBtrfsSnapshots},
+		{"reflink and clone accounting", haveReflinks},
+		{"cloud-only placeholder detection", haveCloudPlaceholders},
+		{"junctions and reparse points", haveReparsePoints},
+	}
+}
+
+// DefaultSkipPaths returns the paths a scan of the local disk prunes
+// unless told otherwise.
+func DefaultSkipPaths() []string {
+	return append([]string(nil), defaultSkipPaths...)
+}
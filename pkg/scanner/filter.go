@@ -0,0 +1,207 @@
+package scanner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Filter is an ordered list of rsync-style include/exclude rules. Paths are
+// matched relative to the scan root and the first matching rule decides;
+// paths no rule matches are included. An excluded directory is not
+// descended into, so nothing below it can be included again, as in rsync.
+//
+// Supported rules are "- PATTERN" (or "exclude PATTERN"), "+ PATTERN"
+// ("include PATTERN"), "merge FILE" (". FILE") and "!" (or "clear"), which
+// drops the rules added so far. Patterns follow rsync: a leading "/"
+// anchors the pattern to the root, a trailing "/" only matches
+// directories, "*" and "?" stop at slashes while "**" does not, "dir/***"
+// matches dir and everything below it, and a pattern without a slash is
+// matched against the last path component only.
+type Filter struct {
+	rules []filterRule
+}
+
+type filterRule struct {
+	text    string
+	include bool
+	dirOnly bool
+	// anchored patterns must match the whole relative path; the others may
+	// also match any trailing part of it that starts after a slash.
+	anchored bool
+	// base patterns are unanchored and contain no slash; they are matched
+	// against the last path component.
+	base bool
+	re   *regexp.Regexp
+}
+
+// Add parses one rule. Relative merge files are opened relative to the
+// current directory.
+func (f *Filter) Add(rule string) error {
+	rule = strings.TrimRight(rule, "\r")
+	if rule == "!" || rule == "clear" {
+		f.rules = nil
+		return nil
+	}
+
+	keyword, arg, ok := strings.Cut(rule, " ")
+	if !ok {
+		return fmt.Errorf("filter rule %q: expected \"- PATTERN\", \"+ PATTERN\" or \"merge FILE\"", rule)
+	}
+	name, modifier, _ := strings.Cut(keyword, ",")
+	switch name {
+	case "-", "exclude":
+		return f.addPattern(rule, arg, false)
+	case "+", "include":
+		return f.addPattern(rule, arg, true)
+	case ".", "merge":
+		switch modifier {
+		case "":
+			return f.AddFile(arg, "")
+		case "-", "+":
+			return f.AddFile(arg, modifier)
+		}
+	}
+	return fmt.Errorf("filter rule %q: unsupported rule %q", rule, keyword)
+}
+
+// AddFile reads rules from name, one per line, skipping blank lines and
+// lines starting with "#" or ";". With kind "-" or "+" every line is an
+// exclude or include pattern, as in --exclude-from and --include-from,
+// unless it starts with "- " or "+ " itself. "-" reads standard input.
+func (f *Filter) AddFile(name, kind string) error {
+	file := os.Stdin
+	if name != "-" {
+		var err error
+		if file, err = os.Open(name); err != nil {
+			return err
+		}
+		defer file.Close()
+	}
+
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if kind != "" && !strings.HasPrefix(line, "- ") && !strings.HasPrefix(line, "+ ") {
+			line = kind + " " + line
+		}
+		if err := f.Add(line); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return sc.Err()
+}
+
+func (f *Filter) addPattern(text, pattern string, include bool) error {
+	if pattern == "" {
+		return fmt.Errorf("filter rule %q: empty pattern", text)
+	}
+	r := filterRule{text: text, include: include}
+	if strings.HasSuffix(pattern, "/") && !strings.HasSuffix(pattern, "***/") {
+		r.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if strings.HasPrefix(pattern, "/") {
+		r.anchored = true
+		pattern = pattern[1:]
+	}
+	r.base = !r.anchored && !strings.Contains(pattern, "/") && !strings.Contains(pattern, "**")
+
+	re, err := regexp.Compile("^" + globRegexp(pattern) + "$")
+	if err != nil {
+		return fmt.Errorf("filter rule %q: %w", text, err)
+	}
+	r.re = re
+	f.rules = append(f.rules, r)
+	return nil
+}
+
+// globRegexp translates an rsync wildcard pattern into a regular expression.
+func globRegexp(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "/***") && i+4 == len(pattern):
+			b.WriteString("(/.*)?")
+			i += 3
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			for i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+			}
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case c == '[':
+			j := i + 1
+			if j < len(pattern) && (pattern[j] == '!' || pattern[j] == '^') {
+				j++
+			}
+			if j < len(pattern) && pattern[j] == ']' {
+				j++
+			}
+			end := strings.IndexByte(pattern[j:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : j+end]
+			if class[0] == '!' {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i = j + end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// Match returns the rule that decides rel, a slash-separated path relative
+// to the scan root, and whether that rule excludes it. rule is "" when no
+// rule matches.
+func (f *Filter) Match(rel string, isDir bool) (rule string, excluded bool) {
+	if f == nil {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, r := range f.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.matches(rel) {
+			return r.text, !r.include
+		}
+	}
+	return "", false
+}
+
+func (r *filterRule) matches(rel string) bool {
+	if r.base {
+		return r.re.MatchString(rel[strings.LastIndexByte(rel, '/')+1:])
+	}
+	if r.re.MatchString(rel) {
+		return true
+	}
+	if r.anchored {
+		return false
+	}
+	for i := 0; i < len(rel); i++ {
+		if rel[i] == '/' && r.re.MatchString(rel[i+1:]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package scanner
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// FileSystem is the low-level access the scanner makes to a filesystem
+// that uses the operating system's paths. Options.FileSystem replaces the
+// real one, typically with a wrapper around OS() that injects permission
+// errors, delays or files that vanish between listing and Lstat, so tests
+// can drive the error handling deterministically. Implementations that
+// also have an Open(name string) (fs.File, error) method are used to read
+// files for hashing; otherwise they are opened from the disk.
+type FileSystem interface {
+	Lstat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
+// OS returns the operating system's filesystem.
+func OS() FileSystem { return osFS{} }
+
+// fileSystem is what the scanner reads entries from: the operating system
+// by default, an fs.FS given in Options.FS or a FileSystem given in
+// Options.FileSystem.
+type fileSystem interface {
+	Lstat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Open(name string) (fs.File, error)
+	Join(elem ...string) string
+}
+
+type osFS struct{}
+
+func (osFS) Lstat(name string) (fs.FileInfo, error)     { return os.Lstat(name) }
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (osFS) Open(name string) (fs.File, error)          { return os.Open(name) }
+func (osFS) Join(elem ...string) string                 { return filepath.Join(elem...) }
+
+// ioFS reads an fs.FS. Paths are slash-separated and relative to its root,
+// and as fs.FS has no Lstat, symlinks are reported as what they point at.
+type ioFS struct{ fsys fs.FS }
+
+func (f ioFS) Lstat(name string) (fs.FileInfo, error)     { return fs.Stat(f.fsys, name) }
+func (f ioFS) ReadDir(name string) ([]fs.DirEntry, error) { return fs.ReadDir(f.fsys, name) }
+func (f ioFS) Open(name string) (fs.File, error)          { return f.fsys.Open(name) }
+func (ioFS) Join(elem ...string) string                   { return path.Join(elem...) }
+
+// customFS adapts a FileSystem given in Options.
+type customFS struct{ FileSystem }
+
+func (f customFS) Open(name string) (fs.File, error) {
+	if o, ok := f.FileSystem.(interface {
+		Open(name string) (fs.File, error)
+	}); ok {
+		return o.Open(name)
+	}
+	return os.Open(name)
+}
+
+func (customFS) Join(elem ...string) string { return filepath.Join(elem...) }
+
+// walk is filepath.Walk over fsys: fn is called for root and everything
+// below it in lexical order, with the Lstat result of each entry, and may
+// return filepath.SkipDir to prune a directory. timed, if not nil, is told
+// how long each directory walked into took to list, and to Lstat the
+// entries of.
+func walk(fsys fileSystem, root string, timed func(dir string, entries int, list, stat time.Duration), fn filepath.WalkFunc) error {
+	info, err := fsys.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDir(fsys, root, info, timed, fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func walkDir(fsys fileSystem, dir string, info fs.FileInfo, timed func(string, int, time.Duration, time.Duration), fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(dir, info, nil)
+	}
+	start := time.Now()
+	entries, err := fsys.ReadDir(dir)
+	list := time.Since(start)
+	err1 := fn(dir, info, err)
+	// A directory that can't be read is reported once and not descended
+	// into, whatever fn returns.
+	if err != nil || err1 != nil {
+		return err1
+	}
+	var stat time.Duration
+	if timed != nil {
+		defer func() { timed(dir, len(entries), list, stat) }()
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, e := range entries {
+		name := fsys.Join(dir, e.Name())
+		start := time.Now()
+		info, err := fsys.Lstat(name)
+		stat += time.Since(start)
+		if err != nil {
+			if err := fn(name, info, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+		if err := walkDir(fsys, name, info, timed, fn); err != nil {
+			if !info.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// SnapshotMode says what a scan does with filesystem snapshots it comes
+// across, such as ZFS's .zfs/snapshot directories and Btrfs snapshot
+// subvolumes. Each one holds a full copy of the tree as it was, so
+// counting them makes the data look several times larger than it is.
+type SnapshotMode int
+
+const (
+	// SnapshotsInclude counts snapshots like any other directory; they are
+	// still listed in ScanResult.Snapshots, without totals.
+	SnapshotsInclude SnapshotMode = iota
+	// SnapshotsSkip prunes snapshots, reporting them in ScanResult.Skipped.
+	SnapshotsSkip
+	// SnapshotsSeparate leaves snapshots out of the totals and counts each
+	// one in ScanResult.Snapshots instead.
+	SnapshotsSeparate
+)
+
+// SnapshotStats is one snapshot found while scanning. Kind is "zfs" or
+// "btrfs". The totals are only counted with SnapshotsSeparate.
+type SnapshotStats struct {
+	Path  string
+	Kind  string
+	Files int64
+	Dirs  int64
+	Bytes int64
+}
+
+// snapshotKind reports whether the directory at path is a filesystem
+// snapshot, and of which kind.
+func snapshotKind(path string, info os.FileInfo) string {
+	if !info.IsDir() {
+		return ""
+	}
+	// .zfs/snapshot/<name>, only listed when the dataset has snapdir=visible.
+	parent := filepath.Dir(path)
+	if filepath.Base(parent) == "snapshot" && filepath.Base(filepath.Dir(parent)) == ".zfs" {
+		return "zfs"
+	}
+	if isBtrfsSnapshot(path, info) {
+		return "btrfs"
+	}
+	return ""
+}
+
+// handleSnapshot applies the snapshot mode to a snapshot found at path and
+// reports whether the walk should leave it out. Only the walking goroutine
+// calls it, so snapshots needs no lock.
+func (s *Scanner) handleSnapshot(kind, path string, info os.FileInfo) bool {
+	st := SnapshotStats{Path: path, Kind: kind}
+	switch s.opts.Snapshots {
+	case SnapshotsSkip:
+		s.skips.add(kind+" snapshot", path, info)
+		atomic.AddInt64(&s.skippedCount, 1)
+		s.rootSkipped(path)
+	case SnapshotsSeparate:
+		s.countSnapshot(&st)
+	}
+	s.snapshots = append(s.snapshots, st)
+	return s.opts.Snapshots != SnapshotsInclude
+}
+
+// countSnapshot walks a snapshot in the walking goroutine, adding up what
+// it holds. Nested snapshots are counted as part of it.
+func (s *Scanner) countSnapshot(st *SnapshotStats) {
+	filepath.Walk(st.Path, func(path string, info os.FileInfo, err error) error {
+		if s.ctx.Err() != nil {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return nil
+		}
+		s.setCurrentPath(path)
+		if info.IsDir() {
+			st.Dirs++
+		} else {
+			st.Files++
+			st.Bytes += info.Size()
+		}
+		return nil
+	})
+}
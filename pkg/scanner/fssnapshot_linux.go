@@ -0,0 +1,45 @@
+package scanner
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const haveBtrfsSnapshots = true
+
+const (
+	// btrfsFirstFreeObjectID is the inode number of every subvolume root.
+	btrfsFirstFreeObjectID = 256
+	// btrfsIocGetSubvolInfo is _IOR(0x94, 60, struct
+	// btrfs_ioctl_get_subvol_info_args), available without privileges
+	// since Linux 4.18.
+	btrfsIocGetSubvolInfo = 0x81f8943c
+	btrfsSubvolInfoSize   = 504
+	btrfsParentUUIDOffset = 312
+)
+
+// isBtrfsSnapshot reports whether path is the root of a Btrfs subvolume that
+// was created as a snapshot of another, i.e. has a parent UUID.
+func isBtrfsSnapshot(path string, info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Ino != btrfsFirstFreeObjectID {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	var args [btrfsSubvolInfoSize]byte
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), btrfsIocGetSubvolInfo, uintptr(unsafe.Pointer(&args[0])))
+	if errno != 0 {
+		return false // not btrfs, or an old kernel
+	}
+	for _, b := range args[btrfsParentUUIDOffset : btrfsParentUUIDOffset+16] {
+		if b != 0 {
+			return true
+		}
+	}
+	return false
+}
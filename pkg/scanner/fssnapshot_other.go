@@ -0,0 +1,12 @@
+//go:build !linux
+
+package scanner
+
+import "os"
+
+const haveBtrfsSnapshots = false
+
+// isBtrfsSnapshot always reports false: Btrfs is Linux-only.
+func isBtrfsSnapshot(path string, info os.FileInfo) bool {
+	return false
+}
@@ -0,0 +1,15 @@
+package scanner
+
+import "syscall"
+
+const haveFSUsage = true
+
+// fsUsage returns the number of inodes and bytes in use on the filesystem
+// holding path. OpenBSD prefixes the statfs fields with F_.
+func fsUsage(path string) (entries, bytes int64, ok bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, false
+	}
+	return int64(st.F_files) - int64(st.F_ffree), (int64(st.F_blocks) - int64(st.F_bfree)) * int64(st.F_bsize), true
+}
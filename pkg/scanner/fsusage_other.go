@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd || openbsd)
+
+package scanner
+
+const haveFSUsage = false
+
+func fsUsage(path string) (entries, bytes int64, ok bool) {
+	return 0, 0, false
+}
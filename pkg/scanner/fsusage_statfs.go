@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd
+
+package scanner
+
+import "syscall"
+
+const haveFSUsage = true
+
+// fsUsage returns the number of inodes and bytes in use on the filesystem
+// holding path.
+func fsUsage(path string) (entries, bytes int64, ok bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, false
+	}
+	// The field types differ between platforms (Ffree is signed on
+	// FreeBSD), so convert each one before doing arithmetic.
+	return int64(st.Files) - int64(st.Ffree), (int64(st.Blocks) - int64(st.Bfree)) * int64(st.Bsize), true
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package scanner
+
+import "os"
+
+const haveInodes = false
+
+// inodeKey is not available on this platform, so hardlink dedup is a no-op.
+func inodeKey(info os.FileInfo) (dev, ino uint64, linked bool) {
+	return 0, 0, false
+}
+
+func deviceID(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
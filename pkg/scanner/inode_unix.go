@@ -0,0 +1,29 @@
+//go:build unix
+
+package scanner
+
+import (
+	"os"
+	"syscall"
+)
+
+const haveInodes = true
+
+// inodeKey returns the device and inode of info, and whether it has more than
+// one hard link.
+func inodeKey(info os.FileInfo) (dev, ino uint64, linked bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return uint64(st.Dev), uint64(st.Ino), uint64(st.Nlink) > 1
+}
+
+// deviceID returns the device info lives on.
+func deviceID(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
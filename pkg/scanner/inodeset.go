@@ -0,0 +1,115 @@
+package scanner
+
+import "sync"
+
+// inodeSet records (device, inode) pairs using roaring-style containers: inode
+// numbers are split into a 48-bit key and a 16-bit low part, and each key holds
+// either a sorted array of low parts or, once dense, a fixed 8 KiB bitmap. This
+// keeps millions of hardlinked inodes in a few bytes each instead of a map entry.
+type inodeSet struct {
+	mu      sync.Mutex
+	devices map[uint64]map[uint64]*container
+	count   int64
+}
+
+const arrayMaxSize = 4096
+
+type container struct {
+	array  []uint16
+	bitmap []uint64
+}
+
+func newInodeSet() *inodeSet {
+	return &inodeSet{devices: make(map[uint64]map[uint64]*container)}
+}
+
+// Add reports whether the inode was newly added.
+func (s *inodeSet) Add(dev, ino uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	containers, ok := s.devices[dev]
+	if !ok {
+		containers = make(map[uint64]*container)
+		s.devices[dev] = containers
+	}
+	c, ok := containers[ino>>16]
+	if !ok {
+		c = &container{}
+		containers[ino>>16] = c
+	}
+
+	if c.add(uint16(ino)) {
+		s.count++
+		return true
+	}
+	return false
+}
+
+func (s *inodeSet) Len() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Bytes estimates the memory held by the set, including map overhead.
+func (s *inodeSet) Bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	const mapEntryOverhead = 48
+	var total int64
+	for _, containers := range s.devices {
+		total += mapEntryOverhead
+		for _, c := range containers {
+			total += mapEntryOverhead + int64(cap(c.array))*2 + int64(cap(c.bitmap))*8
+		}
+	}
+	return total
+}
+
+func (c *container) add(low uint16) bool {
+	if c.bitmap != nil {
+		word, bit := low>>6, uint64(1)<<(low&63)
+		if c.bitmap[word]&bit != 0 {
+			return false
+		}
+		c.bitmap[word] |= bit
+		return true
+	}
+
+	i := searchUint16(c.array, low)
+	if i < len(c.array) && c.array[i] == low {
+		return false
+	}
+	if len(c.array) >= arrayMaxSize {
+		c.toBitmap()
+		return c.add(low)
+	}
+
+	c.array = append(c.array, 0)
+	copy(c.array[i+1:], c.array[i:])
+	c.array[i] = low
+	return true
+}
+
+func (c *container) toBitmap() {
+	c.bitmap = make([]uint64, 1024)
+	for _, v := range c.array {
+		c.bitmap[v>>6] |= 1 << (v & 63)
+	}
+	c.array = nil
+}
+
+func searchUint16(a []uint16, v uint16) int {
+	lo, hi := 0, len(a)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if a[mid] < v {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
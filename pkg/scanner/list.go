@@ -0,0 +1,66 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// maxListEntry bounds a single entry of a path list; real paths are far
+// shorter, so anything longer means the delimiter is wrong.
+const maxListEntry = 1 << 20
+
+// readList feeds the paths in r, separated by delim, to the workers instead
+// of walking a tree. Listed directories are counted but not descended into,
+// and skip rules don't apply: the list is taken as given. Empty entries are
+// ignored, as is a carriage return before a newline delimiter.
+func (s *Scanner) readList(r io.Reader, delim byte, pathChan chan<- string) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxListEntry)
+	sc.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, delim); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+
+	for sc.Scan() {
+		entry := sc.Bytes()
+		if delim == '\n' {
+			entry = bytes.TrimSuffix(entry, []byte{'\r'})
+		}
+		if len(entry) == 0 {
+			continue
+		}
+		path := string(entry)
+		s.setCurrentPath(path)
+
+		select {
+		case pathChan <- path:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+	if err := sc.Err(); err != nil {
+		atomic.AddInt64(&s.errorCount, 1)
+		s.setLastError(fmt.Sprintf("Error reading path list: %v", err))
+		s.setErr(fmt.Errorf("reading path list: %w", err))
+		s.cancel()
+	}
+}
+
+// DetectDelimiter reports whether the start of a path list is NUL-delimited
+// (as written by find -print0) or newline-delimited. Paths cannot contain
+// NUL, so a single one settles it.
+func DetectDelimiter(r *bufio.Reader) byte {
+	head, _ := r.Peek(64 * 1024)
+	if bytes.IndexByte(head, 0) >= 0 {
+		return 0
+	}
+	return '\n'
+}
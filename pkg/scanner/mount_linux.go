@@ -0,0 +1,58 @@
+//go:build linux
+
+package scanner
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const haveMounts = true
+
+// listMounts reads the mount table from /proc/self/mountinfo.
+func listMounts() ([]mount, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mounts []mount
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw
+		fields, rest, ok := strings.Cut(sc.Text(), " - ")
+		if !ok {
+			continue
+		}
+		f := strings.Fields(fields)
+		r := strings.Fields(rest)
+		if len(f) < 5 || len(r) < 1 {
+			continue
+		}
+		mounts = append(mounts, mount{Path: unescapeMount(f[4]), FSType: r[0]})
+	}
+	return mounts, sc.Err()
+}
+
+// unescapeMount decodes the octal escapes (\040 for space, etc.) the kernel
+// uses in mount paths.
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package scanner
+
+const haveMounts = false
+
+// listMounts is only implemented on Linux; elsewhere the whole scan is
+// treated as a single filesystem.
+func listMounts() ([]mount, error) {
+	return nil, nil
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package scanner
+
+import "os"
+
+const haveOwners = false
+
+func ownerIDs(info os.FileInfo) (uid, gid uint32, ok bool) {
+	return 0, 0, false
+}
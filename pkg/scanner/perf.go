@@ -0,0 +1,110 @@
+package scanner
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Performance breaks down where a scan spent its time, for Options.Profile.
+// The walk runs in one goroutine, so its times add up to at most the
+// scan's Duration; the workers' times are summed over all of them.
+type Performance struct {
+	// ReadDir and WalkStat are the time the walk spent listing directories
+	// and calling Lstat on their entries, and WalkBlocked the time it
+	// waited for room in the path queue because the workers were behind.
+	ReadDir     time.Duration
+	WalkStat    time.Duration
+	WalkBlocked time.Duration
+
+	// Workers is how many workers ran, and WorkerTime how long they ran
+	// together: Workers times the time from their start to the last one
+	// finishing. A worker not running for want of a CPU counts as idle.
+	Workers    int
+	WorkerTime time.Duration
+	// Busy is the time workers spent processing paths: calling Lstat
+	// (Stat), hashing (Hash), running Options.Inspect (Inspect) and
+	// waiting for room in the record queue because the sinks were behind
+	// (RecordWait), among the rest.
+	Busy       time.Duration
+	Stat       time.Duration
+	Hash       time.Duration
+	Inspect    time.Duration
+	RecordWait time.Duration
+	// PathWait is the time workers waited for the walk to find a path, and
+	// MountWait the time they waited for a filesystem's concurrency limit.
+	PathWait  time.Duration
+	MountWait time.Duration
+
+	// Sinks is the time spent in the sinks' Write methods.
+	Sinks time.Duration
+}
+
+// Utilization returns the share of the workers' time they were busy. With
+// adaptive concurrency, workers beyond a filesystem's current limit sit
+// idle, so it is low even when the walk keeps up.
+func (p *Performance) Utilization() float64 {
+	if p.WorkerTime <= 0 {
+		return 0
+	}
+	return float64(p.Busy) / float64(p.WorkerTime)
+}
+
+type perfCounter int
+
+const (
+	perfReadDir perfCounter = iota
+	perfWalkStat
+	perfWalkBlocked
+	perfWorkerTime
+	perfBusy
+	perfStat
+	perfHash
+	perfInspect
+	perfRecordWait
+	perfPathWait
+	perfMountWait
+	perfSinks
+	perfCounters
+)
+
+// perfTimes sums the time spent in each part of a scan, in nanoseconds.
+// A nil *perfTimes records nothing, and doesn't read the clock.
+type perfTimes [perfCounters]atomic.Int64
+
+func (p *perfTimes) now() time.Time {
+	if p == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+func (p *perfTimes) since(c perfCounter, start time.Time) {
+	if p != nil {
+		p[c].Add(int64(time.Since(start)))
+	}
+}
+
+func (p *perfTimes) add(c perfCounter, d time.Duration) {
+	if p != nil {
+		p[c].Add(int64(d))
+	}
+}
+
+func (p *perfTimes) result(workers int) *Performance {
+	d := func(c perfCounter) time.Duration { return time.Duration(p[c].Load()) }
+	return &Performance{
+		ReadDir:     d(perfReadDir),
+		WalkStat:    d(perfWalkStat),
+		WalkBlocked: d(perfWalkBlocked),
+		Workers:     workers,
+		WorkerTime:  d(perfWorkerTime),
+		Busy:        d(perfBusy),
+		Stat:        d(perfStat),
+		Hash:        d(perfHash),
+		Inspect:     d(perfInspect),
+		RecordWait:  d(perfRecordWait),
+		PathWait:    d(perfPathWait),
+		MountWait:   d(perfMountWait),
+		Sinks:       d(perfSinks),
+	}
+}
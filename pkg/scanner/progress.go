@@ -0,0 +1,102 @@
+package scanner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Estimate is the expected size of a scan, from an earlier scan of the same
+// root or a pre-count. Items counts files and directories together.
+type Estimate struct {
+	Items  int64
+	Bytes  int64
+	Source string
+}
+
+const progressBarWidth = 30
+
+// progressBar renders "[#####.....]  42.0% | ETA 3m10s" for done items out
+// of est. The estimate may be off, so the bar stops short of 100% and the
+// ETA is dropped once the scan runs past it.
+func progressBar(done int64, est *Estimate, elapsed time.Duration) string {
+	frac := float64(done) / float64(est.Items)
+	if frac > 0.999 {
+		frac = 0.999
+	}
+	filled := int(frac * progressBarWidth)
+	bar := strings.Repeat("#", filled) + strings.Repeat(".", progressBarWidth-filled)
+
+	eta := "ETA --"
+	if done > 0 && done < est.Items {
+		remaining := time.Duration(float64(elapsed) * (1 - frac) / frac)
+		eta = "ETA " + remaining.Truncate(time.Second).String()
+	}
+	return fmt.Sprintf("[%s] %5.1f%% | %s", bar, frac*100, eta)
+}
+
+// Precount quickly counts the entries below root, honouring the default
+// skip rules, by reading directories in parallel without stat'ing files.
+// It is much cheaper than a scan and gives the progress bar its estimate.
+func Precount(root string) *Estimate {
+	skips := newSkipRules(defaultSkipPaths, root)
+	var (
+		mu      sync.Mutex
+		cond    = sync.NewCond(&mu)
+		pending = []string{root}
+		active  int
+		items   int64 = 1
+	)
+
+	worker := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for {
+			for len(pending) == 0 && active > 0 {
+				cond.Wait()
+			}
+			if len(pending) == 0 {
+				cond.Broadcast()
+				return
+			}
+			dir := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			active++
+			mu.Unlock()
+
+			entries, _ := os.ReadDir(dir)
+			var subdirs []string
+			var n int64
+			for _, e := range entries {
+				path := filepath.Join(dir, e.Name())
+				if skips.match(path) != "" {
+					continue
+				}
+				n++
+				if e.IsDir() {
+					subdirs = append(subdirs, path)
+				}
+			}
+
+			mu.Lock()
+			active--
+			items += n
+			pending = append(pending, subdirs...)
+			cond.Broadcast()
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < cpuCount()*4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker()
+		}()
+	}
+	wg.Wait()
+	return &Estimate{Items: items, Source: "pre-count"}
+}
@@ -0,0 +1,107 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+)
+
+// defaultPathQueue is how many discovered paths may wait for a worker
+// unless Options.PathQueue says otherwise.
+const defaultPathQueue = 1000
+
+// stealQueue holds the paths waiting for workers in one bounded deque per
+// worker. The walk deals paths out round robin, waiting while every deque
+// is full; a worker takes the newest path from its own deque and, when
+// that is empty, steals the oldest from the fullest other deque, so one
+// worker stuck on a slow directory doesn't leave the rest idle while paths
+// pile up behind it.
+type stealQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	deques [][]string
+	depth  int
+	next   int
+	queued int
+	closed bool // no more paths will be pushed
+	ctx    context.Context
+}
+
+// newStealQueue makes deques for workers holding depth paths each. They
+// are released when ctx is cancelled.
+func newStealQueue(ctx context.Context, workers, depth int) *stealQueue {
+	q := &stealQueue{deques: make([][]string, workers), depth: max(1, depth), ctx: ctx}
+	q.cond = sync.NewCond(&q.mu)
+	context.AfterFunc(ctx, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.cond.Broadcast()
+	})
+	return q
+}
+
+// push adds path to the next deque with room, reporting false once the
+// scan is cancelled.
+func (q *stealQueue) push(path string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.ctx.Err() == nil {
+		for i := range q.deques {
+			w := (q.next + i) % len(q.deques)
+			if len(q.deques[w]) < q.depth {
+				q.deques[w] = append(q.deques[w], path)
+				q.next = w + 1
+				q.queued++
+				q.cond.Broadcast()
+				return true
+			}
+		}
+		q.cond.Wait()
+	}
+	return false
+}
+
+// close tells the workers no more paths are coming.
+func (q *stealQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// pop returns the next path for worker w, waiting for one. It reports
+// false once the queue is closed and empty, or the scan is cancelled.
+func (q *stealQueue) pop(w int) (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.ctx.Err() == nil {
+		if own := q.deques[w]; len(own) > 0 {
+			path := own[len(own)-1]
+			q.deques[w] = own[:len(own)-1]
+			return q.took(path), true
+		}
+		if q.queued > 0 {
+			victim := 0
+			for i, d := range q.deques {
+				if len(d) > len(q.deques[victim]) {
+					victim = i
+				}
+			}
+			d := q.deques[victim]
+			path := d[0]
+			q.deques[victim] = d[1:]
+			return q.took(path), true
+		}
+		if q.closed {
+			return "", false
+		}
+		q.cond.Wait()
+	}
+	return "", false
+}
+
+// took accounts for a path leaving the queue, waking a waiting push.
+func (q *stealQueue) took(path string) string {
+	q.queued--
+	q.cond.Broadcast()
+	return path
+}
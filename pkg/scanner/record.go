@@ -0,0 +1,163 @@
+package scanner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// FileRecord describes one entry seen during a scan. Records are handed to
+// sinks as they are produced and are not retained by the scanner.
+type FileRecord struct {
+	Path    string
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+	IsDir   bool
+	Hash    string
+	// UID and GID are only meaningful when HasOwner is set; platforms
+	// without numeric ownership leave it false.
+	UID      uint32
+	GID      uint32
+	HasOwner bool
+	// CloudOnly marks a cloud-sync placeholder whose data is not stored
+	// locally. Such files are not hashed, since reading them would
+	// download them.
+	CloudOnly bool
+	// Inspection is what Options.Inspect returned for the file.
+	Inspection any
+}
+
+// HashCache remembers the hashes of files between scans, so that unchanged
+// files need not be read again; hashcache.Cache is one. It must be safe for
+// concurrent use.
+type HashCache interface {
+	// Lookup returns the hash remembered for the file at path, if info
+	// still describes the file that was hashed.
+	Lookup(path string, info os.FileInfo) (string, bool)
+	// Store remembers the hex SHA-256 hash of the file.
+	Store(path string, info os.FileInfo, hash string)
+}
+
+// Sink consumes per-entry records. Write is only ever called from a single
+// goroutine, so implementations don't need their own locking.
+type Sink interface {
+	Write(rec *FileRecord) error
+}
+
+const defaultRecordQueue = 4096
+
+func (s *Scanner) emit(path string, info os.FileInfo) {
+	if s.records == nil {
+		return
+	}
+
+	rec := &FileRecord{
+		Path:    path,
+		Size:    info.Size(),
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+		IsDir:   info.IsDir(),
+	}
+	rec.UID, rec.GID, rec.HasOwner = ownerIDs(info)
+	rec.CloudOnly = !info.IsDir() && isCloudOnly(info)
+	if s.opts.Hash && info.Mode().IsRegular() && !rec.CloudOnly {
+		started := s.perf.now()
+		rec.Hash = s.hash(path, info)
+		s.perf.since(perfHash, started)
+	}
+	if s.opts.Inspect != nil && info.Mode().IsRegular() && !rec.CloudOnly {
+		started := s.perf.now()
+		v, err := s.opts.Inspect(s.ctx, path, info)
+		s.perf.since(perfInspect, started)
+		if err != nil && s.ctx.Err() == nil {
+			atomic.AddInt64(&s.errorCount, 1)
+			s.rootError(path)
+			s.setLastError(fmt.Sprintf("Error inspecting %s: %v", path, err))
+			s.visitError(path, err)
+		}
+		rec.Inspection = v
+	}
+
+	waited := s.perf.now()
+	select {
+	case s.records <- rec:
+	case <-s.ctx.Done():
+	}
+	s.perf.since(perfRecordWait, waited)
+}
+
+// hash returns the SHA-256 of the regular file at path, from the hash cache
+// if it has it, or "" if it can't be read.
+func (s *Scanner) hash(path string, info os.FileInfo) string {
+	cache := s.opts.HashCache
+	if cache != nil {
+		if hash, ok := cache.Lookup(path, info); ok {
+			return hash
+		}
+	}
+	hash, err := hashFile(s.ctx, s.fs, path)
+	switch {
+	case err == nil && cache != nil:
+		cache.Store(path, info, hash)
+	case err != nil && s.ctx.Err() == nil:
+		atomic.AddInt64(&s.errorCount, 1)
+		s.rootError(path)
+		s.setLastError(fmt.Sprintf("Error hashing %s: %v", path, err))
+		s.visitError(path, err)
+	}
+	return hash
+}
+
+// dispatch drains the record queue into every sink. The first write error
+// stops the scan, since a truncated inventory is worse than none.
+func (s *Scanner) dispatch(done chan<- struct{}) {
+	defer close(done)
+	for rec := range s.records {
+		if s.Err() != nil {
+			continue
+		}
+		started := s.perf.now()
+		for _, sink := range s.opts.Sinks {
+			if err := sink.Write(rec); err != nil {
+				s.setErr(err)
+				s.cancel()
+				break
+			}
+		}
+		s.perf.since(perfSinks, started)
+	}
+}
+
+// hashFile returns the hex SHA-256 of path. It gives up between reads once
+// ctx is cancelled, so Stop isn't held up by a large file.
+func hashFile(ctx context.Context, fsys fileSystem, path string) (string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, ctxReader{ctx, f}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,61 @@
+package scanner
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// extentKey identifies a range of physical storage shared between files:
+// an extent's device and physical offset, or on APFS a clone group.
+type extentKey struct {
+	dev uint64
+	id  uint64
+}
+
+// sharedExtent is part of a file whose storage other files may share.
+type sharedExtent struct {
+	key    extentKey
+	length int64
+}
+
+// cloneTracker adds up the storage files really take up when some of it is
+// shared through reflinks or clones: each shared extent is counted the
+// first time a file using it is seen.
+type cloneTracker struct {
+	physical int64
+	shared   int64
+
+	mu   sync.Mutex
+	seen map[extentKey]bool
+}
+
+func newCloneTracker() *cloneTracker {
+	return &cloneTracker{seen: make(map[extentKey]bool)}
+}
+
+// add accounts the regular file at path. Files whose extents can't be read
+// count their whole size as unique.
+func (t *cloneTracker) add(path string, info os.FileInfo) {
+	unique, shared, err := fileClones(path, info)
+	if err != nil {
+		atomic.AddInt64(&t.physical, info.Size())
+		return
+	}
+	atomic.AddInt64(&t.physical, unique)
+	if len(shared) == 0 {
+		return
+	}
+	var first, total int64
+	t.mu.Lock()
+	for _, e := range shared {
+		total += e.length
+		if !t.seen[e.key] {
+			t.seen[e.key] = true
+			first += e.length
+		}
+	}
+	t.mu.Unlock()
+	atomic.AddInt64(&t.physical, first)
+	atomic.AddInt64(&t.shared, total)
+}
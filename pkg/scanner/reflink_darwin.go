@@ -0,0 +1,58 @@
+package scanner
+
+import (
+	"encoding/binary"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const haveReflinks = true
+
+const (
+	attrBitMapCount      = 5
+	fsoptNoFollow        = 0x1
+	fsoptAttrCmnExtended = 0x20
+	attrCmnExtPrivate    = 0x8   // ATTR_CMNEXT_PRIVATESIZE
+	attrCmnExtCloneID    = 0x100 // ATTR_CMNEXT_CLONEID
+)
+
+type attrList struct {
+	bitmapCount uint16
+	reserved    uint16
+	commonAttr  uint32
+	volAttr     uint32
+	dirAttr     uint32
+	fileAttr    uint32
+	forkAttr    uint32 // ATTR_CMNEXT_* with FSOPT_ATTR_CMN_EXTENDED
+}
+
+// fileClones asks APFS how much of a file's storage is private to it. The
+// rest is shared with its clones and keyed by the file's clone id, so a
+// family of clones counts its shared storage once. APFS doesn't say which
+// blocks are shared, so files that diverged differently from the same
+// original make this an estimate.
+func fileClones(path string, info os.FileInfo) (unique int64, shared []sharedExtent, err error) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, nil, syscall.ENOTSUP
+	}
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	al := attrList{bitmapCount: attrBitMapCount, forkAttr: attrCmnExtPrivate | attrCmnExtCloneID}
+	var buf [4 + 8 + 8]byte
+	_, _, errno := syscall.Syscall6(syscall.SYS_GETATTRLIST, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&al)),
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), fsoptNoFollow|fsoptAttrCmnExtended, 0)
+	if errno != 0 {
+		return 0, nil, errno
+	}
+	private := int64(binary.LittleEndian.Uint64(buf[4:]))
+	cloneID := binary.LittleEndian.Uint64(buf[12:])
+	allocated := st.Blocks * 512
+	if cloneID == 0 || allocated <= private {
+		return private, nil, nil
+	}
+	return private, []sharedExtent{{extentKey{uint64(st.Dev), cloneID}, allocated - private}}, nil
+}
@@ -0,0 +1,70 @@
+package scanner
+
+import (
+	"encoding/binary"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const haveReflinks = true
+
+const (
+	fsIocFiemap        = 0xc020660b // _IOWR('f', 11, struct fiemap)
+	fiemapHeaderSize   = 32
+	fiemapExtentSize   = 56
+	fiemapBatch        = 128
+	fiemapExtentLast   = 0x1
+	fiemapExtentShared = 0x2000
+)
+
+// fileClones reads the extent map of a file with FIEMAP. Extents flagged
+// as shared (reflinked on XFS and Btrfs, or kept in a snapshot) are
+// returned keyed by their physical offset; the rest is unique. Lengths
+// are in file bytes, like TotalBytes, not whole blocks.
+func fileClones(path string, info os.FileInfo) (unique int64, shared []sharedExtent, err error) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, nil, syscall.ENOTSUP
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	le := binary.LittleEndian
+	buf := make([]byte, fiemapHeaderSize+fiemapExtentSize*fiemapBatch)
+	var start uint64
+	for {
+		clear(buf)
+		le.PutUint64(buf[0:], start)
+		le.PutUint64(buf[8:], ^uint64(0)-start)
+		le.PutUint32(buf[24:], fiemapBatch)
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), fsIocFiemap, uintptr(unsafe.Pointer(&buf[0]))); errno != 0 {
+			return 0, nil, errno
+		}
+		n := int(le.Uint32(buf[20:]))
+		if n == 0 {
+			return unique, shared, nil
+		}
+		for i := 0; i < n; i++ {
+			e := buf[fiemapHeaderSize+fiemapExtentSize*i:]
+			logical, physical, length := le.Uint64(e[0:]), le.Uint64(e[8:]), le.Uint64(e[16:])
+			flags := le.Uint32(e[40:])
+			if end := uint64(info.Size()); logical+length > end {
+				// The last extent is rounded up to whole blocks.
+				length = end - min(logical, end)
+			}
+			if flags&fiemapExtentShared != 0 && physical != 0 {
+				shared = append(shared, sharedExtent{extentKey{uint64(st.Dev), physical}, int64(length)})
+			} else {
+				unique += int64(length)
+			}
+			if flags&fiemapExtentLast != 0 {
+				return unique, shared, nil
+			}
+			start = logical + length
+		}
+	}
+}
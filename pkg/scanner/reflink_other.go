@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package scanner
+
+import (
+	"os"
+	"syscall"
+)
+
+const haveReflinks = false
+
+// fileClones is not implemented here; every file counts as unique.
+func fileClones(path string, info os.FileInfo) (int64, []sharedExtent, error) {
+	return 0, nil, syscall.ENOTSUP
+}
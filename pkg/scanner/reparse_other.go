@@ -0,0 +1,12 @@
+//go:build !windows
+
+package scanner
+
+import "os"
+
+const haveReparsePoints = false
+
+// reparseKind is Windows-only; symbolic links elsewhere count as files.
+func reparseKind(path string, info os.FileInfo) string {
+	return ""
+}
@@ -0,0 +1,50 @@
+//go:build windows
+
+package scanner
+
+import (
+	"os"
+	"syscall"
+)
+
+const haveReparsePoints = true
+
+const (
+	reparseTagMountPoint = 0xa0000003
+	reparseTagSymlink    = 0xa000000c
+	// reparseTagNameSurrogate marks tags whose reparse point stands for
+	// another named entity, as opposed to data stored elsewhere (cloud,
+	// deduplicated or compressed files).
+	reparseTagNameSurrogate = 0x20000000
+)
+
+// reparseKind names a reparse point that refers to another path —
+// "junction", "symlink" or "reparse point" for other name surrogates such
+// as WSL links — or returns "" for anything else. Reparse points holding
+// data, such as OneDrive or deduplicated files, count as ordinary entries.
+func reparseKind(path string, info os.FileInfo) string {
+	d, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok || d.FileAttributes&syscall.FILE_ATTRIBUTE_REPARSE_POINT == 0 {
+		return ""
+	}
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return ""
+	}
+	var fd syscall.Win32finddata
+	h, err := syscall.FindFirstFile(p, &fd)
+	if err != nil {
+		// Err on the side of not descending into it.
+		return "reparse point"
+	}
+	syscall.FindClose(h)
+	switch tag := fd.Reserved0; {
+	case tag == reparseTagMountPoint:
+		return "junction"
+	case tag == reparseTagSymlink:
+		return "symlink"
+	case tag&reparseTagNameSurrogate != 0:
+		return "reparse point"
+	}
+	return ""
+}
@@ -0,0 +1,153 @@
+package scanner
+
+import (
+	"sort"
+	"time"
+)
+
+// Merge returns the combined result of two scans of different trees, such
+// as the roots of a multi-root scan or the same path on several hosts. The
+// scans are taken to have run at the same time: Duration is the longer of
+// the two and FilesPerSecond is worked out again from the merged totals,
+// rather than added up. Skip and snapshot statistics are merged by rule and
+// path, mount statistics by mount point, and the result is only Completed
+// if both were. Neither operand is changed.
+func (r *ScanResult) Merge(o *ScanResult) *ScanResult {
+	m := r.combine(o, 1)
+	m.Duration = max(r.Duration, o.Duration)
+	m.FilesPerSecond = rate(m.TotalFiles, m.Duration)
+	m.Mounts = mergeMounts(r.Mounts, o.Mounts)
+	m.Completed = r.Completed && o.Completed
+	return m
+}
+
+// Add returns r with the changes in d applied, d typically being the
+// difference between two scans from Sub. Durations are added and
+// FilesPerSecond is worked out again, so that a.Add(b.Sub(a)) has the
+// totals, duration and rate of b. Mount statistics are r's.
+func (r *ScanResult) Add(d *ScanResult) *ScanResult {
+	m := r.combine(d, 1)
+	m.Duration = r.Duration + d.Duration
+	m.FilesPerSecond = rate(m.TotalFiles, m.Duration)
+	m.Mounts = append([]MountStats(nil), r.Mounts...)
+	m.Completed = r.Completed && d.Completed
+	return m
+}
+
+// Sub returns how r differs from an earlier scan o of the same tree: every
+// count is r's minus o's, as are Duration and FilesPerSecond, so a
+// negative rate means the later scan was slower. Skip and snapshot entries
+// that come out at zero are dropped, and mount statistics, which don't
+// subtract meaningfully, are left out.
+func (r *ScanResult) Sub(o *ScanResult) *ScanResult {
+	d := r.combine(o, -1)
+	d.Duration = r.Duration - o.Duration
+	d.FilesPerSecond = r.FilesPerSecond - o.FilesPerSecond
+	d.Completed = r.Completed && o.Completed
+	return d
+}
+
+// combine adds sign times the counts of o to those of r.
+func (r *ScanResult) combine(o *ScanResult, sign int64) *ScanResult {
+	return &ScanResult{
+		TotalFiles:         r.TotalFiles + sign*o.TotalFiles,
+		TotalDirs:          r.TotalDirs + sign*o.TotalDirs,
+		TotalErrors:        r.TotalErrors + sign*o.TotalErrors,
+		TotalSkipped:       r.TotalSkipped + sign*o.TotalSkipped,
+		Skipped:            combineSkips(r.Skipped, o.Skipped, sign),
+		TotalBytes:         r.TotalBytes + sign*o.TotalBytes,
+		TotalHardlinks:     r.TotalHardlinks + sign*o.TotalHardlinks,
+		TotalReparsePoints: r.TotalReparsePoints + sign*o.TotalReparsePoints,
+		CloudOnlyFiles:     r.CloudOnlyFiles + sign*o.CloudOnlyFiles,
+		CloudOnlyBytes:     r.CloudOnlyBytes + sign*o.CloudOnlyBytes,
+		Snapshots:          combineSnapshots(r.Snapshots, o.Snapshots, sign),
+		PhysicalBytes:      r.PhysicalBytes + sign*o.PhysicalBytes,
+		SharedBytes:        r.SharedBytes + sign*o.SharedBytes,
+		VisitedInodes:      r.VisitedInodes + sign*o.VisitedInodes,
+		VisitedBytes:       r.VisitedBytes + sign*o.VisitedBytes,
+	}
+}
+
+func rate(files int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(files) / d.Seconds()
+}
+
+func combineSkips(a, b []SkipStats, sign int64) []SkipStats {
+	byRule := map[string]*SkipStats{}
+	add := func(st SkipStats, sign int64) {
+		m := byRule[st.Rule]
+		if m == nil {
+			m = &SkipStats{Rule: st.Rule}
+			byRule[st.Rule] = m
+		}
+		m.Count, m.Entries, m.Bytes = m.Count+sign*st.Count, m.Entries+sign*st.Entries, m.Bytes+sign*st.Bytes
+	}
+	for _, st := range a {
+		add(st, 1)
+	}
+	for _, st := range b {
+		add(st, sign)
+	}
+	var out []SkipStats
+	for _, m := range byRule {
+		if *m != (SkipStats{Rule: m.Rule}) {
+			out = append(out, *m)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Rule < out[j].Rule })
+	return out
+}
+
+func combineSnapshots(a, b []SnapshotStats, sign int64) []SnapshotStats {
+	byPath := map[string]*SnapshotStats{}
+	add := func(st SnapshotStats, sign int64) {
+		m := byPath[st.Path]
+		if m == nil {
+			m = &SnapshotStats{Path: st.Path, Kind: st.Kind}
+			byPath[st.Path] = m
+		}
+		m.Files, m.Dirs, m.Bytes = m.Files+sign*st.Files, m.Dirs+sign*st.Dirs, m.Bytes+sign*st.Bytes
+	}
+	for _, st := range a {
+		add(st, 1)
+	}
+	for _, st := range b {
+		add(st, sign)
+	}
+	var out []SnapshotStats
+	for _, m := range byPath {
+		if m.Files != 0 || m.Dirs != 0 || m.Bytes != 0 || sign > 0 {
+			out = append(out, *m)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// mergeMounts combines the statistics of mounts scanned by either result.
+// Operations add up, latencies are averaged weighted by operations and the
+// worker limits are the higher of the two.
+func mergeMounts(a, b []MountStats) []MountStats {
+	var out []MountStats
+	index := map[string]int{}
+	for _, ms := range append(append([]MountStats(nil), a...), b...) {
+		i, ok := index[ms.Path]
+		if !ok {
+			index[ms.Path] = len(out)
+			out = append(out, ms)
+			continue
+		}
+		m := &out[i]
+		if ops := m.Operations + ms.Operations; ops > 0 {
+			m.AvgLatency = time.Duration((int64(m.AvgLatency)*m.Operations + int64(ms.AvgLatency)*ms.Operations) / ops)
+		}
+		m.Operations += ms.Operations
+		m.Workers = max(m.Workers, ms.Workers)
+		m.PeakWorkers = max(m.PeakWorkers, ms.PeakWorkers)
+		m.Adaptive = m.Adaptive || ms.Adaptive
+	}
+	return out
+}
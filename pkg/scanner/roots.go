@@ -0,0 +1,112 @@
+package scanner
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// rootStats counts what one root of a multi-root scan contributed. first
+// and last are the UnixNano times its first and last entries were
+// processed.
+type rootStats struct {
+	path                                string
+	files, dirs, bytes, errors, skipped int64
+	first, last                         int64
+}
+
+// StartRoots scans several roots as one scan: they share the workers,
+// sinks and progress display, and the first result is the combined
+// totals. The map holds the totals of each root, keyed as given, with
+// Duration running from the first entry of the root processed to the
+// last. A root that lies inside another one, or is given twice, is only
+// scanned once, and has no entry of its own.
+func (s *Scanner) StartRoots(roots []string) (*ScanResult, map[string]*ScanResult) {
+	s.begin()
+	var keys []string
+	for _, root := range roots {
+		clean := filepath.Clean(root)
+		covered := false
+		for _, other := range roots {
+			o := filepath.Clean(other)
+			if o != clean && within(clean, o) {
+				covered = true
+			}
+		}
+		for _, r := range s.roots {
+			covered = covered || r.path == clean
+		}
+		if !covered {
+			s.roots = append(s.roots, &rootStats{path: clean})
+			keys = append(keys, root)
+		}
+	}
+	var walked []string
+	for _, r := range s.roots {
+		walked = append(walked, r.path)
+	}
+	s.logf("Starting scan of %d roots\n", len(s.roots))
+	result := s.runRoots(walked, func(pathChan chan<- string) {
+		for _, root := range walked {
+			if s.ctx.Err() != nil {
+				return
+			}
+			s.walkDirectory(root, pathChan)
+		}
+	})
+
+	perRoot := make(map[string]*ScanResult, len(keys))
+	for i, r := range s.roots {
+		res := &ScanResult{
+			TotalFiles:   atomic.LoadInt64(&r.files),
+			TotalDirs:    atomic.LoadInt64(&r.dirs),
+			TotalBytes:   atomic.LoadInt64(&r.bytes),
+			TotalErrors:  atomic.LoadInt64(&r.errors),
+			TotalSkipped: atomic.LoadInt64(&r.skipped),
+			Completed:    result.Completed,
+		}
+		if first := atomic.LoadInt64(&r.first); first != 0 {
+			res.Duration = time.Duration(atomic.LoadInt64(&r.last) - first)
+			res.FilesPerSecond = rate(res.TotalFiles, res.Duration)
+		}
+		perRoot[keys[i]] = res
+	}
+	return result, perRoot
+}
+
+// root returns the root path falls under in a multi-root scan, or nil.
+func (s *Scanner) root(path string) *rootStats {
+	for _, r := range s.roots {
+		if within(path, r.path) {
+			return r
+		}
+	}
+	return nil
+}
+
+// rootCount adds an entry processed below its root.
+func (s *Scanner) rootCount(path string, files, dirs, bytes int64) {
+	r := s.root(path)
+	if r == nil {
+		return
+	}
+	atomic.AddInt64(&r.files, files)
+	atomic.AddInt64(&r.dirs, dirs)
+	atomic.AddInt64(&r.bytes, bytes)
+	now := time.Now().UnixNano()
+	atomic.CompareAndSwapInt64(&r.first, 0, now)
+	for last := atomic.LoadInt64(&r.last); now > last && !atomic.CompareAndSwapInt64(&r.last, last, now); last = atomic.LoadInt64(&r.last) {
+	}
+}
+
+func (s *Scanner) rootError(path string) {
+	if r := s.root(path); r != nil {
+		atomic.AddInt64(&r.errors, 1)
+	}
+}
+
+func (s *Scanner) rootSkipped(path string) {
+	if r := s.root(path); r != nil {
+		atomic.AddInt64(&r.skipped, 1)
+	}
+}
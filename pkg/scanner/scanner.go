@@ -3,9 +3,12 @@ package scanner
 import (
 	"context"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
-	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -17,6 +20,7 @@ type Scanner struct {
 	skippedCount   int64
 	bytesScanned   int64
 	startTime      time.Time
+	endTime        time.Time
 	ctx            context.Context
 	cancel         context.CancelFunc
 	workerCount    int
@@ -24,153 +28,719 @@ type Scanner struct {
 	mu             sync.Mutex
 	lastError      string
 	currentPath    string
+	hardlinkCount  int64
+	visited        *inodeSet
+	opts           Options
+	records        chan *FileRecord
+	err            error
+	mounts         *mountPool
+	skips          *skipRules
+	skipPaths      []string
+	reparseCount   int64
+	cloudCount     int64
+	cloudBytes     int64
+	followed       map[string]bool
+	snapshots      []SnapshotStats
+	clones         *cloneTracker
+	roots          []*rootStats
+	dirs           chan DirSummary
+	dirStack       []*dirFrame
+	slowDirs       *slowDirs
+	perf           *perfTimes
+	fs             fileSystem
+	ran            bool
+	walking        chan struct{}
 }
 type ScanResult struct {
-	TotalFiles     int64
-	TotalDirs      int64
-	TotalErrors    int64
-	TotalSkipped   int64
+	TotalFiles   int64
+	TotalDirs    int64
+	TotalErrors  int64
+	TotalSkipped int64
+	// Skipped breaks TotalSkipped down by the rule that pruned each entry.
+	Skipped        []SkipStats
 	TotalBytes     int64
 	Duration       time.Duration
 	FilesPerSecond float64
+	TotalHardlinks int64
+	// TotalReparsePoints counts the Windows junctions, symbolic links and
+	// other reparse points that refer to another path. They are not
+	// included in TotalFiles.
+	TotalReparsePoints int64
+	// CloudOnlyFiles and CloudOnlyBytes count the cloud-sync placeholders
+	// (OneDrive, Dropbox, iCloud) included in TotalFiles and TotalBytes
+	// whose data is not on the local disk.
+	CloudOnlyFiles int64
+	CloudOnlyBytes int64
+	// Snapshots lists the ZFS and Btrfs snapshots found below the root;
+	// what happened to them depends on Options.Snapshots.
+	Snapshots []SnapshotStats
+	// PhysicalBytes and SharedBytes are only set with Options.Reflinks.
+	// PhysicalBytes is the storage the files take up, counting extents
+	// shared through reflinks or clones once; SharedBytes is how much of
+	// TotalBytes lies in such extents.
+	PhysicalBytes int64
+	SharedBytes   int64
+	VisitedInodes int64
+	VisitedBytes  int64
+	Mounts        []MountStats
+	// Completed is false when the scan was cut short by Stop, Timeout or a
+	// sink error; the totals then only cover what was reached.
+	Completed bool
+	// SlowestDirs lists the Options.SlowestDirs directories that took the
+	// walk longest to enumerate, slowest first.
+	SlowestDirs []DirTiming
+	// Performance is only set with Options.Profile.
+	Performance *Performance
 }
+type Options struct {
+	// Workers fixes the number of workers. By default the concurrency is
+	// tuned per filesystem while scanning, starting from twice the
+	// available CPUs (GOMAXPROCS or the cgroup CPU quota, if lower).
+	Workers int
+	// MountLimits caps the concurrent operations on a filesystem, keyed by
+	// mount point ("/mnt/nas") or filesystem type ("nfs", "cifs").
+	MountLimits map[string]int
+	// DedupHardlinks counts files with several hard links only once.
+	DedupHardlinks bool
+	// Sinks receive a FileRecord for every file and directory scanned,
+	// through a queue of RecordQueue entries (default 4096, smaller under a
+	// cgroup memory limit).
+	Sinks       []Sink
+	RecordQueue int
+	// PathQueue is how many paths the walk may find ahead of the workers
+	// (default 1000). A deeper queue keeps many fast workers busy; a
+	// shallower one holds less in memory while a slow filesystem catches
+	// up. Either way the walk waits once it is full.
+	PathQueue int
+	// WorkStealing splits the path queue into one bounded deque per
+	// worker, with idle workers stealing from the fullest, instead of one
+	// shared queue.
+	WorkStealing bool
+	// Hash fills in FileRecord.Hash with the SHA-256 of regular files.
+	Hash bool
+	// HashCache, when set, is asked for the hash of each file before it
+	// is read for Hash, and told the hashes that had to be computed. It is
+	// ignored when FS or FileSystem is set, whose paths aren't on the disk.
+	HashCache HashCache
+	// Inspect, when set, is called by the scanning workers for every
+	// regular file that is stored locally, and what it returns is handed to
+	// sinks in FileRecord.Inspection. It must be safe for concurrent use;
+	// its errors are counted like read errors.
+	Inspect func(ctx context.Context, path string, info os.FileInfo) (any, error)
+	// Visitor, when set, is called with every entry and error as the
+	// workers process them.
+	Visitor FileVisitor
+	// OnProgress is called every ProgressInterval (default 1s) with the
+	// running totals, and once more when the scan finishes.
+	OnProgress       func(Stats)
+	ProgressInterval time.Duration
+	// Timeout stops the scan once it has run this long.
+	Timeout time.Duration
+	// LogInterval is how often the progress display prints a line when
+	// standard output is not a terminal (default 10s). Piped or redirected
+	// to a file, as in CI logs, it prints one line each time instead of
+	// redrawing in place.
+	LogInterval time.Duration
+	// Estimate, when known, turns the progress display into a percentage
+	// bar with an ETA.
+	Estimate *Estimate
+	// Quiet turns off the start-up messages and the live progress display.
+	Quiet bool
+	// Filter excludes entries below the root with rsync-style rules. What
+	// each rule excluded is reported in ScanResult.Skipped.
+	Filter *Filter
+	// FollowLinks descends into symbolic links and junctions that point at
+	// directories. A link back to one of its own ancestors, or to a
+	// directory already reached through another link, is not followed and
+	// is reported in ScanResult.Skipped as a "link cycle".
+	FollowLinks bool
+	// Snapshots chooses whether filesystem snapshots are counted, skipped
+	// or counted separately from the totals.
+	Snapshots SnapshotMode
+	// Reflinks reads the extent map of every regular file (FIEMAP on
+	// Linux, clone information on APFS) to find storage shared between
+	// files, reported in ScanResult.PhysicalBytes and SharedBytes.
+	Reflinks bool
+	// FS, when set, is scanned instead of the operating system's
+	// filesystem: Start takes a path within it, such as ".", and records
+	// carry slash-separated paths relative to its root. Embedded files,
+	// zip archives and fstest.MapFS trees can all be scanned this way.
+	// What only makes sense on a real disk is left out: the default skip
+	// paths, snapshots, reflinks, following links and reparse points.
+	FS fs.FS
+	// FileSystem, when set, replaces the calls the scanner makes to list
+	// directories and Lstat entries on the disk; see FileSystem. It is
+	// ignored when FS is set.
+	FileSystem FileSystem
+	// SlowestDirs keeps the timings of this many directories that took
+	// longest to list and Lstat the entries of, such as network mounts or
+	// directories with millions of entries, for ScanResult.SlowestDirs.
+	SlowestDirs int
+	// Profile times the parts of the scan, the walk's directory listing
+	// and Lstat calls, the workers' Lstat calls, hashing and inspection,
+	// and the waits between them, for ScanResult.Performance.
+	Profile bool
+}
+
+// Stats is a snapshot of a scan's counters, as returned by Scanner.Stats
+// and passed to Options.OnProgress.
+type Stats struct {
+	Files       int64
+	Dirs        int64
+	Errors      int64
+	Skipped     int64
+	Bytes       int64
+	Elapsed     time.Duration
+	CurrentPath string
+}
+
 func NewScanner() *Scanner {
+	return NewScannerWithOptions(Options{})
+}
+func NewScannerWithOptions(opts Options) *Scanner {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &Scanner{
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = cpuCount() * 2
+	}
+
+	s := &Scanner{
 		startTime:      time.Now(),
 		ctx:            ctx,
 		cancel:         cancel,
-		workerCount:    runtime.GOMAXPROCS(0) * 2,
+		workerCount:    workers,
 		progressTicker: time.NewTicker(50 * time.Millisecond),
+		opts:           opts,
+		skipPaths:      defaultSkipPaths,
+		fs:             osFS{},
+	}
+	if opts.FileSystem != nil {
+		s.fs, s.opts.HashCache = customFS{opts.FileSystem}, nil
+	}
+	if opts.FS != nil {
+		s.fs, s.skipPaths, s.opts.HashCache = ioFS{opts.FS}, nil, nil
+		s.opts.FollowLinks, s.opts.Reflinks, s.opts.Snapshots = false, false, SnapshotsInclude
+	}
+	if opts.DedupHardlinks {
+		s.visited = newInodeSet()
 	}
+	if s.opts.Reflinks {
+		s.clones = newCloneTracker()
+	}
+	if opts.SlowestDirs > 0 {
+		s.slowDirs = newSlowDirs(opts.SlowestDirs)
+	}
+	if opts.Profile {
+		s.perf = &perfTimes{}
+	}
+	return s
 }
+
+// Start scans the tree below rootPath and returns the totals. A Scanner
+// runs one scan at a time, but can run any number in turn: each Start,
+// StartList or StartRoots after the first resets it as Reset does.
 func (s *Scanner) Start(rootPath string) *ScanResult {
-	fmt.Printf("Starting file system scan from: %s\n", rootPath)
-	fmt.Printf("Using %d worker goroutines\n", s.workerCount)
-	fmt.Println("Press Ctrl+C to stop at any time")
+	s.begin()
+	s.logf("Starting file system scan from: %s\n", rootPath)
+	return s.run(rootPath, s.skipPaths, func(pathChan chan<- string) {
+		s.walkDirectory(rootPath, pathChan)
+	})
+}
+func (s *Scanner) StartList(r io.Reader, delim byte) *ScanResult {
+	s.begin()
+	s.logf("Starting scan of listed paths\n")
+	return s.run("/", nil, func(pathChan chan<- string) {
+		s.readList(r, delim, pathChan)
+	})
+}
+func (s *Scanner) run(rootPath string, skipPaths []string, produce func(chan<- string)) *ScanResult {
+	s.mounts = newMountPool(rootPath, s.opts.Workers, s.opts.MountLimits)
+	s.skips = newSkipRules(skipPaths, rootPath)
+	return s.execute(produce)
+}
+
+// runRoots is run for several roots: the skip rules kept are those that
+// contain none of them.
+func (s *Scanner) runRoots(roots []string, produce func(chan<- string)) *ScanResult {
+	s.mounts = newMountPool("/", s.opts.Workers, s.opts.MountLimits)
+	s.skips = newSkipRules(s.skipPaths, roots...)
+	return s.execute(produce)
+}
+func (s *Scanner) execute(produce func(chan<- string)) *ScanResult {
+	s.skips.fs = s.fs
+	if s.opts.Workers > 0 {
+		s.logf("Using %d worker goroutines\n", s.workerCount)
+	} else {
+		s.workerCount = s.mounts.maxWorkers()
+		s.logf("Using adaptive concurrency (%d to %d workers per filesystem)\n", s.mounts.fallback.limit, maxAdaptiveWorkers)
+	}
+	s.logf("Press Ctrl+C to stop at any time\n")
 
-	go s.displayProgress()
+	if !s.opts.Quiet {
+		go s.displayProgress(s.ctx.Done())
+	}
+	var reported chan struct{}
+	if s.opts.OnProgress != nil {
+		reported = make(chan struct{})
+		go s.reportProgress(reported)
+	}
+
+	var dispatched chan struct{}
+	if len(s.opts.Sinks) > 0 {
+		queue := s.opts.RecordQueue
+		if queue <= 0 {
+			queue = defaultQueueSize()
+		}
+		s.records = make(chan *FileRecord, queue)
+		dispatched = make(chan struct{})
+		go s.dispatch(dispatched)
+	}
 
-	pathChan := make(chan string, 1000)
+	if s.opts.Timeout > 0 {
+		timer := time.AfterFunc(s.opts.Timeout, s.cancel)
+		defer timer.Stop()
+	}
+
+	tuned := make(chan struct{})
+	go s.mounts.tuneLoop(tuned)
+
+	depth := s.opts.PathQueue
+	if depth <= 0 {
+		depth = defaultPathQueue
+	}
+	pathChan := make(chan string, depth)
+	next := func(int) (string, bool) {
+		select {
+		case path, ok := <-pathChan:
+			return path, ok
+		case <-s.ctx.Done():
+			return "", false
+		}
+	}
+	if s.opts.WorkStealing {
+		// The channel only hands paths over to the deques.
+		q := newStealQueue(s.ctx, s.workerCount, (depth+s.workerCount-1)/s.workerCount)
+		pathChan = make(chan string, s.workerCount)
+		go func(paths <-chan string) {
+			defer q.close()
+			for path := range paths {
+				if !q.push(path) {
+					return
+				}
+			}
+		}(pathChan)
+		next = q.pop
+	}
 	var wg sync.WaitGroup
+	launched := s.perf.now()
 	for i := 0; i < s.workerCount; i++ {
 		wg.Add(1)
-		go s.worker(pathChan, &wg)
+		go s.worker(i, next, &wg)
 	}
 
+	walking := make(chan struct{})
+	s.walking = walking
 	go func() {
+		defer close(walking)
 		defer close(pathChan)
-		s.walkDirectory(rootPath, pathChan)
+		produce(pathChan)
+		if s.dirs != nil {
+			close(s.dirs)
+			s.dirs = nil
+		}
 	}()
 
 	wg.Wait()
+	s.perf.add(perfWorkerTime, time.Duration(s.workerCount)*time.Since(launched))
+	close(tuned)
+	if s.records != nil {
+		close(s.records)
+		<-dispatched
+	}
+	completed := s.ctx.Err() == nil
 	s.progressTicker.Stop()
-	duration := time.Since(s.startTime)
+	if reported != nil {
+		reported <- struct{}{}
+		<-reported
+	}
+	duration := s.finish()
 	filesPerSecond := float64(atomic.LoadInt64(&s.fileCount)) / duration.Seconds()
 
-	return &ScanResult{
-		TotalFiles:     atomic.LoadInt64(&s.fileCount),
-		TotalDirs:      atomic.LoadInt64(&s.dirCount),
-		TotalErrors:    atomic.LoadInt64(&s.errorCount),
-		TotalSkipped:   atomic.LoadInt64(&s.skippedCount),
-		TotalBytes:     atomic.LoadInt64(&s.bytesScanned),
-		Duration:       duration,
-		FilesPerSecond: filesPerSecond,
+	result := &ScanResult{
+		TotalFiles:         atomic.LoadInt64(&s.fileCount),
+		TotalDirs:          atomic.LoadInt64(&s.dirCount),
+		TotalErrors:        atomic.LoadInt64(&s.errorCount),
+		TotalSkipped:       atomic.LoadInt64(&s.skippedCount),
+		TotalBytes:         atomic.LoadInt64(&s.bytesScanned),
+		Duration:           duration,
+		FilesPerSecond:     filesPerSecond,
+		TotalHardlinks:     atomic.LoadInt64(&s.hardlinkCount),
+		TotalReparsePoints: atomic.LoadInt64(&s.reparseCount),
+		CloudOnlyFiles:     atomic.LoadInt64(&s.cloudCount),
+		CloudOnlyBytes:     atomic.LoadInt64(&s.cloudBytes),
+		Mounts:             s.mounts.stats(),
+		Completed:          completed,
+		Skipped:            s.skips.stats(),
+		Snapshots:          s.snapshots,
+	}
+	if s.clones != nil {
+		result.PhysicalBytes = atomic.LoadInt64(&s.clones.physical)
+		result.SharedBytes = atomic.LoadInt64(&s.clones.shared)
+	}
+	if s.slowDirs != nil {
+		result.SlowestDirs = s.slowDirs.sorted()
+	}
+	if s.perf != nil {
+		result.Performance = s.perf.result(s.workerCount)
 	}
+	if s.visited != nil {
+		result.VisitedInodes = s.visited.Len()
+		result.VisitedBytes = s.visited.Bytes()
+	}
+	return result
 }
 func (s *Scanner) Stop() {
 	s.cancel()
 }
-func (s *Scanner) worker(pathChan <-chan string, wg *sync.WaitGroup) {
+
+// Reset discards the counts and state of the last scan, so that the next
+// one starts from zero with the same Options. It cancels a Stop that came
+// after the last scan ended. A stopped scan may still be winding down its
+// walk when Start returns; Reset waits for it. It must not be called while
+// a scan is running. A DirSummaries channel asked for since the last scan
+// is kept for the next one.
+func (s *Scanner) Reset() {
+	if s.walking != nil {
+		<-s.walking
+		s.walking = nil
+	}
+	s.cancel()
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.progressTicker.Stop()
+	s.progressTicker = time.NewTicker(50 * time.Millisecond)
+	// Stats may be polled while the counters are reset.
+	for _, n := range []*int64{&s.fileCount, &s.dirCount, &s.errorCount, &s.skippedCount, &s.bytesScanned,
+		&s.hardlinkCount, &s.reparseCount, &s.cloudCount, &s.cloudBytes} {
+		atomic.StoreInt64(n, 0)
+	}
+	s.mu.Lock()
+	s.startTime, s.endTime = time.Now(), time.Time{}
+	s.lastError, s.currentPath, s.err = "", "", nil
+	s.mu.Unlock()
+	s.workerCount = s.opts.Workers
+	if s.workerCount <= 0 {
+		s.workerCount = cpuCount() * 2
+	}
+	s.records, s.mounts, s.skips = nil, nil, nil
+	s.followed, s.snapshots, s.roots, s.dirStack = nil, nil, nil, nil
+	if s.visited != nil {
+		s.visited = newInodeSet()
+	}
+	if s.clones != nil {
+		s.clones = newCloneTracker()
+	}
+	if s.slowDirs != nil {
+		s.slowDirs = newSlowDirs(s.opts.SlowestDirs)
+	}
+	if s.perf != nil {
+		s.perf = &perfTimes{}
+	}
+	s.ran = false
+}
+
+// begin readies the Scanner for a scan, resetting it if it has run before.
+func (s *Scanner) begin() {
+	if s.ran {
+		s.Reset()
+	}
+	s.ran = true
+	s.mu.Lock()
+	s.startTime = time.Now()
+	s.mu.Unlock()
+}
+
+// finish stops the clock on a scan, returning how long it ran.
+func (s *Scanner) finish() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.endTime = time.Now()
+	return s.endTime.Sub(s.startTime)
+}
+func (s *Scanner) elapsed() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.endTime.IsZero() {
+		return s.endTime.Sub(s.startTime)
+	}
+	return time.Since(s.startTime)
+}
+func (s *Scanner) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+func (s *Scanner) setErr(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+}
+
+// worker processes paths from next(id) until it reports there are no
+// more.
+func (s *Scanner) worker(id int, next func(int) (string, bool), wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for {
-		select {
-		case path, ok := <-pathChan:
-			if !ok {
-				return
-			}
-			s.ProcessPath(path)
-		case <-s.ctx.Done():
+		waited := s.perf.now()
+		path, ok := next(id)
+		s.perf.since(perfPathWait, waited)
+		if !ok {
 			return
 		}
+		l := s.mounts.forPath(path)
+		waited = s.perf.now()
+		l.acquire()
+		s.perf.since(perfMountWait, waited)
+		started := time.Now()
+		s.ProcessPath(path)
+		took := time.Since(started)
+		s.perf.add(perfBusy, took)
+		l.release(took)
 	}
 }
 func (s *Scanner) walkDirectory(root string, pathChan chan<- string) {
-	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+	s.walkTree(root, root, root, pathChan)
+	s.finishDirs()
+}
+
+// walkTree walks dir, reporting its entries under alias, the path of the
+// link that led to it when following links. Skip and filter rules match
+// relative to root.
+func (s *Scanner) walkTree(root, dir, alias string, pathChan chan<- string) {
+	var timed func(string, int, time.Duration, time.Duration)
+	if s.slowDirs != nil || s.perf != nil {
+		timed = func(path string, entries int, list, stat time.Duration) {
+			s.perf.add(perfReadDir, list)
+			s.perf.add(perfWalkStat, stat)
+			if s.slowDirs == nil {
+				return
+			}
+			if dir != alias {
+				rel, _ := filepath.Rel(dir, path)
+				path = filepath.Join(alias, rel)
+			}
+			s.slowDirs.add(DirTiming{Path: path, Entries: entries, Duration: list + stat})
+		}
+	}
+	walk(s.fs, dir, timed, func(path string, info os.FileInfo, err error) error {
 		select {
 		case <-s.ctx.Done():
 			return filepath.SkipDir
 		default:
 		}
 
+		if dir != alias {
+			rel, _ := filepath.Rel(dir, path)
+			path = filepath.Join(alias, rel)
+			if path == alias {
+				return nil // reported by the walk that found the link
+			}
+		}
+		if path != root {
+			if rule := s.skips.match(path); rule != "" {
+				s.skips.add(rule, path, info)
+				atomic.AddInt64(&s.skippedCount, 1)
+				s.rootSkipped(path)
+				if info != nil && info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info != nil {
+				rel, _ := filepath.Rel(root, path)
+				if rule, excluded := s.opts.Filter.Match(rel, info.IsDir()); excluded {
+					s.skips.add(rule, path, info)
+					atomic.AddInt64(&s.skippedCount, 1)
+					s.rootSkipped(path)
+					if info.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+			}
+		}
+
 		if err != nil {
 			atomic.AddInt64(&s.errorCount, 1)
+			s.rootError(path)
 			s.setLastError(fmt.Sprintf("Error accessing %s: %v", path, err))
+			s.visitError(path, err)
 			return nil
 		}
 
+		if path != root && s.opts.FS == nil {
+			if kind := snapshotKind(path, info); kind != "" && s.handleSnapshot(kind, path, info) {
+				return filepath.SkipDir
+			}
+		}
+
 		s.setCurrentPath(path)
 
+		blocked := s.perf.now()
 		select {
 		case pathChan <- path:
 		case <-s.ctx.Done():
 			return filepath.SkipDir
 		}
+		s.perf.since(perfWalkBlocked, blocked)
+		s.trackDir(path, info.IsDir() && (s.opts.FS != nil || reparseKind(path, info) == ""), info.Size())
 
+		if path != root && s.opts.FS == nil && (info.Mode()&os.ModeSymlink != 0 || reparseKind(path, info) != "") {
+			if s.opts.FollowLinks {
+				s.followLink(root, path, info, pathChan)
+			}
+			// Junctions may look like directories; never descend into them
+			// directly.
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+		}
 		return nil
 	})
 }
+
+// followLink walks the directory a link points at. Only the walking
+// goroutine calls it, so followed needs no lock.
+func (s *Scanner) followLink(root, link string, info os.FileInfo, pathChan chan<- string) {
+	abs, _ := filepath.Abs(link)
+	target, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return // dangling; counted as the link itself
+	}
+	if ti, err := os.Stat(target); err != nil || !ti.IsDir() {
+		return
+	}
+	parent, err := filepath.EvalSymlinks(filepath.Dir(abs))
+	if err != nil {
+		parent = filepath.Dir(abs)
+	}
+	if s.followed == nil {
+		s.followed = map[string]bool{}
+	}
+	ancestor := parent == target || strings.HasPrefix(parent, strings.TrimSuffix(target, string(filepath.Separator))+string(filepath.Separator))
+	if ancestor || s.followed[target] {
+		s.skips.add("link cycle", link, info)
+		atomic.AddInt64(&s.skippedCount, 1)
+		s.rootSkipped(link)
+		return
+	}
+	s.followed[target] = true
+	s.walkTree(root, target, link, pathChan)
+}
 func (s *Scanner) ProcessPath(path string) {
-	info, err := os.Lstat(path)
+	started := s.perf.now()
+	info, err := s.fs.Lstat(path)
+	s.perf.since(perfStat, started)
 	if err != nil {
 		atomic.AddInt64(&s.errorCount, 1)
+		s.rootError(path)
 		s.setLastError(fmt.Sprintf("Error getting info for %s: %v", path, err))
+		s.visitError(path, err)
 		return
 	}
 
-	if info.IsDir() {
+	if s.opts.FS == nil && reparseKind(path, info) != "" {
+		atomic.AddInt64(&s.reparseCount, 1)
+	} else if info.IsDir() {
 		atomic.AddInt64(&s.dirCount, 1)
+		s.rootCount(path, 0, 1, 0)
+	} else if s.isDuplicateLink(info) {
+		atomic.AddInt64(&s.hardlinkCount, 1)
+		s.emit(path, info)
+		return
 	} else {
 		atomic.AddInt64(&s.fileCount, 1)
 		atomic.AddInt64(&s.bytesScanned, info.Size())
+		s.rootCount(path, 1, 0, info.Size())
+		if isCloudOnly(info) {
+			atomic.AddInt64(&s.cloudCount, 1)
+			atomic.AddInt64(&s.cloudBytes, info.Size())
+		} else if s.clones != nil && info.Mode().IsRegular() {
+			s.clones.add(path, info)
+		}
 	}
-
-	if s.ShouldSkipPath(path) {
-		atomic.AddInt64(&s.skippedCount, 1)
+	s.visit(path, info)
+	s.emit(path, info)
+}
+func (s *Scanner) isDuplicateLink(info os.FileInfo) bool {
+	if s.visited == nil {
+		return false
 	}
+	dev, ino, linked := inodeKey(info)
+	if !linked {
+		return false
+	}
+	return !s.visited.Add(dev, ino)
 }
 func (s *Scanner) ShouldSkipPath(path string) bool {
-	skipPaths := []string{
-		"/proc", "/sys", "/dev", "/run", "/tmp",
-		"/var/run", "/var/lock", "/var/tmp",
+	return newSkipRules(s.skipPaths, "").match(path) != ""
+}
+func (s *Scanner) logf(format string, args ...any) {
+	if !s.opts.Quiet {
+		fmt.Printf(format, args...)
 	}
-
-	for _, skipPath := range skipPaths {
-		if path == skipPath || filepath.HasPrefix(path, skipPath+"/") {
-			return true
+}
+func (s *Scanner) displayProgress(done <-chan struct{}) {
+	ansi, logged := ansiConsole(), !isTerminal(os.Stdout)
+	width := 0
+	tick := s.progressTicker.C
+	if logged {
+		interval := s.opts.LogInterval
+		if interval <= 0 {
+			interval = defaultLogInterval
 		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
 	}
-	return false
-}
-func (s *Scanner) displayProgress() {
 	for {
 		select {
-		case <-s.progressTicker.C:
+		case <-tick:
 			files := atomic.LoadInt64(&s.fileCount)
 			dirs := atomic.LoadInt64(&s.dirCount)
 			errors := atomic.LoadInt64(&s.errorCount)
 			skipped := atomic.LoadInt64(&s.skippedCount)
 			bytes := atomic.LoadInt64(&s.bytesScanned)
-			elapsed := time.Since(s.startTime)
+			elapsed := s.elapsed()
 
 			currentPath := s.getCurrentPath()
 			lastError := s.getLastError()
 
-			fmt.Printf("\r\033[K")
-			fmt.Printf("Scanned Files: %d | Dirs: %d | Errors: %d | Skipped: %d | Size: %s | Time: %v",
-				files, dirs, errors, skipped, FormatBytes(bytes), elapsed.Truncate(time.Second))
+			var status string
+			if est := s.opts.Estimate; est != nil && est.Items > 0 {
+				status = fmt.Sprintf("%s | Files: %d | Dirs: %d | Errors: %d | Size: %s",
+					progressBar(files+dirs+atomic.LoadInt64(&s.hardlinkCount), est, elapsed), files, dirs, errors, FormatBytes(bytes))
+			} else {
+				status = fmt.Sprintf("Scanned Files: %d | Dirs: %d | Errors: %d | Skipped: %d | Size: %s | Time: %v",
+					files, dirs, errors, skipped, FormatBytes(bytes), elapsed.Truncate(time.Second))
+			}
+			if logged {
+				if currentPath != "" {
+					status += " | Current: " + currentPath
+				}
+				fmt.Println(status)
+				continue
+			}
+			if !ansi {
+				var line string
+				line, width = plainLine(status, currentPath, width)
+				fmt.Printf("\r%s", line)
+				continue
+			}
+			fmt.Printf("\r\033[K%s", status)
 
 			if len(currentPath) > 0 {
 				if len(currentPath) > 80 {
@@ -197,7 +767,40 @@ func (s *Scanner) displayProgress() {
 				fmt.Printf("\033[%dA", lines-1)
 			}
 
-		case <-s.ctx.Done():
+		case <-done:
+			return
+		}
+	}
+}
+
+// Stats returns the counters of the scan running now, or of the last one
+// once it has ended, when Elapsed stops growing. It is safe to call from
+// any goroutine, so embedders can poll it instead of using OnProgress.
+func (s *Scanner) Stats() Stats {
+	return Stats{
+		Files:       atomic.LoadInt64(&s.fileCount),
+		Dirs:        atomic.LoadInt64(&s.dirCount),
+		Errors:      atomic.LoadInt64(&s.errorCount),
+		Skipped:     atomic.LoadInt64(&s.skippedCount),
+		Bytes:       atomic.LoadInt64(&s.bytesScanned),
+		Elapsed:     s.elapsed(),
+		CurrentPath: s.getCurrentPath(),
+	}
+}
+func (s *Scanner) reportProgress(done chan struct{}) {
+	interval := s.opts.ProgressInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.opts.OnProgress(s.Stats())
+		case <-done:
+			s.opts.OnProgress(s.Stats())
+			close(done)
 			return
 		}
 	}
@@ -234,3 +837,20 @@ func FormatBytes(bytes int64) string {
 	}
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
+
+// ParseBytes parses a size such as 500, 100MB, 4k or 1.5GiB. Units are
+// powers of 1024, as in FormatBytes.
+func ParseBytes(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "B"), "I")
+	shift := 0
+	if i := strings.IndexAny(v, "KMGTPE"); i >= 0 && i == len(v)-1 {
+		shift = 10 * (1 + strings.IndexByte("KMGTPE", v[i]))
+		v = strings.TrimSpace(v[:i])
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(int64(1)<<shift)), nil
+}
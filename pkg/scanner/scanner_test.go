@@ -1,11 +1,22 @@
 package scanner
 
 import (
+	"archive/zip"
+	"bufio"
+	"bytes"
 	"context"
+	"fmt"
+	"io/fs"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
 	"time"
+	"unicode/utf8"
 )
 
 func TestNewScanner(t *testing.T) {
@@ -38,6 +49,52 @@ func TestScannerStop(t *testing.T) {
 	}
 }
 
+func TestScannerReuse(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/1":   {Data: make([]byte, 10)},
+		"a/2":   {Data: make([]byte, 20)},
+		"b/1":   {Data: make([]byte, 5)},
+		"b/c/1": {Data: make([]byte, 5)},
+	}
+	s := NewScannerWithOptions(Options{FS: fsys, Quiet: true, DedupHardlinks: true})
+	for i := 0; i < 3; i++ {
+		result := s.Start(".")
+		if result.TotalFiles != 4 || result.TotalBytes != 40 || !result.Completed {
+			t.Fatalf("scan %d: got %d files, %d bytes, completed %v", i, result.TotalFiles, result.TotalBytes, result.Completed)
+		}
+	}
+	if result := s.Start("b"); result.TotalFiles != 2 || result.TotalDirs != 2 {
+		t.Errorf("scan of b: got %d files, %d dirs", result.TotalFiles, result.TotalDirs)
+	}
+
+	// A Stop between scans only holds until the next one starts.
+	s.Stop()
+	if result := s.Start("."); result.TotalFiles != 4 || !result.Completed {
+		t.Errorf("scan after Stop: got %d files, completed %v", result.TotalFiles, result.Completed)
+	}
+	s.Reset()
+	if p := s.Stats(); p.Files != 0 || p.Bytes != 0 {
+		t.Errorf("after Reset: got %d files, %d bytes", p.Files, p.Bytes)
+	}
+
+	for i := 0; i < 2; i++ {
+		dirs := s.DirSummaries(16)
+		var root DirSummary
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for d := range dirs {
+				root = d
+			}
+		}()
+		s.Start(".")
+		<-done
+		if root.Path != "." || root.Files != 4 {
+			t.Errorf("summaries of scan %d: got %+v for the root", i, root)
+		}
+	}
+}
+
 func TestFormatBytes(t *testing.T) {
 	tests := []struct {
 		input    int64
@@ -171,6 +228,580 @@ func TestScanResultCalculations(t *testing.T) {
 	}
 }
 
+func TestInodeSet(t *testing.T) {
+	set := newInodeSet()
+
+	if !set.Add(1, 42) {
+		t.Error("First Add should report a new inode")
+	}
+	if set.Add(1, 42) {
+		t.Error("Second Add of the same inode should report a duplicate")
+	}
+	if !set.Add(2, 42) {
+		t.Error("The same inode on another device should be new")
+	}
+
+	// Push one container past the array limit so it converts to a bitmap.
+	for i := uint64(0); i < arrayMaxSize+10; i++ {
+		set.Add(3, 1<<20+i*3)
+	}
+	if set.Add(3, 1<<20+30) {
+		t.Error("Inode added before the bitmap conversion was lost")
+	}
+	if got, want := set.Len(), int64(arrayMaxSize+12); got != want {
+		t.Errorf("Len() = %d, expected %d", got, want)
+	}
+	if set.Bytes() <= 0 {
+		t.Error("Bytes() should report memory in use")
+	}
+}
+
+func TestDedupHardlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	original := filepath.Join(tmpDir, "original.txt")
+	if err := os.WriteFile(original, []byte("linked content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(original, filepath.Join(tmpDir, "link.txt")); err != nil {
+		t.Skipf("Hard links not supported: %v", err)
+	}
+
+	s := NewScannerWithOptions(Options{DedupHardlinks: true})
+	result := s.Start(tmpDir)
+
+	if result.TotalFiles != 1 {
+		t.Errorf("Expected 1 file after dedup, got %d", result.TotalFiles)
+	}
+	if result.TotalHardlinks != 1 {
+		t.Errorf("Expected 1 duplicate hard link, got %d", result.TotalHardlinks)
+	}
+	if result.TotalBytes != int64(len("linked content")) {
+		t.Errorf("Expected bytes to be counted once, got %d", result.TotalBytes)
+	}
+}
+
+type collectSink struct {
+	records []*FileRecord
+}
+
+func (c *collectSink) Write(rec *FileRecord) error {
+	c.records = append(c.records, rec)
+	return nil
+}
+
+func TestSinksReceiveRecords(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &collectSink{}
+	s := NewScannerWithOptions(Options{Sinks: []Sink{sink}, RecordQueue: 1, Hash: true})
+	s.Start(tmpDir)
+
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(sink.records))
+	}
+	for _, rec := range sink.records {
+		if rec.IsDir {
+			continue
+		}
+		const abcSHA256 = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+		if rec.Hash != abcSHA256 {
+			t.Errorf("Unexpected hash %q", rec.Hash)
+		}
+	}
+}
+
+// mapCache is a HashCache keyed by path alone.
+type mapCache struct {
+	mu     sync.Mutex
+	hashes map[string]string
+	stored []string
+}
+
+func (c *mapCache) Lookup(path string, info os.FileInfo) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hash, ok := c.hashes[filepath.Base(path)]
+	return hash, ok
+}
+
+func (c *mapCache) Store(path string, info os.FileInfo, hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hashes[filepath.Base(path)] = hash
+	c.stored = append(c.stored, filepath.Base(path))
+}
+
+func TestHashCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"cached.txt", "new.txt"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("abc"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cache := &mapCache{hashes: map[string]string{"cached.txt": "remembered"}}
+	sink := &collectSink{}
+	s := NewScannerWithOptions(Options{Sinks: []Sink{sink}, Hash: true, HashCache: cache, Quiet: true})
+	s.Start(tmpDir)
+
+	hashes := map[string]string{}
+	for _, rec := range sink.records {
+		hashes[filepath.Base(rec.Path)] = rec.Hash
+	}
+	if hashes["cached.txt"] != "remembered" {
+		t.Errorf("cached.txt was read instead of taken from the cache: %q", hashes["cached.txt"])
+	}
+	if h := hashes["new.txt"]; h != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("Unexpected hash of new.txt %q", h)
+	}
+	if len(cache.stored) != 1 || cache.stored[0] != "new.txt" {
+		t.Errorf("Expected only new.txt to be stored, got %v", cache.stored)
+	}
+}
+
+// extVisitor totals bytes per extension.
+type extVisitor struct {
+	mu     sync.Mutex
+	bytes  map[string]int64
+	dirs   int
+	errors []string
+}
+
+func (v *extVisitor) VisitFile(path string, info os.FileInfo) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.bytes[filepath.Ext(path)] += info.Size()
+}
+
+func (v *extVisitor) VisitDir(path string, info os.FileInfo) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.dirs++
+}
+
+func (v *extVisitor) HandleError(path string, err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.errors = append(v.errors, path)
+}
+
+func TestVisitor(t *testing.T) {
+	tmpDir := t.TempDir()
+	for name, size := range map[string]int{"a.txt": 3, "sub/b.txt": 4, "sub/c.go": 5} {
+		path := filepath.Join(tmpDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	v := &extVisitor{bytes: map[string]int64{}}
+	s := NewScannerWithOptions(Options{Visitor: v})
+	s.Start(tmpDir)
+	if v.bytes[".txt"] != 7 || v.bytes[".go"] != 5 || v.dirs != 2 || len(v.errors) != 0 {
+		t.Errorf("Got bytes %v, %d dirs, errors %v", v.bytes, v.dirs, v.errors)
+	}
+
+	v = &extVisitor{bytes: map[string]int64{}}
+	s = NewScannerWithOptions(Options{Visitor: v})
+	s.StartList(strings.NewReader(filepath.Join(tmpDir, "missing")+"\n"), '\n')
+	if len(v.errors) != 1 {
+		t.Errorf("Expected the missing path to be handled as an error, got %v", v.errors)
+	}
+}
+
+func TestOnProgressReportsFinalTotals(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"a", "b", "c"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var last Stats
+	s := NewScannerWithOptions(Options{OnProgress: func(st Stats) { last = st }})
+	result := s.Start(tmpDir)
+
+	if last.Files != result.TotalFiles || last.Bytes != result.TotalBytes {
+		t.Errorf("Last progress %+v does not match result %+v", last, result)
+	}
+}
+
+func TestStatsPolling(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for i := 0; i < 200; i++ {
+		fsys[fmt.Sprintf("d%d/f%d", i%10, i)] = &fstest.MapFile{Data: []byte("xy")}
+	}
+	s := NewScannerWithOptions(Options{FS: fsys, Quiet: true})
+
+	stop := make(chan struct{})
+	polled := make(chan Stats)
+	go func() {
+		var last Stats
+		for {
+			select {
+			case <-stop:
+				polled <- last
+				return
+			default:
+				st := s.Stats()
+				if st.Files < last.Files {
+					t.Errorf("file count went back from %d to %d", last.Files, st.Files)
+				}
+				last = st
+			}
+		}
+	}()
+	result := s.Start(".")
+	close(stop)
+	<-polled
+
+	st := s.Stats()
+	if st.Files != 200 || st.Dirs != result.TotalDirs || st.Bytes != 400 {
+		t.Errorf("got %+v after a scan of %d files", st, result.TotalFiles)
+	}
+	if st.Elapsed != result.Duration {
+		t.Errorf("elapsed %v after the scan, want its duration %v", st.Elapsed, result.Duration)
+	}
+}
+
+func TestPlainLine(t *testing.T) {
+	status := "Scanned Files: 12 | Dirs: 3 | Errors: 0"
+	line, width := plainLine(status, "/home/user/src", 0)
+	if line != status+" | /home/user/src" || width != len(line) {
+		t.Errorf("got %q (%d)", line, width)
+	}
+
+	// A shorter line covers what was drawn before it.
+	line, width = plainLine(status, "", 60)
+	if len(line) != 60 || width != len(status) || strings.TrimRight(line, " ") != status {
+		t.Errorf("got %q (%d)", line, width)
+	}
+
+	long := "/srv/" + strings.Repeat("ü", 100) + "/last.txt"
+	line, width = plainLine(status, long, 0)
+	if width != plainWidth || utf8.RuneCountInString(line) != plainWidth || !strings.HasSuffix(line, "üü/last.txt") {
+		t.Errorf("got %q (%d)", line, width)
+	}
+	if line, width = plainLine(strings.Repeat("x", 100), long, 0); line != strings.Repeat("x", plainWidth) || width != plainWidth {
+		t.Errorf("got %q (%d)", line, width)
+	}
+}
+
+func TestLimiterTuning(t *testing.T) {
+	l := newLimiter(mount{Path: "/"}, 8, 64, true)
+	window := func(ops int64) {
+		l.ops, l.waits = ops, 1
+		l.tune(time.Second)
+	}
+
+	window(1000)
+	if l.limit <= 8 {
+		t.Fatalf("Expected the first saturated window to raise the limit, got %d", l.limit)
+	}
+	raised := l.limit
+	window(2000)
+	if l.limit <= raised {
+		t.Fatalf("Expected improving throughput to keep raising the limit, got %d", l.limit)
+	}
+	peak := l.limit
+	window(1000)
+	if l.limit >= peak {
+		t.Errorf("Expected falling throughput to lower the limit, got %d", l.limit)
+	}
+	if l.peak != peak {
+		t.Errorf("Peak = %d, expected %d", l.peak, peak)
+	}
+
+	fixed := newLimiter(mount{Path: "/"}, 4, 4, false)
+	fixed.ops, fixed.waits = 1000, 1
+	fixed.tune(time.Second)
+	if fixed.limit != 4 {
+		t.Errorf("Fixed limiter changed to %d", fixed.limit)
+	}
+}
+
+func TestMountPoolForPath(t *testing.T) {
+	root := newLimiter(mount{Path: "/"}, 1, 1, false)
+	nfs := newLimiter(mount{Path: "/mnt/nfs", FSType: "nfs4"}, 1, 1, false)
+	p := &mountPool{cwd: "/mnt", limiters: []*limiter{nfs, root}, fallback: root}
+
+	tests := map[string]*limiter{
+		"/mnt/nfs":       nfs,
+		"/mnt/nfs/a/b":   nfs,
+		"/mnt/nfsother":  root,
+		"nfs/relative":   nfs,
+		"/var/lib/thing": root,
+	}
+	for path, want := range tests {
+		if got := p.forPath(path); got != want {
+			t.Errorf("forPath(%q) = %s, expected %s", path, got.mount.Path, want.mount.Path)
+		}
+	}
+}
+
+func TestMountCap(t *testing.T) {
+	caps := map[string]int{"nfs": 4, "/mnt/fast": 32, "cifs": 2}
+	tests := []struct {
+		m    mount
+		want int
+	}{
+		{mount{Path: "/mnt/nas", FSType: "nfs4"}, 4},
+		{mount{Path: "/mnt/nas", FSType: "nfs"}, 4},
+		{mount{Path: "/mnt/fast", FSType: "nfs4"}, 32},
+		{mount{Path: "/mnt/share", FSType: "cifs"}, 2},
+		{mount{Path: "/", FSType: "ext4"}, 0},
+	}
+	for _, tt := range tests {
+		if got, _ := mountCap(tt.m, caps); got != tt.want {
+			t.Errorf("mountCap(%+v) = %d, expected %d", tt.m, got, tt.want)
+		}
+	}
+}
+
+type blockingSink struct{ ctx context.Context }
+
+func (b blockingSink) Write(*FileRecord) error {
+	<-b.ctx.Done()
+	return nil
+}
+
+func TestTimeoutReturnsPartialResult(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "a"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := NewScanner().Start(tmpDir)
+	if !result.Completed {
+		t.Error("Expected an uninterrupted scan to be complete")
+	}
+
+	// A sink that blocks until the scan is cancelled keeps the scan running
+	// until the timeout fires.
+	s := NewScannerWithOptions(Options{Timeout: 10 * time.Millisecond, RecordQueue: 1})
+	s.opts.Sinks = []Sink{blockingSink{s.ctx}}
+	result = s.Start(tmpDir)
+	if result.Completed {
+		t.Error("Expected a timed out scan to be marked partial")
+	}
+}
+
+func TestStopReturnsPartialResult(t *testing.T) {
+	tmpDir := t.TempDir()
+	for i := 0; i < 100; i++ {
+		if err := os.WriteFile(filepath.Join(tmpDir, fmt.Sprintf("f%03d", i)), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewScannerWithOptions(Options{Workers: 1, RecordQueue: 1})
+	first := make(chan struct{})
+	var once sync.Once
+	s.opts.Sinks = []Sink{sinkFunc(func(*FileRecord) error {
+		once.Do(func() { close(first) })
+		<-s.ctx.Done()
+		return nil
+	})}
+
+	results := make(chan *ScanResult, 1)
+	go func() { results <- s.Start(tmpDir) }()
+	<-first
+	s.Stop()
+
+	select {
+	case result := <-results:
+		if result.Completed {
+			t.Error("Expected a stopped scan to be marked partial")
+		}
+		if result.TotalDirs+result.TotalFiles == 0 {
+			t.Error("Expected the partial result to include what was counted")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after Stop")
+	}
+}
+
+func TestSkipRulesPruneTraversal(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"keep/a", "cache/b", "cache/deep/c", "cache/deep/d", "volatile/e"} {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewScanner()
+	s.skipPaths = []string{filepath.Join(tmpDir, "cache"), filepath.Join(tmpDir, "volatile"), filepath.Join(tmpDir, "missing")}
+	result := s.Start(tmpDir)
+
+	if result.TotalFiles != 1 {
+		t.Errorf("Expected only keep/a to be counted, got %d files", result.TotalFiles)
+	}
+	if result.TotalSkipped != 2 {
+		t.Errorf("Expected 2 pruned subtrees, got %d", result.TotalSkipped)
+	}
+	// cache itself plus its immediate children b and deep; only b's size is
+	// known without descending.
+	want := SkipStats{Rule: filepath.Join(tmpDir, "cache"), Count: 1, Entries: 3, Bytes: 1}
+	if len(result.Skipped) != 2 || result.Skipped[0] != want {
+		t.Errorf("Unexpected per-rule breakdown %+v", result.Skipped)
+	}
+
+	// A rule containing the root itself must not prune the whole scan.
+	s = NewScanner()
+	s.skipPaths = []string{tmpDir}
+	if result := s.Start(filepath.Join(tmpDir, "cache")); result.TotalFiles != 3 {
+		t.Errorf("Expected 3 files when scanning inside a skipped path, got %d", result.TotalFiles)
+	}
+}
+
+func TestSkipFunc(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The default skip rules are Unix paths")
+	}
+	skip := SkipFunc("/tmp/build")
+	for path, want := range map[string]bool{
+		"/tmp/build":         false,
+		"/tmp/build/out/a.o": false,
+		"/tmp/other":         false,
+		"/proc/1/status":     true,
+		"/var/tmp/x":         true,
+		"/procfs":            false,
+	} {
+		if got := skip(path); got != want {
+			t.Errorf("SkipFunc(/tmp/build)(%s) = %v, expected %v", path, got, want)
+		}
+	}
+	if skip := SkipFunc("/srv"); !skip("/tmp/other") {
+		t.Error("Expected /tmp to be skipped in a scan of /srv")
+	}
+}
+
+func TestEstimateSkipped(t *testing.T) {
+	tmpDir := t.TempDir()
+	for name, data := range map[string]string{"dir/a": "12345", "dir/b": "678", "dir/sub/c": "not counted"} {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("a", filepath.Join(tmpDir, "dir", "link")); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(tmpDir, "gone"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	lstat := func(name string) os.FileInfo {
+		info, err := os.Lstat(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+	dir, file, link, gone := lstat("dir"), lstat("dir/a"), lstat("dir/link"), lstat("gone")
+	// A directory removed after it was seen can no longer be listed.
+	if err := os.Remove(filepath.Join(tmpDir, "gone")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		info           os.FileInfo
+		entries, bytes int64
+	}{
+		// The directory, a, b, sub and link; only the regular files' sizes.
+		{"directory", "dir", dir, 5, 8},
+		{"file", "dir/a", file, 1, 5},
+		{"symlink", "dir/link", link, 1, link.Size()},
+		{"unlistable directory", "gone", gone, 1, 0},
+		{"unreadable entry", "missing", nil, 0, 0},
+	}
+	for _, test := range tests {
+		entries, bytes := estimateSkipped(osFS{}, filepath.Join(tmpDir, test.path), test.info)
+		if entries != test.entries || bytes != test.bytes {
+			t.Errorf("%s: estimateSkipped = %d entries, %d bytes, expected %d, %d", test.name, entries, bytes, test.entries, test.bytes)
+		}
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	est := &Estimate{Items: 200}
+	got := progressBar(50, est, 10*time.Second)
+	if !strings.Contains(got, " 25.0% | ETA 30s") || !strings.HasPrefix(got, "[#######.......") {
+		t.Errorf("Unexpected progress bar %q", got)
+	}
+	// Running past the estimate must neither reach 100% nor show an ETA.
+	if got := progressBar(300, est, time.Minute); !strings.Contains(got, " 99.9% | ETA --") {
+		t.Errorf("Unexpected overrun progress bar %q", got)
+	}
+}
+
+func TestPrecount(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"a", "sub/b", "sub/deeper/c"} {
+		path := filepath.Join(tmpDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The root, two directories and three files.
+	if est := Precount(tmpDir); est.Items != 6 {
+		t.Errorf("Precount = %d, expected 6", est.Items)
+	}
+}
+
+func TestStartList(t *testing.T) {
+	tmpDir := t.TempDir()
+	var list []string
+	for _, name := range []string{"a", "with\nnewline", "sub/b"} {
+		path := filepath.Join(tmpDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte("12345"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		list = append(list, path)
+	}
+	// The directory is counted but not descended into.
+	list = append(list, filepath.Join(tmpDir, "sub"), filepath.Join(tmpDir, "missing"))
+
+	input := bufio.NewReader(strings.NewReader(strings.Join(list, "\x00") + "\x00"))
+	delim := DetectDelimiter(input)
+	if delim != 0 {
+		t.Fatalf("Expected NUL delimiter, got %q", delim)
+	}
+	result := NewScanner().StartList(input, delim)
+	if result.TotalFiles != 3 || result.TotalDirs != 1 || result.TotalBytes != 15 || result.TotalErrors != 1 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	input = bufio.NewReader(strings.NewReader(list[0] + "\r\n\n" + list[2] + "\n"))
+	if delim := DetectDelimiter(input); delim != '\n' {
+		t.Fatalf("Expected newline delimiter, got %q", delim)
+	}
+	if result := NewScanner().StartList(input, '\n'); result.TotalFiles != 2 || result.TotalErrors != 0 {
+		t.Errorf("Unexpected newline-delimited result %+v", result)
+	}
+}
+
+type sinkFunc func(*FileRecord) error
+
+func (f sinkFunc) Write(rec *FileRecord) error { return f(rec) }
+
 func BenchmarkFormatBytes(b *testing.B) {
 	sizes := []int64{1024, 1048576, 1073741824, 1099511627776}
 
@@ -180,3 +811,500 @@ func BenchmarkFormatBytes(b *testing.B) {
 		}
 	}
 }
+
+func TestFilterMatch(t *testing.T) {
+	var f Filter
+	for _, rule := range []string{"- *.o", "+ /src/keep.o", "- /build/", "+ */", "+ *.go", "+ docs/***", "- *"} {
+		if err := f.Add(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		path     string
+		isDir    bool
+		excluded bool
+	}{
+		{"main.o", false, true},
+		{"src/keep.o", false, true}, // "- *.o" comes first
+		{"build", true, true},
+		{"build", false, true}, // "- *" catches the file
+		{"src/build", true, false},
+		{"src/main.go", false, false},
+		{"src/README", false, true},
+		{"a/docs/README", false, false},
+		{"docs", true, false},
+	}
+	for _, tt := range tests {
+		if _, excluded := f.Match(tt.path, tt.isDir); excluded != tt.excluded {
+			t.Errorf("Match(%q, %v) excluded = %v, expected %v", tt.path, tt.isDir, excluded, tt.excluded)
+		}
+	}
+
+	if err := f.Add("exclude"); err == nil {
+		t.Error("Expected an error for a rule without a pattern")
+	}
+	f.Add("!")
+	if rule, excluded := f.Match("main.o", false); rule != "" || excluded {
+		t.Errorf("Expected no rules after \"!\", got %q", rule)
+	}
+}
+
+func TestFilterPrunesTraversal(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"a.txt", "a.log", "logs/b.log", "logs/c.txt", "src/d.txt"} {
+		path := filepath.Join(tmpDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("x"), 0644)
+	}
+	rules := filepath.Join(t.TempDir(), "rules")
+	os.WriteFile(rules, []byte("# backup exclusions\n- /logs/\n- *.log\n"), 0644)
+
+	var f Filter
+	if err := f.Add("merge " + rules); err != nil {
+		t.Fatal(err)
+	}
+	result := NewScannerWithOptions(Options{Filter: &f}).Start(tmpDir)
+	if result.TotalFiles != 2 {
+		t.Errorf("Expected a.txt and src/d.txt to be counted, got %d files", result.TotalFiles)
+	}
+	if len(result.Skipped) != 2 || result.Skipped[0].Rule != "- *.log" || result.Skipped[1].Rule != "- /logs/" || result.Skipped[1].Entries != 3 {
+		t.Errorf("Unexpected per-rule breakdown %+v", result.Skipped)
+	}
+}
+
+func TestFollowLinks(t *testing.T) {
+	tmpDir, outside := t.TempDir(), t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "data"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "data", "one.txt"), []byte("1"), 0644)
+	os.WriteFile(filepath.Join(outside, "x"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(outside, "y"), []byte("y"), 0644)
+	os.Symlink("..", filepath.Join(tmpDir, "data", "loop"))
+	os.Symlink(outside, filepath.Join(tmpDir, "shared"))
+	os.Symlink(outside, filepath.Join(tmpDir, "shared2"))
+
+	result := NewScannerWithOptions(Options{Quiet: true}).Start(tmpDir)
+	if result.TotalFiles != 4 || result.TotalSkipped != 0 {
+		t.Errorf("Expected links to be counted but not followed, got %d files, %d skipped", result.TotalFiles, result.TotalSkipped)
+	}
+
+	result = NewScannerWithOptions(Options{Quiet: true, FollowLinks: true}).Start(tmpDir)
+	if result.TotalFiles != 6 || result.TotalDirs != 2 {
+		t.Errorf("Expected the shared directory to be counted once, got %d files, %d dirs", result.TotalFiles, result.TotalDirs)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0].Rule != "link cycle" || result.Skipped[0].Count != 2 {
+		t.Errorf("Expected the loop and the second link to be reported as cycles, got %+v", result.Skipped)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, ".zfs", "snapshot", "daily"), 0755)
+	os.MkdirAll(filepath.Join(tmpDir, ".zfs", "snapshot", "weekly"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "live.txt"), []byte("12345"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, ".zfs", "snapshot", "daily", "live.txt"), []byte("1234"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, ".zfs", "snapshot", "weekly", "live.txt"), []byte("123"), 0644)
+
+	result := NewScannerWithOptions(Options{Quiet: true}).Start(tmpDir)
+	if result.TotalFiles != 3 || len(result.Snapshots) != 2 {
+		t.Errorf("Expected snapshots to be counted and listed, got %d files, %+v", result.TotalFiles, result.Snapshots)
+	}
+
+	result = NewScannerWithOptions(Options{Quiet: true, Snapshots: SnapshotsSkip}).Start(tmpDir)
+	if result.TotalFiles != 1 || len(result.Skipped) != 1 || result.Skipped[0].Rule != "zfs snapshot" || result.Skipped[0].Count != 2 {
+		t.Errorf("Expected snapshots to be skipped, got %d files, %+v", result.TotalFiles, result.Skipped)
+	}
+
+	result = NewScannerWithOptions(Options{Quiet: true, Snapshots: SnapshotsSeparate}).Start(tmpDir)
+	if result.TotalFiles != 1 || result.TotalBytes != 5 || result.TotalSkipped != 0 {
+		t.Errorf("Expected snapshots to be left out of the totals, got %d files, %d bytes", result.TotalFiles, result.TotalBytes)
+	}
+	var bytes int64
+	for _, st := range result.Snapshots {
+		if st.Kind != "zfs" || st.Files != 1 || st.Dirs != 1 {
+			t.Errorf("Got snapshot %+v", st)
+		}
+		bytes += st.Bytes
+	}
+	if bytes != 7 {
+		t.Errorf("Expected 7 bytes in snapshots, got %d", bytes)
+	}
+}
+
+func TestReflinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	data := make([]byte, 64*1024)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	os.WriteFile(filepath.Join(tmpDir, "orig"), data, 0644)
+
+	result := NewScannerWithOptions(Options{Quiet: true, Reflinks: true}).Start(tmpDir)
+	if result.PhysicalBytes != int64(len(data)) || result.SharedBytes != 0 {
+		t.Errorf("Expected %d unique bytes, got %d physical, %d shared", len(data), result.PhysicalBytes, result.SharedBytes)
+	}
+
+	// Only XFS, Btrfs and APFS can clone; elsewhere cp fails and the rest
+	// of the test is skipped.
+	clone := filepath.Join(tmpDir, "clone")
+	if err := exec.Command("cp", "--reflink=always", filepath.Join(tmpDir, "orig"), clone).Run(); err != nil {
+		if err := exec.Command("cp", "-c", filepath.Join(tmpDir, "orig"), clone).Run(); err != nil {
+			t.Skip("temporary directory does not support reflinks")
+		}
+	}
+	result = NewScannerWithOptions(Options{Quiet: true, Reflinks: true}).Start(tmpDir)
+	if result.TotalBytes != 2*int64(len(data)) || result.PhysicalBytes != int64(len(data)) {
+		t.Errorf("Expected the clone to share its data, got %d logical, %d physical bytes", result.TotalBytes, result.PhysicalBytes)
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	for in, want := range map[string]int64{"500": 500, "4k": 4096, "100MB": 100 << 20, "1.5GiB": 3 << 29, " 2 T ": 2 << 40} {
+		if got, err := ParseBytes(in); err != nil || got != want {
+			t.Errorf("ParseBytes(%q) = %d, %v; expected %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "MB", "-1G", "12X"} {
+		if _, err := ParseBytes(in); err == nil {
+			t.Errorf("Expected ParseBytes(%q) to fail", in)
+		}
+	}
+}
+
+func TestScanFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":          {Data: []byte("abc")},
+		"docs/b.md":      {Data: []byte("hello")},
+		"docs/old/c.log": {Data: make([]byte, 100)},
+	}
+	filter := &Filter{}
+	filter.Add("- old/")
+	sink := &collectSink{}
+	s := NewScannerWithOptions(Options{FS: fsys, Quiet: true, Hash: true, Filter: filter, Sinks: []Sink{sink}})
+	result := s.Start(".")
+	if result.TotalFiles != 2 || result.TotalDirs != 2 || result.TotalBytes != 8 || result.TotalErrors != 0 {
+		t.Errorf("Got %d files, %d dirs, %d bytes, %d errors", result.TotalFiles, result.TotalDirs, result.TotalBytes, result.TotalErrors)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0].Entries != 2 || result.Skipped[0].Bytes != 100 {
+		t.Errorf("Got skipped %+v", result.Skipped)
+	}
+	paths := map[string]string{}
+	for _, rec := range sink.records {
+		paths[rec.Path] = rec.Hash
+	}
+	if _, ok := paths["docs/b.md"]; !ok || paths["a.txt"] != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("Got records %v", paths)
+	}
+
+	// A zip archive is an fs.FS too.
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"x/1.bin", "x/2.bin", "y.bin"} {
+		w, _ := zw.Create(name)
+		w.Write(make([]byte, 10))
+	}
+	zw.Close()
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result = NewScannerWithOptions(Options{FS: zr, Quiet: true}).Start(".")
+	if result.TotalFiles != 3 || result.TotalBytes != 30 {
+		t.Errorf("Got %d files, %d bytes from the zip", result.TotalFiles, result.TotalBytes)
+	}
+
+	result = NewScannerWithOptions(Options{FS: fsys, Quiet: true}).Start("missing")
+	if result.TotalErrors != 1 {
+		t.Errorf("Expected a missing root to be an error, got %d errors", result.TotalErrors)
+	}
+}
+
+// faultyFS wraps the real filesystem, failing or delaying chosen paths.
+type faultyFS struct {
+	FileSystem
+	lstat   map[string]error
+	readDir map[string]error
+	delay   time.Duration
+}
+
+func (f faultyFS) Lstat(name string) (fs.FileInfo, error) {
+	time.Sleep(f.delay)
+	if err := f.lstat[filepath.Base(name)]; err != nil {
+		return nil, err
+	}
+	return f.FileSystem.Lstat(name)
+}
+
+func (f faultyFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := f.readDir[filepath.Base(name)]; err != nil {
+		return nil, err
+	}
+	return f.FileSystem.ReadDir(name)
+}
+
+func TestFileSystemFaults(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"ok", "denied", "vanished", "locked/inner"} {
+		path := filepath.Join(tmpDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	faults := faultyFS{
+		FileSystem: OS(),
+		lstat:      map[string]error{"denied": fs.ErrPermission, "vanished": fs.ErrNotExist},
+		readDir:    map[string]error{"locked": fs.ErrPermission},
+	}
+	v := &extVisitor{bytes: map[string]int64{}}
+	result := NewScannerWithOptions(Options{FileSystem: faults, Visitor: v, Quiet: true}).Start(tmpDir)
+	// An unreadable directory counts as an error rather than a directory,
+	// as with filepath.Walk.
+	if result.TotalFiles != 1 || result.TotalDirs != 1 || result.TotalErrors != 3 {
+		t.Errorf("Got %d files, %d dirs, %d errors", result.TotalFiles, result.TotalDirs, result.TotalErrors)
+	}
+	if len(v.errors) != 3 {
+		t.Errorf("Expected the visitor to see 3 errors, got %v", v.errors)
+	}
+
+	// A slow device doesn't keep a timed-out scan from returning.
+	faults = faultyFS{FileSystem: OS(), delay: 50 * time.Millisecond}
+	started := time.Now()
+	result = NewScannerWithOptions(Options{FileSystem: faults, Quiet: true, Timeout: 20 * time.Millisecond}).Start(tmpDir)
+	if result.Completed || time.Since(started) > time.Second {
+		t.Errorf("Expected a partial result promptly, got completed=%v after %v", result.Completed, time.Since(started))
+	}
+}
+
+func TestResultArithmetic(t *testing.T) {
+	a := &ScanResult{
+		TotalFiles: 100, TotalDirs: 10, TotalBytes: 1000, Duration: 10 * time.Second, FilesPerSecond: 10,
+		Skipped:   []SkipStats{{Rule: "/proc", Count: 1, Entries: 50}},
+		Mounts:    []MountStats{{Path: "/", Workers: 4, Operations: 100, AvgLatency: time.Millisecond}},
+		Completed: true,
+	}
+	b := &ScanResult{
+		TotalFiles: 300, TotalDirs: 20, TotalBytes: 500, Duration: 20 * time.Second, FilesPerSecond: 15,
+		Skipped:   []SkipStats{{Rule: "/proc", Count: 1, Entries: 50}, {Rule: "- *.o", Count: 3, Bytes: 30}},
+		Mounts:    []MountStats{{Path: "/", Workers: 8, Operations: 300, AvgLatency: 3 * time.Millisecond}},
+		Completed: true,
+	}
+
+	m := a.Merge(b)
+	if m.TotalFiles != 400 || m.TotalBytes != 1500 || m.Duration != 20*time.Second || m.FilesPerSecond != 20 || !m.Completed {
+		t.Errorf("Got merged %+v", m)
+	}
+	if len(m.Skipped) != 2 || m.Skipped[1] != (SkipStats{Rule: "/proc", Count: 2, Entries: 100}) {
+		t.Errorf("Got merged skips %+v", m.Skipped)
+	}
+	if len(m.Mounts) != 1 || m.Mounts[0].Operations != 400 || m.Mounts[0].AvgLatency != 2500*time.Microsecond || m.Mounts[0].Workers != 8 {
+		t.Errorf("Got merged mounts %+v", m.Mounts)
+	}
+
+	d := b.Sub(a)
+	if d.TotalFiles != 200 || d.TotalBytes != -500 || d.Duration != 10*time.Second || d.FilesPerSecond != 5 || d.Mounts != nil {
+		t.Errorf("Got diff %+v", d)
+	}
+	if len(d.Skipped) != 1 || d.Skipped[0].Rule != "- *.o" {
+		t.Errorf("Expected unchanged skip rules to drop out of the diff, got %+v", d.Skipped)
+	}
+	back := a.Add(d)
+	if back.TotalFiles != b.TotalFiles || back.TotalBytes != b.TotalBytes || back.Duration != b.Duration || back.FilesPerSecond != b.FilesPerSecond {
+		t.Errorf("Got %+v adding the diff back, expected the totals of %+v", back, b)
+	}
+	if a.TotalFiles != 100 || len(a.Skipped) != 1 {
+		t.Error("Expected the operands to be left alone")
+	}
+}
+
+func TestStartRoots(t *testing.T) {
+	tmpDir := t.TempDir()
+	for name, size := range map[string]int{"a/1": 10, "a/2": 20, "b/1": 5, "b/sub/2": 5} {
+		path := filepath.Join(tmpDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b := filepath.Join(tmpDir, "a"), filepath.Join(tmpDir, "b")
+	s := NewScannerWithOptions(Options{Quiet: true})
+	total, roots := s.StartRoots([]string{a, b, filepath.Join(b, "sub")})
+	if total.TotalFiles != 4 || total.TotalDirs != 3 || total.TotalBytes != 40 {
+		t.Errorf("Got %d files, %d dirs, %d bytes in total", total.TotalFiles, total.TotalDirs, total.TotalBytes)
+	}
+	if len(roots) != 2 {
+		t.Fatalf("Expected the nested root to be left out, got %d roots", len(roots))
+	}
+	if r := roots[a]; r.TotalFiles != 2 || r.TotalDirs != 1 || r.TotalBytes != 30 || !r.Completed {
+		t.Errorf("Got %+v for a", r)
+	}
+	if r := roots[b]; r.TotalFiles != 2 || r.TotalDirs != 2 || r.TotalBytes != 10 {
+		t.Errorf("Got %+v for b", r)
+	}
+}
+
+func TestDirSummaries(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/1":     {Data: make([]byte, 10)},
+		"a/b/2":   {Data: make([]byte, 20)},
+		"a/b/c/3": {Data: make([]byte, 30)},
+		"d/4":     {Data: make([]byte, 40)},
+		"5":       {Data: make([]byte, 50)},
+	}
+	s := NewScannerWithOptions(Options{FS: fsys, Quiet: true})
+	dirs := s.DirSummaries(0)
+	var got []DirSummary
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for d := range dirs {
+			got = append(got, d)
+		}
+	}()
+	s.Start(".")
+	<-done
+
+	want := []DirSummary{
+		{Path: "a/b/c", Files: 1, Dirs: 1, Bytes: 30},
+		{Path: "a/b", Files: 2, Dirs: 2, Bytes: 50},
+		{Path: "a", Files: 3, Dirs: 3, Bytes: 60},
+		{Path: "d", Files: 1, Dirs: 1, Bytes: 40},
+		{Path: ".", Files: 5, Dirs: 5, Bytes: 150},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Got %v, expected %v", got, want)
+	}
+}
+
+// slowListFS wraps the real filesystem, delaying the listing of chosen
+// directories.
+type slowListFS struct {
+	FileSystem
+	delay map[string]time.Duration
+}
+
+func (f slowListFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	time.Sleep(f.delay[filepath.Base(name)])
+	return f.FileSystem.ReadDir(name)
+}
+
+func TestSlowestDirs(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"fast/1", "slow/1", "slow/2", "slower/sub/1"} {
+		path := filepath.Join(tmpDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fsys := slowListFS{FileSystem: OS(), delay: map[string]time.Duration{"slow": 20 * time.Millisecond, "slower": 60 * time.Millisecond}}
+	result := NewScannerWithOptions(Options{FileSystem: fsys, Quiet: true, SlowestDirs: 2}).Start(tmpDir)
+	got := result.SlowestDirs
+	// The time of a directory doesn't include its subdirectories'.
+	if len(got) != 2 || got[0].Path != filepath.Join(tmpDir, "slower") || got[0].Entries != 1 ||
+		got[1].Path != filepath.Join(tmpDir, "slow") || got[1].Entries != 2 || got[1].Duration < 20*time.Millisecond {
+		t.Errorf("Got %+v", got)
+	}
+
+	if result := NewScannerWithOptions(Options{Quiet: true}).Start(tmpDir); result.SlowestDirs != nil {
+		t.Errorf("Expected no timings unless asked for, got %+v", result.SlowestDirs)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"a/1", "a/2", "b/3"} {
+		path := filepath.Join(tmpDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, make([]byte, 1<<16), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sink := &collectSink{}
+	result := NewScannerWithOptions(Options{Quiet: true, Profile: true, Hash: true, Workers: 2, Sinks: []Sink{sink}}).Start(tmpDir)
+	p := result.Performance
+	if p == nil {
+		t.Fatal("Expected a performance breakdown")
+	}
+	for name, d := range map[string]time.Duration{"ReadDir": p.ReadDir, "WalkStat": p.WalkStat, "Stat": p.Stat, "Hash": p.Hash, "Busy": p.Busy, "Sinks": p.Sinks} {
+		if d <= 0 {
+			t.Errorf("Expected time in %s, got %v", name, d)
+		}
+	}
+	if p.Workers != 2 || p.Busy < p.Stat+p.Hash || p.WorkerTime < p.Busy+p.PathWait+p.MountWait {
+		t.Errorf("Inconsistent breakdown: %+v", p)
+	}
+	if u := p.Utilization(); u <= 0 || u > 1 {
+		t.Errorf("Utilization = %v", u)
+	}
+
+	if result := NewScannerWithOptions(Options{Quiet: true}).Start(tmpDir); result.Performance != nil {
+		t.Errorf("Expected no breakdown unless asked for, got %+v", result.Performance)
+	}
+}
+
+func TestStealQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q := newStealQueue(ctx, 2, 2)
+	for _, p := range []string{"a", "b", "c", "d"} {
+		q.push(p)
+	}
+	// Worker 0 got a and c, worker 1 b and d; each takes its newest first.
+	if p, _ := q.pop(0); p != "c" {
+		t.Errorf("Got %q from worker 0's own deque, expected c", p)
+	}
+	q.pop(0)
+	// Worker 0 is empty now and steals the oldest path of worker 1.
+	if p, _ := q.pop(0); p != "b" {
+		t.Errorf("Got %q stolen, expected b", p)
+	}
+
+	pushed := make(chan bool)
+	go func() {
+		for _, p := range []string{"e", "f", "g", "h"} {
+			q.push(p)
+		}
+		pushed <- true
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("Expected push to wait while every deque is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+	q.pop(1)
+	<-pushed
+	q.close()
+	n := 0
+	for {
+		if _, ok := q.pop(1); !ok {
+			break
+		}
+		n++
+	}
+	if n != 4 {
+		t.Errorf("Drained %d paths after close, expected 4", n)
+	}
+
+	q = newStealQueue(ctx, 1, 1)
+	q.push("x")
+	cancel()
+	if q.push("y") {
+		t.Error("Expected push to give up once cancelled")
+	}
+	if _, ok := q.pop(0); ok {
+		t.Error("Expected pop to give up once cancelled")
+	}
+}
+
+func TestWorkStealingScan(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for i := 0; i < 500; i++ {
+		fsys[fmt.Sprintf("d%d/f%d", i%7, i)] = &fstest.MapFile{Data: []byte("x")}
+	}
+	for _, depth := range []int{1, 3, 5000} {
+		result := NewScannerWithOptions(Options{FS: fsys, Quiet: true, Workers: 4, WorkStealing: true, PathQueue: depth}).Start(".")
+		if result.TotalFiles != 500 || result.TotalDirs != 8 || !result.Completed {
+			t.Errorf("Queue depth %d: got %d files, %d dirs", depth, result.TotalFiles, result.TotalDirs)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaultSkipPaths are pseudo and volatile filesystems that are pruned from
+// the walk instead of being descended into.
+var defaultSkipPaths = []string{
+	"/proc", "/sys", "/dev", "/run", "/tmp",
+	"/var/run", "/var/lock", "/var/tmp",
+}
+
+// SkipStats reports what one skip rule pruned: Count is the number of
+// entries the walk did not descend into or visit, Entries and Bytes an
+// estimate of what they contained.
+type SkipStats struct {
+	Rule    string
+	Count   int64
+	Entries int64
+	Bytes   int64
+}
+
+// skipRules matches paths against the rules that apply to a scan and counts
+// what each of them pruned.
+type skipRules struct {
+	rules []string
+	mu    sync.Mutex
+	stat  map[string]*SkipStats
+	fs    fileSystem
+}
+
+// newSkipRules drops rules that contain one of the roots, so that
+// explicitly scanning /tmp/build (or /proc) still works.
+func newSkipRules(rules []string, roots ...string) *skipRules {
+	sr := &skipRules{stat: make(map[string]*SkipStats), fs: osFS{}}
+rules:
+	for _, rule := range rules {
+		for _, root := range roots {
+			if within(filepath.Clean(root), rule) {
+				continue rules
+			}
+		}
+		sr.rules = append(sr.rules, rule)
+	}
+	return sr
+}
+
+// SkipFunc reports whether a scan of root would prune path by the default
+// skip rules, for walks done outside the Scanner. Like Start, it drops the
+// rules that contain root, so a root below /tmp is not pruned entirely.
+func SkipFunc(root string) func(path string) bool {
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	rules := newSkipRules(defaultSkipPaths, root)
+	return func(path string) bool { return rules.match(path) != "" }
+}
+
+// match returns the rule that prunes path, or "" if none does.
+func (sr *skipRules) match(path string) string {
+	for _, rule := range sr.rules {
+		if path == rule || strings.HasPrefix(path, rule+"/") {
+			return rule
+		}
+	}
+	return ""
+}
+
+// add records that rule pruned path, whose Lstat result is info (nil if it
+// could not be read).
+func (sr *skipRules) add(rule, path string, info os.FileInfo) {
+	entries, bytes := estimateSkipped(sr.fs, path, info)
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	st := sr.stat[rule]
+	if st == nil {
+		st = &SkipStats{Rule: rule}
+		sr.stat[rule] = st
+	}
+	st.Count++
+	st.Entries += entries
+	st.Bytes += bytes
+}
+
+// estimateSkipped guesses the size of a pruned entry without walking it. A
+// directory that is a mount point reports its filesystem's usage from
+// statfs; any other directory counts its immediate children only.
+func estimateSkipped(fsys fileSystem, path string, info os.FileInfo) (entries, bytes int64) {
+	if info == nil {
+		return 0, 0
+	}
+	if !info.IsDir() {
+		return 1, info.Size()
+	}
+
+	if _, native := fsys.(osFS); native && isMountPoint(path, info) {
+		if n, b, ok := fsUsage(path); ok {
+			return n, b
+		}
+	}
+	children, err := fsys.ReadDir(path)
+	if err != nil {
+		return 1, 0
+	}
+	entries = 1 + int64(len(children))
+	for _, child := range children {
+		if child.Type().IsRegular() {
+			if ci, err := child.Info(); err == nil {
+				bytes += ci.Size()
+			}
+		}
+	}
+	return entries, bytes
+}
+
+func isMountPoint(path string, info os.FileInfo) bool {
+	parent, err := os.Lstat(filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	dev, ok1 := deviceID(info)
+	parentDev, ok2 := deviceID(parent)
+	return ok1 && ok2 && dev != parentDev
+}
+
+func (sr *skipRules) stats() []SkipStats {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	out := make([]SkipStats, 0, len(sr.stat))
+	for _, st := range sr.stat {
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Rule < out[j].Rule })
+	return out
+}
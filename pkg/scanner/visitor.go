@@ -0,0 +1,36 @@
+package scanner
+
+import "os"
+
+// FileVisitor is driven by the scan with every entry it counts, so
+// programs embedding the scanner can build their own aggregations on top
+// of the concurrent traversal. Its methods are called from the scanning
+// workers, several at a time, and must be safe for concurrent use; a slow
+// visitor slows the scan down.
+type FileVisitor interface {
+	// VisitFile is called for every entry that isn't a directory,
+	// including symlinks and reparse points but not the repeated links of
+	// a hard-linked file under DedupHardlinks.
+	VisitFile(path string, info os.FileInfo)
+	// VisitDir is called for every directory, the root included.
+	VisitDir(path string, info os.FileInfo)
+	// HandleError is called for every entry that couldn't be read, with
+	// the error that was counted in the totals.
+	HandleError(path string, err error)
+}
+
+func (s *Scanner) visit(path string, info os.FileInfo) {
+	if v := s.opts.Visitor; v != nil {
+		if info.IsDir() && (s.opts.FS != nil || reparseKind(path, info) == "") {
+			v.VisitDir(path, info)
+		} else {
+			v.VisitFile(path, info)
+		}
+	}
+}
+
+func (s *Scanner) visitError(path string, err error) {
+	if v := s.opts.Visitor; v != nil {
+		v.HandleError(path, err)
+	}
+}
@@ -0,0 +1,108 @@
+// Package scantest runs the scanner against in-memory filesystems, so
+// aggregation logic built on it can be tested, in this repository or by
+// its consumers, without touching a real disk.
+package scantest
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"testing/fstest"
+
+	"file-counter/pkg/scanner"
+)
+
+// Tree describes a synthetic tree of Dirs directories holding Files files
+// each. The sizes of the files in a directory cycle through Sizes; with
+// none, files are empty. With a Depth above 1, each of the directories
+// holding files sits that many levels below the root, to exercise deep
+// paths.
+type Tree struct {
+	Dirs  int
+	Files int
+	Sizes []int64
+	Depth int
+}
+
+// FS builds the tree. File contents are zeros, all sharing one buffer, so
+// a tree of many large files stays cheap to build.
+func (t Tree) FS() fstest.MapFS {
+	var largest int64
+	for _, size := range t.Sizes {
+		largest = max(largest, size)
+	}
+	zeros := make([]byte, largest)
+	fsys := fstest.MapFS{}
+	for d := 0; d < t.Dirs; d++ {
+		dir := fmt.Sprintf("dir%04d", d)
+		for level := 1; level < t.Depth; level++ {
+			dir += fmt.Sprintf("/sub%d", level)
+		}
+		fsys[dir] = &fstest.MapFile{Mode: fs.ModeDir | 0755}
+		for f := 0; f < t.Files; f++ {
+			var size int64
+			if len(t.Sizes) > 0 {
+				size = t.Sizes[f%len(t.Sizes)]
+			}
+			fsys[fmt.Sprintf("%s/file%04d", dir, f)] = &fstest.MapFile{Data: zeros[:size], Mode: 0644}
+		}
+	}
+	return fsys
+}
+
+// Totals is what a scan of a filesystem should count. Dirs includes the
+// root.
+type Totals struct {
+	Files int64
+	Dirs  int64
+	Bytes int64
+}
+
+// Count walks fsys without the scanner, for checking scan results against.
+func Count(fsys fs.FS) (Totals, error) {
+	var t Totals
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			t.Dirs++
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		t.Files++
+		t.Bytes += info.Size()
+		return nil
+	})
+	return t, err
+}
+
+// Scan scans fsys from its root with opts, quietly.
+func Scan(fsys fs.FS, opts scanner.Options) *scanner.ScanResult {
+	opts.FS, opts.Quiet = fsys, true
+	return scanner.NewScannerWithOptions(opts).Start(".")
+}
+
+// Records scans fsys and returns the record of every entry, sorted by
+// path, along with the result.
+func Records(fsys fs.FS, opts scanner.Options) ([]*scanner.FileRecord, *scanner.ScanResult, error) {
+	sink := &collector{}
+	opts.Sinks = append(opts.Sinks, sink)
+	opts.FS, opts.Quiet = fsys, true
+	s := scanner.NewScannerWithOptions(opts)
+	result := s.Start(".")
+	sort.Slice(sink.records, func(i, j int) bool { return sink.records[i].Path < sink.records[j].Path })
+	return sink.records, result, s.Err()
+}
+
+type collector struct {
+	records []*scanner.FileRecord
+}
+
+func (c *collector) Write(rec *scanner.FileRecord) error {
+	c.records = append(c.records, rec)
+	return nil
+}
@@ -0,0 +1,45 @@
+package scantest
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"file-counter/pkg/scanner"
+)
+
+func TestTree(t *testing.T) {
+	fsys := Tree{Dirs: 20, Files: 50, Sizes: []int64{0, 1024, 1 << 20}, Depth: 3}.FS()
+	want, err := Count(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 20 branches of 3 levels each, plus the root.
+	if want.Files != 1000 || want.Dirs != 61 {
+		t.Fatalf("Got %+v", want)
+	}
+	result := Scan(fsys, scanner.Options{Workers: 8})
+	got := Totals{result.TotalFiles, result.TotalDirs, result.TotalBytes}
+	if got != want || result.TotalErrors != 0 {
+		t.Errorf("Scan got %+v with %d errors, expected %+v", got, result.TotalErrors, want)
+	}
+	if err := fstest.TestFS(Tree{Dirs: 2, Files: 2, Sizes: []int64{3}}.FS(), "dir0000/file0001"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRecords(t *testing.T) {
+	recs, result, err := Records(fstest.MapFS{
+		"b/y": {Data: []byte("12")},
+		"a":   {Data: []byte("1")},
+	}, scanner.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, rec := range recs {
+		paths = append(paths, rec.Path)
+	}
+	if len(paths) != 4 || paths[0] != "." || paths[1] != "a" || paths[3] != "b/y" || result.TotalBytes != 3 {
+		t.Errorf("Got %v, %d bytes", paths, result.TotalBytes)
+	}
+}
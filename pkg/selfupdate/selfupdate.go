@@ -0,0 +1,198 @@
+// Package selfupdate finds the latest release of file-counter, checks the
+// downloaded binary against the release's SHA256SUMS file, and the
+// checksums against their ed25519 signature, and swaps it in for the
+// running executable.
+//
+// Release metadata is in the shape of the GitHub releases API: a tag and
+// a list of named assets with download URLs. A release carries a binary
+// per platform named file-counter-GOOS-GOARCH (.exe on Windows), a
+// SHA256SUMS file in sha256sum format and, when signed, SHA256SUMS.sig
+// holding the raw 64-byte ed25519 signature of SHA256SUMS.
+package selfupdate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// DefaultURL is where the latest release is looked up.
+const DefaultURL = "https://api.github.com/repos/playfairs/file-counter/releases/latest"
+
+// Names of the checksum and signature assets.
+const (
+	SumsAsset = "SHA256SUMS"
+	SigAsset  = "SHA256SUMS.sig"
+)
+
+// maxBinary caps downloads, so a wrong URL can't fill the disk.
+const maxBinary = 512 << 20
+
+// Release is one published release.
+type Release struct {
+	Tag    string  `json:"tag_name"`
+	Assets []Asset `json:"assets"`
+}
+
+// Asset is one file attached to a release.
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// Asset returns the asset with the given name.
+func (r *Release) Asset(name string) (Asset, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Asset{}, false
+}
+
+// BinaryName is the name of the release asset for this platform.
+func BinaryName() string {
+	name := "file-counter-" + runtime.GOOS + "-" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Latest fetches the release metadata at url.
+func Latest(ctx context.Context, client *http.Client, url string) (*Release, error) {
+	data, err := fetch(ctx, client, url, 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	var r Release
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	if r.Tag == "" {
+		return nil, fmt.Errorf("%s: no release tag", url)
+	}
+	return &r, nil
+}
+
+// Download fetches an asset.
+func Download(ctx context.Context, client *http.Client, a Asset) ([]byte, error) {
+	return fetch(ctx, client, a.URL, maxBinary)
+}
+
+func fetch(ctx context.Context, client *http.Client, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json, application/octet-stream")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s: larger than %d bytes", url, limit)
+	}
+	return data, nil
+}
+
+// ParseKey decodes a base64 ed25519 public key.
+func ParseKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("release key must be a base64 ed25519 public key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// VerifySignature checks sig, the raw ed25519 signature of sums.
+func VerifySignature(key ed25519.PublicKey, sums, sig []byte) error {
+	if !ed25519.Verify(key, sums, sig) {
+		return errors.New("SHA256SUMS signature does not match the release key")
+	}
+	return nil
+}
+
+// VerifyChecksum checks data against the line for name in sums, which is
+// in sha256sum format.
+func VerifyChecksum(sums []byte, name string, data []byte) error {
+	sc := bufio.NewScanner(bytes.NewReader(sums))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		want, err := hex.DecodeString(fields[0])
+		if err != nil {
+			return fmt.Errorf("SHA256SUMS: bad checksum for %s", name)
+		}
+		got := sha256.Sum256(data)
+		if !bytes.Equal(got[:], want) {
+			return fmt.Errorf("%s does not match its SHA-256 in SHA256SUMS", name)
+		}
+		return nil
+	}
+	return fmt.Errorf("SHA256SUMS has no checksum for %s", name)
+}
+
+// Replace writes data over the executable at exe, keeping its mode. The
+// new binary is written next to it and renamed into place, so exe is
+// never left half written. Windows can't replace a running executable,
+// so there the old one is first moved aside to exe.old, which the next
+// update removes.
+func Replace(exe string, data []byte) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(exe)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(exe)+".new-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0111); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp.Name(), exe); err != nil {
+			os.Rename(old, exe)
+			return err
+		}
+		return nil
+	}
+	return os.Rename(tmp.Name(), exe)
+}
@@ -0,0 +1,98 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	binary := []byte("#!/bin/sh\necho new\n")
+	sum := sha256.Sum256(binary)
+	sums := []byte(hex.EncodeToString(sum[:]) + "  " + BinaryName() + "\n" +
+		"0000000000000000000000000000000000000000000000000000000000000000  file-counter-plan9-386\n")
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := ed25519.Sign(priv, sums)
+
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	mux.HandleFunc("/latest", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Release{Tag: "v2.0.0", Assets: []Asset{
+			{BinaryName(), srv.URL + "/bin"},
+			{SumsAsset, srv.URL + "/sums"},
+			{SigAsset, srv.URL + "/sig"},
+		}})
+	})
+	mux.HandleFunc("/bin", func(w http.ResponseWriter, r *http.Request) { w.Write(binary) })
+	mux.HandleFunc("/sums", func(w http.ResponseWriter, r *http.Request) { w.Write(sums) })
+	mux.HandleFunc("/sig", func(w http.ResponseWriter, r *http.Request) { w.Write(sig) })
+	srv = httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+	rel, err := Latest(ctx, srv.Client(), srv.URL+"/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Tag != "v2.0.0" {
+		t.Errorf("Got tag %q", rel.Tag)
+	}
+	asset, ok := rel.Asset(BinaryName())
+	if !ok {
+		t.Fatal("no binary for this platform")
+	}
+	data, err := Download(ctx, srv.Client(), asset)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ParseKey(base64.StdEncoding.EncodeToString(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySignature(key, sums, sig); err != nil {
+		t.Error(err)
+	}
+	if err := VerifySignature(key, append(sums, '\n'), sig); err == nil {
+		t.Error("Expected altered checksums to fail the signature check")
+	}
+	if err := VerifyChecksum(sums, BinaryName(), data); err != nil {
+		t.Error(err)
+	}
+	if err := VerifyChecksum(sums, BinaryName(), append(data, 0)); err == nil {
+		t.Error("Expected a corrupted binary to fail the checksum")
+	}
+	if err := VerifyChecksum(sums, "file-counter-other", data); err == nil {
+		t.Error("Expected a binary missing from SHA256SUMS to be rejected")
+	}
+	if _, err := ParseKey("c2hvcnQ="); err == nil {
+		t.Error("Expected a short key to be rejected")
+	}
+
+	exe := filepath.Join(t.TempDir(), "file-counter")
+	if err := os.WriteFile(exe, []byte("old"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := Replace(exe, data); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(exe)
+	info, _ := os.Stat(exe)
+	if string(got) != string(binary) || info.Mode().Perm() != 0751 {
+		t.Errorf("Got %q with mode %v", got, info.Mode())
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(exe)); len(entries) != 1 {
+		t.Errorf("Got %d files next to the executable, expected only it", len(entries))
+	}
+}
@@ -0,0 +1,128 @@
+package sensitive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// MaxContentSize is the largest file whose contents are scanned; secrets
+// live in small config and key files, and reading large files would slow
+// the scan down for little gain.
+const MaxContentSize = 1 << 20
+
+// Pattern is a named regular expression for one kind of secret.
+type Pattern struct {
+	Name string
+	Re   *regexp.Regexp
+}
+
+// DefaultPatterns match well-known credential formats.
+var DefaultPatterns = []Pattern{
+	{"aws access key id", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"aws secret access key", regexp.MustCompile(`(?i)aws_secret_access_key\s*[=:]\s*["']?[A-Za-z0-9/+=]{40}`)},
+	{"private key", regexp.MustCompile(`-----BEGIN ([A-Z]+ )?PRIVATE KEY( BLOCK)?-----`)},
+	{"github token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36}\b`)},
+	{"slack token", regexp.MustCompile(`\bxox[abprs]-[0-9A-Za-z-]{10,}`)},
+	{"google api key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+}
+
+// LoadPatterns reads patterns from a file of "name: regexp" lines. Blank
+// lines and lines starting with # are ignored.
+func LoadPatterns(name string) ([]Pattern, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var pats []Pattern
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kind, expr, ok := strings.Cut(line, ":")
+		kind, expr = strings.TrimSpace(kind), strings.TrimSpace(expr)
+		if !ok || kind == "" || expr == "" {
+			return nil, fmt.Errorf("%s:%d: expected name: regexp", name, n)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+		pats = append(pats, Pattern{kind, re})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(pats) == 0 {
+		return nil, fmt.Errorf("%s: no patterns", name)
+	}
+	return pats, nil
+}
+
+// Match is one secret found in a file. Text is redacted so that reports
+// can be shared without spreading the secret itself.
+type Match struct {
+	Path    string `json:"path"`
+	Line    int    `json:"line"`
+	Pattern string `json:"pattern"`
+	Text    string `json:"text"`
+}
+
+// ScanContent looks for pats in the file at path. Files larger than
+// MaxContentSize and files that don't look like text are skipped. It gives
+// up between lines once ctx is cancelled.
+func ScanContent(ctx context.Context, path string, size int64, pats []Pattern) ([]Match, error) {
+	if size > MaxContentSize || size == 0 {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, MaxContentSize))
+	if err != nil {
+		return nil, err
+	}
+	// A NUL byte near the start is the usual sign of a binary file.
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return nil, nil
+	}
+
+	var matches []Match
+	for n := 1; len(data) > 0; n++ {
+		if err := ctx.Err(); err != nil {
+			return matches, err
+		}
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		for _, p := range pats {
+			if loc := p.Re.FindIndex(line); loc != nil {
+				matches = append(matches, Match{Path: path, Line: n, Pattern: p.Name, Text: Redact(string(line[loc[0]:loc[1]]))})
+			}
+		}
+	}
+	return matches, nil
+}
+
+// Redact keeps the first four characters of a secret, enough to tell
+// which key it is, and masks the rest.
+func Redact(s string) string {
+	r := []rune(s)
+	if len(r) <= 4 {
+		return strings.Repeat("*", len(r))
+	}
+	return string(r[:4]) + strings.Repeat("*", min(len(r)-4, 16))
+}
@@ -0,0 +1,155 @@
+// Package sensitive recognises files that are likely to hold credentials,
+// such as private keys, keystores, password databases and .env files, by
+// their name, and flags those whose permissions let other users read them.
+package sensitive
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// rule maps file name globs to the kind of credential they suggest. A
+// pattern containing / is matched against the last path elements.
+type rule struct {
+	kind     string
+	patterns []string
+}
+
+var rules = []rule{
+	{"ssh private key", []string{"id_rsa", "id_dsa", "id_ecdsa", "id_ed25519", "id_ecdsa_sk", "id_ed25519_sk", "*.ppk"}},
+	{"private key", []string{"*.pem", "*.key", "*.p8"}},
+	{"keystore", []string{"*.p12", "*.pfx", "*.jks", "*.keystore", "*.bks"}},
+	{"password database", []string{"*.kdbx", "*.kdb", "*.psafe3", "*.1pif"}},
+	{"environment file", []string{".env", ".env.*", "*.env"}},
+	{"cloud credentials", []string{".aws/credentials", ".azure/accessTokens.json", "gcloud/credentials.db", "gcloud/application_default_credentials.json", ".docker/config.json", ".kube/config"}},
+	{"credentials file", []string{".netrc", "_netrc", ".pgpass", ".git-credentials", ".npmrc", ".pypirc", "credentials.json", "secrets.yml", "secrets.yaml", "*.tfstate"}},
+	{"shell history", []string{".bash_history", ".zsh_history", ".mysql_history", ".psql_history"}},
+}
+
+// notSecret are names the patterns above would catch that are public by
+// nature.
+var notSecret = []string{"*.pub", "*.crt", "*.cer", ".env.example", ".env.sample", ".env.template", "*.env.example"}
+
+// Kind returns the kind of credential the file at p is likely to hold, or
+// "" if its name doesn't suggest one.
+func Kind(p string) string {
+	p = filepath.ToSlash(p)
+	name := path.Base(p)
+	for _, pat := range notSecret {
+		if ok, _ := path.Match(pat, name); ok {
+			return ""
+		}
+	}
+	for _, r := range rules {
+		for _, pat := range r.patterns {
+			subject := name
+			if n := strings.Count(pat, "/"); n > 0 {
+				subject = lastElems(p, n+1)
+			}
+			if ok, _ := path.Match(pat, subject); ok {
+				return r.kind
+			}
+		}
+	}
+	return ""
+}
+
+// lastElems returns the last n slash-separated elements of p.
+func lastElems(p string, n int) string {
+	i := len(p)
+	for ; n > 0 && i > 0; n-- {
+		i = strings.LastIndexByte(p[:i], '/')
+		if i < 0 {
+			return p
+		}
+	}
+	return p[i+1:]
+}
+
+// Exposure describes who besides the owner may read a file with mode:
+// "world-readable", "group-readable" or "" when only the owner can.
+// Platforms without Unix permissions report "".
+func Exposure(mode os.FileMode) string {
+	switch {
+	case runtime.GOOS == "windows":
+		return "" // permissions there are ACLs, not mode bits
+	case mode&0o004 != 0:
+		return "world-readable"
+	case mode&0o040 != 0:
+		return "group-readable"
+	}
+	return ""
+}
+
+// Finding is one likely credential file.
+type Finding struct {
+	Path     string
+	Kind     string
+	Exposure string
+}
+
+// Dir summarises the findings in one directory.
+type Dir struct {
+	Path          string
+	Files         int
+	WorldReadable int
+	GroupReadable int
+	Kinds         []string
+	Findings      []Finding
+}
+
+// Tally collects findings per directory.
+type Tally struct {
+	dirs map[string]*Dir
+}
+
+// Add records f under its directory.
+func (t *Tally) Add(f Finding) {
+	if t.dirs == nil {
+		t.dirs = make(map[string]*Dir)
+	}
+	dir := filepath.Dir(f.Path)
+	d := t.dirs[dir]
+	if d == nil {
+		d = &Dir{Path: dir}
+		t.dirs[dir] = d
+	}
+	d.Files++
+	switch f.Exposure {
+	case "world-readable":
+		d.WorldReadable++
+	case "group-readable":
+		d.GroupReadable++
+	}
+	if i := sort.SearchStrings(d.Kinds, f.Kind); i == len(d.Kinds) || d.Kinds[i] != f.Kind {
+		d.Kinds = append(d.Kinds[:i], append([]string{f.Kind}, d.Kinds[i:]...)...)
+	}
+	d.Findings = append(d.Findings, f)
+}
+
+// Dirs returns the directories with findings, the most exposed first.
+func (t *Tally) Dirs() []*Dir {
+	out := make([]*Dir, 0, len(t.dirs))
+	for _, d := range t.dirs {
+		sort.Slice(d.Findings, func(i, j int) bool { return d.Findings[i].Path < d.Findings[j].Path })
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.WorldReadable != b.WorldReadable {
+			return a.WorldReadable > b.WorldReadable
+		}
+		if a.GroupReadable != b.GroupReadable {
+			return a.GroupReadable > b.GroupReadable
+		}
+		if a.Files != b.Files {
+			return a.Files > b.Files
+		}
+		return a.Path < b.Path
+	})
+	return out
+}
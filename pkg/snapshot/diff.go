@@ -0,0 +1,67 @@
+package snapshot
+
+import "sort"
+
+type Change struct {
+	Path   string
+	Old    *File
+	New    *File
+	Fields []string
+}
+
+type Diff struct {
+	Unchanged int
+	Added     []Change
+	Removed   []Change
+	Modified  []Change
+}
+
+func (d *Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// Compare reports how current differs from base. Hashes are only compared
+// when both sides recorded one.
+func Compare(base, current *Snapshot) *Diff {
+	before := make(map[string]*File, len(base.Files))
+	for i := range base.Files {
+		before[base.Files[i].Path] = &base.Files[i]
+	}
+
+	diff := &Diff{}
+	for i := range current.Files {
+		now := &current.Files[i]
+		old, ok := before[now.Path]
+		if !ok {
+			diff.Added = append(diff.Added, Change{Path: now.Path, New: now})
+			continue
+		}
+		delete(before, now.Path)
+
+		var fields []string
+		if old.Size != now.Size {
+			fields = append(fields, "size")
+		}
+		if !old.ModTime.Equal(now.ModTime) {
+			fields = append(fields, "mtime")
+		}
+		if old.Mode != now.Mode {
+			fields = append(fields, "mode")
+		}
+		if old.Hash != "" && now.Hash != "" && old.Hash != now.Hash {
+			fields = append(fields, "hash")
+		}
+
+		if len(fields) > 0 {
+			diff.Modified = append(diff.Modified, Change{Path: now.Path, Old: old, New: now, Fields: fields})
+		} else {
+			diff.Unchanged++
+		}
+	}
+
+	for path, old := range before {
+		diff.Removed = append(diff.Removed, Change{Path: path, Old: old})
+	}
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].Path < diff.Removed[j].Path })
+	return diff
+}
@@ -0,0 +1,100 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Failure is an entry a scan could not read. Path is absolute.
+type Failure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+	// Counted is set for directories that were found but could not be
+	// listed; the snapshot of the scan counts them in TotalDirs.
+	Counted bool `json:"counted,omitempty"`
+}
+
+// Failures lists the entries a scan of Root could not read, so that they
+// can be scanned again, typically with more privileges. Snapshot is the
+// snapshot file the scan saved, if any, which the results of that rescan
+// are merged into.
+type Failures struct {
+	Version   int       `json:"version"`
+	Root      string    `json:"root,omitempty"`
+	Snapshot  string    `json:"snapshot,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Failures  []Failure `json:"failures"`
+}
+
+// LoadFailures reads a list saved by Failures.Save.
+func LoadFailures(path string) (*Failures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f Failures
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing error list %s: %w", path, err)
+	}
+	if f.Version != Version {
+		return nil, fmt.Errorf("error list %s has unsupported version %d", path, f.Version)
+	}
+	return &f, nil
+}
+
+// Save writes the list to path, sorted by path.
+func (f *Failures) Save(path string) error {
+	if f.Failures == nil {
+		f.Failures = []Failure{}
+	}
+	sort.Slice(f.Failures, func(i, j int) bool { return f.Failures[i].Path < f.Failures[j].Path })
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Merge replaces the files of s at and below sub.Root with those of sub, a
+// snapshot of part of the same tree, and adjusts the totals. counted says
+// whether s already counts sub.Root as a directory, as it does for one it
+// found but could not list.
+func (s *Snapshot) Merge(sub *Snapshot, counted bool) error {
+	rel, err := filepath.Rel(s.Root, sub.Root)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s is not below %s", sub.Root, s.Root)
+	}
+	prefix := filepath.ToSlash(rel)
+	files := s.Files[:0]
+	for _, f := range s.Files {
+		if prefix == "." || f.Path == prefix || strings.HasPrefix(f.Path, prefix+"/") {
+			s.TotalFiles--
+			s.TotalBytes -= f.Size
+			continue
+		}
+		files = append(files, f)
+	}
+	for _, f := range sub.Files {
+		f.Path = path.Join(prefix, f.Path)
+		files = append(files, f)
+	}
+	s.Files = files
+	s.TotalFiles += sub.TotalFiles
+	s.TotalBytes += sub.TotalBytes
+	s.TotalDirs += sub.TotalDirs
+	if counted && sub.TotalDirs > 0 {
+		s.TotalDirs--
+	}
+	sort.Slice(s.Files, func(i, j int) bool { return s.Files[i].Path < s.Files[j].Path })
+	return nil
+}
@@ -0,0 +1,159 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"file-counter/pkg/hashcache"
+	"file-counter/pkg/manifest"
+)
+
+// Version is bumped whenever the on-disk layout changes incompatibly.
+const Version = 1
+
+type File struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Mode    uint32    `json:"mode"`
+	Hash    string    `json:"hash,omitempty"`
+}
+
+// Snapshot is the persisted state of one scan of Root. File paths are
+// slash-separated and relative to Root.
+type Snapshot struct {
+	Version    int       `json:"version"`
+	Root       string    `json:"root"`
+	CreatedAt  time.Time `json:"created_at"`
+	TotalFiles int64     `json:"total_files"`
+	TotalDirs  int64     `json:"total_dirs"`
+	TotalBytes int64     `json:"total_bytes"`
+	Files      []File    `json:"files"`
+}
+
+type Options struct {
+	Hash bool
+	// HashCache, when set, supplies the hashes of files unchanged since
+	// they were last hashed, and keeps the new ones.
+	HashCache *hashcache.Cache
+	Skip      func(path string) bool
+	// OnError, when set, is told about every entry that can't be read,
+	// which is then left out, instead of Build failing on the first.
+	OnError func(Failure)
+}
+
+func Build(root string, opts Options) (*Snapshot, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &Snapshot{Version: Version, Root: abs, CreatedAt: time.Now().UTC()}
+	failed := func(path string, counted bool, err error) error {
+		if opts.OnError == nil {
+			return err
+		}
+		opts.OnError(Failure{Path: path, Error: err.Error(), Counted: counted})
+		return nil
+	}
+	err = filepath.WalkDir(abs, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// A directory that can't be listed was counted when it was
+			// found.
+			return failed(path, d != nil && d.IsDir(), err)
+		}
+		if opts.Skip != nil && opts.Skip(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			snap.TotalDirs++
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return failed(path, false, err)
+		}
+		rel, err := filepath.Rel(abs, path)
+		if err != nil {
+			return err
+		}
+
+		file := File{
+			Path:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime().UTC(),
+			Mode:    uint32(info.Mode()),
+		}
+		if opts.Hash && info.Mode().IsRegular() {
+			if file.Hash, err = hashFile(path, info, opts.HashCache); err != nil {
+				return failed(path, false, err)
+			}
+		}
+
+		snap.Files = append(snap.Files, file)
+		snap.TotalFiles++
+		snap.TotalBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(snap.Files, func(i, j int) bool { return snap.Files[i].Path < snap.Files[j].Path })
+	return snap, nil
+}
+
+// hashFile hashes the file at path, or takes its hash from cache.
+func hashFile(path string, info os.FileInfo, cache *hashcache.Cache) (string, error) {
+	if cache == nil {
+		return manifest.HashFile(path)
+	}
+	if hash, ok := cache.Lookup(path, info); ok {
+		return hash, nil
+	}
+	hash, err := manifest.HashFile(path)
+	if err == nil {
+		cache.Store(path, info, hash)
+	}
+	return hash, err
+}
+
+func Load(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("parsing snapshot %s: %w", path, err)
+	}
+	if snap.Version != Version {
+		return nil, fmt.Errorf("snapshot %s has unsupported version %d", path, snap.Version)
+	}
+	return &snap, nil
+}
+
+func (s *Snapshot) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an interrupted save never leaves a
+	// truncated baseline behind.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,138 @@
+package snapshot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildSaveLoad(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "sub", "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := Build(root, Options{Hash: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.TotalFiles != 1 || snap.TotalDirs != 2 || snap.TotalBytes != 5 {
+		t.Errorf("Unexpected totals: files=%d dirs=%d bytes=%d", snap.TotalFiles, snap.TotalDirs, snap.TotalBytes)
+	}
+	if snap.Files[0].Path != "sub/a.txt" || snap.Files[0].Hash == "" {
+		t.Errorf("Unexpected file entry: %+v", snap.Files[0])
+	}
+
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := snap.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := Compare(snap, loaded); !diff.Empty() || diff.Unchanged != 1 {
+		t.Errorf("Round trip changed the snapshot: %+v", diff)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	now := time.Now()
+	base := &Snapshot{Files: []File{
+		{Path: "same", Size: 1, ModTime: now, Hash: "aa"},
+		{Path: "gone", Size: 1, ModTime: now},
+		{Path: "edited", Size: 1, ModTime: now, Hash: "aa"},
+	}}
+	current := &Snapshot{Files: []File{
+		{Path: "same", Size: 1, ModTime: now, Hash: "aa"},
+		{Path: "edited", Size: 1, ModTime: now, Hash: "bb"},
+		{Path: "new", Size: 2, ModTime: now},
+	}}
+
+	diff := Compare(base, current)
+	if diff.Unchanged != 1 {
+		t.Errorf("Expected 1 unchanged, got %d", diff.Unchanged)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].Path != "new" {
+		t.Errorf("Unexpected added: %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Path != "gone" {
+		t.Errorf("Unexpected removed: %+v", diff.Removed)
+	}
+	if len(diff.Modified) != 1 || diff.Modified[0].Fields[0] != "hash" {
+		t.Errorf("Unexpected modified: %+v", diff.Modified)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	root := t.TempDir()
+	for name, data := range map[string]string{"sub/a": "1", "other/b": "22"} {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snap, err := Build(root, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// What couldn't be read the first time around turns up in a rescan.
+	os.MkdirAll(filepath.Join(root, "sub", "deeper"), 0755)
+	os.WriteFile(filepath.Join(root, "sub", "deeper", "c"), []byte("333"), 0644)
+	sub, err := Build(filepath.Join(root, "sub"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.Merge(sub, true); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range snap.Files {
+		paths = append(paths, f.Path)
+	}
+	if fmt.Sprint(paths) != "[other/b sub/a sub/deeper/c]" || snap.TotalFiles != 3 || snap.TotalBytes != 6 || snap.TotalDirs != 4 {
+		t.Errorf("Got %v, %d files, %d bytes, %d dirs", paths, snap.TotalFiles, snap.TotalBytes, snap.TotalDirs)
+	}
+
+	if err := snap.Merge(&Snapshot{Root: t.TempDir()}, false); err == nil {
+		t.Error("Expected merging another tree to fail")
+	}
+}
+
+func TestFailures(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	var failures []Failure
+	if _, err := Build(missing, Options{}); err == nil {
+		t.Error("Expected an unreadable root to fail the build")
+	}
+	snap, err := Build(missing, Options{OnError: func(f Failure) { failures = append(failures, f) }})
+	if err != nil || snap.TotalFiles != 0 {
+		t.Fatalf("Got %+v, %v", snap, err)
+	}
+	if len(failures) != 1 || failures[0].Path != missing || failures[0].Counted {
+		t.Errorf("Got failures %+v", failures)
+	}
+
+	path := filepath.Join(t.TempDir(), "errors.json")
+	saved := &Failures{Version: Version, Root: "/srv", Snapshot: "/srv/baseline.json", Failures: []Failure{
+		{Path: "/srv/z", Error: "permission denied"},
+		{Path: "/srv/a", Error: "permission denied", Counted: true},
+	}}
+	if err := saved.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFailures(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Snapshot != saved.Snapshot || len(loaded.Failures) != 2 || loaded.Failures[0] != (Failure{"/srv/a", "permission denied", true}) {
+		t.Errorf("Round trip changed the list: %+v", loaded)
+	}
+}
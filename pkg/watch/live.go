@@ -0,0 +1,467 @@
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"file-counter/pkg/index"
+)
+
+// Counts are the totals of a tree. As in an index, Dirs includes the root.
+type Counts struct {
+	Files int64 `json:"files"`
+	Dirs  int64 `json:"dirs"`
+	Bytes int64 `json:"bytes"`
+}
+
+// Tree holds the size of everything in a tree by path, so its counts stay
+// exact as single entries come and go. Paths are slash-separated and
+// relative to the root, which is ".".
+type Tree struct {
+	root   *node
+	counts Counts
+}
+
+type node struct {
+	size int64
+	dir  bool
+	kids map[string]*node
+}
+
+// NewTree returns a tree holding only its root.
+func NewTree() *Tree {
+	return &Tree{root: &node{dir: true, kids: map[string]*node{}}, counts: Counts{Dirs: 1}}
+}
+
+// Counts returns the totals of the tree.
+func (t *Tree) Counts() Counts { return t.counts }
+
+// Set adds or updates the entry at rel, adding any missing parent
+// directories. The size of directories is ignored.
+func (t *Tree) Set(rel string, size int64, dir bool) {
+	if rel == "." {
+		return
+	}
+	parent, name := t.dir(path.Dir(rel)), path.Base(rel)
+	n := parent.kids[name]
+	if n != nil && n.dir != dir {
+		t.drop(rel, n, nil)
+		n = nil
+	}
+	if n == nil {
+		n = &node{dir: dir}
+		if dir {
+			n.kids = map[string]*node{}
+			t.counts.Dirs++
+		} else {
+			t.counts.Files++
+		}
+		parent.kids[name] = n
+	}
+	if !dir {
+		t.counts.Bytes += size - n.size
+		n.size = size
+	}
+}
+
+// Remove drops rel and everything below it, returning the directories
+// that went with it. The root cannot be removed.
+func (t *Tree) Remove(rel string) []string {
+	if rel == "." {
+		return nil
+	}
+	parent := t.get(path.Dir(rel))
+	if parent == nil || !parent.dir {
+		return nil
+	}
+	name := path.Base(rel)
+	n := parent.kids[name]
+	if n == nil {
+		return nil
+	}
+	delete(parent.kids, name)
+	var dirs []string
+	t.drop(rel, n, &dirs)
+	return dirs
+}
+
+// get returns the node at rel, or nil.
+func (t *Tree) get(rel string) *node {
+	n := t.root
+	if rel == "." {
+		return n
+	}
+	for _, name := range strings.Split(rel, "/") {
+		if !n.dir {
+			return nil
+		}
+		if n = n.kids[name]; n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// dir returns the directory at rel, adding it and its parents, or turning
+// files in the way into directories, as needed.
+func (t *Tree) dir(rel string) *node {
+	n := t.root
+	if rel == "." {
+		return n
+	}
+	cur := "."
+	for _, name := range strings.Split(rel, "/") {
+		cur = path.Join(cur, name)
+		kid := n.kids[name]
+		if kid != nil && !kid.dir {
+			t.drop(cur, kid, nil)
+			kid = nil
+		}
+		if kid == nil {
+			kid = &node{dir: true, kids: map[string]*node{}}
+			n.kids[name] = kid
+			t.counts.Dirs++
+		}
+		n = kid
+	}
+	return n
+}
+
+// drop takes n, found at rel, and everything below it out of the counts,
+// appending the directories among them to dirs if it is not nil.
+func (t *Tree) drop(rel string, n *node, dirs *[]string) {
+	if !n.dir {
+		t.counts.Files--
+		t.counts.Bytes -= n.size
+		return
+	}
+	t.counts.Dirs--
+	if dirs != nil {
+		*dirs = append(*dirs, rel)
+	}
+	for name, kid := range n.kids {
+		t.drop(path.Join(rel, name), kid, dirs)
+	}
+}
+
+// errWatchLimit is returned by a watcher that has run out of watches.
+var errWatchLimit = errors.New("watch limit reached")
+
+// watcher is how a platform tells a Live about changes. With Live.mu held,
+// it calls Live.changed for every path that may have changed, or
+// Live.rescan for every directory whose entries may have, counting them in
+// Live.stats.Events, and Live.overflowed when it lost events.
+type watcher interface {
+	// watch starts watching the directory rel for changes to its entries.
+	watch(rel string) error
+	// unwatch stops watching rel, if it was watched.
+	unwatch(rel string)
+	// watches returns how many directories are watched.
+	watches() int
+	// run delivers events until close is called.
+	run()
+	close() error
+}
+
+// Live keeps the exact counts of a tree up to date from the platform's
+// change events instead of walking it again, for trees small enough to
+// watch every directory. Directories that could not be watched, once the
+// watch limit is reached, are walked again by Poll instead.
+type Live struct {
+	Root string
+
+	opts      index.Options
+	w         watcher
+	mu        sync.Mutex
+	tree      *Tree
+	unwatched map[string]bool
+	stats     LiveStats
+	err       error
+
+	// What changed since the last call to Changes, and that call's
+	// position.
+	dirty index.Dirs
+	lost  bool
+	pos   index.Journal
+}
+
+// LiveStats say how a Live is keeping up. Unwatched counts the
+// directories, each with everything below it, that Poll walks because
+// they could not be watched; Limit is why, once the watch limit is hit.
+type LiveStats struct {
+	Watches   int    `json:"watches"`
+	Unwatched int    `json:"unwatched"`
+	Events    int64  `json:"events"`
+	Overflows int64  `json:"overflows"`
+	Limit     string `json:"limit,omitempty"`
+}
+
+// NewLive watches every directory of the tree at root and counts it. Each
+// directory is watched before it is listed, so nothing changed during the
+// initial walk is missed.
+func NewLive(root string, opts index.Options) (*Live, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", abs)
+	}
+	l := &Live{Root: abs, opts: opts, tree: NewTree(), unwatched: map[string]bool{}, pos: index.Journal{ID: uint64(time.Now().UnixNano())}}
+	if l.w, err = newWatcher(l); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	err = l.add(".", true)
+	l.mu.Unlock()
+	if err != nil {
+		l.w.close()
+		return nil, err
+	}
+	go l.w.run()
+	return l, nil
+}
+
+// Counts returns the current totals.
+func (l *Live) Counts() Counts {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.tree.Counts()
+}
+
+// Stats returns how the Live is keeping up.
+func (l *Live) Stats() LiveStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st := l.stats
+	st.Watches = l.w.watches()
+	st.Unwatched = len(l.unwatched)
+	return st
+}
+
+// Err returns why the counts stopped being kept up to date, such as the
+// root being removed, or nil.
+func (l *Live) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Poll walks the directories that are not watched again, trying to watch
+// them in case watches were freed since.
+func (l *Live) Poll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	dirs := make([]string, 0, len(l.unwatched))
+	for rel := range l.unwatched {
+		dirs = append(dirs, rel)
+	}
+	sort.Strings(dirs)
+	for _, rel := range dirs {
+		delete(l.unwatched, rel)
+		if rel == "." {
+			l.tree = NewTree()
+			l.add(".", true)
+			continue
+		}
+		l.remove(rel)
+		l.changed(rel)
+	}
+}
+
+// Name returns the name of the platform's events, to make Live an
+// index.ChangeSource.
+func (l *Live) Name() string { return LiveBackend }
+
+// Changes makes Live an index.ChangeSource, so an index of the tree can be
+// updated by listing only the directories that had events. It returns
+// those since the last call, when old was built right after it, along
+// with every directory that is not watched and everything below it.
+func (l *Live) Changes(abs string, old *index.Index) (index.Dirs, *index.Journal, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	dirs, lost := l.dirty, l.lost || l.err != nil
+	l.dirty, l.lost = nil, false
+	known := old.Journal != nil && *old.Journal == l.pos && abs == l.Root
+	l.pos.Next++
+	pos := l.pos
+	if !known || lost {
+		return nil, &pos, false
+	}
+	if dirs == nil {
+		dirs = index.Dirs{}
+	}
+	for rel := range l.unwatched {
+		dirs[rel] = true
+	}
+	return dirs, &pos, true
+}
+
+// mark notes that the entries of the directory rel, and with all set
+// everything below it, changed. l.mu must be held.
+func (l *Live) mark(rel string, all bool) {
+	if l.dirty == nil {
+		l.dirty = index.Dirs{}
+	}
+	l.dirty[rel] = l.dirty[rel] || all
+}
+
+// Close stops watching the tree.
+func (l *Live) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.close()
+}
+
+// changed brings rel up to date with what is on disk now. Events only say
+// where to look, so applying one twice or late does no harm. l.mu must be
+// held.
+func (l *Live) changed(rel string) {
+	full := filepath.Join(l.Root, filepath.FromSlash(rel))
+	info, err := os.Lstat(full)
+	if rel == "." {
+		if err != nil && l.err == nil {
+			l.err = fmt.Errorf("%s was removed", l.Root)
+		}
+		return
+	}
+	l.mark(path.Dir(rel), false)
+	if err != nil || l.opts.Skip != nil && l.opts.Skip(full) {
+		l.remove(rel)
+		return
+	}
+	n := l.tree.get(rel)
+	switch {
+	case !info.IsDir():
+		if n != nil && n.dir {
+			l.remove(rel)
+		}
+		l.tree.Set(rel, info.Size(), false)
+	case n == nil || !n.dir:
+		l.tree.Set(rel, 0, true)
+		l.add(rel, !l.unwatchedAbove(rel))
+	}
+}
+
+// rescan brings the directory rel up to date by listing it again, for
+// watchers that only say which directories changed. With recursive set,
+// the directories below it are listed again too. l.mu must be held.
+func (l *Live) rescan(rel string, recursive bool) {
+	l.mark(rel, recursive)
+	n := l.tree.get(rel)
+	if n == nil || !n.dir {
+		l.changed(rel)
+		return
+	}
+	entries, err := os.ReadDir(filepath.Join(l.Root, filepath.FromSlash(rel)))
+	if err != nil {
+		l.changed(rel)
+		return
+	}
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		seen[e.Name()] = true
+	}
+	for name := range n.kids {
+		if !seen[name] {
+			l.remove(path.Join(rel, name))
+		}
+	}
+	for _, e := range entries {
+		child, kid := path.Join(rel, e.Name()), n.kids[e.Name()]
+		l.changed(child)
+		// New directories were just walked whole.
+		if recursive && kid != nil && kid.dir && e.IsDir() {
+			l.rescan(child, true)
+		}
+	}
+}
+
+// overflowed counts the tree again after the watcher lost events. Watching
+// a directory that is already watched is harmless. l.mu must be held.
+func (l *Live) overflowed() {
+	l.stats.Overflows++
+	l.lost = true
+	l.tree = NewTree()
+	clear(l.unwatched)
+	if err := l.add(".", true); err != nil && l.err == nil {
+		l.err = err
+	}
+}
+
+// add watches the directory rel, if watch is set, then lists it and adds
+// what it holds to the tree, recursively. A directory that cannot be
+// watched is noted for Poll, along with everything below it. l.mu must be
+// held.
+func (l *Live) add(rel string, watch bool) error {
+	dir := filepath.Join(l.Root, filepath.FromSlash(rel))
+	if watch {
+		if err := l.w.watch(rel); errors.Is(err, errWatchLimit) {
+			l.stats.Limit = err.Error()
+			l.unwatched[rel] = true
+			watch = false
+		} else if err != nil && rel == "." {
+			return err
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if rel == "." {
+			return err
+		}
+		return nil
+	}
+	for _, e := range entries {
+		full := filepath.Join(dir, e.Name())
+		if l.opts.Skip != nil && l.opts.Skip(full) {
+			continue
+		}
+		info, err := os.Lstat(full)
+		if err != nil {
+			continue
+		}
+		child := path.Join(rel, e.Name())
+		if info.IsDir() {
+			l.tree.Set(child, 0, true)
+			l.add(child, watch)
+		} else {
+			l.tree.Set(child, info.Size(), false)
+		}
+	}
+	return nil
+}
+
+// remove drops rel from the tree and stops watching the directories that
+// went with it. l.mu must be held.
+func (l *Live) remove(rel string) {
+	for _, dir := range l.tree.Remove(rel) {
+		if l.unwatched[dir] {
+			delete(l.unwatched, dir)
+			continue
+		}
+		l.w.unwatch(dir)
+	}
+}
+
+// unwatchedAbove reports whether rel is below a directory Poll walks.
+func (l *Live) unwatchedAbove(rel string) bool {
+	for dir := path.Dir(rel); ; dir = path.Dir(dir) {
+		if l.unwatched[dir] {
+			return true
+		}
+		if dir == "." {
+			return false
+		}
+	}
+}
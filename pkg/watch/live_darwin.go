@@ -0,0 +1,129 @@
+//go:build cgo
+
+package watch
+
+/*
+#cgo LDFLAGS: -framework CoreServices
+#include <CoreServices/CoreServices.h>
+#include <dispatch/dispatch.h>
+#include <stdint.h>
+#include <stdlib.h>
+
+extern void fseventsCallback(void *stream, uintptr_t info, size_t n, char **paths, FSEventStreamEventFlags *flags, FSEventStreamEventId *ids);
+
+// startStream watches the tree at path for directories whose entries
+// change, delivering events on a queue of their own.
+static FSEventStreamRef startStream(const char *path, uintptr_t info, double latency) {
+	CFStringRef p = CFStringCreateWithCString(NULL, path, kCFStringEncodingUTF8);
+	CFArrayRef paths = CFArrayCreate(NULL, (const void **)&p, 1, &kCFTypeArrayCallBacks);
+	FSEventStreamContext ctx = {0, (void *)info, NULL, NULL, NULL};
+	FSEventStreamRef s = FSEventStreamCreate(NULL, (FSEventStreamCallback)fseventsCallback, &ctx, paths,
+		kFSEventStreamEventIdSinceNow, latency, kFSEventStreamCreateFlagNoDefer | kFSEventStreamCreateFlagWatchRoot);
+	CFRelease(paths);
+	CFRelease(p);
+	if (s == NULL) {
+		return NULL;
+	}
+	dispatch_queue_t q = dispatch_queue_create("file-counter.fsevents", DISPATCH_QUEUE_SERIAL);
+	FSEventStreamSetDispatchQueue(s, q);
+	dispatch_release(q);
+	if (!FSEventStreamStart(s)) {
+		FSEventStreamInvalidate(s);
+		FSEventStreamRelease(s);
+		return NULL;
+	}
+	return s;
+}
+
+static void stopStream(FSEventStreamRef s) {
+	FSEventStreamStop(s);
+	FSEventStreamInvalidate(s);
+	FSEventStreamRelease(s);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime/cgo"
+	"strings"
+	"sync/atomic"
+	"unsafe"
+)
+
+const LiveBackend = "FSEvents"
+
+// fseventsLatency is how long FSEvents coalesces changes before reporting
+// the directories they were in.
+const fseventsLatency = 0.2
+
+// fsevents watches a whole tree with one FSEvents stream. It only learns
+// which directories changed, which are then listed again, as watching
+// every file with kqueue would run out of descriptors on large trees.
+type fsevents struct {
+	l      *Live
+	real   string
+	stream C.FSEventStreamRef
+	closed atomic.Bool
+	done   chan struct{}
+}
+
+func newWatcher(l *Live) (watcher, error) {
+	// Events name real paths, such as /private/var for /var.
+	real, err := filepath.EvalSymlinks(l.Root)
+	if err != nil {
+		return nil, err
+	}
+	w := &fsevents{l: l, real: real, done: make(chan struct{})}
+	// The handle is never deleted, as a callback may still be queued
+	// after the stream is stopped.
+	h := cgo.NewHandle(w)
+	path := C.CString(real)
+	defer C.free(unsafe.Pointer(path))
+	if w.stream = C.startStream(path, C.uintptr_t(h), fseventsLatency); w.stream == nil {
+		h.Delete()
+		return nil, errors.New("could not start an FSEvents stream")
+	}
+	return w, nil
+}
+
+// The stream covers every directory below the root.
+func (w *fsevents) watch(rel string) error { return nil }
+func (w *fsevents) unwatch(rel string)     {}
+func (w *fsevents) watches() int           { return 1 }
+
+func (w *fsevents) run() { <-w.done }
+
+// close is called with Live.mu held, which a callback may be waiting
+// for, so the stream is stopped without waiting on it.
+func (w *fsevents) close() error {
+	if !w.closed.Swap(true) {
+		go C.stopStream(w.stream)
+		close(w.done)
+	}
+	return nil
+}
+
+// event applies one event, for the directory p. l.mu must be held.
+func (w *fsevents) event(p string, flags C.FSEventStreamEventFlags) {
+	switch {
+	case flags&(C.kFSEventStreamEventFlagUserDropped|C.kFSEventStreamEventFlagKernelDropped) != 0:
+		w.l.overflowed()
+		return
+	case flags&C.kFSEventStreamEventFlagRootChanged != 0:
+		w.l.changed(".")
+		return
+	}
+	p = strings.TrimSuffix(p, "/")
+	rel := "."
+	if p != w.real {
+		r, ok := strings.CutPrefix(p, w.real+"/")
+		if !ok {
+			return
+		}
+		rel = r
+	}
+	w.l.stats.Events++
+	w.l.rescan(rel, flags&C.kFSEventStreamEventFlagMustScanSubDirs != 0)
+}
@@ -0,0 +1,32 @@
+//go:build cgo
+
+package watch
+
+/*
+#include <CoreServices/CoreServices.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"runtime/cgo"
+	"unsafe"
+)
+
+// fseventsCallback is called by FSEvents, on the stream's queue, with the
+// directories that changed. It is kept apart from the stream code, as a
+// file with exports may only declare C functions.
+//
+//export fseventsCallback
+func fseventsCallback(stream unsafe.Pointer, info C.uintptr_t, n C.size_t, paths **C.char, flags *C.FSEventStreamEventFlags, ids *C.FSEventStreamEventId) {
+	w := cgo.Handle(info).Value().(*fsevents)
+	ps, fs := unsafe.Slice(paths, int(n)), unsafe.Slice(flags, int(n))
+	w.l.mu.Lock()
+	defer w.l.mu.Unlock()
+	if w.closed.Load() {
+		return
+	}
+	for i := range ps {
+		w.event(C.GoString(ps[i]), fs[i])
+	}
+}
@@ -0,0 +1,137 @@
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// LiveBackend names what NewLive is told about changes by, or is "" where
+// it is not available.
+const LiveBackend = "inotify"
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF |
+	syscall.IN_ONLYDIR | syscall.IN_DONT_FOLLOW | syscall.IN_EXCL_UNLINK
+
+// inotify watches each directory of a Live with its own inotify watch.
+// Watch descriptors are only touched with Live.mu held.
+type inotify struct {
+	l    *Live
+	fd   int
+	f    *os.File
+	dirs map[int32]string
+	wds  map[string]int32
+}
+
+func newWatcher(l *Live) (watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %w", err)
+	}
+	// A non-blocking descriptor goes to the runtime poller, so closing f
+	// wakes a pending Read.
+	return &inotify{l: l, fd: fd, f: os.NewFile(uintptr(fd), "inotify"), dirs: map[int32]string{}, wds: map[string]int32{}}, nil
+}
+
+func (w *inotify) watch(rel string) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, filepath.Join(w.l.Root, filepath.FromSlash(rel)), inotifyMask)
+	if err == syscall.ENOSPC {
+		return fmt.Errorf("%w: raise fs.inotify.max_user_watches (now %s)", errWatchLimit, maxUserWatches())
+	}
+	if err != nil {
+		return err
+	}
+	// Watching a directory again, after a move, gives back the same
+	// descriptor.
+	if old, ok := w.dirs[int32(wd)]; ok {
+		delete(w.wds, old)
+	}
+	w.dirs[int32(wd)] = rel
+	w.wds[rel] = int32(wd)
+	return nil
+}
+
+func (w *inotify) unwatch(rel string) {
+	if wd, ok := w.wds[rel]; ok {
+		delete(w.wds, rel)
+		delete(w.dirs, wd)
+		syscall.InotifyRmWatch(w.fd, uint32(wd))
+	}
+}
+
+func (w *inotify) watches() int { return len(w.dirs) }
+
+func (w *inotify) run() {
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := w.f.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.l.mu.Lock()
+				if w.l.err == nil {
+					w.l.err = fmt.Errorf("inotify: %w", err)
+				}
+				w.l.mu.Unlock()
+			}
+			return
+		}
+		w.l.mu.Lock()
+		w.apply(buf[:n])
+		w.l.mu.Unlock()
+	}
+}
+
+// apply handles one read's worth of events.
+func (w *inotify) apply(buf []byte) {
+	for len(buf) >= syscall.SizeofInotifyEvent {
+		ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[0]))
+		end := syscall.SizeofInotifyEvent + int(ev.Len)
+		name := strings.TrimRight(string(buf[syscall.SizeofInotifyEvent:end]), "\x00")
+		buf = buf[end:]
+
+		switch {
+		case ev.Mask&syscall.IN_Q_OVERFLOW != 0:
+			w.l.overflowed()
+			continue
+		case ev.Mask&syscall.IN_IGNORED != 0:
+			// The watch is gone, removed by us or with its directory.
+			if rel, ok := w.dirs[ev.Wd]; ok {
+				delete(w.dirs, ev.Wd)
+				delete(w.wds, rel)
+			}
+			continue
+		}
+		dir, ok := w.dirs[ev.Wd]
+		if !ok {
+			continue
+		}
+		rel := dir
+		if name != "" {
+			rel = path.Join(dir, name)
+		} else if ev.Mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0 && dir != "." {
+			// The parent's event covers it.
+			continue
+		}
+		w.l.stats.Events++
+		w.l.changed(rel)
+	}
+}
+
+func (w *inotify) close() error {
+	return w.f.Close()
+}
+
+// maxUserWatches returns the per-user inotify watch limit, for messages.
+func maxUserWatches() string {
+	b, err := os.ReadFile("/proc/sys/fs/inotify/max_user_watches")
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(b))
+}
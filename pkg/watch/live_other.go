@@ -0,0 +1,11 @@
+//go:build !linux && !(darwin && cgo)
+
+package watch
+
+import "errors"
+
+const LiveBackend = ""
+
+func newWatcher(l *Live) (watcher, error) {
+	return nil, errors.New("live counting needs inotify on Linux or FSEvents on macOS, built with cgo")
+}
@@ -0,0 +1,150 @@
+// Package watch follows how fast watched trees change: files created,
+// deleted and modified, and bytes written, as rolling per-minute rates, so
+// a runaway log writer or sync loop stands out as soon as it starts.
+package watch
+
+import (
+	"path"
+	"sort"
+	"time"
+
+	"file-counter/pkg/index"
+)
+
+// TopDirs is how many of the directories written to most a Delta names.
+const TopDirs = 3
+
+// Delta is what changed in a tree during one interval. BytesWritten counts
+// the size of created files and the growth of modified ones; a file
+// rewritten at the same size counts as modified only.
+type Delta struct {
+	At           time.Time  `json:"at"`
+	Interval     float64    `json:"interval_seconds"`
+	Created      int64      `json:"created"`
+	Deleted      int64      `json:"deleted"`
+	Modified     int64      `json:"modified"`
+	BytesWritten int64      `json:"bytes_written"`
+	BytesDeleted int64      `json:"bytes_deleted"`
+	Top          []DirBytes `json:"top,omitempty"`
+}
+
+// DirBytes is the bytes written directly into one directory.
+type DirBytes struct {
+	Dir   string `json:"dir"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Diff compares two indexes of the same tree. Directories are not counted.
+func Diff(old, cur *index.Index) Delta {
+	d := Delta{At: cur.BuiltAt, Interval: cur.BuiltAt.Sub(old.BuiltAt).Seconds()}
+	written := map[string]int64{}
+	wrote := func(e *index.Entry, n int64) {
+		d.BytesWritten += n
+		if n > 0 {
+			written[path.Dir(e.Path)] += n
+		}
+	}
+
+	// Both entry lists are sorted by path.
+	a, b := old.Entries, cur.Entries
+	for len(a) > 0 || len(b) > 0 {
+		switch {
+		case len(b) == 0 || len(a) > 0 && a[0].Path < b[0].Path:
+			if !a[0].IsDir() {
+				d.Deleted++
+				d.BytesDeleted += a[0].Size
+			}
+			a = a[1:]
+		case len(a) == 0 || b[0].Path < a[0].Path:
+			if !b[0].IsDir() {
+				d.Created++
+				wrote(&b[0], b[0].Size)
+			}
+			b = b[1:]
+		default:
+			o, n := &a[0], &b[0]
+			if !n.IsDir() && (o.Size != n.Size || !o.ModTime.Equal(n.ModTime)) {
+				d.Modified++
+				wrote(n, max(0, n.Size-o.Size))
+			}
+			a, b = a[1:], b[1:]
+		}
+	}
+
+	for dir, n := range written {
+		d.Top = append(d.Top, DirBytes{Dir: path.Join(cur.Root, dir), Bytes: n})
+	}
+	sort.Slice(d.Top, func(i, j int) bool {
+		if d.Top[i].Bytes != d.Top[j].Bytes {
+			return d.Top[i].Bytes > d.Top[j].Bytes
+		}
+		return d.Top[i].Dir < d.Top[j].Dir
+	})
+	if len(d.Top) > TopDirs {
+		d.Top = d.Top[:TopDirs]
+	}
+	return d
+}
+
+// Rate is a per-minute rate of change.
+type Rate struct {
+	Created      float64 `json:"created"`
+	Deleted      float64 `json:"deleted"`
+	Modified     float64 `json:"modified"`
+	BytesWritten float64 `json:"bytes_written"`
+	BytesDeleted float64 `json:"bytes_deleted"`
+}
+
+// Rates keeps the deltas of the last Span to compute rolling rates from.
+type Rates struct {
+	Span   time.Duration
+	deltas []Delta
+}
+
+// NewRates keeps enough history for rates over windows up to span.
+func NewRates(span time.Duration) *Rates {
+	return &Rates{Span: span}
+}
+
+// Add records the delta of one interval.
+func (r *Rates) Add(d Delta) {
+	r.deltas = append(r.deltas, d)
+	cut := 0
+	for cut < len(r.deltas) && d.At.Sub(r.deltas[cut].At) > r.Span {
+		cut++
+	}
+	r.deltas = r.deltas[cut:]
+}
+
+// PerMinute averages the deltas that ended within window of the latest
+// one. Early on, before window has passed, it averages what there is.
+func (r *Rates) PerMinute(window time.Duration) Rate {
+	var rate Rate
+	if len(r.deltas) == 0 {
+		return rate
+	}
+	last := r.deltas[len(r.deltas)-1].At
+	var seconds float64
+	for i := len(r.deltas) - 1; i >= 0; i-- {
+		d := r.deltas[i]
+		if last.Sub(d.At) >= window {
+			break
+		}
+		seconds += d.Interval
+		rate.Created += float64(d.Created)
+		rate.Deleted += float64(d.Deleted)
+		rate.Modified += float64(d.Modified)
+		rate.BytesWritten += float64(d.BytesWritten)
+		rate.BytesDeleted += float64(d.BytesDeleted)
+	}
+	if seconds <= 0 {
+		return Rate{}
+	}
+	scale := 60 / seconds
+	rate.Created *= scale
+	rate.Deleted *= scale
+	rate.Modified *= scale
+	rate.BytesWritten *= scale
+	rate.BytesDeleted *= scale
+	return rate
+}
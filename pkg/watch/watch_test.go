@@ -0,0 +1,237 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"file-counter/pkg/index"
+)
+
+func entry(p string, size int64, mtime int) index.Entry {
+	return index.Entry{Path: p, Size: size, ModTime: time.Unix(int64(mtime), 0), Mode: 0o644}
+}
+
+func TestDiff(t *testing.T) {
+	start := time.Unix(1000, 0)
+	dir := index.Entry{Path: "logs", Mode: os.ModeDir | 0o755}
+	old := &index.Index{Root: "/srv", BuiltAt: start, Entries: []index.Entry{
+		{Path: ".", Mode: os.ModeDir | 0o755}, entry("a", 10, 1), entry("b", 20, 1), dir, entry("logs/app.log", 100, 1),
+	}}
+	cur := &index.Index{Root: "/srv", BuiltAt: start.Add(30 * time.Second), Entries: []index.Entry{
+		{Path: ".", Mode: os.ModeDir | 0o755}, entry("a", 5, 2), entry("c", 7, 2), dir, entry("logs/app.log", 1100, 2),
+	}}
+
+	d := Diff(old, cur)
+	if d.Created != 1 || d.Deleted != 1 || d.Modified != 2 || d.BytesWritten != 1007 || d.BytesDeleted != 20 || d.Interval != 30 {
+		t.Errorf("Got %+v", d)
+	}
+	if len(d.Top) != 2 || d.Top[0] != (DirBytes{"/srv/logs", 1000}) || d.Top[1] != (DirBytes{"/srv", 7}) {
+		t.Errorf("Got top directories %+v", d.Top)
+	}
+}
+
+func TestRates(t *testing.T) {
+	r := NewRates(5 * time.Minute)
+	start := time.Unix(0, 0)
+	for i := 1; i <= 40; i++ {
+		// 10 files every 10s for 5 minutes, then 100 files every 10s.
+		created := int64(10)
+		if i > 30 {
+			created = 100
+		}
+		r.Add(Delta{At: start.Add(time.Duration(i) * 10 * time.Second), Interval: 10, Created: created, BytesWritten: created * 1000})
+	}
+	if got := r.PerMinute(time.Minute); got.Created != 600 || got.BytesWritten != 600000 {
+		t.Errorf("Got a 1m rate of %+v", got)
+	}
+	// The last five minutes: 20 intervals of 10 files, 10 of 100.
+	if got := r.PerMinute(5 * time.Minute); got.Created != 240 {
+		t.Errorf("Got a 5m rate of %+v", got)
+	}
+	if len(r.deltas) > 31 {
+		t.Errorf("Expected old deltas to be dropped, kept %d", len(r.deltas))
+	}
+	if got := NewRates(time.Minute).PerMinute(time.Minute); got != (Rate{}) {
+		t.Errorf("Got %+v without deltas", got)
+	}
+}
+
+func TestTree(t *testing.T) {
+	tr := NewTree()
+	tr.Set("a", 10, false)
+	tr.Set("logs/2024/app.log", 100, false)
+	tr.Set("logs/2024/app.log", 150, false)
+	if got := tr.Counts(); got != (Counts{Files: 2, Dirs: 3, Bytes: 160}) {
+		t.Errorf("Got %+v", got)
+	}
+	// A file replaced by a directory, and the other way round.
+	tr.Set("a", 0, true)
+	tr.Set("logs/2024", 5, false)
+	if got := tr.Counts(); got != (Counts{Files: 1, Dirs: 3, Bytes: 5}) {
+		t.Errorf("Got %+v after replacing entries", got)
+	}
+	if dirs := tr.Remove("a"); len(dirs) != 1 || dirs[0] != "a" {
+		t.Errorf("Got removed directories %v", dirs)
+	}
+	tr.Remove("missing/file")
+	if got := tr.Counts(); got != (Counts{Files: 1, Dirs: 2, Bytes: 5}) {
+		t.Errorf("Got %+v after removing", got)
+	}
+}
+
+// limitWatcher has no watches to give, as if the limit were reached.
+type limitWatcher struct{}
+
+func (limitWatcher) watch(string) error { return errWatchLimit }
+func (limitWatcher) unwatch(string)     {}
+func (limitWatcher) watches() int       { return 0 }
+func (limitWatcher) run()               {}
+func (limitWatcher) close() error       { return nil }
+
+// dirWatcher watches nothing, like FSEvents, which watches the whole tree
+// and says which directories changed.
+type dirWatcher struct{}
+
+func (dirWatcher) watch(string) error { return nil }
+func (dirWatcher) unwatch(string)     {}
+func (dirWatcher) watches() int       { return 1 }
+func (dirWatcher) run()               {}
+func (dirWatcher) close() error       { return nil }
+
+func writeFile(t *testing.T, path string, size int) {
+	t.Helper()
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLivePollsUnwatched(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a"), 10)
+	writeFile(t, filepath.Join(root, "sub", "b"), 20)
+	l := &Live{Root: root, w: limitWatcher{}, tree: NewTree(), unwatched: map[string]bool{}}
+	if err := l.add(".", true); err != nil {
+		t.Fatal(err)
+	}
+	if got := l.Counts(); got != (Counts{Files: 2, Dirs: 2, Bytes: 30}) {
+		t.Errorf("Got %+v", got)
+	}
+	if st := l.Stats(); st.Unwatched != 1 || st.Watches != 0 {
+		t.Errorf("Got stats %+v", st)
+	}
+
+	writeFile(t, filepath.Join(root, "sub", "c"), 5)
+	os.Remove(filepath.Join(root, "a"))
+	l.Poll()
+	if got := l.Counts(); got != (Counts{Files: 2, Dirs: 2, Bytes: 25}) {
+		t.Errorf("Got %+v after polling", got)
+	}
+}
+
+func TestLive(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a"), 10)
+	writeFile(t, filepath.Join(root, "old", "b"), 20)
+	l, err := NewLive(root, index.Options{})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+	if got := l.Counts(); got != (Counts{Files: 2, Dirs: 2, Bytes: 30}) {
+		t.Fatalf("Got %+v", got)
+	}
+
+	writeFile(t, filepath.Join(root, "a"), 100)
+	writeFile(t, filepath.Join(root, "new", "deep", "c"), 7)
+	os.Rename(filepath.Join(root, "old"), filepath.Join(root, "new", "moved"))
+	writeFile(t, filepath.Join(root, "new", "moved", "d"), 3)
+	want := Counts{Files: 4, Dirs: 4, Bytes: 130}
+	deadline := time.Now().Add(5 * time.Second)
+	for l.Counts() != want && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := l.Counts(); got != want {
+		t.Errorf("Got %+v, want %+v", got, want)
+	}
+	if st := l.Stats(); st.Watches != 4 || st.Events == 0 {
+		t.Errorf("Got stats %+v", st)
+	}
+
+	os.RemoveAll(root)
+	deadline = time.Now().Add(5 * time.Second)
+	for l.Err() == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if l.Err() == nil {
+		t.Error("Expected an error once the root is removed")
+	}
+}
+
+func TestLiveRescan(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a"), 10)
+	writeFile(t, filepath.Join(root, "sub", "deep", "b"), 20)
+	l := &Live{Root: root, w: dirWatcher{}, tree: NewTree(), unwatched: map[string]bool{}}
+	if err := l.add(".", true); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, filepath.Join(root, "a"), 15)
+	writeFile(t, filepath.Join(root, "new", "c"), 1)
+	writeFile(t, filepath.Join(root, "sub", "deep", "d"), 2)
+	l.rescan(".", false)
+	if got := l.Counts(); got != (Counts{Files: 3, Dirs: 4, Bytes: 36}) {
+		t.Errorf("Got %+v after listing the root again", got)
+	}
+	l.rescan(".", true)
+	if got := l.Counts(); got != (Counts{Files: 4, Dirs: 4, Bytes: 38}) {
+		t.Errorf("Got %+v after listing everything again", got)
+	}
+	os.RemoveAll(filepath.Join(root, "sub"))
+	l.rescan(".", false)
+	if got := l.Counts(); got != (Counts{Files: 2, Dirs: 2, Bytes: 16}) {
+		t.Errorf("Got %+v after removing a directory", got)
+	}
+}
+
+func TestLiveChanges(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "f"), 1)
+	writeFile(t, filepath.Join(root, "b", "g"), 1)
+	l := &Live{Root: root, w: dirWatcher{}, tree: NewTree(), unwatched: map[string]bool{}}
+	if err := l.add(".", true); err != nil {
+		t.Fatal(err)
+	}
+	opts := index.Options{Changes: l}
+	ix, err := index.Build(root, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only a/ is reported, so the change in b/ goes unseen.
+	writeFile(t, filepath.Join(root, "a", "f"), 10)
+	writeFile(t, filepath.Join(root, "b", "g"), 10)
+	l.mu.Lock()
+	l.rescan("a", false)
+	l.mu.Unlock()
+	updated, changes, err := index.Update(ix, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Bytes != 11 || changes.Reread != 1 || changes.Source != l.Name() {
+		t.Errorf("Got %d bytes, changes %+v", updated.Bytes, *changes)
+	}
+
+	// An index built before the last update can't be brought up to date
+	// from events, so mtimes are compared.
+	updated, changes, err = index.Update(ix, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Bytes != 20 || changes.Source != "" {
+		t.Errorf("Got %d bytes, changes %+v from a stale index", updated.Bytes, *changes)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+
+	"file-counter/pkg/index"
+	"file-counter/pkg/output"
+	"file-counter/pkg/query"
+)
+
+// runQuery answers a SQL SELECT from a stored index or sqlite inventory.
+func runQuery(args []string) int {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	root := fs.String("root", ".", "query the stored index of this `path`")
+	indexPath := fs.String("index", "", "query this index `file` instead")
+	db := fs.String("db", "", "run the query with sqlite3 against a `database` written by -output sqlite")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: file-counter query [-root path | -index file | -db inventory.db] \"SELECT ...\"")
+		fmt.Fprintln(os.Stderr, "Tables: files("+strings.Join(query.FileColumns, ", ")+")")
+		fmt.Fprintln(os.Stderr, "        directories("+strings.Join(query.DirColumns, ", ")+")")
+		fmt.Fprintln(os.Stderr, "Size literals such as 100MB are accepted; mtime is in Unix seconds.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitError
+	}
+	sql := fs.Arg(0)
+
+	if *db != "" {
+		cmd := exec.Command(output.SQLiteCommand, "-readonly", "-header", "-column", *db, query.ExpandUnits(sql))
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	if *indexPath == "" {
+		name, err := index.DefaultPath(*root)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		if _, err := os.Stat(name); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s has no index; run 'file-counter index build %s' first\n", *root, *root)
+			return exitError
+		}
+		*indexPath = name
+	}
+	ix, err := index.Load(*indexPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	res, err := query.Run(sql, query.IndexTables(ix))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(res.Columns, "\t"))
+	cells := make([]string, len(res.Columns))
+	for _, row := range res.Rows {
+		for i, v := range row {
+			cells[i] = query.Format(v)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	tw.Flush()
+	return exitOK
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"file-counter/pkg/scanner"
+	"file-counter/pkg/snapshot"
+)
+
+// rescanShown caps how many of the paths still failing are listed.
+const rescanShown = 20
+
+// errorRecorder is a scanner.FileVisitor that keeps the path of every
+// entry the scan could not read, for -save-errors.
+type errorRecorder struct {
+	mu       sync.Mutex
+	failures []snapshot.Failure
+}
+
+func (r *errorRecorder) VisitFile(path string, info os.FileInfo) {}
+func (r *errorRecorder) VisitDir(path string, info os.FileInfo)  {}
+
+func (r *errorRecorder) HandleError(path string, err error) {
+	if abs, aerr := filepath.Abs(path); aerr == nil {
+		path = abs
+	}
+	r.mu.Lock()
+	r.failures = append(r.failures, snapshot.Failure{Path: path, Error: err.Error()})
+	r.mu.Unlock()
+}
+
+// save writes the paths to name for 'file-counter rescan-errors'. root is
+// the root scanned, if there was only one.
+func (r *errorRecorder) save(name, root string) {
+	list := &snapshot.Failures{Version: snapshot.Version, CreatedAt: time.Now().UTC(), Failures: r.failures}
+	if root != "" {
+		list.Root, _ = filepath.Abs(root)
+	}
+	if err := list.Save(name); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -save-errors: %v\n", err)
+		return
+	}
+	if len(r.failures) > 0 {
+		fmt.Printf("Error paths saved to %s; 'file-counter rescan-errors %s' scans them again\n", name, name)
+	}
+}
+
+// runRescanErrors scans the paths in an error list again, typically with
+// more privileges, merges what it can now read into the snapshot the list
+// was saved with, and keeps the paths that still fail in the list.
+func runRescanErrors(args []string) int {
+	fs := flag.NewFlagSet("rescan-errors", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: file-counter rescan-errors errors.json")
+		fmt.Fprintln(os.Stderr, "Scans the paths in a list saved by -save-errors or 'baseline -save-errors' again, e.g. under sudo.")
+		fmt.Fprintln(os.Stderr, "What can now be read is merged into the baseline the list was saved with; paths that still fail stay in the list.")
+		fmt.Fprintln(os.Stderr, "Exit status is 0 when every path could be read, 1 when some still fail, 2 on error.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitError
+	}
+	listPath := fs.Arg(0)
+	list, err := snapshot.LoadFailures(listPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading error list: %v\n", err)
+		return exitError
+	}
+	var snap *snapshot.Snapshot
+	if list.Snapshot != "" {
+		if snap, err = snapshot.Load(list.Snapshot); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading baseline: %v\n", err)
+			return exitError
+		}
+	}
+
+	opts := snapshot.Options{Hash: snap != nil, Skip: samePath(listPath)}
+	if snap != nil {
+		skipList, skipSnap := opts.Skip, samePath(list.Snapshot)
+		opts.Skip = func(path string) bool { return skipList(path) || skipSnap(path) }
+	}
+	var remaining []snapshot.Failure
+	var recovered snapshot.Snapshot
+	var gone int
+	var done []string
+	// The list is sorted, so a directory comes before the paths below it,
+	// which its rescan covers.
+	for _, f := range list.Failures {
+		covered := false
+		for _, dir := range done {
+			covered = covered || f.Path == dir || strings.HasPrefix(f.Path, dir+string(filepath.Separator))
+		}
+		if covered {
+			continue
+		}
+		done = append(done, f.Path)
+		if _, err := os.Lstat(f.Path); errors.Is(err, os.ErrNotExist) {
+			gone++
+			continue
+		}
+		opts.OnError = func(failure snapshot.Failure) { remaining = append(remaining, failure) }
+		sub, err := snapshot.Build(f.Path, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error scanning %s: %v\n", f.Path, err)
+			return exitError
+		}
+		recovered.TotalFiles += sub.TotalFiles
+		recovered.TotalDirs += sub.TotalDirs
+		recovered.TotalBytes += sub.TotalBytes
+		if snap != nil && sub.TotalFiles+sub.TotalDirs > 0 {
+			if err := snap.Merge(sub, f.Counted); err != nil {
+				fmt.Fprintf(os.Stderr, "Error merging %s: %v\n", f.Path, err)
+				return exitError
+			}
+		}
+	}
+
+	fmt.Printf("\n=== RESCAN RESULTS ===\n")
+	fmt.Printf("Paths rescanned: %d of %d\n", len(done)-gone, len(list.Failures))
+	if gone > 0 {
+		fmt.Printf("No longer exist: %d\n", gone)
+	}
+	fmt.Printf("Now readable: %d files, %d directories, %s\n", recovered.TotalFiles, recovered.TotalDirs, scanner.FormatBytes(recovered.TotalBytes))
+	fmt.Printf("Still failing: %d\n", len(remaining))
+	if snap != nil {
+		if err := saveKeepingOwner(list.Snapshot, snap.Save); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving baseline: %v\n", err)
+			return exitError
+		}
+		fmt.Printf("Merged into %s (%d files, %s)\n", list.Snapshot, snap.TotalFiles, scanner.FormatBytes(snap.TotalBytes))
+	}
+	list.Failures = remaining
+	if err := saveKeepingOwner(listPath, list.Save); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving error list: %v\n", err)
+		return exitError
+	}
+	if len(remaining) > 0 {
+		for i, f := range remaining {
+			if i == rescanShown {
+				fmt.Printf("  ... and %d more\n", len(remaining)-i)
+				break
+			}
+			fmt.Printf("  %s: %s\n", f.Path, f.Error)
+		}
+		fmt.Printf("The paths still failing are kept in %s\n", listPath)
+		return exitChanged
+	}
+	return exitOK
+}
+
+// saveKeepingOwner replaces the file name with save, keeping its owner.
+func saveKeepingOwner(name string, save func(string) error) error {
+	info, statErr := os.Stat(name)
+	if err := save(name); err != nil {
+		return err
+	}
+	if statErr == nil {
+		keepOwner(name, info)
+	}
+	return nil
+}
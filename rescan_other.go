@@ -0,0 +1,7 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+func keepOwner(name string, info os.FileInfo) {}
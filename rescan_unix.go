@@ -0,0 +1,19 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// keepOwner gives name back to the owner of the file it replaced, described
+// by info. Run under sudo, rescan-errors would otherwise leave the baseline
+// and error list to root, unreadable by whoever made them.
+func keepOwner(name string, info os.FileInfo) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || os.Geteuid() != 0 {
+		return
+	}
+	os.Chown(name, int(st.Uid), int(st.Gid))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+
+	"file-counter/pkg/content"
+	"file-counter/pkg/scanner"
+)
+
+// interpretersShown caps how many interpreters the report lists.
+const interpretersShown = 20
+
+// interpreterTally counts the scripts run by one interpreter, per way the
+// #! line names it.
+type interpreterTally struct {
+	files int64
+	paths map[string]int64
+}
+
+// scriptSink counts scripts by the interpreter their #! line names, as the
+// scanning workers read it. Scripts without execute permission can't be run
+// directly, so they are counted on their own.
+type scriptSink struct {
+	executable    map[string]*interpreterTally
+	scripts       int64
+	notExecutable map[string]int64
+}
+
+// newScriptSink hooks #! line detection into opts.
+func newScriptSink(opts *scanner.Options) *scriptSink {
+	s := &scriptSink{executable: map[string]*interpreterTally{}, notExecutable: map[string]int64{}}
+	addInspector(opts, func(ctx context.Context, path string, info os.FileInfo) (any, error) {
+		if info.Size() < 3 {
+			return nil, nil
+		}
+		head, err := content.ReadHead(path, content.ShebangSample)
+		if err != nil {
+			return nil, err
+		}
+		if interp := content.Shebang(head); interp != nil {
+			return interp, nil
+		}
+		return nil, nil
+	})
+	opts.Sinks = append(opts.Sinks, s)
+	return s
+}
+
+func (s *scriptSink) Write(rec *scanner.FileRecord) error {
+	interp, ok := inspection[*content.Interpreter](rec)
+	if !ok {
+		return nil
+	}
+	// Windows has no execute bits; scripts there run by association.
+	if rec.Mode&0o111 == 0 && runtime.GOOS != "windows" {
+		s.notExecutable[interp.Name]++
+		return nil
+	}
+	s.scripts++
+	t := s.executable[interp.Name]
+	if t == nil {
+		t = &interpreterTally{paths: map[string]int64{}}
+		s.executable[interp.Name] = t
+	}
+	t.files++
+	t.paths[interp.Path]++
+	return nil
+}
+
+func (s *scriptSink) report() {
+	fmt.Printf("\n=== SCRIPT INTERPRETERS ===\n")
+	fmt.Printf("Executable scripts: %d\n", s.scripts)
+	names := make([]string, 0, len(s.executable))
+	for name := range s.executable {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := s.executable[names[i]], s.executable[names[j]]
+		if a.files != b.files {
+			return a.files > b.files
+		}
+		return names[i] < names[j]
+	})
+	for i, name := range names {
+		if i == interpretersShown {
+			fmt.Printf("  ... and %d more interpreters\n", len(names)-i)
+			break
+		}
+		t := s.executable[name]
+		fmt.Printf("  %s: %d (%s)\n", name, t.files, countList(t.paths))
+	}
+	if len(s.notExecutable) > 0 {
+		var n int64
+		for _, c := range s.notExecutable {
+			n += c
+		}
+		fmt.Printf("Scripts without execute permission: %d (%s)\n", n, countList(s.notExecutable))
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"file-counter/pkg/index"
+	"file-counter/pkg/scanner"
+)
+
+// runSearch finds paths in the stored indexes, like locate.
+func runSearch(args []string) int {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	glob := fs.Bool("glob", false, "match a shell glob against the file name (or the whole path if it contains /)")
+	regex := fs.Bool("regex", false, "match a regular expression against the path")
+	fold := fs.Bool("i", false, "ignore case")
+	root := fs.String("root", "", "only search the index of this `path` (default: every indexed root)")
+	indexPath := fs.String("index", "", "search this index `file`")
+	kind := fs.String("type", "", "only list files (f) or directories (d)")
+	limit := fs.Int("limit", 0, "stop after this many results (0 for no limit)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: file-counter search [-glob | -regex] [-i] [-root path] [-type f|d] [-limit N] <pattern>")
+		fmt.Fprintln(os.Stderr, "Lists indexed paths matching pattern (a substring by default) with their size and mtime.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *glob && *regex || *kind != "" && *kind != "f" && *kind != "d" {
+		fs.Usage()
+		return exitError
+	}
+
+	mode := index.MatchSubstring
+	if *glob {
+		mode = index.MatchGlob
+	} else if *regex {
+		mode = index.MatchRegexp
+	}
+	match, err := index.Matcher(fs.Arg(0), mode, *fold)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	var names []string
+	switch {
+	case *indexPath != "":
+		names = []string{*indexPath}
+	case *root != "":
+		name, err := index.DefaultPath(*root)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		names = []string{name}
+	default:
+		if names, err = index.All(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		if len(names) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: nothing is indexed yet; run 'file-counter index build <path>' first")
+			return exitError
+		}
+	}
+
+	found := 0
+	for _, name := range names {
+		ix, err := index.Load(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		ix.Search(match, func(p string, e *index.Entry) bool {
+			if *kind == "f" && e.IsDir() || *kind == "d" && !e.IsDir() {
+				return true
+			}
+			size := scanner.FormatBytes(e.Size)
+			if e.IsDir() {
+				size, p = "-", p+"/"
+			}
+			fmt.Printf("%10s  %s  %s\n", size, e.ModTime.Local().Format("2006-01-02 15:04"), p)
+			found++
+			return *limit <= 0 || found < *limit
+		})
+		if *limit > 0 && found >= *limit {
+			break
+		}
+	}
+	if found == 0 {
+		// Like locate, report no matches with status 1.
+		return exitChanged
+	}
+	return exitOK
+}
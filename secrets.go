@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"file-counter/pkg/scanner"
+	"file-counter/pkg/sensitive"
+)
+
+// secretsShown caps how many matches are printed when there is no
+// -secrets-report file.
+const secretsShown = 50
+
+// secretsSink collects the secrets found by content scanning, which runs
+// in the scanning workers through scanner.Options.Inspect.
+type secretsSink struct {
+	patterns []sensitive.Pattern
+	report   string
+	files    int
+	matches  []sensitive.Match
+}
+
+// newSecretsSink sets up content scanning with the patterns in the named
+// file, or the defaults, and hooks it into opts.
+func newSecretsSink(patternFile, report string, opts *scanner.Options) (*secretsSink, error) {
+	s := &secretsSink{patterns: sensitive.DefaultPatterns, report: report}
+	if patternFile != "" {
+		pats, err := sensitive.LoadPatterns(patternFile)
+		if err != nil {
+			return nil, err
+		}
+		s.patterns = pats
+	}
+	addInspector(opts, func(ctx context.Context, path string, info os.FileInfo) (any, error) {
+		m, err := sensitive.ScanContent(ctx, path, info.Size(), s.patterns)
+		if len(m) == 0 {
+			return nil, err
+		}
+		return m, err
+	})
+	opts.Sinks = append(opts.Sinks, s)
+	return s, nil
+}
+
+func (s *secretsSink) Write(rec *scanner.FileRecord) error {
+	if m, ok := inspection[[]sensitive.Match](rec); ok {
+		s.files++
+		s.matches = append(s.matches, m...)
+	}
+	return nil
+}
+
+// finish prints a summary and writes the redacted matches to the report
+// file, or prints them when there is none.
+func (s *secretsSink) finish() {
+	fmt.Printf("\n=== SECRETS IN FILE CONTENTS (REDACTED) ===\n")
+	fmt.Printf("%d matches in %d files\n", len(s.matches), s.files)
+	if s.report != "" {
+		if err := s.writeReport(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -secrets-report: %v\n", err)
+			return
+		}
+		fmt.Printf("Report written to %s\n", s.report)
+		return
+	}
+	for i, m := range s.matches {
+		if i == secretsShown {
+			fmt.Printf("... and %d more; use -secrets-report to list them all\n", len(s.matches)-i)
+			break
+		}
+		fmt.Printf("%s:%d: %s %s\n", m.Path, m.Line, m.Pattern, m.Text)
+	}
+}
+
+func (s *secretsSink) writeReport() error {
+	f, err := os.OpenFile(s.report, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	matches := s.matches
+	if matches == nil {
+		matches = []sensitive.Match{}
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(matches); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
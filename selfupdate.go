@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"file-counter/pkg/selfupdate"
+)
+
+// releaseKey is the base64 ed25519 public key release checksums are signed
+// with, set at build time with -ldflags "-X main.releaseKey=...".
+var releaseKey string
+
+// runSelfUpdate replaces the running binary with the latest release.
+func runSelfUpdate(args []string) int {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	check := fs.Bool("check", false, "only report whether a newer release is available")
+	force := fs.Bool("force", false, "install the latest release even if it is the running version")
+	url := fs.String("url", selfupdate.DefaultURL, "look up the latest release at this `URL`")
+	keyFlag := fs.String("key", "", "verify the release checksums with this base64 ed25519 public `key` instead of the built-in one")
+	insecure := fs.Bool("insecure", false, "without a release key, install a release checked only against its unsigned SHA256SUMS")
+	timeout := fs.Duration("timeout", 5*time.Minute, "give up after this `duration`")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: file-counter self-update [-check] [-force] [-url URL] [-key key | -insecure]")
+		fmt.Fprintln(os.Stderr, "Downloads the latest release for this platform, verifies it against the signed SHA256SUMS and replaces this binary.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return exitError
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	client := &http.Client{}
+	current := collectBuildInfo().Version
+
+	rel, err := selfupdate.Latest(ctx, client, *url)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	upToDate := strings.TrimPrefix(rel.Tag, "v") == strings.TrimPrefix(current, "v")
+	if *check {
+		if upToDate {
+			fmt.Printf("file-counter %s is the latest release\n", current)
+		} else {
+			fmt.Printf("file-counter %s is available (running %s)\n", rel.Tag, current)
+		}
+		return exitOK
+	}
+	if upToDate && !*force {
+		fmt.Printf("file-counter %s is already the latest release\n", current)
+		return exitOK
+	}
+
+	data, err := fetchRelease(ctx, client, rel, *keyFlag, *insecure)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err == nil {
+		err = selfupdate.Replace(exe, data)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: replacing the binary: %v\n", err)
+		if errors.Is(err, os.ErrPermission) {
+			fmt.Fprintln(os.Stderr, "Run self-update as a user who can write to", filepath.Dir(exe))
+		}
+		return exitError
+	}
+	fmt.Printf("Updated %s from %s to %s\n", exe, current, rel.Tag)
+	return exitOK
+}
+
+// fetchRelease downloads this platform's binary from rel and verifies it
+// against SHA256SUMS, whose signature is checked first. Without a release
+// key it refuses unless insecure is set: checksums from the server that
+// serves the binary prove nothing about who built it.
+func fetchRelease(ctx context.Context, client *http.Client, rel *selfupdate.Release, keyFlag string, insecure bool) ([]byte, error) {
+	k := keyFlag
+	if k == "" {
+		k = releaseKey
+	}
+	if k == "" && !insecure {
+		return nil, errors.New("this build has no release key to verify the release with; give one with -key, or use -insecure to trust SHA256SUMS alone")
+	}
+	name := selfupdate.BinaryName()
+	asset, ok := rel.Asset(name)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no %s", rel.Tag, name)
+	}
+	sumsAsset, ok := rel.Asset(selfupdate.SumsAsset)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no %s to verify the download with", rel.Tag, selfupdate.SumsAsset)
+	}
+	sums, err := selfupdate.Download(ctx, client, sumsAsset)
+	if err != nil {
+		return nil, err
+	}
+
+	if k != "" {
+		key, err := selfupdate.ParseKey(k)
+		if err != nil {
+			return nil, err
+		}
+		sigAsset, ok := rel.Asset(selfupdate.SigAsset)
+		if !ok {
+			return nil, fmt.Errorf("release %s is not signed (no %s)", rel.Tag, selfupdate.SigAsset)
+		}
+		sig, err := selfupdate.Download(ctx, client, sigAsset)
+		if err != nil {
+			return nil, err
+		}
+		if err := selfupdate.VerifySignature(key, sums, sig); err != nil {
+			return nil, err
+		}
+	} else {
+		fmt.Fprintln(os.Stderr, "Warning: -insecure: the download is checked against the unsigned SHA256SUMS only")
+	}
+
+	fmt.Printf("Downloading %s %s...\n", name, rel.Tag)
+	data, err := selfupdate.Download(ctx, client, asset)
+	if err != nil {
+		return nil, err
+	}
+	if err := selfupdate.VerifyChecksum(sums, name, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
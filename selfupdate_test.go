@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"file-counter/pkg/selfupdate"
+)
+
+func TestFetchReleaseWithoutKey(t *testing.T) {
+	binary := []byte("new binary")
+	name := selfupdate.BinaryName()
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/bin":
+			w.Write(binary)
+		case "/sums":
+			fmt.Fprintf(w, "%x  %s\n", sha256.Sum256(binary), name)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	rel := &selfupdate.Release{Tag: "v9.9.9", Assets: []selfupdate.Asset{
+		{Name: name, URL: srv.URL + "/bin"},
+		{Name: selfupdate.SumsAsset, URL: srv.URL + "/sums"},
+	}}
+
+	// Without a key the checksums vouch for nothing, so nothing is fetched.
+	if _, err := fetchRelease(context.Background(), srv.Client(), rel, "", false); err == nil {
+		t.Error("Fetched a release without a key, expected an error")
+	}
+	if requests != 0 {
+		t.Errorf("Made %d requests without a key, expected none", requests)
+	}
+
+	data, err := fetchRelease(context.Background(), srv.Client(), rel, "", true)
+	if err != nil {
+		t.Fatalf("-insecure: %v", err)
+	}
+	if string(data) != string(binary) {
+		t.Errorf("-insecure fetched %q, expected %q", data, binary)
+	}
+}
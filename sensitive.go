@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"file-counter/pkg/scanner"
+	"file-counter/pkg/sensitive"
+)
+
+// sensitiveDirs caps how many directories the report lists.
+const sensitiveDirs = 20
+
+// sensitiveSink collects the files whose names suggest credentials.
+type sensitiveSink struct {
+	tally sensitive.Tally
+	files int
+}
+
+func (s *sensitiveSink) Write(rec *scanner.FileRecord) error {
+	if rec.IsDir || !rec.Mode.IsRegular() {
+		return nil
+	}
+	if kind := sensitive.Kind(rec.Path); kind != "" {
+		s.tally.Add(sensitive.Finding{Path: rec.Path, Kind: kind, Exposure: sensitive.Exposure(rec.Mode)})
+		s.files++
+	}
+	return nil
+}
+
+// report lists the directories holding likely credentials, most exposed
+// first, naming each file other users can read.
+func (s *sensitiveSink) report() {
+	fmt.Printf("\n=== LIKELY CREDENTIAL FILES ===\n")
+	if s.files == 0 {
+		fmt.Println("None found.")
+		return
+	}
+	dirs := s.tally.Dirs()
+	fmt.Printf("%d files in %d directories\n", s.files, len(dirs))
+	for i, d := range dirs {
+		if i == sensitiveDirs {
+			fmt.Printf("... and %d more directories\n", len(dirs)-i)
+			break
+		}
+		fmt.Printf("%s: %d (%s)", d.Path, d.Files, strings.Join(d.Kinds, ", "))
+		if d.WorldReadable > 0 || d.GroupReadable > 0 {
+			fmt.Printf(", %d world-readable, %d group-readable", d.WorldReadable, d.GroupReadable)
+		}
+		fmt.Println()
+		for _, f := range d.Findings {
+			if f.Exposure != "" {
+				fmt.Printf("  %s: %s, %s\n", f.Path, f.Kind, f.Exposure)
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+
+	"file-counter/pkg/api"
+)
+
+// runServe serves the stored indexes and snapshots over a JSON HTTP API.
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", "localhost:8080", "listen on this `address` (e.g. :8080 for every interface)")
+	var snapshots stringList
+	fs.Var(&snapshots, "snapshot", "also serve this baseline snapshot `file`; repeatable")
+	certFile := fs.String("tls-cert", "", "serve HTTPS with this PEM certificate `file`")
+	keyFile := fs.String("tls-key", "", "PEM private key `file` for -tls-cert")
+	clientCA := fs.String("tls-client-ca", "", "require client certificates signed by a CA in this PEM `file` (mutual TLS)")
+	tokenFile := fs.String("token-file", "", "require a bearer token listed in this `file`, one per line")
+	usersFile := fs.String("users-file", "", "accept basic auth for the user:password (or user:sha256:hex) lines in this `file`")
+	insecure := fs.Bool("insecure", false, "allow serving without TLS or credentials on a non-loopback address")
+	logs := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: file-counter serve [-listen addr] [-tls-cert file -tls-key file] [-token-file file] [-snapshot file]...")
+		fmt.Fprintln(os.Stderr, "Serves the stored indexes (see 'index') and the given snapshots as JSON:")
+		fmt.Fprintln(os.Stderr, "  GET /api/scans                     list scans")
+		fmt.Fprintln(os.Stderr, "  GET /api/scans/{id}                totals of one scan")
+		fmt.Fprintln(os.Stderr, "  GET /api/scans/{id}/rollup?path=   per-directory totals")
+		fmt.Fprintln(os.Stderr, "  GET /api/diff?from={id}&to={id}    changes between two scans (&limit=N)")
+		fmt.Fprintln(os.Stderr, "  GET /api/progress                  running and recently finished scans")
+		fmt.Fprintln(os.Stderr, "  GET /api/progress/{id}[/events]    counters and rate history, or a live event stream")
+		fmt.Fprintln(os.Stderr, "  GET /metrics                       Prometheus gauges, with the time of the last successful scan")
+		fmt.Fprintln(os.Stderr, "  GET /healthz, /readyz              liveness and readiness probes, without credentials")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || (*certFile == "") != (*keyFile == "") || *clientCA != "" && *certFile == "" {
+		fs.Usage()
+		return exitError
+	}
+	for _, name := range snapshots {
+		if _, err := os.Stat(name); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+
+	auth, err := api.LoadAuth(*tokenFile, *usersFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if token := os.Getenv(apiTokenEnv); token != "" {
+		auth.Tokens = append(auth.Tokens, token)
+	}
+	// Inventories reveal what is stored where, so don't publish them to
+	// the network unprotected by accident.
+	if !auth.Enabled() && *clientCA == "" && !*insecure && !isLoopback(*listen) {
+		fmt.Fprintln(os.Stderr, "Error: refusing to serve scan data on a network address without credentials or client certificates; use -token-file, -users-file or -tls-client-ca, or -insecure")
+		return exitError
+	}
+	tlsConfig, err := api.TLSConfig(*clientCA)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	_, errs, closeLog, err := logs.open()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	defer closeLog()
+	handler := api.New(snapshots)
+	srv := &http.Server{Addr: *listen, Handler: handler.Probes(auth.Wrap(handler)), TLSConfig: tlsConfig}
+	if *logs.file != "" {
+		// Failed handshakes and the like, otherwise logged to stderr.
+		srv.ErrorLog = log.New(errs, "", log.LstdFlags)
+	}
+
+	if *certFile != "" {
+		fmt.Fprintf(errs, "Serving scan data on https://%s\n", *listen)
+		err = srv.ListenAndServeTLS(*certFile, *keyFile)
+	} else {
+		fmt.Fprintf(errs, "Serving scan data on http://%s\n", *listen)
+		err = srv.ListenAndServe()
+	}
+	if err != nil {
+		fmt.Fprintf(errs, "Error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// apiTokenEnv names a variable holding one more accepted bearer token, for
+// deployments that pass secrets through the environment.
+const apiTokenEnv = "FILE_COUNTER_API_TOKEN"
+
+// isLoopback reports whether addr only listens on the loopback interface.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
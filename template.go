@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"file-counter/pkg/output"
+	"file-counter/pkg/scanner"
+)
+
+// templateFuncs can be called from -format and -summary-format templates.
+var templateFuncs = template.FuncMap{
+	"human": scanner.FormatBytes,
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// templateEscapes expands the escapes that single-quoted shell arguments
+// leave alone, so that '{{.Path}}\t{{.Size}}' separates with a tab.
+var templateEscapes = strings.NewReplacer(`\\`, `\`, `\t`, "\t", `\n`, "\n", `\0`, "\x00")
+
+// parseTemplate parses the text of a -format or -summary-format flag.
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Parse(templateEscapes.Replace(text))
+}
+
+// fileData is what a -format template is executed with: the scanner's
+// record, plus the derived fields of the ndjson and csv outputs.
+type fileData struct {
+	*scanner.FileRecord
+}
+
+func (f fileData) Name() string  { return filepath.Base(f.Path) }
+func (f fileData) Ext() string   { return filepath.Ext(f.Path) }
+func (f fileData) Type() string  { return output.FileType(f.FileRecord) }
+func (f fileData) Owner() string { return output.OwnerName(f.FileRecord) }
+
+// templateSink writes every entry through a -format template, each followed
+// by a newline. Entries the template prints nothing for are left out, so a
+// template can filter with {{if}}.
+type templateSink struct {
+	t   *template.Template
+	w   *bufio.Writer
+	buf bytes.Buffer
+}
+
+func newTemplateSink(t *template.Template, f *os.File) *templateSink {
+	return &templateSink{t: t, w: bufio.NewWriterSize(f, 64*1024)}
+}
+
+func (s *templateSink) Write(rec *scanner.FileRecord) error {
+	s.buf.Reset()
+	if err := s.t.Execute(&s.buf, fileData{rec}); err != nil {
+		return err
+	}
+	if s.buf.Len() == 0 {
+		return nil
+	}
+	s.buf.WriteByte('\n')
+	_, err := s.w.Write(s.buf.Bytes())
+	return err
+}
+
+func (s *templateSink) Close() error {
+	return s.w.Flush()
+}
+
+// summaryData is what a -summary-format template is executed with.
+type summaryData struct {
+	*scanner.ScanResult
+	Root string
+}
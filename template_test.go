@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"file-counter/pkg/scanner"
+)
+
+// runTemplate writes recs through a -format template and returns what the
+// sink printed, or the first error.
+func runTemplate(t *testing.T, format string, recs ...*scanner.FileRecord) (string, error) {
+	t.Helper()
+	tmpl, err := parseTemplate("format", format)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sink := newTemplateSink(tmpl, f)
+	for _, rec := range recs {
+		if err := sink.Write(rec); err != nil {
+			return "", err
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), nil
+}
+
+func TestFormatTemplate(t *testing.T) {
+	file := &scanner.FileRecord{
+		Path:    filepath.Join("docs", "report.tar.gz"),
+		Size:    1536,
+		Mode:    0640,
+		ModTime: time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC),
+		Hash:    "abc123",
+		UID:     1000,
+		GID:     100,
+	}
+	dir := &scanner.FileRecord{Path: "docs", IsDir: true, Mode: os.ModeDir | 0755}
+	link := &scanner.FileRecord{Path: "latest", Mode: os.ModeSymlink | 0777}
+
+	tests := []struct {
+		format string
+		rec    *scanner.FileRecord
+		want   string
+	}{
+		{"{{.Path}}", file, file.Path},
+		{"{{.Size}}", file, "1536"},
+		{"{{human .Size}}", file, "1.5 KB"},
+		{"{{.Mode}}", file, "-rw-r-----"},
+		{`{{.ModTime.Format "2006-01-02T15:04:05"}}`, file, "2024-05-06T07:08:09"},
+		{"{{.IsDir}}", file, "false"},
+		{"{{.IsDir}}", dir, "true"},
+		{"{{.Hash}}", file, "abc123"},
+		{"{{.UID}}:{{.GID}}", file, "1000:100"},
+		{"{{.Name}}", file, "report.tar.gz"},
+		{"{{.Ext}}", file, ".gz"},
+		{"{{.Type}}", file, "file"},
+		{"{{.Type}}", dir, "dir"},
+		{"{{.Type}}", link, "symlink"},
+		// Without ownership information there is no name to look up.
+		{"[{{.Owner}}]", file, "[]"},
+		{"{{json .Path}}", &scanner.FileRecord{Path: `say "hi"`}, `"say \"hi\""`},
+	}
+	for _, test := range tests {
+		out, err := runTemplate(t, test.format, test.rec)
+		if err != nil {
+			t.Errorf("%s: %v", test.format, err)
+			continue
+		}
+		if out != test.want+"\n" {
+			t.Errorf("%s printed %q, expected %q", test.format, out, test.want+"\n")
+		}
+	}
+}
+
+func TestFormatTemplateEscapes(t *testing.T) {
+	rec := &scanner.FileRecord{Path: "a <b> & 'c'", Size: 3}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{`{{.Path}}\t{{.Size}}`, "a <b> & 'c'\t3"},
+		{`{{.Path}}\n--`, "a <b> & 'c'\n--"},
+		{`{{.Path}}\0`, "a <b> & 'c'\x00"},
+		// An escaped backslash stays a backslash, even before a t.
+		{`\\t{{.Size}}`, `\t3`},
+		// Paths are printed as they are, not HTML-escaped.
+		{`{{.Path}}`, "a <b> & 'c'"},
+	}
+	for _, test := range tests {
+		out, err := runTemplate(t, test.format, rec)
+		if err != nil {
+			t.Errorf("%s: %v", test.format, err)
+			continue
+		}
+		if out != test.want+"\n" {
+			t.Errorf("%s printed %q, expected %q", test.format, out, test.want+"\n")
+		}
+	}
+}
+
+func TestFormatTemplateFilters(t *testing.T) {
+	out, err := runTemplate(t, "{{if not .IsDir}}{{.Path}}{{end}}",
+		&scanner.FileRecord{Path: "dir", IsDir: true},
+		&scanner.FileRecord{Path: "file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "file\n" {
+		t.Errorf("Printed %q, expected only the file", out)
+	}
+}
+
+func TestFormatTemplateErrors(t *testing.T) {
+	rec := &scanner.FileRecord{Path: "file"}
+	tests := []string{
+		"{{.Path",
+		"{{.Nonsense}}",
+		"{{nonsense .Path}}",
+		"{{.Path.Size}}",
+	}
+	for _, format := range tests {
+		if out, err := runTemplate(t, format, rec); err == nil {
+			t.Errorf("%s printed %q, expected an error", format, out)
+		}
+	}
+}
+
+func TestSummaryTemplate(t *testing.T) {
+	data := summaryData{&scanner.ScanResult{TotalFiles: 12, TotalDirs: 3, TotalBytes: 2048, TotalErrors: 1}, "/srv"}
+	tests := []struct {
+		format string
+		want   string
+		err    bool
+	}{
+		{`{{.Root}}\t{{.TotalFiles}}\t{{.TotalDirs}}\t{{.TotalErrors}}`, "/srv\t12\t3\t1", false},
+		{"{{human .TotalBytes}}", "2.0 KB", false},
+		{"{{.TotalSize}}", "", true},
+	}
+	for _, test := range tests {
+		tmpl, err := parseTemplate("summary-format", test.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out strings.Builder
+		err = tmpl.Execute(&out, data)
+		if (err != nil) != test.err {
+			t.Errorf("%s: error = %v", test.format, err)
+			continue
+		}
+		if !test.err && out.String() != test.want {
+			t.Errorf("%s printed %q, expected %q", test.format, out.String(), test.want)
+		}
+	}
+}
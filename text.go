@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"file-counter/pkg/content"
+	"file-counter/pkg/scanner"
+)
+
+// binaryContent is the inspection result of -text: whether a file is
+// binary rather than text.
+type binaryContent bool
+
+// textSink counts text and binary files, as the scanning workers told them
+// apart by sampling their start.
+type textSink struct {
+	text, binary sizeTally
+}
+
+// newTextSink hooks text and binary classification into opts.
+func newTextSink(opts *scanner.Options) *textSink {
+	s := &textSink{}
+	addInspector(opts, func(ctx context.Context, path string, info os.FileInfo) (any, error) {
+		if info.Size() == 0 {
+			return nil, nil
+		}
+		sample, err := content.ReadHead(path, content.TextSample)
+		if err != nil {
+			return nil, err
+		}
+		return binaryContent(content.IsBinary(sample)), nil
+	})
+	opts.Sinks = append(opts.Sinks, s)
+	return s
+}
+
+func (s *textSink) Write(rec *scanner.FileRecord) error {
+	binary, ok := inspection[binaryContent](rec)
+	switch {
+	case !ok:
+	case bool(binary):
+		s.binary.add(rec.Size)
+	default:
+		s.text.add(rec.Size)
+	}
+	return nil
+}
+
+func (s *textSink) report() {
+	fmt.Printf("\n=== TEXT AND BINARY FILES ===\n")
+	fmt.Printf("Text: %d files, %s\n", s.text.files, scanner.FormatBytes(s.text.bytes))
+	fmt.Printf("Binary: %d files, %s\n", s.binary.files, scanner.FormatBytes(s.binary.bytes))
+}
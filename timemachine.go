@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"file-counter/pkg/scanner"
+)
+
+// backupTally counts the files and bytes attributed to one side of the
+// backup split.
+type backupTally struct {
+	files int64
+	bytes int64
+}
+
+// backupSink splits the scanned files into those Time Machine backs up and
+// those it excludes, keyed by the source of each exclusion.
+type backupSink struct {
+	cwd        string
+	exclusions map[string]string // path -> source
+	included   backupTally
+	excluded   map[string]*backupTally
+}
+
+func newBackupSink(exclusions map[string]string) *backupSink {
+	cwd, _ := os.Getwd()
+	return &backupSink{cwd: cwd, exclusions: exclusions, excluded: make(map[string]*backupTally)}
+}
+
+func (b *backupSink) Write(rec *scanner.FileRecord) error {
+	if rec.IsDir {
+		return nil
+	}
+	path := rec.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(b.cwd, path)
+	}
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if source, ok := b.exclusions[dir]; ok {
+			t := b.excluded[source]
+			if t == nil {
+				t = &backupTally{}
+				b.excluded[source] = t
+			}
+			t.files++
+			t.bytes += rec.Size
+			return nil
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+	b.included.files++
+	b.included.bytes += rec.Size
+	return nil
+}
+
+// report prints the split after the scan summary.
+func (b *backupSink) report() {
+	var total backupTally
+	sources := make([]string, 0, len(b.excluded))
+	for source, t := range b.excluded {
+		sources = append(sources, source)
+		total.files += t.files
+		total.bytes += t.bytes
+	}
+	sort.Strings(sources)
+	fmt.Printf("Time Machine Included: %d files, %s\n", b.included.files, scanner.FormatBytes(b.included.bytes))
+	fmt.Printf("Time Machine Excluded: %d files, %s\n", total.files, scanner.FormatBytes(total.bytes))
+	for _, source := range sources {
+		t := b.excluded[source]
+		fmt.Printf("  %s: %d files, %s\n", source, t.files, scanner.FormatBytes(t.bytes))
+	}
+}
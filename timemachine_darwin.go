@@ -0,0 +1,75 @@
+//go:build darwin
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const haveTimeMachine = true
+
+const (
+	timeMachinePrefs = "/Library/Preferences/com.apple.TimeMachine.plist"
+	stdExclusions    = "/System/Library/CoreServices/backupd.bundle/Contents/Resources/StdExclusions.plist"
+)
+
+// loadBackupExclusions collects what Time Machine leaves out under root:
+// items carrying the sticky com_apple_backup_excludeItem attribute (found
+// through Spotlight, so only on indexed volumes), the paths excluded in
+// Time Machine settings, and the system's standard exclusions. Sources
+// that can't be read, such as the settings without Full Disk Access, are
+// skipped.
+func loadBackupExclusions(root string) (map[string]string, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	exclusions := make(map[string]string)
+	for _, p := range plistPaths(stdExclusions, "PathsExcluded") {
+		exclusions[p] = "system exclusions"
+	}
+	for _, p := range plistPaths(stdExclusions, "ContentsExcluded") {
+		exclusions[p] = "system exclusions"
+	}
+	if homes, err := filepath.Glob("/Users/*"); err == nil {
+		for _, rel := range plistPaths(stdExclusions, "UserPathsExcluded") {
+			for _, home := range homes {
+				exclusions[filepath.Join(home, rel)] = "system exclusions"
+			}
+		}
+	}
+	for _, p := range plistPaths(timeMachinePrefs, "SkipPaths") {
+		if rest, ok := strings.CutPrefix(p, "~/"); ok {
+			home, _ := os.UserHomeDir()
+			p = filepath.Join(home, rest)
+		}
+		exclusions[filepath.Clean(p)] = "Time Machine settings"
+	}
+
+	out, err := exec.Command("mdfind", "-onlyin", abs, "com_apple_backup_excludeItem = 'com.apple.backupd'").Output()
+	if err != nil {
+		return exclusions, err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if line != "" {
+			exclusions[line] = "excluded by attribute"
+		}
+	}
+	return exclusions, nil
+}
+
+// plistPaths returns the array of strings stored under key in a property
+// list, or nil if it can't be read.
+func plistPaths(plist, key string) []string {
+	out, err := exec.Command("plutil", "-extract", key, "json", "-o", "-", plist).Output()
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	json.Unmarshal(out, &paths)
+	return paths
+}
@@ -0,0 +1,11 @@
+//go:build !darwin
+
+package main
+
+import "errors"
+
+const haveTimeMachine = false
+
+func loadBackupExclusions(root string) (map[string]string, error) {
+	return nil, errors.New("-backup-exclusions needs macOS Time Machine")
+}
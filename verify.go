@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"file-counter/pkg/manifest"
+)
+
+// Exit codes shared by the integrity subcommands.
+const (
+	exitOK      = 0
+	exitChanged = 1
+	exitError   = 2
+)
+
+// runManifest writes a sha256sum-compatible manifest of every regular file under a root.
+func runManifest(args []string) int {
+	fs := flag.NewFlagSet("manifest", flag.ExitOnError)
+	output := fs.String("o", "", "write the manifest to this file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: file-counter manifest [-o manifest.txt] <path>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitError
+	}
+	root := fs.Arg(0)
+
+	out := os.Stdout
+	var skip func(string) bool
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating manifest: %v\n", err)
+			return exitError
+		}
+		defer f.Close()
+		out = f
+		skip = samePath(*output)
+	}
+
+	entries, err := manifest.Build(root, skip)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error building manifest: %v\n", err)
+		return exitError
+	}
+	if err := manifest.Write(out, entries); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing manifest: %v\n", err)
+		return exitError
+	}
+
+	unreadable := 0
+	for _, e := range entries {
+		if e.Err != "" {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %s\n", e.Path, e.Err)
+			unreadable++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Wrote manifest with %d files\n", len(entries)-unreadable)
+	if unreadable > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d entries could not be read and are not in the manifest\n", unreadable)
+	}
+	return exitOK
+}
+
+// runVerify re-scans the manifest root and reports missing, added and modified files.
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	root := fs.String("root", ".", "directory the manifest paths are relative to")
+	quiet := fs.Bool("q", false, "only print the summary counts")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: file-counter verify [-root dir] [-q] manifest.txt")
+		fmt.Fprintln(os.Stderr, "Exit status is 0 when the tree matches, 1 when it differs, 2 on error.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitError
+	}
+	manifestPath := fs.Arg(0)
+
+	f, err := os.Open(manifestPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening manifest: %v\n", err)
+		return exitError
+	}
+	entries, err := manifest.Read(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading manifest %s: %v\n", manifestPath, err)
+		return exitError
+	}
+
+	report, err := manifest.Verify(*root, entries, samePath(manifestPath))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning %s: %v\n", *root, err)
+		return exitError
+	}
+
+	if !*quiet {
+		for _, p := range report.Missing {
+			fmt.Printf("MISSING  %s\n", p)
+		}
+		for _, p := range report.Added {
+			fmt.Printf("ADDED    %s\n", p)
+		}
+		for _, p := range report.Mismatched {
+			fmt.Printf("CHANGED  %s\n", p)
+		}
+		for _, e := range report.Unreadable {
+			fmt.Printf("ERROR    %s (%s)\n", e.Path, e.Err)
+		}
+	}
+
+	fmt.Printf("\n=== VERIFY RESULTS ===\n")
+	fmt.Printf("Matched: %d\n", report.Matched)
+	fmt.Printf("Missing: %d\n", len(report.Missing))
+	fmt.Printf("Added: %d\n", len(report.Added))
+	fmt.Printf("Hash Mismatches: %d\n", len(report.Mismatched))
+	fmt.Printf("Unreadable: %d\n", len(report.Unreadable))
+
+	if !report.Clean() {
+		return exitChanged
+	}
+	return exitOK
+}
+
+// samePath returns a skip func matching the given file, so a manifest stored
+// inside the tree it describes does not report itself as added or changed.
+func samePath(target string) func(string) bool {
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		return nil
+	}
+	return func(path string) bool {
+		p, err := filepath.Abs(path)
+		return err == nil && p == abs
+	}
+}
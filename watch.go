@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"file-counter/pkg/churn"
+	"file-counter/pkg/index"
+	"file-counter/pkg/scanner"
+	"file-counter/pkg/watch"
+)
+
+// watchReport is one line of watch -json output.
+type watchReport struct {
+	Root      string      `json:"root"`
+	Delta     watch.Delta `json:"delta"`
+	PerMinute watch.Rate  `json:"per_minute_1m"`
+	Per5      watch.Rate  `json:"per_minute_5m"`
+}
+
+// topProcs is how many processes watch -procs names each interval.
+const topProcs = 5
+
+// churnReport is a watch -procs -json line, with no root: the processes,
+// anywhere on the system, that created and deleted the most files during
+// the interval.
+type churnReport struct {
+	At        time.Time    `json:"at"`
+	Processes []churn.Proc `json:"processes"`
+}
+
+// liveReport is one line of watch -live -json output. Change is the
+// difference in the counts since the previous line.
+type liveReport struct {
+	Root   string          `json:"root"`
+	At     time.Time       `json:"at"`
+	Counts watch.Counts    `json:"counts"`
+	Change watch.Counts    `json:"change"`
+	Stats  watch.LiveStats `json:"stats"`
+}
+
+// watchOptions are the index options for watching root: the default skip
+// rules, less those that contain root.
+func watchOptions(root string) index.Options {
+	return index.Options{Skip: scanner.SkipFunc(root)}
+}
+
+// runWatch polls trees for changes and reports rolling rates of change.
+func runWatch(args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	interval := fs.Duration("interval", 10*time.Second, "look for changes this often")
+	jsonOut := fs.Bool("json", false, "write one JSON object per root and interval instead of text")
+	live := fs.Bool("live", false, "keep exact counts from inotify (Linux) or FSEvents (macOS) events instead of polling")
+	mtimes := fs.Bool("mtime", false, "find changes by comparing directory mtimes, without inotify or FSEvents")
+	procs := fs.Bool("procs", false, "also name the processes creating and deleting the most files, with eBPF (experimental, Linux, root)")
+	logs := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: file-counter watch [-interval 10s] [-json] [-live] [-mtime] [-procs] [-log-file file] <path>...")
+		fmt.Fprintln(os.Stderr, "Reports files created, deleted and modified and bytes written per minute under each path.")
+		fmt.Fprintln(os.Stderr, "With -live, reports the exact counts of each path instead, kept up to date as it changes.")
+		fmt.Fprintln(os.Stderr, "With -procs, also names the processes that created and deleted the most files anywhere.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 || *interval <= 0 {
+		fs.Usage()
+		return exitError
+	}
+	out, errs, closeLog, err := logs.open()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	defer closeLog()
+
+	var mon *churn.Monitor
+	if *procs {
+		if mon, err = churn.Start(); err != nil {
+			fmt.Fprintf(errs, "Error: -procs: %v\n", err)
+			return exitError
+		}
+		defer mon.Close()
+	}
+
+	if *live {
+		return runLiveWatch(fs.Args(), *interval, *jsonOut, mon, out, errs)
+	}
+	type watched struct {
+		ix    *index.Index
+		opts  index.Options
+		rates *watch.Rates
+	}
+	var roots []*watched
+	for _, root := range fs.Args() {
+		// Where the platform has events, they say which directories to
+		// list again, so that the rest of the tree isn't stat'ed.
+		ropts := watchOptions(root)
+		if !*mtimes && watch.LiveBackend != "" {
+			l, err := watch.NewLive(root, ropts)
+			if err != nil {
+				fmt.Fprintf(errs, "Warning: %v; comparing mtimes instead\n", err)
+			} else {
+				defer l.Close()
+				ropts.Changes = l
+				if st := l.Stats(); st.Unwatched > 0 {
+					fmt.Fprintf(errs, "Warning: %s: %s; listing %d directories again every interval\n", l.Root, st.Limit, st.Unwatched)
+				}
+			}
+		}
+		ix, err := index.Build(root, ropts)
+		if err != nil {
+			fmt.Fprintf(errs, "Error: %v\n", err)
+			return exitError
+		}
+		roots = append(roots, &watched{ix: ix, opts: ropts, rates: watch.NewRates(5 * time.Minute)})
+		if !*jsonOut {
+			fmt.Fprintf(out, "Watching %s (%d files)\n", ix.Root, ix.Files)
+		}
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	enc := json.NewEncoder(out)
+	for {
+		select {
+		case <-sigChan:
+			return exitOK
+		case <-ticker.C:
+		}
+		for _, w := range roots {
+			cur, _, err := index.Update(w.ix, w.opts)
+			if err != nil {
+				fmt.Fprintf(errs, "Error: %s: %v\n", w.ix.Root, err)
+				continue
+			}
+			d := watch.Diff(w.ix, cur)
+			w.ix = cur
+			w.rates.Add(d)
+			rate := w.rates.PerMinute(time.Minute)
+			if *jsonOut {
+				enc.Encode(watchReport{Root: cur.Root, Delta: d, PerMinute: rate, Per5: w.rates.PerMinute(5 * time.Minute)})
+				continue
+			}
+			line := fmt.Sprintf("%s %s: %.0f created, %.0f deleted, %.0f modified, %s written per minute",
+				d.At.Local().Format("15:04:05"), cur.Root, rate.Created, rate.Deleted, rate.Modified, scanner.FormatBytes(int64(rate.BytesWritten)))
+			if len(d.Top) > 0 {
+				line += fmt.Sprintf(" (most in %s)", d.Top[0].Dir)
+			}
+			fmt.Fprintln(out, line)
+		}
+		reportChurn(mon, time.Now(), *jsonOut, enc, out, errs)
+	}
+}
+
+// runLiveWatch watches every directory of each root and reports its
+// counts every interval. Directories past the watch limit are walked again
+// each interval instead.
+func runLiveWatch(paths []string, interval time.Duration, jsonOut bool, mon *churn.Monitor, out, errs io.Writer) int {
+	type watched struct {
+		live   *watch.Live
+		last   watch.Counts
+		warned bool
+	}
+	var roots []*watched
+	for _, root := range paths {
+		l, err := watch.NewLive(root, watchOptions(root))
+		if err != nil {
+			fmt.Fprintf(errs, "Error: %v\n", err)
+			return exitError
+		}
+		defer l.Close()
+		c := l.Counts()
+		roots = append(roots, &watched{live: l, last: c})
+		if !jsonOut {
+			fmt.Fprintf(out, "Watching %s live (%d files, %d dirs, %s; %d watches)\n",
+				l.Root, c.Files, c.Dirs, scanner.FormatBytes(c.Bytes), l.Stats().Watches)
+		}
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	enc := json.NewEncoder(out)
+	for {
+		select {
+		case <-sigChan:
+			return exitOK
+		case now := <-ticker.C:
+			for _, w := range roots {
+				w.live.Poll()
+				if err := w.live.Err(); err != nil {
+					fmt.Fprintf(errs, "Error: %v\n", err)
+					return exitError
+				}
+				c, st := w.live.Counts(), w.live.Stats()
+				if st.Unwatched > 0 && !w.warned {
+					fmt.Fprintf(errs, "Warning: %s: %s; walking %d directories every %s instead\n", w.live.Root, st.Limit, st.Unwatched, interval)
+					w.warned = true
+				}
+				change := watch.Counts{Files: c.Files - w.last.Files, Dirs: c.Dirs - w.last.Dirs, Bytes: c.Bytes - w.last.Bytes}
+				w.last = c
+				if jsonOut {
+					enc.Encode(liveReport{Root: w.live.Root, At: now.UTC(), Counts: c, Change: change, Stats: st})
+					continue
+				}
+				fmt.Fprintf(out, "%s %s: %d files (%+d), %d dirs (%+d), %s (%s)\n", now.Format("15:04:05"), w.live.Root,
+					c.Files, change.Files, c.Dirs, change.Dirs, scanner.FormatBytes(c.Bytes), signedBytes(change.Bytes))
+			}
+			reportChurn(mon, now, jsonOut, enc, out, errs)
+		}
+	}
+}
+
+// reportChurn names the processes that created and deleted the most files
+// since the last interval, if mon is set.
+func reportChurn(mon *churn.Monitor, now time.Time, jsonOut bool, enc *json.Encoder, out, errs io.Writer) {
+	if mon == nil {
+		return
+	}
+	procs, err := mon.Read()
+	if err != nil {
+		fmt.Fprintf(errs, "Error: -procs: %v\n", err)
+		return
+	}
+	if len(procs) > topProcs {
+		procs = procs[:topProcs]
+	}
+	if jsonOut {
+		enc.Encode(churnReport{At: now.UTC(), Processes: procs})
+		return
+	}
+	if len(procs) == 0 {
+		return
+	}
+	var names []string
+	for _, p := range procs {
+		names = append(names, fmt.Sprintf("%s %d created, %d deleted", p, p.Created, p.Deleted))
+	}
+	fmt.Fprintf(out, "%s busiest processes: %s\n", now.Local().Format("15:04:05"), strings.Join(names, "; "))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"file-counter/pkg/index"
+	"file-counter/pkg/watch"
+)
+
+func TestWatchUnderTmp(t *testing.T) {
+	root := tmpTree(t, map[string]string{"a": "1", "sub/b": "22", "sub/deeper/c": "333"})
+	opts := watchOptions(root)
+
+	ix, err := index.Build(root, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ix.Files != 3 {
+		t.Fatalf("Watching %s found %d files, expected 3", root, ix.Files)
+	}
+	if err := os.WriteFile(filepath.Join(root, "new"), []byte("4444"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cur, _, err := index.Update(ix, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := watch.Diff(ix, cur); d.Created != 1 || d.BytesWritten != 4 {
+		t.Errorf("Expected 1 file of 4 bytes created, got %d created, %d bytes written", d.Created, d.BytesWritten)
+	}
+
+	if watch.LiveBackend == "" {
+		return
+	}
+	l, err := watch.NewLive(root, opts)
+	if err != nil {
+		t.Skipf("Live watching unavailable: %v", err)
+	}
+	defer l.Close()
+	if c := l.Counts(); c.Files != 4 || c.Dirs != 3 {
+		t.Errorf("Live counts %+v, expected 4 files in 3 directories", c)
+	}
+}